@@ -0,0 +1,275 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// alertCheckInterval is how often time-based rule conditions (expiring
+// thresholds, absence) are re-evaluated.
+const alertCheckInterval = 10 * time.Second
+
+const (
+	alertKindThreshold = "threshold"
+	alertKindAbsence   = "absence"
+)
+
+// jsonDuration is a time.Duration written as a Go duration string ("5m").
+type jsonDuration struct {
+	time.Duration
+}
+
+func (d *jsonDuration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	d.Duration = parsed
+	return nil
+}
+
+func (d jsonDuration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+// AlertRule fires its actions either when more than MoreThan matching
+// webhooks arrive Within a sliding window, or when no matching webhook has
+// arrived for AbsentFor. Match uses the same parameters as /query.
+type AlertRule struct {
+	Name      string           `json:"name"`
+	Match     json.RawMessage  `json:"match"`
+	MoreThan  int              `json:"more_than,omitempty"`
+	Within    jsonDuration     `json:"within,omitempty"`
+	AbsentFor jsonDuration     `json:"absent_for,omitempty"`
+	Actions   []NotifierConfig `json:"actions"`
+}
+
+func (r AlertRule) kind() string {
+	if r.AbsentFor.Duration > 0 {
+		return alertKindAbsence
+	}
+	return alertKindThreshold
+}
+
+// LoadAlertRules reads a JSON array of alert rules from path.
+func LoadAlertRules(path string) ([]AlertRule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var rules []AlertRule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return rules, nil
+}
+
+type alertState struct {
+	rule      AlertRule
+	filter    QueryFilter
+	notifiers []Notifier
+	hits      []time.Time
+	lastSeen  time.Time
+	firing    bool
+	lastFired time.Time
+}
+
+// AlertStatus is the externally visible state of a rule.
+type AlertStatus struct {
+	Name      string     `json:"name"`
+	Kind      string     `json:"kind"`
+	Firing    bool       `json:"firing"`
+	Count     int        `json:"count"`
+	LastSeen  *time.Time `json:"last_seen,omitempty"`
+	LastFired *time.Time `json:"last_fired,omitempty"`
+}
+
+// AlertEngine evaluates alert rules against ingested webhooks and the passage
+// of time, dispatching notifiers when a rule starts firing.
+type AlertEngine struct {
+	mu       sync.Mutex
+	rules    []*alertState
+	now      func() time.Time
+	dispatch func(Alert, []Notifier)
+}
+
+func NewAlertEngine(rules []AlertRule) (*AlertEngine, error) {
+	engine := &AlertEngine{now: time.Now}
+	engine.dispatch = notifyAsync
+
+	started := engine.now()
+	for _, rule := range rules {
+		if rule.Name == "" {
+			return nil, errors.New("alert rule without name")
+		}
+		switch {
+		case rule.AbsentFor.Duration > 0 && (rule.MoreThan > 0 || rule.Within.Duration > 0):
+			return nil, fmt.Errorf("alert rule %s: absent_for cannot be combined with more_than/within", rule.Name)
+		case rule.AbsentFor.Duration == 0 && rule.Within.Duration <= 0:
+			return nil, fmt.Errorf("alert rule %s: needs either absent_for or within", rule.Name)
+		}
+
+		params, err := decodeParams(rule.Match)
+		if err != nil {
+			return nil, fmt.Errorf("alert rule %s: match: %w", rule.Name, err)
+		}
+		filter, err := parseQueryFilter(params, "")
+		if err != nil {
+			return nil, fmt.Errorf("alert rule %s: match: %w", rule.Name, err)
+		}
+
+		state := &alertState{rule: rule, filter: filter, lastSeen: started}
+		for _, cfg := range rule.Actions {
+			n, err := newNotifier(cfg)
+			if err != nil {
+				return nil, fmt.Errorf("alert rule %s: %w", rule.Name, err)
+			}
+			state.notifiers = append(state.notifiers, n)
+		}
+		engine.rules = append(engine.rules, state)
+	}
+	return engine, nil
+}
+
+func (e *AlertEngine) OnIngest(item WebhookParams, body []byte) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	now := e.now()
+	for _, s := range e.rules {
+		if !s.filter.Match(item) {
+			continue
+		}
+		s.lastSeen = now
+
+		switch s.rule.kind() {
+		case alertKindAbsence:
+			s.firing = false
+		case alertKindThreshold:
+			s.hits = append(s.hits, now)
+			e.evaluateThreshold(s, now)
+		}
+	}
+}
+
+// Check re-evaluates rules whose state depends on elapsed time.
+func (e *AlertEngine) Check() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	now := e.now()
+	for _, s := range e.rules {
+		switch s.rule.kind() {
+		case alertKindAbsence:
+			if !s.firing && now.Sub(s.lastSeen) > s.rule.AbsentFor.Duration {
+				e.fire(s, now, 0, fmt.Sprintf("No matching webhook seen for %s", s.rule.AbsentFor))
+			}
+		case alertKindThreshold:
+			e.evaluateThreshold(s, now)
+		}
+	}
+}
+
+func (e *AlertEngine) evaluateThreshold(s *alertState, now time.Time) {
+	cutoff := now.Add(-s.rule.Within.Duration)
+	keep := 0
+	for keep < len(s.hits) && !s.hits[keep].After(cutoff) {
+		keep++
+	}
+	s.hits = s.hits[keep:]
+
+	count := len(s.hits)
+	if count <= s.rule.MoreThan {
+		s.firing = false
+		return
+	}
+	if !s.firing {
+		e.fire(s, now, count, fmt.Sprintf("%d matching webhooks within %s (threshold %d)",
+			count, s.rule.Within, s.rule.MoreThan))
+	}
+}
+
+func (e *AlertEngine) fire(s *alertState, now time.Time, count int, message string) {
+	s.firing = true
+	s.lastFired = now
+	alert := Alert{
+		Rule:       s.rule.Name,
+		Kind:       s.rule.kind(),
+		EventTypes: s.filter.EventTypes,
+		Message:    message,
+		Count:      count,
+		FiredAt:    now.UTC(),
+	}
+	log.Printf("Alert %s fired: %s", alert.Rule, alert.Message)
+	e.dispatch(alert, s.notifiers)
+}
+
+// notifyAsync runs each notifier in its own goroutine, logging failures.
+func notifyAsync(alert Alert, notifiers []Notifier) {
+	for _, n := range notifiers {
+		go func(n Notifier) {
+			ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+			defer cancel()
+			if err := n.Notify(ctx, alert); err != nil {
+				log.Printf("Alert %s notification failed: %v", alert.Rule, err)
+			}
+		}(n)
+	}
+}
+
+// Run periodically calls Check until ctx is cancelled.
+func (e *AlertEngine) Run(ctx context.Context) {
+	ticker := time.NewTicker(alertCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			e.Check()
+		}
+	}
+}
+
+func (e *AlertEngine) Status() []AlertStatus {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	statuses := make([]AlertStatus, 0, len(e.rules))
+	for _, s := range e.rules {
+		status := AlertStatus{
+			Name:   s.rule.Name,
+			Kind:   s.rule.kind(),
+			Firing: s.firing,
+			Count:  len(s.hits),
+		}
+		if s.rule.kind() == alertKindAbsence {
+			lastSeen := s.lastSeen.UTC()
+			status.LastSeen = &lastSeen
+		}
+		if !s.lastFired.IsZero() {
+			lastFired := s.lastFired.UTC()
+			status.LastFired = &lastFired
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+func alertsHandler(engine *AlertEngine) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(engine.Status())
+	}
+}
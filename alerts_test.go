@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type fakeClock struct{ t time.Time }
+
+func (c *fakeClock) now() time.Time          { return c.t }
+func (c *fakeClock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func newTestAlertEngine(t *testing.T, rulesJSON string) (*AlertEngine, *fakeClock, *[]Alert) {
+	t.Helper()
+	var rules []AlertRule
+	if err := json.Unmarshal([]byte(rulesJSON), &rules); err != nil {
+		t.Fatalf("bad rules: %v", err)
+	}
+	engine, err := NewAlertEngine(rules)
+	if err != nil {
+		t.Fatalf("NewAlertEngine: %v", err)
+	}
+
+	clock := &fakeClock{t: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	engine.now = clock.now
+	for _, s := range engine.rules {
+		s.lastSeen = clock.t
+	}
+	var fired []Alert
+	engine.dispatch = func(a Alert, _ []Notifier) { fired = append(fired, a) }
+	return engine, clock, &fired
+}
+
+func TestAlertThresholdRule(t *testing.T) {
+	engine, clock, fired := newTestAlertEngine(t, `[{
+		"name": "payment-failures",
+		"match": {"event_type": "payment.failed"},
+		"more_than": 2,
+		"within": "5m"
+	}]`)
+
+	failed := WebhookParams{EventType: "payment.failed"}
+	engine.OnIngest(failed, nil)
+	engine.OnIngest(WebhookParams{EventType: "payment.succeeded"}, nil)
+	engine.OnIngest(failed, nil)
+	if len(*fired) != 0 {
+		t.Fatalf("expected no alert at threshold, got %v", *fired)
+	}
+
+	engine.OnIngest(failed, nil)
+	engine.OnIngest(failed, nil)
+	if len(*fired) != 1 || (*fired)[0].Count != 3 {
+		t.Fatalf("expected a single alert with count 3, got %v", *fired)
+	}
+
+	// Once the window slides past the burst the rule re-arms.
+	clock.advance(6 * time.Minute)
+	engine.Check()
+	if engine.Status()[0].Firing {
+		t.Error("expected rule to stop firing after the window passed")
+	}
+	for i := 0; i < 3; i++ {
+		engine.OnIngest(failed, nil)
+	}
+	if len(*fired) != 2 {
+		t.Errorf("expected the rule to fire again, got %d alerts", len(*fired))
+	}
+}
+
+func TestAlertAbsenceRule(t *testing.T) {
+	engine, clock, fired := newTestAlertEngine(t, `[{
+		"name": "no-shipments",
+		"match": {"event_type": "order.shipped"},
+		"absent_for": "1h"
+	}]`)
+
+	clock.advance(30 * time.Minute)
+	engine.OnIngest(WebhookParams{EventType: "order.shipped"}, nil)
+	clock.advance(45 * time.Minute)
+	engine.Check()
+	if len(*fired) != 0 {
+		t.Fatalf("expected no alert yet, got %v", *fired)
+	}
+
+	clock.advance(30 * time.Minute)
+	engine.Check()
+	engine.Check()
+	if len(*fired) != 1 || (*fired)[0].Kind != alertKindAbsence {
+		t.Fatalf("expected one absence alert, got %v", *fired)
+	}
+
+	engine.OnIngest(WebhookParams{EventType: "order.shipped"}, nil)
+	if engine.Status()[0].Firing {
+		t.Error("expected a matching webhook to clear the absence alert")
+	}
+}
+
+func TestAlertRuleValidation(t *testing.T) {
+	for _, rules := range []string{
+		`[{"match": {"event_type": "x"}, "within": "1m"}]`,
+		`[{"name": "a", "match": {"event_type": "x"}}]`,
+		`[{"name": "a", "match": {"event_type": "x"}, "absent_for": "1m", "more_than": 1}]`,
+		`[{"name": "a", "match": {"status": "x"}, "within": "1m"}]`,
+		`[{"name": "a", "match": {"event_type": "x"}, "within": "1m", "actions": [{"type": "pager"}]}]`,
+	} {
+		var parsed []AlertRule
+		if err := json.Unmarshal([]byte(rules), &parsed); err != nil {
+			t.Fatalf("bad test rules %s: %v", rules, err)
+		}
+		if _, err := NewAlertEngine(parsed); err == nil {
+			t.Errorf("expected rules to be rejected: %s", rules)
+		}
+	}
+}
+
+func TestWebhookNotifier(t *testing.T) {
+	received := make(chan Alert, 1)
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var a Alert
+		json.Unmarshal(body, &a)
+		received <- a
+	}))
+	defer target.Close()
+
+	n, err := newNotifier(NotifierConfig{Type: "webhook", URL: target.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := n.Notify(context.Background(), Alert{Rule: "r1", Message: "boom"}); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+	if a := <-received; a.Rule != "r1" || a.Message != "boom" {
+		t.Errorf("unexpected alert delivered: %+v", a)
+	}
+}
+
+func TestLoadAlertRules(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.json")
+	os.WriteFile(path, []byte(`[{"name":"a","match":{"event_type":"x"},"more_than":1,"within":"30s"}]`), 0o644)
+
+	rules, err := LoadAlertRules(path)
+	if err != nil {
+		t.Fatalf("LoadAlertRules: %v", err)
+	}
+	if len(rules) != 1 || rules[0].Within.Duration != 30*time.Second {
+		t.Errorf("unexpected rules: %+v", rules)
+	}
+}
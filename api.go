@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// apiVersion is the current version of the query/admin API. Versioned routes
+// live under /v1; the unversioned routes remain as deprecated aliases.
+const apiVersion = "1"
+
+const codeUnsupportedVersion = "unsupported_api_version"
+
+// withAPIVersion negotiates the X-API-Version header: requests asking for a
+// version this server does not speak are rejected, and every response
+// advertises the version that served it.
+func withAPIVersion(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if v := r.Header.Get("X-API-Version"); v != "" && v != apiVersion {
+			writeProblem(w, r, http.StatusBadRequest, codeUnsupportedVersion,
+				"Unsupported API version "+v+", supported: "+apiVersion)
+			return
+		}
+		w.Header().Set("X-API-Version", apiVersion)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// deprecatedAlias marks a legacy unversioned route as deprecated and points
+// clients at its /v1 successor.
+func deprecatedAlias(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Deprecation", "true")
+		w.Header().Set("Link", "<"+externalPath("/v"+apiVersion+r.URL.Path)+`>; rel="successor-version"`)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// handleAPI registers an API route under the /v1 prefix and as a deprecated
+// unversioned alias. The pattern is given without the prefix, e.g.
+// "GET /query/{event_type}".
+func handleAPI(mux *http.ServeMux, pattern string, h http.Handler) {
+	method, path, ok := strings.Cut(pattern, " ")
+	if !ok {
+		method, path = "", pattern
+	} else {
+		method += " "
+	}
+
+	versioned := withAPIVersion(h)
+	mux.Handle(method+"/v"+apiVersion+path, versioned)
+	mux.Handle(method+path, deprecatedAlias(versioned))
+}
+
+// isVersioned reports whether r came in on a /v1 route rather than on its
+// deprecated alias.
+func isVersioned(r *http.Request) bool {
+	return strings.HasPrefix(r.URL.Path, "/v"+apiVersion+"/")
+}
+
+// QueryResult is the /v1 response to a query. EvictedSince counts the
+// records evicted since the server started and OldestRetainedAt is when the
+// oldest record still held was received, so that a client can tell a record
+// that never arrived from one that was already evicted.
+type QueryResult struct {
+	Items            []WebhookParams `json:"items"`
+	Total            int             `json:"total"`
+	EvictedSince     uint64          `json:"evicted_since"`
+	OldestRetainedAt *time.Time      `json:"oldest_retained_at"`
+	// Truncated is set when the scan ran out of time and Items are only the
+	// matches found until then.
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// QueryResult runs filter and reports the buffer's retention along with the
+// matches, all from the same Snapshot.
+func (rb *RingBuffer) QueryResult(ctx context.Context, filter QueryFilter) QueryResult {
+	snap := rb.Snapshot()
+	res := QueryResult{EvictedSince: snap.evicted}
+	res.Items, res.Truncated = snap.query(ctx, filter)
+	if res.Items == nil {
+		res.Items = []WebhookParams{}
+	}
+	res.Total = len(res.Items)
+	if snap.count > 0 {
+		oldest := snap.at(snap.newest(snap.count - 1)).ReceivedAt
+		res.OldestRetainedAt = &oldest
+	}
+	return res
+}
+
+// queryTimeout bounds the buffer scans done for a request; 0 leaves them
+// bounded by the request's own context only.
+var queryTimeout = 10 * time.Second
+
+// scanContext returns the context buffer scans for r run under.
+func scanContext(r *http.Request) (context.Context, context.CancelFunc) {
+	if queryTimeout <= 0 {
+		return context.WithCancel(r.Context())
+	}
+	return context.WithTimeout(r.Context(), queryTimeout)
+}
+
+// writeQueryResults answers a query with a QueryResult on /v1 routes and
+// with the bare list of matches on the deprecated aliases, which flag a
+// truncated scan with X-Echo-Truncated instead. Both stream the matches as
+// NDJSON when asked to with Accept.
+func writeQueryResults(w http.ResponseWriter, r *http.Request, buffer *RingBuffer, filter QueryFilter) {
+	ctx, cancel := scanContext(r)
+	defer cancel()
+	if strings.Contains(r.Header.Get("Accept"), ndjsonContentType) {
+		streamQueryResults(ctx, w, buffer, filter)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if !isVersioned(r) {
+		items, truncated := buffer.Query(ctx, filter)
+		if truncated {
+			w.Header().Set("X-Echo-Truncated", "true")
+		}
+		previewItems(items)
+		flattenItems(items, filter)
+		json.NewEncoder(w).Encode(items)
+		return
+	}
+	res := buffer.QueryResult(ctx, filter)
+	previewItems(res.Items)
+	flattenItems(res.Items, filter)
+	json.NewEncoder(w).Encode(res)
+}
+
+const ndjsonContentType = "application/x-ndjson"
+
+// streamQueryResults writes one match per line, newest first, flushing each
+// as it is found so the client can start on the first before the scan ends.
+// Whether the scan was cut short is only known at the end, so it is sent as
+// the X-Echo-Truncated trailer.
+func streamQueryResults(ctx context.Context, w http.ResponseWriter, buffer *RingBuffer, filter QueryFilter) {
+	w.Header().Set("Content-Type", ndjsonContentType)
+	w.Header().Set("Trailer", "X-Echo-Truncated")
+	rc := http.NewResponseController(w)
+	enc := json.NewEncoder(w)
+	truncated := buffer.Snapshot().Scan(ctx, filter, func(item WebhookParams) bool {
+		item = previewRecord(item)
+		if filter.Flatten {
+			item.Payload = flattenPayload(item.Payload)
+		}
+		if enc.Encode(item) != nil {
+			return false
+		}
+		rc.Flush()
+		return true
+	})
+	w.Header().Set("X-Echo-Truncated", strconv.FormatBool(truncated))
+}
+
+// newIngestMux serves only the ingest endpoint, /healthz and share links,
+// for the public listener when the APIs are bound to -admin-addr instead.
+func newIngestMux(recorder *Recorder, monitor *CapacityMonitor) *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /", recordWebhookHandler(recorder))
+	mux.HandleFunc("GET /healthz", healthHandler(monitor))
+	mux.HandleFunc("GET /shared/{token}", sharedWebhookHandler(recorder.buffer))
+	return mux
+}
+
+// registerRoutes mounts the ingest endpoint and the query API. Routes that
+// change stored state need adminToken. The hooks are run for every newly
+// recorded webhook. The returned Recorder lets other
+// ingest sources feed the same store and hooks.
+func registerRoutes(mux *http.ServeMux, buffer *RingBuffer, adminToken string, hooks ...IngestHook) *Recorder {
+	eventTypes := NewEventTypeIndex()
+	stream := NewEventStream()
+	saved := NewSavedQueries()
+	recorder := NewRecorder(buffer, append([]IngestHook{eventTypes, stream}, hooks...)...)
+	recorder.adminToken = adminToken
+	for _, hook := range hooks {
+		// Subscriptions are made before the routes, but match against the
+		// saved queries mounted here.
+		if subs, ok := hook.(*Subscriptions); ok {
+			subs.saved = saved
+		}
+	}
+
+	mux.HandleFunc("POST /", recordWebhookHandler(recorder))
+	handleAPI(mux, "GET /query", queryWebhookHandler(buffer))
+	handleAPI(mux, "GET /query/{event_type}", queryWebhookHandler(buffer))
+	handleAPI(mux, "GET /event-types", eventTypesHandler(eventTypes))
+	handleAPI(mux, "GET /id-strategy", idStrategyHandler())
+	handleAPI(mux, "GET /stream", streamHandler(stream, saved))
+	handleAPI(mux, "GET /stream/{event_type}", streamHandler(stream, saved))
+	handleAPI(mux, "GET /report", reportHandler(buffer, eventTypes))
+	handleAPI(mux, "GET /webhooks/{id}", getWebhookHandler(buffer))
+	handleAPI(mux, "GET /webhooks/{id}/raw", rawWebhookHandler(buffer))
+	handleAPI(mux, "GET /webhooks/{id}/body", bodyWebhookHandler(buffer))
+	handleAPI(mux, "GET /webhooks/{id}/canonical", canonicalWebhookHandler(buffer))
+	handleAPI(mux, "POST /webhooks/{id}/attachments", requireAdmin(adminToken, attachHandler(buffer)))
+	handleAPI(mux, "GET /webhooks/{id}/attachments/{name}", getAttachmentHandler(buffer))
+	handleAPI(mux, "POST /webhooks/{id}/share", requireAdmin(adminToken, shareHandler(buffer)))
+	mux.HandleFunc("GET /shared/{token}", sharedWebhookHandler(buffer))
+	handleAPI(mux, "POST /debug/signature", signatureDebugHandler())
+	handleAPI(mux, "POST /canonicalize", canonicalizeHandler())
+	handleAPI(mux, "GET /cassette", cassetteHandler(buffer))
+	handleAPI(mux, "GET /cassette/{event_type}", cassetteHandler(buffer))
+	registerSavedQueryRoutes(mux, buffer, saved, adminToken)
+	registerCatalogRoutes(mux, buffer, eventTypes, NewCatalog(), adminToken)
+	registerConsumeRoutes(mux, buffer, NewConsumers(), adminToken)
+	return recorder
+}
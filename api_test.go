@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestVersionedQueryRoute(t *testing.T) {
+	mux := newTestServer()
+	postWebhook(t, mux, `{"event":"user","data":{},"version":"1"}`)
+
+	results := queryWebhooks(t, mux, "/v1/query/user")
+	if len(results) != 1 {
+		t.Errorf("expected 1 result, got %d", len(results))
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/query/user", nil)
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	if rec.Header().Get("X-API-Version") != apiVersion {
+		t.Errorf("expected X-API-Version %s, got %q", apiVersion, rec.Header().Get("X-API-Version"))
+	}
+	if rec.Header().Get("Deprecation") != "" {
+		t.Error("versioned route should not be marked deprecated")
+	}
+}
+
+func TestLegacyRouteIsDeprecatedAlias(t *testing.T) {
+	mux := newTestServer()
+
+	req := httptest.NewRequest(http.MethodGet, "/query/user", nil)
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rec.Code)
+	}
+	if rec.Header().Get("Deprecation") != "true" {
+		t.Error("expected Deprecation header on legacy route")
+	}
+	if want := `</v1/query/user>; rel="successor-version"`; rec.Header().Get("Link") != want {
+		t.Errorf("expected Link %s, got %s", want, rec.Header().Get("Link"))
+	}
+}
+
+func TestUnsupportedAPIVersion(t *testing.T) {
+	mux := newTestServer()
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/query/user", nil)
+	req.Header.Set("X-API-Version", "2")
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected status 400, got %d", rec.Code)
+	}
+	if p := decodeProblem(t, rec); p.Code != codeUnsupportedVersion {
+		t.Errorf("expected code %s, got %s", codeUnsupportedVersion, p.Code)
+	}
+}
+
+func TestVersionedQueryEnvelope(t *testing.T) {
+	buffer := NewRingBuffer(2)
+	mux := http.NewServeMux()
+	registerRoutes(mux, buffer, "secret")
+
+	query := func() QueryResult {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/query/order", nil))
+		var res QueryResult
+		if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+			t.Fatalf("failed to parse envelope: %v: %s", err, rec.Body)
+		}
+		return res
+	}
+	if res := query(); res.Items == nil || res.Total != 0 || res.OldestRetainedAt != nil {
+		t.Errorf("expected an empty envelope, got %+v", res)
+	}
+
+	postWebhook(t, mux, `{"event":"order","data":{"n":1}}`)
+	postWebhook(t, mux, `{"event":"order","data":{"n":2}}`)
+	postWebhook(t, mux, `{"event":"user","data":{}}`)
+	res := query()
+	if res.Total != 1 || res.EvictedSince != 1 || res.OldestRetainedAt == nil {
+		t.Fatalf("unexpected envelope %+v", res)
+	}
+	if !res.OldestRetainedAt.Equal(res.Items[0].ReceivedAt) {
+		t.Errorf("expected the oldest retained record to be the remaining order, got %s", res.OldestRetainedAt)
+	}
+
+	if legacy := queryWebhooks(t, mux, "/query/order"); len(legacy) != 1 {
+		t.Errorf("expected the legacy route to keep returning a list, got %+v", legacy)
+	}
+}
+
+func TestQueryTruncatedWhenContextDone(t *testing.T) {
+	buffer := NewRingBuffer(10)
+	mux := http.NewServeMux()
+	registerRoutes(mux, buffer, "secret")
+	postWebhook(t, mux, `{"event":"order","data":{}}`)
+
+	if items, truncated := buffer.Query(context.Background(), QueryFilter{EventTypes: []string{"order"}}); truncated || len(items) != 1 {
+		t.Fatalf("expected a complete scan, got %d items, truncated %v", len(items), truncated)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/query/order", nil).WithContext(ctx))
+	var res QueryResult
+	if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+	if !res.Truncated || res.Total != 0 {
+		t.Errorf("expected a truncated envelope, got %+v", res)
+	}
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/query/order", nil).WithContext(ctx))
+	if rec.Header().Get("X-Echo-Truncated") != "true" {
+		t.Errorf("expected X-Echo-Truncated on the legacy route, got %v", rec.Header())
+	}
+}
+
+func TestIngestMuxOnlyAcceptsWebhooks(t *testing.T) {
+	buffer := NewRingBuffer(10)
+	admin := http.NewServeMux()
+	recorder := registerRoutes(admin, buffer, "secret")
+	public := withProblemFallback(newIngestMux(recorder, NewCapacityMonitor(buffer, nil, 0, nil)))
+
+	rec := httptest.NewRecorder()
+	public.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/hooks/stripe", strings.NewReader(`{"event":"order","data":{}}`)))
+	if rec.Code != http.StatusOK || rec.Header().Get("X-Echo-Id") == "" {
+		t.Fatalf("expected the webhook to be recorded, got %d", rec.Code)
+	}
+	rec = httptest.NewRecorder()
+	public.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("expected /healthz on the ingest listener, got %d", rec.Code)
+	}
+	for _, path := range []string{"/v1/query/order", "/query/order", "/v1/webhooks/" + buffer.Snapshot().at(0).ID} {
+		rec = httptest.NewRecorder()
+		public.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code < 400 {
+			t.Errorf("%s: expected the API to be unreachable on the ingest listener, got %d", path, rec.Code)
+		}
+	}
+
+	if got := queryWebhooks(t, admin, "/v1/query/order"); len(got) != 1 {
+		t.Errorf("expected the record on the admin listener, got %d", len(got))
+	}
+}
+
+func TestQueryStreamsNDJSON(t *testing.T) {
+	mux := newTestServer()
+	for _, status := range []string{"a", "b", "c"} {
+		postWebhook(t, mux, `{"event": "order", "data": {"status": "`+status+`", "kind": "x"}}`)
+	}
+	for _, path := range []string{"/v1/query/order?kind=x", "/query/order?kind=x"} {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Accept", "application/x-ndjson")
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+
+		lines := strings.Split(strings.TrimSpace(rec.Body.String()), "\n")
+		if rec.Header().Get("Content-Type") != "application/x-ndjson" || len(lines) != 3 {
+			t.Fatalf("%s: expected three NDJSON lines, got %q", path, rec.Body)
+		}
+		var newest WebhookParams
+		if err := json.Unmarshal([]byte(lines[0]), &newest); err != nil || newest.Payload["status"] != "c" {
+			t.Errorf("%s: expected the newest record first, got %s", path, lines[0])
+		}
+		if trailer := rec.Result().Trailer.Get("X-Echo-Truncated"); trailer != "false" {
+			t.Errorf("%s: expected the X-Echo-Truncated trailer, got %q", path, trailer)
+		}
+	}
+}
@@ -0,0 +1,301 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// maxAssertionRecords bounds the matched records kept and reported per
+	// assertion; Matched keeps counting past it.
+	maxAssertionRecords  = 100
+	defaultAssertionWait = 30 * time.Second
+	maxAssertionWait     = time.Hour
+)
+
+const (
+	assertionPending = "pending"
+	assertionPassed  = "passed"
+	assertionFailed  = "failed"
+)
+
+// AssertionRequest creates an assertion: that at least Min (by default 1)
+// and, when Max is set, at most Max records matching Match arrive within
+// Within. Without Max the assertion passes as soon as Min records matched;
+// with it, the count can only be judged at the deadline, though going over
+// Max fails it at once. The outcome is POSTed to Callback, so tests in any
+// language can wait on a local HTTP server instead of polling.
+// IncludeExisting counts matching records already in the buffer.
+type AssertionRequest struct {
+	Name            string          `json:"name,omitempty"`
+	Match           json.RawMessage `json:"match"`
+	Min             *int            `json:"min,omitempty"`
+	Max             int             `json:"max,omitempty"`
+	Within          jsonDuration    `json:"within,omitempty"`
+	Callback        string          `json:"callback,omitempty"`
+	IncludeExisting bool            `json:"include_existing,omitempty"`
+}
+
+// Assertion is an assertion's state, and the body of its callback.
+type Assertion struct {
+	ID            string          `json:"id"`
+	Name          string          `json:"name,omitempty"`
+	Match         json.RawMessage `json:"match"`
+	Min           int             `json:"min"`
+	Max           int             `json:"max,omitempty"`
+	State         string          `json:"state"`
+	Reason        string          `json:"reason,omitempty"`
+	Matched       int             `json:"matched"`
+	Records       []WebhookParams `json:"records"`
+	CreatedAt     time.Time       `json:"created_at"`
+	Deadline      time.Time       `json:"deadline"`
+	DecidedAt     time.Time       `json:"decided_at,omitzero"`
+	Callback      string          `json:"callback,omitempty"`
+	CallbackError string          `json:"callback_error,omitempty"`
+}
+
+type assertion struct {
+	Assertion
+	filter QueryFilter
+	timer  *time.Timer
+}
+
+// Assertions evaluates assertions against ingested webhooks. They are kept
+// in memory until deleted.
+type Assertions struct {
+	mu         sync.Mutex
+	buffer     *RingBuffer
+	client     *http.Client
+	assertions map[string]*assertion
+}
+
+func NewAssertions(buffer *RingBuffer, client *http.Client) *Assertions {
+	return &Assertions{buffer: buffer, client: client, assertions: make(map[string]*assertion)}
+}
+
+func (a *Assertions) Create(ctx context.Context, req AssertionRequest) (Assertion, error) {
+	params, err := decodeParams(req.Match)
+	if err != nil {
+		return Assertion{}, &paramError{codeInvalidParameter, "match: " + err.Error()}
+	}
+	filter, err := parseQueryFilter(params, "")
+	if err != nil {
+		return Assertion{}, err
+	}
+	minimum := 1
+	if req.Min != nil {
+		minimum = *req.Min
+	}
+	if minimum < 0 || req.Max < 0 || (req.Max > 0 && req.Max < minimum) {
+		return Assertion{}, &paramError{codeInvalidParameter, "min and max must be non-negative with min <= max"}
+	}
+	wait := req.Within.Duration
+	if wait == 0 {
+		wait = defaultAssertionWait
+	}
+	if wait < 0 || wait > maxAssertionWait {
+		return Assertion{}, &paramError{codeInvalidParameter, "within must be positive and at most " + maxAssertionWait.String()}
+	}
+
+	now := time.Now().UTC()
+	as := &assertion{
+		Assertion: Assertion{
+			ID:        newRecordID(),
+			Name:      req.Name,
+			Match:     req.Match,
+			Min:       minimum,
+			Max:       req.Max,
+			State:     assertionPending,
+			Records:   []WebhookParams{},
+			CreatedAt: now,
+			Deadline:  now.Add(wait),
+			Callback:  req.Callback,
+		},
+		filter: filter,
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if req.IncludeExisting {
+		// Query is newest first; assertions list their records oldest first.
+		items, _ := a.buffer.Query(ctx, filter)
+		for i := len(items) - 1; i >= 0; i-- {
+			a.match(as, items[i])
+		}
+	}
+	a.assertions[as.ID] = as
+	if as.State == assertionPending {
+		as.timer = time.AfterFunc(wait, func() { a.expire(as.ID) })
+	}
+	return as.snapshot(), nil
+}
+
+func (as *assertion) snapshot() Assertion {
+	s := as.Assertion
+	s.Records = append([]WebhookParams(nil), as.Records...)
+	return s
+}
+
+// match counts item against a pending assertion, deciding it if it can.
+// a.mu must be held.
+func (a *Assertions) match(as *assertion, item WebhookParams) {
+	if as.State != assertionPending || !as.filter.Match(item) {
+		return
+	}
+	as.Matched++
+	if len(as.Records) < maxAssertionRecords {
+		as.Records = append(as.Records, item)
+	}
+	switch {
+	case as.Max > 0 && as.Matched > as.Max:
+		a.decide(as, assertionFailed, "more than max matching records arrived")
+	case as.Max == 0 && as.Matched >= as.Min:
+		a.decide(as, assertionPassed, "")
+	}
+}
+
+func (a *Assertions) OnIngest(item WebhookParams, body []byte) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, as := range a.assertions {
+		a.match(as, item)
+	}
+}
+
+func (a *Assertions) expire(id string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	as, ok := a.assertions[id]
+	if !ok || as.State != assertionPending {
+		return
+	}
+	if as.Matched >= as.Min {
+		a.decide(as, assertionPassed, "")
+	} else {
+		a.decide(as, assertionFailed, "fewer than min matching records arrived in time")
+	}
+}
+
+// decide settles an assertion and sends its callback. a.mu must be held.
+func (a *Assertions) decide(as *assertion, state, reason string) {
+	as.State, as.Reason, as.DecidedAt = state, reason, time.Now().UTC()
+	if as.timer != nil {
+		as.timer.Stop()
+	}
+	if as.Callback == "" {
+		return
+	}
+	result := as.snapshot()
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+		defer cancel()
+		err := postJSON(ctx, a.client, result.Callback, result)
+		if err == nil {
+			return
+		}
+		log.Printf("Assertion %s callback failed: %v", result.ID, err)
+		a.mu.Lock()
+		as.CallbackError = err.Error()
+		a.mu.Unlock()
+	}()
+}
+
+func (a *Assertions) Get(id string) (Assertion, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	as, ok := a.assertions[id]
+	if !ok {
+		return Assertion{}, false
+	}
+	return as.snapshot(), true
+}
+
+func (a *Assertions) List() []Assertion {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	list := make([]Assertion, 0, len(a.assertions))
+	for _, as := range a.assertions {
+		list = append(list, as.snapshot())
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.Before(list[j].CreatedAt) })
+	return list
+}
+
+func (a *Assertions) Delete(id string) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	as, ok := a.assertions[id]
+	if ok {
+		if as.timer != nil {
+			as.timer.Stop()
+		}
+		delete(a.assertions, id)
+	}
+	return ok
+}
+
+func createAssertionHandler(assertions *Assertions) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req AssertionRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeProblem(w, r, http.StatusBadRequest, codeInvalidJSON, "Invalid JSON: "+err.Error())
+			return
+		}
+		if len(req.Match) == 0 {
+			writeProblem(w, r, http.StatusBadRequest, codeMissingParameter, "Missing match")
+			return
+		}
+		ctx, cancel := scanContext(r)
+		defer cancel()
+		as, err := assertions.Create(ctx, req)
+		if err != nil {
+			writeParamError(w, r, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(as)
+	}
+}
+
+func listAssertionsHandler(assertions *Assertions) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(assertions.List())
+	}
+}
+
+func getAssertionHandler(assertions *Assertions) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		as, ok := assertions.Get(r.PathValue("id"))
+		if !ok {
+			writeProblem(w, r, http.StatusNotFound, codeNotFound, "No assertion with id "+r.PathValue("id"))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(as)
+	}
+}
+
+func deleteAssertionHandler(assertions *Assertions) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !assertions.Delete(r.PathValue("id")) {
+			writeProblem(w, r, http.StatusNotFound, codeNotFound, "No assertion with id "+r.PathValue("id"))
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// registerAssertionRoutes mounts the assertion API. Callbacks go to
+// arbitrary URLs, so like subscriptions it is admin-only.
+func registerAssertionRoutes(mux *http.ServeMux, assertions *Assertions, adminToken string) {
+	handleAPI(mux, "GET /assertions", requireAdmin(adminToken, listAssertionsHandler(assertions)))
+	handleAPI(mux, "POST /assertions", requireAdmin(adminToken, createAssertionHandler(assertions)))
+	handleAPI(mux, "GET /assertions/{id}", requireAdmin(adminToken, getAssertionHandler(assertions)))
+	handleAPI(mux, "DELETE /assertions/{id}", requireAdmin(adminToken, deleteAssertionHandler(assertions)))
+}
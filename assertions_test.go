@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func newAssertionServer() (*http.ServeMux, *Assertions) {
+	buffer := NewRingBuffer(10)
+	assertions := NewAssertions(buffer, http.DefaultClient)
+	mux := http.NewServeMux()
+	registerAssertionRoutes(mux, assertions, "secret")
+	registerRoutes(mux, buffer, "secret", assertions)
+	return mux, assertions
+}
+
+func createAssertion(t *testing.T, mux *http.ServeMux, body string) Assertion {
+	t.Helper()
+	rec := subscriptionRequest(t, mux, http.MethodPost, "/assertions", body)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create failed with status %d: %s", rec.Code, rec.Body.String())
+	}
+	var as Assertion
+	json.NewDecoder(rec.Body).Decode(&as)
+	return as
+}
+
+func TestAssertionCallsBackOnPass(t *testing.T) {
+	results := make(chan Assertion, 1)
+	callback := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var as Assertion
+		json.NewDecoder(r.Body).Decode(&as)
+		results <- as
+	}))
+	defer callback.Close()
+
+	mux, _ := newAssertionServer()
+	postWebhook(t, mux, `{"event":"order","data":{"n":1}}`)
+	as := createAssertion(t, mux, `{"name":"two orders","match":{"event_type":"order"},"min":2,"within":"5s","include_existing":true,"callback":"`+callback.URL+`"}`)
+	if as.State != assertionPending || as.Matched != 1 {
+		t.Fatalf("expected a pending assertion counting the existing record, got %+v", as)
+	}
+	postWebhook(t, mux, `{"event":"refund"}`)
+	postWebhook(t, mux, `{"event":"order","data":{"n":2}}`)
+
+	select {
+	case got := <-results:
+		if got.ID != as.ID || got.State != assertionPassed || got.Matched != 2 || len(got.Records) != 2 {
+			t.Fatalf("unexpected callback: %+v", got)
+		}
+		if got.Records[0].Payload["n"] != 1.0 || got.Records[1].Payload["n"] != 2.0 {
+			t.Errorf("expected the matched records oldest first, got %+v", got.Records)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no callback")
+	}
+}
+
+func TestAssertionFailsAtDeadline(t *testing.T) {
+	results := make(chan Assertion, 1)
+	callback := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var as Assertion
+		json.NewDecoder(r.Body).Decode(&as)
+		results <- as
+	}))
+	defer callback.Close()
+
+	mux, assertions := newAssertionServer()
+	as := createAssertion(t, mux, `{"match":{"event_type":"order"},"within":"50ms","callback":"`+callback.URL+`"}`)
+	select {
+	case got := <-results:
+		if got.State != assertionFailed || got.Matched != 0 || got.Reason == "" {
+			t.Fatalf("expected a failure, got %+v", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no callback")
+	}
+
+	// Records arriving after the verdict do not change it.
+	postWebhook(t, mux, `{"event":"order"}`)
+	if got, _ := assertions.Get(as.ID); got.State != assertionFailed || got.Matched != 0 {
+		t.Errorf("expected the verdict to stand, got %+v", got)
+	}
+}
+
+func TestAssertionMaxFailsEarly(t *testing.T) {
+	mux, assertions := newAssertionServer()
+	as := createAssertion(t, mux, `{"match":{"event_type":"order"},"min":0,"max":1,"within":"1h"}`)
+	postWebhook(t, mux, `{"event":"order"}`)
+	if got, _ := assertions.Get(as.ID); got.State != assertionPending {
+		t.Fatalf("expected the assertion to wait for the deadline, got %+v", got)
+	}
+	postWebhook(t, mux, `{"event":"order"}`)
+	if got, _ := assertions.Get(as.ID); got.State != assertionFailed {
+		t.Fatalf("expected exceeding max to fail at once, got %+v", got)
+	}
+
+	if rec := subscriptionRequest(t, mux, http.MethodDelete, "/assertions/"+as.ID, ""); rec.Code != http.StatusNoContent {
+		t.Errorf("expected delete to succeed, got %d", rec.Code)
+	}
+	if rec := subscriptionRequest(t, mux, http.MethodPost, "/assertions", `{"match":{"event_type":"order"},"min":3,"max":2}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("expected min > max to be rejected, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// Limits on what can be attached to a single record.
+const (
+	attachmentMaxSize  = 1 << 20
+	attachmentMaxCount = 16
+)
+
+// Attachment is an artifact attached to a captured record after the fact,
+// such as a log snippet, a screenshot or a trace ID. The content is served
+// from /webhooks/{id}/attachments/{name}.
+type Attachment struct {
+	Name        string    `json:"name"`
+	ContentType string    `json:"content_type"`
+	Size        int       `json:"size"`
+	AddedAt     time.Time `json:"added_at"`
+	Data        []byte    `json:"-"`
+}
+
+var (
+	errRecordNotFound     = errors.New("record not found")
+	errTooManyAttachments = fmt.Errorf("a record can have at most %d attachments", attachmentMaxCount)
+)
+
+// Attach adds att to the record with the given id, replacing an attachment
+// of the same name. An unnamed att is named "attachment-N" after the first
+// N from the count of attachments up that is free, so it never replaces
+// one. It reports whether att replaced one. Attachments are not
+// covered by the chain hash, which only seals what was received.
+func (rb *RingBuffer) Attach(id string, att *Attachment) (replaced bool, err error) {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+
+	idx, ok := rb.find(id)
+	if !ok {
+		return false, errRecordNotFound
+	}
+	// Copy on write: records handed out by Query share the old slice.
+	current := rb.at(idx).Attachments
+	if att.Name == "" {
+		att.Name = unusedAttachmentName(current)
+	}
+	attachments := make([]Attachment, 0, len(current)+1)
+	for _, a := range current {
+		if a.Name == att.Name {
+			replaced = true
+			continue
+		}
+		attachments = append(attachments, a)
+	}
+	if len(attachments) == attachmentMaxCount {
+		return false, errTooManyAttachments
+	}
+	rb.slot(idx).Attachments = append(attachments, *att)
+	return replaced, nil
+}
+
+func unusedAttachmentName(attachments []Attachment) string {
+	for n := len(attachments) + 1; ; n++ {
+		name := "attachment-" + strconv.Itoa(n)
+		if !slices.ContainsFunc(attachments, func(a Attachment) bool { return a.Name == name }) {
+			return name
+		}
+	}
+}
+
+// attachHandler stores the request body as an attachment named by the name
+// parameter, "attachment-N" by default.
+func attachHandler(buffer *RingBuffer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := r.PathValue("id")
+		if _, ok := buffer.Get(id); !ok {
+			writeProblem(w, r, http.StatusNotFound, codeNotFound, "No webhook with id "+id)
+			return
+		}
+		data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, attachmentMaxSize))
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				writeProblem(w, r, http.StatusRequestEntityTooLarge, codePayloadTooLarge,
+					fmt.Sprintf("Attachments are limited to %d bytes", attachmentMaxSize))
+				return
+			}
+			writeProblem(w, r, http.StatusBadRequest, codeUnreadableBody, "Failed to read request body")
+			return
+		}
+
+		contentType := r.Header.Get("Content-Type")
+		if contentType == "" {
+			contentType = http.DetectContentType(data)
+		}
+		att := Attachment{
+			Name:        r.URL.Query().Get("name"),
+			ContentType: contentType,
+			Size:        len(data),
+			AddedAt:     time.Now().UTC(),
+			Data:        data,
+		}
+
+		replaced, err := buffer.Attach(id, &att)
+		switch {
+		case errors.Is(err, errRecordNotFound):
+			writeProblem(w, r, http.StatusNotFound, codeNotFound, "No webhook with id "+id)
+			return
+		case err != nil:
+			writeProblem(w, r, http.StatusConflict, codeInvalidParameter, err.Error())
+			return
+		}
+
+		status := http.StatusCreated
+		if replaced {
+			status = http.StatusOK
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(att)
+	}
+}
+
+func getAttachmentHandler(buffer *RingBuffer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		item, ok := buffer.Get(r.PathValue("id"))
+		if !ok {
+			writeProblem(w, r, http.StatusNotFound, codeNotFound, "No webhook with id "+r.PathValue("id"))
+			return
+		}
+		for _, att := range item.Attachments {
+			if att.Name == r.PathValue("name") {
+				w.Header().Set("Content-Type", att.ContentType)
+				w.Header().Set("X-Content-Type-Options", "nosniff")
+				w.Write(att.Data)
+				return
+			}
+		}
+		writeProblem(w, r, http.StatusNotFound, codeNotFound, "No attachment named "+r.PathValue("name"))
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func attach(t *testing.T, mux *http.ServeMux, path, contentType, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := adminRequest(http.MethodPost, path, strings.NewReader(body))
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestAttachments(t *testing.T) {
+	mux := newTestServer()
+	id := postWebhook(t, mux, `{"event":"order"}`).Header().Get("X-Echo-Id")
+	base := "/v1/webhooks/" + id + "/attachments"
+
+	if rec := attach(t, mux, base+"?name=trace", "text/plain", "4bf92f3577b34da6"); rec.Code != http.StatusCreated {
+		t.Fatalf("expected status 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := attach(t, mux, base+"?name=trace", "text/plain", "a3ce929d0e0e4736"); rec.Code != http.StatusOK {
+		t.Errorf("expected replacing to answer 200, got %d", rec.Code)
+	}
+	rec := attach(t, mux, base, "", "\x89PNG\r\n\x1a\n")
+	var att Attachment
+	json.NewDecoder(rec.Body).Decode(&att)
+	if att.Name != "attachment-2" || att.ContentType != "image/png" {
+		t.Errorf("expected a generated name and sniffed type, got %+v", att)
+	}
+
+	if rec := attach(t, mux, base+"?name=attachment-4", "text/plain", "kept"); rec.Code != http.StatusCreated {
+		t.Fatalf("expected status 201, got %d", rec.Code)
+	}
+	rec = attach(t, mux, base, "text/plain", "new")
+	json.NewDecoder(rec.Body).Decode(&att)
+	if rec.Code != http.StatusCreated || att.Name != "attachment-5" {
+		t.Errorf("expected a generated name not to replace attachment-4, got %d %+v", rec.Code, att)
+	}
+	if got := getRaw(t, mux, base+"/attachment-4"); got.Body.String() != "kept" {
+		t.Errorf("expected attachment-4 to be kept, got %q", got.Body.String())
+	}
+
+	got := getRaw(t, mux, base+"/trace")
+	if got.Body.String() != "a3ce929d0e0e4736" || got.Header().Get("Content-Type") != "text/plain" {
+		t.Errorf("expected the replaced trace attachment, got %q", got.Body.String())
+	}
+	var item WebhookParams
+	json.NewDecoder(getRaw(t, mux, "/v1/webhooks/"+id).Body).Decode(&item)
+	if len(item.Attachments) != 4 || item.Attachments[0].Name != "trace" {
+		t.Errorf("expected the record to list its attachments, got %+v", item.Attachments)
+	}
+
+	if rec := getRaw(t, mux, base+"/missing"); rec.Code != http.StatusNotFound {
+		t.Errorf("expected status 404 for a missing attachment, got %d", rec.Code)
+	}
+	if rec := attach(t, mux, "/v1/webhooks/nope/attachments", "", "x"); rec.Code != http.StatusNotFound {
+		t.Errorf("expected status 404 for a missing record, got %d", rec.Code)
+	}
+	big := string(bytes.Repeat([]byte("x"), attachmentMaxSize+1))
+	if rec := attach(t, mux, base, "", big); rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected status 413, got %d", rec.Code)
+	}
+}
+
+func TestAttachmentLimit(t *testing.T) {
+	buffer := NewRingBuffer(1)
+	stored, _ := buffer.Push(WebhookParams{EventType: "order"})
+	for i := 0; i < attachmentMaxCount; i++ {
+		if _, err := buffer.Attach(stored.ID, &Attachment{Name: string(rune('a' + i))}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := buffer.Attach(stored.ID, &Attachment{Name: "extra"}); err != errTooManyAttachments {
+		t.Errorf("expected the limit to be enforced, got %v", err)
+	}
+	if _, err := buffer.Attach(stored.ID, &Attachment{Name: "a"}); err != nil {
+		t.Errorf("expected replacing at the limit to work, got %v", err)
+	}
+}
+
+func TestAttachmentsWithoutAdminToken(t *testing.T) {
+	buffer := NewRingBuffer(1)
+	stored, _ := buffer.Push(WebhookParams{EventType: "order"})
+	mux := http.NewServeMux()
+	registerRoutes(mux, buffer, "")
+	if rec := attach(t, mux, "/v1/webhooks/"+stored.ID+"/attachments", "", "x"); rec.Code != http.StatusForbidden {
+		t.Errorf("expected status 403 without a configured admin token, got %d", rec.Code)
+	}
+}
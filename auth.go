@@ -0,0 +1,35 @@
+package main
+
+import (
+	"crypto/subtle"
+	"net/http"
+)
+
+// requireAdmin only lets requests through that carry the configured admin
+// token as a bearer token. With no token configured every request is refused.
+func requireAdmin(token string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if currentSecret(token) == "" {
+			writeProblem(w, r, http.StatusForbidden, codeForbidden, "Admin token not configured")
+			return
+		}
+		if !isAdmin(token, r) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="webhook-echo"`)
+			writeProblem(w, r, http.StatusUnauthorized, codeUnauthorized, "Missing or invalid admin token")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// isAdmin reports whether r carries the configured admin token as a bearer
+// token. It never does when no token is configured.
+func isAdmin(token string, r *http.Request) bool {
+	token = currentSecret(token)
+	if token == "" {
+		return false
+	}
+	got := []byte(r.Header.Get("Authorization"))
+	want := []byte("Bearer " + token)
+	return subtle.ConstantTimeCompare(got, want) == 1
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+const orderSchema = `{
+	"type": "record", "name": "OrderCreated", "namespace": "com.acme",
+	"fields": [
+		{"name": "id", "type": "long"},
+		{"name": "status", "type": {"type": "enum", "name": "Status", "symbols": ["NEW", "PAID"]}},
+		{"name": "note", "type": ["null", "string"]},
+		{"name": "tags", "type": {"type": "array", "items": "string"}},
+		{"name": "attrs", "type": {"type": "map", "values": "long"}},
+		{"name": "amount", "type": "double"},
+		{"name": "parent", "type": ["null", "OrderCreated"]}
+	]
+}`
+
+func avroString(b []byte, s string) []byte {
+	return append(binary.AppendVarint(b, int64(len(s))), s...)
+}
+
+func TestAvroIngest(t *testing.T) {
+	var fetches atomic.Int32
+	registry := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/schemas/ids/7" {
+			http.NotFound(w, r)
+			return
+		}
+		fetches.Add(1)
+		json.NewEncoder(w).Encode(map[string]string{"schema": orderSchema})
+	}))
+	defer registry.Close()
+	reg := NewSchemaRegistry(registry.URL+"/", registry.Client())
+	RegisterFormat("avro/binary", BodyFormat{Name: "Avro", Code: codeInvalidAvro, Binary: true, Parser: reg})
+	t.Cleanup(func() { delete(bodyFormats, "avro/binary") })
+
+	b := []byte{0, 0, 0, 0, 7}
+	b = binary.AppendVarint(b, -42)
+	b = binary.AppendVarint(b, 1)
+	b = avroString(binary.AppendVarint(b, 1), "rush")
+	b = avroString(avroString(binary.AppendVarint(b, 2), "a"), "b")
+	b = binary.AppendVarint(b, 0)
+	b = binary.AppendVarint(avroString(binary.AppendVarint(b, 1), "qty"), 3)
+	b = binary.AppendVarint(b, 0)
+	b = binary.LittleEndian.AppendUint64(b, math.Float64bits(9.5))
+	b = binary.AppendVarint(b, 0)
+
+	mux := newTestServer()
+	for range 2 {
+		if rec := postBody(t, mux, "avro/binary", b); rec.Code != http.StatusOK {
+			t.Fatalf("expected Avro to be accepted, got %d %s", rec.Code, rec.Body)
+		}
+	}
+	got := queryWebhooks(t, mux, "/query/com.acme.OrderCreated?id=-42&status=PAID&note=rush&attrs.qty=3&amount=9.5")
+	if len(got) != 2 || got[0].Version != "7" {
+		t.Fatalf("expected both records decoded with schema 7 as version, got %+v", got)
+	}
+	if tags, _ := got[0].Payload["tags"].([]any); len(tags) != 2 || tags[1] != "b" {
+		t.Errorf("expected the array decoded, got %v", got[0].Payload["tags"])
+	}
+	if fetches.Load() != 1 {
+		t.Errorf("expected the schema fetched once, got %d", fetches.Load())
+	}
+
+	for name, body := range map[string][]byte{
+		"no magic byte":  {1, 0, 0, 0, 7, 0},
+		"unknown schema": {0, 0, 0, 0, 8, 0},
+		"truncated":      b[:len(b)-3],
+		"trailing bytes": append(append([]byte(nil), b...), 0),
+	} {
+		rec := postBody(t, mux, "avro/binary", body)
+		if p := decodeProblem(t, rec); rec.Code != http.StatusBadRequest || p.Code != codeInvalidAvro {
+			t.Errorf("%s: expected invalid_avro, got %d %+v", name, rec.Code, p)
+		}
+	}
+}
+
+func TestDecodeAvroLimits(t *testing.T) {
+	s, err := parseAvroSchema([]byte(`{"type": "array", "items": "null"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := decodeAvro(s, binary.AppendVarint(nil, avroMaxItems+1)); err == nil {
+		t.Error("expected a block of nulls past the item limit to be rejected")
+	}
+
+	// A record that contains itself takes no bytes per level.
+	s, err = parseAvroSchema([]byte(`{"type": "record", "name": "R", "fields": [{"name": "r", "type": "R"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := decodeAvro(s, nil); err == nil {
+		t.Error("expected unbounded recursion to be rejected")
+	}
+
+	if _, err := parseAvroSchema([]byte(`{"type": "record", "name": "R", "fields": [{"name": "x", "type": "Missing"}]}`)); err == nil {
+		t.Error("expected an unknown type name to be rejected")
+	}
+}
+
+func TestDecodeAvroWithoutDepthLimit(t *testing.T) {
+	limit := maxJSONDepth
+	maxJSONDepth = 0
+	t.Cleanup(func() { maxJSONDepth = limit })
+
+	s, err := parseAvroSchema([]byte(`{"type": "record", "name": "R", "fields": [{"name": "next", "type": ["null", "R"]}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var data []byte
+	for i := 0; i < 100; i++ {
+		data = binary.AppendVarint(data, 1)
+	}
+	data = binary.AppendVarint(data, 0)
+	if _, err := decodeAvro(s, data); err != nil {
+		t.Errorf("expected deeply nested records to be accepted with no limit, got %v", err)
+	}
+
+	s, err = parseAvroSchema([]byte(`{"type": "record", "name": "R", "fields": [{"name": "r", "type": "R"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := decodeAvro(s, nil); err == nil {
+		t.Error("expected unbounded recursion to be rejected with no limit")
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// basePath is the path prefix every route is served under when behind a
+// reverse proxy, e.g. /webhook-echo, or "" to serve from the root.
+var basePath string
+
+// parseBasePath normalizes a -base-path value to a leading slash and no
+// trailing one.
+func parseBasePath(s string) (string, error) {
+	s = strings.TrimRight(s, "/")
+	if s == "" {
+		return "", nil
+	}
+	if !strings.HasPrefix(s, "/") || strings.ContainsAny(s, "?#") {
+		return "", fmt.Errorf("%q must be an absolute path such as /webhook-echo", s)
+	}
+	return s, nil
+}
+
+// externalPath returns the path clients use to reach the route path.
+func externalPath(path string) string {
+	return basePath + path
+}
+
+// withBasePath serves h under basePath, answering 404 outside of it. Routes,
+// and the paths rules and event types are taken from, stay relative to it.
+func withBasePath(h http.Handler) http.Handler {
+	if basePath == "" {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rest, ok := strings.CutPrefix(r.URL.Path, basePath)
+		if !ok || rest != "" && rest[0] != '/' {
+			writeProblem(w, nil, http.StatusNotFound, codeNotFound, "No route matches this path; routes are under "+basePath)
+			return
+		}
+		if rest == "" {
+			rest = "/"
+		}
+		r2 := r.Clone(r.Context())
+		r2.URL.Path = rest
+		r2.URL.RawPath = ""
+		if r.URL.RawPath != "" {
+			r2.URL.RawPath = strings.TrimPrefix(r.URL.RawPath, basePath)
+		}
+		h.ServeHTTP(&basePathWriter{ResponseWriter: w}, r2)
+	})
+}
+
+// basePathWriter puts the prefix back on redirects the mux issues for
+// route paths, such as /debug/pprof to /debug/pprof/.
+type basePathWriter struct {
+	http.ResponseWriter
+}
+
+func (w *basePathWriter) WriteHeader(status int) {
+	if loc := w.Header().Get("Location"); strings.HasPrefix(loc, "/") && !strings.HasPrefix(loc, "//") {
+		w.Header().Set("Location", externalPath(loc))
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *basePathWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestParseBasePath(t *testing.T) {
+	for in, want := range map[string]string{"": "", "/": "", "/webhook-echo/": "/webhook-echo", "/a/b": "/a/b"} {
+		if got, err := parseBasePath(in); err != nil || got != want {
+			t.Errorf("parseBasePath(%q) = %q, %v", in, got, err)
+		}
+	}
+	for _, bad := range []string{"webhook-echo", "/a?b"} {
+		if _, err := parseBasePath(bad); err == nil {
+			t.Errorf("%q: expected an error", bad)
+		}
+	}
+}
+
+func TestBasePath(t *testing.T) {
+	basePath = "/webhook-echo"
+	t.Cleanup(func() { basePath = "" })
+
+	mux := http.NewServeMux()
+	registerRoutes(mux, NewRingBuffer(10), "secret")
+	registerDebugRoutes(mux, NewRingBuffer(1), "")
+	h := withBasePath(withProblemFallback(mux))
+	serve := func(method, path, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return rec
+	}
+
+	if rec := serve(http.MethodPost, "/webhook-echo/hooks", `{"event":"order","data":{}}`); rec.Code != http.StatusOK {
+		t.Fatalf("expected ingest under the base path, got %d", rec.Code)
+	}
+	if rec := serve(http.MethodGet, "/webhook-echo/v1/query/order", ""); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"event":"order"`) {
+		t.Errorf("expected the query API under the base path, got %d %s", rec.Code, rec.Body)
+	}
+	rec := serve(http.MethodGet, "/webhook-echo/query/order", "")
+	if link := rec.Header().Get("Link"); link != `</webhook-echo/v1/query/order>; rel="successor-version"` {
+		t.Errorf("expected the successor link under the base path, got %q", link)
+	}
+	if p := decodeProblem(t, serve(http.MethodGet, "/webhook-echo/v1/webhooks/nope", "")); p.Instance != "/webhook-echo/v1/webhooks/nope" {
+		t.Errorf("expected the problem instance under the base path, got %q", p.Instance)
+	}
+	if rec := serve(http.MethodGet, "/webhook-echo/debug/pprof", ""); rec.Header().Get("Location") != "/webhook-echo/debug/pprof/" {
+		t.Errorf("expected redirects under the base path, got %d %v", rec.Code, rec.Header())
+	}
+	for _, path := range []string{"/v1/query/order", "/webhook-echoes/v1/query/order"} {
+		if rec := serve(http.MethodGet, path, ""); rec.Code != http.StatusNotFound {
+			t.Errorf("%s: expected 404 outside the base path, got %d", path, rec.Code)
+		}
+	}
+}
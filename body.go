@@ -0,0 +1,43 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"sync"
+)
+
+const (
+	// maxPresizedBody is the largest declared Content-Length read straight
+	// into a buffer of that size; larger bodies grow one as they arrive, so
+	// that a false length cannot reserve memory up front.
+	maxPresizedBody = 1 << 20
+	// maxPooledBuffer is the largest read buffer kept for reuse.
+	maxPooledBuffer = 4 << 20
+)
+
+// bodyBuffers holds the read buffers of bodies without a usable length.
+var bodyBuffers = sync.Pool{New: func() any { return new(bytes.Buffer) }}
+
+// readBody reads a request body of the given Content-Length, -1 if unknown,
+// into one slice of exactly its size. The slice is stored with the record
+// and shared by parsing and echoing, so it is never pooled itself: a body
+// of known size is read into it directly, and any other is collected in a
+// pooled buffer and copied out once.
+func readBody(r io.Reader, size int64) ([]byte, error) {
+	if size >= 0 && size <= maxPresizedBody {
+		body := make([]byte, size)
+		n, err := io.ReadFull(r, body)
+		return body[:n], err
+	}
+	buf := bodyBuffers.Get().(*bytes.Buffer)
+	defer func() {
+		if buf.Cap() <= maxPooledBuffer {
+			buf.Reset()
+			bodyBuffers.Put(buf)
+		}
+	}()
+	_, err := buf.ReadFrom(r)
+	body := make([]byte, buf.Len())
+	copy(body, buf.Bytes())
+	return body, err
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestReadBody(t *testing.T) {
+	payload := strings.Repeat("x", 3000)
+	for _, size := range []int64{int64(len(payload)), -1} {
+		body, err := readBody(iotest.OneByteReader(strings.NewReader(payload)), size)
+		if err != nil || string(body) != payload || cap(body) != len(payload) {
+			t.Errorf("size %d: got %d bytes in a %d byte slice, %v", size, len(body), cap(body), err)
+		}
+	}
+	if _, err := readBody(strings.NewReader("short"), 10); err != io.ErrUnexpectedEOF {
+		t.Errorf("expected a short body to fail, got %v", err)
+	}
+	if body, err := readBody(strings.NewReader(""), -1); err != nil || body == nil || len(body) != 0 {
+		t.Errorf("expected an empty non-nil body, got %q, %v", body, err)
+	}
+}
+
+// chunkedReader hides the size of a body, as a chunked request does.
+type chunkedReader struct{ r io.Reader }
+
+func (c chunkedReader) Read(p []byte) (int, error) { return c.r.Read(p) }
+
+func benchmarkRead(b *testing.B, read func(io.Reader) ([]byte, error)) {
+	payload := bytes.Repeat([]byte(`{"k":"v"},`), 64<<10/10)
+	reader := bytes.NewReader(payload)
+	b.SetBytes(int64(len(payload)))
+	b.ReportAllocs()
+	for b.Loop() {
+		reader.Reset(payload)
+		if _, err := read(chunkedReader{reader}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkReadAll(b *testing.B) {
+	benchmarkRead(b, io.ReadAll)
+}
+
+func BenchmarkReadBodySized(b *testing.B) {
+	benchmarkRead(b, func(r io.Reader) ([]byte, error) { return readBody(r, 64<<10/10*10) })
+}
+
+func BenchmarkReadBodyChunked(b *testing.B) {
+	benchmarkRead(b, func(r io.Reader) ([]byte, error) { return readBody(r, -1) })
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+var errChainedDelete = errors.New("records cannot be deleted from a hash-chained buffer")
+
+// Delete drops the records with the given IDs into the trash, see
+// SetTrashRetention, and returns how many it
+// found. A hash-chained buffer refuses, as a gap would break the chain.
+func (rb *RingBuffer) Delete(ids map[string]bool) (int, error) {
+	return rb.deleteAs(lifecycleDeleted, ids)
+}
+
+// deleteAs is Delete reporting the records dropped as kind.
+func (rb *RingBuffer) deleteAs(kind string, ids map[string]bool) (int, error) {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+	if rb.chained {
+		return 0, errChainedDelete
+	}
+	now := time.Now()
+	return rb.compact(func(item *WebhookParams) bool {
+		if !ids[item.ID] {
+			return false
+		}
+		if kind == lifecycleDeleted {
+			rb.toTrash(item, now)
+		}
+		rb.dropped(kind, item)
+		return true
+	}), nil
+}
+
+// BulkRequest applies Action to every record selected by Match (in /query
+// parameter syntax) and the optional receive time range: Since and Until are
+// RFC 3339 times or durations ago, such as "24h". Action is "delete", "tag"
+// (adding Tag) or "replay" (re-sending as Replay describes, whose match and
+// limit are ignored). DryRun only counts the records it would affect.
+type BulkRequest struct {
+	Action string          `json:"action"`
+	Match  json.RawMessage `json:"match"`
+	Since  string          `json:"since,omitempty"`
+	Until  string          `json:"until,omitempty"`
+	Limit  int             `json:"limit,omitempty"`
+	Tag    string          `json:"tag,omitempty"`
+	Replay *ReplayRequest  `json:"replay,omitempty"`
+	DryRun bool            `json:"dry_run,omitempty"`
+}
+
+// BulkResult reports what a bulk operation did, or would do on a dry run.
+type BulkResult struct {
+	Action   string         `json:"action"`
+	DryRun   bool           `json:"dry_run"`
+	Matched  int            `json:"matched"`
+	Affected int            `json:"affected"`
+	IDs      []string       `json:"ids"`
+	Replayed []ReplayResult `json:"replayed,omitempty"`
+}
+
+// bulkTime resolves a BulkRequest time bound.
+func bulkTime(spec string, now time.Time) (time.Time, error) {
+	if spec == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, spec); err == nil {
+		return t, nil
+	}
+	ago, err := time.ParseDuration(spec)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("want an RFC 3339 time or a duration ago, got %q", spec)
+	}
+	return now.Add(-ago), nil
+}
+
+// bulkHandler serves POST /webhooks/bulk.
+func bulkHandler(buffer *RingBuffer, client *http.Client) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req BulkRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeProblem(w, r, http.StatusBadRequest, codeInvalidJSON, "Invalid JSON: "+err.Error())
+			return
+		}
+		now := time.Now()
+		var scheme, reverifyScheme SignatureScheme
+		switch req.Action {
+		case "delete":
+		case "tag":
+			if req.Tag == "" {
+				writeProblem(w, r, http.StatusBadRequest, codeMissingParameter, "Missing tag")
+				return
+			}
+		case "replay":
+			if req.Replay == nil {
+				writeProblem(w, r, http.StatusBadRequest, codeMissingParameter, "Missing replay")
+				return
+			}
+			var err error
+			if scheme, err = checkReplayTarget(*req.Replay, now); err != nil {
+				writeParamError(w, r, err)
+				return
+			}
+			if reverifyScheme, err = checkReverify(*req.Replay); err != nil {
+				writeParamError(w, r, err)
+				return
+			}
+		default:
+			writeProblem(w, r, http.StatusBadRequest, codeInvalidParameter, `action must be "delete", "tag" or "replay"`)
+			return
+		}
+
+		if len(req.Match) == 0 {
+			writeProblem(w, r, http.StatusBadRequest, codeMissingParameter, "Missing match")
+			return
+		}
+		params, err := decodeParams(req.Match)
+		if err != nil {
+			writeProblem(w, r, http.StatusBadRequest, codeInvalidParameter, "match: "+err.Error())
+			return
+		}
+		filter, err := parseQueryFilter(params, "")
+		if err != nil {
+			writeParamError(w, r, err)
+			return
+		}
+		since, err := bulkTime(req.Since, now)
+		if err != nil {
+			writeProblem(w, r, http.StatusBadRequest, codeInvalidParameter, "since: "+err.Error())
+			return
+		}
+		until, err := bulkTime(req.Until, now)
+		if err != nil {
+			writeProblem(w, r, http.StatusBadRequest, codeInvalidParameter, "until: "+err.Error())
+			return
+		}
+
+		ctx, cancel := scanContext(r)
+		matches, truncated := buffer.Query(ctx, filter)
+		cancel()
+		if truncated {
+			writeProblem(w, r, http.StatusServiceUnavailable, codeQueryTimeout, "Selecting the records took too long")
+			return
+		}
+		var items []WebhookParams
+		for _, item := range matches {
+			if (!since.IsZero() && item.ReceivedAt.Before(since)) || (!until.IsZero() && !item.ReceivedAt.Before(until)) {
+				continue
+			}
+			items = append(items, item)
+		}
+		if req.Limit > 0 && len(items) > req.Limit {
+			items = items[:req.Limit]
+		}
+
+		result := BulkResult{Action: req.Action, DryRun: req.DryRun, Matched: len(items), IDs: make([]string, len(items))}
+		for i, item := range items {
+			result.IDs[i] = item.ID
+		}
+		if req.DryRun {
+			result.Affected = len(items)
+		} else {
+			switch req.Action {
+			case "delete":
+				ids := make(map[string]bool, len(items))
+				for _, item := range items {
+					ids[item.ID] = true
+				}
+				if result.Affected, err = buffer.Delete(ids); err != nil {
+					writeProblem(w, r, http.StatusConflict, codeConflict, err.Error())
+					return
+				}
+			case "tag":
+				for _, item := range items {
+					if buffer.AddTag(item.ID, req.Tag) {
+						result.Affected++
+					}
+				}
+			case "replay":
+				// Oldest first, as POST /replay does.
+				for i := len(items) - 1; i >= 0; i-- {
+					res := replayRecord(r.Context(), client, buffer, *req.Replay, scheme, reverifyScheme, items[i], now)
+					if res.Error == "" {
+						result.Affected++
+					}
+					result.Replayed = append(result.Replayed, res)
+				}
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(result)
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func postBulk(t *testing.T, handler http.Handler, body string) (*httptest.ResponseRecorder, BulkResult) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/webhooks/bulk", bytes.NewBufferString(body)))
+	var result BulkResult
+	json.NewDecoder(bytes.NewReader(rec.Body.Bytes())).Decode(&result)
+	return rec, result
+}
+
+func TestBulkOperations(t *testing.T) {
+	buffer := NewRingBuffer(10)
+	mux := http.NewServeMux()
+	registerRoutes(mux, buffer, "secret")
+	for _, body := range []string{
+		`{"event": "order", "data": {"status": "failed", "id": 1}}`,
+		`{"event": "order", "data": {"status": "failed", "id": 2}}`,
+		`{"event": "order", "data": {"status": "paid", "id": 3}}`,
+		`{"event": "refund", "data": {"status": "failed", "id": 4}}`,
+	} {
+		postWebhook(t, mux, body)
+	}
+	var replayed []string
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var item WebhookParams
+		json.NewDecoder(r.Body).Decode(&item)
+		replayed = append(replayed, item.EventType)
+	}))
+	defer target.Close()
+	bulk := bulkHandler(buffer, target.Client())
+
+	rec, result := postBulk(t, bulk, `{"action": "delete", "match": {"event_type": "order", "status": "failed"}, "dry_run": true}`)
+	if rec.Code != http.StatusOK || result.Matched != 2 || !result.DryRun || buffer.Len() != 4 {
+		t.Fatalf("expected a dry run to count without deleting, got %d %+v", rec.Code, result)
+	}
+
+	_, result = postBulk(t, bulk, `{"action": "tag", "match": {"event_type": "order,refund", "status": "failed"}, "tag": "incident-42"}`)
+	if result.Affected != 3 {
+		t.Errorf("expected three records tagged, got %+v", result)
+	}
+	_, result = postBulk(t, bulk, `{"action": "replay", "match": {"event_type": "refund"}, "since": "1h", "replay": {"url": "`+target.URL+`", "scheme": "stripe", "secret": "s"}}`)
+	if result.Affected != 1 || len(replayed) != 1 || replayed[0] != "refund" {
+		t.Errorf("expected the refund replayed, got %+v %v", result, replayed)
+	}
+	_, result = postBulk(t, bulk, `{"action": "delete", "match": {"event_type": "order", "status": "failed"}}`)
+	if result.Affected != 2 || buffer.Len() != 2 {
+		t.Fatalf("expected two records deleted, got %+v with %d left", result, buffer.Len())
+	}
+	if got := queryWebhooks(t, mux, "/query/order?status=paid"); len(got) != 1 {
+		t.Errorf("expected the remaining records still queryable, got %d", len(got))
+	}
+	if got := queryWebhooks(t, mux, "/query/refund?status=failed"); len(got) != 1 || len(got[0].Tags) != 1 {
+		t.Errorf("expected the tagged refund kept, got %+v", got)
+	}
+	_, result = postBulk(t, bulk, `{"action": "delete", "match": {"event_type": "order"}, "until": "1h"}`)
+	if result.Matched != 0 {
+		t.Errorf("expected until to exclude recent records, got %+v", result)
+	}
+
+	for _, body := range []string{
+		`{"action": "purge", "match": {"event_type": "order"}}`,
+		`{"action": "tag", "match": {"event_type": "order"}}`,
+		`{"action": "delete"}`,
+		`{"action": "replay", "match": {"event_type": "order"}, "replay": {"url": "http://x", "scheme": "nope"}}`,
+		`{"action": "delete", "match": {"event_type": "order"}, "since": "yesterday"}`,
+	} {
+		if rec, _ := postBulk(t, bulk, body); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", body, rec.Code)
+		}
+	}
+}
+
+func TestBulkDeleteChained(t *testing.T) {
+	buffer := NewRingBuffer(10)
+	buffer.ChainHashes()
+	mux := http.NewServeMux()
+	registerRoutes(mux, buffer, "secret")
+	postWebhook(t, mux, `{"event": "order", "data": {}}`)
+	if rec, _ := postBulk(t, bulkHandler(buffer, http.DefaultClient), `{"action": "delete", "match": {"event_type": "order"}}`); rec.Code != http.StatusConflict || buffer.Len() != 1 {
+		t.Errorf("expected deleting from a chained buffer to be refused, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// canonicalize rewrites a JSON document so that cosmetic differences go
+// away: keys are sorted, whitespace is dropped and numbers are written in
+// one form, so 1.50, 1.5 and 15e-1 all become 1.5. Two payloads with the
+// same content canonicalize to the same bytes.
+func canonicalize(body []byte) ([]byte, error) {
+	if err := checkJSONDepth(body, maxJSONDepth); err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, errors.New("invalid character after top-level value")
+	}
+	return encodeCanonical(canonicalNumbers(v))
+}
+
+func canonicalNumbers(v any) any {
+	switch v := v.(type) {
+	case json.Number:
+		return json.Number(canonicalNumber(string(v)))
+	case map[string]any:
+		for k, child := range v {
+			v[k] = canonicalNumbers(child)
+		}
+	case []any:
+		for i, child := range v {
+			v[i] = canonicalNumbers(child)
+		}
+	}
+	return v
+}
+
+// canonicalNumber writes a JSON number as a plain decimal without leading or
+// trailing zeros, falling back to d.ddde±n beyond maxDecimalExponent. It
+// works on the digits, so no precision is lost.
+func canonicalNumber(number string) string {
+	neg := strings.HasPrefix(number, "-")
+	s := strings.TrimPrefix(number, "-")
+	mantissa, exp := s, 0
+	if i := strings.IndexAny(s, "eE"); i >= 0 {
+		e, err := strconv.Atoi(s[i+1:])
+		if err != nil {
+			return number
+		}
+		mantissa, exp = s[:i], e
+	}
+	intPart, frac, _ := strings.Cut(mantissa, ".")
+	digits := intPart + frac
+	point := len(intPart) + exp // position of the decimal point in digits
+
+	trimmed := strings.TrimLeft(digits, "0")
+	point -= len(digits) - len(trimmed)
+	digits = strings.TrimRight(trimmed, "0")
+	if digits == "" {
+		return "0"
+	}
+
+	var out string
+	switch {
+	case point > maxDecimalExponent || point < -maxDecimalExponent:
+		out = digits[:1]
+		if len(digits) > 1 {
+			out += "." + digits[1:]
+		}
+		out += "e" + strconv.Itoa(point-1)
+	case point <= 0:
+		out = "0." + strings.Repeat("0", -point) + digits
+	case point >= len(digits):
+		out = digits + strings.Repeat("0", point-len(digits))
+	default:
+		out = digits[:point] + "." + digits[point:]
+	}
+	if neg {
+		out = "-" + out
+	}
+	return out
+}
+
+// CanonicalForm is a canonicalized document together with its SHA-256.
+type CanonicalForm struct {
+	Canonical json.RawMessage `json:"canonical"`
+	SHA256    string          `json:"sha256"`
+}
+
+func canonicalForm(body []byte) (CanonicalForm, error) {
+	canonical, err := canonicalize(body)
+	if err != nil {
+		return CanonicalForm{}, err
+	}
+	sum := sha256.Sum256(canonical)
+	return CanonicalForm{Canonical: canonical, SHA256: hex.EncodeToString(sum[:])}, nil
+}
+
+func writeCanonicalForm(w http.ResponseWriter, cf CanonicalForm) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	enc.Encode(cf)
+}
+
+// canonicalizeHandler canonicalizes the JSON document in the request body.
+func canonicalizeHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			writeProblem(w, r, http.StatusBadRequest, codeUnreadableBody, "Failed to read request body")
+			return
+		}
+		cf, err := canonicalForm(body)
+		if err != nil {
+			writeProblem(w, r, http.StatusBadRequest, codeInvalidJSON, "Invalid JSON: "+err.Error())
+			return
+		}
+		writeCanonicalForm(w, cf)
+	}
+}
+
+// canonicalWebhookHandler canonicalizes the body of a stored record.
+func canonicalWebhookHandler(buffer *RingBuffer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		item, ok := buffer.Get(r.PathValue("id"))
+		if !ok {
+			writeProblem(w, r, http.StatusNotFound, codeNotFound, "No webhook with id "+r.PathValue("id"))
+			return
+		}
+		body, _, err := normalizeBody(item.Raw, item.ContentType)
+		if err != nil {
+			writeProblem(w, r, http.StatusBadRequest, codeUnreadableBody, "Failed to decode body: "+err.Error())
+			return
+		}
+		cf, err := canonicalForm(body)
+		if err != nil {
+			writeProblem(w, r, http.StatusBadRequest, codeInvalidJSON, "Body is not JSON: "+err.Error())
+			return
+		}
+		writeCanonicalForm(w, cf)
+	}
+}
+
+// canonicalizeCommand is "webhook-echo canonicalize [-hash|-with-hash]
+// [file...]". It prints the canonical form of each file, or of stdin, one
+// per line.
+func canonicalizeCommand(fs *flag.FlagSet) func(args []string, stdin io.Reader, stdout io.Writer) error {
+	hashOnly := fs.Bool("hash", false, "Print the SHA-256 of the canonical form instead")
+	withHash := fs.Bool("with-hash", false, "Print the SHA-256 after the canonical form")
+	return func(inputs []string, stdin io.Reader, stdout io.Writer) error {
+		return canonicalizeFiles(inputs, stdin, stdout, *hashOnly, *withHash)
+	}
+}
+
+// canonicalizedFile is the -output form of one canonicalized input.
+type canonicalizedFile struct {
+	Input string `json:"input"`
+	CanonicalForm
+}
+
+func canonicalizeFiles(inputs []string, stdin io.Reader, stdout io.Writer, hashOnly, withHash bool) error {
+	if len(inputs) == 0 {
+		inputs = []string{"-"}
+	}
+	out := &outputPrinter{w: stdout}
+	for _, name := range inputs {
+		var body []byte
+		var err error
+		if name == "-" {
+			body, err = io.ReadAll(stdin)
+		} else {
+			body, err = os.ReadFile(name)
+		}
+		if err != nil {
+			return err
+		}
+		cf, err := canonicalForm(body)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		err = out.Print(canonicalizedFile{Input: name, CanonicalForm: cf}, func() error {
+			switch {
+			case hashOnly:
+				_, err = fmt.Fprintln(stdout, cf.SHA256)
+			case withHash:
+				_, err = fmt.Fprintf(stdout, "%s %s\n", cf.Canonical, cf.SHA256)
+			default:
+				_, err = fmt.Fprintf(stdout, "%s\n", cf.Canonical)
+			}
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
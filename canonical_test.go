@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCanonicalNumber(t *testing.T) {
+	tests := map[string]string{
+		"0":                    "0",
+		"-0.0":                 "0",
+		"1.50":                 "1.5",
+		"15e-1":                "1.5",
+		"1E2":                  "100",
+		"100":                  "100",
+		"0.00120":              "0.0012",
+		"-12.5e+1":             "-125",
+		"12345678901234567891": "12345678901234567891",
+		"1e9999":               "1e9999",
+		"-2.50e-2000":          "-2.5e-2000",
+	}
+	for in, want := range tests {
+		if got := canonicalNumber(in); got != want {
+			t.Errorf("canonicalNumber(%s) = %s, want %s", in, got, want)
+		}
+	}
+}
+
+func TestCanonicalize(t *testing.T) {
+	a, err := canonicalize([]byte(` { "b" : [1.0, "<&>"], "a": {"y": 2e0, "x": null} } `))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"a":{"x":null,"y":2},"b":[1,"<&>"]}`; string(a) != want {
+		t.Errorf("got %s, want %s", a, want)
+	}
+	b, _ := canonicalize([]byte(`{"a":{"x":null,"y":2.000},"b":[10e-1,"<&>"]}`))
+	if !bytes.Equal(a, b) {
+		t.Errorf("expected cosmetic differences to canonicalize away: %s vs %s", a, b)
+	}
+	if _, err := canonicalize([]byte(`{} []`)); err == nil {
+		t.Error("expected trailing data to be rejected")
+	}
+}
+
+func TestCanonicalEndpoints(t *testing.T) {
+	mux := newTestServer()
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/v1/canonicalize", strings.NewReader(`{"b":1.50,"a":true}`)))
+	var direct CanonicalForm
+	if err := json.Unmarshal(rec.Body.Bytes(), &direct); err != nil || string(direct.Canonical) != `{"a":true,"b":1.5}` || len(direct.SHA256) != 64 {
+		t.Fatalf("unexpected canonical form %s (%v)", rec.Body, err)
+	}
+
+	id := postWebhook(t, mux, `{"event":"order", "data":{"n":1.0}}`).Header().Get("X-Echo-Id")
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/webhooks/"+id+"/canonical", nil))
+	var stored CanonicalForm
+	json.Unmarshal(rec.Body.Bytes(), &stored)
+	if string(stored.Canonical) != `{"data":{"n":1},"event":"order"}` {
+		t.Errorf("unexpected canonical record body %s", rec.Body)
+	}
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/v1/canonicalize", strings.NewReader(`{`)))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for invalid JSON, got %d", rec.Code)
+	}
+}
+
+func TestCanonicalizeCommand(t *testing.T) {
+	var out bytes.Buffer
+	if err := runSubcommand("canonicalize", []string{"-with-hash"}, strings.NewReader(`{"b":2, "a":1}`), &out); err != nil {
+		t.Fatal(err)
+	}
+	canonical, hash, _ := strings.Cut(strings.TrimSpace(out.String()), " ")
+	if canonical != `{"a":1,"b":2}` || len(hash) != 64 {
+		t.Errorf("unexpected output %q", out.String())
+	}
+	if err := runSubcommand("canonicalize", nil, strings.NewReader(`nope`), &out); err == nil {
+		t.Error("expected an error for invalid input")
+	}
+}
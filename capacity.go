@@ -0,0 +1,213 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const alertKindCapacity = "capacity"
+
+// CapacityMonitor warns before captures are lost: when the buffer fills up
+// past one of Levels (percentages of its capacity), and when more than
+// EvictionRate records are evicted within a minute. Each level warns once
+// when reached; the eviction warning fires again after the rate has dropped.
+type CapacityMonitor struct {
+	Levels       []int
+	EvictionRate int
+
+	buffer    *RingBuffer
+	notifiers []Notifier
+
+	mu       sync.Mutex
+	reached  int    // number of Levels reached
+	evicted  uint64 // the buffer's eviction count when last observed
+	seconds  [60]evictionSecond
+	spiking  bool
+	now      func() time.Time
+	dispatch func(Alert, []Notifier)
+}
+
+// evictionSecond counts the evictions within one second of the last minute.
+type evictionSecond struct {
+	unix int64
+	n    int
+}
+
+func NewCapacityMonitor(buffer *RingBuffer, levels []int, evictionRate int, notifiers []Notifier) *CapacityMonitor {
+	levels = slices.Clone(levels)
+	slices.Sort(levels)
+	return &CapacityMonitor{
+		Levels:       levels,
+		EvictionRate: evictionRate,
+		buffer:       buffer,
+		notifiers:    notifiers,
+		evicted:      buffer.Evictions(),
+		now:          time.Now,
+		dispatch:     notifyAsync,
+	}
+}
+
+// parseLevels parses comma-separated occupancy percentages.
+func parseLevels(s string) ([]int, error) {
+	var levels []int
+	for _, item := range splitList(s) {
+		level, err := strconv.Atoi(item)
+		if err != nil || level <= 0 || level > 100 {
+			return nil, fmt.Errorf("%q is not a percentage between 1 and 100", item)
+		}
+		levels = append(levels, level)
+	}
+	return levels, nil
+}
+
+// parseNotifiers parses a JSON array of notifiers, in the form used by
+// alert rule actions.
+func parseNotifiers(s string) ([]Notifier, error) {
+	if s == "" {
+		return nil, nil
+	}
+	var configs []NotifierConfig
+	if err := json.Unmarshal([]byte(s), &configs); err != nil {
+		return nil, err
+	}
+	notifiers := make([]Notifier, 0, len(configs))
+	for _, cfg := range configs {
+		n, err := newNotifier(cfg)
+		if err != nil {
+			return nil, err
+		}
+		notifiers = append(notifiers, n)
+	}
+	return notifiers, nil
+}
+
+func (m *CapacityMonitor) OnIngest(WebhookParams, []byte) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	evicted := m.buffer.Evictions()
+	if n := int(evicted - m.evicted); n > 0 {
+		s := &m.seconds[now.Unix()%int64(len(m.seconds))]
+		if s.unix != now.Unix() {
+			*s = evictionSecond{unix: now.Unix()}
+		}
+		s.n += n
+	}
+	m.evicted = evicted
+
+	occupancy := m.occupancy()
+	reached := m.reached
+	for reached < len(m.Levels) && occupancy >= float64(m.Levels[reached]) {
+		reached++
+	}
+	for reached > 0 && occupancy < float64(m.Levels[reached-1]) {
+		reached--
+	}
+	if reached > m.reached {
+		m.warn("buffer-occupancy", m.buffer.Len(), now, fmt.Sprintf("Buffer is %.0f%% full (%d of %d records), threshold %d%%",
+			occupancy, m.buffer.Len(), m.buffer.Cap(), m.Levels[reached-1]))
+	}
+	m.reached = reached
+
+	if m.EvictionRate <= 0 {
+		return
+	}
+	rate := m.evictionsLastMinute(now)
+	spiking := rate > m.EvictionRate
+	if spiking && !m.spiking {
+		m.warn("eviction-rate", rate, now, fmt.Sprintf("%d records evicted within the last minute (threshold %d)", rate, m.EvictionRate))
+	}
+	m.spiking = spiking
+}
+
+func (m *CapacityMonitor) warn(rule string, count int, now time.Time, message string) {
+	alert := Alert{
+		Rule:    rule,
+		Kind:    alertKindCapacity,
+		Message: message,
+		Count:   count,
+		FiredAt: now.UTC(),
+	}
+	log.Printf("Warning: %s", message)
+	m.dispatch(alert, m.notifiers)
+}
+
+func (m *CapacityMonitor) occupancy() float64 {
+	return float64(m.buffer.Len()) * 100 / float64(m.buffer.Cap())
+}
+
+func (m *CapacityMonitor) evictionsLastMinute(now time.Time) int {
+	total := 0
+	for _, s := range m.seconds {
+		if now.Unix()-s.unix < int64(len(m.seconds)) {
+			total += s.n
+		}
+	}
+	return total
+}
+
+// Health is the body of /healthz. Status is "degraded" while the buffer is
+// past its highest warning level or evicting faster than allowed.
+type Health struct {
+	Status   string       `json:"status"`
+	Buffer   BufferHealth `json:"buffer"`
+	Warnings []string     `json:"warnings,omitempty"`
+}
+
+type BufferHealth struct {
+	Len                 int     `json:"len"`
+	Cap                 int     `json:"cap"`
+	Occupancy           float64 `json:"occupancy_percent"`
+	Evictions           uint64  `json:"evictions"`
+	Expired             uint64  `json:"expired"`
+	EvictionsLastMinute int     `json:"evictions_last_minute"`
+}
+
+func (m *CapacityMonitor) Health() Health {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	h := Health{
+		Status: "ok",
+		Buffer: BufferHealth{
+			Len:                 m.buffer.Len(),
+			Cap:                 m.buffer.Cap(),
+			Occupancy:           m.occupancy(),
+			Evictions:           m.buffer.Evictions(),
+			Expired:             m.buffer.Expired(),
+			EvictionsLastMinute: m.evictionsLastMinute(now),
+		},
+	}
+	if n := len(m.Levels); n > 0 && h.Buffer.Occupancy >= float64(m.Levels[n-1]) {
+		h.Warnings = append(h.Warnings, fmt.Sprintf("buffer is %.0f%% full, threshold %d%%", h.Buffer.Occupancy, m.Levels[n-1]))
+	}
+	if m.EvictionRate > 0 && h.Buffer.EvictionsLastMinute > m.EvictionRate {
+		h.Warnings = append(h.Warnings, fmt.Sprintf("%d records evicted within the last minute, threshold %d", h.Buffer.EvictionsLastMinute, m.EvictionRate))
+	}
+	if len(h.Warnings) > 0 {
+		h.Status = "degraded"
+	}
+	return h
+}
+
+// healthHandler serves /healthz. A degraded server still answers 200 so that
+// liveness probes do not restart it and lose the buffer, unless ?strict=true
+// asks for 503.
+func healthHandler(monitor *CapacityMonitor) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		h := monitor.Health()
+		w.Header().Set("Content-Type", "application/json")
+		if strict, _ := strconv.ParseBool(r.URL.Query().Get("strict")); strict && h.Status != "ok" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(h)
+	}
+}
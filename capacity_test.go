@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCapacityMonitorLevels(t *testing.T) {
+	buffer := NewRingBuffer(10)
+	monitor := NewCapacityMonitor(buffer, []int{90, 50}, 0, nil)
+	var fired []Alert
+	monitor.dispatch = func(a Alert, _ []Notifier) { fired = append(fired, a) }
+
+	for i := 0; i < 15; i++ {
+		item, _ := buffer.Push(WebhookParams{EventType: "order"})
+		monitor.OnIngest(item, nil)
+	}
+	if len(fired) != 2 || fired[0].Rule != "buffer-occupancy" || fired[0].Count != 5 || fired[1].Count != 9 {
+		t.Fatalf("expected one warning per level, got %+v", fired)
+	}
+	if h := monitor.Health(); h.Status != "degraded" || h.Buffer.Occupancy != 100 || h.Buffer.Evictions != 5 {
+		t.Errorf("unexpected health %+v", h)
+	}
+}
+
+func TestCapacityMonitorEvictionRate(t *testing.T) {
+	buffer := NewRingBuffer(2)
+	monitor := NewCapacityMonitor(buffer, nil, 3, nil)
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	monitor.now = func() time.Time { return now }
+	var fired []Alert
+	monitor.dispatch = func(a Alert, _ []Notifier) { fired = append(fired, a) }
+
+	ingest := func(n int) {
+		for i := 0; i < n; i++ {
+			item, _ := buffer.Push(WebhookParams{EventType: "order"})
+			monitor.OnIngest(item, nil)
+			now = now.Add(time.Second)
+		}
+	}
+	ingest(6) // 4 evictions
+	if len(fired) != 1 || fired[0].Rule != "eviction-rate" || fired[0].Count != 4 {
+		t.Fatalf("expected an eviction warning, got %+v", fired)
+	}
+	ingest(3)
+	if len(fired) != 1 {
+		t.Fatalf("expected a single warning while spiking, got %+v", fired)
+	}
+
+	now = now.Add(2 * time.Minute)
+	if h := monitor.Health(); h.Status != "ok" || h.Buffer.EvictionsLastMinute != 0 {
+		t.Errorf("expected the spike to be over, got %+v", h)
+	}
+	ingest(1)
+	ingest(4)
+	if len(fired) != 2 {
+		t.Errorf("expected a second warning after the rate dropped, got %+v", fired)
+	}
+}
+
+func TestHealthHandler(t *testing.T) {
+	buffer := NewRingBuffer(2)
+	monitor := NewCapacityMonitor(buffer, []int{100}, 0, nil)
+	monitor.dispatch = func(Alert, []Notifier) {}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", healthHandler(monitor))
+
+	get := func(path string) (int, Health) {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		var h Health
+		if err := json.NewDecoder(rec.Body).Decode(&h); err != nil {
+			t.Fatal(err)
+		}
+		return rec.Code, h
+	}
+	if code, h := get("/healthz?strict=true"); code != http.StatusOK || h.Status != "ok" {
+		t.Errorf("expected ok, got %d %+v", code, h)
+	}
+
+	for i := 0; i < 2; i++ {
+		item, _ := buffer.Push(WebhookParams{EventType: "order"})
+		monitor.OnIngest(item, nil)
+	}
+	if code, h := get("/healthz"); code != http.StatusOK || h.Status != "degraded" || len(h.Warnings) != 1 {
+		t.Errorf("expected a degraded 200, got %d %+v", code, h)
+	}
+	if code, _ := get("/healthz?strict=true"); code != http.StatusServiceUnavailable {
+		t.Errorf("expected 503 in strict mode, got %d", code)
+	}
+}
+
+func TestParseLevels(t *testing.T) {
+	if levels, err := parseLevels("80, 95"); err != nil || len(levels) != 2 || levels[1] != 95 {
+		t.Errorf("got %v, %v", levels, err)
+	}
+	for _, bad := range []string{"0", "101", "half"} {
+		if _, err := parseLevels(bad); err == nil {
+			t.Errorf("%q: expected an error", bad)
+		}
+	}
+}
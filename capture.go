@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+)
+
+// captureHeader lets a sender control recording inline: "skip" leaves just
+// that request out. "pause" and "resume" flip the switch from that request
+// on, but only for requests carrying the admin token; otherwise they are
+// ignored, so that one sender cannot stop recording for everyone.
+const captureHeader = "X-Echo-Capture"
+
+func (rec *Recorder) Pause()       { rec.paused.Store(true) }
+func (rec *Recorder) Resume()      { rec.paused.Store(false) }
+func (rec *Recorder) Paused() bool { return rec.paused.Load() }
+
+// captureControl applies the captureHeader of r and reports whether r should
+// be recorded.
+func captureControl(rec *Recorder, r *http.Request) bool {
+	switch r.Header.Get(captureHeader) {
+	case "pause":
+		if !isAdmin(rec.adminToken, r) {
+			break
+		}
+		if !rec.Paused() {
+			log.Printf("Capture paused by %s header", captureHeader)
+		}
+		rec.Pause()
+	case "resume":
+		if !isAdmin(rec.adminToken, r) {
+			break
+		}
+		if rec.Paused() {
+			log.Printf("Capture resumed by %s header", captureHeader)
+		}
+		rec.Resume()
+	case "skip":
+		return false
+	}
+	return true
+}
+
+type captureStatus struct {
+	Paused bool `json:"paused"`
+}
+
+func captureHandler(rec *Recorder, set func()) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if set != nil {
+			set()
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(captureStatus{Paused: rec.Paused()})
+	}
+}
+
+// registerCaptureRoutes mounts the admin switch that stops and restarts
+// recording. Ingest keeps answering as usual while paused.
+func registerCaptureRoutes(mux *http.ServeMux, rec *Recorder, adminToken string) {
+	handleAPI(mux, "GET /admin/capture", requireAdmin(adminToken, captureHandler(rec, nil)))
+	handleAPI(mux, "POST /admin/pause", requireAdmin(adminToken, captureHandler(rec, rec.Pause)))
+	handleAPI(mux, "POST /admin/resume", requireAdmin(adminToken, captureHandler(rec, rec.Resume)))
+}
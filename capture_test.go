@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func newCaptureTestServer() *http.ServeMux {
+	mux := http.NewServeMux()
+	recorder := registerRoutes(mux, NewRingBuffer(100), "secret")
+	registerCaptureRoutes(mux, recorder, "secret")
+	return mux
+}
+
+func adminPost(t *testing.T, mux *http.ServeMux, path string) int {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, path, nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	return rec.Code
+}
+
+func postWebhookWithCapture(t *testing.T, mux *http.ServeMux, body, capture string, admin bool) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString(body))
+	req.Header.Set(captureHeader, capture)
+	if admin {
+		req.Header.Set("Authorization", "Bearer secret")
+	}
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestPauseAndResume(t *testing.T) {
+	mux := newCaptureTestServer()
+	body := `{"event":"noise","data":{},"version":"1"}`
+
+	if code := adminPost(t, mux, "/v1/admin/pause"); code != http.StatusOK {
+		t.Fatalf("pause failed with status %d", code)
+	}
+	rec := postWebhook(t, mux, body)
+	if rec.Code != http.StatusOK || rec.Body.String() != body {
+		t.Errorf("expected a normal echo while paused, got %d %q", rec.Code, rec.Body.String())
+	}
+	if got := queryWebhooks(t, mux, "/query/noise"); len(got) != 0 {
+		t.Errorf("expected nothing recorded while paused, got %d", len(got))
+	}
+
+	adminPost(t, mux, "/v1/admin/resume")
+	postWebhook(t, mux, body)
+	if got := queryWebhooks(t, mux, "/query/noise"); len(got) != 1 {
+		t.Errorf("expected 1 recorded after resume, got %d", len(got))
+	}
+}
+
+func TestPauseRequiresAdmin(t *testing.T) {
+	mux := newCaptureTestServer()
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/v1/admin/pause", nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected status 401, got %d", rec.Code)
+	}
+}
+
+func TestCaptureHeader(t *testing.T) {
+	mux := newCaptureTestServer()
+	body := `{"event":"e","data":{},"version":"1"}`
+
+	postWebhookWithCapture(t, mux, body, "skip", false)
+	postWebhookWithCapture(t, mux, body, "pause", true)
+	postWebhook(t, mux, body)
+	if got := queryWebhooks(t, mux, "/query/e"); len(got) != 0 {
+		t.Fatalf("expected skip and pause to record nothing, got %d", len(got))
+	}
+
+	// The resuming request is itself recorded.
+	postWebhookWithCapture(t, mux, body, "resume", true)
+	postWebhook(t, mux, body)
+	if got := queryWebhooks(t, mux, "/query/e"); len(got) != 2 {
+		t.Errorf("expected 2 recorded after resume, got %d", len(got))
+	}
+}
+
+func TestCaptureHeaderPauseRequiresAdmin(t *testing.T) {
+	mux := newCaptureTestServer()
+	body := `{"event":"e","data":{},"version":"1"}`
+
+	postWebhookWithCapture(t, mux, body, "pause", false)
+	postWebhook(t, mux, body)
+	if got := queryWebhooks(t, mux, "/query/e"); len(got) != 2 {
+		t.Errorf("expected a pause without the admin token to be ignored, got %d recorded", len(got))
+	}
+}
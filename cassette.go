@@ -0,0 +1,256 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// cassetteVersion is the go-vcr cassette format version written and read.
+const cassetteVersion = 2
+
+// maxCassetteSize bounds an uploaded cassette.
+const maxCassetteSize = 32 << 20
+
+// Cassette is a go-vcr cassette. It is written as JSON, which is also YAML,
+// so go-vcr loads the exported file as is.
+type Cassette struct {
+	Version      int           `json:"version"`
+	Interactions []Interaction `json:"interactions"`
+}
+
+type Interaction struct {
+	ID       int              `json:"id"`
+	Request  CassetteRequest  `json:"request"`
+	Response CassetteResponse `json:"response"`
+}
+
+type CassetteRequest struct {
+	Proto         string      `json:"proto,omitempty"`
+	ProtoMajor    int         `json:"proto_major,omitempty"`
+	ProtoMinor    int         `json:"proto_minor,omitempty"`
+	ContentLength int64       `json:"content_length"`
+	Host          string      `json:"host,omitempty"`
+	RemoteAddr    string      `json:"remote_addr,omitempty"`
+	Body          string      `json:"body"`
+	Form          url.Values  `json:"form"`
+	Headers       http.Header `json:"headers"`
+	URL           string      `json:"url"`
+	Method        string      `json:"method"`
+}
+
+type CassetteResponse struct {
+	Proto         string      `json:"proto,omitempty"`
+	ProtoMajor    int         `json:"proto_major,omitempty"`
+	ProtoMinor    int         `json:"proto_minor,omitempty"`
+	ContentLength int64       `json:"content_length"`
+	Body          string      `json:"body"`
+	Headers       http.Header `json:"headers"`
+	Status        string      `json:"status"`
+	Code          int         `json:"code"`
+	Duration      string      `json:"duration"`
+}
+
+// cassetteOf turns records, oldest first, into a cassette with one
+// interaction each. Records keep neither the request path nor the response
+// body, so the URL is the host's root and the response holds the status
+// the webhook was answered with.
+func cassetteOf(items []WebhookParams) Cassette {
+	c := Cassette{Version: cassetteVersion, Interactions: make([]Interaction, 0, len(items))}
+	for i, item := range items {
+		req := CassetteRequest{
+			Proto: "HTTP/1.1", ProtoMajor: 1, ProtoMinor: 1,
+			ContentLength: int64(len(item.Raw)),
+			Body:          string(item.Raw),
+			Form:          url.Values{},
+			Headers:       item.Headers,
+			URL:           "http://localhost/",
+			Method:        http.MethodPost,
+		}
+		if req.Headers == nil {
+			req.Headers = http.Header{}
+		}
+		if item.Client != nil {
+			req.Host, req.RemoteAddr = item.Client.Host, item.Client.IP
+			req.URL = item.Client.Proto + "://" + item.Client.Host + "/"
+		}
+		code := item.StatusCode
+		if code == 0 {
+			code = http.StatusOK
+		}
+		var duration time.Duration
+		if item.Transfer != nil {
+			duration = time.Duration(item.Transfer.DurationMs * float64(time.Millisecond))
+		}
+		c.Interactions = append(c.Interactions, Interaction{
+			ID:      i,
+			Request: req,
+			Response: CassetteResponse{
+				Proto: "HTTP/1.1", ProtoMajor: 1, ProtoMinor: 1,
+				Headers:  http.Header{},
+				Status:   fmt.Sprintf("%d %s", code, http.StatusText(code)),
+				Code:     code,
+				Duration: duration.String(),
+			},
+		})
+	}
+	return c
+}
+
+// cassetteHandler exports the records matching the query parameters, as
+// for /query, as a go-vcr cassette in the order they were received.
+func cassetteHandler(buffer *RingBuffer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		filter, err := parseQueryFilter(r.URL.Query(), r.PathValue("event_type"))
+		if err != nil {
+			writeParamError(w, r, err)
+			return
+		}
+		ctx, cancel := scanContext(r)
+		defer cancel()
+		items, truncated := buffer.Query(ctx, filter)
+		if truncated {
+			w.Header().Set("X-Echo-Truncated", "true")
+		}
+		slices.Reverse(items)
+		w.Header().Set("Content-Type", "application/yaml")
+		w.Header().Set("Content-Disposition", `attachment; filename="cassette.yaml"`)
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.Encode(cassetteOf(items))
+	}
+}
+
+// playback answers ingest requests with the responses of a loaded cassette,
+// one interaction after another, until it runs out.
+var playback = &cassettePlayer{}
+
+type cassettePlayer struct {
+	mu        sync.Mutex
+	responses []CassetteResponse
+	next      int
+}
+
+// PlaybackStatus reports how far a loaded cassette has been played.
+type PlaybackStatus struct {
+	Interactions int `json:"interactions"`
+	Played       int `json:"played"`
+	Remaining    int `json:"remaining"`
+}
+
+func (p *cassettePlayer) Load(c Cassette) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.responses, p.next = make([]CassetteResponse, 0, len(c.Interactions)), 0
+	for _, interaction := range c.Interactions {
+		p.responses = append(p.responses, interaction.Response)
+	}
+}
+
+// Next returns the response to play for the next ingest request, or nil
+// once the cassette is played out.
+func (p *cassettePlayer) Next() *CassetteResponse {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.next >= len(p.responses) {
+		return nil
+	}
+	resp := &p.responses[p.next]
+	p.next++
+	return resp
+}
+
+func (p *cassettePlayer) Status() PlaybackStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return PlaybackStatus{Interactions: len(p.responses), Played: p.next, Remaining: len(p.responses) - p.next}
+}
+
+// write plays resp. Headers the body framing depends on are left to
+// net/http, as the recorded body has already been decoded.
+func (resp *CassetteResponse) write(w http.ResponseWriter) {
+	for name, values := range resp.Headers {
+		switch http.CanonicalHeaderKey(name) {
+		case "Content-Length", "Transfer-Encoding", "Content-Encoding":
+			continue
+		}
+		w.Header()[http.CanonicalHeaderKey(name)] = values
+	}
+	w.Header().Set("X-Echo-Cassette", "played")
+	code := resp.Code
+	if code == 0 {
+		code = http.StatusOK
+	}
+	w.WriteHeader(code)
+	io.WriteString(w, resp.Body)
+}
+
+// parseCassette reads a go-vcr cassette, in JSON or in the YAML go-vcr
+// writes.
+func parseCassette(data []byte) (Cassette, error) {
+	var c Cassette
+	trimmed := bytes.TrimSpace(data)
+	if !bytes.HasPrefix(trimmed, []byte("{")) {
+		doc, err := parseYAML(string(data))
+		if err != nil {
+			return c, err
+		}
+		if data, err = json.Marshal(doc); err != nil {
+			return c, err
+		}
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if err := dec.Decode(&c); err != nil {
+		return c, err
+	}
+	if c.Version != 1 && c.Version != cassetteVersion {
+		return c, fmt.Errorf("unsupported cassette version %d", c.Version)
+	}
+	for i, interaction := range c.Interactions {
+		if interaction.Response.Code == 0 {
+			code, _, _ := strings.Cut(interaction.Response.Status, " ")
+			c.Interactions[i].Response.Code, _ = strconv.Atoi(code)
+		}
+	}
+	return c, nil
+}
+
+func loadPlaybackHandler(p *cassettePlayer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxCassetteSize))
+		if err != nil {
+			writeProblem(w, r, http.StatusBadRequest, codeUnreadableBody, "Failed to read cassette")
+			return
+		}
+		c, err := parseCassette(data)
+		if err != nil {
+			writeProblem(w, r, http.StatusBadRequest, codeInvalidJSON, "Invalid cassette: "+err.Error())
+			return
+		}
+		p.Load(c)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(p.Status())
+	}
+}
+
+func playbackStatusHandler(p *cassettePlayer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(p.Status())
+	}
+}
+
+func stopPlaybackHandler(p *cassettePlayer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		p.Load(Cassette{})
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,297 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"html/template"
+	"maps"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// catalogSampleSize bounds how many of the newest records of each event type
+// the catalog infers fields from.
+const catalogSampleSize = 500
+
+// CatalogEntry documents one event type: the totals the event type index
+// keeps, the fields seen in the newest records still in the buffer, and the
+// newest payload, redacted as in share links, as an example.
+type CatalogEntry struct {
+	EventType   string         `json:"event"`
+	Description string         `json:"description,omitempty"`
+	Count       int            `json:"count"`
+	FirstSeen   time.Time      `json:"first_seen"`
+	LastSeen    time.Time      `json:"last_seen"`
+	Versions    []string       `json:"versions"`
+	Sampled     int            `json:"sampled"`
+	Fields      []CatalogField `json:"fields"`
+	Example     map[string]any `json:"example,omitempty"`
+	ExampleID   string         `json:"example_id,omitempty"`
+}
+
+// CatalogField is a payload field, with its dotted path as in the lint
+// report. Required is set when every sampled record has it.
+type CatalogField struct {
+	Path        string   `json:"path"`
+	Types       []string `json:"types"`
+	Seen        int      `json:"seen"`
+	Required    bool     `json:"required"`
+	Example     any      `json:"example,omitempty"`
+	Description string   `json:"description,omitempty"`
+}
+
+// CatalogNotes are the descriptions written for an event type and its
+// fields through the API, kept in memory.
+type CatalogNotes struct {
+	Description string            `json:"description,omitempty"`
+	Fields      map[string]string `json:"fields,omitempty"`
+}
+
+type Catalog struct {
+	mu    sync.RWMutex
+	notes map[string]CatalogNotes
+}
+
+func NewCatalog() *Catalog {
+	return &Catalog{notes: make(map[string]CatalogNotes)}
+}
+
+// Annotate sets the description of eventType, unless description is nil,
+// and those of the given fields, an empty one removing it.
+func (c *Catalog) Annotate(eventType string, description *string, fields map[string]string) CatalogNotes {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	notes := c.notes[eventType]
+	if description != nil {
+		notes.Description = *description
+	}
+	merged := maps.Clone(notes.Fields)
+	if merged == nil {
+		merged = make(map[string]string)
+	}
+	for path, desc := range fields {
+		if desc == "" {
+			delete(merged, path)
+		} else {
+			merged[path] = desc
+		}
+	}
+	notes.Fields = merged
+	c.notes[eventType] = notes
+	return notes
+}
+
+func (c *Catalog) Notes(eventType string) CatalogNotes {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.notes[eventType]
+}
+
+// catalogShape collects the fields of one event type's sampled records.
+type catalogShape struct {
+	entry  *CatalogEntry
+	fields map[string]*CatalogField
+}
+
+func (cs *catalogShape) add(item WebhookParams) {
+	cs.entry.Sampled++
+	if cs.entry.Example == nil && item.Payload != nil {
+		cs.entry.Example, _ = redactValue(item.Payload).(map[string]any)
+		cs.entry.ExampleID = item.ID
+	}
+	seen := make(map[string]bool)
+	var walk func(path, key string, value any)
+	walk = func(path, key string, value any) {
+		field := cs.fields[path]
+		if field == nil {
+			field = &CatalogField{Path: path}
+			cs.fields[path] = field
+		}
+		if !seen[path] {
+			seen[path] = true
+			field.Seen++
+		}
+		if kind := jsonType(value); !slices.Contains(field.Types, kind) {
+			field.Types = append(field.Types, kind)
+			sort.Strings(field.Types)
+		}
+		switch v := value.(type) {
+		case map[string]any:
+			for key, child := range v {
+				walk(path+"."+key, key, child)
+			}
+		case []any:
+			for _, child := range v {
+				walk(path+"[]", key, child)
+			}
+		case nil:
+		default:
+			if field.Example == nil {
+				field.Example = v
+				if isSensitive(key) {
+					field.Example = redacted
+				}
+			}
+		}
+	}
+	for key, value := range item.Payload {
+		walk(key, key, value)
+	}
+}
+
+// buildCatalog documents every event type idx knows of, or only eventType
+// when it is set, from the records of s. It reports whether the scan ran
+// out of time.
+func buildCatalog(ctx context.Context, s *Snapshot, idx *EventTypeIndex, c *Catalog, eventType string) ([]CatalogEntry, bool) {
+	shapes := make(map[string]*catalogShape)
+	var order []string
+	for _, stats := range idx.List() {
+		if eventType != "" && stats.EventType != eventType {
+			continue
+		}
+		notes := c.Notes(stats.EventType)
+		shapes[stats.EventType] = &catalogShape{
+			entry: &CatalogEntry{
+				EventType:   stats.EventType,
+				Description: notes.Description,
+				Count:       stats.Count,
+				FirstSeen:   stats.FirstSeen,
+				LastSeen:    stats.LastSeen,
+				Versions:    stats.Versions,
+				Fields:      []CatalogField{},
+			},
+			fields: make(map[string]*CatalogField),
+		}
+		order = append(order, stats.EventType)
+	}
+
+	truncated := false
+	for i := 0; i < s.count; i++ {
+		if i%scanCheckInterval == 0 && ctx.Err() != nil {
+			truncated = true
+			break
+		}
+		item := s.at(s.newest(i))
+		if shape := shapes[item.EventType]; shape != nil && shape.entry.Sampled < catalogSampleSize {
+			shape.add(*item)
+		}
+	}
+
+	entries := make([]CatalogEntry, len(order))
+	for i, name := range order {
+		shape := shapes[name]
+		notes := c.Notes(name)
+		for _, field := range shape.fields {
+			field.Required = field.Seen == shape.entry.Sampled
+			field.Description = notes.Fields[field.Path]
+			shape.entry.Fields = append(shape.entry.Fields, *field)
+		}
+		sort.Slice(shape.entry.Fields, func(i, j int) bool { return shape.entry.Fields[i].Path < shape.entry.Fields[j].Path })
+		entries[i] = *shape.entry
+	}
+	return entries, truncated
+}
+
+// Pretty renders the example payload for the HTML catalog.
+func (e CatalogEntry) Pretty() string {
+	b, _ := json.MarshalIndent(e.Example, "", "  ")
+	return string(b)
+}
+
+// ExampleValue renders a field's example for the HTML catalog.
+func (f CatalogField) ExampleValue() string {
+	if f.Example == nil {
+		return ""
+	}
+	b, _ := json.Marshal(f.Example)
+	return string(b)
+}
+
+var catalogTemplate = template.Must(template.New("catalog").Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>Event catalog</title></head><body>
+<h1>Event catalog</h1>
+{{if not .}}<p>No webhooks received.</p>{{else}}<ul>{{range .}}<li><a href="#{{.EventType}}">{{.EventType}}</a></li>{{end}}</ul>{{end}}
+{{range .}}<section id="{{.EventType}}">
+<h2>{{.EventType}}</h2>
+{{if .Description}}<p>{{.Description}}</p>{{end}}
+<p>{{.Count}} received, first {{.FirstSeen.Format "2006-01-02T15:04:05Z07:00"}}, last {{.LastSeen.Format "2006-01-02T15:04:05Z07:00"}}; fields from the newest {{.Sampled}}.{{if .Versions}} Versions: {{range $i, $v := .Versions}}{{if $i}}, {{end}}{{if $v}}{{$v}}{{else}}(none){{end}}{{end}}.{{end}}</p>
+{{if .Fields}}<table>
+<tr><th>Field</th><th>Type</th><th>Required</th><th>Example</th><th>Description</th></tr>
+{{range .Fields}}<tr><td><code>{{.Path}}</code></td><td>{{range $i, $t := .Types}}{{if $i}} | {{end}}{{$t}}{{end}}</td><td>{{if .Required}}yes{{else}}no{{end}}</td><td><code>{{.ExampleValue}}</code></td><td>{{.Description}}</td></tr>
+{{end}}</table>{{end}}
+{{if .Example}}<h3>Example</h3>
+<pre>{{.Pretty}}</pre>{{end}}
+</section>
+{{end}}</body></html>
+`))
+
+// catalogHandler serves GET /catalog and /catalog/{event_type}, as JSON or,
+// with format=html, as a browsable page.
+func catalogHandler(buffer *RingBuffer, idx *EventTypeIndex, c *Catalog) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		format := r.URL.Query().Get("format")
+		if format != "" && format != "json" && format != "html" {
+			writeProblem(w, r, http.StatusBadRequest, codeInvalidParameter, "format must be json or html")
+			return
+		}
+		eventType := r.PathValue("event_type")
+		ctx, cancel := scanContext(r)
+		defer cancel()
+		entries, truncated := buildCatalog(ctx, buffer.Snapshot(), idx, c, eventType)
+		if eventType != "" && len(entries) == 0 {
+			writeProblem(w, r, http.StatusNotFound, codeNotFound, "No webhooks with event type "+eventType)
+			return
+		}
+		if truncated {
+			w.Header().Set("X-Echo-Truncated", "true")
+		}
+		if format == "html" {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			catalogTemplate.Execute(w, entries)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if eventType != "" {
+			json.NewEncoder(w).Encode(entries[0])
+			return
+		}
+		json.NewEncoder(w).Encode(entries)
+	}
+}
+
+// annotateCatalogHandler serves PATCH /catalog/{event_type}, which sets the
+// event type's description and those of its fields, e.g.
+// {"description": "...", "fields": {"data.id": "..."}}. Descriptions not in
+// the request are kept.
+func annotateCatalogHandler(c *Catalog) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var update struct {
+			Description *string           `json:"description"`
+			Fields      map[string]string `json:"fields"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+			writeProblem(w, r, http.StatusBadRequest, codeInvalidJSON, "Invalid JSON: "+err.Error())
+			return
+		}
+		for path := range update.Fields {
+			if strings.TrimSpace(path) == "" {
+				writeProblem(w, r, http.StatusBadRequest, codeInvalidParameter, "Field paths must not be empty")
+				return
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(c.Annotate(r.PathValue("event_type"), update.Description, update.Fields))
+	}
+}
+
+// registerCatalogRoutes mounts the event catalog. Annotating an event type
+// takes the admin token.
+func registerCatalogRoutes(mux *http.ServeMux, buffer *RingBuffer, idx *EventTypeIndex, c *Catalog, adminToken string) {
+	handleAPI(mux, "GET /catalog", catalogHandler(buffer, idx, c))
+	handleAPI(mux, "GET /catalog/{event_type}", catalogHandler(buffer, idx, c))
+	handleAPI(mux, "PATCH /catalog/{event_type}", requireAdmin(adminToken, annotateCatalogHandler(c)))
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCatalogInfersFields(t *testing.T) {
+	mux := newTestServer()
+	postWebhook(t, mux, `{"event":"order","data":{"id":1,"note":null,"password":"hunter2"}}`)
+	postWebhook(t, mux, `{"event":"order","data":{"id":2,"note":"rush","items":[{"sku":"a"}],"password":"hunter3"}}`)
+	postWebhook(t, mux, `{"event":"refund","data":{"amount":5}}`)
+
+	req := adminRequest(http.MethodPatch, "/catalog/order", strings.NewReader(`{"description":"An order was placed.","fields":{"id":"Order number"}}`))
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("annotate failed with status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/catalog/order", nil))
+	var entry CatalogEntry
+	json.NewDecoder(rec.Body).Decode(&entry)
+	if entry.Description != "An order was placed." || entry.Count != 2 || entry.Sampled != 2 {
+		t.Fatalf("unexpected entry: %+v", entry)
+	}
+	fields := make(map[string]CatalogField)
+	for _, f := range entry.Fields {
+		fields[f.Path] = f
+	}
+	if f := fields["id"]; !f.Required || f.Example != 2.0 || f.Description != "Order number" {
+		t.Errorf("unexpected id field: %+v", f)
+	}
+	if f := fields["note"]; strings.Join(f.Types, ",") != "null,string" || !f.Required {
+		t.Errorf("unexpected note field: %+v", f)
+	}
+	if f := fields["items[].sku"]; f.Required || f.Seen != 1 || f.Example != "a" {
+		t.Errorf("unexpected items[].sku field: %+v", f)
+	}
+	if fields["password"].Example != redacted || entry.Example["password"] != redacted {
+		t.Errorf("expected sensitive examples to be redacted, got %+v and %v", fields["password"], entry.Example)
+	}
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/catalog?format=html", nil))
+	if page := rec.Body.String(); !strings.Contains(page, `<section id="refund">`) || !strings.Contains(page, "Order number") || strings.Contains(page, "hunter") {
+		t.Errorf("unexpected catalog page:\n%s", page)
+	}
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/catalog/unknown", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for an unknown event type, got %d", rec.Code)
+	}
+}
+
+func TestCatalogAnnotateWithoutAdminToken(t *testing.T) {
+	mux := http.NewServeMux()
+	registerCatalogRoutes(mux, NewRingBuffer(1), NewEventTypeIndex(), NewCatalog(), "")
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, adminRequest(http.MethodPatch, "/catalog/order", strings.NewReader(`{"description":"An order."}`)))
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("expected status 403 without a configured admin token, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+)
+
+// cborBreak is the stop code ending indefinite-length items.
+const cborBreak = 0xff
+
+// errCBORBreak reports a break code, which only ends indefinite-length
+// items; anywhere else it is errUnexpectedBreak.
+var (
+	errCBORBreak       = errors.New("break")
+	errUnexpectedBreak = errors.New("unexpected break")
+)
+
+func notBreak(err error) error {
+	if err == errCBORBreak {
+		return errUnexpectedBreak
+	}
+	return err
+}
+
+// decodeCBOR decodes a CBOR document (RFC 8949) into the values
+// encoding/json produces. Byte strings stay []byte, written as base64;
+// bignums become exact numbers and other tags are dropped, leaving the
+// tagged value.
+func decodeCBOR(body []byte) (any, error) {
+	r := &binaryReader{b: body}
+	v, err := r.cborValue(0)
+	if err != nil {
+		return nil, notBreak(err)
+	}
+	if r.remaining() > 0 {
+		return nil, fmt.Errorf("%d bytes after the top-level value", r.remaining())
+	}
+	return v, nil
+}
+
+// cborHead reads an item's major type and argument. Indefinite lengths are
+// reported as indefinite with a zero argument.
+func (r *binaryReader) cborHead() (major byte, arg uint64, indefinite bool, err error) {
+	c, err := r.byte()
+	if err != nil {
+		return 0, 0, false, err
+	}
+	major, info := c>>5, c&0x1f
+	switch {
+	case info < 24:
+		return major, uint64(info), false, nil
+	case info <= 27:
+		arg, err = r.uint(1 << (info - 24))
+		return major, arg, false, err
+	case info == 31 && major >= 2 && major <= 5:
+		return major, 0, true, nil
+	case c == cborBreak:
+		return 7, 0, false, errCBORBreak
+	}
+	return 0, 0, false, fmt.Errorf("invalid initial byte 0x%02x", c)
+}
+
+func (r *binaryReader) cborValue(depth int) (any, error) {
+	if maxJSONDepth > 0 && depth > maxJSONDepth {
+		return nil, fmt.Errorf("nesting exceeds %d levels", maxJSONDepth)
+	}
+	start := r.pos
+	major, arg, indefinite, err := r.cborHead()
+	if err != nil {
+		return nil, err
+	}
+	switch major {
+	case 0:
+		return integer(arg, false), nil
+	case 1:
+		// -1 - arg, which overflows uint64 for the largest arguments.
+		if arg < math.MaxUint64 {
+			return integer(arg+1, true), nil
+		}
+		n := new(big.Int).SetUint64(arg)
+		return json.Number(n.Add(n, big.NewInt(1)).Neg(n).String()), nil
+	case 2, 3:
+		b, err := r.cborString(major, arg, indefinite)
+		if major == 3 {
+			return string(b), err
+		}
+		return b, err
+	case 4:
+		if _, err := r.length(arg); err != nil {
+			return nil, err
+		}
+		items := []any{}
+		for i := uint64(0); indefinite || i < arg; i++ {
+			v, err := r.cborValue(depth + 1)
+			if indefinite && err == errCBORBreak {
+				break
+			}
+			if err != nil {
+				return nil, notBreak(err)
+			}
+			items = append(items, v)
+		}
+		return items, nil
+	case 5:
+		if _, err := r.length(arg); err != nil {
+			return nil, err
+		}
+		m := make(map[string]any)
+		for i := uint64(0); indefinite || i < arg; i++ {
+			k, err := r.cborValue(depth + 1)
+			if indefinite && err == errCBORBreak {
+				break
+			}
+			if err != nil {
+				return nil, notBreak(err)
+			}
+			v, err := r.cborValue(depth + 1)
+			if err != nil {
+				return nil, notBreak(err)
+			}
+			m[documentKey(k)] = v
+		}
+		return m, nil
+	case 6:
+		v, err := r.cborValue(depth + 1)
+		if err != nil {
+			return nil, notBreak(err)
+		}
+		// Tags 2 and 3 are unsigned and negative bignums.
+		if b, ok := v.([]byte); ok && (arg == 2 || arg == 3) {
+			n := new(big.Int).SetBytes(b)
+			if arg == 3 {
+				n.Add(n, big.NewInt(1)).Neg(n)
+			}
+			return json.Number(n.String()), nil
+		}
+		return v, nil
+	}
+
+	// Major type 7: simple values and floats.
+	switch info := r.b[start] & 0x1f; info {
+	case 20:
+		return false, nil
+	case 21:
+		return true, nil
+	case 22, 23:
+		return nil, nil
+	case 25:
+		return halfFloat(uint16(arg)), nil
+	case 26:
+		return float64(math.Float32frombits(uint32(arg))), nil
+	case 27:
+		return math.Float64frombits(arg), nil
+	}
+	return nil, fmt.Errorf("unsupported simple value %d", arg)
+}
+
+// cborString reads a byte or text string, joining the chunks of an
+// indefinite-length one.
+func (r *binaryReader) cborString(major byte, arg uint64, indefinite bool) ([]byte, error) {
+	if !indefinite {
+		n, err := r.length(arg)
+		if err != nil {
+			return nil, err
+		}
+		b, err := r.next(n)
+		return append([]byte(nil), b...), err
+	}
+	var out []byte
+	for {
+		m, n, chunked, err := r.cborHead()
+		if err == errCBORBreak {
+			return out, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if m != major || chunked {
+			return nil, errors.New("invalid chunk in indefinite-length string")
+		}
+		size, err := r.length(n)
+		if err != nil {
+			return nil, err
+		}
+		b, _ := r.next(size)
+		out = append(out, b...)
+	}
+}
+
+// halfFloat converts an IEEE 754 half-precision float.
+func halfFloat(h uint16) float64 {
+	exp, frac := int(h>>10)&0x1f, float64(h&0x3ff)
+	var v float64
+	switch exp {
+	case 0:
+		v = math.Ldexp(frac, -24)
+	case 0x1f:
+		if frac == 0 {
+			v = math.Inf(1)
+		} else {
+			v = math.NaN()
+		}
+	default:
+		v = math.Ldexp(frac+1024, exp-25)
+	}
+	if h&0x8000 != 0 {
+		v = -v
+	}
+	return v
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// ChainHashes makes the buffer link each stored record to its predecessor
+// by hash. It must be called before the first Push.
+func (rb *RingBuffer) ChainHashes() {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+	rb.chained = true
+}
+
+// recordHash hashes the immutable parts of a record together with the hash
+// of its predecessor. The raw body enters by its digest, and the headers
+// with canonical names, so /webhooks/{id}/raw and /body are sealed as well
+// as the parsed payload. The delivery count is left out as re-deliveries
+// bump it in place.
+func recordHash(item WebhookParams) string {
+	raw := sha256.Sum256(item.Raw)
+	canonical, _ := json.Marshal(struct {
+		PrevHash       string              `json:"prev_hash"`
+		ID             string              `json:"id"`
+		Sequence       uint64              `json:"sequence"`
+		EventType      string              `json:"event"`
+		Payload        map[string]any      `json:"data"`
+		Version        string              `json:"version"`
+		IdempotencyKey string              `json:"idempotency_key"`
+		ReceivedAt     time.Time           `json:"received_at"`
+		Source         string              `json:"source"`
+		RawSHA256      string              `json:"raw_sha256"`
+		ContentType    string              `json:"content_type"`
+		Headers        map[string][]string `json:"headers"`
+		Client         *ClientInfo         `json:"client"`
+	}{item.PrevHash, item.ID, item.Sequence, item.EventType, item.Payload, item.Version, item.IdempotencyKey, item.ReceivedAt, item.Source,
+		hex.EncodeToString(raw[:]), item.ContentType, canonicalHeaders(item.Headers), item.Client})
+	sum := sha256.Sum256(canonical)
+	return hex.EncodeToString(sum[:])
+}
+
+// canonicalHeaders keys h by canonical header name, merging the values of
+// names that differ only in case. Marshalled, the keys come out sorted.
+func canonicalHeaders(h http.Header) map[string][]string {
+	canonical := make(map[string][]string, len(h))
+	for name, values := range h {
+		key := http.CanonicalHeaderKey(name)
+		canonical[key] = append(canonical[key], values...)
+	}
+	return canonical
+}
+
+// ChainBreak locates the first record that fails verification.
+type ChainBreak struct {
+	Index      int       `json:"index"`
+	ReceivedAt time.Time `json:"received_at"`
+	Reason     string    `json:"reason"`
+}
+
+// ChainReport is the result of verifying the hash chain. Records evicted
+// from the buffer can no longer be checked, so the oldest retained record's
+// PrevHash is reported as the anchor the chain is verified from.
+type ChainReport struct {
+	Enabled bool        `json:"enabled"`
+	Valid   bool        `json:"valid"`
+	Records int         `json:"records"`
+	Anchor  string      `json:"anchor,omitempty"`
+	Head    string      `json:"head,omitempty"`
+	Broken  *ChainBreak `json:"broken,omitempty"`
+}
+
+// VerifyChain recomputes every retained record's hash, oldest first, and
+// checks that each links to the one before it.
+func (rb *RingBuffer) VerifyChain() ChainReport {
+	snap := rb.Snapshot()
+	report := ChainReport{Enabled: snap.chained, Records: snap.count}
+	if !snap.chained {
+		return report
+	}
+	report.Valid = true
+	report.Head = snap.lastHash
+
+	prev := ""
+	for i := 0; i < snap.count; i++ {
+		item := *snap.at(snap.newest(snap.count - 1 - i))
+		reason := ""
+		switch {
+		case i == 0:
+			report.Anchor = item.PrevHash
+		case item.PrevHash != prev:
+			reason = "prev_hash does not match the preceding record"
+		}
+		if reason == "" && recordHash(item) != item.Hash {
+			reason = "record contents do not match its hash"
+		}
+		if reason != "" {
+			report.Valid = false
+			report.Broken = &ChainBreak{Index: i, ReceivedAt: item.ReceivedAt, Reason: reason}
+			return report
+		}
+		prev = item.Hash
+	}
+	if prev != snap.lastHash {
+		report.Valid = false
+		report.Broken = &ChainBreak{Index: snap.count, Reason: "newest record is not the chain head"}
+	}
+	return report
+}
+
+func verifyChainHandler(buffer *RingBuffer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(buffer.VerifyChain())
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func chainedBuffer(size, n int) *RingBuffer {
+	buffer := NewRingBuffer(size)
+	buffer.ChainHashes()
+	for i := 0; i < n; i++ {
+		buffer.Push(WebhookParams{
+			EventType:  "evidence",
+			Payload:    map[string]any{"n": float64(i)},
+			ReceivedAt: time.Date(2024, 1, 1, 0, 0, i, 0, time.UTC),
+		})
+	}
+	return buffer
+}
+
+func TestChainLinksRecords(t *testing.T) {
+	buffer := chainedBuffer(10, 3)
+	items, _ := buffer.Query(context.Background(), QueryFilter{EventTypes: []string{"evidence"}})
+	// Newest first.
+	if items[2].PrevHash != "" {
+		t.Errorf("expected the first record to have no predecessor, got %q", items[2].PrevHash)
+	}
+	if items[1].PrevHash != items[2].Hash || items[0].PrevHash != items[1].Hash {
+		t.Error("expected each record to link to the hash of the one before it")
+	}
+
+	report := buffer.VerifyChain()
+	if !report.Valid || report.Records != 3 || report.Head != items[0].Hash {
+		t.Errorf("unexpected report %+v", report)
+	}
+}
+
+func TestChainDetectsTampering(t *testing.T) {
+	buffer := chainedBuffer(10, 3)
+	buffer.at(1).Payload["n"] = float64(42)
+
+	report := buffer.VerifyChain()
+	if report.Valid || report.Broken == nil || report.Broken.Index != 1 {
+		t.Fatalf("expected the tampered record to be reported, got %+v", report)
+	}
+}
+
+func TestChainSealsRawCapture(t *testing.T) {
+	tampers := map[string]func(item *WebhookParams){
+		"raw":          func(item *WebhookParams) { item.Raw[0] = '[' },
+		"header":       func(item *WebhookParams) { item.Headers.Set("X-Signature", "forged") },
+		"content type": func(item *WebhookParams) { item.ContentType = "text/plain" },
+		"client":       func(item *WebhookParams) { item.Client.IP = "10.0.0.2" },
+	}
+	for name, tamper := range tampers {
+		buffer := NewRingBuffer(10)
+		buffer.ChainHashes()
+		buffer.Push(WebhookParams{
+			EventType:   "evidence",
+			Raw:         []byte(`{"n":1}`),
+			ContentType: "application/json",
+			Headers:     http.Header{"X-Signature": {"sig"}},
+			Client:      &ClientInfo{IP: "10.0.0.1"},
+		})
+		if report := buffer.VerifyChain(); !report.Valid {
+			t.Fatalf("%s: expected an untouched chain to verify, got %+v", name, report)
+		}
+		tamper(buffer.at(0))
+		if report := buffer.VerifyChain(); report.Valid {
+			t.Errorf("%s: expected tampering to break the chain", name)
+		}
+	}
+}
+
+func TestChainSurvivesEvictionAndRedelivery(t *testing.T) {
+	buffer := chainedBuffer(3, 5)
+	report := buffer.VerifyChain()
+	if !report.Valid || report.Anchor == "" {
+		t.Errorf("expected a valid chain anchored at an evicted record, got %+v", report)
+	}
+
+	buffer.Push(WebhookParams{EventType: "evidence", IdempotencyKey: "k"})
+	buffer.Push(WebhookParams{EventType: "evidence", IdempotencyKey: "k"})
+	if report := buffer.VerifyChain(); !report.Valid {
+		t.Errorf("expected re-deliveries not to break the chain, got %+v", report)
+	}
+}
+
+func TestVerifyEndpoint(t *testing.T) {
+	rec := httptest.NewRecorder()
+	verifyChainHandler(chainedBuffer(10, 2))(rec, httptest.NewRequest(http.MethodGet, "/verify", nil))
+
+	var report ChainReport
+	if err := json.NewDecoder(rec.Body).Decode(&report); err != nil {
+		t.Fatal(err)
+	}
+	if !report.Enabled || !report.Valid || report.Records != 2 {
+		t.Errorf("unexpected report %+v", report)
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// maxDecompressedSize caps gzip bodies when no -max-body-size is set.
+const maxDecompressedSize = 64 << 20
+
+// windows1252 maps bytes 0x80-0x9F, where Windows-1252 differs from
+// ISO-8859-1; zero entries are undefined and decode as U+FFFD.
+var windows1252 = [32]rune{
+	0x20AC, 0, 0x201A, 0x0192, 0x201E, 0x2026, 0x2020, 0x2021,
+	0x02C6, 0x2030, 0x0160, 0x2039, 0x0152, 0, 0x017D, 0,
+	0, 0x2018, 0x2019, 0x201C, 0x201D, 0x2022, 0x2013, 0x2014,
+	0x02DC, 0x2122, 0x0161, 0x203A, 0x0153, 0, 0x017E, 0x0178,
+}
+
+func decodeSingleByte(b []byte, cp1252 bool) []byte {
+	var buf bytes.Buffer
+	buf.Grow(len(b))
+	for _, c := range b {
+		switch {
+		case c < 0x80:
+			buf.WriteByte(c)
+		case c < 0xA0 && cp1252:
+			r := windows1252[c-0x80]
+			if r == 0 {
+				r = utf8.RuneError
+			}
+			buf.WriteRune(r)
+		default:
+			buf.WriteRune(rune(c))
+		}
+	}
+	return buf.Bytes()
+}
+
+func decodeUTF16(b []byte, order binary.ByteOrder) []byte {
+	units := make([]uint16, len(b)/2)
+	for i := range units {
+		units[i] = order.Uint16(b[2*i:])
+	}
+	return []byte(string(utf16.Decode(units)))
+}
+
+func gunzip(b []byte) ([]byte, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	limit := int64(maxDecompressedSize)
+	if maxBodySize > 0 {
+		limit = maxBodySize
+	}
+	out, err := io.ReadAll(io.LimitReader(zr, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(out)) > limit {
+		return nil, fmt.Errorf("decompressed body exceeds %d bytes", limit)
+	}
+	return out, nil
+}
+
+// sniffedType reports the content type detected from body's magic bytes when
+// it contradicts the declared one. Text detections are ignored as JSON has
+// no magic bytes of its own.
+func sniffedType(body []byte, declared string) string {
+	detected := http.DetectContentType(body)
+	if strings.HasPrefix(detected, "text/plain") || detected == "application/octet-stream" {
+		return ""
+	}
+	declaredType, _, _ := mime.ParseMediaType(declared)
+	detectedType, _, _ := mime.ParseMediaType(detected)
+	if declaredType == detectedType {
+		return ""
+	}
+	return detectedType
+}
+
+// gunzipBody is normalizeBody for binary formats, which have no charset to
+// convert: it only undoes gzip.
+func gunzipBody(body []byte, _ string) ([]byte, string, error) {
+	if len(body) > 2 && body[0] == 0x1f && body[1] == 0x8b {
+		body, err := gunzip(body)
+		if err != nil {
+			return nil, "", fmt.Errorf("gzip: %w", err)
+		}
+		return body, "gzip", nil
+	}
+	return body, "", nil
+}
+
+// normalizeBody converts a request body to UTF-8 before it is parsed. It
+// undoes gzip compression the sender did not declare, honours byte order
+// marks and a declared charset, and falls back to Windows-1252 for bodies
+// that claim to be UTF-8 but are not. The returned encoding describes what
+// was undone and is empty for plain UTF-8.
+func normalizeBody(body []byte, contentType string) (normalized []byte, encoding string, err error) {
+	var steps []string
+	if len(body) > 2 && body[0] == 0x1f && body[1] == 0x8b {
+		if body, err = gunzip(body); err != nil {
+			return nil, "", fmt.Errorf("gzip: %w", err)
+		}
+		steps = append(steps, "gzip")
+	}
+
+	charset := ""
+	if _, params, err := mime.ParseMediaType(contentType); err == nil {
+		charset = strings.ToLower(params["charset"])
+	}
+
+	var utf string
+	switch {
+	case bytes.HasPrefix(body, []byte{0xEF, 0xBB, 0xBF}):
+		body, utf = body[3:], "utf-8-bom"
+	case bytes.HasPrefix(body, []byte{0xFF, 0xFE}):
+		body, utf = decodeUTF16(body[2:], binary.LittleEndian), "utf-16le"
+	case bytes.HasPrefix(body, []byte{0xFE, 0xFF}):
+		body, utf = decodeUTF16(body[2:], binary.BigEndian), "utf-16be"
+	case charset == "utf-16le" || (charset == "utf-16" || charset == "") && len(body) >= 2 && body[0] != 0 && body[1] == 0:
+		body, utf = decodeUTF16(body, binary.LittleEndian), "utf-16le"
+	case charset == "utf-16be" || (charset == "utf-16" || charset == "") && len(body) >= 2 && body[0] == 0 && body[1] != 0:
+		body, utf = decodeUTF16(body, binary.BigEndian), "utf-16be"
+	case utf8.Valid(body):
+		// Valid UTF-8 wins over a declared single-byte charset: a mislabel
+		// is far more likely than Latin-1 text that happens to be valid.
+	case charset == "iso-8859-1" || charset == "latin1" || charset == "latin-1":
+		body, utf = decodeSingleByte(body, false), "iso-8859-1"
+	case charset == "" || charset == "utf-8" || charset == "windows-1252" || charset == "cp1252" || charset == "us-ascii":
+		body, utf = decodeSingleByte(body, true), "windows-1252"
+	default:
+		return nil, "", fmt.Errorf("unsupported charset %q", charset)
+	}
+	if utf != "" {
+		steps = append(steps, utf)
+	}
+	return body, strings.Join(steps, "+"), nil
+}
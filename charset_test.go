@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"unicode/utf16"
+)
+
+func utf16Bytes(s string, order binary.AppendByteOrder, bom bool) []byte {
+	var b []byte
+	if bom {
+		b = order.AppendUint16(b, 0xFEFF)
+	}
+	for _, u := range utf16.Encode([]rune(s)) {
+		b = order.AppendUint16(b, u)
+	}
+	return b
+}
+
+func TestNormalizeBody(t *testing.T) {
+	const text = `{"name":"Zoë €"}`
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	zw.Write(utf16Bytes(text, binary.LittleEndian, true))
+	zw.Close()
+
+	tests := []struct {
+		name        string
+		body        []byte
+		contentType string
+		encoding    string
+	}{
+		{"utf-8", []byte(text), "application/json", ""},
+		{"utf-8 bom", append([]byte{0xEF, 0xBB, 0xBF}, text...), "application/json", "utf-8-bom"},
+		{"utf-16le bom", utf16Bytes(text, binary.LittleEndian, true), "application/json", "utf-16le"},
+		{"utf-16be bom", utf16Bytes(text, binary.BigEndian, true), "", "utf-16be"},
+		{"utf-16le without bom", utf16Bytes(text, binary.LittleEndian, false), "application/json", "utf-16le"},
+		{"windows-1252 mislabelled as utf-8", []byte("{\"name\":\"Zo\xeb \x80\"}"), "application/json; charset=utf-8", "windows-1252"},
+		{"valid utf-8 mislabelled as latin-1", []byte(text), "application/json; charset=iso-8859-1", ""},
+		{"undeclared gzip", gz.Bytes(), "application/json", "gzip+utf-16le"},
+	}
+	for _, tt := range tests {
+		got, encoding, err := normalizeBody(tt.body, tt.contentType)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if string(got) != text || encoding != tt.encoding {
+			t.Errorf("%s: got %q (%q), want %q (%q)", tt.name, got, encoding, text, tt.encoding)
+		}
+	}
+
+	latin1, encoding, _ := normalizeBody([]byte("{\"a\":\"\x80\xe9\"}"), "application/json; charset=ISO-8859-1")
+	if string(latin1) != "{\"a\":\"\u0080é\"}" || encoding != "iso-8859-1" {
+		t.Errorf("expected strict ISO-8859-1 decoding, got %q (%q)", latin1, encoding)
+	}
+	if _, _, err := normalizeBody([]byte{'{', 0xff, '}'}, "application/json; charset=koi8-r"); err == nil {
+		t.Error("expected an unsupported charset to be rejected")
+	}
+}
+
+func TestIngestRecordsOriginalEncoding(t *testing.T) {
+	mux := newTestServer()
+	raw := utf16Bytes(`{"event":"legacy","data":{"name":"Zoë"}}`, binary.LittleEndian, true)
+
+	req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(raw))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if !bytes.Equal(rec.Body.Bytes(), raw) {
+		t.Error("expected the verbatim echo to return the body as received")
+	}
+
+	records := queryWebhooks(t, mux, "/query/legacy")
+	if len(records) != 1 || records[0].Payload["name"] != "Zoë" || records[0].Encoding != "utf-16le" {
+		t.Errorf("unexpected record %+v", records)
+	}
+}
+
+func TestSniffedType(t *testing.T) {
+	png := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+	if got := sniffedType(png, "application/json"); got != "image/png" {
+		t.Errorf("expected image/png, got %q", got)
+	}
+	if got := sniffedType([]byte(`{"a":1}`), "application/json"); got != "" {
+		t.Errorf("expected no sniffed type for JSON, got %q", got)
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// circuitThreshold is how many deliveries to a target fail in a row
+	// before its circuit opens.
+	circuitThreshold = 5
+	// circuitCooldown is how long an open circuit waits before letting a
+	// single probe through.
+	circuitCooldown = 30 * time.Second
+)
+
+// Circuit states.
+const (
+	circuitClosed   = "closed"
+	circuitOpen     = "open"
+	circuitHalfOpen = "half_open"
+)
+
+// circuitOpenError refuses a delivery to a target whose circuit is open.
+type circuitOpenError struct {
+	target  string
+	retryIn time.Duration
+}
+
+func (e *circuitOpenError) Error() string {
+	return fmt.Sprintf("circuit open for %s, next probe in %s", e.target, e.retryIn.Round(time.Millisecond))
+}
+
+// Circuit is the state of the circuit to one push target.
+type Circuit struct {
+	Target    string    `json:"target"`
+	State     string    `json:"state"`
+	Failures  int       `json:"failures,omitempty"`
+	LastError string    `json:"last_error,omitempty"`
+	OpenedAt  time.Time `json:"opened_at,omitzero"`
+	Opened    int       `json:"opened,omitempty"`
+}
+
+// CircuitBreakers keeps a circuit per push target URL, shared by every
+// subscription pushing to it. After Threshold failures in a row the circuit
+// opens and deliveries are held back for Cooldown; then a single probe goes
+// through, which closes the circuit if it succeeds and opens it again if
+// not.
+type CircuitBreakers struct {
+	Threshold int
+	Cooldown  time.Duration
+
+	mu       sync.Mutex
+	circuits map[string]*Circuit
+	now      func() time.Time
+}
+
+func NewCircuitBreakers() *CircuitBreakers {
+	return &CircuitBreakers{
+		Threshold: circuitThreshold,
+		Cooldown:  circuitCooldown,
+		circuits:  make(map[string]*Circuit),
+		now:       time.Now,
+	}
+}
+
+// Allow reports whether a delivery to target may go out, returning a
+// *circuitOpenError if not.
+func (b *CircuitBreakers) Allow(target string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	c, ok := b.circuits[target]
+	if !ok {
+		return nil
+	}
+	switch c.State {
+	case circuitOpen:
+		if wait := c.OpenedAt.Add(b.Cooldown).Sub(b.now()); wait > 0 {
+			return &circuitOpenError{target, wait}
+		}
+		c.State = circuitHalfOpen
+		return nil
+	case circuitHalfOpen:
+		// The probe is still out.
+		return &circuitOpenError{target, b.Cooldown}
+	}
+	return nil
+}
+
+// Done records the outcome of a delivery to target that Allow let through.
+func (b *CircuitBreakers) Done(target string, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	c, ok := b.circuits[target]
+	if err == nil {
+		if ok {
+			c.State, c.Failures, c.LastError = circuitClosed, 0, ""
+		}
+		return
+	}
+	if !ok {
+		c = &Circuit{Target: target, State: circuitClosed}
+		b.circuits[target] = c
+	}
+	c.Failures++
+	c.LastError = err.Error()
+	if c.State == circuitHalfOpen || c.Failures >= b.Threshold {
+		if c.State != circuitOpen {
+			c.Opened++
+		}
+		c.State, c.OpenedAt = circuitOpen, b.now().UTC()
+	}
+}
+
+// Abort gives up on a delivery Allow let through without an outcome, such
+// as one cancelled with its subscription. A probe is let out again.
+func (b *CircuitBreakers) Abort(target string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if c, ok := b.circuits[target]; ok && c.State == circuitHalfOpen {
+		c.State = circuitOpen
+	}
+}
+
+// Forget drops the circuit to target once no subscription pushes to it.
+func (b *CircuitBreakers) Forget(target string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.circuits, target)
+}
+
+// Circuits returns the circuit of every target that has failed, by target.
+func (b *CircuitBreakers) Circuits() []Circuit {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	circuits := make([]Circuit, 0, len(b.circuits))
+	for _, c := range b.circuits {
+		circuits = append(circuits, *c)
+	}
+	sort.Slice(circuits, func(i, j int) bool { return circuits[i].Target < circuits[j].Target })
+	return circuits
+}
+
+func circuitsHandler(b *CircuitBreakers) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(b.Circuits())
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	b := NewCircuitBreakers()
+	b.Threshold, b.Cooldown = 2, time.Minute
+	b.now = func() time.Time { return now }
+	failed := errors.New("503")
+
+	b.Done("t", failed)
+	if err := b.Allow("t"); err != nil {
+		t.Fatalf("expected the circuit closed below the threshold, got %v", err)
+	}
+	b.Done("t", failed)
+	var open *circuitOpenError
+	if err := b.Allow("t"); !errors.As(err, &open) || open.retryIn != time.Minute {
+		t.Fatalf("expected the circuit open for a minute, got %v", err)
+	}
+
+	now = now.Add(time.Minute)
+	if err := b.Allow("t"); err != nil {
+		t.Fatalf("expected a probe after the cooldown, got %v", err)
+	}
+	if err := b.Allow("t"); err == nil {
+		t.Fatal("expected a single probe at a time")
+	}
+	b.Done("t", failed)
+	if c := b.Circuits()[0]; c.State != circuitOpen || c.Opened != 2 {
+		t.Fatalf("expected a failed probe to open the circuit again, got %+v", c)
+	}
+
+	now = now.Add(time.Minute)
+	b.Allow("t")
+	b.Done("t", nil)
+	if c := b.Circuits()[0]; c.State != circuitClosed || c.Failures != 0 {
+		t.Errorf("expected a successful probe to close the circuit, got %+v", c)
+	}
+}
+
+func TestPushSubscriptionCircuitOpens(t *testing.T) {
+	var requests atomic.Int32
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer target.Close()
+
+	mux, _, subs := newSubscriptionServer(10)
+	subs.breakers.Threshold, subs.breakers.Cooldown = 2, time.Hour
+	sub := createSubscription(t, mux, `{"url":"`+target.URL+`"}`)
+	defer subs.Delete(sub.ID)
+	postWebhook(t, mux, `{"event":"a"}`)
+
+	waitFor(t, func() bool {
+		return len(subs.breakers.Circuits()) == 1 && subs.breakers.Circuits()[0].State == circuitOpen
+	})
+	time.Sleep(20 * time.Millisecond)
+	if n := requests.Load(); n != 2 {
+		t.Errorf("expected no deliveries while the circuit is open, got %d", n)
+	}
+	if s, _ := subs.Get(sub.ID); s.Failures != 2 || s.DeadLettered != 0 {
+		t.Errorf("expected held back deliveries not to count as attempts, got %+v", s)
+	}
+
+	var circuits []Circuit
+	json.NewDecoder(subscriptionRequest(t, mux, http.MethodGet, "/stats/circuits", "").Body).Decode(&circuits)
+	if len(circuits) != 1 || circuits[0].Target != target.URL || circuits[0].State != circuitOpen {
+		t.Errorf("unexpected circuits %+v", circuits)
+	}
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// trustedProxies lists the peers whose forwarding headers are believed.
+// Headers from anyone else are ignored, since any sender can set them.
+var trustedProxies []netip.Prefix
+
+// parseTrustedProxies parses a comma-separated list of IPs and CIDRs.
+func parseTrustedProxies(s string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, item := range splitList(s) {
+		if addr, err := netip.ParseAddr(item); err == nil {
+			prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(item)
+		if err != nil {
+			return nil, fmt.Errorf("%q is neither an IP nor a CIDR", item)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+func isTrustedProxy(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, prefix := range trustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientInfo describes the original sender of a request, as seen through
+// trusted proxies and tunnels. Peer is the directly connected address when
+// it differs from IP; Via names the tunnel or CDN in between, if known.
+type ClientInfo struct {
+	IP      string `json:"ip"`
+	Proto   string `json:"proto"`
+	Host    string `json:"host"`
+	Via     string `json:"via,omitempty"`
+	Country string `json:"country,omitempty"`
+	Peer    string `json:"peer,omitempty"`
+}
+
+// clientInfo works out who sent r. Forwarding headers (Cloudflare's
+// CF-Connecting-IP, RFC 7239 Forwarded, X-Forwarded-*) are only used when
+// the peer is a trusted proxy, and the client is the last address in the
+// forwarding chain that is not itself a trusted proxy.
+func clientInfo(r *http.Request) *ClientInfo {
+	info := &ClientInfo{IP: r.RemoteAddr, Proto: "http", Host: r.Host}
+	if r.TLS != nil {
+		info.Proto = "https"
+	}
+	peer, err := netip.ParseAddrPort(r.RemoteAddr)
+	if err != nil || !isTrustedProxy(peer.Addr()) {
+		if err == nil {
+			info.IP = peer.Addr().Unmap().String()
+		}
+		return info
+	}
+	info.IP = peer.Addr().Unmap().String()
+	peerIP := info.IP
+
+	var chain []string
+	proto, host := "", ""
+	if fwd := r.Header.Values("Forwarded"); len(fwd) > 0 {
+		chain, proto, host = parseForwarded(fwd)
+	} else {
+		for _, v := range r.Header.Values("X-Forwarded-For") {
+			for _, hop := range strings.Split(v, ",") {
+				chain = append(chain, strings.TrimSpace(hop))
+			}
+		}
+		proto = firstValue(r.Header.Get("X-Forwarded-Proto"))
+		host = firstValue(r.Header.Get("X-Forwarded-Host"))
+	}
+	if client := forwardedClient(chain); client != "" {
+		info.IP, info.Via = client, "proxy"
+	}
+	if cf := r.Header.Get("CF-Connecting-IP"); cf != "" {
+		if addr, err := netip.ParseAddr(cf); err == nil {
+			info.IP, info.Via = addr.Unmap().String(), "cloudflare"
+			info.Country = r.Header.Get("CF-IPCountry")
+		}
+	}
+	if proto == "http" || proto == "https" {
+		info.Proto = proto
+	}
+	if host != "" {
+		info.Host = host
+	}
+	if r.Header.Get("Ngrok-Trace-Id") != "" || strings.Contains(info.Host, ".ngrok") {
+		info.Via = "ngrok"
+	}
+	if info.IP != peerIP {
+		info.Peer = peerIP
+	}
+	return info
+}
+
+// forwardedClient picks the client from a forwarding chain, client first:
+// the rightmost address that is not a trusted proxy, or the leftmost if all
+// are trusted.
+func forwardedClient(chain []string) string {
+	var leftmost string
+	for i := len(chain) - 1; i >= 0; i-- {
+		addr, ok := parseHop(chain[i])
+		if !ok {
+			// An unparseable hop means the chain cannot be followed further.
+			break
+		}
+		leftmost = addr.String()
+		if !isTrustedProxy(addr) {
+			return leftmost
+		}
+	}
+	return leftmost
+}
+
+// parseHop parses a forwarded address: an IP, optionally with a port, and
+// possibly quoted and bracketed as in Forwarded: for="[2001:db8::1]:4711".
+func parseHop(hop string) (netip.Addr, bool) {
+	hop = strings.Trim(strings.TrimSpace(hop), `"`)
+	if addrPort, err := netip.ParseAddrPort(hop); err == nil {
+		return addrPort.Addr().Unmap(), true
+	}
+	addr, err := netip.ParseAddr(strings.Trim(hop, "[]"))
+	return addr.Unmap(), err == nil
+}
+
+// parseForwarded reads the for, proto and host parameters of RFC 7239
+// Forwarded headers. proto and host come from the first element, the one
+// added by the proxy closest to the client.
+func parseForwarded(values []string) (chain []string, proto, host string) {
+	first := true
+	for _, v := range values {
+		for _, element := range strings.Split(v, ",") {
+			for _, pair := range strings.Split(element, ";") {
+				key, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+				if !ok {
+					continue
+				}
+				value = strings.Trim(value, `"`)
+				switch strings.ToLower(key) {
+				case "for":
+					chain = append(chain, value)
+				case "proto":
+					if first {
+						proto = strings.ToLower(value)
+					}
+				case "host":
+					if first {
+						host = value
+					}
+				}
+			}
+			first = false
+		}
+	}
+	return chain, proto, host
+}
+
+func firstValue(v string) string {
+	first, _, _ := strings.Cut(v, ",")
+	return strings.TrimSpace(first)
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+)
+
+func setTrustedProxies(t *testing.T, s string) {
+	t.Helper()
+	proxies, err := parseTrustedProxies(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	trustedProxies = proxies
+	t.Cleanup(func() { trustedProxies = nil })
+}
+
+func TestParseTrustedProxies(t *testing.T) {
+	proxies, err := parseTrustedProxies("127.0.0.1, 10.0.0.0/8,::1")
+	if err != nil || len(proxies) != 3 {
+		t.Fatalf("got %v, %v", proxies, err)
+	}
+	if !proxies[1].Contains(netip.MustParseAddr("10.1.2.3")) || !proxies[2].Contains(netip.MustParseAddr("::1")) {
+		t.Errorf("unexpected prefixes %v", proxies)
+	}
+	if _, err := parseTrustedProxies("10.0.0.0/33"); err == nil {
+		t.Error("expected an error for an invalid CIDR")
+	}
+}
+
+func TestClientInfo(t *testing.T) {
+	setTrustedProxies(t, "10.0.0.0/8")
+
+	tests := []struct {
+		name   string
+		peer   string
+		header http.Header
+		want   ClientInfo
+	}{
+		{"untrusted peer", "203.0.113.9:4000",
+			http.Header{"X-Forwarded-For": {"198.51.100.1"}, "X-Forwarded-Host": {"forged.example.com"}},
+			ClientInfo{IP: "203.0.113.9", Proto: "http", Host: "echo.local"}},
+		{"x-forwarded", "10.0.0.2:4000",
+			http.Header{"X-Forwarded-For": {"198.51.100.1, 10.0.0.5"}, "X-Forwarded-Proto": {"https"}, "X-Forwarded-Host": {"hooks.example.com"}},
+			ClientInfo{IP: "198.51.100.1", Proto: "https", Host: "hooks.example.com", Via: "proxy", Peer: "10.0.0.2"}},
+		// Addresses left of the first untrusted hop may be forged.
+		{"spoofed chain", "10.0.0.2:4000",
+			http.Header{"X-Forwarded-For": {"192.0.2.66, 198.51.100.1"}},
+			ClientInfo{IP: "198.51.100.1", Proto: "http", Host: "echo.local", Via: "proxy", Peer: "10.0.0.2"}},
+		{"forwarded", "10.0.0.2:4000",
+			http.Header{"Forwarded": {`for="[2001:db8::1]:4711";proto=https;host=hooks.example.com, for=10.0.0.7`}},
+			ClientInfo{IP: "2001:db8::1", Proto: "https", Host: "hooks.example.com", Via: "proxy", Peer: "10.0.0.2"}},
+		{"cloudflare", "10.0.0.2:4000",
+			http.Header{"Cf-Connecting-Ip": {"198.51.100.7"}, "Cf-Ipcountry": {"BG"}, "X-Forwarded-For": {"198.51.100.7"}, "X-Forwarded-Proto": {"https"}},
+			ClientInfo{IP: "198.51.100.7", Proto: "https", Host: "echo.local", Via: "cloudflare", Country: "BG", Peer: "10.0.0.2"}},
+		{"ngrok", "10.0.0.2:4000",
+			http.Header{"X-Forwarded-For": {"198.51.100.8"}, "X-Forwarded-Proto": {"https"}, "X-Forwarded-Host": {"abcd.ngrok-free.app"}},
+			ClientInfo{IP: "198.51.100.8", Proto: "https", Host: "abcd.ngrok-free.app", Via: "ngrok", Peer: "10.0.0.2"}},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodPost, "http://echo.local/", nil)
+		req.RemoteAddr = tt.peer
+		req.Header = tt.header
+		if got := clientInfo(req); *got != tt.want {
+			t.Errorf("%s: got %+v, want %+v", tt.name, *got, tt.want)
+		}
+	}
+}
+
+func TestClientOnRecords(t *testing.T) {
+	setTrustedProxies(t, "192.0.2.1")
+
+	mux := newTestServer()
+	req := httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString(`{"event":"order","client":{"ip":"forged"}}`))
+	req.Header.Set("X-Forwarded-For", "198.51.100.1")
+	mux.ServeHTTP(httptest.NewRecorder(), req)
+
+	got := queryWebhooks(t, mux, "/query/order")
+	if len(got) != 1 || got[0].Client == nil || got[0].Client.IP != "198.51.100.1" || got[0].Client.Peer != "192.0.2.1" {
+		t.Fatalf("expected the client from the trusted proxy's header, got %+v", got)
+	}
+}
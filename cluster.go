@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const codePeerUnavailable = "peer_unavailable"
+
+// Query consistency levels: local reads only this replica's records, all
+// fans the query out to every peer for a complete view.
+const (
+	consistencyLocal = "local"
+	consistencyAll   = "all"
+)
+
+// peers are the base URLs of the other replicas, from -peers, which queries
+// with consistency=all are fanned out to.
+var peers []string
+
+// replicaCount is the number of replicas deployed, from -replicas.
+var replicaCount = 1
+
+// parseConsistency takes the consistency parameter out of params.
+func parseConsistency(params url.Values) (string, error) {
+	consistency := params.Get("consistency")
+	delete(params, "consistency")
+	switch consistency {
+	case "", consistencyLocal:
+		return consistencyLocal, nil
+	case consistencyAll:
+		if replicaCount > 1 && len(peers) == 0 {
+			return "", &paramError{codeInvalidParameter, "consistency=all needs -peers listing the other replicas"}
+		}
+		return consistencyAll, nil
+	}
+	return "", &paramError{codeInvalidParameter, "consistency must be local or all"}
+}
+
+// queryPeers runs the query r asks for on every peer with local
+// consistency, merging their results into res. A peer that cannot answer
+// fails the whole query, since a partial view is what the caller asked to
+// avoid.
+func queryPeers(ctx context.Context, client *http.Client, r *http.Request, res QueryResult) (QueryResult, error) {
+	params := r.URL.Query()
+	params.Set("consistency", consistencyLocal)
+	path := "/v" + apiVersion + "/query"
+	if eventType := r.PathValue("event_type"); eventType != "" {
+		path += "/" + url.PathEscape(eventType)
+	}
+
+	results := make([]QueryResult, len(peers))
+	errs := make([]error, len(peers))
+	var wg sync.WaitGroup
+	for i, peer := range peers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i], errs[i] = queryPeer(ctx, client, strings.TrimSuffix(peer, "/")+path+"?"+params.Encode())
+		}()
+	}
+	wg.Wait()
+
+	for i, peerRes := range results {
+		if errs[i] != nil {
+			return res, errs[i]
+		}
+		res.Items = append(res.Items, peerRes.Items...)
+		res.EvictedSince += peerRes.EvictedSince
+		res.Truncated = res.Truncated || peerRes.Truncated
+		if o := peerRes.OldestRetainedAt; o != nil && (res.OldestRetainedAt == nil || o.Before(*res.OldestRetainedAt)) {
+			res.OldestRetainedAt = o
+		}
+	}
+	sort.SliceStable(res.Items, func(i, j int) bool {
+		return res.Items[i].ReceivedAt.After(res.Items[j].ReceivedAt)
+	})
+	res.Total = len(res.Items)
+	return res, nil
+}
+
+func queryPeer(ctx context.Context, client *http.Client, target string) (QueryResult, error) {
+	var res QueryResult
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return res, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return res, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return res, fmt.Errorf("GET %s: %s", req.URL.Redacted(), resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return res, fmt.Errorf("GET %s: %w", req.URL.Redacted(), err)
+	}
+	return res, nil
+}
+
+// writeClusterResults answers a query with consistency=all as
+// writeQueryResults does, from the records of this replica and every peer.
+func writeClusterResults(w http.ResponseWriter, r *http.Request, buffer *RingBuffer, filter QueryFilter) {
+	ctx, cancel := scanContext(r)
+	defer cancel()
+	res, err := queryPeers(ctx, http.DefaultClient, r, buffer.QueryResult(ctx, filter))
+	if err != nil {
+		writeProblem(w, r, http.StatusBadGateway, codePeerUnavailable, err.Error())
+		return
+	}
+	w.Header().Set("X-Echo-Consistency", consistencyAll)
+	previewItems(res.Items)
+	flattenItems(res.Items, filter)
+	if strings.Contains(r.Header.Get("Accept"), ndjsonContentType) {
+		w.Header().Set("Content-Type", ndjsonContentType)
+		w.Header().Set("X-Echo-Truncated", strconv.FormatBool(res.Truncated))
+		enc := json.NewEncoder(w)
+		for _, item := range res.Items {
+			enc.Encode(item)
+		}
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if !isVersioned(r) {
+		if res.Truncated {
+			w.Header().Set("X-Echo-Truncated", "true")
+		}
+		json.NewEncoder(w).Encode(res.Items)
+		return
+	}
+	json.NewEncoder(w).Encode(res)
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func withPeers(t *testing.T, urls ...string) {
+	t.Helper()
+	peers = urls
+	t.Cleanup(func() { peers, replicaCount = nil, 1 })
+}
+
+func TestQueryConsistencyAll(t *testing.T) {
+	peerMux := newTestServer()
+	peer := httptest.NewServer(peerMux)
+	defer peer.Close()
+	withPeers(t, peer.URL)
+
+	mux := newTestServer()
+	postWebhook(t, peerMux, `{"event":"spread","data":{"n":1}}`)
+	postWebhook(t, mux, `{"event":"spread","data":{"n":2}}`)
+
+	if items := queryWebhooks(t, mux, "/query/spread"); len(items) != 1 {
+		t.Errorf("expected a local read to see 1 record, got %d", len(items))
+	}
+	items := queryWebhooks(t, mux, "/query/spread?consistency=all")
+	if len(items) != 2 || items[0].Payload["n"] != float64(2) {
+		t.Fatalf("expected both records newest first, got %+v", items)
+	}
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/query?status_code=200&consistency=all", nil))
+	var res QueryResult
+	if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+	if res.Total != 2 || rec.Header().Get("X-Echo-Consistency") != consistencyAll {
+		t.Errorf("unexpected result %d %+v", rec.Code, res)
+	}
+}
+
+func TestQueryConsistencyErrors(t *testing.T) {
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+	withPeers(t, down.URL)
+	mux := newTestServer()
+
+	for path, want := range map[string]int{
+		"/query/x?consistency=all":    http.StatusBadGateway,
+		"/query/x?consistency=strong": http.StatusBadRequest,
+	} {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != want {
+			t.Errorf("%s: expected %d, got %d", path, want, rec.Code)
+		}
+	}
+
+	peers, replicaCount = nil, 3
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/query/x?consistency=all", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected consistency=all without peers refused, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"flag"
+	"io"
+)
+
+// subcommand is a tool run as "webhook-echo <name> [flags] [args]" instead
+// of the server. It declares its flags on fs and returns the function that
+// runs it with the arguments left once they are parsed.
+type subcommand func(fs *flag.FlagSet) func(args []string, stdin io.Reader, stdout io.Writer) error
+
+var subcommands map[string]subcommand
+
+// serverSubcommands are the subcommands that talk to a webhook-echo server,
+// and so take -remote.
+var serverSubcommands = map[string]bool{
+	"i18n":   true,
+	"query":  true,
+	"replay": true,
+	"tail":   true,
+}
+
+// Assigned in init, as the completion command lists the subcommands.
+func init() {
+	subcommands = map[string]subcommand{
+		"canonicalize": canonicalizeCommand,
+		"completion":   completionCommand,
+		"conformance":  conformanceCommand,
+		"i18n":         i18nCommand,
+		"install":      installCommand,
+		"query":        queryCommand,
+		"remote":       remoteCommand,
+		"replay":       replayCommand,
+		"self-update":  selfUpdateCommand,
+		"tail":         tailCommand,
+	}
+}
+
+// newSubcommandFlags returns the flag set of the subcommand name, with the
+// -output flag every subcommand takes and -remote on those in
+// serverSubcommands, and the function running it.
+func newSubcommandFlags(name string) (*flag.FlagSet, func(args []string, stdin io.Reader, stdout io.Writer) error) {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	outputFormat, remoteName = outputText, ""
+	fs.Func("output", "Output format: text, json, yaml or table", func(s string) error {
+		if err := validOutputFormat(s); err != nil {
+			return err
+		}
+		outputFormat = s
+		return nil
+	})
+	if serverSubcommands[name] {
+		fs.StringVar(&remoteName, "remote", "", "Work against this server saved with 'webhook-echo remote add' instead of -url")
+	}
+	return fs, subcommands[name](fs)
+}
+
+// runSubcommand parses args for the subcommand name and runs it. Flags may
+// follow the positional arguments, up to a "--".
+func runSubcommand(name string, args []string, stdin io.Reader, stdout io.Writer) error {
+	fs, run := newSubcommandFlags(name)
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return err
+		}
+		rest := fs.Args()
+		if len(rest) == 0 {
+			break
+		}
+		if n := len(args) - len(rest); n > 0 && args[n-1] == "--" {
+			positional = append(positional, rest...)
+			break
+		}
+		positional, args = append(positional, rest[0]), rest[1:]
+	}
+	return run(positional, stdin, stdout)
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// completionValues are the values completed after flags that take one of a
+// fixed set, by flag name.
+var completionValues = map[string][]string{
+	"output": {outputText, outputJSON, outputYAML, outputTable},
+	"color":  {"auto", "always", "never"},
+	"preset": signatureSchemeNames(),
+}
+
+var completionShells = []string{"bash", "zsh", "fish"}
+
+// completionCommand is "webhook-echo completion bash|zsh|fish". It prints
+// a script completing the subcommands and their flags, to be sourced from
+// the shell's startup files. With -output it lists them instead.
+func completionCommand(fs *flag.FlagSet) func(args []string, stdin io.Reader, stdout io.Writer) error {
+	return func(args []string, stdin io.Reader, stdout io.Writer) error {
+		if outputFormat != outputText {
+			return (&outputPrinter{w: stdout}).Print(describeSubcommands(), nil)
+		}
+		if len(args) != 1 || !slices.Contains(completionShells, args[0]) {
+			return errors.New("expected one shell: bash, zsh or fish")
+		}
+		var script string
+		switch commands := describeSubcommands(); args[0] {
+		case "bash":
+			script = bashCompletion(commands)
+		case "zsh":
+			script = zshCompletion(commands)
+		default:
+			script = fishCompletion(commands)
+		}
+		_, err := io.WriteString(stdout, script)
+		return err
+	}
+}
+
+// commandDescription is a subcommand and its flags, as completion and
+// "completion -output json" see them.
+type commandDescription struct {
+	Name  string            `json:"name"`
+	Flags []flagDescription `json:"flags"`
+	// Args are the values of the command's positional argument, if fixed.
+	Args []string `json:"args,omitempty"`
+}
+
+type flagDescription struct {
+	Name     string   `json:"name"`
+	Usage    string   `json:"usage"`
+	TakesArg bool     `json:"takes_value"`
+	Values   []string `json:"values,omitempty"`
+}
+
+func describeSubcommands() []commandDescription {
+	saved := outputFormat
+	defer func() { outputFormat = saved }()
+	var commands []commandDescription
+	for _, name := range slices.Sorted(maps.Keys(subcommands)) {
+		fs, _ := newSubcommandFlags(name)
+		cmd := commandDescription{Name: name}
+		switch name {
+		case "completion":
+			cmd.Args = completionShells
+		case "remote":
+			cmd.Args = []string{"add", "remove", "list"}
+		}
+		fs.VisitAll(func(f *flag.Flag) {
+			b, ok := f.Value.(interface{ IsBoolFlag() bool })
+			takesArg := !ok || !b.IsBoolFlag()
+			cmd.Flags = append(cmd.Flags, flagDescription{Name: f.Name, Usage: f.Usage, TakesArg: takesArg, Values: completionValues[f.Name]})
+		})
+		commands = append(commands, cmd)
+	}
+	return commands
+}
+
+func bashCompletion(commands []commandDescription) string {
+	var b strings.Builder
+	b.WriteString("# bash completion for webhook-echo\n_webhook_echo() {\n")
+	b.WriteString("\tlocal cur=${COMP_WORDS[COMP_CWORD]} prev=${COMP_WORDS[COMP_CWORD-1]} words=\n")
+	b.WriteString("\tif [ \"$COMP_CWORD\" -eq 1 ]; then\n")
+	fmt.Fprintf(&b, "\t\tCOMPREPLY=($(compgen -W %q -- \"$cur\"))\n\t\treturn\n\tfi\n", strings.Join(commandNames(commands), " "))
+	b.WriteString("\tcase $prev in\n")
+	for name, values := range sortedValues() {
+		fmt.Fprintf(&b, "\t-%s | --%s)\n\t\tCOMPREPLY=($(compgen -W %q -- \"$cur\"))\n\t\treturn\n\t\t;;\n", name, name, strings.Join(values, " "))
+	}
+	b.WriteString("\tesac\n\tcase ${COMP_WORDS[1]} in\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(&b, "\t%s) words=%q ;;\n", cmd.Name, strings.Join(append(flagNames(cmd), cmd.Args...), " "))
+	}
+	b.WriteString("\tesac\n\tCOMPREPLY=($(compgen -W \"$words\" -- \"$cur\"))\n}\n")
+	b.WriteString("complete -o default -F _webhook_echo webhook-echo\n")
+	return b.String()
+}
+
+func zshCompletion(commands []commandDescription) string {
+	var b strings.Builder
+	b.WriteString("#compdef webhook-echo\n_webhook_echo() {\n")
+	fmt.Fprintf(&b, "\tif (( CURRENT == 2 )); then\n\t\tcompadd -- %s\n\t\treturn\n\tfi\n", strings.Join(commandNames(commands), " "))
+	b.WriteString("\tcase ${words[CURRENT-1]} in\n")
+	for name, values := range sortedValues() {
+		fmt.Fprintf(&b, "\t-%s | --%s)\n\t\tcompadd -- %s\n\t\treturn\n\t\t;;\n", name, name, strings.Join(values, " "))
+	}
+	b.WriteString("\tesac\n\tcase ${words[2]} in\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(&b, "\t%s) compadd -- %s ;;\n", cmd.Name, strings.Join(append(flagNames(cmd), cmd.Args...), " "))
+	}
+	b.WriteString("\tesac\n}\ncompdef _webhook_echo webhook-echo\n")
+	return b.String()
+}
+
+func fishCompletion(commands []commandDescription) string {
+	var b strings.Builder
+	b.WriteString("# fish completion for webhook-echo\ncomplete -c webhook-echo -f\n")
+	fmt.Fprintf(&b, "complete -c webhook-echo -n __fish_use_subcommand -a %q\n", strings.Join(commandNames(commands), " "))
+	for _, cmd := range commands {
+		seen := fmt.Sprintf("-n '__fish_seen_subcommand_from %s'", cmd.Name)
+		for _, f := range cmd.Flags {
+			fmt.Fprintf(&b, "complete -c webhook-echo %s -o %s -d %s", seen, f.Name, fishQuote(f.Usage))
+			if len(f.Values) > 0 {
+				fmt.Fprintf(&b, " -xa %q", strings.Join(f.Values, " "))
+			} else if f.TakesArg {
+				b.WriteString(" -r")
+			}
+			b.WriteString("\n")
+		}
+		if len(cmd.Args) > 0 {
+			fmt.Fprintf(&b, "complete -c webhook-echo %s -a %q\n", seen, strings.Join(cmd.Args, " "))
+		}
+	}
+	return b.String()
+}
+
+func fishQuote(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s) + "'"
+}
+
+func commandNames(commands []commandDescription) []string {
+	names := make([]string, len(commands))
+	for i, cmd := range commands {
+		names[i] = cmd.Name
+	}
+	return names
+}
+
+func flagNames(cmd commandDescription) []string {
+	names := make([]string, len(cmd.Flags))
+	for i, f := range cmd.Flags {
+		names[i] = "-" + f.Name
+	}
+	return names
+}
+
+// sortedValues yields completionValues in flag name order, so that the
+// scripts come out the same every time.
+func sortedValues() func(yield func(string, []string) bool) {
+	return func(yield func(string, []string) bool) {
+		for _, name := range slices.Sorted(maps.Keys(completionValues)) {
+			if !yield(name, completionValues[name]) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestCompletionScripts(t *testing.T) {
+	for shell, want := range map[string][]string{
+		"bash": {"complete -o default -F _webhook_echo webhook-echo", `"canonicalize completion conformance i18n install query remote replay self-update tail"`, "-filter", `-output | --output)`},
+		"zsh":  {"#compdef webhook-echo", "tail) compadd -- -color -filter -format -n -output -remote -url ;;"},
+		"fish": {"-n '__fish_seen_subcommand_from tail' -o url -d 'Base URL of the webhook-echo server' -r", `-o color -d 'Color event types: auto, always or never' -xa "auto always never"`},
+	} {
+		var out strings.Builder
+		if err := runSubcommand("completion", []string{shell}, nil, &out); err != nil {
+			t.Fatal(err)
+		}
+		for _, s := range want {
+			if !strings.Contains(out.String(), s) {
+				t.Errorf("%s script lacks %q:\n%s", shell, s, out.String())
+			}
+		}
+	}
+	if err := runSubcommand("completion", []string{"powershell"}, nil, &strings.Builder{}); err == nil {
+		t.Error("expected an unknown shell to be rejected")
+	}
+}
+
+func TestCompletionJSON(t *testing.T) {
+	var out strings.Builder
+	if err := runSubcommand("completion", []string{"-output", "json"}, nil, &out); err != nil {
+		t.Fatal(err)
+	}
+	var commands []commandDescription
+	if err := json.Unmarshal([]byte(out.String()), &commands); err != nil {
+		t.Fatal(err)
+	}
+	for _, cmd := range commands {
+		if cmd.Name != "canonicalize" {
+			continue
+		}
+		for _, f := range cmd.Flags {
+			if f.Name == "hash" && f.TakesArg {
+				t.Error("expected -hash to be a boolean flag")
+			}
+		}
+		return
+	}
+	t.Errorf("expected canonicalize to be described, got %+v", commands)
+}
@@ -0,0 +1,312 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+// conformancePreset is what a provider's webhooks look like besides their
+// signature: a payload and extra headers, whose strings are templates as
+// in a schedule's data.
+type conformancePreset struct {
+	payload string
+	headers map[string]any
+}
+
+// conformancePresets are the providers with a payload of their own; the
+// other signature schemes send conformanceGeneric.
+var conformancePresets = map[string]conformancePreset{
+	"stripe": {payload: `{"id": "evt_{{uuid}}", "object": "event", "api_version": "2024-06-20", "created": 1704067200,
+		"type": "payment_intent.succeeded", "livemode": false, "pending_webhooks": 1,
+		"data": {"object": {"id": "pi_{{uuid}}", "object": "payment_intent", "amount": 2000, "currency": "usd", "status": "succeeded"}}}`},
+	"github": {
+		payload: `{"action": "opened", "issue": {"number": 1, "title": "conformance {{.Name}}", "state": "open"},
+			"repository": {"full_name": "octo-org/conformance"}, "sender": {"login": "webhook-echo"}}`,
+		headers: map[string]any{"X-GitHub-Event": "issues", "X-GitHub-Delivery": "{{uuid}}"},
+	},
+	"shopify": {
+		payload: `{"id": 820982911946154508, "name": "#1001", "note": "conformance {{.Name}}", "email": "conformance@example.com",
+			"currency": "USD", "total_price": "20.00", "financial_status": "paid"}`,
+		headers: map[string]any{"X-Shopify-Topic": "orders/create", "X-Shopify-Shop-Domain": "conformance.myshopify.com", "X-Shopify-Webhook-Id": "{{uuid}}"},
+	},
+	"slack": {payload: `{"token": "conformance", "team_id": "T0CONFORM", "api_app_id": "A0CONFORM", "type": "event_callback",
+		"event_id": "Ev{{.Seq}}{{randInt 100000 999999}}", "event_time": 1704067200,
+		"event": {"type": "app_mention", "user": "U0CONFORM", "text": "conformance {{.Name}}", "channel": "C0CONFORM"}}`},
+}
+
+const conformanceGeneric = `{"event": "conformance.test", "data": {"id": "{{uuid}}", "case": "{{.Name}}"}}`
+
+// conformanceCommand is "webhook-echo conformance -target URL -preset
+// SCHEME -secret SECRET". It sends the consumer at URL a battery of
+// webhooks signed as the provider would, and forged, malformed and replayed
+// ones it must reject, and reports which it answered as it should: 2xx for
+// genuine deliveries, 4xx for the rest.
+func conformanceCommand(fs *flag.FlagSet) func(args []string, stdin io.Reader, stdout io.Writer) error {
+	var opts conformanceOptions
+	fs.StringVar(&opts.target, "target", "", "URL of the webhook consumer to test")
+	fs.StringVar(&opts.preset, "preset", "hmac-sha256", "Provider whose webhooks to send, one of the signature schemes")
+	fs.StringVar(&opts.secret, "secret", "", "Secret the consumer verifies signatures with")
+	fs.StringVar(&opts.payload, "payload", "", "JSON file with the payload to send instead of the preset's, its strings templates")
+	fs.DurationVar(&opts.stale, "stale", time.Hour, "Age of the timestamps the consumer must reject as stale")
+	return func(args []string, stdin io.Reader, stdout io.Writer) error {
+		if len(args) > 0 {
+			return errors.New("conformance takes no arguments")
+		}
+		if opts.target == "" {
+			return errors.New("-target is required")
+		}
+		if opts.secret == "" {
+			return errors.New("-secret is required")
+		}
+		return conformanceCheck(opts, stdout)
+	}
+}
+
+type conformanceOptions struct {
+	target, preset, secret, payload string
+	stale                           time.Duration
+}
+
+// conformanceResult is how the consumer answered one delivery.
+type conformanceResult struct {
+	Case   string `json:"case"`
+	Expect string `json:"expect"`
+	Status int    `json:"status,omitempty"`
+	OK     bool   `json:"ok"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// conformanceDelivery is one webhook of the battery.
+type conformanceDelivery struct {
+	name   string
+	accept bool
+	body   []byte
+	header http.Header
+}
+
+// conformanceBuild makes the body of a delivery from its rendered payload,
+// signing it into header as the case calls for.
+type conformanceBuild func(payload map[string]any, header http.Header) ([]byte, error)
+
+// conformanceCase is a delivery the consumer must reject.
+type conformanceCase struct {
+	name  string
+	build conformanceBuild
+}
+
+// conformanceWebhooks renders the preset's payload and headers for the
+// delivery named name.
+type conformanceWebhooks struct {
+	payload, headers any
+	seq              int
+	now              time.Time
+}
+
+func (w *conformanceWebhooks) render(name string) (map[string]any, http.Header, error) {
+	w.seq++
+	data := struct {
+		Name      string
+		Seq       int
+		Time      time.Time
+		Timestamp string
+	}{name, w.seq, w.now, w.now.UTC().Format(time.RFC3339)}
+	payload, err := renderTemplates(w.payload, data)
+	if err != nil {
+		return nil, nil, err
+	}
+	headers, err := renderTemplates(w.headers, data)
+	if err != nil {
+		return nil, nil, err
+	}
+	header := http.Header{"Content-Type": {"application/json"}}
+	for k, v := range headers.(map[string]any) {
+		header.Set(k, fmt.Sprint(v))
+	}
+	return payload.(map[string]any), header, nil
+}
+
+// conformanceDeliveries builds the battery. Every case but the duplicate
+// gets a payload of its own, so that a consumer deduplicating deliveries
+// cannot acknowledge a forged one as already seen.
+func conformanceDeliveries(opts conformanceOptions, scheme SignatureScheme, w *conformanceWebhooks) ([]conformanceDelivery, error) {
+	ts := strconv.FormatInt(w.now.Unix(), 10)
+	staleTS := strconv.FormatInt(w.now.Add(-opts.stale).Unix(), 10)
+
+	var deliveries []conformanceDelivery
+	add := func(name string, accept bool, build conformanceBuild) error {
+		payload, header, err := w.render(name)
+		if err != nil {
+			return fmt.Errorf("render %s: %w", name, err)
+		}
+		body, err := build(payload, header)
+		if err != nil {
+			return err
+		}
+		deliveries = append(deliveries, conformanceDelivery{name: name, accept: accept, body: body, header: header})
+		return nil
+	}
+	signed := func(secret, ts, signedTS string) conformanceBuild {
+		return func(payload map[string]any, header http.Header) ([]byte, error) {
+			body, err := json.Marshal(payload)
+			if err == nil {
+				signHeader(header, scheme, secret, body, ts, signedTS)
+			}
+			return body, err
+		}
+	}
+
+	if err := add("valid", true, signed(opts.secret, ts, ts)); err != nil {
+		return nil, err
+	}
+	// Providers redeliver unchanged when unsure of the first answer.
+	valid := deliveries[0]
+	deliveries = append(deliveries, conformanceDelivery{name: "duplicate", accept: true, body: valid.body, header: valid.header.Clone()})
+
+	cases := []conformanceCase{
+		{"wrong-secret", signed(opts.secret+"-wrong", ts, ts)},
+		{"tampered", func(payload map[string]any, header http.Header) ([]byte, error) {
+			if _, err := signed(opts.secret, ts, ts)(payload, header); err != nil {
+				return nil, err
+			}
+			payload["tampered"] = true
+			return json.Marshal(payload)
+		}},
+		{"unsigned", func(payload map[string]any, header http.Header) ([]byte, error) {
+			body, err := signed(opts.secret, ts, ts)(payload, header)
+			header.Del(scheme.header)
+			return body, err
+		}},
+		{"malformed", func(payload map[string]any, header http.Header) ([]byte, error) {
+			body, err := json.Marshal(payload)
+			if err != nil {
+				return nil, err
+			}
+			body = body[:len(body)/2]
+			signHeader(header, scheme, opts.secret, body, ts, ts)
+			return body, nil
+		}},
+	}
+	if scheme.needsTimestamp {
+		cases = append(cases,
+			conformanceCase{"stale", signed(opts.secret, staleTS, staleTS)},
+			// A captured delivery with its timestamp refreshed.
+			conformanceCase{"replayed", signed(opts.secret, ts, staleTS)},
+		)
+	}
+	for _, c := range cases {
+		if err := add(c.name, false, c.build); err != nil {
+			return nil, err
+		}
+	}
+	return deliveries, nil
+}
+
+func conformanceCheck(opts conformanceOptions, stdout io.Writer) error {
+	scheme, ok := signatureSchemes[opts.preset]
+	if !ok {
+		return fmt.Errorf("unknown preset %q, expected one of %v", opts.preset, signatureSchemeNames())
+	}
+	preset, ok := conformancePresets[opts.preset]
+	if !ok {
+		preset.payload = conformanceGeneric
+	}
+	if opts.payload != "" {
+		data, err := os.ReadFile(opts.payload)
+		if err != nil {
+			return err
+		}
+		preset.payload = string(data)
+	}
+	var payload map[string]any
+	if err := json.Unmarshal([]byte(preset.payload), &payload); err != nil {
+		return fmt.Errorf("parse payload: %w", err)
+	}
+	w := &conformanceWebhooks{now: time.Now()}
+	var err error
+	if w.payload, err = compileTemplates(payload); err != nil {
+		return fmt.Errorf("payload: %w", err)
+	}
+	if w.headers, err = compileTemplates(map[string]any(preset.headers)); err != nil {
+		return fmt.Errorf("headers: %w", err)
+	}
+	deliveries, err := conformanceDeliveries(opts, scheme, w)
+	if err != nil {
+		return err
+	}
+
+	var results []conformanceResult
+	failed := 0
+	for _, d := range deliveries {
+		r := conformanceSend(opts.target, d)
+		if !r.OK {
+			failed++
+		}
+		results = append(results, r)
+	}
+	out := &outputPrinter{w: stdout}
+	err = out.Print(results, func() error {
+		for _, r := range results {
+			status := "ok"
+			if !r.OK {
+				status = "FAIL"
+			}
+			line := fmt.Sprintf("%-4s %-12s expect %s", status, r.Case, r.Expect)
+			if r.Status != 0 {
+				line += fmt.Sprintf(", got %d %s", r.Status, http.StatusText(r.Status))
+			}
+			if r.Detail != "" {
+				line += ": " + r.Detail
+			}
+			if _, err := fmt.Fprintln(stdout, line); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d conformance checks failed", failed, len(results))
+	}
+	return nil
+}
+
+// conformanceSend delivers d to target and checks the answer.
+func conformanceSend(target string, d conformanceDelivery) conformanceResult {
+	result := conformanceResult{Case: d.name, Expect: "4xx"}
+	if d.accept {
+		result.Expect = "2xx"
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), replayTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(d.body))
+	if err != nil {
+		result.Detail = err.Error()
+		return result
+	}
+	req.Header = d.header.Clone()
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		result.Detail = err.Error()
+		return result
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<20))
+	resp.Body.Close()
+	result.Status = resp.StatusCode
+	if d.accept {
+		result.OK = resp.StatusCode >= 200 && resp.StatusCode < 300
+	} else {
+		result.OK = resp.StatusCode >= 400 && resp.StatusCode < 500
+	}
+	return result
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// verifyingConsumer answers as a careful consumer: it rejects deliveries
+// with a bad signature, a stale timestamp or an unparsable body, and
+// acknowledges redeliveries.
+func verifyingConsumer(scheme SignatureScheme, secret string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		header := r.Header.Get(scheme.header)
+		ts := r.Header.Get(scheme.timestampHeader)
+		if scheme.Name == "stripe" {
+			for _, part := range strings.Split(header, ",") {
+				if v, ok := strings.CutPrefix(part, "t="); ok {
+					ts = v
+				}
+			}
+		}
+		if header == "" || !scheme.Verify(secret, body, ts, header) {
+			http.Error(w, "bad signature", http.StatusUnauthorized)
+			return
+		}
+		if scheme.needsTimestamp {
+			sec, err := strconv.ParseInt(ts, 10, 64)
+			if err != nil || time.Since(time.Unix(sec, 0)) > 5*time.Minute {
+				http.Error(w, "stale", http.StatusBadRequest)
+				return
+			}
+		}
+		var payload map[string]any
+		if err := json.Unmarshal(body, &payload); err != nil {
+			http.Error(w, "bad body", http.StatusBadRequest)
+			return
+		}
+	}))
+}
+
+func runConformance(t *testing.T, args ...string) ([]conformanceResult, error) {
+	t.Helper()
+	var out strings.Builder
+	err := runSubcommand("conformance", append(args, "-output", "json"), nil, &out)
+	var results []conformanceResult
+	if jsonErr := json.Unmarshal([]byte(out.String()), &results); jsonErr != nil {
+		t.Fatalf("decode report: %v\n%s", jsonErr, out.String())
+	}
+	return results, err
+}
+
+func TestConformancePassesVerifyingConsumer(t *testing.T) {
+	for _, preset := range []string{"stripe", "github", "slack", "hmac-sha256"} {
+		t.Run(preset, func(t *testing.T) {
+			consumer := verifyingConsumer(signatureSchemes[preset], "whsec")
+			defer consumer.Close()
+
+			results, err := runConformance(t, "-target", consumer.URL, "-preset", preset, "-secret", "whsec")
+			if err != nil {
+				t.Fatalf("conformance failed: %v\n%+v", err, results)
+			}
+			want := 6
+			if signatureSchemes[preset].needsTimestamp {
+				want = 8
+			}
+			if len(results) != want {
+				t.Fatalf("expected %d checks, got %+v", want, results)
+			}
+		})
+	}
+}
+
+func TestConformanceReportsLaxConsumer(t *testing.T) {
+	consumer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer consumer.Close()
+
+	results, err := runConformance(t, "-target", consumer.URL, "-preset", "stripe", "-secret", "whsec")
+	if err == nil || !strings.Contains(err.Error(), "6 of 8") {
+		t.Fatalf("expected 6 of 8 checks failed, got %v", err)
+	}
+	for _, r := range results {
+		if wantOK := r.Case == "valid" || r.Case == "duplicate"; r.OK != wantOK || r.Status != http.StatusOK {
+			t.Errorf("unexpected result %+v", r)
+		}
+	}
+}
+
+func TestConformancePayloadTemplate(t *testing.T) {
+	var mu sync.Mutex
+	var bodies []string
+	consumer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		bodies = append(bodies, string(body))
+		mu.Unlock()
+	}))
+	defer consumer.Close()
+
+	path := filepath.Join(t.TempDir(), "payload.json")
+	if err := os.WriteFile(path, []byte(`{"order": "{{.Name}}-{{.Seq}}", "total": 5}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	runConformance(t, "-target", consumer.URL, "-secret", "s", "-payload", path)
+	if len(bodies) == 0 || bodies[0] != `{"order":"valid-1","total":5}` {
+		t.Errorf("unexpected bodies %q", bodies)
+	}
+}
+
+func TestConformanceUnknownPreset(t *testing.T) {
+	err := runSubcommand("conformance", []string{"-target", "http://127.0.0.1:1", "-preset", "paypal", "-secret", "s"}, nil, io.Discard)
+	if err == nil || !strings.Contains(err.Error(), `unknown preset "paypal"`) {
+		t.Errorf("expected an unknown preset error, got %v", err)
+	}
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// RPC protocols recognised on the ingest path, recorded as the webhook
+// version.
+const (
+	protocolConnect = "connect"
+	protocolGRPCWeb = "grpc-web"
+)
+
+// connectProtocol reports the RPC protocol and message codec r uses, or
+// empty strings for a plain webhook. Connect unary calls are POSTs to /package.Service/Method with a
+// Connect-Protocol-Version header (required for JSON, since that is
+// otherwise indistinguishable from a webhook) or an application/proto body.
+func connectProtocol(r *http.Request) (protocol, codec string) {
+	service, method, ok := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if !ok || !strings.Contains(service, ".") || method == "" || strings.Contains(method, "/") {
+		return "", ""
+	}
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch {
+	case mediaType == "application/grpc-web" || mediaType == "application/grpc-web+proto":
+		return protocolGRPCWeb, "proto"
+	case mediaType == "application/grpc-web+json":
+		return protocolGRPCWeb, "json"
+	case mediaType == "application/proto":
+		return protocolConnect, "proto"
+	case mediaType == "application/json" && r.Header.Get("Connect-Protocol-Version") != "":
+		return protocolConnect, "json"
+	}
+	return "", ""
+}
+
+// decodeConnectMessage decodes a request message. There are no descriptors
+// to decode protobuf with, so binary messages are decoded by wire format,
+// keyed by field number, see decodeProtoWire.
+func decodeConnectMessage(body []byte, codec string) (map[string]any, error) {
+	if codec == "json" {
+		if err := checkJSONDepth(body, maxJSONDepth); err != nil {
+			return nil, err
+		}
+		var msg map[string]any
+		if err := decodeJSON(body, &msg); err != nil {
+			return nil, err
+		}
+		return msg, nil
+	}
+	return decodeProtoWire(body)
+}
+
+// grpcWebMessage returns the message in a gRPC-web request body: the first
+// frame after the 5-byte flags and length prefix. Compressed frames are
+// rejected.
+func grpcWebMessage(body []byte) ([]byte, error) {
+	if len(body) < 5 {
+		return nil, errors.New("grpc-web: short frame")
+	}
+	if body[0]&1 != 0 {
+		return nil, errors.New("grpc-web: compressed messages are not supported")
+	}
+	n := binary.BigEndian.Uint32(body[1:5])
+	if uint64(len(body)-5) < uint64(n) {
+		return nil, errors.New("grpc-web: truncated frame")
+	}
+	return body[5 : 5+n], nil
+}
+
+func grpcWebFrame(flags byte, data []byte) []byte {
+	frame := binary.BigEndian.AppendUint32([]byte{flags}, uint32(len(data)))
+	return append(frame, data...)
+}
+
+// decodeProtoWire decodes a protobuf message without its schema. Fields are
+// keyed by number, repeated fields become arrays, varints and fixed-width
+// values are unsigned integers, and length-delimited fields are strings if
+// printable UTF-8, nested messages if they decode as one, and base64
+// otherwise. Past maxJSONDepth nested messages are kept as base64.
+func decodeProtoWire(b []byte) (map[string]any, error) {
+	return decodeProtoMessage(b, 1)
+}
+
+func decodeProtoMessage(b []byte, depth int) (map[string]any, error) {
+	if maxJSONDepth > 0 && depth > maxJSONDepth {
+		return nil, errors.New("proto: nested too deeply")
+	}
+	msg := make(map[string]any)
+	for len(b) > 0 {
+		tag, n := binary.Uvarint(b)
+		if n <= 0 || tag>>3 == 0 {
+			return nil, errors.New("proto: invalid tag")
+		}
+		b = b[n:]
+
+		var value any
+		switch tag & 7 {
+		case 0:
+			v, n := binary.Uvarint(b)
+			if n <= 0 {
+				return nil, errors.New("proto: invalid varint")
+			}
+			value, b = v, b[n:]
+		case 1:
+			if len(b) < 8 {
+				return nil, errors.New("proto: truncated fixed64")
+			}
+			value, b = binary.LittleEndian.Uint64(b), b[8:]
+		case 5:
+			if len(b) < 4 {
+				return nil, errors.New("proto: truncated fixed32")
+			}
+			value, b = binary.LittleEndian.Uint32(b), b[4:]
+		case 2:
+			l, n := binary.Uvarint(b)
+			if n <= 0 || uint64(len(b)-n) < l {
+				return nil, errors.New("proto: truncated field")
+			}
+			data := b[n : n+int(l)]
+			b = b[n+int(l):]
+			if isPrintable(data) {
+				value = string(data)
+			} else if nested, err := decodeProtoMessage(data, depth+1); err == nil {
+				value = nested
+			} else {
+				value = base64.StdEncoding.EncodeToString(data)
+			}
+		default:
+			return nil, fmt.Errorf("proto: unsupported wire type %d", tag&7)
+		}
+
+		key := strconv.FormatUint(tag>>3, 10)
+		switch existing := msg[key].(type) {
+		case nil:
+			msg[key] = value
+		case []any:
+			msg[key] = append(existing, value)
+		default:
+			msg[key] = []any{existing, value}
+		}
+	}
+	return msg, nil
+}
+
+func isPrintable(data []byte) bool {
+	if !utf8.Valid(data) {
+		return false
+	}
+	for _, r := range string(data) {
+		if !unicode.IsPrint(r) && !unicode.IsSpace(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// connectError answers a failed call the way clients of protocol expect:
+// Connect errors are JSON with an HTTP status, gRPC-web errors are
+// trailers in a 200 response.
+func connectError(w http.ResponseWriter, protocol, detail string) {
+	if protocol == protocolGRPCWeb {
+		w.Header().Set("Content-Type", "application/grpc-web+proto")
+		w.Write(grpcWebFrame(0x80, []byte("grpc-status: 3\r\ngrpc-message: "+detail+"\r\n")))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(map[string]string{"code": "invalid_argument", "message": detail})
+}
+
+// recordConnect records a Connect or gRPC-web unary call under its procedure
+// name, e.g. "acme.orders.v1.OrderService/Shipped", and answers with an empty
+// response message, which decodes as the default value of any response type.
+func recordConnect(w http.ResponseWriter, r *http.Request, recorder *Recorder, protocol, codec string, body []byte) {
+	msg := body
+	if protocol == protocolGRPCWeb {
+		var err error
+		if msg, err = grpcWebMessage(body); err != nil {
+			connectError(w, protocol, err.Error())
+			return
+		}
+	}
+	payload, err := decodeConnectMessage(msg, codec)
+	if err != nil {
+		connectError(w, protocol, "Failed to decode message: "+err.Error())
+		return
+	}
+
+	if !checkQuota(w, r, int64(len(body))) {
+		return
+	}
+
+	res := WebhookParams{
+		EventType:      strings.TrimPrefix(r.URL.Path, "/"),
+		Payload:        payload,
+		Version:        protocol,
+		IdempotencyKey: r.Header.Get(idempotencyHeader),
+		Trace:          traceContext(r.Header),
+		Client:         clientInfo(r),
+		TLS:            tlsInfo(r),
+		Headers:        r.Header.Clone(),
+		ContentType:    r.Header.Get("Content-Type"),
+		Raw:            body,
+	}
+	stored := res
+	if captureControl(recorder, r) {
+		stored, _ = recorder.Record(res, body)
+	}
+	setProvenanceHeaders(w, stored)
+
+	switch {
+	case protocol == protocolGRPCWeb:
+		w.Header().Set("Content-Type", "application/grpc-web+"+codec)
+		empty := []byte{}
+		if codec == "json" {
+			empty = []byte("{}")
+		}
+		w.Write(grpcWebFrame(0, empty))
+		w.Write(grpcWebFrame(0x80, []byte("grpc-status: 0\r\n")))
+	case codec == "json":
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte("{}"))
+	default:
+		w.Header().Set("Content-Type", "application/proto")
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+// shippedProto is {order_id: 42, carrier: "ups", item: {sku: "A1"}} with
+// fields numbered 1, 2 and 3.
+var shippedProto = []byte{0x08, 42, 0x12, 3, 'u', 'p', 's', 0x1a, 4, 0x0a, 2, 'A', '1'}
+
+func postRPC(t *testing.T, mux *http.ServeMux, path, contentType string, body []byte, connect bool) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(body))
+	req.Header.Set("Content-Type", contentType)
+	if connect {
+		req.Header.Set("Connect-Protocol-Version", "1")
+	}
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestDecodeProtoWire(t *testing.T) {
+	msg, err := decodeProtoWire(shippedProto)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]any{"1": uint64(42), "2": "ups", "3": map[string]any{"1": "A1"}}
+	if !reflect.DeepEqual(msg, want) {
+		t.Errorf("got %#v", msg)
+	}
+
+	repeated, _ := decodeProtoWire([]byte{0x08, 1, 0x08, 2})
+	if !reflect.DeepEqual(repeated["1"], []any{uint64(1), uint64(2)}) {
+		t.Errorf("expected repeated fields as an array, got %#v", repeated)
+	}
+
+	for _, bad := range [][]byte{{0x08}, {0x12, 5, 'a'}, {0x0b}, {0x00}} {
+		if _, err := decodeProtoWire(bad); err == nil {
+			t.Errorf("expected % x to be rejected", bad)
+		}
+	}
+}
+
+func TestConnectIngest(t *testing.T) {
+	mux := newTestServer()
+	const procedure = "/acme.orders.v1.OrderService/Shipped"
+
+	rec := postRPC(t, mux, procedure, "application/json", []byte(`{"orderId":"42"}`), true)
+	if rec.Code != http.StatusOK || rec.Body.String() != "{}" || rec.Header().Get("X-Echo-Id") == "" {
+		t.Fatalf("expected an empty Connect response, got %d %q", rec.Code, rec.Body.String())
+	}
+	rec = postRPC(t, mux, procedure, "application/proto", shippedProto, false)
+	if rec.Code != http.StatusOK || rec.Body.Len() != 0 || rec.Header().Get("Content-Type") != "application/proto" {
+		t.Fatalf("expected an empty proto response, got %d %q", rec.Code, rec.Body.String())
+	}
+
+	got := queryWebhooks(t, mux, "/query?event_type=acme.orders.v1.OrderService/Shipped")
+	if len(got) != 2 || got[0].Version != protocolConnect {
+		t.Fatalf("expected both calls recorded, got %+v", got)
+	}
+	if got := queryWebhooks(t, mux, "/query?event_type=acme.orders.v1.OrderService/Shipped&3.1=A1"); len(got) != 1 {
+		t.Errorf("expected proto fields to be filterable by number, got %d", len(got))
+	}
+
+	// Without the protocol header JSON is an ordinary webhook.
+	postRPC(t, mux, procedure, "application/json", []byte(`{"event":"plain"}`), false)
+	if got := queryWebhooks(t, mux, "/query/plain"); len(got) != 1 {
+		t.Errorf("expected a plain webhook, got %d", len(got))
+	}
+
+	rec = postRPC(t, mux, procedure, "application/json", []byte(`[`), true)
+	if rec.Code != http.StatusBadRequest || !bytes.Contains(rec.Body.Bytes(), []byte("invalid_argument")) {
+		t.Errorf("expected a Connect error, got %d %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestGRPCWebIngest(t *testing.T) {
+	mux := newTestServer()
+	body := binary.BigEndian.AppendUint32([]byte{0}, uint32(len(shippedProto)))
+	body = append(body, shippedProto...)
+
+	rec := postRPC(t, mux, "/acme.orders.v1.OrderService/Shipped", "application/grpc-web+proto", body, false)
+	want := append(grpcWebFrame(0, nil), grpcWebFrame(0x80, []byte("grpc-status: 0\r\n"))...)
+	if rec.Code != http.StatusOK || !bytes.Equal(rec.Body.Bytes(), want) {
+		t.Fatalf("expected an empty message and OK trailers, got %d % x", rec.Code, rec.Body.Bytes())
+	}
+	got := queryWebhooks(t, mux, "/query?event_type=acme.orders.v1.OrderService/Shipped")
+	if len(got) != 1 || got[0].Version != protocolGRPCWeb || got[0].Payload["2"] != "ups" {
+		t.Fatalf("expected the decoded call, got %+v", got)
+	}
+
+	rec = postRPC(t, mux, "/acme.orders.v1.OrderService/Shipped", "application/grpc-web", []byte{0, 0, 0, 0, 9}, false)
+	if !bytes.Contains(rec.Body.Bytes(), []byte("grpc-status: 3")) {
+		t.Errorf("expected an invalid argument trailer, got %q", rec.Body.String())
+	}
+}
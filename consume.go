@@ -0,0 +1,164 @@
+package main
+
+import (
+	"encoding/json"
+	"maps"
+	"net/http"
+	"strconv"
+	"sync"
+)
+
+// Consumers holds the committed cursor of each named /consume consumer.
+type Consumers struct {
+	mu      sync.Mutex
+	cursors map[string]uint64
+}
+
+func NewConsumers() *Consumers {
+	return &Consumers{cursors: make(map[string]uint64)}
+}
+
+func (c *Consumers) Committed(name string) uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.cursors[name]
+}
+
+// Commit records cursor for name. Commits never move a consumer backwards.
+func (c *Consumers) Commit(name string, cursor uint64) uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cursors[name] = max(c.cursors[name], cursor)
+	return c.cursors[name]
+}
+
+// parseCursor reads a cursor handed out by /consume. Cursors are opaque to
+// clients; they are the sequence number of the last record consumed.
+func parseCursor(s string) (uint64, error) {
+	if s == "" {
+		return 0, nil
+	}
+	n, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return 0, &paramError{codeInvalidParameter, "Invalid cursor " + strconv.Quote(s)}
+	}
+	return n, nil
+}
+
+type consumeBatch struct {
+	Records    []WebhookParams `json:"records"`
+	NextCursor string          `json:"next_cursor"`
+	Evicted    uint64          `json:"evicted,omitempty"`
+	// Truncated is set when the scan ran out of time. NextCursor then only
+	// covers the records returned.
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// consumeHandler returns the records after cursor, oldest first. Without a
+// cursor, a named consumer resumes from its committed cursor and anyone else
+// starts from the oldest buffered record. Any other parameters filter the
+// batch as on /query. Committing next_cursor after processing a batch gives
+// at-least-once delivery across consumer restarts.
+func consumeHandler(buffer *RingBuffer, consumers *Consumers) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := maps.Clone(r.URL.Query())
+		consumer := params.Get("consumer")
+		limit := subscriptionBatch
+		if v := params.Get("max"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 || n > 1000 {
+				writeProblem(w, r, http.StatusBadRequest, codeInvalidParameter, "max must be between 1 and 1000")
+				return
+			}
+			limit = n
+		}
+		cursor, err := parseCursor(params.Get("cursor"))
+		if err != nil {
+			writeParamError(w, r, err)
+			return
+		}
+		if !params.Has("cursor") && consumer != "" {
+			cursor = consumers.Committed(consumer)
+		}
+		delete(params, "consumer")
+		delete(params, "max")
+		delete(params, "cursor")
+
+		var filter *QueryFilter
+		if len(params) > 0 {
+			f, err := parseQueryFilter(params, "")
+			if err != nil {
+				writeParamError(w, r, err)
+				return
+			}
+			filter = &f
+		}
+
+		// Everything up to last is scanned unless the batch fills up or the
+		// scan runs out of time, so a filtered consumer does not rescan
+		// records it skipped.
+		ctx, cancel := scanContext(r)
+		defer cancel()
+		last := buffer.LastSequence()
+		items, evicted, truncated := buffer.After(ctx, cursor, limit, filter)
+		next := max(cursor, last)
+		if truncated {
+			next = cursor
+		}
+		if len(items) > 0 && (len(items) == limit || truncated) {
+			next = items[len(items)-1].Sequence
+		} else if len(items) > 0 {
+			next = max(next, items[len(items)-1].Sequence)
+		}
+		if items == nil {
+			items = []WebhookParams{}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(consumeBatch{
+			Records:    items,
+			NextCursor: strconv.FormatUint(next, 10),
+			Evicted:    evicted,
+			Truncated:  truncated,
+		})
+	}
+}
+
+type commitRequest struct {
+	Consumer string `json:"consumer"`
+	Cursor   string `json:"cursor"`
+}
+
+func commitHandler(buffer *RingBuffer, consumers *Consumers) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req commitRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeProblem(w, r, http.StatusBadRequest, codeInvalidJSON, "Invalid JSON: "+err.Error())
+			return
+		}
+		if req.Consumer == "" {
+			writeProblem(w, r, http.StatusBadRequest, codeMissingParameter, "Missing consumer")
+			return
+		}
+		cursor, err := parseCursor(req.Cursor)
+		if err != nil {
+			writeParamError(w, r, err)
+			return
+		}
+		if cursor > buffer.LastSequence() {
+			writeProblem(w, r, http.StatusBadRequest, codeInvalidParameter, "Cursor is ahead of the latest record")
+			return
+		}
+		committed := consumers.Commit(req.Consumer, cursor)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(commitRequest{Consumer: req.Consumer, Cursor: strconv.FormatUint(committed, 10)})
+	}
+}
+
+// registerConsumeRoutes mounts the pull consumption API. Committing a cursor
+// takes the admin token, so that one consumer cannot move another's.
+func registerConsumeRoutes(mux *http.ServeMux, buffer *RingBuffer, consumers *Consumers, adminToken string) {
+	handleAPI(mux, "GET /consume", consumeHandler(buffer, consumers))
+	handleAPI(mux, "POST /consume/commit", requireAdmin(adminToken, commitHandler(buffer, consumers)))
+}
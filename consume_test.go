@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func consume(t *testing.T, mux *http.ServeMux, query string) consumeBatch {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/consume?"+query, nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("consume failed with status %d: %s", rec.Code, rec.Body.String())
+	}
+	var batch consumeBatch
+	json.NewDecoder(rec.Body).Decode(&batch)
+	return batch
+}
+
+func commit(t *testing.T, mux *http.ServeMux, body string) int {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, adminRequest(http.MethodPost, "/consume/commit", strings.NewReader(body)))
+	return rec.Code
+}
+
+func TestConsumeBatches(t *testing.T) {
+	mux := newTestServer()
+	for _, event := range []string{"order", "other", "order", "order"} {
+		postWebhook(t, mux, `{"event":"`+event+`"}`)
+	}
+
+	batch := consume(t, mux, "max=2")
+	if len(batch.Records) != 2 || batch.Records[0].Sequence != 1 || batch.NextCursor != "2" {
+		t.Fatalf("expected records 1-2 and cursor 2, got %+v", batch)
+	}
+	batch = consume(t, mux, "max=2&cursor="+batch.NextCursor)
+	if len(batch.Records) != 2 || batch.Records[0].Sequence != 3 || batch.NextCursor != "4" {
+		t.Fatalf("expected records 3-4 and cursor 4, got %+v", batch)
+	}
+	if batch = consume(t, mux, "cursor=4"); len(batch.Records) != 0 || batch.NextCursor != "4" {
+		t.Errorf("expected an empty batch at the end, got %+v", batch)
+	}
+
+	// A filtered consumer moves past records it skipped.
+	batch = consume(t, mux, "event_type=other&cursor=2")
+	if len(batch.Records) != 0 || batch.NextCursor != "4" {
+		t.Errorf("expected no other records after 2 and cursor 4, got %+v", batch)
+	}
+
+	for _, bad := range []string{"cursor=abc", "max=0", "max=5000"} {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/consume?"+bad, nil))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status 400, got %d", bad, rec.Code)
+		}
+	}
+}
+
+func TestConsumeCommit(t *testing.T) {
+	mux := newTestServer()
+	for i := 0; i < 3; i++ {
+		postWebhook(t, mux, `{"event":"order"}`)
+	}
+
+	batch := consume(t, mux, "consumer=etl&max=2")
+	if len(batch.Records) != 2 {
+		t.Fatalf("expected 2 records, got %d", len(batch.Records))
+	}
+	// Until committed, the consumer gets the same batch again.
+	if again := consume(t, mux, "consumer=etl&max=2"); again.Records[0].ID != batch.Records[0].ID {
+		t.Errorf("expected the uncommitted batch again")
+	}
+
+	if code := commit(t, mux, `{"consumer":"etl","cursor":"`+batch.NextCursor+`"}`); code != http.StatusOK {
+		t.Fatalf("commit failed with status %d", code)
+	}
+	if rest := consume(t, mux, "consumer=etl"); len(rest.Records) != 1 || rest.Records[0].Sequence != 3 {
+		t.Errorf("expected to resume after the commit, got %+v", rest)
+	}
+	if code := commit(t, mux, `{"consumer":"etl","cursor":"1"}`); code != http.StatusOK {
+		t.Errorf("expected an older commit to be accepted, got %d", code)
+	}
+	if rest := consume(t, mux, "consumer=etl"); len(rest.Records) != 1 {
+		t.Errorf("expected commits never to move backwards, got %d records", len(rest.Records))
+	}
+
+	if code := commit(t, mux, `{"consumer":"etl","cursor":"10"}`); code != http.StatusBadRequest {
+		t.Errorf("expected status 400 for a cursor past the latest record, got %d", code)
+	}
+	if code := commit(t, mux, `{"cursor":"1"}`); code != http.StatusBadRequest {
+		t.Errorf("expected status 400 without a consumer, got %d", code)
+	}
+}
+
+func TestConsumeTruncatedKeepsCursor(t *testing.T) {
+	mux := newTestServer()
+	postWebhook(t, mux, `{"event":"order"}`)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/consume?cursor=0", nil).WithContext(ctx))
+	var batch consumeBatch
+	json.NewDecoder(rec.Body).Decode(&batch)
+	if !batch.Truncated || len(batch.Records) != 0 || batch.NextCursor != "0" {
+		t.Errorf("expected a truncated batch that does not advance, got %+v", batch)
+	}
+}
+
+func TestConsumeCommitWithoutAdminToken(t *testing.T) {
+	mux := http.NewServeMux()
+	registerConsumeRoutes(mux, NewRingBuffer(1), NewConsumers(), "")
+	if code := commit(t, mux, `{"consumer":"etl","cursor":"0"}`); code != http.StatusForbidden {
+		t.Errorf("expected status 403 without a configured admin token, got %d", code)
+	}
+}
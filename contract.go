@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ResponseContract is what a forwarding target promises to answer with.
+// Status lists the accepted status codes and classes, such as 200 or 2xx;
+// Schema is a JSON Schema the response body must satisfy; MaxLatency bounds
+// the time to a complete response. Empty fields are not checked.
+type ResponseContract struct {
+	Status     []string        `json:"status,omitempty"`
+	Schema     json.RawMessage `json:"schema,omitempty"`
+	MaxLatency jsonDuration    `json:"max_latency,omitempty"`
+
+	schema *jsonSchema
+}
+
+// compile validates the contract and parses its schema.
+func (c *ResponseContract) compile() error {
+	for _, spec := range c.Status {
+		if !validStatusCode(strings.ToLower(spec)) {
+			return &paramError{codeInvalidParameter, fmt.Sprintf("expect.status: %q is not a status code such as 200 or a class such as 2xx", spec)}
+		}
+	}
+	if c.MaxLatency.Duration < 0 {
+		return &paramError{codeInvalidParameter, "expect.max_latency must not be negative"}
+	}
+	if len(c.Schema) > 0 {
+		schema, err := parseJSONSchema(c.Schema)
+		if err != nil {
+			return &paramError{codeInvalidParameter, "expect.schema: " + err.Error()}
+		}
+		c.schema = schema
+	}
+	return nil
+}
+
+// needsBody reports whether checking the contract reads the response body.
+func (c *ResponseContract) needsBody() bool {
+	return c != nil && c.schema != nil
+}
+
+// Check returns how a response with status and body, taking latency,
+// breaks the contract, nil if it keeps it.
+func (c *ResponseContract) Check(status int, body []byte, latency time.Duration) []string {
+	if c == nil {
+		return nil
+	}
+	var violations []string
+	if len(c.Status) > 0 {
+		ok := false
+		for _, spec := range c.Status {
+			ok = ok || statusMatches(strings.ToLower(spec), status)
+		}
+		if !ok {
+			violations = append(violations, fmt.Sprintf("status %d, expected %s", status, strings.Join(c.Status, ", ")))
+		}
+	}
+	if c.MaxLatency.Duration > 0 && latency > c.MaxLatency.Duration {
+		violations = append(violations, fmt.Sprintf("took %s, expected at most %s", latency.Round(time.Millisecond), c.MaxLatency))
+	}
+	if c.schema != nil {
+		var v any
+		if err := json.Unmarshal(body, &v); err != nil {
+			violations = append(violations, "body is not JSON: "+err.Error())
+		} else {
+			violations = c.schema.Validate("", v, violations)
+		}
+	}
+	return violations
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestResponseContractCheck(t *testing.T) {
+	contract := &ResponseContract{
+		Status:     []string{"200", "202"},
+		Schema:     json.RawMessage(`{"type":"object","required":["ok"],"properties":{"ok":{"type":"boolean"},"id":{"type":"string","pattern":"^evt_"}}}`),
+		MaxLatency: jsonDuration{time.Second},
+	}
+	if err := contract.compile(); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		status  int
+		body    string
+		latency time.Duration
+		want    string
+	}{
+		{200, `{"ok":true,"id":"evt_1"}`, time.Millisecond, ""},
+		{201, `{"ok":true}`, time.Millisecond, "status 201, expected 200, 202"},
+		{202, `{"ok":true}`, 2 * time.Second, "took 2s, expected at most 1s"},
+		{200, `{"id":"x"}`, time.Millisecond, `body: missing required property "ok"; id: does not match "^evt_"`},
+		{200, `{"ok":"yes"}`, time.Millisecond, "ok: expected boolean, got string"},
+		{200, `accepted`, time.Millisecond, "body is not JSON"},
+	}
+	for _, tt := range tests {
+		got := strings.Join(contract.Check(tt.status, []byte(tt.body), tt.latency), "; ")
+		if tt.want == "" && got != "" || !strings.Contains(got, tt.want) {
+			t.Errorf("Check(%d, %s, %s) = %q, want %q", tt.status, tt.body, tt.latency, got, tt.want)
+		}
+	}
+}
+
+func TestResponseContractCompile(t *testing.T) {
+	for _, c := range []ResponseContract{
+		{Status: []string{"2x"}},
+		{Schema: json.RawMessage(`{"type":"date"}`)},
+		{Schema: json.RawMessage(`{"pattern":"("}`)},
+	} {
+		if err := c.compile(); err == nil {
+			t.Errorf("expected %+v to be rejected", c)
+		}
+	}
+}
+
+func TestPushSubscriptionContractViolations(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.Header.Get("X-Echo-Sequence") == "2" {
+			w.Write([]byte(`{"status":"queued"}`))
+			return
+		}
+		w.Write([]byte(`{"ok":true}`))
+	}))
+	defer target.Close()
+
+	mux, _, subs := newSubscriptionServer(10)
+	if rec := subscriptionRequest(t, mux, http.MethodPost, "/subscriptions", `{"expect":{"status":["2xx"]}}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("expected a contract on a pull subscription to be rejected, got %d", rec.Code)
+	}
+	sub := createSubscription(t, mux, `{"url":"`+target.URL+`","expect":{"status":["2xx"],"schema":{"required":["ok"]}}}`)
+	defer subs.Delete(sub.ID)
+	postWebhook(t, mux, `{"event":"a","data":{}}`)
+	postWebhook(t, mux, `{"event":"b","data":{}}`)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if s, _ := subs.Get(sub.ID); s.Acked == 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("push did not catch up")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	s, _ := subs.Get(sub.ID)
+	if s.Delivered != 2 || s.Violations != 1 || s.LastViolation != `body: missing required property "ok"` {
+		t.Errorf("expected one violation in two deliveries, got %+v", s)
+	}
+	rec := subscriptionRequest(t, mux, http.MethodGet, "/subscriptions/"+sub.ID+"/deliveries?violations=true", "")
+	var attempts []DeliveryAttempt
+	json.NewDecoder(rec.Body).Decode(&attempts)
+	if len(attempts) != 1 || attempts[0].Sequence != 2 || attempts[0].Status != http.StatusOK {
+		t.Errorf("expected the second delivery logged as a violation, got %+v", attempts)
+	}
+}
@@ -0,0 +1,444 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// cronSchedule is a parsed crontab expression. Each field is a bitmask of
+// the values it allows.
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64
+	// domAny and dowAny record a field given as "*": as in cron, a day
+	// matches either restricted day field when both are restricted.
+	domAny, dowAny bool
+	// every is set for "@every <duration>", which is not tied to the clock.
+	every time.Duration
+}
+
+var cronMacros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+var (
+	cronMonths = []string{"", "jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}
+	cronDays   = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+)
+
+// parseCron parses a five-field crontab expression (minute, hour, day of
+// month, month, day of week), one of the @hourly-style macros, or
+// "@every 30s". Fields take *, lists, ranges, /steps and, for months and
+// days of the week, three-letter names; 7 is Sunday as well as 0.
+func parseCron(spec string) (cronSchedule, error) {
+	var s cronSchedule
+	spec = strings.TrimSpace(spec)
+	if d, ok := strings.CutPrefix(spec, "@every "); ok {
+		every, err := time.ParseDuration(strings.TrimSpace(d))
+		if err != nil || every <= 0 {
+			return s, fmt.Errorf("invalid @every duration %q", d)
+		}
+		s.every = every
+		return s, nil
+	}
+	if macro, ok := cronMacros[spec]; ok {
+		spec = macro
+	}
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return s, fmt.Errorf("want 5 fields, got %d in %q", len(fields), spec)
+	}
+	var err error
+	if s.minute, err = cronField(fields[0], 0, 59, nil); err != nil {
+		return s, fmt.Errorf("minute: %w", err)
+	}
+	if s.hour, err = cronField(fields[1], 0, 23, nil); err != nil {
+		return s, fmt.Errorf("hour: %w", err)
+	}
+	if s.dom, err = cronField(fields[2], 1, 31, nil); err != nil {
+		return s, fmt.Errorf("day of month: %w", err)
+	}
+	if s.month, err = cronField(fields[3], 1, 12, cronMonths); err != nil {
+		return s, fmt.Errorf("month: %w", err)
+	}
+	if s.dow, err = cronField(fields[4], 0, 7, cronDays); err != nil {
+		return s, fmt.Errorf("day of week: %w", err)
+	}
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+	}
+	s.domAny, s.dowAny = fields[2] == "*", fields[4] == "*"
+	return s, nil
+}
+
+func cronField(field string, lo, hi int, names []string) (uint64, error) {
+	var mask uint64
+	for _, part := range strings.Split(field, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			n, err := strconv.Atoi(stepPart)
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("invalid step %q", stepPart)
+			}
+			step = n
+		}
+		first, last := lo, hi
+		if rangePart != "*" {
+			a, b, isRange := strings.Cut(rangePart, "-")
+			var err error
+			if first, err = cronValue(a, lo, hi, names); err != nil {
+				return 0, err
+			}
+			last = first
+			if isRange {
+				if last, err = cronValue(b, lo, hi, names); err != nil {
+					return 0, err
+				}
+			} else if hasStep {
+				last = hi
+			}
+			if last < first {
+				return 0, fmt.Errorf("invalid range %q", rangePart)
+			}
+		}
+		for v := first; v <= last; v += step {
+			mask |= 1 << v
+		}
+	}
+	return mask, nil
+}
+
+func cronValue(s string, lo, hi int, names []string) (int, error) {
+	for i, name := range names {
+		if name != "" && strings.EqualFold(s, name) {
+			return i, nil
+		}
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < lo || n > hi {
+		return 0, fmt.Errorf("%q is not in %d-%d", s, lo, hi)
+	}
+	return n, nil
+}
+
+func (s cronSchedule) dayMatches(t time.Time) bool {
+	dom := s.dom&(1<<t.Day()) != 0
+	dow := s.dow&(1<<int(t.Weekday())) != 0
+	if s.domAny || s.dowAny {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// Next returns the first time after t the schedule fires, or the zero time
+// if it never does, e.g. for "0 0 30 2 *".
+func (s cronSchedule) Next(t time.Time) time.Time {
+	if s.every > 0 {
+		return t.Add(s.every)
+	}
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		switch {
+		case s.month&(1<<int(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		case !s.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		case s.hour&(1<<t.Hour()) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+		case s.minute&(1<<t.Minute()) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// ScheduleConfig emits a synthetic webhook on a cron schedule, to keep
+// downstream dashboards fed in demo environments. Every string in Data is a
+// text/template executed with the emission's .Name, .Seq (counting from 1),
+// .Time and .Timestamp (RFC 3339), and the functions uuid and randInt; the
+// results stay strings. The webhook is stored unless ForwardOnly is set, and
+// also POSTed to Forward when that is set.
+type ScheduleConfig struct {
+	Name        string          `json:"name"`
+	Schedule    string          `json:"schedule"`
+	Event       string          `json:"event"`
+	Version     string          `json:"version,omitempty"`
+	Data        json.RawMessage `json:"data,omitempty"`
+	Forward     string          `json:"forward,omitempty"`
+	ForwardOnly bool            `json:"forward_only,omitempty"`
+}
+
+func LoadSchedules(path string) ([]ScheduleConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var configs []ScheduleConfig
+	if err := json.Unmarshal(data, &configs); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return configs, nil
+}
+
+// ScheduleStatus is what GET /schedules reports for a schedule.
+type ScheduleStatus struct {
+	Name      string    `json:"name"`
+	Schedule  string    `json:"schedule"`
+	Event     string    `json:"event"`
+	Emitted   int       `json:"emitted"`
+	LastRun   time.Time `json:"last_run,omitzero"`
+	NextRun   time.Time `json:"next_run,omitzero"`
+	LastError string    `json:"last_error,omitempty"`
+}
+
+var templateFuncs = template.FuncMap{
+	"uuid": func() string {
+		b := make([]byte, 16)
+		rand.Read(b)
+		b[6], b[8] = b[6]&0x0f|0x40, b[8]&0x3f|0x80
+		h := hex.EncodeToString(b)
+		return h[:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:]
+	},
+	"randInt": func(lo, hi int) int {
+		if hi <= lo {
+			return lo
+		}
+		n, _ := rand.Int(rand.Reader, big.NewInt(int64(hi-lo+1)))
+		return lo + int(n.Int64())
+	},
+}
+
+// Emitter runs one schedule.
+type Emitter struct {
+	cfg      ScheduleConfig
+	schedule cronSchedule
+	data     any
+	client   *http.Client
+	recorder *Recorder
+
+	mu     sync.Mutex
+	status ScheduleStatus
+}
+
+func NewEmitter(cfg ScheduleConfig, client *http.Client, recorder *Recorder) (*Emitter, error) {
+	if cfg.Name == "" {
+		return nil, errors.New("schedule without name")
+	}
+	if cfg.Event == "" {
+		return nil, fmt.Errorf("schedule %s: event is required", cfg.Name)
+	}
+	if cfg.ForwardOnly && cfg.Forward == "" {
+		return nil, fmt.Errorf("schedule %s: forward_only needs forward", cfg.Name)
+	}
+	schedule, err := parseCron(cfg.Schedule)
+	if err != nil {
+		return nil, fmt.Errorf("schedule %s: %w", cfg.Name, err)
+	}
+	e := &Emitter{
+		cfg:      cfg,
+		schedule: schedule,
+		client:   client,
+		recorder: recorder,
+		status:   ScheduleStatus{Name: cfg.Name, Schedule: cfg.Schedule, Event: cfg.Event},
+	}
+	data := map[string]any{}
+	if len(cfg.Data) > 0 {
+		if err := json.Unmarshal(cfg.Data, &data); err != nil {
+			return nil, fmt.Errorf("schedule %s: data must be an object: %w", cfg.Name, err)
+		}
+	}
+	if e.data, err = compileTemplates(data); err != nil {
+		return nil, fmt.Errorf("schedule %s: %w", cfg.Name, err)
+	}
+	return e, nil
+}
+
+// compileTemplates replaces the strings in a decoded JSON value with their
+// templates.
+func compileTemplates(v any) (any, error) {
+	switch v := v.(type) {
+	case string:
+		if !strings.Contains(v, "{{") {
+			return v, nil
+		}
+		return template.New("").Funcs(templateFuncs).Option("missingkey=error").Parse(v)
+	case map[string]any:
+		out := make(map[string]any, len(v))
+		for key, value := range v {
+			c, err := compileTemplates(value)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", key, err)
+			}
+			out[key] = c
+		}
+		return out, nil
+	case []any:
+		out := make([]any, len(v))
+		for i, value := range v {
+			c, err := compileTemplates(value)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = c
+		}
+		return out, nil
+	}
+	return v, nil
+}
+
+func renderTemplates(v any, data any) (any, error) {
+	switch v := v.(type) {
+	case *template.Template:
+		var b strings.Builder
+		if err := v.Execute(&b, data); err != nil {
+			return nil, err
+		}
+		return b.String(), nil
+	case map[string]any:
+		out := make(map[string]any, len(v))
+		for key, value := range v {
+			r, err := renderTemplates(value, data)
+			if err != nil {
+				return nil, err
+			}
+			out[key] = r
+		}
+		return out, nil
+	case []any:
+		out := make([]any, len(v))
+		for i, value := range v {
+			r, err := renderTemplates(value, data)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = r
+		}
+		return out, nil
+	}
+	return v, nil
+}
+
+// Run emits on schedule until ctx is cancelled.
+func (e *Emitter) Run(ctx context.Context) {
+	for {
+		next := e.schedule.Next(time.Now())
+		if next.IsZero() {
+			log.Printf("Schedule %s: %q never fires", e.cfg.Name, e.cfg.Schedule)
+			return
+		}
+		e.mu.Lock()
+		e.status.NextRun = next
+		e.mu.Unlock()
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		if err := e.emit(ctx, next); err != nil {
+			log.Printf("Schedule %s: %v", e.cfg.Name, err)
+		}
+	}
+}
+
+// emit renders and delivers one synthetic webhook for the run at t.
+func (e *Emitter) emit(ctx context.Context, t time.Time) (err error) {
+	e.mu.Lock()
+	seq := e.status.Emitted + 1
+	e.mu.Unlock()
+	defer func() {
+		e.mu.Lock()
+		e.status.LastRun = t
+		e.status.LastError = ""
+		if err != nil {
+			e.status.LastError = err.Error()
+		} else {
+			e.status.Emitted = seq
+		}
+		e.mu.Unlock()
+	}()
+
+	rendered, err := renderTemplates(e.data, struct {
+		Name      string
+		Seq       int
+		Time      time.Time
+		Timestamp string
+	}{e.cfg.Name, seq, t, t.UTC().Format(time.RFC3339)})
+	if err != nil {
+		return err
+	}
+	item := WebhookParams{
+		EventType:   e.cfg.Event,
+		Payload:     rendered.(map[string]any),
+		Version:     e.cfg.Version,
+		Source:      "cron:" + e.cfg.Name,
+		ContentType: "application/json",
+	}
+	body, _, err := webhookBody(item)
+	if err != nil {
+		return err
+	}
+	if !e.cfg.ForwardOnly {
+		e.recorder.Record(item, body)
+	}
+	if e.cfg.Forward == "" {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, replayTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.cfg.Forward, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("POST %s: %s", e.cfg.Forward, resp.Status)
+	}
+	return nil
+}
+
+func (e *Emitter) Status() ScheduleStatus {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.status
+}
+
+func schedulesHandler(emitters []*Emitter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		statuses := make([]ScheduleStatus, len(emitters))
+		for i, e := range emitters {
+			statuses[i] = e.Status()
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(statuses)
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCronNext(t *testing.T) {
+	from := time.Date(2026, 3, 14, 10, 7, 30, 0, time.UTC)
+	for _, tc := range []struct{ spec, want string }{
+		{"*/15 * * * *", "2026-03-14T10:15:00Z"},
+		{"0 9-17 * * mon-fri", "2026-03-16T09:00:00Z"},
+		{"30 4 1,15 * *", "2026-03-15T04:30:00Z"},
+		{"0 0 13 * 5", "2026-03-20T00:00:00Z"},
+		{"0 12 * feb 7", "2027-02-07T12:00:00Z"},
+		{"@hourly", "2026-03-14T11:00:00Z"},
+		{"@every 90s", "2026-03-14T10:09:00Z"},
+		{"0 0 30 2 *", "0001-01-01T00:00:00Z"},
+	} {
+		s, err := parseCron(tc.spec)
+		if err != nil {
+			t.Errorf("%s: %v", tc.spec, err)
+			continue
+		}
+		if got := s.Next(from).Format(time.RFC3339); got != tc.want {
+			t.Errorf("%s: expected %s, got %s", tc.spec, tc.want, got)
+		}
+	}
+	for _, spec := range []string{"* * * *", "60 * * * *", "*/0 * * * *", "5-1 * * * *", "@every -1s", "* * * foo *"} {
+		if _, err := parseCron(spec); err == nil {
+			t.Errorf("%s: expected an error", spec)
+		}
+	}
+}
+
+func TestEmitter(t *testing.T) {
+	var forwarded map[string]any
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		json.Unmarshal(b, &forwarded)
+	}))
+	defer target.Close()
+
+	buffer := NewRingBuffer(10)
+	e, err := NewEmitter(ScheduleConfig{
+		Name:     "demo",
+		Schedule: "* * * * *",
+		Event:    "heartbeat",
+		Data:     json.RawMessage(`{"run": "{{.Seq}}", "at": "{{.Timestamp}}", "tags": ["{{.Name}}", 3], "id": "{{uuid}}"}`),
+		Forward:  target.URL,
+	}, target.Client(), NewRecorder(buffer))
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := time.Date(2026, 3, 14, 10, 0, 0, 0, time.UTC)
+	for range 2 {
+		if err := e.emit(context.Background(), at); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	items, _, _ := buffer.After(context.Background(), 0, 0, nil)
+	if len(items) != 2 {
+		t.Fatalf("expected two emitted records, got %d", len(items))
+	}
+	p := items[1].Payload
+	if items[1].EventType != "heartbeat" || p["run"] != "2" || p["at"] != "2026-03-14T10:00:00Z" || items[1].Source != "cron:demo" {
+		t.Errorf("unexpected emitted record %+v", items[1])
+	}
+	if tags, _ := p["tags"].([]any); len(tags) != 2 || tags[0] != "demo" || tags[1] != 3.0 {
+		t.Errorf("expected templates rendered inside arrays, got %v", p["tags"])
+	}
+	if id, _ := p["id"].(string); len(id) != 36 || id == items[0].Payload["id"] {
+		t.Errorf("expected a fresh uuid per run, got %q", id)
+	}
+	if forwarded["event"] != "heartbeat" {
+		t.Errorf("expected the webhook forwarded, got %v", forwarded)
+	}
+	if s := e.Status(); s.Emitted != 2 || s.LastError != "" {
+		t.Errorf("unexpected status %+v", s)
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"time"
+)
+
+const (
+	// subscriptionMaxAttempts is how many times in a row a push subscription
+	// tries a record by default before dead-lettering it.
+	subscriptionMaxAttempts = 10
+	// deadLetterSize bounds the dead-letter queue, dropping the oldest.
+	deadLetterSize = 1000
+)
+
+var errDeadLetterNotFound = errors.New("dead letter not found")
+
+// DeadLetter is a record a push subscription gave up delivering after
+// Attempts failed attempts in a row. It keeps a copy of the record, so it
+// can be requeued even once the record has left the buffer.
+type DeadLetter struct {
+	ID           string    `json:"id"`
+	Subscription string    `json:"subscription"`
+	URL          string    `json:"url"`
+	RecordID     string    `json:"record_id"`
+	Sequence     uint64    `json:"sequence"`
+	EventType    string    `json:"event_type,omitempty"`
+	Attempts     int       `json:"attempts"`
+	LastError    string    `json:"last_error"`
+	FailedAt     time.Time `json:"failed_at"`
+
+	item WebhookParams
+}
+
+// deadLetter gives up on item, which sub failed to deliver Failures times
+// in a row, and moves sub on to its next record. s.mu must be held.
+func (s *Subscriptions) deadLetter(sub *subscription, item WebhookParams, requeued bool) {
+	s.deadLetters = append(s.deadLetters, DeadLetter{
+		ID:           newRecordID(),
+		Subscription: sub.ID,
+		URL:          sub.URL,
+		RecordID:     item.ID,
+		Sequence:     item.Sequence,
+		EventType:    item.EventType,
+		Attempts:     sub.Failures,
+		LastError:    sub.LastError,
+		FailedAt:     time.Now().UTC(),
+		item:         item,
+	})
+	if over := len(s.deadLetters) - deadLetterSize; over > 0 {
+		s.deadLetters = slices.Delete(s.deadLetters, 0, over)
+	}
+	if requeued {
+		sub.requeued = sub.requeued[1:]
+	} else {
+		sub.Acked = max(sub.Acked, item.Sequence)
+	}
+	sub.DeadLettered++
+	sub.Failures = 0
+}
+
+// DeadLetters returns the dead-letter queue, newest first, only the
+// records of subscription id if it is set.
+func (s *Subscriptions) DeadLetters(id string) []DeadLetter {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	letters := []DeadLetter{}
+	for i := len(s.deadLetters) - 1; i >= 0; i-- {
+		if id == "" || s.deadLetters[i].Subscription == id {
+			letters = append(letters, s.deadLetters[i])
+		}
+	}
+	return letters
+}
+
+// Requeue takes the dead letter id off the queue and hands its record back
+// to its subscription, which delivers it before its other pending records.
+func (s *Subscriptions) Requeue(id string) (DeadLetter, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := slices.IndexFunc(s.deadLetters, func(l DeadLetter) bool { return l.ID == id })
+	if i < 0 {
+		return DeadLetter{}, errDeadLetterNotFound
+	}
+	letter := s.deadLetters[i]
+	sub, ok := s.subs[letter.Subscription]
+	if !ok {
+		return letter, errSubscriptionNotFound
+	}
+	s.deadLetters = slices.Delete(s.deadLetters, i, i+1)
+	sub.requeued = append(sub.requeued, letter.item)
+	select {
+	case sub.wake <- struct{}{}:
+	default:
+	}
+	return letter, nil
+}
+
+func deadLettersHandler(subs *Subscriptions) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(subs.DeadLetters(r.URL.Query().Get("subscription")))
+	}
+}
+
+// requeueHandler serves POST /deadletter/{id}/requeue, which delivers a
+// dead-lettered record again once its target has been fixed.
+func requeueHandler(subs *Subscriptions) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		letter, err := subs.Requeue(r.PathValue("id"))
+		switch {
+		case errors.Is(err, errDeadLetterNotFound):
+			writeProblem(w, r, http.StatusNotFound, codeNotFound, "No dead letter with id "+r.PathValue("id"))
+			return
+		case errors.Is(err, errSubscriptionNotFound):
+			writeProblem(w, r, http.StatusConflict, codeConflict, "Subscription "+letter.Subscription+" was deleted")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(letter)
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDeadLetterAndRequeue(t *testing.T) {
+	var mu sync.Mutex
+	var delivered []string
+	broken := true
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		defer mu.Unlock()
+		if broken && strings.Contains(string(body), "bad") {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		delivered = append(delivered, r.Header.Get("X-Echo-Sequence"))
+	}))
+	defer target.Close()
+
+	mux, _, subs := newSubscriptionServer(10)
+	sub := createSubscription(t, mux, `{"url":"`+target.URL+`","max_attempts":2}`)
+	defer subs.Delete(sub.ID)
+	postWebhook(t, mux, `{"event":"bad"}`)
+	postWebhook(t, mux, `{"event":"good"}`)
+	waitFor(t, func() bool { s, _ := subs.Get(sub.ID); return s.Acked == 2 })
+
+	var letters []DeadLetter
+	json.NewDecoder(subscriptionRequest(t, mux, http.MethodGet, "/deadletter?subscription="+sub.ID, "").Body).Decode(&letters)
+	if len(letters) != 1 || letters[0].Sequence != 1 || letters[0].Attempts != 2 || letters[0].LastError == "" {
+		t.Fatalf("expected the bad record dead-lettered after 2 attempts, got %+v", letters)
+	}
+	if s, _ := subs.Get(sub.ID); s.DeadLettered != 1 || s.Failures != 0 {
+		t.Errorf("expected the subscription to count the dead letter, got %+v", s)
+	}
+
+	mu.Lock()
+	broken = false
+	mu.Unlock()
+	if rec := subscriptionRequest(t, mux, http.MethodPost, "/deadletter/"+letters[0].ID+"/requeue", ""); rec.Code != http.StatusAccepted {
+		t.Fatalf("expected requeue to be accepted, got %d", rec.Code)
+	}
+	waitFor(t, func() bool { mu.Lock(); defer mu.Unlock(); return len(delivered) == 2 })
+	mu.Lock()
+	if strings.Join(delivered, ",") != "2,1" {
+		t.Errorf("expected the requeued record delivered after the good one, got %v", delivered)
+	}
+	mu.Unlock()
+	if rec := subscriptionRequest(t, mux, http.MethodPost, "/deadletter/"+letters[0].ID+"/requeue", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("expected a requeued letter to leave the queue, got %d", rec.Code)
+	}
+}
+
+func TestSubscriptionMaxAttemptsNeedsPush(t *testing.T) {
+	mux, _, _ := newSubscriptionServer(10)
+	if rec := subscriptionRequest(t, mux, http.MethodPost, "/subscriptions", `{"max_attempts":3}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("expected max_attempts on a pull subscription to be refused, got %d", rec.Code)
+	}
+}
+
+func waitFor(t *testing.T, done func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !done() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
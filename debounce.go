@@ -0,0 +1,193 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// debounceRules coalesces bursts of webhooks when configured; nil stores
+// every delivery.
+var debounceRules *Debouncer
+
+// DebounceRule coalesces webhooks matching it, as a drop rule matches, that
+// share the payload value at Key, a field name or dotted path such as
+// "sku" or "item.sku". A delivery within Window of the previous one with
+// the same value replaces its record, so that a burst keeps only its
+// latest webhook.
+type DebounceRule struct {
+	DropRule
+	Key    string `json:"key"`
+	Window string `json:"window"`
+}
+
+// LoadDebounceRules reads a JSON array of debounce rules from path.
+func LoadDebounceRules(path string) ([]DebounceRule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var rules []DebounceRule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return rules, nil
+}
+
+// Coalescing describes the burst a record stands for.
+type Coalescing struct {
+	Rule string `json:"rule"`
+	// Key is the value the burst's webhooks share.
+	Key string `json:"key"`
+	// Count is how many deliveries the burst had so far, this one included.
+	Count           int       `json:"count"`
+	FirstReceivedAt time.Time `json:"first_received_at"`
+}
+
+// debounceBurst is the latest record of a burst.
+type debounceBurst struct {
+	id          string
+	count       int
+	first, last time.Time
+}
+
+type debounceState struct {
+	*dropState
+	key       string
+	window    time.Duration
+	bursts    map[string]*debounceBurst
+	lastSweep time.Time
+	coalesced int
+}
+
+// Debouncer stores webhooks matching its rules through Record, replacing
+// the previous record of a burst.
+type Debouncer struct {
+	mu    sync.Mutex
+	rules []*debounceState
+	now   func() time.Time
+}
+
+func NewDebouncer(rules []DebounceRule) (*Debouncer, error) {
+	d := &Debouncer{now: time.Now}
+	for _, rule := range rules {
+		if rule.Name == "" {
+			return nil, errors.New("debounce rule without name")
+		}
+		if rule.Key == "" {
+			return nil, fmt.Errorf("debounce rule %s: key is required", rule.Name)
+		}
+		window, err := time.ParseDuration(rule.Window)
+		if err != nil || window <= 0 {
+			return nil, fmt.Errorf("debounce rule %s: window must be a positive duration, got %q", rule.Name, rule.Window)
+		}
+		state, err := newDropState("debounce", rule.DropRule)
+		if err != nil {
+			return nil, err
+		}
+		d.rules = append(d.rules, &debounceState{
+			dropState: state,
+			key:       rule.Key,
+			window:    window,
+			bursts:    make(map[string]*debounceBurst),
+		})
+	}
+	return d, nil
+}
+
+// Record stores item, parsed from r, with recorder. Under the first rule
+// it matches and has the key of, it is marked with its burst and the
+// burst's previous record, if still in the buffer, is dropped.
+func (d *Debouncer) Record(recorder *Recorder, r *http.Request, item WebhookParams, body []byte) (stored WebhookParams, duplicate bool) {
+	var s *debounceState
+	var key string
+	for _, rule := range d.rules {
+		if v, ok := payloadValue(item.Payload, rule.key); ok && rule.matches(r, item) {
+			s, key = rule, valueString(v)
+			break
+		}
+	}
+	if s == nil {
+		return recorder.Record(item, body)
+	}
+
+	// Held while storing, so that a burst's deliveries replace each other
+	// in the order they are stored.
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	now := d.now()
+	if now.Sub(s.lastSweep) > s.window {
+		for k, b := range s.bursts {
+			if now.Sub(b.last) > s.window {
+				delete(s.bursts, k)
+			}
+		}
+		s.lastSweep = now
+	}
+	prev := s.bursts[key]
+	if prev != nil && now.Sub(prev.last) > s.window {
+		prev = nil
+	}
+	item.Coalesced = &Coalescing{Rule: s.rule.Name, Key: key, Count: 1, FirstReceivedAt: now.UTC()}
+	if prev != nil {
+		item.Coalesced.Count, item.Coalesced.FirstReceivedAt = prev.count+1, prev.first.UTC()
+	}
+	stored, duplicate = recorder.Record(item, body)
+	if duplicate || stored.ID == "" {
+		return stored, duplicate
+	}
+	if prev != nil {
+		// The buffer may have evicted it already, which is as good.
+		if n, _ := recorder.buffer.deleteAs(lifecycleCoalesced, map[string]bool{prev.id: true}); n > 0 {
+			s.coalesced++
+		}
+	}
+	s.bursts[key] = &debounceBurst{id: stored.ID, count: item.Coalesced.Count, first: item.Coalesced.FirstReceivedAt, last: now}
+	return stored, duplicate
+}
+
+type DebounceRuleStatus struct {
+	DebounceRule
+	// Coalesced counts the records replaced by a later delivery.
+	Coalesced int `json:"coalesced"`
+	// Bursts is how many keys have a burst in progress.
+	Bursts int `json:"bursts"`
+}
+
+type DebounceReport struct {
+	Coalesced int                  `json:"coalesced"`
+	Rules     []DebounceRuleStatus `json:"rules"`
+}
+
+func (d *Debouncer) Report() DebounceReport {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := d.now()
+	report := DebounceReport{Rules: make([]DebounceRuleStatus, 0, len(d.rules))}
+	for _, s := range d.rules {
+		status := DebounceRuleStatus{
+			DebounceRule: DebounceRule{DropRule: s.rule, Key: s.key, Window: s.window.String()},
+			Coalesced:    s.coalesced,
+		}
+		for _, b := range s.bursts {
+			if now.Sub(b.last) <= s.window {
+				status.Bursts++
+			}
+		}
+		report.Coalesced += s.coalesced
+		report.Rules = append(report.Rules, status)
+	}
+	return report
+}
+
+func debounceRulesHandler(d *Debouncer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(d.Report())
+	}
+}
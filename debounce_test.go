@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestDebounceKeepsLastOfBurst(t *testing.T) {
+	d, err := NewDebouncer([]DebounceRule{{
+		DropRule: DropRule{Name: "inventory", EventType: "inventory.*"},
+		Key:      "sku",
+		Window:   "2s",
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	d.now = func() time.Time { return now }
+	debounceRules = d
+	t.Cleanup(func() { debounceRules = nil })
+	mux := newTestServer()
+
+	for i := 1; i <= 20; i++ {
+		postWebhook(t, mux, fmt.Sprintf(`{"event":"inventory.updated","data":{"sku":"A-1","stock":%d}}`, i))
+		now = now.Add(500 * time.Millisecond)
+	}
+	postWebhook(t, mux, `{"event":"inventory.updated","data":{"sku":"B-2","stock":1}}`)
+	postWebhook(t, mux, `{"event":"inventory.updated","data":{"stock":1}}`)
+
+	items := queryWebhooks(t, mux, "/query/inventory.updated")
+	if len(items) != 3 {
+		t.Fatalf("expected one record per burst and the keyless one, got %d", len(items))
+	}
+	if items[0].Coalesced != nil {
+		t.Errorf("expected the webhook without a key left alone, got %+v", items[0].Coalesced)
+	}
+	if c := items[1].Coalesced; c == nil || c.Key != "B-2" || c.Count != 1 {
+		t.Errorf("unexpected coalescing of B-2: %+v", c)
+	}
+	last := items[2]
+	if c := last.Coalesced; c == nil || c.Rule != "inventory" || c.Count != 20 || !c.FirstReceivedAt.Equal(time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected coalescing of A-1: %+v", c)
+	}
+	if last.Payload["stock"] != 20.0 {
+		t.Errorf("expected the last delivery kept, got %v", last.Payload)
+	}
+
+	// After a quiet window the next delivery starts a new burst.
+	now = now.Add(3 * time.Second)
+	postWebhook(t, mux, `{"event":"inventory.updated","data":{"sku":"A-1","stock":0}}`)
+	if items := queryWebhooks(t, mux, "/query/inventory.updated?sku=A-1"); len(items) != 2 || items[0].Coalesced.Count != 1 {
+		t.Errorf("expected a new burst, got %+v", items)
+	}
+
+	report := d.Report()
+	if report.Coalesced != 19 || report.Rules[0].Window != "2s" || report.Rules[0].Bursts != 1 {
+		data, _ := json.Marshal(report)
+		t.Errorf("unexpected report %s", data)
+	}
+}
+
+func TestInvalidDebounceRules(t *testing.T) {
+	for name, rule := range map[string]DebounceRule{
+		"no name":    {Key: "sku", Window: "1s"},
+		"no key":     {DropRule: DropRule{Name: "x"}, Window: "1s"},
+		"bad window": {DropRule: DropRule{Name: "x"}, Key: "sku", Window: "soon"},
+		"no window":  {DropRule: DropRule{Name: "x"}, Key: "sku"},
+		"bad glob":   {DropRule: DropRule{Name: "x", EventType: "["}, Key: "sku", Window: "1s"},
+	} {
+		if _, err := NewDebouncer([]DebounceRule{rule}); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
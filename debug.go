@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"time"
+)
+
+var startTime = time.Now()
+
+type bufferVars struct {
+	Count int `json:"count"`
+	Size  int `json:"size"`
+}
+
+type gcVars struct {
+	NumGC        uint32 `json:"num_gc"`
+	PauseTotalNs uint64 `json:"pause_total_ns"`
+	LastGC       string `json:"last_gc,omitempty"`
+	HeapAlloc    uint64 `json:"heap_alloc"`
+	HeapObjects  uint64 `json:"heap_objects"`
+	Sys          uint64 `json:"sys"`
+}
+
+type debugVars struct {
+	Uptime     string     `json:"uptime"`
+	Goroutines int        `json:"goroutines"`
+	Buffer     bufferVars `json:"buffer"`
+	GC         gcVars     `json:"gc"`
+	// Queues are the depths of the queues that are configured, by name.
+	Queues map[string]int `json:"queues"`
+}
+
+// queuedHook is implemented by ingest hooks that hand records to background
+// workers, so /debug/vars can show how far behind they are.
+type queuedHook interface {
+	QueueName() string
+	QueueDepth() int
+}
+
+// queueDepths reports the ingest queues in use: the parser pool, the
+// webhooks in flight under priority lanes, the bursts debounce rules hold
+// open, and the delivery queues of hooks.
+func queueDepths(hooks []IngestHook) map[string]int {
+	queues := make(map[string]int)
+	if parserPool != nil {
+		queues["parser"] = parserPool.Status().Queued
+	}
+	if priorityLanes != nil {
+		queues["priority_inflight"] = int(priorityLanes.Report().InFlight)
+	}
+	if debounceRules != nil {
+		bursts := 0
+		for _, rule := range debounceRules.Report().Rules {
+			bursts += rule.Bursts
+		}
+		queues["debounce_bursts"] = bursts
+	}
+	for _, hook := range hooks {
+		if q, ok := hook.(queuedHook); ok {
+			queues[q.QueueName()] += q.QueueDepth()
+		}
+	}
+	return queues
+}
+
+func debugVarsHandler(buffer *RingBuffer, hooks []IngestHook) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var mem runtime.MemStats
+		runtime.ReadMemStats(&mem)
+
+		vars := debugVars{
+			Uptime:     time.Since(startTime).Round(time.Second).String(),
+			Goroutines: runtime.NumGoroutine(),
+			Buffer: bufferVars{
+				Count: buffer.Len(),
+				Size:  buffer.Cap(),
+			},
+			GC: gcVars{
+				NumGC:        mem.NumGC,
+				PauseTotalNs: mem.PauseTotalNs,
+				HeapAlloc:    mem.HeapAlloc,
+				HeapObjects:  mem.HeapObjects,
+				Sys:          mem.Sys,
+			},
+			Queues: queueDepths(hooks),
+		}
+		if mem.LastGC > 0 {
+			vars.GC.LastGC = time.Unix(0, int64(mem.LastGC)).UTC().Format(time.RFC3339)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(vars)
+	}
+}
+
+// registerDebugRoutes mounts pprof and runtime introspection endpoints behind
+// admin auth. /debug/vars reports the queue depths of hooks.
+func registerDebugRoutes(mux *http.ServeMux, buffer *RingBuffer, adminToken string, hooks ...IngestHook) {
+	guard := func(h http.HandlerFunc) http.Handler {
+		return requireAdmin(adminToken, h)
+	}
+
+	mux.Handle("GET /debug/vars", guard(debugVarsHandler(buffer, hooks)))
+	mux.Handle("GET /debug/pprof/", guard(pprof.Index))
+	mux.Handle("GET /debug/pprof/cmdline", guard(pprof.Cmdline))
+	mux.Handle("GET /debug/pprof/profile", guard(pprof.Profile))
+	mux.Handle("GET /debug/pprof/symbol", guard(pprof.Symbol))
+	mux.Handle("POST /debug/pprof/symbol", guard(pprof.Symbol))
+	mux.Handle("GET /debug/pprof/trace", guard(pprof.Trace))
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func newDebugTestServer(adminToken string) *http.ServeMux {
+	buffer := NewRingBuffer(10)
+	buffer.Push(WebhookParams{EventType: "test"})
+	mux := http.NewServeMux()
+	registerDebugRoutes(mux, buffer, adminToken)
+	return mux
+}
+
+func TestDebugVarsRequiresAdminToken(t *testing.T) {
+	mux := newDebugTestServer("secret")
+
+	req := httptest.NewRequest(http.MethodGet, "/debug/vars", nil)
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected status 401 without token, got %d", rec.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/debug/vars", nil)
+	req.Header.Set("Authorization", "Bearer wrong")
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected status 401 with wrong token, got %d", rec.Code)
+	}
+}
+
+func TestDebugVarsRefusedWithoutConfiguredToken(t *testing.T) {
+	mux := newDebugTestServer("")
+
+	req := httptest.NewRequest(http.MethodGet, "/debug/pprof/", nil)
+	req.Header.Set("Authorization", "Bearer ")
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("expected status 403, got %d", rec.Code)
+	}
+}
+
+func TestDebugVarsReportsBufferOccupancy(t *testing.T) {
+	mux := newDebugTestServer("secret")
+
+	req := httptest.NewRequest(http.MethodGet, "/debug/vars", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rec.Code)
+	}
+
+	var vars debugVars
+	if err := json.Unmarshal(rec.Body.Bytes(), &vars); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	if vars.Buffer.Count != 1 || vars.Buffer.Size != 10 {
+		t.Errorf("expected buffer 1/10, got %d/%d", vars.Buffer.Count, vars.Buffer.Size)
+	}
+	if vars.Goroutines == 0 {
+		t.Error("expected goroutine count to be reported")
+	}
+}
+
+func TestDebugVarsReportsQueueDepths(t *testing.T) {
+	buffer := NewRingBuffer(10)
+	subs := NewSubscriptions(buffer, http.DefaultClient)
+	if _, err := subs.Create(SubscriptionRequest{From: "earliest"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := subs.Create(SubscriptionRequest{From: "earliest", Match: json.RawMessage(`{"event_type":"b"}`)}); err != nil {
+		t.Fatal(err)
+	}
+	buffer.Push(WebhookParams{EventType: "a"})
+	buffer.Push(WebhookParams{EventType: "b"})
+	mux := http.NewServeMux()
+	registerDebugRoutes(mux, buffer, "secret", subs)
+
+	req := httptest.NewRequest(http.MethodGet, "/debug/vars", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	var vars debugVars
+	if err := json.Unmarshal(rec.Body.Bytes(), &vars); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	if depth, ok := vars.Queues["subscriptions"]; !ok || depth != 3 {
+		t.Errorf("expected 2 records queued for one subscription and 1 for the filtered one, got %v", vars.Queues)
+	}
+	if _, ok := vars.Queues["parser"]; ok {
+		t.Errorf("expected no parser queue without a parser pool, got %v", vars.Queues)
+	}
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Subdirectories of a drop folder that ingested files are moved to.
+const (
+	dropProcessedDir = "processed"
+	dropFailedDir    = "failed"
+)
+
+// dropContentTypes maps file extensions to the content type the file is
+// parsed as. Other extensions are looked up with mime.TypeByExtension and
+// ingested when that names a registered body format.
+var dropContentTypes = map[string]string{
+	".json": "application/json",
+	".xml":  "application/xml",
+}
+
+type dropFileState struct {
+	size    int64
+	modTime time.Time
+}
+
+// DropFolder records files dropped into a directory as webhooks, for
+// partners that deliver events by uploading files. It polls rather than
+// watches, and only ingests a file once its size and modification time have
+// been the same for two scans, so files still being written are left alone;
+// dotfiles and .tmp, .part and .filepart files never are. Ingested files move
+// to processed/, prefixed with the record's ID, and unparseable ones to
+// failed/ with the error next to them in a .error file.
+//
+// There is no SFTP client: point the folder at the upload directory of an
+// SFTP server running on the same host instead.
+type DropFolder struct {
+	dir      string
+	interval time.Duration
+	recorder *Recorder
+	pending  map[string]dropFileState
+}
+
+func NewDropFolder(dir string, interval time.Duration, recorder *Recorder) (*DropFolder, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, sub := range []string{dropProcessedDir, dropFailedDir} {
+		if err := os.MkdirAll(filepath.Join(abs, sub), 0o755); err != nil {
+			return nil, err
+		}
+	}
+	return &DropFolder{dir: abs, interval: interval, recorder: recorder, pending: make(map[string]dropFileState)}, nil
+}
+
+// Run scans the folder every interval until ctx is cancelled.
+func (d *DropFolder) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+	for {
+		d.scan()
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (d *DropFolder) scan() {
+	entries, err := os.ReadDir(d.dir)
+	if err != nil {
+		log.Printf("Drop folder: %v", err)
+		return
+	}
+	present := make(map[string]bool, len(entries))
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.Type().IsRegular() || strings.HasPrefix(name, ".") || dropPartial(name) {
+			continue
+		}
+		contentType := dropContentType(name)
+		if contentType == "" {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		present[name] = true
+		state := dropFileState{size: info.Size(), modTime: info.ModTime()}
+		if prev, ok := d.pending[name]; !ok || prev != state {
+			d.pending[name] = state
+			continue
+		}
+		delete(d.pending, name)
+		d.ingest(name, contentType, info)
+	}
+	for name := range d.pending {
+		if !present[name] {
+			delete(d.pending, name)
+		}
+	}
+}
+
+func dropPartial(name string) bool {
+	for _, suffix := range []string{".tmp", ".part", ".filepart"} {
+		if strings.HasSuffix(strings.ToLower(name), suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+func dropContentType(name string) string {
+	ext := strings.ToLower(filepath.Ext(name))
+	if ct := dropContentTypes[ext]; ct != "" {
+		return ct
+	}
+	if ct := mime.TypeByExtension(ext); ct != "" && lookupFormat(ct) != nil {
+		return ct
+	}
+	return ""
+}
+
+func (d *DropFolder) ingest(name, contentType string, info os.FileInfo) {
+	path := filepath.Join(d.dir, name)
+	stored, err := d.record(path, contentType, info)
+	if err != nil {
+		log.Printf("Drop folder: %s: %v", name, err)
+		failed := filepath.Join(d.dir, dropFailedDir, name)
+		if err := os.Rename(path, failed); err != nil {
+			log.Printf("Drop folder: %v", err)
+			return
+		}
+		os.WriteFile(failed+".error", []byte(err.Error()+"\n"), 0o644)
+		return
+	}
+	// While capture is paused nothing is stored, and the file stays for
+	// when it resumes.
+	if stored.ID == "" {
+		return
+	}
+	if err := os.Rename(path, filepath.Join(d.dir, dropProcessedDir, stored.ID+"-"+name)); err != nil {
+		log.Printf("Drop folder: %v", err)
+	}
+}
+
+func (d *DropFolder) record(path, contentType string, info os.FileInfo) (WebhookParams, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return WebhookParams{}, err
+	}
+	defer f.Close()
+	limit := int64(maxDecompressedSize)
+	if maxBodySize > 0 {
+		limit = maxBodySize
+	}
+	raw, err := io.ReadAll(io.LimitReader(f, limit+1))
+	if err != nil {
+		return WebhookParams{}, err
+	}
+	if int64(len(raw)) > limit {
+		return WebhookParams{}, fmt.Errorf("larger than %d bytes", limit)
+	}
+
+	normalize := normalizeBody
+	if format := lookupFormat(contentType); format != nil && format.Binary {
+		normalize = gunzipBody
+	}
+	body, encoding, err := normalize(raw, contentType)
+	if err != nil {
+		return WebhookParams{}, err
+	}
+	item, err := parseWebhook(body, contentType)
+	if err != nil {
+		var pe *paramError
+		if errors.As(err, &pe) {
+			return WebhookParams{}, errors.New(pe.detail)
+		}
+		return WebhookParams{}, err
+	}
+
+	// The file's metadata is kept as the headers it would have been served
+	// with.
+	clearServerFields(&item)
+	item.Headers = http.Header{
+		"Content-Type":        {contentType},
+		"Content-Length":      {strconv.FormatInt(info.Size(), 10)},
+		"Content-Disposition": {mime.FormatMediaType("attachment", map[string]string{"filename": info.Name()})},
+		"Last-Modified":       {info.ModTime().UTC().Format(http.TimeFormat)},
+	}
+	item.Source = "file://" + filepath.ToSlash(path)
+	item.ContentType, item.Raw = contentType, raw
+	item.Encoding, item.SniffedType = encoding, sniffedType(raw, contentType)
+	stored, _ := d.recorder.Record(item, body)
+	return stored, nil
+}
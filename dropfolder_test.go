@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDropFolder(t *testing.T) {
+	dir := t.TempDir()
+	buffer := NewRingBuffer(10)
+	d, err := NewDropFolder(dir, 0, NewRecorder(buffer))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"order.json":       `{"event": "order.created", "data": {"id": 1}}`,
+		"invoice.xml":      `<invoice><id>2</id></invoice>`,
+		"broken.json":      `{"event":`,
+		"upload.json.part": `{"event": "partial"}`,
+		"notes.txt":        "not an event",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	d.scan()
+	if items, _, _ := buffer.After(context.Background(), 0, 0, nil); len(items) != 0 {
+		t.Fatalf("expected files to be left alone until they are stable, got %d records", len(items))
+	}
+	d.scan()
+	items, _, _ := buffer.After(context.Background(), 0, 0, nil)
+	if len(items) != 2 {
+		t.Fatalf("expected two records, got %+v", items)
+	}
+	events := map[string]WebhookParams{}
+	for _, item := range items {
+		events[item.EventType] = item
+	}
+	order, ok := events["order.created"]
+	if invoice, _ := events["invoice"].Payload["invoice"].(map[string]any); !ok || invoice["id"] != "2" {
+		t.Fatalf("expected the JSON and XML files parsed, got %+v", events)
+	}
+	if order.Source != "file://"+filepath.ToSlash(filepath.Join(dir, "order.json")) || !strings.Contains(order.Headers.Get("Content-Disposition"), "order.json") || order.Headers.Get("Last-Modified") == "" {
+		t.Errorf("expected the file name and metadata captured, got %q %v", order.Source, order.Headers)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, dropProcessedDir, order.ID+"-order.json")); err != nil {
+		t.Errorf("expected order.json moved to processed: %v", err)
+	}
+	if b, err := os.ReadFile(filepath.Join(dir, dropFailedDir, "broken.json.error")); err != nil || !strings.HasPrefix(string(b), "Invalid JSON") {
+		t.Errorf("expected broken.json moved to failed with its error, got %q %v", b, err)
+	}
+	for _, name := range []string{"upload.json.part", "notes.txt"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("expected %s left in place: %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"sync"
+)
+
+// dropRules holds the ingest drop rules when configured; nil stores
+// everything.
+var dropRules *DropRules
+
+// DropRule matches webhooks that are acknowledged but not stored, such as
+// health-check pings. Path and EventType are globs, Headers maps header names
+// to globs their value must match, and Match is a payload filter with the
+// same parameters as /query. Every condition given must hold.
+type DropRule struct {
+	Name      string            `json:"name"`
+	Path      string            `json:"path,omitempty"`
+	EventType string            `json:"event_type,omitempty"`
+	Headers   map[string]string `json:"headers,omitempty"`
+	Match     json.RawMessage   `json:"match,omitempty"`
+}
+
+// LoadDropRules reads a JSON array of drop rules from path.
+func LoadDropRules(path string) ([]DropRule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var rules []DropRule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return rules, nil
+}
+
+type dropState struct {
+	rule    DropRule
+	filter  *QueryFilter
+	dropped int
+}
+
+// DropRules decides which webhooks to drop and counts them per rule.
+type DropRules struct {
+	mu    sync.Mutex
+	rules []*dropState
+}
+
+func NewDropRules(rules []DropRule) (*DropRules, error) {
+	d := &DropRules{}
+	for _, rule := range rules {
+		if rule.Name == "" {
+			return nil, errors.New("drop rule without name")
+		}
+		if rule.Path == "" && rule.EventType == "" && len(rule.Headers) == 0 && len(rule.Match) == 0 {
+			return nil, fmt.Errorf("drop rule %s: needs at least one of path, event_type, headers or match", rule.Name)
+		}
+		state, err := newDropState("drop", rule)
+		if err != nil {
+			return nil, err
+		}
+		d.rules = append(d.rules, state)
+	}
+	return d, nil
+}
+
+// newDropState compiles the conditions of rule, which other kinds of rule
+// share, naming the kind in errors.
+func newDropState(kind string, rule DropRule) (*dropState, error) {
+	globs := []string{rule.Path, rule.EventType}
+	for _, glob := range rule.Headers {
+		globs = append(globs, glob)
+	}
+	for _, glob := range globs {
+		if _, err := path.Match(glob, ""); err != nil {
+			return nil, fmt.Errorf("%s rule %s: invalid pattern %q", kind, rule.Name, glob)
+		}
+	}
+
+	state := &dropState{rule: rule}
+	if len(rule.Match) > 0 {
+		params, err := decodeParams(rule.Match)
+		if err != nil {
+			return nil, fmt.Errorf("%s rule %s: match: %w", kind, rule.Name, err)
+		}
+		filter, err := parseQueryFilter(params, "")
+		if err != nil {
+			return nil, fmt.Errorf("%s rule %s: match: %w", kind, rule.Name, err)
+		}
+		state.filter = &filter
+	}
+	return state, nil
+}
+
+// Drop returns the name of the first rule matching the request and its
+// parsed webhook, counting the drop, or "" to store it.
+func (d *DropRules) Drop(r *http.Request, item WebhookParams) string {
+	for _, s := range d.rules {
+		if !s.matches(r, item) {
+			continue
+		}
+		d.mu.Lock()
+		s.dropped++
+		d.mu.Unlock()
+		return s.rule.Name
+	}
+	return ""
+}
+
+func (s *dropState) matches(r *http.Request, item WebhookParams) bool {
+	if !globMatch(s.rule.Path, r.URL.Path) || !globMatch(s.rule.EventType, item.EventType) {
+		return false
+	}
+	for name, glob := range s.rule.Headers {
+		if !globMatch(glob, r.Header.Get(name)) {
+			return false
+		}
+	}
+	return s.filter == nil || s.filter.Match(item)
+}
+
+// globMatch reports whether value matches pattern, an empty pattern
+// matching anything.
+func globMatch(pattern, value string) bool {
+	if pattern == "" {
+		return true
+	}
+	ok, _ := path.Match(pattern, value)
+	return ok
+}
+
+type DropRuleStatus struct {
+	DropRule
+	Dropped int `json:"dropped"`
+}
+
+type DropReport struct {
+	Dropped int              `json:"dropped"`
+	Rules   []DropRuleStatus `json:"rules"`
+}
+
+func (d *DropRules) Report() DropReport {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	report := DropReport{Rules: make([]DropRuleStatus, 0, len(d.rules))}
+	for _, s := range d.rules {
+		report.Dropped += s.dropped
+		report.Rules = append(report.Rules, DropRuleStatus{DropRule: s.rule, Dropped: s.dropped})
+	}
+	return report
+}
+
+func dropRulesHandler(d *DropRules) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(d.Report())
+	}
+}
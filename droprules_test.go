@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDropRules(t *testing.T) {
+	rules, err := NewDropRules([]DropRule{
+		{Name: "probes", Path: "/health*"},
+		{Name: "kube", Headers: map[string]string{"User-Agent": "kube-probe/*"}},
+		{Name: "heartbeats", EventType: "heartbeat.*"},
+		{Name: "test-mode", Match: json.RawMessage(`{"event_type":"order","livemode":"false"}`)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dropRules = rules
+	t.Cleanup(func() { dropRules = nil })
+
+	mux := newTestServer()
+	post := func(path, userAgent, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		if userAgent != "" {
+			req.Header.Set("User-Agent", userAgent)
+		}
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec
+	}
+	tests := []struct {
+		path, userAgent, body, rule string
+	}{
+		{"/healthz", "", `{"event":"order","data":{}}`, "probes"},
+		{"/", "kube-probe/1.29", `{"event":"order","data":{}}`, "kube"},
+		{"/", "", `{"event":"heartbeat.ping","data":{}}`, "heartbeats"},
+		{"/", "", `{"event":"order","data":{"livemode":false}}`, "test-mode"},
+		{"/", "curl/8.0", `{"event":"order","data":{"livemode":true}}`, ""},
+	}
+	for _, tt := range tests {
+		rec := post(tt.path, tt.userAgent, tt.body)
+		if rec.Code != http.StatusOK || rec.Header().Get("X-Echo-Dropped") != tt.rule || (rec.Header().Get("X-Echo-Id") == "") != (tt.rule != "") {
+			t.Errorf("%s %s: expected rule %q, got %d %v", tt.path, tt.body, tt.rule, rec.Code, rec.Header())
+		}
+	}
+	if got := queryWebhooks(t, mux, "/query/order"); len(got) != 1 {
+		t.Errorf("expected only the live order stored, got %d", len(got))
+	}
+
+	report := dropRules.Report()
+	if report.Dropped != 4 || report.Rules[0].Dropped != 1 || report.Rules[3].Name != "test-mode" {
+		t.Errorf("unexpected drop report %+v", report)
+	}
+}
+
+func TestNewDropRulesErrors(t *testing.T) {
+	for _, rule := range []DropRule{
+		{Path: "/health"},
+		{Name: "empty"},
+		{Name: "glob", EventType: "["},
+		{Name: "match", Match: json.RawMessage(`{"status":"ok"}`)},
+	} {
+		if _, err := NewDropRules([]DropRule{rule}); err == nil {
+			t.Errorf("%+v: expected an error", rule)
+		}
+	}
+}
+
+func TestLoadDropRules(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "drop.json")
+	os.WriteFile(path, []byte(`[{"name":"probes","path":"/health*","headers":{"X-Probe":"*"}}]`), 0o644)
+	rules, err := LoadDropRules(path)
+	if err != nil || len(rules) != 1 || rules[0].Headers["X-Probe"] != "*" {
+		t.Errorf("unexpected rules %+v (%v)", rules, err)
+	}
+}
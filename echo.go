@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Echo modes select how an ingest request is acknowledged.
+const (
+	echoVerbatim  = "verbatim"  // the request body, byte for byte
+	echoCanonical = "canonical" // the body as compact JSON with sorted keys
+	echoEnvelope  = "envelope"  // a summary of the stored record
+	echoEmpty     = "empty"     // 204 No Content
+)
+
+var echoModes = []string{echoVerbatim, echoCanonical, echoEnvelope, echoEmpty}
+
+// echoModeHeader lets a sender pick the echo mode for a single request.
+const echoModeHeader = "X-Echo-Mode"
+
+var echoMode = echoVerbatim
+
+func validEchoMode(mode string) error {
+	for _, m := range echoModes {
+		if mode == m {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown echo mode %q, expected one of %s", mode, strings.Join(echoModes, ", "))
+}
+
+// echoEnvelopeBody is the acknowledgement written in envelope mode.
+type echoEnvelopeBody struct {
+	ID         string    `json:"id,omitempty"`
+	Sequence   uint64    `json:"sequence,omitempty"`
+	Event      string    `json:"event"`
+	ReceivedAt time.Time `json:"received_at"`
+	Deliveries int       `json:"deliveries"`
+	Duplicate  bool      `json:"duplicate"`
+	Recorded   bool      `json:"recorded"`
+	Size       int       `json:"size"`
+}
+
+// canonicalJSON re-encodes body compactly with object keys sorted. Numbers
+// are kept as written.
+func canonicalJSON(body []byte) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	return encodeCanonical(v)
+}
+
+// encodeCanonical encodes v compactly, with object keys sorted and without
+// escaping HTML characters.
+func encodeCanonical(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+// writeEcho acknowledges an ingest request in the given mode. body is the
+// request body normalized to UTF-8, while stored.Raw holds it as received.
+// recorded is false when capture was paused or skipped for the request.
+func writeEcho(w http.ResponseWriter, mode string, body []byte, stored WebhookParams, duplicate, recorded bool) {
+	switch mode {
+	case echoEmpty:
+		w.WriteHeader(http.StatusNoContent)
+	case echoEnvelope:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(echoEnvelopeBody{
+			ID:         stored.ID,
+			Sequence:   stored.Sequence,
+			Event:      stored.EventType,
+			ReceivedAt: stored.ReceivedAt,
+			Deliveries: stored.Deliveries,
+			Duplicate:  duplicate,
+			Recorded:   recorded,
+			Size:       len(stored.Raw),
+		})
+	case echoCanonical:
+		if canonical, err := canonicalJSON(body); err == nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.Write(canonical)
+			return
+		}
+		// Not JSON (e.g. XML): there is no canonical form, echo verbatim.
+		fallthrough
+	default:
+		contentType := "application/json"
+		if lookupFormat(stored.ContentType) != nil {
+			contentType = stored.ContentType
+		}
+		w.Header().Set("Content-Type", contentType)
+		w.Write(stored.Raw)
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func postWithEchoMode(t *testing.T, mux *http.ServeMux, body, mode string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString(body))
+	if mode != "" {
+		req.Header.Set(echoModeHeader, mode)
+	}
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestEchoModes(t *testing.T) {
+	body := `{ "event": "order", "version": "1", "data": {"total": 10.50, "b": 1, "a": "<x>"} }`
+
+	tests := []struct {
+		mode   string
+		status int
+		want   string
+	}{
+		{echoVerbatim, http.StatusOK, body},
+		{echoCanonical, http.StatusOK, `{"data":{"a":"<x>","b":1,"total":10.50},"event":"order","version":"1"}`},
+		{echoEmpty, http.StatusNoContent, ""},
+	}
+	for _, tt := range tests {
+		rec := postWithEchoMode(t, newTestServer(), body, tt.mode)
+		if rec.Code != tt.status || rec.Body.String() != tt.want {
+			t.Errorf("%s: got %d %q, want %d %q", tt.mode, rec.Code, rec.Body.String(), tt.status, tt.want)
+		}
+	}
+}
+
+func TestEchoEnvelope(t *testing.T) {
+	mux := newTestServer()
+	rec := postWithEchoMode(t, mux, `{"event":"order","data":{}}`, echoEnvelope)
+
+	var env echoEnvelopeBody
+	if err := json.NewDecoder(rec.Body).Decode(&env); err != nil {
+		t.Fatal(err)
+	}
+	if env.ID == "" || env.ID != rec.Header().Get("X-Echo-Id") || env.Event != "order" || !env.Recorded || env.Duplicate {
+		t.Errorf("unexpected envelope %+v", env)
+	}
+}
+
+func TestEchoModeDefaultAndValidation(t *testing.T) {
+	echoMode = echoEmpty
+	t.Cleanup(func() { echoMode = echoVerbatim })
+
+	mux := newTestServer()
+	if rec := postWithEchoMode(t, mux, `{"event":"e"}`, ""); rec.Code != http.StatusNoContent {
+		t.Errorf("expected the configured default mode, got %d", rec.Code)
+	}
+	rec := postWithEchoMode(t, mux, `{"event":"e"}`, "yaml")
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400 for an unknown mode, got %d", rec.Code)
+	}
+	if got := queryWebhooks(t, mux, "/query/e"); len(got) != 1 {
+		t.Errorf("expected the rejected request not to be recorded, got %d", len(got))
+	}
+}
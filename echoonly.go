@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+// Server modes: full captures webhooks, echo-only answers them without
+// parsing or storing anything, for load tests where only response behavior
+// matters.
+const (
+	modeFull     = "full"
+	modeEchoOnly = "echo-only"
+)
+
+var serverMode = modeFull
+
+func validServerMode(mode string) error {
+	if mode != modeFull && mode != modeEchoOnly {
+		return fmt.Errorf("unknown mode %q, expected %s or %s", mode, modeFull, modeEchoOnly)
+	}
+	return nil
+}
+
+// echoBuffers holds the copy buffers of echo-only requests.
+var echoBuffers = sync.Pool{New: func() any {
+	b := make([]byte, 32<<10)
+	return &b
+}}
+
+// echoOnlyHandler writes a POSTed body back as it is read, with its content
+// type, through a pooled buffer. It allocates nothing per request itself.
+func echoOnlyHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header()["Allow"] = allowPost
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if ct, ok := r.Header["Content-Type"]; ok {
+		w.Header()["Content-Type"] = ct
+	}
+	buf := echoBuffers.Get().(*[]byte)
+	defer echoBuffers.Put(buf)
+	// io.Copy would hand the body to the ResponseWriter's ReadFrom, which
+	// brings its own buffer.
+	for {
+		n, err := r.Body.Read(*buf)
+		if n > 0 {
+			if _, werr := w.Write((*buf)[:n]); werr != nil {
+				return
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+var allowPost = []string{http.MethodPost}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestEchoOnlyHandler(t *testing.T) {
+	body := `{"event":"order","data":{"id":1}}` + strings.Repeat(" ", 100<<10)
+	req := httptest.NewRequest(http.MethodPost, "/any/path", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	echoOnlyHandler(rec, req)
+	if rec.Code != http.StatusOK || rec.Body.String() != body {
+		t.Errorf("expected the body echoed with 200, got %d and %d bytes", rec.Code, rec.Body.Len())
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("expected the content type echoed, got %q", ct)
+	}
+
+	rec = httptest.NewRecorder()
+	echoOnlyHandler(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusMethodNotAllowed || rec.Header().Get("Allow") != http.MethodPost {
+		t.Errorf("expected GET to be refused, got %d", rec.Code)
+	}
+}
+
+// discardResponse is a ResponseWriter that allocates nothing, so that the
+// benchmarks measure the handlers alone.
+type discardResponse struct{ header http.Header }
+
+func (d *discardResponse) Header() http.Header         { return d.header }
+func (d *discardResponse) Write(b []byte) (int, error) { return len(b), nil }
+func (d *discardResponse) WriteHeader(int)             {}
+
+// benchmarkIngest posts a small webhook to handler, with a Content-Length
+// of size, or -1 for a chunked body.
+func benchmarkIngest(b *testing.B, handler http.HandlerFunc, size int) {
+	payload := []byte(`{"event":"order.created","data":{"id":"ord_1","amount":1299,"currency":"usd","items":[{"sku":"a","qty":2}]}}`)
+	req := httptest.NewRequest(http.MethodPost, "/", nil)
+	req.Header.Set("Content-Type", "application/json")
+	req.ContentLength = int64(min(size, len(payload)))
+	reader := bytes.NewReader(payload)
+	body := io.NopCloser(reader)
+	w := &discardResponse{header: make(http.Header)}
+	b.SetBytes(int64(len(payload)))
+	b.ReportAllocs()
+	for b.Loop() {
+		reader.Reset(payload)
+		req.Body = body
+		clear(w.header)
+		handler(w, req)
+	}
+}
+
+func BenchmarkEchoOnly(b *testing.B) {
+	benchmarkIngest(b, echoOnlyHandler, math.MaxInt)
+}
+
+func BenchmarkFullIngest(b *testing.B) {
+	benchmarkIngest(b, recordWebhookHandler(NewRecorder(NewRingBuffer(1000))), math.MaxInt)
+}
+
+func BenchmarkFullIngestChunked(b *testing.B) {
+	benchmarkIngest(b, recordWebhookHandler(NewRecorder(NewRingBuffer(1000))), -1)
+}
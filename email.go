@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"mime"
+	"net"
+	"net/smtp"
+	"os"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+const (
+	emailModePerEvent = "per_event"
+	emailModeDigest   = "digest"
+
+	defaultDigestInterval = 15 * time.Minute
+
+	defaultEmailSubject = `[webhook-echo] {{if eq (len .Alerts) 1}}{{.Rule}} fired{{else}}{{len .Alerts}} alerts{{end}}`
+	defaultEmailBody    = `{{range .Alerts}}{{.FiredAt.Format "2006-01-02 15:04:05 MST"}}  {{.Rule}} ({{.Kind}})
+  {{.Message}}
+{{end}}`
+)
+
+// EmailConfig configures the SMTP notifier of an alert rule.
+type EmailConfig struct {
+	SMTPAddr    string       `json:"smtp_addr"`
+	From        string       `json:"from"`
+	To          []string     `json:"to"`
+	Username    string       `json:"username,omitempty"`
+	PasswordEnv string       `json:"password_env,omitempty"`
+	Mode        string       `json:"mode,omitempty"`
+	Interval    jsonDuration `json:"interval,omitempty"`
+	Subject     string       `json:"subject,omitempty"`
+	Body        string       `json:"body,omitempty"`
+}
+
+// emailData is what subject and body templates are executed with. The
+// embedded Alert is the first (for per-event mode, only) alert.
+type emailData struct {
+	Alert
+	Alerts []Alert
+}
+
+type sendMailFunc func(addr string, a smtp.Auth, from string, to []string, msg []byte) error
+
+// emailNotifier sends alerts over SMTP, either one message per alert or as a
+// periodic digest.
+type emailNotifier struct {
+	cfg      EmailConfig
+	auth     smtp.Auth
+	subject  *template.Template
+	body     *template.Template
+	sendMail sendMailFunc
+
+	mu      sync.Mutex
+	pending []Alert
+}
+
+func newEmailNotifier(cfg EmailConfig) (*emailNotifier, error) {
+	if cfg.SMTPAddr == "" || cfg.From == "" || len(cfg.To) == 0 {
+		return nil, fmt.Errorf("email notifier requires smtp_addr, from and to")
+	}
+	switch cfg.Mode {
+	case "":
+		cfg.Mode = emailModePerEvent
+	case emailModePerEvent, emailModeDigest:
+	default:
+		return nil, fmt.Errorf("email notifier mode must be %s or %s", emailModePerEvent, emailModeDigest)
+	}
+	if cfg.Subject == "" {
+		cfg.Subject = defaultEmailSubject
+	}
+	if cfg.Body == "" {
+		cfg.Body = defaultEmailBody
+	}
+
+	n := &emailNotifier{cfg: cfg, sendMail: smtp.SendMail}
+	var err error
+	if n.subject, err = template.New("subject").Parse(cfg.Subject); err != nil {
+		return nil, fmt.Errorf("email subject template: %w", err)
+	}
+	if n.body, err = template.New("body").Parse(cfg.Body); err != nil {
+		return nil, fmt.Errorf("email body template: %w", err)
+	}
+	if cfg.Username != "" {
+		host, _, _ := net.SplitHostPort(cfg.SMTPAddr)
+		n.auth = smtp.PlainAuth("", cfg.Username, os.Getenv(cfg.PasswordEnv), host)
+	}
+
+	if cfg.Mode == emailModeDigest {
+		interval := cfg.Interval.Duration
+		if interval <= 0 {
+			interval = defaultDigestInterval
+		}
+		go n.runDigest(interval)
+	}
+	return n, nil
+}
+
+func (n *emailNotifier) Notify(ctx context.Context, alert Alert) error {
+	if n.cfg.Mode == emailModeDigest {
+		n.mu.Lock()
+		n.pending = append(n.pending, alert)
+		n.mu.Unlock()
+		return nil
+	}
+	return n.send([]Alert{alert})
+}
+
+func (n *emailNotifier) runDigest(interval time.Duration) {
+	for range time.Tick(interval) {
+		if err := n.flush(); err != nil {
+			log.Printf("Email digest failed: %v", err)
+		}
+	}
+}
+
+// flush sends pending digest alerts, if any.
+func (n *emailNotifier) flush() error {
+	n.mu.Lock()
+	alerts := n.pending
+	n.pending = nil
+	n.mu.Unlock()
+
+	if len(alerts) == 0 {
+		return nil
+	}
+	return n.send(alerts)
+}
+
+func (n *emailNotifier) send(alerts []Alert) error {
+	msg, err := n.message(alerts)
+	if err != nil {
+		return err
+	}
+	return n.sendMail(n.cfg.SMTPAddr, n.auth, n.cfg.From, n.cfg.To, msg)
+}
+
+func (n *emailNotifier) message(alerts []Alert) ([]byte, error) {
+	data := emailData{Alert: alerts[0], Alerts: alerts}
+
+	var subject, body bytes.Buffer
+	if err := n.subject.Execute(&subject, data); err != nil {
+		return nil, err
+	}
+	if err := n.body.Execute(&body, data); err != nil {
+		return nil, err
+	}
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", n.cfg.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(n.cfg.To, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", strings.TrimSpace(subject.String())))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	msg.WriteString(strings.ReplaceAll(body.String(), "\n", "\r\n"))
+	return msg.Bytes(), nil
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"net/smtp"
+	"strings"
+	"testing"
+	"time"
+)
+
+type sentMail struct {
+	addr string
+	from string
+	to   []string
+	msg  string
+}
+
+func newTestEmailNotifier(t *testing.T, cfg EmailConfig) (*emailNotifier, *[]sentMail) {
+	t.Helper()
+	n, err := newEmailNotifier(cfg)
+	if err != nil {
+		t.Fatalf("newEmailNotifier: %v", err)
+	}
+	var sent []sentMail
+	n.sendMail = func(addr string, a smtp.Auth, from string, to []string, msg []byte) error {
+		sent = append(sent, sentMail{addr, from, to, string(msg)})
+		return nil
+	}
+	return n, &sent
+}
+
+func TestEmailNotifierPerEvent(t *testing.T) {
+	n, sent := newTestEmailNotifier(t, EmailConfig{
+		SMTPAddr: "smtp.example.com:25",
+		From:     "echo@example.com",
+		To:       []string{"oncall@example.com"},
+		Body:     "Rule {{.Rule}}: {{.Message}}\n",
+	})
+
+	alert := Alert{Rule: "payment-failures", Kind: alertKindThreshold, Message: "11 matching webhooks", FiredAt: time.Now()}
+	if err := n.Notify(context.Background(), alert); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+
+	if len(*sent) != 1 {
+		t.Fatalf("expected 1 message, got %d", len(*sent))
+	}
+	msg := (*sent)[0]
+	if msg.addr != "smtp.example.com:25" || msg.to[0] != "oncall@example.com" {
+		t.Errorf("unexpected envelope: %+v", msg)
+	}
+	if !strings.Contains(msg.msg, "Subject: [webhook-echo] payment-failures fired\r\n") {
+		t.Errorf("unexpected subject in:\n%s", msg.msg)
+	}
+	if !strings.HasSuffix(msg.msg, "\r\n\r\nRule payment-failures: 11 matching webhooks\r\n") {
+		t.Errorf("unexpected body in:\n%s", msg.msg)
+	}
+}
+
+func TestEmailNotifierDigest(t *testing.T) {
+	n, sent := newTestEmailNotifier(t, EmailConfig{
+		SMTPAddr: "smtp.example.com:25",
+		From:     "echo@example.com",
+		To:       []string{"oncall@example.com"},
+		Mode:     emailModeDigest,
+		Interval: jsonDuration{time.Hour},
+	})
+
+	n.Notify(context.Background(), Alert{Rule: "a", Message: "first", FiredAt: time.Now()})
+	n.Notify(context.Background(), Alert{Rule: "b", Message: "second", FiredAt: time.Now()})
+	if len(*sent) != 0 {
+		t.Fatal("digest mode should not send immediately")
+	}
+
+	if err := n.flush(); err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+	if len(*sent) != 1 {
+		t.Fatalf("expected a single digest, got %d", len(*sent))
+	}
+	msg := (*sent)[0].msg
+	if !strings.Contains(msg, "Subject: [webhook-echo] 2 alerts") || !strings.Contains(msg, "first") || !strings.Contains(msg, "second") {
+		t.Errorf("unexpected digest:\n%s", msg)
+	}
+
+	n.flush()
+	if len(*sent) != 1 {
+		t.Error("empty digest should not be sent")
+	}
+}
+
+func TestEmailNotifierConfigValidation(t *testing.T) {
+	if _, err := newNotifier(NotifierConfig{Type: "email"}); err == nil {
+		t.Error("expected error without email settings")
+	}
+	if _, err := newEmailNotifier(EmailConfig{SMTPAddr: "x:25", From: "a@b"}); err == nil {
+		t.Error("expected error without recipients")
+	}
+	if _, err := newEmailNotifier(EmailConfig{SMTPAddr: "x:25", From: "a@b", To: []string{"c@d"}, Mode: "weekly"}); err == nil {
+		t.Error("expected error for unknown mode")
+	}
+}
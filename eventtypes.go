@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+type EventTypeStats struct {
+	EventType string    `json:"event"`
+	Count     int       `json:"count"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+	Versions  []string  `json:"versions"`
+}
+
+// EventTypeIndex keeps running totals for every event type ever ingested,
+// including those whose webhooks have since been evicted from the buffer.
+type EventTypeIndex struct {
+	mu    sync.RWMutex
+	types map[string]*EventTypeStats
+}
+
+func NewEventTypeIndex() *EventTypeIndex {
+	return &EventTypeIndex{types: make(map[string]*EventTypeStats)}
+}
+
+func (idx *EventTypeIndex) OnIngest(item WebhookParams, body []byte) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	stats := idx.types[item.EventType]
+	if stats == nil {
+		stats = &EventTypeStats{EventType: item.EventType, FirstSeen: item.ReceivedAt}
+		idx.types[item.EventType] = stats
+	}
+	stats.Count++
+	stats.LastSeen = item.ReceivedAt
+
+	for _, v := range stats.Versions {
+		if v == item.Version {
+			return
+		}
+	}
+	stats.Versions = append(stats.Versions, item.Version)
+	sort.Strings(stats.Versions)
+}
+
+// List returns a copy of the stats for every event type, sorted by name.
+func (idx *EventTypeIndex) List() []EventTypeStats {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	list := make([]EventTypeStats, 0, len(idx.types))
+	for _, stats := range idx.types {
+		s := *stats
+		s.Versions = append([]string(nil), stats.Versions...)
+		list = append(list, s)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].EventType < list[j].EventType })
+	return list
+}
+
+func eventTypesHandler(idx *EventTypeIndex) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(idx.List())
+	}
+}
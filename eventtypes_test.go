@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestEventTypesListing(t *testing.T) {
+	mux := newTestServer()
+
+	postWebhook(t, mux, `{"event":"user.created","data":{},"version":"1"}`)
+	postWebhook(t, mux, `{"event":"order.paid","data":{},"version":"2"}`)
+	postWebhook(t, mux, `{"event":"user.created","data":{},"version":"2"}`)
+	postWebhook(t, mux, `{"event":"user.created","data":{},"version":"1"}`)
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/event-types", nil)
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rec.Code)
+	}
+
+	var types []EventTypeStats
+	if err := json.Unmarshal(rec.Body.Bytes(), &types); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	if len(types) != 2 {
+		t.Fatalf("expected 2 event types, got %d", len(types))
+	}
+	if types[0].EventType != "order.paid" || types[0].Count != 1 {
+		t.Errorf("unexpected first entry: %+v", types[0])
+	}
+	user := types[1]
+	if user.EventType != "user.created" || user.Count != 3 {
+		t.Errorf("unexpected second entry: %+v", user)
+	}
+	if len(user.Versions) != 2 || user.Versions[0] != "1" || user.Versions[1] != "2" {
+		t.Errorf("expected versions [1 2], got %v", user.Versions)
+	}
+	if user.FirstSeen.IsZero() || user.LastSeen.Before(user.FirstSeen) {
+		t.Errorf("unexpected first/last seen: %v / %v", user.FirstSeen, user.LastSeen)
+	}
+}
+
+func TestEventTypesSurviveEviction(t *testing.T) {
+	mux := http.NewServeMux()
+	registerRoutes(mux, NewRingBuffer(1), "secret")
+
+	postWebhook(t, mux, `{"event":"first","data":{}}`)
+	postWebhook(t, mux, `{"event":"second","data":{}}`)
+
+	req := httptest.NewRequest(http.MethodGet, "/event-types", nil)
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+
+	var types []EventTypeStats
+	json.Unmarshal(rec.Body.Bytes(), &types)
+	if len(types) != 2 {
+		t.Errorf("expected evicted event types to remain listed, got %+v", types)
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"os"
+	"os/exec"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// execQueueSize bounds how many webhooks may wait for a free exec worker
+// before new ones are dropped.
+const execQueueSize = 100
+
+type execJob struct {
+	item WebhookParams
+	body []byte
+}
+
+// ExecHook pipes matching webhooks to a local command: the raw body on stdin
+// and metadata in WEBHOOK_* environment variables.
+type ExecHook struct {
+	command []string
+	filter  *QueryFilter
+	timeout time.Duration
+	jobs    chan execJob
+	wg      sync.WaitGroup
+}
+
+// NewExecHook starts concurrency workers running command. A nil filter
+// matches every webhook.
+func NewExecHook(command []string, filter *QueryFilter, concurrency int, timeout time.Duration) *ExecHook {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	h := &ExecHook{
+		command: command,
+		filter:  filter,
+		timeout: timeout,
+		jobs:    make(chan execJob, execQueueSize),
+	}
+	for i := 0; i < concurrency; i++ {
+		h.wg.Add(1)
+		go h.worker()
+	}
+	return h
+}
+
+func (h *ExecHook) OnIngest(item WebhookParams, body []byte) {
+	if h.filter != nil && !h.filter.Match(item) {
+		return
+	}
+	select {
+	case h.jobs <- execJob{item: item, body: body}:
+	default:
+		log.Printf("Exec hook queue full, dropping %s webhook", item.EventType)
+	}
+}
+
+func (h *ExecHook) QueueName() string { return "exec" }
+
+// QueueDepth is how many webhooks wait for a free worker.
+func (h *ExecHook) QueueDepth() int { return len(h.jobs) }
+
+// Close stops accepting jobs and waits for running commands to finish.
+func (h *ExecHook) Close() {
+	close(h.jobs)
+	h.wg.Wait()
+}
+
+func (h *ExecHook) worker() {
+	defer h.wg.Done()
+	for job := range h.jobs {
+		if err := h.run(job); err != nil {
+			log.Printf("Exec hook failed for %s webhook: %v", job.item.EventType, err)
+		}
+	}
+}
+
+func (h *ExecHook) run(job execJob) error {
+	ctx := context.Background()
+	if h.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, h.timeout)
+		defer cancel()
+	}
+
+	cmd := exec.CommandContext(ctx, h.command[0], h.command[1:]...)
+	cmd.Stdin = bytes.NewReader(job.body)
+	// Don't let grandchildren holding the output pipe stall the worker
+	// after the command itself was killed.
+	cmd.WaitDelay = time.Second
+	cmd.Env = append(os.Environ(),
+		"WEBHOOK_EVENT="+job.item.EventType,
+		"WEBHOOK_VERSION="+job.item.Version,
+		"WEBHOOK_RECEIVED_AT="+job.item.ReceivedAt.Format(time.RFC3339Nano),
+		"WEBHOOK_IDEMPOTENCY_KEY="+job.item.IdempotencyKey,
+		"WEBHOOK_DELIVERIES="+strconv.Itoa(job.item.Deliveries),
+	)
+
+	out, err := cmd.CombinedOutput()
+	if debug && len(out) > 0 {
+		log.Printf("Exec hook output: %s", bytes.TrimSpace(out))
+	}
+	return err
+}
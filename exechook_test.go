@@ -0,0 +1,52 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExecHookPipesMatchingWebhooks(t *testing.T) {
+	dir := t.TempDir()
+	script := filepath.Join(dir, "hook.sh")
+	os.WriteFile(script, []byte("#!/bin/sh\ncat > \"$OUT_DIR/$WEBHOOK_IDEMPOTENCY_KEY.json\"\necho \"$WEBHOOK_EVENT $WEBHOOK_DELIVERIES\" > \"$OUT_DIR/$WEBHOOK_IDEMPOTENCY_KEY.env\"\n"), 0o755)
+	t.Setenv("OUT_DIR", dir)
+
+	filter, err := parseMatch("event_type=payment.failed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hook := NewExecHook([]string{script}, &filter, 2, 5*time.Second)
+
+	hook.OnIngest(WebhookParams{EventType: "payment.failed", IdempotencyKey: "k1", Deliveries: 1}, []byte(`{"event":"payment.failed"}`))
+	hook.OnIngest(WebhookParams{EventType: "payment.succeeded", IdempotencyKey: "k2", Deliveries: 1}, []byte(`{}`))
+	hook.Close()
+
+	body, err := os.ReadFile(filepath.Join(dir, "k1.json"))
+	if err != nil {
+		t.Fatalf("expected command to run for matching webhook: %v", err)
+	}
+	if string(body) != `{"event":"payment.failed"}` {
+		t.Errorf("expected body on stdin, got %q", body)
+	}
+	env, _ := os.ReadFile(filepath.Join(dir, "k1.env"))
+	if strings.TrimSpace(string(env)) != "payment.failed 1" {
+		t.Errorf("expected metadata in env, got %q", env)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "k2.json")); err == nil {
+		t.Error("command should not run for non-matching webhook")
+	}
+}
+
+func TestExecHookTimeout(t *testing.T) {
+	hook := NewExecHook([]string{"sleep", "5"}, nil, 1, 50*time.Millisecond)
+
+	start := time.Now()
+	hook.OnIngest(WebhookParams{EventType: "slow"}, nil)
+	hook.Close()
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("expected command to be killed by the timeout, took %v", elapsed)
+	}
+}
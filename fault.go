@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// faultHeader lets a sender ask for a connection fault on a single request,
+// with the same syntax as -fault.
+const faultHeader = "X-Echo-Fault"
+
+// Connection faults break the connection instead of answering with a status.
+const (
+	faultReset             = "reset"               // TCP RST, after the first N bytes of the response
+	faultHang              = "hang"                // never respond, until the sender hangs up
+	faultCloseAfterHeaders = "close-after-headers" // send the headers, then close before the body
+)
+
+// defaultFault applies to every ingest request when set with -fault.
+var defaultFault Fault
+
+// Fault is a connection-level failure, injected after the webhook has been
+// handled (and recorded) as usual.
+type Fault struct {
+	Kind string
+	// After is the number of response bytes sent before a reset.
+	After int
+}
+
+func (f Fault) enabled() bool {
+	return f.Kind != ""
+}
+
+// parseFault parses reset, reset=BYTES, hang or close-after-headers.
+func parseFault(s string) (Fault, error) {
+	kind, value, hasValue := strings.Cut(strings.TrimSpace(s), "=")
+	f := Fault{Kind: kind}
+	switch kind {
+	case faultReset:
+		if hasValue {
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 {
+				return Fault{}, fmt.Errorf("reset must be followed by a non-negative byte count, got %q", value)
+			}
+			f.After = n
+		}
+		return f, nil
+	case faultHang, faultCloseAfterHeaders:
+		if hasValue {
+			return Fault{}, fmt.Errorf("fault %s takes no value", kind)
+		}
+		return f, nil
+	}
+	return Fault{}, fmt.Errorf("unknown fault %q, expected reset, reset=BYTES, hang or close-after-headers", s)
+}
+
+// faultWriter holds back the response, so that apply can send as much of it
+// as the fault allows over the hijacked connection.
+type faultWriter struct {
+	w      http.ResponseWriter
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func newFaultWriter(w http.ResponseWriter) *faultWriter {
+	return &faultWriter{w: w, header: make(http.Header)}
+}
+
+func (fw *faultWriter) Header() http.Header {
+	return fw.header
+}
+
+func (fw *faultWriter) WriteHeader(status int) {
+	if fw.status == 0 {
+		fw.status = status
+	}
+}
+
+func (fw *faultWriter) Write(p []byte) (int, error) {
+	fw.WriteHeader(http.StatusOK)
+	return fw.body.Write(p)
+}
+
+// response serializes the held back response as HTTP/1.1.
+func (fw *faultWriter) response(r *http.Request) []byte {
+	fw.WriteHeader(http.StatusOK)
+	resp := &http.Response{
+		StatusCode:    fw.status,
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Request:       r,
+		Header:        fw.header,
+		Body:          io.NopCloser(bytes.NewReader(fw.body.Bytes())),
+		ContentLength: int64(fw.body.Len()),
+	}
+	var buf bytes.Buffer
+	resp.Write(&buf)
+	return buf.Bytes()
+}
+
+// apply breaks the connection as f says. Connection faults need HTTP/1.x,
+// as HTTP/2 streams cannot be hijacked; other requests get a problem.
+func (fw *faultWriter) apply(r *http.Request, f Fault) {
+	conn, brw, err := http.NewResponseController(fw.w).Hijack()
+	if err != nil {
+		writeProblem(fw.w, r, http.StatusNotImplemented, codeInvalidParameter,
+			fmt.Sprintf("Connection faults need HTTP/1.x, got %s", r.Proto))
+		return
+	}
+	defer conn.Close()
+	response := fw.response(r)
+	switch f.Kind {
+	case faultReset:
+		conn.Write(response[:min(f.After, len(response))])
+		resetConn(conn)
+	case faultCloseAfterHeaders:
+		if i := bytes.Index(response, []byte("\r\n\r\n")); i >= 0 {
+			response = response[:i+4]
+		}
+		conn.Write(response)
+	case faultHang:
+		// Keep reading, so that the connection closes when the sender gives up.
+		io.Copy(io.Discard, brw)
+	}
+}
+
+// resetConn makes Close send a TCP RST rather than a FIN.
+func resetConn(conn net.Conn) {
+	if tc, ok := conn.(*tls.Conn); ok {
+		conn = tc.NetConn()
+	}
+	if tcp, ok := conn.(*net.TCPConn); ok {
+		tcp.SetLinger(0)
+	}
+}
+
+// invalidCertNames are globs of TLS server names answered with an expired,
+// self-signed certificate for another host, from -tls-invalid-sni.
+var invalidCertNames []string
+
+var invalidCert = sync.OnceValues(func() (*tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "invalid.webhook-echo.test"},
+		DNSNames:     []string{"invalid.webhook-echo.test"},
+		NotBefore:    time.Now().Add(-48 * time.Hour),
+		NotAfter:     time.Now().Add(-24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, nil
+})
+
+// wantsInvalidCert reports whether hello asked for a server name in
+// invalidCertNames.
+func wantsInvalidCert(hello *tls.ClientHelloInfo) bool {
+	for _, pattern := range invalidCertNames {
+		if globMatch(pattern, hello.ServerName) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseFault(t *testing.T) {
+	for s, want := range map[string]Fault{
+		"reset":               {Kind: faultReset},
+		"reset=12":            {Kind: faultReset, After: 12},
+		"hang":                {Kind: faultHang},
+		"close-after-headers": {Kind: faultCloseAfterHeaders},
+	} {
+		if got, err := parseFault(s); err != nil || got != want {
+			t.Errorf("parseFault(%q) = %+v, %v", s, got, err)
+		}
+	}
+	for _, bad := range []string{"explode", "reset=-1", "hang=1"} {
+		if _, err := parseFault(bad); err == nil {
+			t.Errorf("parseFault(%q) accepted", bad)
+		}
+	}
+}
+
+func postWithFault(t *testing.T, url, fault, body string) (net.Conn, *bufio.Reader) {
+	t.Helper()
+	conn, err := net.Dial("tcp", strings.TrimPrefix(url, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	req, _ := http.NewRequest(http.MethodPost, url+"/webhook", strings.NewReader(body))
+	req.Header.Set(faultHeader, fault)
+	if err := req.Write(conn); err != nil {
+		t.Fatal(err)
+	}
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	return conn, bufio.NewReader(conn)
+}
+
+func TestFaultCloseAfterHeaders(t *testing.T) {
+	mux := newTestServer()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	_, br := postWithFault(t, server.URL, faultCloseAfterHeaders, `{"event":"cut"}`)
+	resp, err := http.ReadResponse(br, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK || resp.ContentLength != int64(len(`{"event":"cut"}`)) {
+		t.Errorf("got %s with Content-Length %d", resp.Status, resp.ContentLength)
+	}
+	if _, err := io.ReadAll(resp.Body); err != io.ErrUnexpectedEOF {
+		t.Errorf("reading the body: %v, want unexpected EOF", err)
+	}
+	if items := queryWebhooks(t, mux, "/query/cut"); len(items) != 1 {
+		t.Errorf("expected the webhook recorded, got %d records", len(items))
+	}
+}
+
+func TestFaultReset(t *testing.T) {
+	server := httptest.NewServer(newTestServer())
+	defer server.Close()
+
+	_, br := postWithFault(t, server.URL, "reset=8", `{"event":"reset"}`)
+	got, err := io.ReadAll(br)
+	if err == nil {
+		t.Errorf("expected a connection reset, read %q", got)
+	}
+	if string(got) != "HTTP/1.1" {
+		t.Errorf("read %q before the reset, want the first 8 bytes", got)
+	}
+}
+
+func TestFaultHang(t *testing.T) {
+	server := httptest.NewServer(newTestServer())
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodPost, server.URL+"/webhook", strings.NewReader(`{"event":"hang"}`))
+	req.Header.Set(faultHeader, faultHang)
+	if resp, err := http.DefaultClient.Do(req); err == nil {
+		resp.Body.Close()
+		t.Fatalf("expected no response, got %s", resp.Status)
+	}
+}
+
+func TestInvalidCertificateBySNI(t *testing.T) {
+	invalidCertNames = []string{"invalid.*"}
+	t.Cleanup(func() { invalidCertNames = nil })
+	server := httptest.NewUnstartedServer(newTestServer())
+	server.TLS = tlsConfig(&certificateReloader{})
+	server.StartTLS()
+	defer server.Close()
+
+	for name, wantExpired := range map[string]bool{"invalid.example.com": true, "example.com": false} {
+		conn, err := tls.Dial("tcp", server.Listener.Addr().String(), &tls.Config{ServerName: name, InsecureSkipVerify: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		cert := conn.ConnectionState().PeerCertificates[0]
+		conn.Close()
+		if expired := time.Now().After(cert.NotAfter); expired != wantExpired {
+			t.Errorf("%s: certificate expires %v, want expired %v", name, cert.NotAfter, wantExpired)
+		}
+	}
+}
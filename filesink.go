@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// fileSinkLayout is the timestamp prefix of file sink names. It sorts
+// lexically in time order, which rotation relies on.
+const fileSinkLayout = "20060102T150405.000000000Z"
+
+type sinkFile struct {
+	name string
+	size int64
+}
+
+// FileSink writes each captured webhook to its own JSON file in a directory,
+// deleting the oldest files once maxFiles or maxBytes is exceeded (zero
+// disables a limit).
+type FileSink struct {
+	dir      string
+	maxFiles int
+	maxBytes int64
+
+	mu    sync.Mutex
+	files []sinkFile
+	total int64
+	seq   uint64
+}
+
+// NewFileSink creates dir if needed and picks up files left by a previous
+// run so that limits apply across restarts.
+func NewFileSink(dir string, maxFiles int, maxBytes int64) (*FileSink, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &FileSink{dir: dir, maxFiles: maxFiles, maxBytes: maxBytes}
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".json") {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		s.files = append(s.files, sinkFile{name: e.Name(), size: info.Size()})
+		s.total += info.Size()
+	}
+	sort.Slice(s.files, func(i, j int) bool { return s.files[i].name < s.files[j].name })
+
+	s.mu.Lock()
+	s.rotate()
+	s.mu.Unlock()
+	return s, nil
+}
+
+func (s *FileSink) OnIngest(item WebhookParams, body []byte) {
+	data, err := json.MarshalIndent(item, "", "  ")
+	if err != nil {
+		log.Printf("File sink: %v", err)
+		return
+	}
+	data = append(data, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.seq++
+	name := fmt.Sprintf("%s-%06d-%s.json",
+		item.ReceivedAt.UTC().Format(fileSinkLayout), s.seq%1000000, sanitizeFilename(item.EventType))
+	if err := writeFileAtomic(filepath.Join(s.dir, name), data); err != nil {
+		log.Printf("File sink: %v", err)
+		return
+	}
+
+	s.files = append(s.files, sinkFile{name: name, size: int64(len(data))})
+	s.total += int64(len(data))
+	s.rotate()
+}
+
+// rotate removes the oldest files until both limits are satisfied.
+func (s *FileSink) rotate() {
+	for len(s.files) > 0 &&
+		((s.maxFiles > 0 && len(s.files) > s.maxFiles) || (s.maxBytes > 0 && s.total > s.maxBytes)) {
+		oldest := s.files[0]
+		if err := os.Remove(filepath.Join(s.dir, oldest.name)); err != nil && !os.IsNotExist(err) {
+			log.Printf("File sink: %v", err)
+		}
+		s.files = s.files[1:]
+		s.total -= oldest.size
+	}
+}
+
+// writeFileAtomic writes data to a temporary file and renames it into place,
+// so directory watchers never observe a partially written file.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// sanitizeFilename keeps event types usable as file name components.
+func sanitizeFilename(s string) string {
+	if s == "" {
+		return "unknown"
+	}
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '_', r == '-':
+			return r
+		default:
+			return '_'
+		}
+	}, s)
+}
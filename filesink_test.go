@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func sinkFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	return names
+}
+
+func TestFileSinkWritesRecords(t *testing.T) {
+	dir := t.TempDir()
+	sink, err := NewFileSink(dir, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	received := time.Date(2024, 3, 4, 5, 6, 7, 0, time.UTC)
+	sink.OnIngest(WebhookParams{EventType: "user/created", Payload: map[string]any{"id": "u1"}, ReceivedAt: received}, nil)
+
+	names := sinkFiles(t, dir)
+	if len(names) != 1 {
+		t.Fatalf("expected 1 file, got %v", names)
+	}
+	if !strings.HasPrefix(names[0], "20240304T050607.") || !strings.HasSuffix(names[0], "-user_created.json") {
+		t.Errorf("unexpected file name %s", names[0])
+	}
+
+	data, _ := os.ReadFile(filepath.Join(dir, names[0]))
+	var got WebhookParams
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("file is not valid JSON: %v", err)
+	}
+	if got.EventType != "user/created" || got.Payload["id"] != "u1" {
+		t.Errorf("unexpected record: %+v", got)
+	}
+}
+
+func TestFileSinkRotation(t *testing.T) {
+	dir := t.TempDir()
+	sink, err := NewFileSink(dir, 3, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 5; i++ {
+		sink.OnIngest(WebhookParams{EventType: "e", ReceivedAt: base.Add(time.Duration(i) * time.Second)}, nil)
+	}
+	names := sinkFiles(t, dir)
+	if len(names) != 3 || !strings.HasPrefix(names[0], "20240101T000002.") {
+		t.Fatalf("expected the 3 newest files, got %v", names)
+	}
+
+	// Limits apply to files left over from a previous run.
+	reopened, err := NewFileSink(dir, 0, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if names := sinkFiles(t, dir); len(names) != 0 {
+		t.Errorf("expected byte limit to prune existing files, got %v", names)
+	}
+	if reopened.total != 0 {
+		t.Errorf("expected total to be 0, got %d", reopened.total)
+	}
+}
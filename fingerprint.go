@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Extension IDs the fingerprints treat specially.
+const (
+	extServerName        = 0x0000
+	extALPN              = 0x0010
+	extSupportedVersions = 0x002b
+)
+
+// TLSFingerprint identifies the TLS stack a sender used by its ClientHello,
+// which differs between client libraries and versions even when they share
+// a source address. JA3 is the JA3 string and JA3Hash its MD5, as most
+// tools show it; JA4 is the JA4 fingerprint.
+type TLSFingerprint struct {
+	JA3     string `json:"ja3"`
+	JA3Hash string `json:"ja3_hash"`
+	JA4     string `json:"ja4"`
+}
+
+// isGREASE reports whether v is one of the RFC 8701 values clients send at
+// random, which the fingerprints leave out.
+func isGREASE(v uint16) bool {
+	return v&0x0f0f == 0x0a0a && v>>8 == v&0xff
+}
+
+func withoutGREASE[T ~uint16](values []T) []T {
+	return slices.DeleteFunc(slices.Clone(values), func(v T) bool { return isGREASE(uint16(v)) })
+}
+
+func joinValues[T ~uint16 | ~uint8](values []T, sep string, format func(T) string) string {
+	parts := make([]string, len(values))
+	for i, v := range values {
+		parts[i] = format(v)
+	}
+	return strings.Join(parts, sep)
+}
+
+func decimal[T ~uint16 | ~uint8](v T) string { return strconv.Itoa(int(v)) }
+
+func hex4(v uint16) string { return fmt.Sprintf("%04x", v) }
+
+// clientHelloFingerprint computes the fingerprints of hello.
+func clientHelloFingerprint(hello *tls.ClientHelloInfo) *TLSFingerprint {
+	ciphers := withoutGREASE(hello.CipherSuites)
+	extensions := withoutGREASE(hello.Extensions)
+	versions := withoutGREASE(hello.SupportedVersions)
+
+	// The version field of the hello is TLS 1.2 from clients that list
+	// their versions in an extension.
+	legacy := uint16(tls.VersionTLS12)
+	if !slices.Contains(extensions, extSupportedVersions) && len(versions) > 0 {
+		legacy = slices.Max(versions)
+	}
+	ja3 := strings.Join([]string{
+		decimal(legacy),
+		joinValues(ciphers, "-", decimal),
+		joinValues(extensions, "-", decimal),
+		joinValues(withoutGREASE(hello.SupportedCurves), "-", decimal),
+		joinValues(hello.SupportedPoints, "-", decimal),
+	}, ",")
+	sum := md5.Sum([]byte(ja3))
+
+	return &TLSFingerprint{JA3: ja3, JA3Hash: hex.EncodeToString(sum[:]), JA4: ja4(hello, ciphers, extensions, versions)}
+}
+
+// ja4 computes the JA4 fingerprint of hello from its lists without GREASE
+// values.
+func ja4(hello *tls.ClientHelloInfo, ciphers, extensions, versions []uint16) string {
+	version := "00"
+	if len(versions) > 0 {
+		switch slices.Max(versions) {
+		case tls.VersionTLS13:
+			version = "13"
+		case tls.VersionTLS12:
+			version = "12"
+		case tls.VersionTLS11:
+			version = "11"
+		case tls.VersionTLS10:
+			version = "10"
+		case tls.VersionSSL30:
+			version = "s3"
+		}
+	}
+	sni := "i"
+	if hello.ServerName != "" {
+		sni = "d"
+	}
+	alpn := "00"
+	if len(hello.SupportedProtos) > 0 && hello.SupportedProtos[0] != "" {
+		p := hello.SupportedProtos[0]
+		first, last := p[0], p[len(p)-1]
+		if isAlnum(first) && isAlnum(last) {
+			alpn = string([]byte{first, last})
+		} else {
+			h := hex.EncodeToString([]byte(p))
+			alpn = h[:1] + h[len(h)-1:]
+		}
+	}
+	a := fmt.Sprintf("t%s%s%02d%02d%s", version, sni, min(len(ciphers), 99), min(len(extensions), 99), alpn)
+
+	sortedCiphers := slices.Sorted(slices.Values(ciphers))
+	b := truncatedSHA256(joinValues(sortedCiphers, ",", hex4), len(ciphers) == 0)
+
+	// The server name and ALPN are already in the first part.
+	sortedExtensions := slices.DeleteFunc(slices.Sorted(slices.Values(extensions)), func(v uint16) bool {
+		return v == extServerName || v == extALPN
+	})
+	c := joinValues(sortedExtensions, ",", hex4)
+	if schemes := withoutGREASE(hello.SignatureSchemes); len(schemes) > 0 {
+		c += "_" + joinValues(schemes, ",", func(s tls.SignatureScheme) string { return hex4(uint16(s)) })
+	}
+	return a + "_" + b + "_" + truncatedSHA256(c, len(sortedExtensions) == 0)
+}
+
+func isAlnum(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// truncatedSHA256 is the first 12 hex digits of the SHA-256 of s, or zeros
+// when the list it stands for is empty.
+func truncatedSHA256(s string, empty bool) string {
+	if empty {
+		return "000000000000"
+	}
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])[:12]
+}
+
+// fingerprintKey is the context key of a connection's fingerprintHolder.
+type fingerprintKey struct{}
+
+// fingerprintHolder keeps the fingerprint of a connection's ClientHello
+// for its requests.
+type fingerprintHolder struct {
+	mu sync.Mutex
+	fp *TLSFingerprint
+}
+
+func (h *fingerprintHolder) get() *TLSFingerprint {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.fp
+}
+
+// fingerprintTLS has server, serving TLS with config, fingerprint the
+// ClientHello of every connection, for tlsInfo to record. The hello only
+// carries the raw connection, so holders are found by it until the
+// connection closes.
+func fingerprintTLS(server *http.Server, config *tls.Config) {
+	var holders sync.Map // net.Conn -> *fingerprintHolder
+	next := config.GetConfigForClient
+	config.GetConfigForClient = func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+		if h, ok := holders.Load(hello.Conn); ok {
+			h := h.(*fingerprintHolder)
+			h.mu.Lock()
+			h.fp = clientHelloFingerprint(hello)
+			h.mu.Unlock()
+		}
+		if next != nil {
+			return next(hello)
+		}
+		return nil, nil
+	}
+	connContext := server.ConnContext
+	server.ConnContext = func(ctx context.Context, c net.Conn) context.Context {
+		if connContext != nil {
+			ctx = connContext(ctx, c)
+		}
+		tc, ok := c.(*tls.Conn)
+		if !ok {
+			return ctx
+		}
+		h := &fingerprintHolder{}
+		holders.Store(tc.NetConn(), h)
+		return context.WithValue(ctx, fingerprintKey{}, h)
+	}
+	connState := server.ConnState
+	server.ConnState = func(c net.Conn, state http.ConnState) {
+		if connState != nil {
+			connState(c, state)
+		}
+		if tc, ok := c.(*tls.Conn); ok && (state == http.StateClosed || state == http.StateHijacked) {
+			holders.Delete(tc.NetConn())
+		}
+	}
+}
+
+// requestFingerprint returns the fingerprint of the connection r came
+// over, if it was taken.
+func requestFingerprint(r *http.Request) *TLSFingerprint {
+	if h, ok := r.Context().Value(fingerprintKey{}).(*fingerprintHolder); ok {
+		return h.get()
+	}
+	return nil
+}
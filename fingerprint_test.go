@@ -0,0 +1,80 @@
+package main
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestClientHelloFingerprint(t *testing.T) {
+	// The example from the JA3 documentation, with GREASE values added.
+	hello := &tls.ClientHelloInfo{
+		CipherSuites:      []uint16{0x0a0a, 47, 53, 5, 10, 49161, 49162, 49171, 49172, 50, 56, 19, 4},
+		Extensions:        []uint16{0x1a1a, 0, 10, 11},
+		SupportedCurves:   []tls.CurveID{0x2a2a, 23, 24, 25},
+		SupportedPoints:   []uint8{0},
+		SupportedVersions: []uint16{tls.VersionTLS10, tls.VersionSSL30},
+		ServerName:        "example.com",
+	}
+	fp := clientHelloFingerprint(hello)
+	if fp.JA3 != "769,47-53-5-10-49161-49162-49171-49172-50-56-19-4,0-10-11,23-24-25,0" || fp.JA3Hash != "ada70206e40642a3e4461f35503241d5" {
+		t.Errorf("unexpected JA3 %s (%s)", fp.JA3, fp.JA3Hash)
+	}
+	if !regexp.MustCompile(`^t10d120300_[0-9a-f]{12}_[0-9a-f]{12}$`).MatchString(fp.JA4) {
+		t.Errorf("unexpected JA4 %s", fp.JA4)
+	}
+
+	// Neither the order of the ciphers nor GREASE values change JA4.
+	hello.CipherSuites = []uint16{4, 19, 56, 50, 49172, 49171, 49162, 49161, 10, 5, 53, 47}
+	hello.Extensions = []uint16{11, 10, 0}
+	if again := clientHelloFingerprint(hello); again.JA4 != fp.JA4 || again.JA3Hash == fp.JA3Hash {
+		t.Errorf("expected JA4 to ignore order and JA3 not to, got %s and %s", again.JA4, again.JA3Hash)
+	}
+
+	if got := ja4(&tls.ClientHelloInfo{SupportedProtos: []string{"h2"}}, nil, nil, []uint16{tls.VersionTLS13}); got != "t13i0000h2_000000000000_000000000000" {
+		t.Errorf("unexpected JA4 of an empty hello %s", got)
+	}
+}
+
+func TestRecordsTLSFingerprint(t *testing.T) {
+	buffer := NewRingBuffer(10)
+	mux := http.NewServeMux()
+	registerRoutes(mux, buffer, "secret")
+	server := httptest.NewUnstartedServer(mux)
+	server.EnableHTTP2 = true
+	server.TLS = &tls.Config{}
+	fingerprintTLS(server.Config, server.TLS)
+	server.StartTLS()
+	defer server.Close()
+
+	client := server.Client()
+	client.Transport.(*http.Transport).TLSClientConfig.ServerName = "example.com"
+	resp, err := client.Post(server.URL+"/webhook", "application/json", strings.NewReader(`{"event":"secure"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	items := queryWebhooks(t, mux, "/query/secure")
+	if len(items) != 1 || items[0].TLS == nil || items[0].TLS.Fingerprint == nil {
+		t.Fatalf("expected a fingerprinted record, got %+v", items)
+	}
+	fp := items[0].TLS.Fingerprint
+	if !strings.HasPrefix(fp.JA4, "t13d") || !strings.Contains(fp.JA4, "h2_") || !strings.HasPrefix(fp.JA3, "771,") {
+		t.Errorf("unexpected fingerprint %+v", fp)
+	}
+
+	if items := queryWebhooks(t, mux, "/query?ja4="+url.QueryEscape(fp.JA4)+"&ja3="+strings.ToUpper(fp.JA3Hash)); len(items) != 1 {
+		t.Errorf("expected the record found by its fingerprints, got %d", len(items))
+	}
+	if items := queryWebhooks(t, mux, "/query/secure?ja3="+url.QueryEscape(fp.JA3)); len(items) != 1 {
+		t.Errorf("expected the record found by its JA3 string, got %d", len(items))
+	}
+	if items := queryWebhooks(t, mux, "/query/secure?ja4=t12d0000h2_000000000000_000000000000"); len(items) != 0 {
+		t.Errorf("expected no record for another fingerprint, got %d", len(items))
+	}
+}
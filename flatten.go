@@ -0,0 +1,50 @@
+package main
+
+import "strconv"
+
+// flattenPayload returns payload with nested objects and arrays replaced by
+// their leaves under dotted keys, so that {"user": {"id": 1}, "tags": ["a"]}
+// becomes {"user.id": 1, "tags.0": "a"}. Empty objects and arrays are
+// leaves themselves.
+func flattenPayload(payload map[string]any) map[string]any {
+	if payload == nil {
+		return nil
+	}
+	flat := make(map[string]any, len(payload))
+	var walk func(prefix string, v any)
+	walk = func(prefix string, v any) {
+		switch v := v.(type) {
+		case map[string]any:
+			if len(v) > 0 {
+				for key, child := range v {
+					walk(prefix+"."+key, child)
+				}
+				return
+			}
+		case []any:
+			if len(v) > 0 {
+				for i, child := range v {
+					walk(prefix+"."+strconv.Itoa(i), child)
+				}
+				return
+			}
+		}
+		flat[prefix] = v
+	}
+	for key, v := range payload {
+		walk(key, v)
+	}
+	return flat
+}
+
+// flattenItems flattens the payloads of items in place when filter asks
+// for it with flatten=true. The records are copies, so the buffer keeps its
+// nested payloads.
+func flattenItems(items []WebhookParams, filter QueryFilter) {
+	if !filter.Flatten {
+		return
+	}
+	for i := range items {
+		items[i].Payload = flattenPayload(items[i].Payload)
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFlattenPayload(t *testing.T) {
+	got := flattenPayload(map[string]any{
+		"user":  map[string]any{"id": 1.0, "address": map[string]any{"city": "Oslo"}},
+		"items": []any{map[string]any{"sku": "A"}, "loose"},
+		"empty": map[string]any{},
+		"none":  []any{},
+		"flag":  true,
+	})
+	want := map[string]any{
+		"user.id":           1.0,
+		"user.address.city": "Oslo",
+		"items.0.sku":       "A",
+		"items.1":           "loose",
+		"empty":             map[string]any{},
+		"none":              []any{},
+		"flag":              true,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestQueryFlatten(t *testing.T) {
+	mux := newTestServer()
+	postWebhook(t, mux, `{"event":"user","data":{"user":{"id":7,"name":"Ada"}}}`)
+
+	items := queryWebhooks(t, mux, "/v1/query/user?flatten=true&user.id=7")
+	if len(items) != 1 || items[0].Payload["user.id"] != 7.0 || items[0].Payload["user"] != nil {
+		t.Errorf("expected a flat payload, got %+v", items)
+	}
+	// The stored record keeps its nested payload.
+	if items := queryWebhooks(t, mux, "/query/user"); len(items) != 1 || items[0].Payload["user.id"] != nil {
+		t.Errorf("expected the nested payload without flatten, got %+v", items)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/query/user?flatten=true", nil)
+	req.Header.Set("Accept", ndjsonContentType)
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	if !strings.Contains(rec.Body.String(), `"user.name":"Ada"`) {
+		t.Errorf("expected a flat streamed payload, got %s", rec.Body)
+	}
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/query/user?flatten=maybe", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected a bad flatten value refused, got %d", rec.Code)
+	}
+}
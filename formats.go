@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"strings"
+)
+
+// Parser turns an ingest body into a webhook.
+type Parser interface {
+	Parse(body []byte) (WebhookParams, error)
+}
+
+// ParserFunc adapts a function to Parser.
+type ParserFunc func(body []byte) (WebhookParams, error)
+
+func (f ParserFunc) Parse(body []byte) (WebhookParams, error) { return f(body) }
+
+// BodyFormat is an ingest format other than JSON, chosen by the media type
+// of the request. Binary formats get the body as sent, only gunzipped,
+// instead of converted to UTF-8. Parse errors are answered with Code.
+type BodyFormat struct {
+	Name   string
+	Code   string
+	Binary bool
+	Parser Parser
+}
+
+var (
+	xmlFormat     = &BodyFormat{Name: "XML", Code: codeInvalidXML, Parser: ParserFunc(parseXMLWebhook)}
+	msgpackFormat = &BodyFormat{Name: "MessagePack", Code: codeInvalidMsgPack, Binary: true, Parser: documentParser(decodeMsgPack)}
+	cborFormat    = &BodyFormat{Name: "CBOR", Code: codeInvalidCBOR, Binary: true, Parser: documentParser(decodeCBOR)}
+)
+
+// bodyFormats maps media types, or structured syntax suffixes such as +xml,
+// to their format. JSON, the default, is not in it.
+var bodyFormats = map[string]*BodyFormat{
+	"application/xml":         xmlFormat,
+	"text/xml":                xmlFormat,
+	"+xml":                    xmlFormat,
+	"application/msgpack":     msgpackFormat,
+	"application/x-msgpack":   msgpackFormat,
+	"application/vnd.msgpack": msgpackFormat,
+	"+msgpack":                msgpackFormat,
+	"application/cbor":        cborFormat,
+	"+cbor":                   cborFormat,
+}
+
+// RegisterFormat adds an ingest format for a media type such as
+// application/avro, or for a suffix such as +avro. It must be called before
+// the server starts.
+func RegisterFormat(mediaType string, f BodyFormat) {
+	bodyFormats[strings.ToLower(mediaType)] = &f
+}
+
+// lookupFormat returns the format registered for contentType, if any.
+func lookupFormat(contentType string) *BodyFormat {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil
+	}
+	if f := bodyFormats[mediaType]; f != nil {
+		return f
+	}
+	if i := strings.LastIndexByte(mediaType, '+'); i >= 0 {
+		return bodyFormats[mediaType[i:]]
+	}
+	return nil
+}
+
+// documentParser parses formats that carry the same data model as JSON: the
+// decoded document is read as if it had been sent as JSON, envelope and all.
+func documentParser(decode func([]byte) (any, error)) Parser {
+	return ParserFunc(func(body []byte) (WebhookParams, error) {
+		var res WebhookParams
+		doc, err := decode(body)
+		if err != nil {
+			return res, err
+		}
+		b, err := json.Marshal(doc)
+		if err != nil {
+			return res, err
+		}
+		if err := json.Unmarshal(b, &res); err != nil {
+			return res, err
+		}
+		return res, nil
+	})
+}
+
+// documentKey turns a map key of a binary format, which need not be a
+// string, into a JSON object key.
+func documentKey(k any) string {
+	switch k := k.(type) {
+	case string:
+		return k
+	case []byte:
+		return string(k)
+	}
+	b, err := json.Marshal(k)
+	if err != nil {
+		return fmt.Sprint(k)
+	}
+	return string(b)
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func postBody(t *testing.T, mux *http.ServeMux, contentType string, body []byte) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body))
+	req.Header.Set("Content-Type", contentType)
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	return rec
+}
+
+func str(s string) []byte { return append([]byte{0xa0 | byte(len(s))}, s...) }
+
+func TestMsgPackIngest(t *testing.T) {
+	exactNumbers = true
+	t.Cleanup(func() { exactNumbers = false })
+
+	var b []byte
+	b = append(b, 0x82)
+	b = append(b, str("event")...)
+	b = append(b, str("order")...)
+	b = append(b, str("data")...)
+	b = append(b, 0x85)
+	b = append(append(b, str("id")...), 0x01)
+	b = append(append(b, str("big")...), 0xcf, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff)
+	b = append(append(b, str("neg")...), 0xd1, 0xff, 0x38)
+	b = append(append(b, str("ts")...), 0xd6, 0xff, 0x00, 0x00, 0x00, 0x3c)
+	b = append(append(b, str("bin")...), 0xc4, 0x02, 0x01, 0x02)
+
+	mux := newTestServer()
+	if rec := postBody(t, mux, "application/msgpack", b); rec.Code != http.StatusOK {
+		t.Fatalf("expected MessagePack to be accepted, got %d %s", rec.Code, rec.Body)
+	}
+	got := queryWebhooks(t, mux, "/query/order?big=18446744073709551615&neg=-200&ts=1970-01-01T00:01:00Z&bin=AQI=")
+	if len(got) != 1 {
+		t.Fatalf("expected the decoded payload to match, got %d records", len(got))
+	}
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/webhooks/"+got[0].ID+"/raw", nil))
+	if !bytes.Equal(rec.Body.Bytes(), b) || got[0].Encoding != "" {
+		t.Errorf("expected the body stored as sent, got %q (%s)", rec.Body, got[0].Encoding)
+	}
+
+	rec = postBody(t, mux, "application/vnd.example+msgpack", []byte{0x82, 0xa5})
+	if p := decodeProblem(t, rec); rec.Code != http.StatusBadRequest || p.Code != codeInvalidMsgPack {
+		t.Errorf("expected invalid_msgpack for a truncated body, got %d %+v", rec.Code, p)
+	}
+}
+
+func TestCBORIngest(t *testing.T) {
+	exactNumbers = true
+	t.Cleanup(func() { exactNumbers = false })
+
+	var b []byte
+	b = append(b, 0xa2, 0x65)
+	b = append(b, "event"...)
+	b = append(b, 0x65)
+	b = append(b, "order"...)
+	b = append(b, 0x64)
+	b = append(b, "data"...)
+	b = append(b, 0xa5, 0x62, 'i', 'd', 0x01)
+	b = append(b, 0x61, 'n', 0x38, 0x63)
+	b = append(b, 0x61, 'f', 0xf9, 0x3e, 0x00)
+	b = append(b, 0x63, 'b', 'i', 'g', 0xc2, 0x49, 0x01, 0, 0, 0, 0, 0, 0, 0, 0)
+	b = append(b, 0x64, 't', 'a', 'g', 's', 0x9f, 0x7f, 0x61, 'a', 0x61, 'b', 0xff, 0x02, 0xff)
+
+	mux := newTestServer()
+	if rec := postBody(t, mux, "application/cbor", b); rec.Code != http.StatusOK {
+		t.Fatalf("expected CBOR to be accepted, got %d %s", rec.Code, rec.Body)
+	}
+	if got := queryWebhooks(t, mux, "/query/order?n=-100&f=1.5&big=18446744073709551616"); len(got) != 1 {
+		t.Fatalf("expected the decoded payload to match, got %d records", len(got))
+	}
+	if got := queryWebhooks(t, mux, "/query/order?xpath=/tags[1]=ab"); len(got) != 1 {
+		t.Errorf("expected indefinite-length items to be joined, got %d records", len(got))
+	}
+}
+
+func TestBinaryDecoderLimits(t *testing.T) {
+	tests := []struct {
+		name   string
+		decode func([]byte) (any, error)
+		body   []byte
+	}{
+		{"msgpack depth", decodeMsgPack, bytes.Repeat([]byte{0x91}, 100)},
+		{"msgpack huge array", decodeMsgPack, []byte{0xdd, 0xff, 0xff, 0xff, 0xff}},
+		{"msgpack trailing", decodeMsgPack, []byte{0xc0, 0xc0}},
+		{"cbor depth", decodeCBOR, bytes.Repeat([]byte{0x81}, 100)},
+		{"cbor huge map", decodeCBOR, []byte{0xbb, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}},
+		{"cbor stray break", decodeCBOR, []byte{0x9f, 0x81, 0xff}},
+		{"cbor reserved", decodeCBOR, []byte{0x1c}},
+	}
+	for _, tt := range tests {
+		if _, err := tt.decode(tt.body); err == nil {
+			t.Errorf("%s: expected an error", tt.name)
+		}
+	}
+}
+
+func TestBinaryDecoderWithoutDepthLimit(t *testing.T) {
+	limit := maxJSONDepth
+	maxJSONDepth = 0
+	t.Cleanup(func() { maxJSONDepth = limit })
+
+	if _, err := decodeMsgPack(append(bytes.Repeat([]byte{0x91}, 100), 0xc0)); err != nil {
+		t.Errorf("expected deep MessagePack to be accepted with no limit, got %v", err)
+	}
+	if _, err := decodeCBOR(append(bytes.Repeat([]byte{0x81}, 100), 0xf6)); err != nil {
+		t.Errorf("expected deep CBOR to be accepted with no limit, got %v", err)
+	}
+}
+
+func TestRegisterFormat(t *testing.T) {
+	RegisterFormat("Text/CSV", BodyFormat{Name: "CSV", Code: "invalid_csv", Parser: ParserFunc(func(body []byte) (WebhookParams, error) {
+		event, _, _ := strings.Cut(string(body), ",")
+		return WebhookParams{EventType: event, Payload: map[string]any{}}, nil
+	})})
+	t.Cleanup(func() { delete(bodyFormats, "text/csv") })
+
+	mux := newTestServer()
+	postBody(t, mux, "text/csv; charset=utf-8", []byte("shipment,42"))
+	if got := queryWebhooks(t, mux, "/query/shipment"); len(got) != 1 {
+		t.Errorf("expected the registered parser to be used, got %d records", len(got))
+	}
+}
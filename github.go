@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/url"
+)
+
+// githubRecordPings makes GitHub ping events, sent when a hook is created,
+// be recorded like any other event instead of only being acknowledged.
+var githubRecordPings bool
+
+// GitHubDelivery holds the GitHub webhook headers of a delivery.
+// Redeliveries reuse the delivery GUID, which is used as the idempotency
+// key, so they show up as extra deliveries of one record.
+type GitHubDelivery struct {
+	Event    string `json:"event"`
+	Delivery string `json:"delivery"`
+	HookID   string `json:"hook_id,omitempty"`
+	Target   string `json:"target,omitempty"`
+}
+
+func githubDelivery(h http.Header) *GitHubDelivery {
+	event := h.Get("X-GitHub-Event")
+	if event == "" {
+		return nil
+	}
+	return &GitHubDelivery{
+		Event:    event,
+		Delivery: h.Get("X-GitHub-Delivery"),
+		HookID:   h.Get("X-GitHub-Hook-ID"),
+		Target:   h.Get("X-GitHub-Hook-Installation-Target-Type"),
+	}
+}
+
+// githubWebhook parses a GitHub delivery. The body is the event payload,
+// either as JSON or form-encoded in a payload field. The event type is the
+// X-GitHub-Event name, with the payload's action appended if there is one,
+// e.g. "pull_request.opened".
+func githubWebhook(body []byte, contentType string, gh *GitHubDelivery) (WebhookParams, error) {
+	if isFormContentType(contentType) {
+		form, err := url.ParseQuery(string(body))
+		if err != nil {
+			return WebhookParams{}, &paramError{codeInvalidParameter, "Invalid form body: " + err.Error()}
+		}
+		body = []byte(form.Get("payload"))
+	}
+	if err := checkJSONDepth(body, maxJSONDepth); err != nil {
+		return WebhookParams{}, &paramError{codeInvalidJSON, "Invalid JSON: " + err.Error()}
+	}
+	var payload map[string]any
+	if err := decodeJSON(body, &payload); err != nil {
+		return WebhookParams{}, &paramError{codeInvalidJSON, "Invalid JSON: " + err.Error()}
+	}
+
+	event := gh.Event
+	if action, ok := payload["action"].(string); ok && action != "" {
+		event += "." + action
+	}
+	return WebhookParams{EventType: event, Payload: payload, Version: "github"}, nil
+}
+
+// ackGitHubPing answers a ping event without recording it, unless pings
+// are recorded. It reports whether it answered.
+func ackGitHubPing(w http.ResponseWriter, gh *GitHubDelivery) bool {
+	if gh == nil || gh.Event != "ping" || githubRecordPings {
+		return false
+	}
+	log.Printf("Acknowledged GitHub ping for hook %s", gh.HookID)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"ok": true, "hook_id": gh.HookID})
+	return true
+}
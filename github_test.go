@@ -0,0 +1,59 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func postGitHub(t *testing.T, mux *http.ServeMux, event, delivery, contentType, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("X-GitHub-Event", event)
+	req.Header.Set("X-GitHub-Delivery", delivery)
+	req.Header.Set("X-GitHub-Hook-ID", "42")
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestGitHubDeliveries(t *testing.T) {
+	mux := newTestServer()
+	const pr = `{"action":"opened","number":7}`
+	postGitHub(t, mux, "pull_request", "d-1", "application/json", pr)
+	rec := postGitHub(t, mux, "pull_request", "d-1", "application/json", pr)
+	if rec.Header().Get("X-Delivery-Count") != "2" {
+		t.Errorf("expected the redelivery to be detected, got count %s", rec.Header().Get("X-Delivery-Count"))
+	}
+	form := "payload=" + url.QueryEscape(`{"ref":"refs/heads/main"}`)
+	postGitHub(t, mux, "push", "d-2", "application/x-www-form-urlencoded", form)
+
+	got := queryWebhooks(t, mux, "/query/pull_request.opened?number=7")
+	if len(got) != 1 || got[0].Deliveries != 2 || got[0].GitHub == nil || got[0].GitHub.HookID != "42" {
+		t.Fatalf("expected one pull_request.opened delivered twice, got %+v", got)
+	}
+	if got := queryWebhooks(t, mux, "/query/push?ref=refs/heads/main"); len(got) != 1 || got[0].Version != "github" {
+		t.Errorf("expected the form-encoded push, got %+v", got)
+	}
+}
+
+func TestGitHubPing(t *testing.T) {
+	mux := newTestServer()
+	rec := postGitHub(t, mux, "ping", "d-3", "application/json", `{"zen":"Keep it logically awesome.","hook_id":42}`)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"ok":true`) {
+		t.Fatalf("expected the ping to be acknowledged, got %d %s", rec.Code, rec.Body.String())
+	}
+	if got := queryWebhooks(t, mux, "/query/ping"); len(got) != 0 {
+		t.Errorf("expected pings not to be recorded, got %d", len(got))
+	}
+
+	githubRecordPings = true
+	t.Cleanup(func() { githubRecordPings = false })
+	postGitHub(t, mux, "ping", "d-4", "application/json", `{"zen":"Design for failure."}`)
+	if got := queryWebhooks(t, mux, "/query/ping"); len(got) != 1 {
+		t.Errorf("expected the ping to be recorded, got %d", len(got))
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"strings"
+)
+
+// graphqlMode makes ingest treat JSON bodies shaped like GraphQL requests
+// ({"query", "operationName", "variables"}) as GraphQL. Bodies sent as
+// application/graphql are always treated as GraphQL.
+var graphqlMode bool
+
+type graphqlRequest struct {
+	Query         *string        `json:"query"`
+	OperationName string         `json:"operationName"`
+	Variables     map[string]any `json:"variables"`
+	Event         string         `json:"event"`
+}
+
+// parseGraphQLWebhook recognises GraphQL requests. ok reports whether body
+// is one; err is only set in that case. The event type is the operation
+// name, taken from operationName or else from the document, and the payload
+// mirrors the request so variables can be filtered on as variables.<name>.
+func parseGraphQLWebhook(body []byte, contentType string) (item WebhookParams, ok bool, err error) {
+	var req graphqlRequest
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch {
+	case mediaType == "application/graphql":
+		doc := string(body)
+		req.Query = &doc
+	case !graphqlMode:
+		return item, false, nil
+	default:
+		if decodeJSON(body, &req) != nil || req.Query == nil || req.Event != "" {
+			return item, false, nil
+		}
+	}
+
+	opType, opName, err := graphqlOperation(*req.Query, req.OperationName)
+	if err != nil {
+		return item, true, err
+	}
+	if req.Variables == nil {
+		req.Variables = map[string]any{}
+	}
+	item.EventType = opName
+	item.Version = "graphql"
+	item.Payload = map[string]any{
+		"query":         *req.Query,
+		"operationName": opName,
+		"operationType": opType,
+		"variables":     req.Variables,
+	}
+	return item, true, nil
+}
+
+// graphqlTokens splits a GraphQL document into names and punctuators,
+// dropping whitespace, commas, comments and string literals.
+func graphqlTokens(doc string) []string {
+	var tokens []string
+	for i := 0; i < len(doc); {
+		c := doc[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == ',':
+			i++
+		case c == '#':
+			for i < len(doc) && doc[i] != '\n' {
+				i++
+			}
+		case c == '"':
+			if strings.HasPrefix(doc[i:], `"""`) {
+				end := strings.Index(doc[i+3:], `"""`)
+				if end < 0 {
+					return tokens
+				}
+				i += end + 6
+				continue
+			}
+			for i++; i < len(doc) && doc[i] != '"'; i++ {
+				if doc[i] == '\\' {
+					i++
+				}
+			}
+			i++
+		case c == '_' || c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z':
+			start := i
+			for i < len(doc) && (doc[i] == '_' || doc[i] >= 'A' && doc[i] <= 'Z' || doc[i] >= 'a' && doc[i] <= 'z' || doc[i] >= '0' && doc[i] <= '9') {
+				i++
+			}
+			tokens = append(tokens, doc[start:i])
+		default:
+			tokens = append(tokens, string(c))
+			i++
+		}
+	}
+	return tokens
+}
+
+// graphqlOperation finds the operation to classify a document by: the one
+// named operationName if given, otherwise the first. Anonymous operations
+// are named after their first root field, e.g. "mutation { orderShipped }"
+// becomes orderShipped.
+func graphqlOperation(doc, operationName string) (opType, name string, err error) {
+	tokens := graphqlTokens(doc)
+	for i := 0; i < len(tokens); {
+		opType, name = "query", ""
+		fragment := false
+		switch tokens[i] {
+		case "query", "mutation", "subscription":
+			opType = tokens[i]
+			i++
+			if i < len(tokens) && tokens[i] != "{" && tokens[i] != "(" && tokens[i] != "@" {
+				name = tokens[i]
+				i++
+			}
+		case "fragment":
+			fragment = true
+		case "{":
+		default:
+			return "", "", fmt.Errorf("unexpected %q at top level", tokens[i])
+		}
+
+		// Skip variables, type conditions and directives up to the
+		// selection set.
+		for i < len(tokens) && tokens[i] != "{" {
+			i++
+		}
+		if i+1 >= len(tokens) {
+			return "", "", errors.New("missing selection set")
+		}
+		if name == "" {
+			name = tokens[i+1]
+		}
+		for depth := 0; i < len(tokens); {
+			switch tokens[i] {
+			case "{":
+				depth++
+			case "}":
+				depth--
+			}
+			i++
+			if depth == 0 {
+				break
+			}
+		}
+
+		if !fragment && (operationName == "" || name == operationName) {
+			return opType, name, nil
+		}
+	}
+	if operationName != "" {
+		return "", "", fmt.Errorf("no operation named %q", operationName)
+	}
+	return "", "", errors.New("no operation in document")
+}
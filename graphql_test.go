@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func postGraphQL(t *testing.T, mux *http.ServeMux, contentType, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", contentType)
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestGraphQLOperation(t *testing.T) {
+	tests := []struct {
+		doc, operationName string
+		opType, name       string
+	}{
+		{`mutation OrderShipped($id: ID!) { ship(id: $id) { id } }`, "", "mutation", "OrderShipped"},
+		{`mutation { orderShipped(id: "1") { id } }`, "", "mutation", "orderShipped"},
+		{`{ viewer { login } }`, "", "query", "viewer"},
+		{`# leading "comment" {
+		  fragment F on Order { id }
+		  subscription OnOrder @live { order { ...F } }`, "", "subscription", "OnOrder"},
+		{`query A { a } mutation B { b(note: "}") }`, "B", "mutation", "B"},
+	}
+	for _, tt := range tests {
+		opType, name, err := graphqlOperation(tt.doc, tt.operationName)
+		if err != nil {
+			t.Errorf("%q: %v", tt.doc, err)
+			continue
+		}
+		if opType != tt.opType || name != tt.name {
+			t.Errorf("%q: got %s %s, want %s %s", tt.doc, opType, name, tt.opType, tt.name)
+		}
+	}
+
+	for _, bad := range []string{"", "mutation Ship", "type Order { id: ID }"} {
+		if _, _, err := graphqlOperation(bad, ""); err == nil {
+			t.Errorf("expected %q to be rejected", bad)
+		}
+	}
+	if _, _, err := graphqlOperation(`query A { a }`, "B"); err == nil {
+		t.Error("expected an unknown operationName to be rejected")
+	}
+}
+
+func TestGraphQLIngest(t *testing.T) {
+	graphqlMode = true
+	t.Cleanup(func() { graphqlMode = false })
+
+	mux := newTestServer()
+	postGraphQL(t, mux, "application/json", `{"query":"mutation OrderShipped($orderId: ID!) { ship(orderId: $orderId) }","variables":{"orderId":"42"}}`)
+	postGraphQL(t, mux, "application/json", `{"query":"mutation OrderShipped($orderId: ID!) { ship(orderId: $orderId) }","variables":{"orderId":"7"}}`)
+	postGraphQL(t, mux, "application/graphql", `mutation Refunded { refund }`)
+	postWebhook(t, mux, `{"event":"test","data":{"query":"not graphql"}}`)
+
+	got := queryWebhooks(t, mux, "/query/OrderShipped?variables.orderId=42")
+	if len(got) != 1 || got[0].Version != "graphql" || got[0].Payload["operationType"] != "mutation" {
+		t.Fatalf("expected 1 OrderShipped mutation, got %+v", got)
+	}
+	if got := queryWebhooks(t, mux, "/query/Refunded"); len(got) != 1 {
+		t.Errorf("expected the application/graphql body to be recorded, got %d", len(got))
+	}
+	if got := queryWebhooks(t, mux, "/query/test"); len(got) != 1 {
+		t.Errorf("expected webhooks with an event to bypass GraphQL parsing, got %d", len(got))
+	}
+
+	if rec := postGraphQL(t, mux, "application/json", `{"query":"mutation Ship"}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400 for an invalid document, got %d", rec.Code)
+	}
+}
+
+func TestGraphQLModeOff(t *testing.T) {
+	mux := newTestServer()
+	postGraphQL(t, mux, "application/json", `{"query":"mutation OrderShipped { ship }"}`)
+	if got := queryWebhooks(t, mux, "/query/OrderShipped"); len(got) != 0 {
+		t.Errorf("expected JSON GraphQL to need -graphql, got %d", len(got))
+	}
+}
@@ -0,0 +1,321 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf16"
+)
+
+// i18nReplayWait bounds how long the i18n check waits for the replayed
+// deliveries once the server has answered POST /replay.
+const i18nReplayWait = 5 * time.Second
+
+// i18nCase is a piece of text known to be mangled by webhook pipelines.
+type i18nCase struct {
+	name, text string
+}
+
+var i18nCorpus = []i18nCase{
+	{"emoji", "👍🏽 🎉 ❤\ufe0f"},
+	{"zwj-sequence", "👩\u200d👩\u200d👧\u200d👦 🏳\ufe0f\u200d🌈"},
+	{"flags", "🇺🇦 🇯🇵 🏴\U000e0067\U000e0062\U000e0073\U000e0063\U000e0074\U000e007f"},
+	{"astral-plane", "𝄞 𠜎𠜱 𓀀"},
+	{"arabic-rtl", "مرحبا بالعالم ١٢٣"},
+	{"hebrew-bidi", "\u202bשלום עולם\u202c abc \u200fא\u200e"},
+	{"nfc", "caf\u00e9 \u00c5ngstr\u00f6m"},
+	{"nfd", "cafe\u0301 A\u030angstro\u0308m"},
+	{"hangul-jamo", "\ud55c\uae00 \u1112\u1161\u11ab\u1100\u1173\u11af"},
+	{"combining-stack", "Z\u0351\u036b\u0343\u036a\u0302\u036b\u033d\u034f\u0334\u0319"},
+	{"invisible", "\ufeffBOM\u200bzero\u200dwidth\u2060joiner\u00ad"},
+	{"line-separators", "line\u2028separator\u2029paragraph"},
+	{"noncharacters", "\ufffe\uffff\U0001fffe"},
+	{"cjk-mixed", "日本語テキスト 中文 한국어"},
+	{"indic", "नमस्ते दुनिया ক্ষ"},
+}
+
+// i18nForms are how each case's text is written into the JSON body: as is,
+// or with every non-ASCII character \u-escaped, astral ones as surrogate
+// pairs.
+var i18nForms = []string{"utf8", "escaped"}
+
+// i18nCommand is "webhook-echo i18n [-url URL] [-generate]". It posts the
+// non-ASCII corpus to a running server and checks that every text comes back
+// unchanged from storage, from the raw body, from a cassette export and,
+// unless -replay-listen is empty, from a replay to a listener it starts.
+// With -generate it prints the bodies instead, one per line.
+func i18nCommand(fs *flag.FlagSet) func(args []string, stdin io.Reader, stdout io.Writer) error {
+	var opts i18nOptions
+	fs.StringVar(&opts.server, "url", "http://localhost:8080", "Base URL of the webhook-echo server")
+	fs.StringVar(&opts.adminToken, "admin-token", "", "Admin token of the server, needed for the replay check; defaults to the token of -remote")
+	fs.StringVar(&opts.replayListen, "replay-listen", "127.0.0.1:0", "Address to receive replayed webhooks on, reachable from the server; empty skips the replay check")
+	fs.BoolVar(&opts.generate, "generate", false, "Print the corpus as webhook bodies, one per line, instead of checking a server")
+	return func(args []string, stdin io.Reader, stdout io.Writer) error {
+		if len(args) > 0 {
+			return errors.New("i18n takes no arguments")
+		}
+		return i18nCheck(opts, stdout)
+	}
+}
+
+type i18nOptions struct {
+	server, adminToken, replayListen string
+	generate                         bool
+}
+
+// i18nResult is one stage of the round trip of one case in one form.
+type i18nResult struct {
+	Case   string `json:"case"`
+	Form   string `json:"form"`
+	Stage  string `json:"stage"`
+	OK     bool   `json:"ok"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// i18nBody is a posted body, with the payload it must decode to.
+type i18nBody struct {
+	i18nCase
+	form    string
+	body    []byte
+	payload map[string]any
+	id      string
+}
+
+// i18nBodies renders the corpus under eventType in every form.
+func i18nBodies(eventType string) []*i18nBody {
+	var bodies []*i18nBody
+	for _, c := range i18nCorpus {
+		for _, form := range i18nForms {
+			quote := jsonQuote
+			if form == "escaped" {
+				quote = jsonQuoteASCII
+			}
+			// The text is also a key, which pipelines re-encode separately.
+			body := fmt.Sprintf(`{"event":%s,"data":{"case":%s,"form":%s,"text":%s,"keys":{%s:%s}}}`,
+				jsonQuote(eventType), jsonQuote(c.name), jsonQuote(form), quote(c.text), quote(c.text), quote(c.name))
+			bodies = append(bodies, &i18nBody{
+				i18nCase: c,
+				form:     form,
+				body:     []byte(body),
+				payload: map[string]any{
+					"case": c.name, "form": form, "text": c.text,
+					"keys": map[string]any{c.text: c.name},
+				},
+			})
+		}
+	}
+	return bodies
+}
+
+// jsonQuote quotes s as a JSON string, leaving non-ASCII characters as is.
+func jsonQuote(s string) string {
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	enc.Encode(s)
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// jsonQuoteASCII quotes s as a JSON string of ASCII characters only.
+func jsonQuoteASCII(s string) string {
+	var b strings.Builder
+	for _, r := range jsonQuote(s) {
+		if r < 0x80 {
+			b.WriteRune(r)
+			continue
+		}
+		for _, u := range utf16.Encode([]rune{r}) {
+			fmt.Fprintf(&b, `\u%04x`, u)
+		}
+	}
+	return b.String()
+}
+
+func i18nCheck(opts i18nOptions, stdout io.Writer) error {
+	id := make([]byte, 4)
+	rand.Read(id)
+	eventType := "i18n-check." + hex.EncodeToString(id)
+	bodies := i18nBodies(eventType)
+	if opts.generate {
+		for _, b := range bodies {
+			if _, err := fmt.Fprintf(stdout, "%s\n", b.body); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	client, err := newServerClient(opts.server, opts.adminToken)
+	if err != nil {
+		return err
+	}
+	var results []i18nResult
+	record := func(b *i18nBody, stage string, err error) {
+		result := i18nResult{Case: b.name, Form: b.form, Stage: stage, OK: err == nil}
+		if err != nil {
+			result.Detail = err.Error()
+		}
+		results = append(results, result)
+	}
+
+	for _, b := range bodies {
+		// Posted without the token, which the record would keep.
+		resp, err := http.Post(client.base+"/", "application/json", bytes.NewReader(b.body))
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		b.id = resp.Header.Get("X-Echo-Id")
+		if resp.StatusCode >= 300 || b.id == "" {
+			return fmt.Errorf("POST %s: %s without a record id", client.base+"/", resp.Status)
+		}
+	}
+
+	for _, b := range bodies {
+		var stored WebhookParams
+		err := client.call(http.MethodGet, "/webhooks/"+url.PathEscape(b.id), nil, &stored)
+		if err == nil {
+			err = comparePayload(b.payload, stored.Payload)
+		}
+		record(b, "storage", err)
+
+		raw, err := client.get("/webhooks/" + url.PathEscape(b.id) + "/raw")
+		if err == nil && !bytes.Equal(raw, b.body) {
+			err = fmt.Errorf("raw body differs: got %q", raw)
+		}
+		record(b, "raw", err)
+	}
+
+	var cassette Cassette
+	err = client.call(http.MethodGet, "/cassette/"+url.PathEscape(eventType), nil, &cassette)
+	exported := make(map[string]bool)
+	for _, in := range cassette.Interactions {
+		exported[in.Request.Body] = true
+	}
+	for _, b := range bodies {
+		stageErr := err
+		if stageErr == nil && !exported[string(b.body)] {
+			stageErr = errors.New("body not found unchanged in the cassette")
+		}
+		record(b, "export", stageErr)
+	}
+
+	if opts.replayListen != "" {
+		replayed, err := i18nReplay(client, opts.replayListen, eventType, len(bodies))
+		for _, b := range bodies {
+			stageErr := err
+			if stageErr == nil {
+				if got, ok := replayed[b.name+"/"+b.form]; !ok {
+					stageErr = errors.New("not replayed")
+				} else {
+					stageErr = comparePayload(b.payload, got)
+				}
+			}
+			record(b, "replay", stageErr)
+		}
+	}
+
+	failed := 0
+	for _, r := range results {
+		if !r.OK {
+			failed++
+		}
+	}
+	out := &outputPrinter{w: stdout}
+	err = out.Print(results, func() error {
+		for _, r := range results {
+			status := "ok"
+			if !r.OK {
+				status = "FAIL"
+			}
+			line := fmt.Sprintf("%-4s %-16s %-7s %s", status, r.Case, r.Form, r.Stage)
+			if r.Detail != "" {
+				line += ": " + r.Detail
+			}
+			if _, err := fmt.Fprintln(stdout, line); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d checks failed", failed, len(results))
+	}
+	return nil
+}
+
+// i18nReplay replays the records of eventType to a listener on listen and
+// returns the payloads it receives, by case and form.
+func i18nReplay(client *serverClient, listen, eventType string, want int) (map[string]map[string]any, error) {
+	ln, err := net.Listen("tcp", listen)
+	if err != nil {
+		return nil, err
+	}
+	var mu sync.Mutex
+	received := make(map[string]map[string]any)
+	done := make(chan struct{})
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Payload map[string]any `json:"data"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		c, _ := body.Payload["case"].(string)
+		form, _ := body.Payload["form"].(string)
+		mu.Lock()
+		received[c+"/"+form] = body.Payload
+		if len(received) == want {
+			close(done)
+		}
+		mu.Unlock()
+	})}
+	go server.Serve(ln)
+	defer server.Close()
+
+	var results []ReplayResult
+	err = client.call(http.MethodPost, "/replay", ReplayRequest{
+		URL:    "http://" + ln.Addr().String() + "/",
+		Match:  json.RawMessage(fmt.Sprintf(`{"event_type":%s}`, jsonQuote(eventType))),
+		Scheme: "github",
+		Secret: "i18n-check",
+	}, &results)
+	if err != nil {
+		return nil, err
+	}
+	select {
+	case <-done:
+	case <-time.After(i18nReplayWait):
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	return received, nil
+}
+
+// comparePayload reports how got differs from want, naming the first
+// string that changed along with its code points.
+func comparePayload(want, got map[string]any) error {
+	if reflect.DeepEqual(want, got) {
+		return nil
+	}
+	if w, g := want["text"].(string), fmt.Sprint(got["text"]); w != g {
+		return fmt.Errorf("text changed from %+q to %+q", w, g)
+	}
+	return fmt.Errorf("payload changed to %+q", fmt.Sprint(got))
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestI18nRoundTrip(t *testing.T) {
+	buffer := NewRingBuffer(100)
+	mux := http.NewServeMux()
+	registerRoutes(mux, buffer, "secret")
+	handleAPI(mux, "POST /replay", requireAdmin("secret", replayHandler(buffer, http.DefaultClient)))
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	var out strings.Builder
+	err := runSubcommand("i18n", []string{"-url", server.URL, "-admin-token", "secret", "-output", "json"}, nil, &out)
+	if err != nil {
+		t.Fatalf("i18n check failed: %v\n%s", err, out.String())
+	}
+	var results []i18nResult
+	if err := json.Unmarshal([]byte(out.String()), &results); err != nil {
+		t.Fatal(err)
+	}
+	if want := len(i18nCorpus) * len(i18nForms) * 4; len(results) != want {
+		t.Fatalf("expected %d results, got %d", want, len(results))
+	}
+	stages := make(map[string]bool)
+	for _, r := range results {
+		stages[r.Stage] = true
+	}
+	if len(stages) != 4 {
+		t.Errorf("expected storage, raw, export and replay checked, got %v", stages)
+	}
+}
+
+func TestI18nReportsMangling(t *testing.T) {
+	want := map[string]any{"text": "cafe\u0301"}
+	err := comparePayload(want, map[string]any{"text": "caf\u00e9"})
+	if err == nil || !strings.Contains(err.Error(), `"cafe\u0301" to "caf\u00e9"`) {
+		t.Errorf("expected the changed code points reported, got %v", err)
+	}
+	if err := comparePayload(want, map[string]any{"text": "cafe\u0301"}); err != nil {
+		t.Errorf("expected equal payloads to pass, got %v", err)
+	}
+}
+
+func TestI18nGenerate(t *testing.T) {
+	var out strings.Builder
+	if err := runSubcommand("i18n", []string{"-generate"}, nil, &out); err != nil {
+		t.Fatal(err)
+	}
+	lines := 0
+	scanner := bufio.NewScanner(strings.NewReader(out.String()))
+	for scanner.Scan() {
+		lines++
+		var body struct {
+			Payload map[string]any `json:"data"`
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &body); err != nil {
+			t.Fatalf("invalid body %s: %v", scanner.Text(), err)
+		}
+		if body.Payload["form"] == "escaped" && strings.ContainsFunc(scanner.Text(), func(r rune) bool { return r >= 0x80 }) {
+			t.Errorf("escaped body has non-ASCII characters: %s", scanner.Text())
+		}
+	}
+	if lines != len(i18nCorpus)*len(i18nForms) {
+		t.Errorf("expected every case in every form, got %d bodies", lines)
+	}
+	if got := jsonQuoteASCII("\U0001d11e"); got != `"\ud834\udd1e"` {
+		t.Errorf("expected a surrogate pair, got %s", got)
+	}
+}
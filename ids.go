@@ -0,0 +1,228 @@
+package main
+
+import (
+	"cmp"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ID strategies, chosen with -id-strategy.
+const (
+	idRandom    = "random"
+	idUUIDv7    = "uuidv7"
+	idULID      = "ulid"
+	idSnowflake = "snowflake"
+)
+
+// snowflakeEpoch is the millisecond the snowflake timestamps count from.
+var snowflakeEpoch = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// crockford is the ULID alphabet, Crockford's base32.
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// recordIDs generates the IDs of stored records.
+var recordIDs = &IDGenerator{strategy: idRandom}
+
+// IDGenerator makes record IDs under one strategy. The random strategy, the
+// default, gives 128-bit hex IDs. The others are time-ordered: UUIDv7 and
+// ULID IDs of one instance sort as text in the order they were made, and
+// snowflake IDs, decimal numbers, sort by value. UUIDv7 and ULID are unique
+// across instances by their randomness; snowflake IDs carry a 10-bit node
+// number instead, which must differ between instances.
+type IDGenerator struct {
+	strategy string
+	node     uint16
+	now      func() time.Time
+
+	mu sync.Mutex
+	// last is the millisecond of the latest ID, and seq its counter within
+	// that millisecond.
+	last int64
+	seq  uint64
+	ulid [10]byte
+}
+
+// NewIDGenerator returns a generator for strategy. node is the snowflake
+// node number; a negative one is derived from -instance-id.
+func NewIDGenerator(strategy string, node int) (*IDGenerator, error) {
+	switch strategy {
+	case idRandom, idUUIDv7, idULID, idSnowflake:
+	default:
+		return nil, fmt.Errorf("unknown ID strategy %q, expected random, uuidv7, ulid or snowflake", strategy)
+	}
+	if node < 0 {
+		h := fnv.New32a()
+		h.Write([]byte(instanceID))
+		node = int(h.Sum32() % 1024)
+	}
+	if node > 1023 {
+		return nil, fmt.Errorf("snowflake node must be between 0 and 1023, got %d", node)
+	}
+	return &IDGenerator{strategy: strategy, node: uint16(node), now: time.Now}, nil
+}
+
+// TimeOrdered reports whether IDs sort in the order they were made, so that
+// after_id and before_id can page through records.
+func (g *IDGenerator) TimeOrdered() bool {
+	return g.strategy != idRandom
+}
+
+// Compare orders two IDs of a time-ordered strategy.
+func (g *IDGenerator) Compare(a, b string) int {
+	if g.strategy == idSnowflake {
+		// Decimal numbers without leading zeros: longer is larger.
+		return cmp.Or(cmp.Compare(len(a), len(b)), strings.Compare(a, b))
+	}
+	if g.strategy == idULID {
+		a, b = strings.ToUpper(a), strings.ToUpper(b)
+	}
+	return strings.Compare(a, b)
+}
+
+// Next returns a new ID.
+func (g *IDGenerator) Next() string {
+	if g.strategy == idRandom {
+		return newRecordID()
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	ms := g.now().UnixMilli()
+	switch g.strategy {
+	case idUUIDv7:
+		return g.uuidv7(ms)
+	case idULID:
+		return g.nextULID(ms)
+	}
+	return g.snowflake(ms)
+}
+
+// tick advances the clock to ms, or keeps the latest millisecond when the
+// clock went back, and returns it along with whether it is a new one.
+func (g *IDGenerator) tick(ms int64) (int64, bool) {
+	if ms > g.last {
+		g.last = ms
+		return ms, true
+	}
+	return g.last, false
+}
+
+// uuidv7 makes an RFC 9562 UUIDv7 whose 12-bit rand_a field is a counter
+// within the millisecond, started at a random value.
+func (g *IDGenerator) uuidv7(ms int64) string {
+	var b [16]byte
+	rand.Read(b[:])
+	ms, fresh := g.tick(ms)
+	if fresh {
+		g.seq = uint64(binary.BigEndian.Uint16(b[6:]) & 0x7ff)
+	} else if g.seq++; g.seq > 0xfff {
+		// The counter ran out: borrow the next millisecond.
+		g.last++
+		ms, g.seq = g.last, 0
+	}
+	binary.BigEndian.PutUint64(b[:8], uint64(ms)<<16|g.seq)
+	b[6] = 0x70 | b[6]&0x0f
+	b[8] = 0x80 | b[8]&0x3f
+	h := hex.EncodeToString(b[:])
+	return h[:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:]
+}
+
+// nextULID makes a monotonic ULID: within a millisecond the random part of
+// the previous one is incremented.
+func (g *IDGenerator) nextULID(ms int64) string {
+	ms, fresh := g.tick(ms)
+	if fresh {
+		rand.Read(g.ulid[:])
+	} else {
+		i := len(g.ulid) - 1
+		for ; i >= 0; i-- {
+			if g.ulid[i]++; g.ulid[i] != 0 {
+				break
+			}
+		}
+		if i < 0 {
+			g.last++
+			ms = g.last
+			rand.Read(g.ulid[:])
+		}
+	}
+	var b [16]byte
+	binary.BigEndian.PutUint16(b[:2], uint16(ms>>32))
+	binary.BigEndian.PutUint32(b[2:6], uint32(ms))
+	copy(b[6:], g.ulid[:])
+	hi, lo := binary.BigEndian.Uint64(b[:8]), binary.BigEndian.Uint64(b[8:])
+	var s [26]byte
+	// 26 characters of 5 bits cover 130 bits, the first holding 3.
+	for i := 25; i >= 0; i-- {
+		s[i] = crockford[lo&31]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(s[:])
+}
+
+// snowflake makes a 63-bit ID of 41 bits of milliseconds since
+// snowflakeEpoch, the 10-bit node and a 12-bit sequence.
+func (g *IDGenerator) snowflake(ms int64) string {
+	ms, fresh := g.tick(ms)
+	if fresh {
+		g.seq = 0
+	} else if g.seq++; g.seq > 0xfff {
+		g.last++
+		ms, g.seq = g.last, 0
+	}
+	id := uint64(ms-snowflakeEpoch.UnixMilli())<<22 | uint64(g.node)<<12 | g.seq
+	return strconv.FormatUint(id, 10)
+}
+
+// IDStrategyStatus describes how record IDs are made.
+type IDStrategyStatus struct {
+	Strategy    string `json:"strategy"`
+	TimeOrdered bool   `json:"time_ordered"`
+	// Node is the snowflake node number.
+	Node *uint16 `json:"node,omitempty"`
+}
+
+func (g *IDGenerator) Status() IDStrategyStatus {
+	status := IDStrategyStatus{Strategy: g.strategy, TimeOrdered: g.TimeOrdered()}
+	if g.strategy == idSnowflake {
+		status.Node = &g.node
+	}
+	return status
+}
+
+// idStrategyHandler serves GET /id-strategy.
+func idStrategyHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(recordIDs.Status())
+	}
+}
+
+// parseIDRange takes the after_id and before_id parameters out of params.
+// They need a time-ordered strategy.
+func parseIDRange(params url.Values) (after, before string, err error) {
+	after, before = params.Get("after_id"), params.Get("before_id")
+	delete(params, "after_id")
+	delete(params, "before_id")
+	if (after != "" || before != "") && !recordIDs.TimeOrdered() {
+		return "", "", &paramError{codeInvalidParameter, "after_id and before_id need a time-ordered -id-strategy, not " + recordIDs.strategy}
+	}
+	return after, before, nil
+}
+
+// inIDRange reports whether id is after after and before before, each
+// unset when empty.
+func inIDRange(id, after, before string) bool {
+	return (after == "" || recordIDs.Compare(id, after) > 0) &&
+		(before == "" || recordIDs.Compare(id, before) < 0)
+}
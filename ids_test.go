@@ -0,0 +1,103 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIDStrategiesAreTimeOrdered(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	for _, strategy := range []string{idUUIDv7, idULID, idSnowflake} {
+		g, err := NewIDGenerator(strategy, 7)
+		if err != nil {
+			t.Fatal(err)
+		}
+		g.now = func() time.Time { return now }
+		prev := g.Next()
+		// Far more IDs than one millisecond's counter holds, and a clock
+		// that goes back halfway.
+		for i := 0; i < 10000; i++ {
+			if i == 5000 {
+				g.now = func() time.Time { return now.Add(-time.Second) }
+			}
+			id := g.Next()
+			if g.Compare(id, prev) <= 0 || (strategy != idSnowflake && id <= prev) {
+				t.Fatalf("%s: %s does not sort after %s", strategy, id, prev)
+			}
+			prev = id
+		}
+	}
+}
+
+func TestIDFormats(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	newID := func(strategy string) string {
+		g, err := NewIDGenerator(strategy, 7)
+		if err != nil {
+			t.Fatal(err)
+		}
+		g.now = func() time.Time { return now }
+		return g.Next()
+	}
+
+	uuid := newID(idUUIDv7)
+	if len(uuid) != 36 || uuid[14] != '7' || !strings.ContainsAny(uuid[19:20], "89ab") {
+		t.Errorf("not a UUIDv7: %s", uuid)
+	}
+	if ms, _ := strconv.ParseInt(strings.ReplaceAll(uuid[:13], "-", ""), 16, 64); ms != now.UnixMilli() {
+		t.Errorf("UUIDv7 %s has timestamp %d, want %d", uuid, ms, now.UnixMilli())
+	}
+
+	ulid := newID(idULID)
+	var ms int64
+	for _, c := range ulid[:10] {
+		ms = ms<<5 | int64(strings.IndexRune(crockford, c))
+	}
+	if len(ulid) != 26 || ms != now.UnixMilli() {
+		t.Errorf("ULID %s has timestamp %d, want %d", ulid, ms, now.UnixMilli())
+	}
+
+	n, err := strconv.ParseUint(newID(idSnowflake), 10, 64)
+	if err != nil || n>>12&1023 != 7 || int64(n>>22) != now.Sub(snowflakeEpoch).Milliseconds() {
+		t.Errorf("unexpected snowflake %d: %v", n, err)
+	}
+
+	if _, err := NewIDGenerator("uuidv4", -1); err == nil {
+		t.Error("expected an unknown strategy to be refused")
+	}
+	if _, err := NewIDGenerator(idSnowflake, 1024); err == nil {
+		t.Error("expected an out of range node to be refused")
+	}
+}
+
+func TestQueryByIDRange(t *testing.T) {
+	saved := recordIDs
+	t.Cleanup(func() { recordIDs = saved })
+	mux := newTestServer()
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/query/page?after_id=x", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected after_id refused with random IDs, got %d", rec.Code)
+	}
+
+	recordIDs, _ = NewIDGenerator(idULID, -1)
+	var ids []string
+	for i := 0; i < 5; i++ {
+		ids = append(ids, postWebhook(t, mux, `{"event":"page","data":{"n":`+strconv.Itoa(i)+`}}`).Header().Get("X-Echo-Id"))
+	}
+	items := queryWebhooks(t, mux, "/query/page?after_id="+ids[1]+"&before_id="+strings.ToLower(ids[4]))
+	if len(items) != 2 || items[0].ID != ids[3] || items[1].ID != ids[2] {
+		t.Errorf("expected the records between the IDs, got %+v", items)
+	}
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/id-strategy", nil))
+	if !strings.Contains(rec.Body.String(), `"strategy":"ulid","time_ordered":true`) {
+		t.Errorf("unexpected strategy %s", rec.Body)
+	}
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// serviceLabel is the launchd label prefix, in reverse DNS order.
+const serviceLabel = "io.dichev."
+
+// ServicePlan is what installing the service takes on one platform: a file
+// to write, if any, and the commands that register and start it.
+type ServicePlan struct {
+	Path     string
+	Content  string
+	Commands [][]string
+}
+
+// servicePlan builds the plan for running exe with args as a service named
+// name. A user service runs as the current user from login, a system one
+// from boot.
+func servicePlan(goos, name string, user bool, home, exe string, args []string) (ServicePlan, error) {
+	argv := append([]string{exe}, args...)
+	switch goos {
+	case "linux":
+		dir, target, systemctl := "/etc/systemd/system", "multi-user.target", []string{"systemctl"}
+		if user {
+			dir, target, systemctl = filepath.Join(home, ".config/systemd/user"), "default.target", []string{"systemctl", "--user"}
+		}
+		quoted := make([]string, len(argv))
+		for i, arg := range argv {
+			quoted[i] = systemdQuote(arg)
+		}
+		return ServicePlan{
+			Path: filepath.Join(dir, name+".service"),
+			Content: "[Unit]\nDescription=webhook-echo capture server\nAfter=network-online.target\nWants=network-online.target\n\n" +
+				"[Service]\nExecStart=" + strings.Join(quoted, " ") + "\nRestart=on-failure\n\n" +
+				"[Install]\nWantedBy=" + target + "\n",
+			Commands: [][]string{
+				append(systemctl, "daemon-reload"),
+				append(systemctl, "enable", "--now", name+".service"),
+			},
+		}, nil
+
+	case "darwin":
+		dir, logs := "/Library/LaunchDaemons", "/Library/Logs"
+		if user {
+			dir, logs = filepath.Join(home, "Library/LaunchAgents"), filepath.Join(home, "Library/Logs")
+		}
+		var b strings.Builder
+		b.WriteString(`<?xml version="1.0" encoding="UTF-8"?>` + "\n")
+		b.WriteString(`<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">` + "\n")
+		b.WriteString("<plist version=\"1.0\">\n<dict>\n")
+		fmt.Fprintf(&b, "\t<key>Label</key>\n\t<string>%s</string>\n", xmlText(serviceLabel+name))
+		b.WriteString("\t<key>ProgramArguments</key>\n\t<array>\n")
+		for _, arg := range argv {
+			fmt.Fprintf(&b, "\t\t<string>%s</string>\n", xmlText(arg))
+		}
+		b.WriteString("\t</array>\n\t<key>RunAtLoad</key>\n\t<true/>\n\t<key>KeepAlive</key>\n\t<true/>\n")
+		logFile := xmlText(filepath.Join(logs, name+".log"))
+		fmt.Fprintf(&b, "\t<key>StandardOutPath</key>\n\t<string>%s</string>\n\t<key>StandardErrorPath</key>\n\t<string>%s</string>\n", logFile, logFile)
+		b.WriteString("</dict>\n</plist>\n")
+		path := filepath.Join(dir, serviceLabel+name+".plist")
+		return ServicePlan{
+			Path:     path,
+			Content:  b.String(),
+			Commands: [][]string{{"launchctl", "load", "-w", path}},
+		}, nil
+
+	case "windows":
+		// A Windows service has to speak the service control protocol, which
+		// the standard library does not, so a scheduled task keeps the
+		// server running instead.
+		quoted := make([]string, len(argv))
+		for i, arg := range argv {
+			quoted[i] = windowsQuote(arg)
+		}
+		cmdline := strings.Join(quoted, " ")
+		if len(cmdline) > 261 {
+			return ServicePlan{}, fmt.Errorf("command line is %d characters, scheduled tasks allow 261; use environment variables for long settings", len(cmdline))
+		}
+		create := []string{"schtasks", "/Create", "/F", "/TN", name, "/TR", cmdline, "/SC", "ONSTART", "/RU", "SYSTEM"}
+		if user {
+			create = []string{"schtasks", "/Create", "/F", "/TN", name, "/TR", cmdline, "/SC", "ONLOGON"}
+		}
+		return ServicePlan{Commands: [][]string{create, {"schtasks", "/Run", "/TN", name}}}, nil
+	}
+	return ServicePlan{}, fmt.Errorf("installing a service is not supported on %s", goos)
+}
+
+// systemdQuote quotes an ExecStart argument, escaping the specifiers and
+// variables systemd would otherwise expand.
+func systemdQuote(arg string) string {
+	arg = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "%", "%%", "$", "$$").Replace(arg)
+	return `"` + arg + `"`
+}
+
+func xmlText(s string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(s)
+}
+
+// windowsQuote quotes an argument the way the C runtime parses command
+// lines: backslashes only escape when they precede a quote.
+func windowsQuote(arg string) string {
+	if arg != "" && !strings.ContainsAny(arg, " \t\"") {
+		return arg
+	}
+	var b strings.Builder
+	b.WriteByte('"')
+	slashes := 0
+	for _, c := range arg {
+		switch c {
+		case '\\':
+			slashes++
+			continue
+		case '"':
+			b.WriteString(strings.Repeat(`\`, 2*slashes+1))
+		default:
+			b.WriteString(strings.Repeat(`\`, slashes))
+		}
+		slashes = 0
+		b.WriteRune(c)
+	}
+	b.WriteString(strings.Repeat(`\`, 2*slashes))
+	b.WriteByte('"')
+	return b.String()
+}
+
+// installCommand is "webhook-echo install [-user] [-name n] [-dry-run]
+// [-- server flags]". It registers this binary as a service running the
+// server with the flags given after --.
+func installCommand(fs *flag.FlagSet) func(args []string, stdin io.Reader, stdout io.Writer) error {
+	name := fs.String("name", "webhook-echo", "Service name")
+	user := fs.Bool("user", false, "Install a service for the current user instead of a system one")
+	dryRun := fs.Bool("dry-run", false, "Print the service file and commands instead of applying them")
+	return func(args []string, stdin io.Reader, stdout io.Writer) error {
+		return installService(*name, *user, *dryRun, args, stdout)
+	}
+}
+
+// installedService is the -output form of an install or its dry run.
+type installedService struct {
+	Name       string     `json:"name"`
+	Executable string     `json:"executable"`
+	Path       string     `json:"path,omitempty"`
+	Content    string     `json:"content,omitempty"`
+	Commands   [][]string `json:"commands"`
+	Installed  bool       `json:"installed"`
+}
+
+func installService(name string, user, dryRun bool, serverArgs []string, stdout io.Writer) error {
+	if name == "" || strings.ContainsAny(name, `/\ `) {
+		return errors.New("-name must be a plain name")
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	if resolved, err := filepath.EvalSymlinks(exe); err == nil {
+		exe = resolved
+	}
+	home, err := os.UserHomeDir()
+	if err != nil && user {
+		return err
+	}
+	plan, err := servicePlan(runtime.GOOS, name, user, home, exe, serverArgs)
+	if err != nil {
+		return err
+	}
+
+	out := &outputPrinter{w: stdout}
+	result := installedService{Name: name, Executable: exe, Path: plan.Path, Commands: plan.Commands}
+	if dryRun {
+		result.Content = plan.Content
+		return out.Print(result, func() error {
+			if plan.Path != "" {
+				fmt.Fprintf(stdout, "# %s\n%s\n", plan.Path, plan.Content)
+			}
+			for _, cmd := range plan.Commands {
+				fmt.Fprintln(stdout, strings.Join(cmd, " "))
+			}
+			return nil
+		})
+	}
+	// Progress only goes to stdout in the text format, keeping the others
+	// parseable.
+	progress := stdout
+	if outputFormat != outputText {
+		progress = os.Stderr
+	}
+	if plan.Path != "" {
+		if err := os.MkdirAll(filepath.Dir(plan.Path), 0o755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(plan.Path, []byte(plan.Content), 0o644); err != nil {
+			return err
+		}
+		fmt.Fprintln(progress, "Wrote", plan.Path)
+	}
+	for _, argv := range plan.Commands {
+		cmd := exec.Command(argv[0], argv[1:]...)
+		cmd.Stdout, cmd.Stderr = progress, os.Stderr
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("%s: %w", strings.Join(argv, " "), err)
+		}
+	}
+	result.Installed = true
+	return out.Print(result, func() error {
+		_, err := fmt.Fprintf(stdout, "Installed %s running %s\n", name, exe)
+		return err
+	})
+}
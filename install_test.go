@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestServicePlanSystemd(t *testing.T) {
+	plan, err := servicePlan("linux", "webhook-echo", false, "/home/dev", "/opt/webhook echo/bin", []string{"-port", "9000", "-retention", "a=1m%"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plan.Path != "/etc/systemd/system/webhook-echo.service" {
+		t.Errorf("unexpected unit path %s", plan.Path)
+	}
+	if !strings.Contains(plan.Content, `ExecStart="/opt/webhook echo/bin" "-port" "9000" "-retention" "a=1m%%"`+"\n") || !strings.Contains(plan.Content, "WantedBy=multi-user.target") {
+		t.Errorf("unexpected unit\n%s", plan.Content)
+	}
+	if len(plan.Commands) != 2 || strings.Join(plan.Commands[1], " ") != "systemctl enable --now webhook-echo.service" {
+		t.Errorf("unexpected commands %v", plan.Commands)
+	}
+
+	plan, _ = servicePlan("linux", "echo", true, "/home/dev", "/bin/echo", nil)
+	if plan.Path != "/home/dev/.config/systemd/user/echo.service" || plan.Commands[0][1] != "--user" {
+		t.Errorf("unexpected user plan %+v", plan)
+	}
+}
+
+func TestServicePlanLaunchd(t *testing.T) {
+	plan, err := servicePlan("darwin", "webhook-echo", true, "/Users/dev", "/usr/local/bin/webhook-echo", []string{"-trusted-proxies", "a&b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plan.Path != "/Users/dev/Library/LaunchAgents/io.dichev.webhook-echo.plist" {
+		t.Errorf("unexpected plist path %s", plan.Path)
+	}
+	for _, want := range []string{"<string>io.dichev.webhook-echo</string>", "<string>a&amp;b</string>", "<string>/Users/dev/Library/Logs/webhook-echo.log</string>"} {
+		if !strings.Contains(plan.Content, want) {
+			t.Errorf("expected %s in\n%s", want, plan.Content)
+		}
+	}
+}
+
+func TestServicePlanWindows(t *testing.T) {
+	plan, err := servicePlan("windows", "webhook-echo", false, `C:\Users\dev`, `C:\Program Files\webhook-echo.exe`, []string{"-base-path", `say "hi"\`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plan.Path != "" || len(plan.Commands) != 2 {
+		t.Fatalf("unexpected plan %+v", plan)
+	}
+	if tr := plan.Commands[0][6]; tr != `"C:\Program Files\webhook-echo.exe" -base-path "say \"hi\"\\"` {
+		t.Errorf("unexpected task command line %s", tr)
+	}
+	if _, err := servicePlan("windows", "x", false, "", "x.exe", []string{strings.Repeat("a", 300)}); err == nil {
+		t.Error("expected an overlong command line to be rejected")
+	}
+	if _, err := servicePlan("plan9", "x", false, "", "x", nil); err == nil {
+		t.Error("expected unsupported platforms to be rejected")
+	}
+}
+
+func TestInstallDryRun(t *testing.T) {
+	var out bytes.Buffer
+	if err := runSubcommand("install", []string{"-user", "-dry-run", "--", "-port", "9000"}, nil, &out); err != nil {
+		t.Skipf("no service manager for this platform: %v", err)
+	}
+	if !strings.Contains(out.String(), "9000") {
+		t.Errorf("expected the server flags in the plan, got\n%s", out.String())
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+)
+
+// instanceHeader names the replica that served a response.
+const instanceHeader = "X-Echo-Instance"
+
+// instanceID identifies this replica on the records it captures, from
+// -instance-id or the host name, which is the pod name on Kubernetes.
+var instanceID string
+
+func defaultInstanceID() string {
+	host, _ := os.Hostname()
+	return host
+}
+
+// checkReplicas refuses to run several replicas that each keep their
+// records in memory, since a load balancer would spread senders and
+// queries over them and every query would silently see only one replica's
+// share. allowPartial accepts that, for replicas behind session affinity.
+func checkReplicas(replicas int, allowPartial bool) error {
+	if replicas <= 1 || allowPartial {
+		return nil
+	}
+	return fmt.Errorf("%d replicas would each hold only their own records in memory, so queries would return partial results; "+
+		"run a single replica, or route senders and readers to the same replica with session affinity and set -allow-partial-queries, with -peers for queries that need every replica", replicas)
+}
+
+// withInstanceHeader tells the client which replica answered, so that a
+// partial result can be traced to it.
+func withInstanceHeader(h http.Handler) http.Handler {
+	if instanceID == "" {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(instanceHeader, instanceID)
+		h.ServeHTTP(w, r)
+	})
+}
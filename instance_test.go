@@ -0,0 +1,37 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCheckReplicas(t *testing.T) {
+	if err := checkReplicas(1, false); err != nil {
+		t.Errorf("one replica refused: %v", err)
+	}
+	if err := checkReplicas(3, false); err == nil {
+		t.Error("three memory-only replicas accepted")
+	}
+	if err := checkReplicas(3, true); err != nil {
+		t.Errorf("replicas with -allow-partial-queries refused: %v", err)
+	}
+}
+
+func TestRecordsInstance(t *testing.T) {
+	instanceID = "webhook-echo-0"
+	t.Cleanup(func() { instanceID = "" })
+	mux := newTestServer()
+	postWebhook(t, mux, `{"event":"replicated","instance":"spoofed"}`)
+
+	items := queryWebhooks(t, mux, "/query/replicated")
+	if len(items) != 1 || items[0].Instance != "webhook-echo-0" {
+		t.Errorf("expected the record from webhook-echo-0, got %+v", items)
+	}
+
+	rec := httptest.NewRecorder()
+	withInstanceHeader(mux).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/query/replicated", nil))
+	if got := rec.Header().Get(instanceHeader); got != "webhook-echo-0" {
+		t.Errorf("expected %s webhook-echo-0, got %q", instanceHeader, got)
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import "fmt"
+
+// maxJSONDepth limits how deeply ingested JSON may nest objects and arrays.
+// Deep nesting costs stack and time in decoding and in every later walk of
+// the payload (filters, hashing, export), so it is refused up front.
+var maxJSONDepth = 64
+
+// checkJSONDepth reports an error if body nests objects or arrays deeper
+// than max. It only tracks brackets and strings, so it is cheap and works on
+// invalid JSON too, leaving other errors to the decoder.
+func checkJSONDepth(body []byte, max int) error {
+	if max <= 0 {
+		return nil
+	}
+	depth, inString, escaped := 0, false, false
+	for _, c := range body {
+		switch {
+		case inString:
+			switch {
+			case escaped:
+				escaped = false
+			case c == '\\':
+				escaped = true
+			case c == '"':
+				inString = false
+			}
+		case c == '"':
+			inString = true
+		case c == '{' || c == '[':
+			if depth++; depth > max {
+				return fmt.Errorf("JSON nests deeper than %d levels", max)
+			}
+		case c == '}' || c == ']':
+			depth--
+		}
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func nested(depth int) string {
+	return `{"event":"deep","data":` + strings.Repeat(`{"a":`, depth) + "1" + strings.Repeat("}", depth) + "}"
+}
+
+func TestCheckJSONDepth(t *testing.T) {
+	tests := []struct {
+		body string
+		max  int
+		ok   bool
+	}{
+		{`{"a":[1,[2]]}`, 3, true},
+		{`{"a":[1,[2]]}`, 2, false},
+		// Brackets in strings, escaped quotes included, do not count.
+		{`{"a":"[[[{\"[[["}`, 1, true},
+		{`[[[[`, 0, true},
+		{nested(63), 64, true},
+		{nested(64), 64, false},
+	}
+	for _, tt := range tests {
+		if err := checkJSONDepth([]byte(tt.body), tt.max); (err == nil) != tt.ok {
+			t.Errorf("%.40s with max %d: got %v", tt.body, tt.max, err)
+		}
+	}
+}
+
+func TestHostilePayloads(t *testing.T) {
+	mux := newTestServer()
+	tests := []struct {
+		body   string
+		status int
+		code   string
+	}{
+		{nested(100000), http.StatusBadRequest, codeInvalidJSON},
+		{`{"event":"big","data":{"n":1e999}}`, http.StatusBadRequest, codeInvalidJSON},
+		{`{"event":"big","data":{"n":` + strings.Repeat("9", 300) + `}}`, http.StatusOK, ""},
+		{`{"event":"a","event":"dup","data":{"k":1,"k":2}}`, http.StatusOK, ""},
+	}
+	for _, tt := range tests {
+		rec := postWebhook(t, mux, tt.body)
+		if rec.Code != tt.status {
+			t.Errorf("%.40s: expected status %d, got %d", tt.body, tt.status, rec.Code)
+			continue
+		}
+		if tt.code != "" {
+			if p := decodeProblem(t, rec); p.Code != tt.code {
+				t.Errorf("%.40s: expected code %s, got %s", tt.body, tt.code, p.Code)
+			}
+		}
+	}
+
+	// Duplicate keys resolve to the last occurrence, as in encoding/json.
+	got := queryWebhooks(t, mux, "/query/dup")
+	if len(got) != 1 || got[0].Payload["k"] != 2.0 {
+		t.Errorf("expected the last duplicate to win, got %+v", got)
+	}
+}
+
+func TestDeepProtoKeptAsBytes(t *testing.T) {
+	// Each level is field 1 holding the next level as a message.
+	msg := []byte{0x08, 0x01}
+	for i := 0; i < maxJSONDepth+5; i++ {
+		msg = append(binary.AppendUvarint([]byte{0x0a}, uint64(len(msg))), msg...)
+	}
+	decoded, err := decodeProtoWire(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	depth := 0
+	for v := any(decoded); ; depth++ {
+		m, ok := v.(map[string]any)
+		if !ok {
+			break
+		}
+		v = m["1"]
+	}
+	if depth != maxJSONDepth {
+		t.Errorf("expected nesting cut off at %d, got %d", maxJSONDepth, depth)
+	}
+}
+
+func FuzzParseWebhook(f *testing.F) {
+	for _, seed := range []string{
+		`{"event":"order","data":{"id":1},"version":"1"}`,
+		`{"event_type":"order","payload":{},"version":2,"received_at":1714564800}`,
+		`{"event":"a","event":"b","data":{"k":1,"k":2}}`,
+		`{"data":{"n":1e999}}`,
+		`{"data":{"n":123456789012345678901234567890}}`,
+		nested(70),
+		`{"query":"{ a { b } }","operationName":null}`,
+		`[[[["`,
+		`{"event":"\ud800"}`,
+	} {
+		f.Add([]byte(seed), "application/json")
+	}
+	f.Add([]byte(`query Q { order { id } }`), "application/graphql")
+	f.Add([]byte(`<order><id>1</id></order>`), "application/xml")
+	f.Add([]byte("\x82\xa5event\xa5order\xa4data\x81\xa2id\x01"), "application/msgpack")
+	f.Add([]byte("\xa2\x65event\x65order\x64data\xbf\x62id\x01\xff"), "application/cbor")
+
+	f.Fuzz(func(t *testing.T, body []byte, contentType string) {
+		res, err := parseWebhook(body, contentType)
+		if err != nil {
+			if _, ok := err.(*paramError); !ok {
+				t.Fatalf("expected a *paramError, got %T: %v", err, err)
+			}
+			return
+		}
+		if _, err := json.Marshal(res); err != nil {
+			t.Fatalf("parsed webhook does not marshal: %v", err)
+		}
+	})
+}
+
+func FuzzRecordWebhook(f *testing.F) {
+	f.Add([]byte(`{"event":"order","data":{"id":1}}`), "application/json")
+	f.Add([]byte(nested(1000)), "application/json")
+	f.Add([]byte("\x1f\x8b\x08\x00"), "application/json")
+	f.Add([]byte("\x00\x00\x00\x00\x02\x08\x01"), "application/grpc-web+proto")
+
+	mux := newTestServer()
+	f.Fuzz(func(t *testing.T, body []byte, contentType string) {
+		req := httptest.NewRequest(http.MethodPost, "/pkg.Service/Method", bytes.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		if rec.Code >= 500 && rec.Code != http.StatusServiceUnavailable {
+			t.Fatalf("status %d for %q", rec.Code, body)
+		}
+	})
+}
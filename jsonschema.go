@@ -0,0 +1,198 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"unicode/utf8"
+)
+
+// jsonSchema is the subset of JSON Schema that response contracts support:
+// type, enum, const, properties, required, additionalProperties, items,
+// minimum, maximum, minLength, maxLength, pattern, minItems and maxItems.
+// Other keywords are ignored, as the specification asks of unknown ones.
+type jsonSchema struct {
+	Type                 schemaTypes            `json:"type"`
+	Enum                 []any                  `json:"enum"`
+	Const                *any                   `json:"const"`
+	Properties           map[string]*jsonSchema `json:"properties"`
+	Required             []string               `json:"required"`
+	AdditionalProperties *bool                  `json:"additionalProperties"`
+	Items                *jsonSchema            `json:"items"`
+	Minimum              *float64               `json:"minimum"`
+	Maximum              *float64               `json:"maximum"`
+	MinLength            *int                   `json:"minLength"`
+	MaxLength            *int                   `json:"maxLength"`
+	Pattern              string                 `json:"pattern"`
+	MinItems             *int                   `json:"minItems"`
+	MaxItems             *int                   `json:"maxItems"`
+
+	pattern *regexp.Regexp
+}
+
+// schemaTypes is a type keyword, one type name or a list of them.
+type schemaTypes []string
+
+func (t *schemaTypes) UnmarshalJSON(b []byte) error {
+	var one string
+	if json.Unmarshal(b, &one) == nil {
+		*t = schemaTypes{one}
+		return nil
+	}
+	return json.Unmarshal(b, (*[]string)(t))
+}
+
+var schemaTypeNames = map[string]bool{"null": true, "boolean": true, "object": true, "array": true, "number": true, "string": true, "integer": true}
+
+// parseJSONSchema parses and checks a schema, compiling its patterns.
+func parseJSONSchema(raw json.RawMessage) (*jsonSchema, error) {
+	var s jsonSchema
+	if err := json.Unmarshal(raw, &s); err != nil {
+		return nil, err
+	}
+	if err := s.compile(); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func (s *jsonSchema) compile() error {
+	for _, t := range s.Type {
+		if !schemaTypeNames[t] {
+			return fmt.Errorf("unknown type %q", t)
+		}
+	}
+	if s.Pattern != "" {
+		re, err := regexp.Compile(s.Pattern)
+		if err != nil {
+			return fmt.Errorf("pattern: %w", err)
+		}
+		s.pattern = re
+	}
+	for name, prop := range s.Properties {
+		if err := prop.compile(); err != nil {
+			return fmt.Errorf("properties.%s: %w", name, err)
+		}
+	}
+	if s.Items != nil {
+		if err := s.Items.compile(); err != nil {
+			return fmt.Errorf("items: %w", err)
+		}
+	}
+	return nil
+}
+
+// Validate appends a description of each way v breaks the schema to
+// errs, naming where by path.
+func (s *jsonSchema) Validate(path string, v any, errs []string) []string {
+	fail := func(format string, args ...any) {
+		where := path
+		if where == "" {
+			where = "body"
+		}
+		errs = append(errs, where+": "+fmt.Sprintf(format, args...))
+	}
+	if len(s.Type) > 0 && !s.hasType(v) {
+		fail("expected %s, got %s", joinOr(s.Type), jsonType(v))
+		return errs
+	}
+	if s.Const != nil && !reflect.DeepEqual(*s.Const, v) {
+		fail("expected %s", encodeJSON(*s.Const))
+	}
+	if len(s.Enum) > 0 && !containsValue(s.Enum, v) {
+		fail("expected one of %s", encodeJSON(s.Enum))
+	}
+
+	switch v := v.(type) {
+	case map[string]any:
+		for _, name := range s.Required {
+			if _, ok := v[name]; !ok {
+				fail("missing required property %q", name)
+			}
+		}
+		names := make([]string, 0, len(v))
+		for name := range v {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			prop, ok := s.Properties[name]
+			switch {
+			case ok:
+				errs = prop.Validate(joinPath(path, name), v[name], errs)
+			case s.AdditionalProperties != nil && !*s.AdditionalProperties:
+				fail("unexpected property %q", name)
+			}
+		}
+	case []any:
+		if s.MinItems != nil && len(v) < *s.MinItems {
+			fail("expected at least %d items, got %d", *s.MinItems, len(v))
+		}
+		if s.MaxItems != nil && len(v) > *s.MaxItems {
+			fail("expected at most %d items, got %d", *s.MaxItems, len(v))
+		}
+		if s.Items != nil {
+			for i, item := range v {
+				errs = s.Items.Validate(path+"["+strconv.Itoa(i)+"]", item, errs)
+			}
+		}
+	case string:
+		n := utf8.RuneCountInString(v)
+		if s.MinLength != nil && n < *s.MinLength {
+			fail("expected at least %d characters, got %d", *s.MinLength, n)
+		}
+		if s.MaxLength != nil && n > *s.MaxLength {
+			fail("expected at most %d characters, got %d", *s.MaxLength, n)
+		}
+		if s.pattern != nil && !s.pattern.MatchString(v) {
+			fail("does not match %q", s.Pattern)
+		}
+	case float64:
+		if s.Minimum != nil && v < *s.Minimum {
+			fail("expected at least %v, got %v", *s.Minimum, v)
+		}
+		if s.Maximum != nil && v > *s.Maximum {
+			fail("expected at most %v, got %v", *s.Maximum, v)
+		}
+	}
+	return errs
+}
+
+func (s *jsonSchema) hasType(v any) bool {
+	for _, t := range s.Type {
+		switch t {
+		case jsonType(v):
+			return true
+		case "integer":
+			if f, ok := v.(float64); ok && f == math.Trunc(f) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func joinOr(names []string) string {
+	if len(names) == 1 {
+		return names[0]
+	}
+	return fmt.Sprintf("one of %v", names)
+}
+
+func containsValue(values []any, v any) bool {
+	for _, candidate := range values {
+		if reflect.DeepEqual(candidate, v) {
+			return true
+		}
+	}
+	return false
+}
+
+func encodeJSON(v any) string {
+	b, _ := json.Marshal(v)
+	return string(b)
+}
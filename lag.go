@@ -0,0 +1,176 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// lagSamplesPerEvent bounds how many recent lag samples are kept per event
+// type for the distribution report.
+const lagSamplesPerEvent = 1000
+
+type LagStats struct {
+	Field   string  `json:"field"`
+	Samples int     `json:"samples"`
+	Ahead   int     `json:"ahead"` // samples where the sender clock was ahead of ours
+	MinMs   float64 `json:"min_ms"`
+	MeanMs  float64 `json:"mean_ms"`
+	P50Ms   float64 `json:"p50_ms"`
+	P90Ms   float64 `json:"p90_ms"`
+	P99Ms   float64 `json:"p99_ms"`
+	MaxMs   float64 `json:"max_ms"`
+}
+
+type lagSeries struct {
+	field   string
+	samples []time.Duration
+	next    int
+}
+
+// LagTracker compares timestamps embedded in payloads with the time the
+// webhook was received, keeping a rolling window of delivery lag per event
+// type.
+type LagTracker struct {
+	fields []string
+	mu     sync.Mutex
+	series map[string]*lagSeries
+}
+
+// NewLagTracker creates a tracker reading the first timestamp found at any of
+// the given dotted payload paths.
+func NewLagTracker(fields []string) *LagTracker {
+	return &LagTracker{
+		fields: fields,
+		series: make(map[string]*lagSeries),
+	}
+}
+
+func (lt *LagTracker) OnIngest(item WebhookParams, body []byte) {
+	for _, field := range lt.fields {
+		value, ok := lookupPath(item.Payload, field)
+		if !ok {
+			continue
+		}
+		sent, ok := parseTimestamp(value)
+		if !ok {
+			continue
+		}
+		lt.record(item.EventType, field, item.ReceivedAt.Sub(sent))
+		return
+	}
+}
+
+func (lt *LagTracker) record(eventType, field string, lag time.Duration) {
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+
+	s := lt.series[eventType]
+	if s == nil {
+		s = &lagSeries{field: field}
+		lt.series[eventType] = s
+	}
+	if len(s.samples) < lagSamplesPerEvent {
+		s.samples = append(s.samples, lag)
+		return
+	}
+	s.samples[s.next] = lag
+	s.next = (s.next + 1) % lagSamplesPerEvent
+}
+
+// Report returns lag distributions keyed by event type.
+func (lt *LagTracker) Report() map[string]LagStats {
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+
+	report := make(map[string]LagStats, len(lt.series))
+	for eventType, s := range lt.series {
+		sorted := append([]time.Duration(nil), s.samples...)
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+		var total time.Duration
+		ahead := 0
+		for _, d := range sorted {
+			total += d
+			if d < 0 {
+				ahead++
+			}
+		}
+
+		report[eventType] = LagStats{
+			Field:   s.field,
+			Samples: len(sorted),
+			Ahead:   ahead,
+			MinMs:   millis(sorted[0]),
+			MeanMs:  millis(total / time.Duration(len(sorted))),
+			P50Ms:   millis(percentile(sorted, 0.50)),
+			P90Ms:   millis(percentile(sorted, 0.90)),
+			P99Ms:   millis(percentile(sorted, 0.99)),
+			MaxMs:   millis(sorted[len(sorted)-1]),
+		}
+	}
+	return report
+}
+
+// percentile returns the nearest-rank percentile of sorted samples.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	rank := int(math.Ceil(p*float64(len(sorted)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	return sorted[rank]
+}
+
+func millis(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// lookupPath resolves a dotted path such as "meta.created_at" in a payload.
+func lookupPath(payload map[string]any, path string) (any, bool) {
+	var current any = payload
+	for _, part := range strings.Split(path, ".") {
+		obj, ok := current.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		if current, ok = obj[part]; !ok {
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+// parseTimestamp understands the string layouts recognised by the linter and
+// numeric Unix timestamps in seconds or milliseconds.
+func parseTimestamp(value any) (time.Time, bool) {
+	switch v := value.(type) {
+	case string:
+		for _, f := range timestampLayouts {
+			if t, err := time.Parse(f.layout, v); err == nil {
+				return t, true
+			}
+		}
+	case json.Number:
+		if f, err := v.Float64(); err == nil {
+			return parseTimestamp(f)
+		}
+	case float64:
+		if v > 1e12 {
+			return time.UnixMilli(int64(v)), true
+		}
+		sec, frac := math.Modf(v)
+		return time.Unix(int64(sec), int64(frac*1e9)), true
+	}
+	return time.Time{}, false
+}
+
+func lagReportHandler(tracker *LagTracker) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(tracker.Report())
+	}
+}
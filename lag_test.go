@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestLagTrackerDistribution(t *testing.T) {
+	tracker := NewLagTracker([]string{"meta.sent_at", "created"})
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	for i := 1; i <= 10; i++ {
+		sent := now.Add(-time.Duration(i) * time.Second).Format(time.RFC3339)
+		tracker.OnIngest(WebhookParams{
+			EventType:  "order",
+			Payload:    map[string]any{"meta": map[string]any{"sent_at": sent}},
+			ReceivedAt: now,
+		}, nil)
+	}
+	// Unix seconds in the fallback field, with the sender clock running ahead.
+	tracker.OnIngest(WebhookParams{
+		EventType:  "ping",
+		Payload:    map[string]any{"created": float64(now.Add(2 * time.Second).Unix())},
+		ReceivedAt: now,
+	}, nil)
+	// No timestamp at all is ignored.
+	tracker.OnIngest(WebhookParams{EventType: "other", Payload: map[string]any{}, ReceivedAt: now}, nil)
+
+	report := tracker.Report()
+	order := report["order"]
+	if order.Samples != 10 || order.Field != "meta.sent_at" {
+		t.Fatalf("unexpected order stats: %+v", order)
+	}
+	if order.MinMs != 1000 || order.MaxMs != 10000 || order.P50Ms != 5000 || order.P90Ms != 9000 {
+		t.Errorf("unexpected order distribution: %+v", order)
+	}
+
+	ping := report["ping"]
+	if ping.Samples != 1 || ping.Ahead != 1 || ping.MaxMs != -2000 {
+		t.Errorf("unexpected ping stats: %+v", ping)
+	}
+	if _, ok := report["other"]; ok {
+		t.Error("events without timestamps should not be reported")
+	}
+}
+
+func TestLagReportEndpoint(t *testing.T) {
+	tracker := NewLagTracker([]string{"sent_at"})
+	mux := http.NewServeMux()
+	registerRoutes(mux, NewRingBuffer(10), "secret", tracker)
+	handleAPI(mux, "GET /stats/lag", lagReportHandler(tracker))
+
+	sent := time.Now().Add(-time.Minute).UTC().Format(time.RFC3339)
+	postWebhook(t, mux, `{"event":"order","data":{"sent_at":"`+sent+`"}}`)
+
+	req := httptest.NewRequest(http.MethodGet, "/stats/lag", nil)
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+
+	var report map[string]LagStats
+	if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil {
+		t.Fatalf("failed to parse report: %v", err)
+	}
+	if lag := report["order"].P50Ms; lag < 59000 || lag > 120000 {
+		t.Errorf("expected roughly a minute of lag, got %vms", lag)
+	}
+}
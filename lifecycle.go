@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Lifecycle actions, the Kind of the alerts a LifecycleNotifier sends.
+const (
+	lifecycleEvicted   = "evicted"
+	lifecycleExpired   = "expired"
+	lifecycleDeleted   = "deleted"
+	lifecycleCleared   = "cleared"
+	lifecycleCoalesced = "coalesced"
+)
+
+const (
+	// lifecycleFlushInterval batches drops, so that a full buffer evicting
+	// on every ingest sends one alert a second rather than one per record.
+	lifecycleFlushInterval = time.Second
+	// maxLifecycleRecords bounds the record IDs listed in one alert.
+	maxLifecycleRecords = 1000
+)
+
+// AddLifecycleHook has fn called for every record the buffer drops, with
+// the lifecycle action that dropped it. fn is called with the buffer locked,
+// so it must not block or use the buffer. It must be called before the
+// buffer is used.
+func (rb *RingBuffer) AddLifecycleHook(fn func(kind string, item *WebhookParams)) {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+	rb.lifecycle = append(rb.lifecycle, fn)
+}
+
+// dropped reports a dropped record to the lifecycle hooks. rb.mu must be
+// held.
+func (rb *RingBuffer) dropped(kind string, item *WebhookParams) {
+	for _, fn := range rb.lifecycle {
+		fn(kind, item)
+	}
+}
+
+// Clear drops every record into the trash and returns how many it dropped.
+// Like Delete, it refuses on a hash-chained buffer.
+func (rb *RingBuffer) Clear() (int, error) {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+	if rb.chained {
+		return 0, errChainedDelete
+	}
+	rb.nextExpiry = time.Time{}
+	now := time.Now()
+	return rb.compact(func(item *WebhookParams) bool {
+		rb.toTrash(item, now)
+		rb.dropped(lifecycleCleared, item)
+		return true
+	}), nil
+}
+
+// lifecycleBatch collects the records one action dropped since the last
+// flush.
+type lifecycleBatch struct {
+	count      int
+	eventTypes map[string]bool
+	ids        []string
+}
+
+// LifecycleNotifier tells notifiers when captured records are lost: evicted
+// to make room, expired by retention rules, deleted in bulk or cleared. An
+// alert covers every record one action dropped within a second and lists
+// their IDs, so that pipelines reading the store can tell what they missed.
+type LifecycleNotifier struct {
+	notifiers []Notifier
+
+	mu       sync.Mutex
+	pending  map[string]*lifecycleBatch
+	now      func() time.Time
+	dispatch func(Alert, []Notifier)
+}
+
+func NewLifecycleNotifier(notifiers []Notifier) *LifecycleNotifier {
+	return &LifecycleNotifier{
+		notifiers: notifiers,
+		pending:   make(map[string]*lifecycleBatch),
+		now:       time.Now,
+		dispatch:  notifyAsync,
+	}
+}
+
+// Observe records a dropped record. It is the buffer's lifecycle hook.
+func (n *LifecycleNotifier) Observe(kind string, item *WebhookParams) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	batch := n.pending[kind]
+	if batch == nil {
+		batch = &lifecycleBatch{eventTypes: make(map[string]bool)}
+		n.pending[kind] = batch
+	}
+	batch.count++
+	batch.eventTypes[item.EventType] = true
+	if len(batch.ids) < maxLifecycleRecords {
+		batch.ids = append(batch.ids, item.ID)
+	}
+}
+
+// Flush sends an alert for each action that dropped records since the last
+// flush.
+func (n *LifecycleNotifier) Flush() {
+	n.mu.Lock()
+	pending := n.pending
+	n.pending = make(map[string]*lifecycleBatch)
+	now := n.now().UTC()
+	n.mu.Unlock()
+
+	kinds := make([]string, 0, len(pending))
+	for kind := range pending {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	for _, kind := range kinds {
+		batch := pending[kind]
+		eventTypes := make([]string, 0, len(batch.eventTypes))
+		for eventType := range batch.eventTypes {
+			eventTypes = append(eventTypes, eventType)
+		}
+		sort.Strings(eventTypes)
+		n.dispatch(Alert{
+			Rule:       "lifecycle",
+			Kind:       kind,
+			EventTypes: eventTypes,
+			Message:    lifecycleMessage(kind, batch.count),
+			Count:      batch.count,
+			Records:    batch.ids,
+			FiredAt:    now,
+		}, n.notifiers)
+	}
+}
+
+func lifecycleMessage(kind string, count int) string {
+	records := "records"
+	if count == 1 {
+		records = "record"
+	}
+	switch kind {
+	case lifecycleEvicted:
+		return fmt.Sprintf("%d %s evicted to make room for new webhooks", count, records)
+	case lifecycleExpired:
+		return fmt.Sprintf("%d %s expired by retention rules", count, records)
+	case lifecycleDeleted:
+		return fmt.Sprintf("%d %s deleted", count, records)
+	case lifecycleCoalesced:
+		return fmt.Sprintf("%d %s replaced by a later delivery under a debounce rule", count, records)
+	default:
+		return fmt.Sprintf("%d %s dropped when the store was cleared", count, records)
+	}
+}
+
+// Run flushes every lifecycleFlushInterval until ctx is done.
+func (n *LifecycleNotifier) Run(ctx context.Context) {
+	ticker := time.NewTicker(lifecycleFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			n.Flush()
+			return
+		case <-ticker.C:
+			n.Flush()
+		}
+	}
+}
+
+// clearHandler serves DELETE /webhooks, which empties the store. The records
+// can be restored one by one for -trash-retention.
+func clearHandler(buffer *RingBuffer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		n, err := buffer.Clear()
+		if err != nil {
+			writeProblem(w, r, http.StatusConflict, codeConflict, err.Error())
+			return
+		}
+		log.Printf("Store cleared, %d records dropped", n)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]int{"deleted": n})
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLifecycleNotifierBatchesDrops(t *testing.T) {
+	buffer := NewRingBuffer(3)
+	buffer.SetRetention([]RetentionRule{{"heartbeat", time.Minute}})
+	lifecycle := NewLifecycleNotifier(nil)
+	var fired []Alert
+	lifecycle.dispatch = func(a Alert, _ []Notifier) { fired = append(fired, a) }
+	buffer.AddLifecycleHook(lifecycle.Observe)
+
+	now := time.Now()
+	first, _ := buffer.Push(WebhookParams{EventType: "order", ReceivedAt: now})
+	buffer.Push(WebhookParams{EventType: "heartbeat", ReceivedAt: now})
+	kept, _ := buffer.Push(WebhookParams{EventType: "refund", ReceivedAt: now})
+	buffer.Push(WebhookParams{EventType: "order", ReceivedAt: now})
+	buffer.Expire(now.Add(time.Minute))
+	buffer.Delete(map[string]bool{kept.ID: true})
+	lifecycle.Flush()
+
+	if len(fired) != 3 {
+		t.Fatalf("expected an alert per action, got %+v", fired)
+	}
+	deleted, evicted, expired := fired[0], fired[1], fired[2]
+	if evicted.Kind != lifecycleEvicted || evicted.Count != 1 || strings.Join(evicted.Records, ",") != first.ID || strings.Join(evicted.EventTypes, ",") != "order" {
+		t.Errorf("unexpected eviction alert: %+v", evicted)
+	}
+	if expired.Kind != lifecycleExpired || strings.Join(expired.EventTypes, ",") != "heartbeat" {
+		t.Errorf("unexpected expiry alert: %+v", expired)
+	}
+	if deleted.Kind != lifecycleDeleted || strings.Join(deleted.Records, ",") != kept.ID {
+		t.Errorf("unexpected delete alert: %+v", deleted)
+	}
+
+	fired = nil
+	lifecycle.Flush()
+	if len(fired) != 0 {
+		t.Errorf("expected nothing to flush, got %+v", fired)
+	}
+
+	rec := httptest.NewRecorder()
+	clearHandler(buffer)(rec, httptest.NewRequest(http.MethodDelete, "/webhooks", nil))
+	if rec.Code != http.StatusOK || strings.TrimSpace(rec.Body.String()) != `{"deleted":1}` || buffer.Len() != 0 {
+		t.Fatalf("unexpected clear response %d: %s", rec.Code, rec.Body.String())
+	}
+	lifecycle.Flush()
+	if len(fired) != 1 || fired[0].Kind != lifecycleCleared || fired[0].Message != "1 record dropped when the store was cleared" {
+		t.Errorf("unexpected clear alert: %+v", fired)
+	}
+}
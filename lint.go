@@ -0,0 +1,251 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Lint finding kinds.
+const (
+	lintMixedTypes            = "mixed_types"
+	lintDeepNesting           = "deep_nesting"
+	lintInvalidUTF8           = "invalid_utf8"
+	lintInconsistentTimestamp = "inconsistent_timestamp"
+)
+
+const (
+	// lintMaxDepth is the payload nesting depth above which a payload is
+	// flagged as suspiciously deep.
+	lintMaxDepth = 20
+	// lintMaxFindings bounds how many findings are retained for the report.
+	lintMaxFindings = 1000
+	// lintMaxEventTypes and lintMaxFields bound how many event types, and
+	// fields per event type, have their types and timestamp formats
+	// remembered, as senders pick both. lintMaxReported bounds the findings
+	// remembered as already reported. Past them, Overflow is counted instead.
+	lintMaxEventTypes = 1000
+	lintMaxFields     = 1000
+	lintMaxReported   = 10000
+)
+
+// timestampLayouts are the formats recognised when checking that a field
+// always carries timestamps in the same format.
+var timestampLayouts = []struct {
+	name   string
+	layout string
+}{
+	{"rfc3339", time.RFC3339Nano},
+	{"rfc1123", time.RFC1123},
+	{"rfc1123z", time.RFC1123Z},
+	{"datetime", time.DateTime},
+	{"date", time.DateOnly},
+}
+
+type LintFinding struct {
+	Kind      string    `json:"kind"`
+	EventType string    `json:"event"`
+	Field     string    `json:"field,omitempty"`
+	Message   string    `json:"message"`
+	SeenAt    time.Time `json:"seen_at"`
+}
+
+// LintReport is the findings so far. Overflow counts the event types, fields
+// and findings left unchecked because the linter's caps were reached.
+type LintReport struct {
+	Total    int            `json:"total"`
+	ByKind   map[string]int `json:"by_kind"`
+	Overflow int            `json:"overflow,omitempty"`
+	Findings []LintFinding  `json:"findings"`
+}
+
+// Linter inspects ingested payloads for signs of producer bugs. It remembers
+// the JSON types and timestamp formats seen per event type and field so that
+// inconsistencies across events can be reported.
+type Linter struct {
+	mu         sync.Mutex
+	types      map[string]map[string]string // event -> field -> first JSON type
+	formats    map[string]map[string]string // event -> field -> first timestamp format
+	reported   map[string]bool
+	findings   []LintFinding
+	total      int
+	byKind     map[string]int
+	overflow   int
+	timeSource func() time.Time
+}
+
+func NewLinter() *Linter {
+	return &Linter{
+		types:      make(map[string]map[string]string),
+		formats:    make(map[string]map[string]string),
+		reported:   make(map[string]bool),
+		byKind:     make(map[string]int),
+		timeSource: time.Now,
+	}
+}
+
+func (l *Linter) OnIngest(item WebhookParams, body []byte) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// RFC 8259 requires UTF-8 without a byte order mark. The ingest handler
+	// has already converted other encodings; Encoding says from what.
+	if charset := strings.TrimPrefix(strings.TrimPrefix(item.Encoding, "gzip"), "+"); charset != "" {
+		l.add(lintInvalidUTF8, item.EventType, "", "Body is not plain UTF-8, decoded from "+charset)
+	} else if !utf8.Valid(body) {
+		l.add(lintInvalidUTF8, item.EventType, "", "Body contains invalid UTF-8 sequences")
+	}
+
+	if l.types[item.EventType] == nil {
+		if len(l.types) >= lintMaxEventTypes {
+			l.overflow++
+		} else {
+			l.types[item.EventType] = make(map[string]string)
+			l.formats[item.EventType] = make(map[string]string)
+		}
+	}
+
+	maxDepth := 0
+	for key, value := range item.Payload {
+		l.walk(item.EventType, key, value, 1, &maxDepth)
+	}
+	if maxDepth > lintMaxDepth {
+		l.add(lintDeepNesting, item.EventType, "",
+			fmt.Sprintf("Payload nesting depth %d exceeds %d", maxDepth, lintMaxDepth))
+	}
+}
+
+func (l *Linter) walk(eventType, path string, value any, depth int, maxDepth *int) {
+	if depth > *maxDepth {
+		*maxDepth = depth
+	}
+
+	// Only the nesting depth is checked for untracked event types and fields.
+	kind := jsonType(value)
+	fields := l.types[eventType]
+	first, tracked := fields[path]
+	if !tracked && fields != nil {
+		if len(fields) < lintMaxFields {
+			fields[path], tracked = kind, true
+		} else {
+			l.overflow++
+		}
+	} else if tracked && first != kind && kind != "null" && first != "null" {
+		l.addOnce(lintMixedTypes, eventType, path,
+			fmt.Sprintf("Field was %s in earlier events, now %s", first, kind))
+	}
+
+	switch v := value.(type) {
+	case map[string]any:
+		for key, child := range v {
+			l.walk(eventType, path+"."+key, child, depth+1, maxDepth)
+		}
+	case []any:
+		for _, child := range v {
+			l.walk(eventType, path+"[]", child, depth+1, maxDepth)
+		}
+	case string:
+		if !tracked {
+			return
+		}
+		format := timestampFormat(v)
+		if format == "" {
+			return
+		}
+		if first, ok := l.formats[eventType][path]; !ok {
+			l.formats[eventType][path] = format
+		} else if first != format {
+			l.addOnce(lintInconsistentTimestamp, eventType, path,
+				fmt.Sprintf("Timestamp was %s in earlier events, now %s", first, format))
+		}
+	}
+}
+
+// addOnce records a finding unless the same kind/event/field/message has
+// already been reported.
+func (l *Linter) addOnce(kind, eventType, field, message string) {
+	key := kind + "\x00" + eventType + "\x00" + field + "\x00" + message
+	if l.reported[key] {
+		return
+	}
+	if len(l.reported) >= lintMaxReported {
+		l.overflow++
+		return
+	}
+	l.reported[key] = true
+	l.add(kind, eventType, field, message)
+}
+
+func (l *Linter) add(kind, eventType, field, message string) {
+	l.total++
+	l.byKind[kind]++
+	l.findings = append(l.findings, LintFinding{
+		Kind:      kind,
+		EventType: eventType,
+		Field:     field,
+		Message:   message,
+		SeenAt:    l.timeSource(),
+	})
+	if len(l.findings) > lintMaxFindings {
+		l.findings = l.findings[len(l.findings)-lintMaxFindings:]
+	}
+}
+
+// Report returns the retained findings, newest first.
+func (l *Linter) Report() LintReport {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	report := LintReport{
+		Total:    l.total,
+		ByKind:   make(map[string]int, len(l.byKind)),
+		Overflow: l.overflow,
+		Findings: make([]LintFinding, 0, len(l.findings)),
+	}
+	for kind, n := range l.byKind {
+		report.ByKind[kind] = n
+	}
+	for i := len(l.findings) - 1; i >= 0; i-- {
+		report.Findings = append(report.Findings, l.findings[i])
+	}
+	return report
+}
+
+func jsonType(v any) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case string:
+		return "string"
+	case float64, json.Number:
+		return "number"
+	case bool:
+		return "boolean"
+	case map[string]any:
+		return "object"
+	case []any:
+		return "array"
+	default:
+		return fmt.Sprintf("%T", v)
+	}
+}
+
+func timestampFormat(s string) string {
+	for _, f := range timestampLayouts {
+		if _, err := time.Parse(f.layout, s); err == nil {
+			return f.name
+		}
+	}
+	return ""
+}
+
+func lintReportHandler(linter *Linter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(linter.Report())
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func newLintTestServer() (*http.ServeMux, *Linter) {
+	linter := NewLinter()
+	mux := http.NewServeMux()
+	registerRoutes(mux, NewRingBuffer(100), "secret", linter)
+	handleAPI(mux, "GET /lint-report", lintReportHandler(linter))
+	return mux, linter
+}
+
+func findingKinds(report LintReport) map[string]string {
+	kinds := make(map[string]string)
+	for _, f := range report.Findings {
+		kinds[f.Kind] = f.Field
+	}
+	return kinds
+}
+
+func TestLintMixedTypes(t *testing.T) {
+	mux, linter := newLintTestServer()
+
+	postWebhook(t, mux, `{"event":"order","data":{"amount":100}}`)
+	postWebhook(t, mux, `{"event":"order","data":{"amount":"100"}}`)
+	postWebhook(t, mux, `{"event":"order","data":{"amount":"200"}}`)
+	// Same field name under another event type is tracked separately.
+	postWebhook(t, mux, `{"event":"refund","data":{"amount":"5"}}`)
+
+	report := linter.Report()
+	if report.ByKind[lintMixedTypes] != 1 {
+		t.Fatalf("expected 1 mixed_types finding, got %d", report.ByKind[lintMixedTypes])
+	}
+	if field := findingKinds(report)[lintMixedTypes]; field != "amount" {
+		t.Errorf("expected finding on amount, got %q", field)
+	}
+}
+
+func TestLintInconsistentTimestamps(t *testing.T) {
+	mux, linter := newLintTestServer()
+
+	postWebhook(t, mux, `{"event":"user","data":{"meta":{"created_at":"2024-01-02T03:04:05Z"}}}`)
+	postWebhook(t, mux, `{"event":"user","data":{"meta":{"created_at":"2024-01-02 03:04:05"}}}`)
+
+	report := linter.Report()
+	if field := findingKinds(report)[lintInconsistentTimestamp]; field != "meta.created_at" {
+		t.Errorf("expected timestamp finding on meta.created_at, got %v", report.Findings)
+	}
+}
+
+func TestLintDeepNestingAndInvalidUTF8(t *testing.T) {
+	mux, linter := newLintTestServer()
+
+	deep := strings.Repeat(`{"a":`, lintMaxDepth+1) + "1" + strings.Repeat("}", lintMaxDepth+1)
+	postWebhook(t, mux, `{"event":"deep","data":`+deep+`}`)
+	postWebhook(t, mux, "{\"event\":\"bad\",\"data\":{\"name\":\"\xff\"}}")
+
+	report := linter.Report()
+	kinds := findingKinds(report)
+	if _, ok := kinds[lintDeepNesting]; !ok {
+		t.Error("expected deep_nesting finding")
+	}
+	if _, ok := kinds[lintInvalidUTF8]; !ok {
+		t.Error("expected invalid_utf8 finding")
+	}
+}
+
+func TestLintCapsTrackedEventTypesAndFields(t *testing.T) {
+	linter := NewLinter()
+	for i := 0; i < lintMaxEventTypes+10; i++ {
+		linter.OnIngest(WebhookParams{EventType: fmt.Sprintf("type-%d", i), Payload: map[string]any{"id": 1}}, nil)
+	}
+	fields := make(map[string]any, lintMaxFields+10)
+	for i := 0; i < lintMaxFields+10; i++ {
+		fields[fmt.Sprintf("f%d", i)] = 1
+	}
+	linter.OnIngest(WebhookParams{EventType: "type-0", Payload: fields}, nil)
+
+	if len(linter.types) != lintMaxEventTypes || len(linter.types["type-0"]) != lintMaxFields {
+		t.Errorf("expected %d event types of at most %d fields, got %d and %d",
+			lintMaxEventTypes, lintMaxFields, len(linter.types), len(linter.types["type-0"]))
+	}
+	if overflow := linter.Report().Overflow; overflow != 10+11 {
+		t.Errorf("expected 21 untracked event types and fields, got %d", overflow)
+	}
+}
+
+func TestLintReportEndpoint(t *testing.T) {
+	mux, _ := newLintTestServer()
+
+	postWebhook(t, mux, `{"event":"order","data":{"id":1}}`)
+	postWebhook(t, mux, `{"event":"order","data":{"id":"1"}}`)
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/lint-report", nil)
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rec.Code)
+	}
+
+	var report LintReport
+	if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil {
+		t.Fatalf("failed to parse report: %v", err)
+	}
+	if report.Total != 1 || len(report.Findings) != 1 {
+		t.Errorf("expected a single finding, got %+v", report)
+	}
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	lokiQueueSize     = 1000
+	lokiBatchSize     = 100
+	lokiFlushInterval = time.Second
+)
+
+type lokiEntry struct {
+	labels map[string]string
+	ts     time.Time
+	line   string
+}
+
+type lokiStream struct {
+	Stream map[string]string `json:"stream"`
+	Values [][2]string       `json:"values"`
+}
+
+type lokiPush struct {
+	Streams []lokiStream `json:"streams"`
+}
+
+// LokiSink mirrors captured webhooks as log lines to Grafana Loki, labelled
+// by event type and version. Entries are batched and pushed in the
+// background.
+type LokiSink struct {
+	url     string
+	labels  map[string]string
+	client  *http.Client
+	entries chan lokiEntry
+	done    chan struct{}
+}
+
+// NewLokiSink pushes to baseURL's /loki/api/v1/push. labels are added to
+// every stream; tenant, if set, is sent as X-Scope-OrgID.
+func NewLokiSink(baseURL string, labels map[string]string, tenant string) *LokiSink {
+	s := &LokiSink{
+		url:     strings.TrimSuffix(baseURL, "/") + "/loki/api/v1/push",
+		labels:  labels,
+		client:  &http.Client{Timeout: 10 * time.Second},
+		entries: make(chan lokiEntry, lokiQueueSize),
+		done:    make(chan struct{}),
+	}
+	if tenant != "" {
+		s.client.Transport = tenantTransport{tenant}
+	}
+	go s.run()
+	return s
+}
+
+func (s *LokiSink) OnIngest(item WebhookParams, body []byte) {
+	line, err := json.Marshal(item)
+	if err != nil {
+		log.Printf("Loki sink: %v", err)
+		return
+	}
+
+	labels := make(map[string]string, len(s.labels)+2)
+	for k, v := range s.labels {
+		labels[k] = v
+	}
+	labels["event_type"] = item.EventType
+	if item.Version != "" {
+		labels["version"] = item.Version
+	}
+
+	select {
+	case s.entries <- lokiEntry{labels: labels, ts: item.ReceivedAt, line: string(line)}:
+	default:
+		log.Printf("Loki sink queue full, dropping %s webhook", item.EventType)
+	}
+}
+
+func (s *LokiSink) QueueName() string { return "loki" }
+
+// QueueDepth is how many entries wait to be batched into a push.
+func (s *LokiSink) QueueDepth() int { return len(s.entries) }
+
+// Close flushes pending entries and stops the background pusher.
+func (s *LokiSink) Close() {
+	close(s.entries)
+	<-s.done
+}
+
+func (s *LokiSink) run() {
+	defer close(s.done)
+	ticker := time.NewTicker(lokiFlushInterval)
+	defer ticker.Stop()
+
+	var batch []lokiEntry
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := s.push(batch); err != nil {
+			log.Printf("Loki sink: %v", err)
+		}
+		batch = batch[:0]
+	}
+
+	for {
+		select {
+		case e, ok := <-s.entries:
+			if !ok {
+				flush()
+				return
+			}
+			batch = append(batch, e)
+			if len(batch) >= lokiBatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+func (s *LokiSink) push(batch []lokiEntry) error {
+	streams := make(map[string]*lokiStream)
+	var order []string
+	for _, e := range batch {
+		key := labelKey(e.labels)
+		st := streams[key]
+		if st == nil {
+			st = &lokiStream{Stream: e.labels}
+			streams[key] = st
+			order = append(order, key)
+		}
+		st.Values = append(st.Values, [2]string{strconv.FormatInt(e.ts.UnixNano(), 10), e.line})
+	}
+
+	var payload lokiPush
+	for _, key := range order {
+		payload.Streams = append(payload.Streams, *streams[key])
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := postJSON(ctx, s.client, s.url, payload); err != nil {
+		return fmt.Errorf("push %d entries: %w", len(batch), err)
+	}
+	return nil
+}
+
+// tenantTransport sets the Loki multi-tenancy header on every request.
+type tenantTransport struct {
+	tenant string
+}
+
+func (t tenantTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set("X-Scope-OrgID", t.tenant)
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+// labelKey is a canonical string for a label set.
+func labelKey(labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	for _, k := range keys {
+		b.WriteString(k)
+		b.WriteByte('=')
+		b.WriteString(labels[k])
+		b.WriteByte(',')
+	}
+	return b.String()
+}
+
+// parseLabels parses "k1=v1,k2=v2".
+func parseLabels(s string) (map[string]string, error) {
+	labels := make(map[string]string)
+	for _, pair := range splitList(s) {
+		k, v, ok := strings.Cut(pair, "=")
+		if !ok || k == "" {
+			return nil, fmt.Errorf("invalid label %q, expected key=value", pair)
+		}
+		labels[strings.TrimSpace(k)] = strings.TrimSpace(v)
+	}
+	return labels, nil
+}
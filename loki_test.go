@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLokiSinkPushesStreams(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		pushes  []lokiPush
+		tenants []string
+	)
+	loki := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/loki/api/v1/push" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		body, _ := io.ReadAll(r.Body)
+		var p lokiPush
+		json.Unmarshal(body, &p)
+		mu.Lock()
+		pushes = append(pushes, p)
+		tenants = append(tenants, r.Header.Get("X-Scope-OrgID"))
+		mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer loki.Close()
+
+	sink := NewLokiSink(loki.URL+"/", map[string]string{"job": "webhook-echo"}, "team-a")
+	now := time.Now()
+	sink.OnIngest(WebhookParams{EventType: "order", Version: "1", ReceivedAt: now}, nil)
+	sink.OnIngest(WebhookParams{EventType: "order", Version: "1", ReceivedAt: now}, nil)
+	sink.OnIngest(WebhookParams{EventType: "user", ReceivedAt: now}, nil)
+	sink.Close()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(pushes) != 1 {
+		t.Fatalf("expected a single batched push, got %d", len(pushes))
+	}
+	if tenants[0] != "team-a" {
+		t.Errorf("expected tenant header, got %q", tenants[0])
+	}
+	streams := pushes[0].Streams
+	if len(streams) != 2 {
+		t.Fatalf("expected 2 streams, got %d", len(streams))
+	}
+	order := streams[0]
+	if order.Stream["event_type"] != "order" || order.Stream["version"] != "1" || order.Stream["job"] != "webhook-echo" {
+		t.Errorf("unexpected labels: %v", order.Stream)
+	}
+	if len(order.Values) != 2 {
+		t.Errorf("expected 2 order lines, got %d", len(order.Values))
+	}
+	if _, ok := streams[1].Stream["version"]; ok {
+		t.Error("empty version should not become a label")
+	}
+}
+
+func TestParseLabels(t *testing.T) {
+	labels, err := parseLabels("job=webhook-echo, env = staging")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if labels["job"] != "webhook-echo" || labels["env"] != "staging" {
+		t.Errorf("unexpected labels: %v", labels)
+	}
+	if _, err := parseLabels("novalue"); err == nil {
+		t.Error("expected error for label without value")
+	}
+}
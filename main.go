@@ -1,147 +1,765 @@
 package main
 
 import (
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
-	"io"
 	"log"
+	"maps"
 	"net/http"
+	"net/url"
 	"os"
 	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
-var debug bool
+var (
+	debug             bool
+	maxBodySize       int64
+	idempotencyHeader = "X-Idempotency-Key"
+)
 
 type WebhookParams struct {
-	EventType string         `json:"event"`
-	Payload   map[string]any `json:"data"`
-	Version   string         `json:"version"`
+	// ID and Sequence are assigned when the webhook is stored. Sequence
+	// increases by one for every stored record.
+	ID             string         `json:"id,omitempty"`
+	Sequence       uint64         `json:"sequence,omitempty"`
+	EventType      string         `json:"event"`
+	Payload        map[string]any `json:"data"`
+	Version        string         `json:"version"`
+	IdempotencyKey string         `json:"idempotency_key,omitempty"`
+	Deliveries     int            `json:"deliveries,omitempty"`
+	ReceivedAt     time.Time      `json:"received_at"`
+	// Headers are the request headers the webhook was delivered with.
+	Headers http.Header `json:"headers,omitempty"`
+	// Source identifies non-HTTP ingest sources, e.g. "mqtt://broker/topic".
+	Source string `json:"source,omitempty"`
+	// Hash and PrevHash link records into a tamper-evident chain when chain
+	// hashing is enabled.
+	Hash     string `json:"hash,omitempty"`
+	PrevHash string `json:"prev_hash,omitempty"`
+	// ContentType and Raw keep the request as it arrived, for
+	// /webhooks/{id}/raw.
+	ContentType string `json:"content_type,omitempty"`
+	Raw         []byte `json:"-"`
+	// Encoding records what was undone to get UTF-8 JSON out of Raw, e.g.
+	// "gzip+utf-16le". SniffedType is the type detected from magic bytes
+	// when it contradicts ContentType.
+	Encoding    string `json:"original_encoding,omitempty"`
+	SniffedType string `json:"sniffed_content_type,omitempty"`
+	// GitHub is set for deliveries from GitHub webhooks.
+	GitHub *GitHubDelivery `json:"github,omitempty"`
+	// Stripe is set for Stripe events.
+	Stripe *StripeEvent `json:"stripe,omitempty"`
+	// Verification is the result of checking the request's signature.
+	Verification *Verification `json:"verification,omitempty"`
+	// Trace is the trace context the request was sent with.
+	Trace *TraceContext `json:"trace,omitempty"`
+	// Transfer is set for streamed bodies and ones followed by trailers.
+	Transfer *Transfer `json:"transfer,omitempty"`
+	// StatusCode is the response status the delivery was answered with.
+	StatusCode int `json:"status_code,omitempty"`
+	// ParseError is why the body could not be parsed, for malformed
+	// deliveries kept with -record-malformed.
+	ParseError string `json:"parse_error,omitempty"`
+	// Client is the original sender, seen through trusted proxies.
+	Client *ClientInfo `json:"client,omitempty"`
+	// TLS is the handshake of the connection the request came over.
+	TLS *TLSInfo `json:"tls,omitempty"`
+	// Tags mark records after capture, e.g. "retry-storm".
+	Tags []string `json:"tags,omitempty"`
+	// Attachments are added to a record after capture, see Attach.
+	Attachments []Attachment `json:"attachments,omitempty"`
+	// Instance is the replica that captured the record, see -instance-id.
+	Instance string `json:"instance,omitempty"`
+	// Truncation is set when the payload is too large to show in query
+	// responses, see -inline-body-limit.
+	Truncation *BodyTruncation `json:"truncation,omitempty"`
+	// Coalesced is set on records kept for a burst by a debounce rule.
+	Coalesced *Coalescing `json:"coalesced,omitempty"`
 }
 
 type RingBuffer struct {
-	items []WebhookParams
-	head  int
-	count int
-	size  int
-	mu    sync.RWMutex
+	ringView
+	keys map[string]int // idempotency key -> slot
+	mu   sync.RWMutex
+
+	// gen is bumped by every Snapshot. Chunks, and the chunk list itself,
+	// last copied in an earlier generation may be shared with a snapshot.
+	gen       uint64
+	chunksGen uint64
+
+	sequence uint64 // sequence number of the most recently stored record
+	evicted  uint64 // records evicted to make room since startup
+
+	chained  bool
+	lastHash string // hash of the most recently stored record
+
+	retention  []RetentionRule
+	nextExpiry time.Time // earliest expiry among the records held, if any
+	expired    uint64    // records dropped by retention rules since startup
+
+	lifecycle []func(kind string, item *WebhookParams)
+
+	trash          []trashedRecord // deleted records, oldest deleted first
+	trashRetention time.Duration
 }
 
 func NewRingBuffer(size int) *RingBuffer {
 	return &RingBuffer{
-		items: make([]WebhookParams, size),
-		size:  size,
+		ringView: newRingView(size),
+		keys:     make(map[string]int),
 	}
 }
 
-func (rb *RingBuffer) Push(item WebhookParams) {
+// Push stores item in the buffer, evicting the oldest webhook when full and
+// no record has expired to make room. If
+// item carries an idempotency key that is already in the buffer, the existing
+// record's delivery count is bumped instead and Push reports a duplicate.
+// The returned value is the record as stored.
+func (rb *RingBuffer) Push(item WebhookParams) (stored WebhookParams, duplicate bool) {
 	rb.mu.Lock()
 	defer rb.mu.Unlock()
 
-	rb.items[rb.head] = item
+	if item.IdempotencyKey != "" {
+		if idx, ok := rb.keys[item.IdempotencyKey]; ok {
+			stored := rb.slot(idx)
+			stored.Deliveries++
+			return *stored, true
+		}
+	}
+
+	if rb.count == rb.size {
+		rb.expire(time.Now())
+	}
+	if rb.count == rb.size {
+		evicted := rb.at(rb.head)
+		if evicted.IdempotencyKey != "" {
+			delete(rb.keys, evicted.IdempotencyKey)
+		}
+		rb.evicted++
+		rb.dropped(lifecycleEvicted, evicted)
+	}
+	if item.Deliveries == 0 {
+		item.Deliveries = 1
+	}
+	rb.sequence++
+	item.ID = recordIDs.Next()
+	item.Sequence = rb.sequence
+	item.Hash, item.PrevHash = "", ""
+	if rb.chained {
+		item.PrevHash = rb.lastHash
+		item.Hash = recordHash(item)
+		rb.lastHash = item.Hash
+	}
+
+	*rb.slot(rb.head) = item
+	if item.IdempotencyKey != "" {
+		rb.keys[item.IdempotencyKey] = rb.head
+	}
 	rb.head = (rb.head + 1) % rb.size
 	if rb.count < rb.size {
 		rb.count++
 	}
+	if expires := rb.expiresAt(&item); !expires.IsZero() && (rb.nextExpiry.IsZero() || expires.Before(rb.nextExpiry)) {
+		rb.nextExpiry = expires
+	}
+	return item, false
 }
 
-func (rb *RingBuffer) Query(eventType string, filters map[string]string) []WebhookParams {
+// newRecordID returns a random 128-bit identifier in hex.
+func newRecordID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// Len returns the number of webhooks currently held in the buffer.
+func (rb *RingBuffer) Len() int {
 	rb.mu.RLock()
 	defer rb.mu.RUnlock()
+	return rb.count
+}
 
-	var results []WebhookParams
+// Evictions returns how many webhooks were evicted to make room for newer
+// ones since the buffer was created.
+func (rb *RingBuffer) Evictions() uint64 {
+	rb.mu.RLock()
+	defer rb.mu.RUnlock()
+	return rb.evicted
+}
 
-	// Iterate through items newest to oldest
-	for i := 0; i < rb.count; i++ {
-		idx := (rb.head - 1 - i + rb.size) % rb.size
-		item := rb.items[idx]
+// Cap returns the maximum number of webhooks the buffer can hold.
+func (rb *RingBuffer) Cap() int {
+	return rb.size
+}
 
-		// Filter by event type
-		if item.EventType != eventType {
-			continue
+// QueryFilter selects webhooks by event type and payload field values.
+type QueryFilter struct {
+	// EventTypes lists the event types to match; a webhook matches if its
+	// type is any of them.
+	EventTypes []string
+	// Fields maps payload keys to the string form their value must have.
+	Fields map[string]string
+	// Has, Missing and Null list payload keys that must be present, must be
+	// absent, or must be present with a JSON null value.
+	Has     []string
+	Missing []string
+	Null    []string
+	// FoldCase lists Fields keys whose values are compared case-insensitively
+	// using Unicode case folding.
+	FoldCase map[string]bool
+	// XPaths are path conditions such as /order/status=shipped.
+	XPaths []xpathCond
+	// Status selects by delivery outcome. With it, EventTypes may be empty
+	// to match every event type.
+	Status StatusFilter
+	// AfterID and BeforeID bound the record IDs, under a time-ordered ID
+	// strategy, when set.
+	AfterID, BeforeID string
+	// Flatten selects nothing, but has matches returned with flat payloads,
+	// see flattenPayload.
+	Flatten bool
+}
+
+func (f QueryFilter) Match(item WebhookParams) bool {
+	typeMatch := len(f.EventTypes) == 0
+	for _, eventType := range f.EventTypes {
+		if item.EventType == eventType {
+			typeMatch = true
+			break
 		}
+	}
+	if !typeMatch || !f.Status.Match(item) || !inIDRange(item.ID, f.AfterID, f.BeforeID) {
+		return false
+	}
 
-		// Filter by payload fields
-		match := true
-		for key, value := range filters {
-			if payloadVal, ok := item.Payload[key]; ok {
-				// Convert payload value to string for comparison
-				var payloadStr string
-				switch v := payloadVal.(type) {
-				case string:
-					payloadStr = v
-				case float64:
-					payloadStr = strconv.FormatFloat(v, 'f', -1, 64)
-				case bool:
-					payloadStr = strconv.FormatBool(v)
-				default:
-					payloadStr = fmt.Sprintf("%v", v)
-				}
-				if payloadStr != value {
-					match = false
-					break
-				}
-			} else {
-				match = false
-				break
+	for _, key := range f.Has {
+		if _, ok := payloadValue(item.Payload, key); !ok {
+			return false
+		}
+	}
+	for _, key := range f.Missing {
+		if _, ok := payloadValue(item.Payload, key); ok {
+			return false
+		}
+	}
+	for _, key := range f.Null {
+		if v, ok := payloadValue(item.Payload, key); !ok || v != nil {
+			return false
+		}
+	}
+
+	for key, value := range f.Fields {
+		payloadVal, ok := payloadValue(item.Payload, key)
+		if !ok {
+			return false
+		}
+		if f.FoldCase[key] {
+			if !strings.EqualFold(valueString(payloadVal), value) {
+				return false
 			}
+		} else if !valueEquals(payloadVal, value) {
+			return false
+		}
+	}
+	for _, cond := range f.XPaths {
+		if !cond.Match(item.Payload) {
+			return false
+		}
+	}
+	return true
+}
+
+// valueString converts a payload value to the string form filters compare
+// against.
+func valueString(value any) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
+
+// payloadValue looks up key in a payload, first as a literal top-level key and
+// then as a dotted path into nested objects.
+func payloadValue(payload map[string]any, key string) (any, bool) {
+	if v, ok := payload[key]; ok {
+		return v, true
+	}
+	if strings.Contains(key, ".") {
+		return lookupPath(payload, key)
+	}
+	return nil, false
+}
+
+// scanCheckInterval is how many records a scan looks at between checks of
+// its context.
+const scanCheckInterval = 256
+
+// Query returns the webhooks matching filter, newest first. When ctx is done
+// before the scan finishes, the matches found so far are returned and
+// truncated is set. The scan runs on a snapshot, without blocking ingest.
+func (rb *RingBuffer) Query(ctx context.Context, filter QueryFilter) (results []WebhookParams, truncated bool) {
+	return rb.Snapshot().Query(ctx, filter)
+}
+
+// IngestHook observes every webhook recorded by the ingest handler, along with
+// the raw request body it was parsed from.
+type IngestHook interface {
+	OnIngest(item WebhookParams, body []byte)
+}
+
+// Recorder stores webhooks from any ingest source and runs the ingest hooks
+// for each newly recorded one.
+type Recorder struct {
+	buffer *RingBuffer
+	hooks  []IngestHook
+	paused atomic.Bool
+	// adminToken lets captureHeader pause and resume recording.
+	adminToken string
+}
+
+func NewRecorder(buffer *RingBuffer, hooks ...IngestHook) *Recorder {
+	return &Recorder{buffer: buffer, hooks: hooks}
+}
+
+// Record stamps item with the receive time and stores it. Hooks only run for
+// new records, not for idempotent re-deliveries. While capture is paused the
+// item is returned as is without being stored.
+func (rec *Recorder) Record(item WebhookParams, body []byte) (stored WebhookParams, duplicate bool) {
+	item.Deliveries = 0
+	item.ReceivedAt = time.Now().UTC()
+	if item.Instance == "" {
+		item.Instance = instanceID
+	}
+	if item.Raw == nil {
+		item.Raw = body
+	}
+	if rec.paused.Load() {
+		if debug {
+			fmt.Println("Capture paused, not recording webhook:", item)
 		}
+		return item, false
+	}
 
-		if match {
-			results = append(results, item)
+	stored, duplicate = rec.buffer.Push(truncateInline(item, body))
+	if !duplicate {
+		for _, hook := range rec.hooks {
+			hook.OnIngest(stored, body)
+		}
+	}
+	if debug {
+		if duplicate {
+			fmt.Println("Re-delivered webhook:", stored)
+		} else {
+			fmt.Println("Inserted webhook:", stored)
 		}
 	}
+	return stored, duplicate
+}
 
-	return results
+// parseWebhook parses an ingest body according to its content type. Errors
+// are paramErrors carrying the problem code to report.
+func parseWebhook(body []byte, contentType string) (WebhookParams, error) {
+	var res WebhookParams
+	if f := lookupFormat(contentType); f != nil {
+		res, err := f.Parser.Parse(body)
+		if err != nil {
+			return res, &paramError{f.Code, "Invalid " + f.Name + ": " + err.Error()}
+		}
+		return res, nil
+	}
+	if err := checkJSONDepth(body, maxJSONDepth); err != nil {
+		return res, &paramError{codeInvalidJSON, "Invalid JSON: " + err.Error()}
+	}
+	if res, ok, err := parseGraphQLWebhook(body, contentType); ok {
+		if err != nil {
+			return res, &paramError{codeInvalidGraphQL, "Invalid GraphQL request: " + err.Error()}
+		}
+		return res, nil
+	}
+	if err := json.Unmarshal(body, &res); err != nil {
+		return res, &paramError{codeInvalidJSON, "Invalid JSON: " + err.Error()}
+	}
+	return res, nil
 }
 
-func recordWebhookHandler(buffer *RingBuffer) http.HandlerFunc {
+func recordWebhookHandler(recorder *Recorder) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		body, err := io.ReadAll(r.Body)
+		start := time.Now()
+		fault := defaultFault
+		if s := r.Header.Get(faultHeader); s != "" {
+			f, err := parseFault(s)
+			if err != nil {
+				writeProblem(w, r, http.StatusBadRequest, codeInvalidParameter, err.Error())
+				return
+			}
+			fault = f
+		}
+		trickle := defaultTrickle
+		if s := r.Header.Get(trickleHeader); s != "" {
+			t, err := parseTrickle(s)
+			if err != nil {
+				writeProblem(w, r, http.StatusBadRequest, codeInvalidParameter, err.Error())
+				return
+			}
+			trickle = t
+		}
+		if fault.enabled() {
+			fw := newFaultWriter(w)
+			defer fw.apply(r, fault)
+			w = fw
+		} else if trickle.enabled() {
+			w = newTrickleWriter(w, r, trickle)
+		}
+		if !checkRateLimit(w, r) {
+			return
+		}
+		if priorityLanes != nil {
+			defer priorityLanes.Enter()()
+		}
+		transfer := newTransferReader(r.Body, start)
+		r.Body = transfer
+		if maxBodySize > 0 {
+			r.Body = http.MaxBytesReader(w, r.Body, maxBodySize)
+		}
+		body, err := readBody(r.Body, r.ContentLength)
 		if err != nil {
-			http.Error(w, "Failed to read request body", http.StatusBadRequest)
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				writeProblem(w, r, http.StatusRequestEntityTooLarge, codePayloadTooLarge,
+					fmt.Sprintf("Request body exceeds %d bytes", tooLarge.Limit))
+				return
+			}
+			writeProblem(w, r, http.StatusBadRequest, codeUnreadableBody, "Failed to read request body")
 			return
 		}
 		defer r.Body.Close()
 
-		res := WebhookParams{}
-		if err := json.Unmarshal(body, &res); err != nil {
-			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		// RPC messages may be binary, so they skip charset normalization.
+		if protocol, codec := connectProtocol(r); protocol != "" {
+			recordConnect(w, r, recorder, protocol, codec, body)
 			return
 		}
 
-		buffer.Push(res)
-		if debug {
-			fmt.Println("Inserted webhook:", res)
+		raw := body
+		contentType := r.Header.Get("Content-Type")
+		normalize := normalizeBody
+		if f := lookupFormat(contentType); f != nil && f.Binary {
+			normalize = gunzipBody
+		}
+		body, encoding, err := normalize(raw, contentType)
+		if err != nil {
+			rejectMalformed(w, r, recorder, raw, transfer, codeUnreadableBody, "Failed to decode request body: "+err.Error())
+			return
+		}
+		if parserPool != nil && parserPool.Defer(w, r, raw, body, transfer, encoding, start) {
+			return
+		}
+
+		var res WebhookParams
+		gh := githubDelivery(r.Header)
+		twilio := r.Header.Get("X-Twilio-Signature") != ""
+		switch {
+		case gh != nil:
+			res, err = githubWebhook(body, contentType, gh)
+		case twilio && isFormContentType(contentType):
+			res, err = twilioWebhook(body)
+		default:
+			res, err = parseWebhook(body, contentType)
+		}
+		if err != nil {
+			var pe *paramError
+			errors.As(err, &pe)
+			rejectMalformed(w, r, recorder, raw, transfer, pe.code, pe.detail)
+			return
+		}
+
+		mode := echoMode
+		if m := r.Header.Get(echoModeHeader); m != "" {
+			if err := validEchoMode(m); err != nil {
+				writeProblem(w, r, http.StatusBadRequest, codeInvalidParameter, err.Error())
+				return
+			}
+			mode = m
+		}
+
+		if ackGitHubPing(w, gh) {
+			return
+		}
+		// Dropped webhooks are acknowledged as usual, but neither stored nor
+		// counted against quotas.
+		var dropped string
+		if dropRules != nil {
+			dropped = dropRules.Drop(r, res)
+		}
+		if dropped == "" && priorityLanes != nil && !priorityLanes.Admit(w, r, res) {
+			return
 		}
+		if dropped == "" && !checkQuota(w, r, int64(len(raw))) {
+			return
+		}
+		var redirect *RedirectRule
+		var location string
+		if redirectRules != nil && dropped == "" {
+			redirect, location = redirectRules.Redirect(r, res)
+		}
+		var malformed *ResponseRule
+		if responseRules != nil && dropped == "" && redirect == nil {
+			malformed = responseRules.Match(r, res)
+		}
+		var played *CassetteResponse
+		if dropped == "" && redirect == nil && malformed == nil {
+			played = playback.Next()
+		}
+
+		stampWebhook(&res, r, raw, body, transfer.result(r), encoding, gh)
+		if mode == echoEmpty {
+			res.StatusCode = http.StatusNoContent
+		}
+		if redirect != nil {
+			res.StatusCode = redirect.Status
+		}
+		if played != nil && played.Code != 0 {
+			res.StatusCode = played.Code
+		}
+
+		stored, duplicate := res, false
+		if dropped != "" {
+			w.Header().Set("X-Echo-Dropped", dropped)
+		} else if captureControl(recorder, r) {
+			if debounceRules != nil {
+				stored, duplicate = debounceRules.Record(recorder, r, res, body)
+			} else {
+				stored, duplicate = recorder.Record(res, body)
+			}
+		}
+		if ingestMetrics != nil && stored.ID != "" && !duplicate {
+			ingestMetrics.Observe(stored, time.Since(start))
+		}
+		if !duplicate {
+			checkStripeLater(recorder.buffer, stored)
+		}
+		if checkStorm(w, recorder.buffer, stored) {
+			return
+		}
+
+		setProvenanceHeaders(w, stored)
+		if redirect != nil {
+			writeRedirect(w, redirect, location)
+			return
+		}
+		if played != nil {
+			played.write(w)
+			return
+		}
+		if malformed != nil {
+			malformed.write(w, stored, func(w http.ResponseWriter) {
+				writeEcho(w, mode, body, stored, duplicate, stored.ID != "")
+			})
+			return
+		}
+		writeEcho(w, mode, body, stored, duplicate, stored.ID != "")
+	}
+}
+
+// clearServerFields keeps only the event type, payload and version of res,
+// decoded from something a sender wrote. Every other field is the server's
+// to fill in and is never taken from what was sent.
+func clearServerFields(res *WebhookParams) {
+	*res = WebhookParams{EventType: res.EventType, Payload: res.Payload, Version: res.Version}
+}
+
+// stampWebhook fills in the fields of res, parsed from body, that come from
+// the request r rather than the body. The idempotency key always comes from
+// the header, never from the body.
+func stampWebhook(res *WebhookParams, r *http.Request, raw, body []byte, transfer *Transfer, encoding string, gh *GitHubDelivery) {
+	clearServerFields(res)
+	res.IdempotencyKey = r.Header.Get(idempotencyHeader)
+	if res.GitHub = gh; gh != nil && res.IdempotencyKey == "" && gh.Delivery != "" {
+		res.IdempotencyKey = "github:" + gh.Delivery
+	}
+	res.Trace = traceContext(r.Header)
+	res.Client, res.TLS = clientInfo(r), tlsInfo(r)
+	if r.Header.Get("X-Twilio-Signature") != "" && currentSecret(twilioAuthToken) != "" {
+		res.Verification = verifyTwilio(r, raw)
+	} else if verifyRules != nil {
+		res.Verification = verifyRules.Verify(r, raw)
+	}
+	if se := stripeEvent(body); se != nil && gh == nil {
+		if se.precheck(time.Now()) {
+			se.Check = stripePending
+		}
+		applyStripeEvent(res, se)
+	}
+	contentType := r.Header.Get("Content-Type")
+	res.Headers = r.Header.Clone()
+	res.Transfer = transfer
+	res.ContentType, res.Raw = contentType, raw
+	res.Encoding, res.SniffedType = encoding, sniffedType(raw, contentType)
+	res.StatusCode = http.StatusOK
+}
+
+// setProvenanceHeaders tells the sender how its request was recorded. The
+// record headers are left out when capture was paused or skipped.
+func setProvenanceHeaders(w http.ResponseWriter, stored WebhookParams) {
+	if stored.ID != "" {
+		w.Header().Set("X-Echo-Id", stored.ID)
+		w.Header().Set("X-Echo-Received-At", stored.ReceivedAt.Format(time.RFC3339Nano))
+		w.Header().Set("X-Echo-Sequence", strconv.FormatUint(stored.Sequence, 10))
+	}
+	w.Header().Set("X-Delivery-Count", strconv.Itoa(stored.Deliveries))
+}
+
+// paramError is a client error in query parameters, carrying the problem
+// code to report.
+type paramError struct {
+	code   string
+	detail string
+}
+
+func (e *paramError) Error() string { return e.detail }
+
+// writeParamError reports err as a 400 problem.
+func writeParamError(w http.ResponseWriter, r *http.Request, err error) {
+	var pe *paramError
+	if errors.As(err, &pe) {
+		writeProblem(w, r, http.StatusBadRequest, pe.code, pe.detail)
+		return
+	}
+	writeProblem(w, r, http.StatusBadRequest, codeInvalidParameter, err.Error())
+}
+
+// parseQueryFilter builds a filter from query parameters. When pathEventType
+// is set it is the only event type; otherwise event types come from repeated
+// or comma-separated event_type parameters. params is not modified.
+func parseQueryFilter(params url.Values, pathEventType string) (QueryFilter, error) {
+	filter, err := parseFilterParams(params, pathEventType)
+	if err == nil && len(filter.EventTypes) == 0 && filter.Status.empty() {
+		return filter, &paramError{codeMissingParameter, "Event type is required"}
+	}
+	return filter, err
+}
+
+// parseFilterParams is parseQueryFilter without requiring an event type or
+// status filter, for /stream, where no filter means every new webhook.
+func parseFilterParams(params url.Values, pathEventType string) (QueryFilter, error) {
+	params = maps.Clone(params)
+	var filter QueryFilter
+
+	if pathEventType != "" {
+		filter.EventTypes = []string{pathEventType}
+	} else {
+		for _, value := range params["event_type"] {
+			filter.EventTypes = append(filter.EventTypes, splitList(value)...)
+		}
+		delete(params, "event_type")
+	}
+	status, err := parseStatusFilter(params)
+	if err != nil {
+		return filter, err
+	}
+	filter.Status = status
+	if filter.AfterID, filter.BeforeID, err = parseIDRange(params); err != nil {
+		return filter, err
+	}
+
+	// Existence filters take repeated or comma-separated field names
+	for _, list := range []struct {
+		param string
+		dest  *[]string
+	}{
+		{"has", &filter.Has},
+		{"missing", &filter.Missing},
+		{"null", &filter.Null},
+	} {
+		for _, value := range params[list.param] {
+			*list.dest = append(*list.dest, splitList(value)...)
+		}
+		delete(params, list.param)
+	}
+
+	for _, value := range params["xpath"] {
+		cond, err := parseXPath(value)
+		if err != nil {
+			return filter, &paramError{codeInvalidParameter, err.Error()}
+		}
+		filter.XPaths = append(filter.XPaths, cond)
+	}
+	delete(params, "xpath")
+
+	if flatten := params.Get("flatten"); flatten != "" {
+		var err error
+		if filter.Flatten, err = strconv.ParseBool(flatten); err != nil {
+			return filter, &paramError{codeInvalidParameter, "flatten must be a boolean"}
+		}
+	}
+	delete(params, "flatten")
 
-		w.Header().Set("Content-Type", "application/json")
-		w.Write(body)
+	// ci=true makes every field comparison case-insensitive
+	ignoreCase := false
+	if ci := params.Get("ci"); ci != "" {
+		var err error
+		if ignoreCase, err = strconv.ParseBool(ci); err != nil {
+			return filter, &paramError{codeInvalidParameter, "ci must be a boolean"}
+		}
+		delete(params, "ci")
 	}
+
+	// Build filters from the remaining query parameters. A ":ci" suffix
+	// on the key makes that single comparison case-insensitive.
+	filter.Fields = make(map[string]string)
+	filter.FoldCase = make(map[string]bool)
+	for key, values := range params {
+		if len(values) == 0 {
+			continue
+		}
+		field, modifier, _ := strings.Cut(key, ":")
+		if modifier != "" && modifier != "ci" {
+			return filter, &paramError{codeInvalidParameter, "Unknown filter modifier " + modifier}
+		}
+		filter.Fields[field] = values[0]
+		if ignoreCase || modifier == "ci" {
+			filter.FoldCase[field] = true
+		}
+	}
+
+	return filter, nil
 }
 
 func queryWebhookHandler(buffer *RingBuffer) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		// Extract event_type from path
-		eventType := r.PathValue("event_type")
-		if eventType == "" {
-			http.Error(w, "Event type is required", http.StatusBadRequest)
+		params := r.URL.Query()
+		consistency, err := parseConsistency(params)
+		if err != nil {
+			writeParamError(w, r, err)
 			return
 		}
-
-		// Build filters from query parameters
-		filters := make(map[string]string)
-		for key, values := range r.URL.Query() {
-			if len(values) > 0 {
-				filters[key] = values[0]
-			}
+		filter, err := parseQueryFilter(params, r.PathValue("event_type"))
+		if err != nil {
+			writeParamError(w, r, err)
+			return
 		}
 
-		webhooks := buffer.Query(eventType, filters)
-
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(webhooks)
+		if consistency == consistencyAll && len(peers) > 0 {
+			writeClusterResults(w, r, buffer, filter)
+			return
+		}
+		writeQueryResults(w, r, buffer, filter)
 	}
 }
 
@@ -154,29 +772,849 @@ func getEnvInt(key string, defaultVal int) int {
 	return defaultVal
 }
 
+func getEnvString(key string, defaultVal string) string {
+	if val := os.Getenv(key); val != "" {
+		return val
+	}
+	return defaultVal
+}
+
+func getEnvBool(key string, defaultVal bool) bool {
+	if val := os.Getenv(key); val != "" {
+		if b, err := strconv.ParseBool(val); err == nil {
+			return b
+		}
+	}
+	return defaultVal
+}
+
 func main() {
+	if len(os.Args) > 1 {
+		if _, ok := subcommands[os.Args[1]]; ok {
+			if err := runSubcommand(os.Args[1], os.Args[2:], os.Stdin, os.Stdout); err != nil {
+				fmt.Fprintf(os.Stderr, "webhook-echo %s: %v\n", os.Args[1], err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+
 	// Define CLI flags
 	port := flag.Int("port", 8080, "Port to listen on (env: PORT)")
+	ingestAddr := flag.String("ingest-addr", "", "Address to listen on for webhooks, overriding -port, e.g. 0.0.0.0:8080 (env: INGEST_ADDR)")
+	basePathFlag := flag.String("base-path", "", "Path prefix to serve every route under, when behind a reverse proxy, e.g. /webhook-echo (env: BASE_PATH)")
+	adminAddr := flag.String("admin-addr", "", "Separate address for the query and admin APIs, e.g. 127.0.0.1:9090; the ingest listener then only accepts webhooks (env: ADMIN_ADDR)")
+	tlsCert := flag.String("tls-cert", "", "Certificate file to serve the ingest listener over TLS with, recording each request's handshake (env: TLS_CERT)")
+	tlsKey := flag.String("tls-key", "", "Private key file for -tls-cert (env: TLS_KEY)")
+	tlsInvalidSNI := flag.String("tls-invalid-sni", "", "Comma-separated globs of TLS server names answered with an expired, self-signed certificate, e.g. invalid.* (env: TLS_INVALID_SNI)")
+	flag.StringVar(&instanceID, "instance-id", defaultInstanceID(), "Replica name recorded on captured webhooks and sent as X-Echo-Instance, the host name by default (env: INSTANCE_ID)")
+	replicas := flag.Int("replicas", 1, "Number of replicas deployed, e.g. the Helm replicaCount; more than one is refused unless -allow-partial-queries is set (env: REPLICAS)")
+	allowPartial := flag.Bool("allow-partial-queries", false, "Run as one of several replicas, each answering queries from its own records only (env: ALLOW_PARTIAL_QUERIES)")
+	peersFlag := flag.String("peers", "", "Comma-separated base URLs of the other replicas, which queries with consistency=all are fanned out to (env: PEERS)")
 	bufferSize := flag.Int("buffer-size", 1000, "Ring buffer size (env: BUFFER_SIZE)")
+	trashRetention := flag.Duration("trash-retention", defaultTrashRetention, "How long records removed by DELETE /webhooks or a bulk delete can be restored with POST /webhooks/{id}/restore, 0 to delete for good (env: TRASH_RETENTION)")
+	retention := flag.String("retention", "", "Comma-separated event type retention overrides, first match wins, e.g. heartbeat.*=10m,payment.*=168h (env: RETENTION)")
+	bufferWarn := flag.String("buffer-warn", "", "Comma-separated buffer occupancy percentages that log a warning when reached, e.g. 80,95 (env: BUFFER_WARN)")
+	evictionWarn := flag.Int("eviction-warn", 0, "Evictions per minute above which a warning is logged, 0 to disable (env: EVICTION_WARN)")
+	capacityNotify := flag.String("capacity-notify", "", "JSON array of notifiers for buffer warnings, as in alert rule actions (env: CAPACITY_NOTIFY)")
+	lifecycleNotify := flag.String("lifecycle-notify", "", "JSON array of notifiers told when records are evicted, expired, deleted or cleared, as in alert rule actions (env: LIFECYCLE_NOTIFY)")
 	flag.BoolVar(&debug, "debug", false, "Enable debug logging")
+	metrics := flag.Bool("metrics", false, "Expose ingest histograms with exemplars on /metrics (env: METRICS)")
+	debugEndpoints := flag.Bool("debug-endpoints", false, "Expose /debug/pprof and /debug/vars (env: DEBUG_ENDPOINTS)")
+	idStrategy := flag.String("id-strategy", idRandom, "How record IDs are made: random, or the time-ordered uuidv7, ulid or snowflake, which after_id and before_id page through (env: ID_STRATEGY)")
+	snowflakeNode := flag.Int("snowflake-node", -1, "Node number from 0 to 1023 in snowflake IDs, unique per instance; -1 derives it from -instance-id (env: SNOWFLAKE_NODE)")
+	flag.IntVar(&inlineBodyLimit, "inline-body-limit", 0, "Leave the payload of bodies over this many bytes out of query responses, showing a preview of that size; the full body is served from /webhooks/{id}/body. Records still keep their payload, so this does not reduce memory use. 0 shows every payload (env: INLINE_BODY_LIMIT)")
+	flag.Int64Var(&maxBodySize, "max-body-size", 0, "Maximum request body size in bytes, 0 for no limit (env: MAX_BODY_SIZE)")
+	flag.BoolVar(&exactNumbers, "exact-numbers", false, "Keep payload numbers exactly as sent instead of as float64 (env: EXACT_NUMBERS)")
+	flag.IntVar(&maxJSONDepth, "max-json-depth", maxJSONDepth, "Maximum nesting of objects and arrays in ingested JSON, 0 for no limit (env: MAX_JSON_DEPTH)")
+	flag.DurationVar(&queryTimeout, "query-timeout", queryTimeout, "Time a query may scan the buffer before returning partial results, 0 for no limit (env: QUERY_TIMEOUT)")
+	flag.StringVar(&idempotencyHeader, "idempotency-header", idempotencyHeader, "Request header carrying the idempotency key (env: IDEMPOTENCY_HEADER)")
+	lint := flag.Bool("lint", false, "Lint ingested payloads and report findings on /lint-report (env: LINT)")
+	lagFields := flag.String("lag-fields", "", "Comma-separated payload timestamp paths reported on /stats/lag (env: LAG_FIELDS)")
+	alertRules := flag.String("alert-rules", "", "Path to a JSON file of alert rules (env: ALERT_RULES)")
+	schemaRegistry := flag.String("schema-registry", "", "Confluent schema registry URL; enables avro/binary bodies in the Confluent wire format (env: SCHEMA_REGISTRY)")
+	verifyRulesFile := flag.String("verify-rules", "", "Path to a JSON file of rules verifying webhook signatures by path, with a secondary secret for rotations (env: VERIFY_RULES)")
+	redirectRulesFile := flag.String("redirect-rules", "", "Path to a JSON file of rules for webhooks to answer with a redirect (env: REDIRECT_RULES)")
+	responseRulesFile := flag.String("response-rules", "", "Path to a JSON file of rules for webhooks to answer with oversized, invalid JSON, mislabeled or truncated responses (env: RESPONSE_RULES)")
+	priorityRulesFile := flag.String("priority-rules", "", "Path to a JSON file of rules assigning webhooks the priority class low, normal or critical (env: PRIORITY_RULES)")
+	maxInFlight := flag.Int("max-inflight", 0, "Shed low priority webhooks past half this many being ingested at once, and normal ones past all of it; 0 disables shedding (env: MAX_INFLIGHT)")
+	dropRulesFile := flag.String("drop-rules", "", "Path to a JSON file of rules for webhooks to acknowledge without storing (env: DROP_RULES)")
+	debounceRulesFile := flag.String("debounce-rules", "", "Path to a JSON file of rules keeping only the latest of a burst of webhooks sharing a payload key (env: DEBOUNCE_RULES)")
+	shadowOld := flag.String("shadow-old", "", "Forward each captured webhook to this URL of the old consumer and to -shadow-new, reporting response diffs on /shadow (env: SHADOW_OLD)")
+	shadowNew := flag.String("shadow-new", "", "URL of the new consumer implementation compared against -shadow-old (env: SHADOW_NEW)")
+	shadowMatch := flag.String("shadow-match", "", "Only shadow webhooks matching these /query parameters (env: SHADOW_MATCH)")
+	parseOffload := flag.Int("parse-offload", 0, "Answer JSON webhooks of at least this many bytes with 202 before parsing them on a worker, 0 to parse every webhook in its request (env: PARSE_OFFLOAD)")
+	parseWorkers := flag.Int("parse-workers", 2, "Workers parsing the webhooks deferred by -parse-offload (env: PARSE_WORKERS)")
+	execCommand := flag.String("exec-command", "", "Command run for each captured webhook, body on stdin (env: EXEC_COMMAND)")
+	execMatch := flag.String("exec-match", "", "Only run the exec command for webhooks matching these /query parameters (env: EXEC_MATCH)")
+	execConcurrency := flag.Int("exec-concurrency", 4, "Maximum concurrently running exec commands (env: EXEC_CONCURRENCY)")
+	execTimeout := flag.Duration("exec-timeout", 30*time.Second, "Timeout for each exec command (env: EXEC_TIMEOUT)")
+	fileSinkDir := flag.String("file-sink-dir", "", "Write each captured webhook as a JSON file into this directory (env: FILE_SINK_DIR)")
+	fileSinkMaxFiles := flag.Int("file-sink-max-files", 10000, "Maximum files kept in the file sink directory, 0 for no limit (env: FILE_SINK_MAX_FILES)")
+	fileSinkMaxBytes := flag.Int64("file-sink-max-bytes", 0, "Maximum total size of the file sink directory, 0 for no limit (env: FILE_SINK_MAX_BYTES)")
+	syslogEnabled := flag.Bool("syslog", false, "Log each captured webhook to syslog/journald (env: SYSLOG)")
+	syslogAddr := flag.String("syslog-addr", "", "Remote syslog address as udp://host:port or tcp://host:port, local daemon if empty (env: SYSLOG_ADDR)")
+	lokiURL := flag.String("loki-url", "", "Push captured webhooks to this Loki base URL (env: LOKI_URL)")
+	lokiLabels := flag.String("loki-labels", "job=webhook-echo", "Extra Loki stream labels as k=v,k=v (env: LOKI_LABELS)")
+	lokiTenant := flag.String("loki-tenant", "", "Loki tenant sent as X-Scope-OrgID (env: LOKI_TENANT)")
+	shareSecretFlag := flag.String("share-secret", "", "Key signing share links, or file:PATH or vault:PATH#FIELD to load it; random by default so links end with the process (env: SHARE_SECRET)")
+	shareURLFlag := flag.String("share-url", "", "Origin share links point at, e.g. https://hooks.example.com; by default the host the link was requested on, with the ingest port when -admin-addr is set (env: SHARE_URL)")
+	schedulesFile := flag.String("schedules", "", "Path to a JSON file of synthetic webhooks to emit on cron schedules (env: SCHEDULES)")
+	pollersFile := flag.String("pollers", "", "Path to a JSON file of provider APIs to poll for events (env: POLLERS)")
+	dropDir := flag.String("drop-dir", "", "Record JSON and XML files dropped into this directory as webhooks (env: DROP_DIR)")
+	dropInterval := flag.Duration("drop-interval", 2*time.Second, "How often to scan -drop-dir for new files (env: DROP_INTERVAL)")
+	smtpAddr := flag.String("smtp-addr", "", "Accept mail on this address, e.g. :2525, and record each message as an email webhook (env: SMTP_ADDR)")
+	mqttBroker := flag.String("mqtt-broker", "", "Publish captured webhooks to this MQTT broker, host:port (env: MQTT_BROKER)")
+	mqttTopic := flag.String("mqtt-topic", "webhooks/{event_type}", "MQTT topic template, {event_type} and {version} are expanded (env: MQTT_TOPIC)")
+	mqttUsername := flag.String("mqtt-username", "", "MQTT username (env: MQTT_USERNAME)")
+	mqttPassword := flag.String("mqtt-password", "", "MQTT password, or file:PATH or vault:PATH#FIELD to load it (env: MQTT_PASSWORD)")
+	mqttSubscribe := flag.String("mqtt-subscribe", "", "Record messages from this MQTT topic filter on -mqtt-broker as webhooks (env: MQTT_SUBSCRIBE)")
+	fault := flag.String("fault", "", "Break the connection of every ingest request after recording it: reset, reset=BYTES, hang or close-after-headers; senders can ask with the X-Echo-Fault header too (env: FAULT)")
+	trickle := flag.String("trickle", "", "Slow down ingest responses, as rate=BYTES_PER_SECOND,stall=DURATION before the headers; senders can ask with the X-Echo-Trickle header too (env: TRICKLE)")
+	flag.StringVar(&serverMode, "mode", serverMode, "Server mode: full, or echo-only to answer webhooks with their body without parsing or storing them, for load tests (env: MODE)")
+	flag.StringVar(&echoMode, "echo-mode", echoMode, "Ingest response: verbatim, canonical, envelope or empty (env: ECHO_MODE)")
+	flag.BoolVar(&graphqlMode, "graphql", false, "Record JSON GraphQL requests by operation name (env: GRAPHQL)")
+	chainHash := flag.Bool("chain-hash", false, "Chain-hash captured records and expose /verify (env: CHAIN_HASH)")
+	quota := flag.String("quota", "", "Per-bucket capture quota as records=N,bytes=N,per_minute=N (env: QUOTA)")
+	globalQuota := flag.String("global-quota", "", "Capture quota over all buckets, same syntax as -quota (env: GLOBAL_QUOTA)")
+	rateLimit := flag.String("rate-limit", "", "Simulate a receiver's rate limit, answering 429 with Retry-After and X-RateLimit-* headers, as rate=N/s|m|h,burst=N,key=HEADER (env: RATE_LIMIT)")
+	quotaHeader := flag.String("quota-bucket-header", "X-Echo-Bucket", "Request header naming the quota bucket (env: QUOTA_BUCKET_HEADER)")
+	flag.BoolVar(&recordMalformed, "record-malformed", false, "Store deliveries whose body cannot be parsed, answering them with 400 as usual (env: RECORD_MALFORMED)")
+	flag.BoolVar(&githubRecordPings, "github-record-pings", false, "Record GitHub ping events instead of only acknowledging them (env: GITHUB_RECORD_PINGS)")
+	flag.StringVar(&stripeAPIKey, "stripe-api-key", "", "Stripe API key used to cross-check received Stripe events, or file:PATH or vault:PATH#FIELD to load it (env: STRIPE_API_KEY)")
+	flag.StringVar(&twilioAuthToken, "twilio-auth-token", "", "Twilio auth token used to validate X-Twilio-Signature, or file:PATH or vault:PATH#FIELD to load it (env: TWILIO_AUTH_TOKEN)")
+	flag.StringVar(&twilioBaseURL, "twilio-base-url", "", "Public base URL Twilio calls, when behind a proxy (env: TWILIO_BASE_URL)")
+	trusted := flag.String("trusted-proxies", "", "Comma-separated IPs and CIDRs whose X-Forwarded-*, Forwarded and Cloudflare headers are trusted (env: TRUSTED_PROXIES)")
+	flag.StringVar(&traceURLTemplate, "trace-url", "", "Tracing UI link per record, {trace_id} and {span_id} are expanded (env: TRACE_URL)")
+	stormThreshold := flag.Int("storm-threshold", 0, "Deliveries of one idempotency key per minute that count as a retry storm, 0 to disable (env: STORM_THRESHOLD)")
+	stormResponse := flag.String("storm-response", "", "Body answered with status 200 to storming deliveries, echo as usual if empty (env: STORM_RESPONSE)")
+	mirrorFrom := flag.String("mirror-from", "", "Copy records from the webhook-echo instance at this URL (env: MIRROR_FROM)")
+	mirrorMatch := flag.String("mirror-match", "", "Only mirror records matching these /query parameters (env: MIRROR_MATCH)")
+	mirrorInterval := flag.Duration("mirror-interval", 2*time.Second, "How often to poll the -mirror-from instance (env: MIRROR_INTERVAL)")
+	adminToken := flag.String("admin-token", "", "Bearer token required by admin endpoints, or file:PATH or vault:PATH#FIELD to load it (env: ADMIN_TOKEN)")
+	secretRefresh := flag.Duration("secret-refresh", defaultSecretRefresh, "How often secrets given as file:PATH or vault:PATH#FIELD, and the -tls-cert files, are reloaded (env: SECRET_REFRESH)")
 	flag.Parse()
 
 	// Environment variables override defaults (but not explicit CLI flags)
 	if !isFlagSet("port") {
 		*port = getEnvInt("PORT", *port)
 	}
+	if !isFlagSet("ingest-addr") {
+		*ingestAddr = getEnvString("INGEST_ADDR", *ingestAddr)
+	}
+	if !isFlagSet("base-path") {
+		*basePathFlag = getEnvString("BASE_PATH", *basePathFlag)
+	}
+	if !isFlagSet("admin-addr") {
+		*adminAddr = getEnvString("ADMIN_ADDR", *adminAddr)
+	}
+	if !isFlagSet("tls-cert") {
+		*tlsCert = getEnvString("TLS_CERT", *tlsCert)
+	}
+	if !isFlagSet("tls-key") {
+		*tlsKey = getEnvString("TLS_KEY", *tlsKey)
+	}
+	if !isFlagSet("tls-invalid-sni") {
+		*tlsInvalidSNI = getEnvString("TLS_INVALID_SNI", *tlsInvalidSNI)
+	}
+	invalidCertNames = splitList(*tlsInvalidSNI)
+	if !isFlagSet("instance-id") {
+		instanceID = getEnvString("INSTANCE_ID", instanceID)
+	}
+	if !isFlagSet("replicas") {
+		*replicas = getEnvInt("REPLICAS", *replicas)
+	}
+	if !isFlagSet("allow-partial-queries") {
+		*allowPartial = getEnvBool("ALLOW_PARTIAL_QUERIES", *allowPartial)
+	}
+	if !isFlagSet("peers") {
+		*peersFlag = getEnvString("PEERS", *peersFlag)
+	}
+	peers, replicaCount = splitList(*peersFlag), *replicas
+	if err := checkReplicas(*replicas, *allowPartial); err != nil {
+		log.Fatalf("Invalid -replicas: %v", err)
+	}
 	if !isFlagSet("buffer-size") {
 		*bufferSize = getEnvInt("BUFFER_SIZE", *bufferSize)
 	}
+	if !isFlagSet("trash-retention") {
+		*trashRetention = getEnvDuration("TRASH_RETENTION", *trashRetention)
+	}
+	if !isFlagSet("retention") {
+		*retention = getEnvString("RETENTION", *retention)
+	}
+	if !isFlagSet("buffer-warn") {
+		*bufferWarn = getEnvString("BUFFER_WARN", *bufferWarn)
+	}
+	if !isFlagSet("eviction-warn") {
+		*evictionWarn = getEnvInt("EVICTION_WARN", *evictionWarn)
+	}
+	if !isFlagSet("capacity-notify") {
+		*capacityNotify = getEnvString("CAPACITY_NOTIFY", *capacityNotify)
+	}
+	if !isFlagSet("lifecycle-notify") {
+		*lifecycleNotify = getEnvString("LIFECYCLE_NOTIFY", *lifecycleNotify)
+	}
+	if !isFlagSet("id-strategy") {
+		*idStrategy = getEnvString("ID_STRATEGY", *idStrategy)
+	}
+	if !isFlagSet("snowflake-node") {
+		*snowflakeNode = getEnvInt("SNOWFLAKE_NODE", *snowflakeNode)
+	}
+	if g, err := NewIDGenerator(*idStrategy, *snowflakeNode); err != nil {
+		log.Fatalf("Invalid record ID settings: %v", err)
+	} else {
+		recordIDs = g
+	}
+	if !isFlagSet("inline-body-limit") {
+		inlineBodyLimit = getEnvInt("INLINE_BODY_LIMIT", inlineBodyLimit)
+	}
+	if inlineBodyLimit < 0 {
+		log.Fatalf("Invalid -inline-body-limit: must not be negative")
+	}
+	if !isFlagSet("max-body-size") {
+		maxBodySize = int64(getEnvInt("MAX_BODY_SIZE", int(maxBodySize)))
+	}
+	if !isFlagSet("parse-offload") {
+		*parseOffload = getEnvInt("PARSE_OFFLOAD", *parseOffload)
+	}
+	if !isFlagSet("parse-workers") {
+		*parseWorkers = getEnvInt("PARSE_WORKERS", *parseWorkers)
+	}
+	if !isFlagSet("metrics") {
+		*metrics = getEnvBool("METRICS", *metrics)
+	}
+	if !isFlagSet("debug-endpoints") {
+		*debugEndpoints = getEnvBool("DEBUG_ENDPOINTS", *debugEndpoints)
+	}
+	if !isFlagSet("exact-numbers") {
+		exactNumbers = getEnvBool("EXACT_NUMBERS", exactNumbers)
+	}
+	if !isFlagSet("max-json-depth") {
+		maxJSONDepth = getEnvInt("MAX_JSON_DEPTH", maxJSONDepth)
+	}
+	if !isFlagSet("query-timeout") {
+		queryTimeout = getEnvDuration("QUERY_TIMEOUT", queryTimeout)
+	}
+	if !isFlagSet("idempotency-header") {
+		idempotencyHeader = getEnvString("IDEMPOTENCY_HEADER", idempotencyHeader)
+	}
+	if !isFlagSet("lint") {
+		*lint = getEnvBool("LINT", *lint)
+	}
+	if !isFlagSet("lag-fields") {
+		*lagFields = getEnvString("LAG_FIELDS", *lagFields)
+	}
+	if !isFlagSet("alert-rules") {
+		*alertRules = getEnvString("ALERT_RULES", *alertRules)
+	}
+	if !isFlagSet("schema-registry") {
+		*schemaRegistry = getEnvString("SCHEMA_REGISTRY", *schemaRegistry)
+	}
+	if !isFlagSet("drop-rules") {
+		*dropRulesFile = getEnvString("DROP_RULES", *dropRulesFile)
+	}
+	if !isFlagSet("debounce-rules") {
+		*debounceRulesFile = getEnvString("DEBOUNCE_RULES", *debounceRulesFile)
+	}
+	if !isFlagSet("priority-rules") {
+		*priorityRulesFile = getEnvString("PRIORITY_RULES", *priorityRulesFile)
+	}
+	if !isFlagSet("max-inflight") {
+		*maxInFlight = getEnvInt("MAX_INFLIGHT", *maxInFlight)
+	}
+	if !isFlagSet("response-rules") {
+		*responseRulesFile = getEnvString("RESPONSE_RULES", *responseRulesFile)
+	}
+	if !isFlagSet("redirect-rules") {
+		*redirectRulesFile = getEnvString("REDIRECT_RULES", *redirectRulesFile)
+	}
+	if !isFlagSet("verify-rules") {
+		*verifyRulesFile = getEnvString("VERIFY_RULES", *verifyRulesFile)
+	}
+	if !isFlagSet("exec-command") {
+		*execCommand = getEnvString("EXEC_COMMAND", *execCommand)
+	}
+	if !isFlagSet("shadow-old") {
+		*shadowOld = getEnvString("SHADOW_OLD", *shadowOld)
+	}
+	if !isFlagSet("shadow-new") {
+		*shadowNew = getEnvString("SHADOW_NEW", *shadowNew)
+	}
+	if !isFlagSet("shadow-match") {
+		*shadowMatch = getEnvString("SHADOW_MATCH", *shadowMatch)
+	}
+	if !isFlagSet("exec-match") {
+		*execMatch = getEnvString("EXEC_MATCH", *execMatch)
+	}
+	if !isFlagSet("exec-concurrency") {
+		*execConcurrency = getEnvInt("EXEC_CONCURRENCY", *execConcurrency)
+	}
+	if !isFlagSet("exec-timeout") {
+		*execTimeout = getEnvDuration("EXEC_TIMEOUT", *execTimeout)
+	}
+	if !isFlagSet("file-sink-dir") {
+		*fileSinkDir = getEnvString("FILE_SINK_DIR", *fileSinkDir)
+	}
+	if !isFlagSet("file-sink-max-files") {
+		*fileSinkMaxFiles = getEnvInt("FILE_SINK_MAX_FILES", *fileSinkMaxFiles)
+	}
+	if !isFlagSet("file-sink-max-bytes") {
+		*fileSinkMaxBytes = int64(getEnvInt("FILE_SINK_MAX_BYTES", int(*fileSinkMaxBytes)))
+	}
+	if !isFlagSet("syslog") {
+		*syslogEnabled = getEnvBool("SYSLOG", *syslogEnabled)
+	}
+	if !isFlagSet("syslog-addr") {
+		*syslogAddr = getEnvString("SYSLOG_ADDR", *syslogAddr)
+	}
+	if !isFlagSet("loki-url") {
+		*lokiURL = getEnvString("LOKI_URL", *lokiURL)
+	}
+	if !isFlagSet("loki-labels") {
+		*lokiLabels = getEnvString("LOKI_LABELS", *lokiLabels)
+	}
+	if !isFlagSet("loki-tenant") {
+		*lokiTenant = getEnvString("LOKI_TENANT", *lokiTenant)
+	}
+	if !isFlagSet("share-secret") {
+		*shareSecretFlag = getEnvString("SHARE_SECRET", *shareSecretFlag)
+	}
+	shareSecret = *shareSecretFlag
+	if !isFlagSet("share-url") {
+		*shareURLFlag = getEnvString("SHARE_URL", *shareURLFlag)
+	}
+	shareURL = *shareURLFlag
+	if u, err := url.Parse(shareURL); shareURL != "" && (err != nil || u.Scheme == "" || u.Host == "") {
+		log.Fatalf("Invalid -share-url %q: expected an origin such as https://hooks.example.com", shareURL)
+	}
+	if !isFlagSet("schedules") {
+		*schedulesFile = getEnvString("SCHEDULES", *schedulesFile)
+	}
+	if !isFlagSet("pollers") {
+		*pollersFile = getEnvString("POLLERS", *pollersFile)
+	}
+	if !isFlagSet("drop-dir") {
+		*dropDir = getEnvString("DROP_DIR", *dropDir)
+	}
+	if !isFlagSet("drop-interval") {
+		*dropInterval = getEnvDuration("DROP_INTERVAL", *dropInterval)
+	}
+	if !isFlagSet("smtp-addr") {
+		*smtpAddr = getEnvString("SMTP_ADDR", *smtpAddr)
+	}
+	if !isFlagSet("mqtt-broker") {
+		*mqttBroker = getEnvString("MQTT_BROKER", *mqttBroker)
+	}
+	if !isFlagSet("mqtt-topic") {
+		*mqttTopic = getEnvString("MQTT_TOPIC", *mqttTopic)
+	}
+	if !isFlagSet("mqtt-username") {
+		*mqttUsername = getEnvString("MQTT_USERNAME", *mqttUsername)
+	}
+	if !isFlagSet("mqtt-password") {
+		*mqttPassword = getEnvString("MQTT_PASSWORD", *mqttPassword)
+	}
+	if !isFlagSet("mqtt-subscribe") {
+		*mqttSubscribe = getEnvString("MQTT_SUBSCRIBE", *mqttSubscribe)
+	}
+	if !isFlagSet("mode") {
+		serverMode = getEnvString("MODE", serverMode)
+	}
+	if err := validServerMode(serverMode); err != nil {
+		log.Fatalf("Invalid -mode: %v", err)
+	}
+	if !isFlagSet("echo-mode") {
+		echoMode = getEnvString("ECHO_MODE", echoMode)
+	}
+	if err := validEchoMode(echoMode); err != nil {
+		log.Fatalf("Invalid -echo-mode: %v", err)
+	}
+	if !isFlagSet("fault") {
+		*fault = getEnvString("FAULT", *fault)
+	}
+	if *fault != "" {
+		f, err := parseFault(*fault)
+		if err != nil {
+			log.Fatalf("Invalid -fault: %v", err)
+		}
+		defaultFault = f
+	}
+	if !isFlagSet("trickle") {
+		*trickle = getEnvString("TRICKLE", *trickle)
+	}
+	if *trickle != "" {
+		t, err := parseTrickle(*trickle)
+		if err != nil {
+			log.Fatalf("Invalid -trickle: %v", err)
+		}
+		defaultTrickle = t
+	}
+	if !isFlagSet("graphql") {
+		graphqlMode = getEnvBool("GRAPHQL", graphqlMode)
+	}
+	if !isFlagSet("chain-hash") {
+		*chainHash = getEnvBool("CHAIN_HASH", *chainHash)
+	}
+	if !isFlagSet("quota") {
+		*quota = getEnvString("QUOTA", *quota)
+	}
+	if !isFlagSet("global-quota") {
+		*globalQuota = getEnvString("GLOBAL_QUOTA", *globalQuota)
+	}
+	if !isFlagSet("rate-limit") {
+		*rateLimit = getEnvString("RATE_LIMIT", *rateLimit)
+	}
+	if !isFlagSet("quota-bucket-header") {
+		*quotaHeader = getEnvString("QUOTA_BUCKET_HEADER", *quotaHeader)
+	}
+	if !isFlagSet("record-malformed") {
+		recordMalformed = getEnvBool("RECORD_MALFORMED", recordMalformed)
+	}
+	if !isFlagSet("github-record-pings") {
+		githubRecordPings = getEnvBool("GITHUB_RECORD_PINGS", githubRecordPings)
+	}
+	if !isFlagSet("stripe-api-key") {
+		stripeAPIKey = getEnvString("STRIPE_API_KEY", stripeAPIKey)
+	}
+	if !isFlagSet("twilio-auth-token") {
+		twilioAuthToken = getEnvString("TWILIO_AUTH_TOKEN", twilioAuthToken)
+	}
+	if !isFlagSet("twilio-base-url") {
+		twilioBaseURL = getEnvString("TWILIO_BASE_URL", twilioBaseURL)
+	}
+	if !isFlagSet("trusted-proxies") {
+		*trusted = getEnvString("TRUSTED_PROXIES", *trusted)
+	}
+	if !isFlagSet("trace-url") {
+		traceURLTemplate = getEnvString("TRACE_URL", traceURLTemplate)
+	}
+	if !isFlagSet("storm-threshold") {
+		*stormThreshold = getEnvInt("STORM_THRESHOLD", *stormThreshold)
+	}
+	if !isFlagSet("storm-response") {
+		*stormResponse = getEnvString("STORM_RESPONSE", *stormResponse)
+	}
+	if !isFlagSet("mirror-from") {
+		*mirrorFrom = getEnvString("MIRROR_FROM", *mirrorFrom)
+	}
+	if !isFlagSet("mirror-match") {
+		*mirrorMatch = getEnvString("MIRROR_MATCH", *mirrorMatch)
+	}
+	if !isFlagSet("mirror-interval") {
+		*mirrorInterval = getEnvDuration("MIRROR_INTERVAL", *mirrorInterval)
+	}
+	if !isFlagSet("admin-token") {
+		*adminToken = getEnvString("ADMIN_TOKEN", *adminToken)
+	}
+	if !isFlagSet("secret-refresh") {
+		*secretRefresh = getEnvDuration("SECRET_REFRESH", *secretRefresh)
+	}
+	for _, secret := range []struct{ flag, value string }{
+		{"admin-token", *adminToken},
+		{"share-secret", shareSecret},
+		{"stripe-api-key", stripeAPIKey},
+		{"twilio-auth-token", twilioAuthToken},
+		{"mqtt-password", *mqttPassword},
+	} {
+		if err := secrets.Load(secret.value); err != nil {
+			log.Fatalf("Invalid -%s: %v", secret.flag, err)
+		}
+	}
+	if *secretRefresh <= 0 {
+		log.Fatalf("Invalid -secret-refresh: must be positive")
+	}
+	go secrets.Run(context.Background(), *secretRefresh)
+
+	prefix, err := parseBasePath(*basePathFlag)
+	if err != nil {
+		log.Fatalf("Invalid -base-path: %v", err)
+	}
+	basePath = prefix
+
+	addr := fmt.Sprintf(":%d", *port)
+	if *ingestAddr != "" {
+		addr = *ingestAddr
+	}
+	var ingestTLS *tls.Config
+	if *tlsCert != "" || *tlsKey != "" {
+		certs, err := newCertificateReloader(*tlsCert, *tlsKey)
+		if err != nil {
+			log.Fatalf("Invalid -tls-cert or -tls-key: %v", err)
+		}
+		go certs.Run(context.Background(), *secretRefresh)
+		ingestTLS = tlsConfig(certs)
+	}
+	if serverMode == modeEchoOnly {
+		log.Printf("Echo-only server starting on %s, webhooks are neither parsed nor stored", addr)
+		log.Fatal(listenAndServe(addr, http.HandlerFunc(echoOnlyHandler), ingestTLS))
+	}
 
 	buffer := NewRingBuffer(*bufferSize)
+	buffer.SetTrashRetention(*trashRetention)
+	if *retention != "" {
+		rules, err := parseRetention(*retention)
+		if err != nil {
+			log.Fatalf("Invalid -retention: %v", err)
+		}
+		if *chainHash {
+			log.Fatalf("Invalid -retention: expiring records would break the -chain-hash chain")
+		}
+		buffer.SetRetention(rules)
+		go buffer.RunRetention(context.Background())
+	}
 
-	http.HandleFunc("POST /", recordWebhookHandler(buffer))
-	http.HandleFunc("GET /query/{event_type}", queryWebhookHandler(buffer))
+	var hooks []IngestHook
+	mux := http.NewServeMux()
+	if *chainHash {
+		buffer.ChainHashes()
+		handleAPI(mux, "GET /verify", verifyChainHandler(buffer))
+	}
+	levels, err := parseLevels(*bufferWarn)
+	if err != nil {
+		log.Fatalf("Invalid -buffer-warn: %v", err)
+	}
+	notifiers, err := parseNotifiers(*capacityNotify)
+	if err != nil {
+		log.Fatalf("Invalid -capacity-notify: %v", err)
+	}
+	monitor := NewCapacityMonitor(buffer, levels, *evictionWarn, notifiers)
+	if *lifecycleNotify != "" {
+		lifecycleNotifiers, err := parseNotifiers(*lifecycleNotify)
+		if err != nil {
+			log.Fatalf("Invalid -lifecycle-notify: %v", err)
+		}
+		lifecycle := NewLifecycleNotifier(lifecycleNotifiers)
+		buffer.AddLifecycleHook(lifecycle.Observe)
+		go lifecycle.Run(context.Background())
+	}
+	hooks = append(hooks, monitor)
+	mux.HandleFunc("GET /healthz", healthHandler(monitor))
+	if *metrics {
+		ingestMetrics = NewMetrics()
+		mux.HandleFunc("GET /metrics", metricsHandler(ingestMetrics))
+	}
+	if *lint {
+		linter := NewLinter()
+		hooks = append(hooks, linter)
+		handleAPI(mux, "GET /lint-report", lintReportHandler(linter))
+	}
+	if fields := splitList(*lagFields); len(fields) > 0 {
+		tracker := NewLagTracker(fields)
+		hooks = append(hooks, tracker)
+		handleAPI(mux, "GET /stats/lag", lagReportHandler(tracker))
+	}
+	if *alertRules != "" {
+		rules, err := LoadAlertRules(*alertRules)
+		if err != nil {
+			log.Fatalf("Failed to load alert rules: %v", err)
+		}
+		engine, err := NewAlertEngine(rules)
+		if err != nil {
+			log.Fatalf("Invalid alert rules: %v", err)
+		}
+		go engine.Run(context.Background())
+		hooks = append(hooks, engine)
+		handleAPI(mux, "GET /alerts", alertsHandler(engine))
+		log.Printf("Loaded %d alert rules from %s", len(rules), *alertRules)
+	}
+	if *verifyRulesFile != "" {
+		rules, err := LoadVerifyRules(*verifyRulesFile)
+		if err != nil {
+			log.Fatalf("Failed to load verify rules: %v", err)
+		}
+		if verifyRules, err = NewVerifyRules(rules); err != nil {
+			log.Fatalf("Invalid verify rules: %v", err)
+		}
+		handleAPI(mux, "GET /verify-rules", verifyRulesHandler(verifyRules))
+		log.Printf("Loaded %d verify rules from %s", len(rules), *verifyRulesFile)
+	}
+	if *dropRulesFile != "" {
+		rules, err := LoadDropRules(*dropRulesFile)
+		if err != nil {
+			log.Fatalf("Failed to load drop rules: %v", err)
+		}
+		if dropRules, err = NewDropRules(rules); err != nil {
+			log.Fatalf("Invalid drop rules: %v", err)
+		}
+		handleAPI(mux, "GET /drop-rules", dropRulesHandler(dropRules))
+		log.Printf("Loaded %d drop rules from %s", len(rules), *dropRulesFile)
+	}
+	if *debounceRulesFile != "" {
+		if *chainHash {
+			log.Fatalf("Invalid -debounce-rules: %v", errChainedDelete)
+		}
+		rules, err := LoadDebounceRules(*debounceRulesFile)
+		if err != nil {
+			log.Fatalf("Failed to load debounce rules: %v", err)
+		}
+		if debounceRules, err = NewDebouncer(rules); err != nil {
+			log.Fatalf("Invalid debounce rules: %v", err)
+		}
+		handleAPI(mux, "GET /debounce-rules", debounceRulesHandler(debounceRules))
+		log.Printf("Loaded %d debounce rules from %s", len(rules), *debounceRulesFile)
+	}
+	if *maxInFlight > 0 {
+		var rules []PriorityRule
+		var err error
+		if *priorityRulesFile != "" {
+			if rules, err = LoadPriorityRules(*priorityRulesFile); err != nil {
+				log.Fatalf("Failed to load priority rules: %v", err)
+			}
+		}
+		if priorityLanes, err = NewPriorityLanes(*maxInFlight, rules); err != nil {
+			log.Fatalf("Invalid priority rules: %v", err)
+		}
+		handleAPI(mux, "GET /priority", priorityLanesHandler(priorityLanes))
+		log.Printf("Shedding webhooks past %d in flight, with %d priority rules", *maxInFlight, len(rules))
+	} else if *priorityRulesFile != "" {
+		log.Fatalf("Invalid -priority-rules: needs -max-inflight")
+	}
+	if *redirectRulesFile != "" {
+		rules, err := LoadRedirectRules(*redirectRulesFile)
+		if err != nil {
+			log.Fatalf("Failed to load redirect rules: %v", err)
+		}
+		if redirectRules, err = NewRedirectRules(rules); err != nil {
+			log.Fatalf("Invalid redirect rules: %v", err)
+		}
+		handleAPI(mux, "GET /redirect-rules", redirectRulesHandler(redirectRules))
+		log.Printf("Loaded %d redirect rules from %s", len(rules), *redirectRulesFile)
+	}
+	if *responseRulesFile != "" {
+		rules, err := LoadResponseRules(*responseRulesFile)
+		if err != nil {
+			log.Fatalf("Failed to load response rules: %v", err)
+		}
+		if responseRules, err = NewResponseRules(rules); err != nil {
+			log.Fatalf("Invalid response rules: %v", err)
+		}
+		handleAPI(mux, "GET /response-rules", responseRulesHandler(responseRules))
+		log.Printf("Loaded %d response rules from %s", len(rules), *responseRulesFile)
+	}
+	if *schemaRegistry != "" {
+		if u, err := url.Parse(*schemaRegistry); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			log.Fatalf("Invalid -schema-registry: want an http or https URL")
+		}
+		registry := NewSchemaRegistry(*schemaRegistry, &http.Client{Timeout: 10 * time.Second})
+		RegisterFormat("avro/binary", BodyFormat{Name: "Avro", Code: codeInvalidAvro, Binary: true, Parser: registry})
+		RegisterFormat("application/vnd.apache.avro+binary", BodyFormat{Name: "Avro", Code: codeInvalidAvro, Binary: true, Parser: registry})
+	}
+	if command := strings.Fields(*execCommand); len(command) > 0 {
+		var filter *QueryFilter
+		if *execMatch != "" {
+			f, err := parseMatch(*execMatch)
+			if err != nil {
+				log.Fatalf("Invalid -exec-match: %v", err)
+			}
+			filter = &f
+		}
+		hooks = append(hooks, NewExecHook(command, filter, *execConcurrency, *execTimeout))
+	}
+	if *shadowOld != "" || *shadowNew != "" {
+		if *shadowOld == "" || *shadowNew == "" {
+			log.Fatalf("Invalid -shadow-old and -shadow-new: both are needed")
+		}
+		var filter *QueryFilter
+		if *shadowMatch != "" {
+			f, err := parseMatch(*shadowMatch)
+			if err != nil {
+				log.Fatalf("Invalid -shadow-match: %v", err)
+			}
+			filter = &f
+		}
+		shadow := NewShadowDiff(*shadowOld, *shadowNew, filter, http.DefaultClient, buffer)
+		hooks = append(hooks, shadow)
+		handleAPI(mux, "GET /shadow", shadowHandler(shadow))
+	}
+	if *fileSinkDir != "" {
+		sink, err := NewFileSink(*fileSinkDir, *fileSinkMaxFiles, *fileSinkMaxBytes)
+		if err != nil {
+			log.Fatalf("Failed to open file sink: %v", err)
+		}
+		hooks = append(hooks, sink)
+	}
+	if *syslogEnabled {
+		sink, err := NewSyslogSink(*syslogAddr, "webhook-echo")
+		if err != nil {
+			log.Fatalf("Failed to connect to syslog: %v", err)
+		}
+		hooks = append(hooks, sink)
+	}
+	if *lokiURL != "" {
+		labels, err := parseLabels(*lokiLabels)
+		if err != nil {
+			log.Fatalf("Invalid -loki-labels: %v", err)
+		}
+		hooks = append(hooks, NewLokiSink(*lokiURL, labels, *lokiTenant))
+	}
+	if *quota != "" || *globalQuota != "" {
+		bucketLimits, err := parseQuotaLimits(*quota)
+		if err != nil {
+			log.Fatalf("Invalid -quota: %v", err)
+		}
+		globalLimits, err := parseQuotaLimits(*globalQuota)
+		if err != nil {
+			log.Fatalf("Invalid -global-quota: %v", err)
+		}
+		quotas = NewQuotas(*quotaHeader, bucketLimits, globalLimits)
+		buffer.AddLifecycleHook(quotas.Observe)
+		hooks = append(hooks, quotas)
+		handleAPI(mux, "GET /quotas", quotasHandler(quotas))
+	}
+	if *rateLimit != "" {
+		profile, err := parseRateLimit(*rateLimit)
+		if err != nil {
+			log.Fatalf("Invalid -rate-limit: %v", err)
+		}
+		rateLimiter = NewRateLimiter(profile)
+		handleAPI(mux, "GET /rate-limit", rateLimitHandler(rateLimiter))
+	}
+	proxies, err := parseTrustedProxies(*trusted)
+	if err != nil {
+		log.Fatalf("Invalid -trusted-proxies: %v", err)
+	}
+	trustedProxies = proxies
+	if *stormThreshold > 0 {
+		storms = NewStormDetector(*stormThreshold, *stormResponse)
+	}
+	mqttOpts := mqttOptions{
+		ClientID: fmt.Sprintf("webhook-echo-%d", os.Getpid()),
+		Username: *mqttUsername,
+		Password: currentSecret(*mqttPassword),
+	}
+	if *mqttBroker != "" {
+		hooks = append(hooks, NewMQTTSink(*mqttBroker, *mqttTopic, mqttOpts))
+	}
+	subscriptions := NewSubscriptions(buffer, http.DefaultClient)
+	hooks = append(hooks, subscriptions)
+	registerSubscriptionRoutes(mux, subscriptions, *adminToken)
+	assertions := NewAssertions(buffer, http.DefaultClient)
+	hooks = append(hooks, assertions)
+	registerAssertionRoutes(mux, assertions, *adminToken)
+	recorder := registerRoutes(mux, buffer, *adminToken, hooks...)
+	if *parseOffload > 0 {
+		if *parseWorkers <= 0 {
+			log.Fatalf("Invalid -parse-workers: must be positive")
+		}
+		parserPool = NewParserPool(recorder, *parseOffload, *parseWorkers)
+		handleAPI(mux, "GET /parser-pool", parserPoolHandler(parserPool))
+		log.Printf("Parsing webhooks of %d bytes or more on %d workers", *parseOffload, *parseWorkers)
+	}
+	if *mqttBroker != "" && *mqttSubscribe != "" {
+		subOpts := mqttOpts
+		subOpts.ClientID += "-sub"
+		go NewMQTTBridge(*mqttBroker, *mqttSubscribe, subOpts, recorder).Run(context.Background())
+	}
+	if *smtpAddr != "" {
+		gateway := NewSMTPGateway(recorder)
+		go func() { log.Fatal(gateway.ListenAndServe(*smtpAddr)) }()
+	}
+	if *schedulesFile != "" {
+		configs, err := LoadSchedules(*schedulesFile)
+		if err != nil {
+			log.Fatalf("Failed to load schedules: %v", err)
+		}
+		var emitters []*Emitter
+		for _, cfg := range configs {
+			emitter, err := NewEmitter(cfg, http.DefaultClient, recorder)
+			if err != nil {
+				log.Fatalf("Invalid schedules: %v", err)
+			}
+			go emitter.Run(context.Background())
+			emitters = append(emitters, emitter)
+		}
+		handleAPI(mux, "GET /schedules", schedulesHandler(emitters))
+		log.Printf("Loaded %d schedules from %s", len(emitters), *schedulesFile)
+	}
+	if *pollersFile != "" {
+		configs, err := LoadPollers(*pollersFile)
+		if err != nil {
+			log.Fatalf("Failed to load pollers: %v", err)
+		}
+		var pollers []*Poller
+		for _, cfg := range configs {
+			poller, err := NewPoller(cfg, &http.Client{Timeout: 30 * time.Second}, recorder)
+			if err != nil {
+				log.Fatalf("Invalid pollers: %v", err)
+			}
+			go poller.Run(context.Background())
+			pollers = append(pollers, poller)
+		}
+		handleAPI(mux, "GET /pollers", pollersHandler(pollers))
+		log.Printf("Polling %d provider APIs from %s", len(pollers), *pollersFile)
+	}
+	if *dropDir != "" {
+		if *dropInterval <= 0 {
+			log.Fatalf("Invalid -drop-interval: must be positive")
+		}
+		folder, err := NewDropFolder(*dropDir, *dropInterval, recorder)
+		if err != nil {
+			log.Fatalf("Invalid -drop-dir: %v", err)
+		}
+		go folder.Run(context.Background())
+	}
+	if *mirrorFrom != "" {
+		mirror, err := NewMirror(*mirrorFrom, *mirrorMatch, *mirrorInterval, http.DefaultClient, recorder)
+		if err != nil {
+			log.Fatalf("Invalid -mirror-match: %v", err)
+		}
+		go mirror.Run(context.Background())
+	}
+	registerCaptureRoutes(mux, recorder, *adminToken)
+	handleAPI(mux, "POST /replay", requireAdmin(*adminToken, replayHandler(buffer, http.DefaultClient)))
+	handleAPI(mux, "POST /webhooks/bulk", requireAdmin(*adminToken, bulkHandler(buffer, http.DefaultClient)))
+	handleAPI(mux, "DELETE /webhooks", requireAdmin(*adminToken, clearHandler(buffer)))
+	handleAPI(mux, "GET /trash", requireAdmin(*adminToken, trashHandler(buffer)))
+	handleAPI(mux, "POST /webhooks/{id}/restore", requireAdmin(*adminToken, restoreHandler(buffer)))
+	handleAPI(mux, "POST /cassette/playback", requireAdmin(*adminToken, loadPlaybackHandler(playback)))
+	handleAPI(mux, "GET /cassette/playback", playbackStatusHandler(playback))
+	handleAPI(mux, "DELETE /cassette/playback", requireAdmin(*adminToken, stopPlaybackHandler(playback)))
+	if *debugEndpoints {
+		registerDebugRoutes(mux, buffer, *adminToken, hooks...)
+	}
 
-	addr := fmt.Sprintf(":%d", *port)
-	log.Printf("Server starting on %s (buffer size: %d)", addr, *bufferSize)
-	log.Fatal(http.ListenAndServe(addr, nil))
+	public := mux
+	if *adminAddr != "" {
+		public = newIngestMux(recorder, monitor)
+		sharedListener.addr, sharedListener.tls = addr, ingestTLS != nil
+		log.Printf("Admin and query APIs listening on %s", *adminAddr)
+		go func() {
+			log.Fatal(http.ListenAndServe(*adminAddr, withInstanceHeader(withBasePath(withProblemFallback(mux)))))
+		}()
+	}
+	log.Printf("Server starting on %s%s (buffer size: %d)", addr, basePath, *bufferSize)
+	log.Fatal(listenAndServe(addr, withInstanceHeader(withBasePath(withProblemFallback(public))), ingestTLS))
+}
+
+func getEnvDuration(key string, defaultVal time.Duration) time.Duration {
+	if val := os.Getenv(key); val != "" {
+		if d, err := time.ParseDuration(val); err == nil {
+			return d
+		}
+	}
+	return defaultVal
+}
+
+// parseMatch parses a filter given in /query parameter syntax, e.g.
+// "event_type=payment.failed&currency=usd".
+func parseMatch(s string) (QueryFilter, error) {
+	params, err := url.ParseQuery(s)
+	if err != nil {
+		return QueryFilter{}, err
+	}
+	return parseQueryFilter(params, "")
+}
+
+// splitList splits a comma-separated flag value, dropping empty entries.
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
 }
 
 func isFlagSet(name string) bool {
@@ -3,19 +3,29 @@ package main
 import (
 	"bytes"
 	"encoding/json"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 )
 
 func newTestServer() *http.ServeMux {
 	buffer := NewRingBuffer(100)
 	mux := http.NewServeMux()
-	mux.HandleFunc("POST /", recordWebhookHandler(buffer))
-	mux.HandleFunc("GET /query/{event_type}", queryWebhookHandler(buffer))
+	registerRoutes(mux, buffer, "secret")
 	return mux
 }
 
+// adminRequest is a request carrying the admin token newTestServer is set
+// up with.
+func adminRequest(method, path string, body io.Reader) *http.Request {
+	req := httptest.NewRequest(method, path, body)
+	req.Header.Set("Authorization", "Bearer secret")
+	return req
+}
+
 func postWebhook(t *testing.T, mux *http.ServeMux, body string) *httptest.ResponseRecorder {
 	t.Helper()
 	req := httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString(body))
@@ -34,6 +44,13 @@ func queryWebhooks(t *testing.T, mux *http.ServeMux, path string) []WebhookParam
 		t.Fatalf("query failed with status %d: %s", rec.Code, rec.Body.String())
 	}
 
+	if strings.HasPrefix(path, "/v1/") {
+		var res QueryResult
+		if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+			t.Fatalf("failed to parse response: %v", err)
+		}
+		return res.Items
+	}
 	var results []WebhookParams
 	if err := json.Unmarshal(rec.Body.Bytes(), &results); err != nil {
 		t.Fatalf("failed to parse response: %v", err)
@@ -159,3 +176,164 @@ func TestPostEchoesBody(t *testing.T) {
 		t.Errorf("expected response to echo body, got %s", rec.Body.String())
 	}
 }
+
+func TestIdempotentRedelivery(t *testing.T) {
+	mux := newTestServer()
+
+	post := func(key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString(`{"event":"payment","data":{"id":"pi_1"}}`))
+		req.Header.Set("X-Idempotency-Key", key)
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec
+	}
+
+	post("abc")
+	post("abc")
+	rec := post("abc")
+	if got := rec.Header().Get("X-Delivery-Count"); got != "3" {
+		t.Errorf("expected X-Delivery-Count 3, got %q", got)
+	}
+	post("def")
+
+	results := queryWebhooks(t, mux, "/query/payment")
+	if len(results) != 2 {
+		t.Fatalf("expected 2 records, got %d", len(results))
+	}
+	if results[1].IdempotencyKey != "abc" || results[1].Deliveries != 3 {
+		t.Errorf("expected abc delivered 3 times, got %q/%d", results[1].IdempotencyKey, results[1].Deliveries)
+	}
+	if results[0].IdempotencyKey != "def" || results[0].Deliveries != 1 {
+		t.Errorf("expected def delivered once, got %q/%d", results[0].IdempotencyKey, results[0].Deliveries)
+	}
+}
+
+func TestIdempotencyKeyForgottenAfterEviction(t *testing.T) {
+	buffer := NewRingBuffer(1)
+
+	buffer.Push(WebhookParams{EventType: "a", IdempotencyKey: "k1"})
+	buffer.Push(WebhookParams{EventType: "b", IdempotencyKey: "k2"})
+	if _, duplicate := buffer.Push(WebhookParams{EventType: "a", IdempotencyKey: "k1"}); duplicate {
+		t.Error("evicted key should not be treated as a duplicate")
+	}
+}
+
+func TestQueryMultipleEventTypes(t *testing.T) {
+	mux := newTestServer()
+
+	postWebhook(t, mux, `{"event":"user.created","data":{"id":"1"},"version":"1"}`)
+	postWebhook(t, mux, `{"event":"order.paid","data":{"id":"2"},"version":"1"}`)
+	postWebhook(t, mux, `{"event":"user.deleted","data":{"id":"1"},"version":"1"}`)
+
+	repeated := queryWebhooks(t, mux, "/query?event_type=user.created&event_type=user.deleted")
+	if len(repeated) != 2 {
+		t.Fatalf("expected 2 results, got %d", len(repeated))
+	}
+	if repeated[0].EventType != "user.deleted" || repeated[1].EventType != "user.created" {
+		t.Errorf("expected merged results newest first, got %s, %s", repeated[0].EventType, repeated[1].EventType)
+	}
+
+	commaList := queryWebhooks(t, mux, "/query?event_type=user.created,order.paid")
+	if len(commaList) != 2 {
+		t.Errorf("expected 2 results, got %d", len(commaList))
+	}
+
+	filtered := queryWebhooks(t, mux, "/query?event_type=user.created,user.deleted,order.paid&id=1")
+	if len(filtered) != 2 {
+		t.Errorf("expected 2 results with id=1, got %d", len(filtered))
+	}
+}
+
+func TestQueryWithoutEventType(t *testing.T) {
+	mux := newTestServer()
+
+	req := httptest.NewRequest(http.MethodGet, "/query", nil)
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400, got %d", rec.Code)
+	}
+}
+
+func TestQueryExistenceFilters(t *testing.T) {
+	mux := newTestServer()
+
+	postWebhook(t, mux, `{"event":"order","data":{"id":"1","coupon_code":"SAVE10","shipping":{"tracking_num":"T1"}}}`)
+	postWebhook(t, mux, `{"event":"order","data":{"id":"2","shipping":{"tracking_num":null}}}`)
+	postWebhook(t, mux, `{"event":"order","data":{"id":"3","shipping":{}}}`)
+
+	missing := queryWebhooks(t, mux, "/query/order?missing=coupon_code")
+	if len(missing) != 2 {
+		t.Errorf("expected 2 orders without coupon, got %d", len(missing))
+	}
+
+	has := queryWebhooks(t, mux, "/query/order?has=shipping.tracking_num")
+	if len(has) != 2 {
+		t.Errorf("expected 2 orders with a tracking_num key, got %d", len(has))
+	}
+
+	null := queryWebhooks(t, mux, "/query/order?null=shipping.tracking_num")
+	if len(null) != 1 || null[0].Payload["id"] != "2" {
+		t.Errorf("expected only order 2 to have a null tracking_num, got %v", null)
+	}
+
+	combined := queryWebhooks(t, mux, "/query/order?has=shipping.tracking_num&missing=coupon_code,gift_card")
+	if len(combined) != 1 || combined[0].Payload["id"] != "2" {
+		t.Errorf("expected only order 2, got %v", combined)
+	}
+}
+
+func TestQueryCaseInsensitiveFilters(t *testing.T) {
+	mux := newTestServer()
+
+	postWebhook(t, mux, `{"event":"payment","data":{"status":"SUCCEEDED","currency":"usd"}}`)
+	postWebhook(t, mux, `{"event":"payment","data":{"status":"succeeded","currency":"EUR"}}`)
+	postWebhook(t, mux, `{"event":"payment","data":{"status":"Failed","currency":"usd"}}`)
+
+	exact := queryWebhooks(t, mux, "/query/payment?status=succeeded")
+	if len(exact) != 1 {
+		t.Errorf("expected 1 exact match, got %d", len(exact))
+	}
+
+	all := queryWebhooks(t, mux, "/query/payment?status=succeeded&ci=true")
+	if len(all) != 2 {
+		t.Errorf("expected 2 case-insensitive matches, got %d", len(all))
+	}
+
+	// Only status folds case; currency stays exact.
+	perField := queryWebhooks(t, mux, "/query/payment?status:ci=SUCCEEDED&currency=usd")
+	if len(perField) != 1 {
+		t.Errorf("expected 1 match with per-field modifier, got %d", len(perField))
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/query/payment?status:regex=x", nil)
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400 for unknown modifier, got %d", rec.Code)
+	}
+}
+
+func TestProvenanceHeaders(t *testing.T) {
+	mux := newTestServer()
+
+	first := postWebhook(t, mux, `{"event":"order","data":{},"id":"forged","sequence":99,"deliveries":7}`)
+	second := postWebhook(t, mux, `{"event":"order","data":{}}`)
+
+	if first.Header().Get("X-Echo-Sequence") != "1" || second.Header().Get("X-Echo-Sequence") != "2" {
+		t.Errorf("expected sequences 1 and 2, got %q and %q",
+			first.Header().Get("X-Echo-Sequence"), second.Header().Get("X-Echo-Sequence"))
+	}
+	if _, err := time.Parse(time.RFC3339Nano, first.Header().Get("X-Echo-Received-At")); err != nil {
+		t.Errorf("expected an RFC 3339 X-Echo-Received-At, got %q", first.Header().Get("X-Echo-Received-At"))
+	}
+
+	id := first.Header().Get("X-Echo-Id")
+	if id == "" || id == "forged" || id == second.Header().Get("X-Echo-Id") {
+		t.Fatalf("expected distinct server-assigned ids, got %q and %q", id, second.Header().Get("X-Echo-Id"))
+	}
+	records := queryWebhooks(t, mux, "/query/order")
+	if records[1].ID != id || records[1].Sequence != 1 || records[1].Deliveries != 1 {
+		t.Errorf("expected the stored record to carry the echoed id, got %+v", records[1])
+	}
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// responseRules holds the malformed response rules when configured.
+var responseRules *ResponseRules
+
+// Malformed responses a response rule can answer with.
+const (
+	responseOversized        = "oversized"          // a valid JSON body of Size bytes
+	responseInvalidJSON      = "invalid-json"       // an acknowledgement that does not parse
+	responseWrongContentType = "wrong-content-type" // the usual body labeled ContentType
+	responseTruncated        = "truncated"          // the usual body cut off halfway
+)
+
+const (
+	defaultOversizedSize   = 10 << 20
+	defaultWrongType       = "text/html; charset=utf-8"
+	oversizedChunk         = 32 << 10
+	oversizedPaddingPrefix = `{"padding":"`
+	oversizedPaddingSuffix = `"}`
+)
+
+// ResponseRule answers matching webhooks with a malformed response, to
+// harden a sender's parsing and logging of responses against a misbehaving
+// consumer. It matches as a drop rule does, and the webhook is recorded as
+// usual.
+type ResponseRule struct {
+	DropRule
+	Response string `json:"response"`
+	// Size is the body size of an oversized response, 10 MiB by default.
+	Size int `json:"size,omitempty"`
+	// ContentType labels a wrong-content-type response, text/html by
+	// default.
+	ContentType string `json:"content_type,omitempty"`
+}
+
+// LoadResponseRules reads a JSON array of response rules from path.
+func LoadResponseRules(path string) ([]ResponseRule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var rules []ResponseRule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return rules, nil
+}
+
+type responseState struct {
+	*dropState
+	response ResponseRule
+	answered int
+}
+
+// ResponseRules decides which webhooks get a malformed response and counts
+// them per rule.
+type ResponseRules struct {
+	mu    sync.Mutex
+	rules []*responseState
+}
+
+func NewResponseRules(rules []ResponseRule) (*ResponseRules, error) {
+	rr := &ResponseRules{}
+	for _, rule := range rules {
+		if rule.Name == "" {
+			return nil, errors.New("response rule without name")
+		}
+		switch rule.Response {
+		case responseOversized, responseInvalidJSON, responseWrongContentType, responseTruncated:
+		default:
+			return nil, fmt.Errorf("response rule %s: unknown response %q, expected %s, %s, %s or %s", rule.Name, rule.Response,
+				responseOversized, responseInvalidJSON, responseWrongContentType, responseTruncated)
+		}
+		if rule.Size < 0 {
+			return nil, fmt.Errorf("response rule %s: size must not be negative", rule.Name)
+		}
+		if rule.Size == 0 {
+			rule.Size = defaultOversizedSize
+		}
+		if rule.ContentType == "" {
+			rule.ContentType = defaultWrongType
+		}
+		state, err := newDropState("response", rule.DropRule)
+		if err != nil {
+			return nil, err
+		}
+		rr.rules = append(rr.rules, &responseState{dropState: state, response: rule})
+	}
+	return rr, nil
+}
+
+// Match returns the first rule matching the request and its parsed webhook,
+// counting it, or nil to answer as usual.
+func (rr *ResponseRules) Match(r *http.Request, item WebhookParams) *ResponseRule {
+	for _, s := range rr.rules {
+		if !s.matches(r, item) {
+			continue
+		}
+		rr.mu.Lock()
+		s.answered++
+		rr.mu.Unlock()
+		return &s.response
+	}
+	return nil
+}
+
+// write answers as rule says. echo writes the usual response, which the
+// invalid-json, wrong-content-type and truncated responses are made from.
+func (rule *ResponseRule) write(w http.ResponseWriter, stored WebhookParams, echo func(http.ResponseWriter)) {
+	w.Header().Set("X-Echo-Response-Rule", rule.Name)
+	switch rule.Response {
+	case responseOversized:
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Length", strconv.Itoa(rule.Size))
+		writeOversized(w, rule.Size)
+		return
+	case responseInvalidJSON:
+		w.Header().Set("Content-Type", "application/json")
+		// A trailing comma, as a hand-rolled encoder might write.
+		fmt.Fprintf(w, `{"received":true,"id":%q,}`, stored.ID)
+		return
+	}
+
+	held := newFaultWriter(w)
+	echo(held)
+	status, body := held.status, held.body.Bytes()
+	if status == 0 || status == http.StatusNoContent {
+		status = http.StatusOK
+	}
+	for name, values := range held.header {
+		w.Header()[name] = values
+	}
+	switch rule.Response {
+	case responseWrongContentType:
+		w.Header().Set("Content-Type", rule.ContentType)
+		w.WriteHeader(status)
+		w.Write(body)
+	case responseTruncated:
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		w.WriteHeader(status)
+		w.Write(body[:len(body)/2])
+		http.NewResponseController(w).Flush()
+		// Aborting closes the connection, or resets the HTTP/2 stream,
+		// without completing the announced length.
+		panic(http.ErrAbortHandler)
+	}
+}
+
+// writeOversized writes a JSON object of exactly size bytes, or padding of
+// size bytes when that is too small for one.
+func writeOversized(w http.ResponseWriter, size int) {
+	frame := len(oversizedPaddingPrefix) + len(oversizedPaddingSuffix)
+	if size < frame {
+		w.Write(bytes.Repeat([]byte(" "), size))
+		return
+	}
+	w.Write([]byte(oversizedPaddingPrefix))
+	chunk := []byte(strings.Repeat("x", oversizedChunk))
+	for left := size - frame; left > 0; left -= len(chunk) {
+		if _, err := w.Write(chunk[:min(left, len(chunk))]); err != nil {
+			return
+		}
+	}
+	w.Write([]byte(oversizedPaddingSuffix))
+}
+
+type ResponseRuleStatus struct {
+	ResponseRule
+	Answered int `json:"answered"`
+}
+
+func (rr *ResponseRules) Report() []ResponseRuleStatus {
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+
+	report := make([]ResponseRuleStatus, 0, len(rr.rules))
+	for _, s := range rr.rules {
+		report = append(report, ResponseRuleStatus{ResponseRule: s.response, Answered: s.answered})
+	}
+	return report
+}
+
+func responseRulesHandler(rr *ResponseRules) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(rr.Report())
+	}
+}
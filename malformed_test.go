@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestResponseRules(t *testing.T) {
+	rules, err := NewResponseRules([]ResponseRule{
+		{DropRule: DropRule{Name: "big", EventType: "big"}, Response: responseOversized, Size: 100},
+		{DropRule: DropRule{Name: "tiny", EventType: "tiny"}, Response: responseOversized, Size: 5},
+		{DropRule: DropRule{Name: "broken", EventType: "broken"}, Response: responseInvalidJSON},
+		{DropRule: DropRule{Name: "html", EventType: "html"}, Response: responseWrongContentType},
+		{DropRule: DropRule{Name: "cut", EventType: "cut"}, Response: responseTruncated},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	responseRules = rules
+	t.Cleanup(func() { responseRules = nil })
+	mux := newTestServer()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	post := func(event string) (*http.Response, []byte, error) {
+		body := `{"event":"` + event + `","data":{"n":1234567890}}`
+		resp, err := http.Post(server.URL+"/webhook", "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		got, err := io.ReadAll(resp.Body)
+		return resp, got, err
+	}
+
+	for _, tt := range []struct {
+		event string
+		size  int
+	}{{"big", 100}, {"tiny", 5}} {
+		resp, got, err := post(tt.event)
+		if err != nil || len(got) != tt.size || resp.ContentLength != int64(tt.size) {
+			t.Errorf("%s: got %d bytes (Content-Length %d), %v", tt.event, len(got), resp.ContentLength, err)
+		}
+		if tt.size == 100 && !json.Valid(got) {
+			t.Errorf("oversized body is not JSON: %q", got)
+		}
+	}
+
+	resp, got, _ := post("broken")
+	if json.Valid(got) || resp.Header.Get("Content-Type") != "application/json" {
+		t.Errorf("expected invalid JSON labeled as JSON, got %q as %s", got, resp.Header.Get("Content-Type"))
+	}
+
+	resp, got, _ = post("html")
+	if resp.Header.Get("Content-Type") != defaultWrongType || !json.Valid(got) {
+		t.Errorf("expected the usual body as %s, got %q as %s", defaultWrongType, got, resp.Header.Get("Content-Type"))
+	}
+
+	resp, got, err = post("cut")
+	if err != io.ErrUnexpectedEOF || int64(len(got)) >= resp.ContentLength {
+		t.Errorf("expected a truncated body, got %d of %d bytes, %v", len(got), resp.ContentLength, err)
+	}
+
+	if items := queryWebhooks(t, mux, "/query?status_code=200"); len(items) != 5 {
+		t.Errorf("expected every webhook recorded, got %d", len(items))
+	}
+	if report := rules.Report(); report[0].Answered != 1 {
+		t.Errorf("unexpected report %+v", report)
+	}
+}
+
+func TestNewResponseRulesRejectsInvalid(t *testing.T) {
+	for _, rule := range []ResponseRule{
+		{Response: responseTruncated},
+		{DropRule: DropRule{Name: "unknown"}, Response: "gibberish"},
+		{DropRule: DropRule{Name: "size"}, Response: responseOversized, Size: -1},
+	} {
+		if _, err := NewResponseRules([]ResponseRule{rule}); err == nil {
+			t.Errorf("rule %+v accepted", rule)
+		}
+	}
+}
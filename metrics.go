@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ingestMetrics records ingest latency and body size histograms, nil unless
+// -metrics is set.
+var ingestMetrics *Metrics
+
+var (
+	durationBuckets = []float64{0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5}
+	sizeBuckets     = []float64{256, 1024, 4096, 16384, 65536, 262144, 1048576, 4194304}
+)
+
+// Exemplar is the observation a histogram bucket last saw, linking the
+// bucket to the record that caused it.
+type Exemplar struct {
+	CaptureID string
+	TraceID   string
+	Value     float64
+	At        time.Time
+}
+
+// Histogram is a cumulative histogram keeping the latest exemplar of each
+// bucket, as Prometheus client libraries do.
+type Histogram struct {
+	Name      string
+	Help      string
+	Bounds    []float64
+	counts    []uint64 // per bucket, the last one being +Inf
+	exemplars []*Exemplar
+	sum       float64
+	count     uint64
+}
+
+func newHistogram(name, help string, bounds []float64) *Histogram {
+	return &Histogram{
+		Name:      name,
+		Help:      help,
+		Bounds:    bounds,
+		counts:    make([]uint64, len(bounds)+1),
+		exemplars: make([]*Exemplar, len(bounds)+1),
+	}
+}
+
+func (h *Histogram) observe(ex Exemplar) {
+	i := 0
+	for i < len(h.Bounds) && ex.Value > h.Bounds[i] {
+		i++
+	}
+	h.counts[i]++
+	h.exemplars[i] = &ex
+	h.sum += ex.Value
+	h.count++
+}
+
+// Metrics holds the ingest histograms served on /metrics.
+type Metrics struct {
+	mu       sync.Mutex
+	duration *Histogram
+	size     *Histogram
+}
+
+func NewMetrics() *Metrics {
+	return &Metrics{
+		duration: newHistogram("webhook_echo_ingest_duration_seconds", "Time taken to read, parse and record a webhook.", durationBuckets),
+		size:     newHistogram("webhook_echo_body_size_bytes", "Size of recorded webhook bodies as sent.", sizeBuckets),
+	}
+}
+
+// Observe records a newly stored webhook that took elapsed to ingest.
+func (m *Metrics) Observe(item WebhookParams, elapsed time.Duration) {
+	ex := Exemplar{CaptureID: item.ID, At: item.ReceivedAt}
+	if item.Trace != nil {
+		ex.TraceID = item.Trace.TraceID
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ex.Value = elapsed.Seconds()
+	m.duration.observe(ex)
+	ex.Value = float64(len(item.Raw))
+	m.size.observe(ex)
+}
+
+// write writes the metrics in the Prometheus text format, or in
+// OpenMetrics, the only one of the two that carries exemplars.
+func (m *Metrics) write(w io.Writer, openMetrics bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, h := range []*Histogram{m.duration, m.size} {
+		h.write(w, openMetrics)
+	}
+	if openMetrics {
+		fmt.Fprintln(w, "# EOF")
+	}
+}
+
+func (h *Histogram) write(w io.Writer, openMetrics bool) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", h.Name, h.Help, h.Name)
+	var cumulative uint64
+	for i, n := range h.counts {
+		cumulative += n
+		le := "+Inf"
+		if i < len(h.Bounds) {
+			le = formatFloat(h.Bounds[i])
+		}
+		fmt.Fprintf(w, "%s_bucket{le=%q} %d", h.Name, le, cumulative)
+		if ex := h.exemplars[i]; openMetrics && ex != nil {
+			fmt.Fprintf(w, " # {%s} %s %s", ex.labels(), formatFloat(ex.Value), formatFloat(float64(ex.At.UnixMilli())/1000))
+		}
+		fmt.Fprintln(w)
+	}
+	fmt.Fprintf(w, "%s_sum %s\n%s_count %d\n", h.Name, formatFloat(h.sum), h.Name, h.count)
+}
+
+func (ex *Exemplar) labels() string {
+	labels := fmt.Sprintf("capture_id=%q", ex.CaptureID)
+	if ex.TraceID != "" {
+		labels += fmt.Sprintf(",trace_id=%q", ex.TraceID)
+	}
+	return labels
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// metricsHandler serves /metrics, in OpenMetrics with exemplars when the
+// scraper asks for it and in the plain Prometheus text format otherwise.
+func metricsHandler(m *Metrics) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		openMetrics := strings.Contains(r.Header.Get("Accept"), "application/openmetrics-text")
+		if openMetrics {
+			w.Header().Set("Content-Type", "application/openmetrics-text; version=1.0.0; charset=utf-8")
+		} else {
+			w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		}
+		m.write(w, openMetrics)
+	}
+}
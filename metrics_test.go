@@ -0,0 +1,53 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMetricsExemplars(t *testing.T) {
+	ingestMetrics = NewMetrics()
+	t.Cleanup(func() { ingestMetrics = nil })
+
+	mux := newTestServer()
+	mux.HandleFunc("GET /metrics", metricsHandler(ingestMetrics))
+	small := postWebhook(t, mux, `{"event":"small","data":{}}`).Header().Get("X-Echo-Id")
+	big := postWebhook(t, mux, `{"event":"big","data":{"pad":"`+strings.Repeat("x", 5000)+`"}}`).Header().Get("X-Echo-Id")
+
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	req.Header.Set("Accept", "application/openmetrics-text; version=1.0.0")
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	body := rec.Body.String()
+	if !strings.HasPrefix(rec.Header().Get("Content-Type"), "application/openmetrics-text") || !strings.HasSuffix(body, "# EOF\n") {
+		t.Fatalf("expected an OpenMetrics exposition, got %s", body)
+	}
+	for _, want := range []string{
+		`webhook_echo_body_size_bytes_bucket{le="256"} 1 # {capture_id="` + small + `"} 27 `,
+		`webhook_echo_body_size_bytes_bucket{le="16384"} 2 # {capture_id="` + big + `"}`,
+		`webhook_echo_body_size_bytes_bucket{le="+Inf"} 2` + "\n",
+		"webhook_echo_ingest_duration_seconds_count 2\n",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected %q in\n%s", want, body)
+		}
+	}
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if strings.Contains(rec.Body.String(), "capture_id") || strings.Contains(rec.Body.String(), "# EOF") {
+		t.Errorf("expected no exemplars in the Prometheus text format, got %s", rec.Body)
+	}
+}
+
+func TestMetricsTraceExemplar(t *testing.T) {
+	m := NewMetrics()
+	m.Observe(WebhookParams{ID: "abc", Raw: []byte("{}"), Trace: &TraceContext{TraceID: "4bf92f3577b34da6a3ce929d0e0e4736"}}, 0)
+	var b strings.Builder
+	m.write(&b, true)
+	if !strings.Contains(b.String(), `# {capture_id="abc",trace_id="4bf92f3577b34da6a3ce929d0e0e4736"} 2 `) {
+		t.Errorf("expected the trace id in the exemplar, got\n%s", b.String())
+	}
+}
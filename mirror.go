@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// mirrorBatch is the number of records requested per /consume call.
+const mirrorBatch = 500
+
+// Mirror copies records from another webhook-echo instance by polling its
+// /consume API, so a local instance can follow just the slice of a shared
+// instance's traffic that matches a filter. Mirrored records keep their
+// event, payload, idempotency key and instance; Source links back to the
+// original.
+type Mirror struct {
+	base     string
+	params   url.Values
+	interval time.Duration
+	client   *http.Client
+	recorder *Recorder
+	cursor   string
+}
+
+// NewMirror mirrors from the instance at base. match filters the records in
+// /query parameter syntax, all records if empty.
+func NewMirror(base, match string, interval time.Duration, client *http.Client, recorder *Recorder) (*Mirror, error) {
+	params, err := url.ParseQuery(match)
+	if err != nil {
+		return nil, err
+	}
+	if len(params) > 0 {
+		if _, err := parseQueryFilter(params, ""); err != nil {
+			return nil, err
+		}
+	}
+	for _, reserved := range []string{"cursor", "max", "consumer"} {
+		if params.Has(reserved) {
+			return nil, fmt.Errorf("%s is set by the mirror and cannot be matched on", reserved)
+		}
+	}
+	return &Mirror{
+		base:     strings.TrimSuffix(base, "/"),
+		params:   params,
+		interval: interval,
+		client:   client,
+		recorder: recorder,
+	}, nil
+}
+
+// Run polls until ctx is cancelled. Errors are logged and retried on the
+// next poll; a full batch is followed up immediately.
+func (m *Mirror) Run(ctx context.Context) {
+	log.Printf("Mirroring %s", m.base)
+	for ctx.Err() == nil {
+		n, err := m.poll(ctx)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("Mirror: %v", err)
+		}
+		if n == mirrorBatch {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+		case <-time.After(m.interval):
+		}
+	}
+}
+
+// poll fetches and records one batch, returning its size.
+func (m *Mirror) poll(ctx context.Context) (int, error) {
+	params := url.Values{}
+	for key, values := range m.params {
+		params[key] = values
+	}
+	params.Set("max", fmt.Sprint(mirrorBatch))
+	if m.cursor != "" {
+		params.Set("cursor", m.cursor)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, m.base+"/v"+apiVersion+"/consume?"+params.Encode(), nil)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("GET %s: %s", req.URL.Redacted(), resp.Status)
+	}
+	var batch consumeBatch
+	if err := json.NewDecoder(resp.Body).Decode(&batch); err != nil {
+		return 0, fmt.Errorf("decode batch: %w", err)
+	}
+	if batch.Evicted > 0 && m.cursor != "" {
+		log.Printf("Mirror: %d records were evicted on %s before they could be copied", batch.Evicted, m.base)
+	}
+
+	for _, item := range batch.Records {
+		body, _, err := webhookBody(item)
+		if err != nil {
+			return 0, err
+		}
+		// The original body is not exposed by /consume, so the raw view of
+		// a mirrored record is its JSON rendering.
+		item.ContentType, item.Encoding, item.SniffedType = "application/json", "", ""
+		item.Attachments = nil
+		item.Source = m.base + "/v" + apiVersion + "/webhooks/" + item.ID
+		m.recorder.Record(item, body)
+	}
+	m.cursor = batch.NextCursor
+	return len(batch.Records), nil
+}
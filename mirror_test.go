@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMirrorCopiesMatchingRecords(t *testing.T) {
+	remote := newTestServer()
+	srv := httptest.NewServer(remote)
+	defer srv.Close()
+	postWebhook(t, remote, `{"event":"order","data":{"team":"payments"}}`)
+	postWebhook(t, remote, `{"event":"order","data":{"team":"search"}}`)
+
+	local := NewRingBuffer(10)
+	mirror, err := NewMirror(srv.URL, "event_type=order&team=payments", 0, http.DefaultClient, NewRecorder(local))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, err := mirror.poll(context.Background()); err != nil || n != 1 {
+		t.Fatalf("expected 1 mirrored record, got %d: %v", n, err)
+	}
+	got, _ := local.Query(context.Background(), QueryFilter{EventTypes: []string{"order"}})
+	if len(got) != 1 || got[0].Payload["team"] != "payments" || !strings.HasPrefix(got[0].Source, srv.URL+"/v1/webhooks/") {
+		t.Fatalf("expected the payments order with a link back, got %+v", got)
+	}
+
+	// Later polls pick up where the last one stopped.
+	postWebhook(t, remote, `{"event":"order","data":{"team":"payments"}}`)
+	if n, _ := mirror.poll(context.Background()); n != 1 {
+		t.Errorf("expected only the new record, got %d", n)
+	}
+	if n, _ := mirror.poll(context.Background()); n != 0 {
+		t.Errorf("expected nothing new, got %d", n)
+	}
+}
+
+func TestMirrorRejectsReservedParameters(t *testing.T) {
+	if _, err := NewMirror("http://example.com", "event_type=a&cursor=5", 0, http.DefaultClient, nil); err == nil {
+		t.Error("expected cursor to be rejected")
+	}
+	if _, err := NewMirror("http://example.com", "team=a", 0, http.DefaultClient, nil); err == nil {
+		t.Error("expected a filter without event_type to be rejected")
+	}
+}
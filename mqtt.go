@@ -0,0 +1,237 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+// This file implements the small subset of MQTT 3.1.1 the bridges need:
+// connecting, QoS 0 publish, subscribing and keepalive pings.
+
+const (
+	mqttConnect    = 1
+	mqttConnack    = 2
+	mqttPublish    = 3
+	mqttSubscribe  = 8
+	mqttSuback     = 9
+	mqttPingreq    = 12
+	mqttPingresp   = 13
+	mqttDisconnect = 14
+
+	mqttMaxRemaining = 268435455
+)
+
+type mqttPacket struct {
+	kind  byte
+	flags byte
+	body  []byte
+}
+
+type mqttOptions struct {
+	ClientID  string
+	Username  string
+	Password  string
+	KeepAlive time.Duration
+}
+
+// mqttConn is a connected MQTT session. Packets are written by one goroutine
+// and read by another; it does no locking of its own.
+type mqttConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// mqttDial connects to broker ("host:port", optionally prefixed with
+// "tcp://" or "mqtt://") and performs the CONNECT handshake.
+func mqttDial(broker string, opts mqttOptions) (*mqttConn, error) {
+	addr := broker
+	if _, rest, ok := strings.Cut(broker, "://"); ok {
+		addr = rest
+	}
+	conn, err := net.DialTimeout("tcp", addr, 10*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	c := &mqttConn{conn: conn, r: bufio.NewReader(conn)}
+	if err := c.handshake(opts); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *mqttConn) handshake(opts mqttOptions) error {
+	var body []byte
+	body = appendMQTTString(body, "MQTT")
+	body = append(body, 4) // protocol level 3.1.1
+
+	flags := byte(0x02) // clean session
+	if opts.Username != "" {
+		flags |= 0x80
+	}
+	if opts.Password != "" {
+		flags |= 0x40
+	}
+	body = append(body, flags)
+	body = binary.BigEndian.AppendUint16(body, uint16(opts.KeepAlive/time.Second))
+	body = appendMQTTString(body, opts.ClientID)
+	if opts.Username != "" {
+		body = appendMQTTString(body, opts.Username)
+	}
+	if opts.Password != "" {
+		body = appendMQTTString(body, opts.Password)
+	}
+
+	c.conn.SetDeadline(time.Now().Add(10 * time.Second))
+	defer c.conn.SetDeadline(time.Time{})
+
+	if err := c.write(mqttPacket{kind: mqttConnect, body: body}); err != nil {
+		return err
+	}
+	p, err := c.read()
+	if err != nil {
+		return err
+	}
+	if p.kind != mqttConnack || len(p.body) != 2 {
+		return fmt.Errorf("mqtt: expected CONNACK, got packet type %d", p.kind)
+	}
+	if p.body[1] != 0 {
+		return fmt.Errorf("mqtt: connection refused, return code %d", p.body[1])
+	}
+	return nil
+}
+
+// publish sends a QoS 0 message.
+func (c *mqttConn) publish(topic string, payload []byte) error {
+	body := appendMQTTString(nil, topic)
+	body = append(body, payload...)
+	return c.write(mqttPacket{kind: mqttPublish, body: body})
+}
+
+// subscribe requests a subscription at QoS 0 and waits for the SUBACK.
+// It must be called before any other goroutine starts reading.
+func (c *mqttConn) subscribe(filter string) error {
+	body := binary.BigEndian.AppendUint16(nil, 1)
+	body = appendMQTTString(body, filter)
+	body = append(body, 0)
+	if err := c.write(mqttPacket{kind: mqttSubscribe, flags: 0x02, body: body}); err != nil {
+		return err
+	}
+	for {
+		p, err := c.read()
+		if err != nil {
+			return err
+		}
+		if p.kind != mqttSuback {
+			continue
+		}
+		if len(p.body) < 3 || p.body[2] == 0x80 {
+			return fmt.Errorf("mqtt: subscription to %q refused", filter)
+		}
+		return nil
+	}
+}
+
+func (c *mqttConn) ping() error {
+	return c.write(mqttPacket{kind: mqttPingreq})
+}
+
+func (c *mqttConn) close() error {
+	c.write(mqttPacket{kind: mqttDisconnect})
+	return c.conn.Close()
+}
+
+func (c *mqttConn) write(p mqttPacket) error {
+	if len(p.body) > mqttMaxRemaining {
+		return errors.New("mqtt: packet too large")
+	}
+	buf := []byte{p.kind<<4 | p.flags}
+	buf = appendMQTTLength(buf, len(p.body))
+	buf = append(buf, p.body...)
+	_, err := c.conn.Write(buf)
+	return err
+}
+
+func (c *mqttConn) read() (mqttPacket, error) {
+	return readMQTTPacket(c.r)
+}
+
+func readMQTTPacket(r *bufio.Reader) (mqttPacket, error) {
+	header, err := r.ReadByte()
+	if err != nil {
+		return mqttPacket{}, err
+	}
+
+	length, multiplier := 0, 1
+	for i := 0; ; i++ {
+		if i == 4 {
+			return mqttPacket{}, errors.New("mqtt: malformed remaining length")
+		}
+		b, err := r.ReadByte()
+		if err != nil {
+			return mqttPacket{}, err
+		}
+		length += int(b&0x7f) * multiplier
+		if b&0x80 == 0 {
+			break
+		}
+		multiplier *= 128
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return mqttPacket{}, err
+	}
+	return mqttPacket{kind: header >> 4, flags: header & 0x0f, body: body}, nil
+}
+
+// parseMQTTPublish extracts the topic and payload of a PUBLISH packet.
+func parseMQTTPublish(p mqttPacket) (topic string, payload []byte, err error) {
+	topic, rest, err := readMQTTString(p.body)
+	if err != nil {
+		return "", nil, err
+	}
+	if qos := (p.flags >> 1) & 0x03; qos > 0 {
+		if len(rest) < 2 {
+			return "", nil, errors.New("mqtt: publish without packet identifier")
+		}
+		rest = rest[2:]
+	}
+	return topic, rest, nil
+}
+
+func appendMQTTString(b []byte, s string) []byte {
+	b = binary.BigEndian.AppendUint16(b, uint16(len(s)))
+	return append(b, s...)
+}
+
+func readMQTTString(b []byte) (string, []byte, error) {
+	if len(b) < 2 {
+		return "", nil, errors.New("mqtt: truncated string")
+	}
+	n := int(binary.BigEndian.Uint16(b))
+	if len(b) < 2+n {
+		return "", nil, errors.New("mqtt: truncated string")
+	}
+	return string(b[2 : 2+n]), b[2+n:], nil
+}
+
+func appendMQTTLength(b []byte, n int) []byte {
+	for {
+		digit := byte(n % 128)
+		n /= 128
+		if n > 0 {
+			digit |= 0x80
+		}
+		b = append(b, digit)
+		if n == 0 {
+			return b
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+// fakeBroker accepts a single MQTT client, acknowledges its CONNECT and
+// SUBSCRIBE, and forwards every other packet it receives to packets. Once a
+// subscription is acknowledged the connection is handed to conns so tests
+// can publish to the client.
+type fakeBroker struct {
+	ln      net.Listener
+	packets chan mqttPacket
+	conns   chan *mqttConn
+}
+
+func newFakeBroker(t *testing.T) *fakeBroker {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := &fakeBroker{ln: ln, packets: make(chan mqttPacket, 100), conns: make(chan *mqttConn, 1)}
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		c := &mqttConn{conn: conn, r: bufio.NewReader(conn)}
+		for {
+			p, err := c.read()
+			if err != nil {
+				return
+			}
+			switch p.kind {
+			case mqttConnect:
+				c.write(mqttPacket{kind: mqttConnack, body: []byte{0, 0}})
+			case mqttSubscribe:
+				c.write(mqttPacket{kind: mqttSuback, body: append(p.body[:2:2], 0)})
+				b.conns <- c
+			default:
+				b.packets <- p
+			}
+		}
+	}()
+	t.Cleanup(func() { ln.Close() })
+	return b
+}
+
+func (b *fakeBroker) addr() string { return b.ln.Addr().String() }
+
+func (b *fakeBroker) next(t *testing.T) mqttPacket {
+	t.Helper()
+	select {
+	case p := <-b.packets:
+		return p
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for MQTT packet")
+		return mqttPacket{}
+	}
+}
+
+func TestMQTTLengthEncoding(t *testing.T) {
+	for _, n := range []int{0, 127, 128, 16383, 16384, 2097151, 2097152} {
+		enc := appendMQTTLength(nil, n)
+		p, err := readMQTTPacket(bufio.NewReader(bytes.NewReader(append(append([]byte{0x30}, enc...), make([]byte, n)...))))
+		if err != nil {
+			t.Fatalf("length %d: %v", n, err)
+		}
+		if len(p.body) != n {
+			t.Errorf("length %d decoded as %d", n, len(p.body))
+		}
+	}
+}
+
+func TestMQTTSinkPublishes(t *testing.T) {
+	broker := newFakeBroker(t)
+
+	sink := NewMQTTSink("tcp://"+broker.addr(), "webhooks/{event_type}", mqttOptions{ClientID: "test"})
+	sink.OnIngest(WebhookParams{EventType: "order+paid", Payload: map[string]any{"id": "o1"}}, nil)
+
+	p := broker.next(t)
+	if p.kind != mqttPublish {
+		t.Fatalf("expected PUBLISH, got %d", p.kind)
+	}
+	topic, payload, err := parseMQTTPublish(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if topic != "webhooks/order_paid" {
+		t.Errorf("unexpected topic %q", topic)
+	}
+	if string(payload) == "" || payload[0] != '{' {
+		t.Errorf("expected JSON payload, got %q", payload)
+	}
+
+	sink.Close()
+	if p := broker.next(t); p.kind != mqttDisconnect {
+		t.Errorf("expected DISCONNECT on close, got %d", p.kind)
+	}
+}
+
+func TestMQTTBridgeRecordsMessages(t *testing.T) {
+	broker := newFakeBroker(t)
+	buffer := NewRingBuffer(10)
+	recorder := NewRecorder(buffer)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go NewMQTTBridge(broker.addr(), "sensors/#", mqttOptions{ClientID: "test"}, recorder).Run(ctx)
+
+	var conn *mqttConn
+	select {
+	case conn = <-broker.conns:
+	case <-time.After(2 * time.Second):
+		t.Fatal("bridge did not connect")
+	}
+
+	publish := func(topic, payload string) {
+		body := appendMQTTString(nil, topic)
+		conn.write(mqttPacket{kind: mqttPublish, body: append(body, payload...)})
+	}
+	publish("sensors/temp", `{"celsius":21.5}`)
+	publish("sensors/door", `{"event":"door.opened","data":{"id":"front"},"version":"2"}`)
+	publish("sensors/garbage", `not json`)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for buffer.Len() < 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	temps, _ := buffer.Query(context.Background(), QueryFilter{EventTypes: []string{"sensors/temp"}})
+	if len(temps) != 1 || temps[0].Payload["celsius"] != 21.5 {
+		t.Fatalf("expected raw message recorded under its topic, got %v", temps)
+	}
+	if temps[0].Source != "mqtt://"+broker.addr()+"/sensors/temp" {
+		t.Errorf("unexpected source %q", temps[0].Source)
+	}
+
+	doors, _ := buffer.Query(context.Background(), QueryFilter{EventTypes: []string{"door.opened"}})
+	if len(doors) != 1 || doors[0].Version != "2" || doors[0].Payload["id"] != "front" {
+		t.Errorf("expected webhook-shaped message recorded as-is, got %v", doors)
+	}
+}
+
+func TestDecodeBrokerMessageDropsServerFields(t *testing.T) {
+	item, err := decodeBrokerMessage("sensors/door", []byte(`{"event":"door.opened","data":{"id":"front"},`+
+		`"verification":{"scheme":"hmac","verified":true},"tags":["trusted"],"idempotency_key":"k","hash":"forged"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if item.Verification != nil || item.Tags != nil || item.IdempotencyKey != "" || item.Hash != "" {
+		t.Errorf("expected server-owned fields dropped, got %+v", item)
+	}
+	if item.EventType != "door.opened" || item.Payload["id"] != "front" {
+		t.Errorf("expected the event and payload kept, got %+v", item)
+	}
+}
+
+func TestMQTTSinkSkipsBridgedMessages(t *testing.T) {
+	sink := &MQTTSink{template: "webhooks/{event_type}", messages: make(chan mqttMessage, 1)}
+	sink.OnIngest(WebhookParams{EventType: "x", Source: "mqtt://broker/x"}, nil)
+	if len(sink.messages) != 0 {
+		t.Error("bridged messages must not be published back")
+	}
+}
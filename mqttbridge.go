@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"log"
+	"strings"
+	"time"
+)
+
+// MQTTBridge subscribes to an MQTT topic filter and records every message as
+// a webhook. Messages shaped like webhooks ({"event", "data", "version"})
+// are stored as-is; any other JSON object becomes the payload of a webhook
+// whose event type is the topic.
+type MQTTBridge struct {
+	broker   string
+	filter   string
+	opts     mqttOptions
+	recorder *Recorder
+}
+
+func NewMQTTBridge(broker, filter string, opts mqttOptions, recorder *Recorder) *MQTTBridge {
+	if opts.KeepAlive == 0 {
+		opts.KeepAlive = mqttKeepAlive
+	}
+	return &MQTTBridge{broker: broker, filter: filter, opts: opts, recorder: recorder}
+}
+
+// Run consumes messages until ctx is cancelled, reconnecting as needed.
+func (b *MQTTBridge) Run(ctx context.Context) {
+	for ctx.Err() == nil {
+		if err := b.session(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("MQTT bridge: %v, reconnecting in %s", err, mqttReconnectDelay)
+		}
+		select {
+		case <-ctx.Done():
+		case <-time.After(mqttReconnectDelay):
+		}
+	}
+}
+
+func (b *MQTTBridge) session(ctx context.Context) error {
+	conn, err := mqttDial(b.broker, b.opts)
+	if err != nil {
+		return err
+	}
+	defer conn.close()
+	if err := conn.subscribe(b.filter); err != nil {
+		return err
+	}
+	log.Printf("MQTT bridge subscribed to %s on %s", b.filter, b.broker)
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		ticker := time.NewTicker(b.opts.KeepAlive / 2)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				conn.conn.Close()
+				return
+			case <-stop:
+				return
+			case <-ticker.C:
+				if conn.ping() != nil {
+					return
+				}
+			}
+		}
+	}()
+
+	for {
+		p, err := conn.read()
+		if err != nil {
+			return err
+		}
+		if p.kind != mqttPublish {
+			continue
+		}
+		topic, payload, err := parseMQTTPublish(p)
+		if err != nil {
+			log.Printf("MQTT bridge: %v", err)
+			continue
+		}
+		b.handle(topic, payload)
+	}
+}
+
+func (b *MQTTBridge) handle(topic string, payload []byte) {
+	item, err := decodeBrokerMessage(topic, payload)
+	if err != nil {
+		log.Printf("MQTT bridge: dropping message on %s: %v", topic, err)
+		return
+	}
+	item.Source = "mqtt://" + strings.TrimPrefix(strings.TrimPrefix(b.broker, "tcp://"), "mqtt://") + "/" + topic
+	b.recorder.Record(item, payload)
+}
+
+// decodeBrokerMessage turns a broker message into a webhook. Like HTTP
+// ingest, only the event type, payload and version come from the message.
+func decodeBrokerMessage(topic string, payload []byte) (WebhookParams, error) {
+	var item WebhookParams
+	if err := decodeJSON(payload, &item); err != nil {
+		return item, err
+	}
+	clearServerFields(&item)
+	if item.EventType == "" {
+		item.EventType = topic
+	}
+	if item.Payload == nil {
+		if err := decodeJSON(payload, &item.Payload); err != nil {
+			return item, err
+		}
+	}
+	return item, nil
+}
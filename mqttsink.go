@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"strings"
+	"time"
+)
+
+const (
+	mqttQueueSize      = 1000
+	mqttKeepAlive      = 60 * time.Second
+	mqttReconnectDelay = 5 * time.Second
+)
+
+// MQTTSink publishes captured webhooks to an MQTT broker at QoS 0. Topics are
+// built from a template where {event_type} and {version} are replaced.
+type MQTTSink struct {
+	broker   string
+	opts     mqttOptions
+	template string
+	messages chan mqttMessage
+	done     chan struct{}
+}
+
+type mqttMessage struct {
+	topic   string
+	payload []byte
+}
+
+func NewMQTTSink(broker, topicTemplate string, opts mqttOptions) *MQTTSink {
+	if opts.KeepAlive == 0 {
+		opts.KeepAlive = mqttKeepAlive
+	}
+	s := &MQTTSink{
+		broker:   broker,
+		opts:     opts,
+		template: topicTemplate,
+		messages: make(chan mqttMessage, mqttQueueSize),
+		done:     make(chan struct{}),
+	}
+	go s.run()
+	return s
+}
+
+func (s *MQTTSink) OnIngest(item WebhookParams, body []byte) {
+	// Messages the bridge consumed from MQTT are not published back, which
+	// would loop whenever the subscription covers the sink's topics.
+	if strings.HasPrefix(item.Source, "mqtt://") {
+		return
+	}
+	payload, err := json.Marshal(item)
+	if err != nil {
+		log.Printf("MQTT sink: %v", err)
+		return
+	}
+	select {
+	case s.messages <- mqttMessage{topic: s.topic(item), payload: payload}:
+	default:
+		log.Printf("MQTT sink queue full, dropping %s webhook", item.EventType)
+	}
+}
+
+func (s *MQTTSink) QueueName() string { return "mqtt" }
+
+// QueueDepth is how many messages wait to be published.
+func (s *MQTTSink) QueueDepth() int { return len(s.messages) }
+
+// topic expands the template for item. Wildcard characters are not allowed
+// in published topics, so they are replaced.
+func (s *MQTTSink) topic(item WebhookParams) string {
+	clean := strings.NewReplacer("+", "_", "#", "_").Replace
+	eventType := item.EventType
+	if eventType == "" {
+		eventType = "unknown"
+	}
+	return strings.NewReplacer(
+		"{event_type}", clean(eventType),
+		"{version}", clean(item.Version),
+	).Replace(s.template)
+}
+
+// Close publishes queued messages and disconnects.
+func (s *MQTTSink) Close() {
+	close(s.messages)
+	<-s.done
+}
+
+func (s *MQTTSink) run() {
+	defer close(s.done)
+
+	var conn *mqttConn
+	var lost chan struct{}
+	defer func() {
+		if conn != nil {
+			conn.close()
+		}
+	}()
+
+	ping := time.NewTicker(s.opts.KeepAlive / 2)
+	defer ping.Stop()
+
+	connect := func() bool {
+		c, err := mqttDial(s.broker, s.opts)
+		if err != nil {
+			log.Printf("MQTT sink: connect to %s: %v", s.broker, err)
+			return false
+		}
+		conn, lost = c, make(chan struct{})
+		// Drain PINGRESPs and notice when the broker goes away.
+		go func(c *mqttConn, lost chan struct{}) {
+			defer close(lost)
+			for {
+				if _, err := c.read(); err != nil {
+					return
+				}
+			}
+		}(c, lost)
+		return true
+	}
+	disconnect := func() {
+		conn.conn.Close()
+		conn, lost = nil, nil
+	}
+
+	for {
+		select {
+		case msg, ok := <-s.messages:
+			if !ok {
+				return
+			}
+			for attempt := 0; attempt < 2; attempt++ {
+				if conn == nil && !connect() {
+					break
+				}
+				err := conn.publish(msg.topic, msg.payload)
+				if err == nil {
+					break
+				}
+				log.Printf("MQTT sink: publish to %s: %v", msg.topic, err)
+				disconnect()
+			}
+			if conn == nil {
+				// Broker unavailable; back off before trying the next message.
+				time.Sleep(mqttReconnectDelay)
+			}
+		case <-lost:
+			disconnect()
+		case <-ping.C:
+			if conn != nil {
+				if err := conn.ping(); err != nil {
+					disconnect()
+				}
+			}
+		}
+	}
+}
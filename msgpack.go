@@ -0,0 +1,252 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+var errTruncated = errors.New("unexpected end of data")
+
+// binaryReader reads the big-endian fields MessagePack and CBOR are made of.
+type binaryReader struct {
+	b   []byte
+	pos int
+}
+
+func (r *binaryReader) remaining() int { return len(r.b) - r.pos }
+
+func (r *binaryReader) next(n int) ([]byte, error) {
+	if n < 0 || n > r.remaining() {
+		return nil, errTruncated
+	}
+	b := r.b[r.pos : r.pos+n]
+	r.pos += n
+	return b, nil
+}
+
+func (r *binaryReader) byte() (byte, error) {
+	b, err := r.next(1)
+	if err != nil {
+		return 0, err
+	}
+	return b[0], nil
+}
+
+// uint reads an n-byte unsigned integer, n being 1, 2, 4 or 8.
+func (r *binaryReader) uint(n int) (uint64, error) {
+	b, err := r.next(n)
+	if err != nil {
+		return 0, err
+	}
+	switch n {
+	case 1:
+		return uint64(b[0]), nil
+	case 2:
+		return uint64(binary.BigEndian.Uint16(b)), nil
+	case 4:
+		return uint64(binary.BigEndian.Uint32(b)), nil
+	}
+	return binary.BigEndian.Uint64(b), nil
+}
+
+// length checks a declared element count against the data left, each
+// element taking at least a byte, so a forged length cannot make us
+// allocate more than the body's size.
+func (r *binaryReader) length(n uint64) (int, error) {
+	if n > uint64(r.remaining()) {
+		return 0, errTruncated
+	}
+	return int(n), nil
+}
+
+// decodeMsgPack decodes a MessagePack document into the values
+// encoding/json produces. Binary data stays []byte, written as base64;
+// timestamps become RFC 3339 strings and other extensions
+// {"ext_type": n, "data": base64}.
+func decodeMsgPack(body []byte) (any, error) {
+	r := &binaryReader{b: body}
+	v, err := r.msgpackValue(0)
+	if err != nil {
+		return nil, err
+	}
+	if r.remaining() > 0 {
+		return nil, fmt.Errorf("%d bytes after the top-level value", r.remaining())
+	}
+	return v, nil
+}
+
+func (r *binaryReader) msgpackValue(depth int) (any, error) {
+	if maxJSONDepth > 0 && depth > maxJSONDepth {
+		return nil, fmt.Errorf("nesting exceeds %d levels", maxJSONDepth)
+	}
+	c, err := r.byte()
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case c <= 0x7f:
+		return float64(c), nil
+	case c >= 0xe0:
+		return float64(int8(c)), nil
+	case c <= 0x8f:
+		return r.msgpackMap(uint64(c&0x0f), depth)
+	case c <= 0x9f:
+		return r.msgpackArray(uint64(c&0x0f), depth)
+	case c <= 0xbf:
+		return r.msgpackString(uint64(c & 0x1f))
+	}
+
+	switch c {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xc4, 0xc5, 0xc6:
+		n, err := r.uint(1 << (c - 0xc4))
+		if err != nil {
+			return nil, err
+		}
+		b, err := r.next(int(min(n, math.MaxInt32)))
+		return append([]byte(nil), b...), err
+	case 0xc7, 0xc8, 0xc9:
+		n, err := r.uint(1 << (c - 0xc7))
+		if err != nil {
+			return nil, err
+		}
+		return r.msgpackExt(n)
+	case 0xca:
+		n, err := r.uint(4)
+		return float64(math.Float32frombits(uint32(n))), err
+	case 0xcb:
+		n, err := r.uint(8)
+		return math.Float64frombits(n), err
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		n, err := r.uint(1 << (c - 0xcc))
+		return integer(n, false), err
+	case 0xd0, 0xd1, 0xd2, 0xd3:
+		size := 1 << (c - 0xd0)
+		n, err := r.uint(size)
+		if err != nil {
+			return nil, err
+		}
+		// Sign-extend from the field's width.
+		shift := 64 - 8*size
+		v := int64(n<<shift) >> shift
+		if v < 0 {
+			return integer(uint64(-v), true), nil
+		}
+		return integer(uint64(v), false), nil
+	case 0xd4, 0xd5, 0xd6, 0xd7, 0xd8:
+		return r.msgpackExt(1 << (c - 0xd4))
+	case 0xd9, 0xda, 0xdb:
+		n, err := r.uint(1 << (c - 0xd9))
+		if err != nil {
+			return nil, err
+		}
+		return r.msgpackString(n)
+	case 0xdc, 0xdd:
+		n, err := r.uint(2 << (c - 0xdc))
+		if err != nil {
+			return nil, err
+		}
+		return r.msgpackArray(n, depth)
+	case 0xde, 0xdf:
+		n, err := r.uint(2 << (c - 0xde))
+		if err != nil {
+			return nil, err
+		}
+		return r.msgpackMap(n, depth)
+	}
+	return nil, fmt.Errorf("invalid type byte 0x%02x", c)
+}
+
+func (r *binaryReader) msgpackString(n uint64) (any, error) {
+	b, err := r.next(int(min(n, math.MaxInt32)))
+	return string(b), err
+}
+
+func (r *binaryReader) msgpackArray(n uint64, depth int) (any, error) {
+	count, err := r.length(n)
+	if err != nil {
+		return nil, err
+	}
+	items := make([]any, 0, count)
+	for range count {
+		v, err := r.msgpackValue(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, v)
+	}
+	return items, nil
+}
+
+func (r *binaryReader) msgpackMap(n uint64, depth int) (any, error) {
+	count, err := r.length(n)
+	if err != nil {
+		return nil, err
+	}
+	m := make(map[string]any, count)
+	for range count {
+		k, err := r.msgpackValue(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		v, err := r.msgpackValue(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		m[documentKey(k)] = v
+	}
+	return m, nil
+}
+
+// msgpackExt reads an extension's type and n bytes of data.
+func (r *binaryReader) msgpackExt(n uint64) (any, error) {
+	t, err := r.byte()
+	if err != nil {
+		return nil, err
+	}
+	data, err := r.next(int(min(n, math.MaxInt32)))
+	if err != nil {
+		return nil, err
+	}
+	if int8(t) == -1 {
+		var ts time.Time
+		switch len(data) {
+		case 4:
+			ts = time.Unix(int64(binary.BigEndian.Uint32(data)), 0)
+		case 8:
+			v := binary.BigEndian.Uint64(data)
+			ts = time.Unix(int64(v&(1<<34-1)), int64(v>>34))
+		case 12:
+			ts = time.Unix(int64(binary.BigEndian.Uint64(data[4:])), int64(binary.BigEndian.Uint32(data)))
+		default:
+			return nil, fmt.Errorf("timestamp extension of %d bytes", len(data))
+		}
+		return ts.UTC().Format(time.RFC3339Nano), nil
+	}
+	return map[string]any{"ext_type": float64(int8(t)), "data": append([]byte(nil), data...)}, nil
+}
+
+// integer returns n, negated when neg is set, as a float64 when that is
+// exact and as a json.Number otherwise.
+func integer(n uint64, neg bool) any {
+	if n <= 1<<53 {
+		if neg {
+			return -float64(n)
+		}
+		return float64(n)
+	}
+	s := fmt.Sprint(n)
+	if neg {
+		s = "-" + s
+	}
+	return json.Number(s)
+}
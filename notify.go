@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os/exec"
+	"time"
+)
+
+// notifyTimeout bounds how long a single notifier may take.
+const notifyTimeout = 30 * time.Second
+
+// Alert describes a rule transition that notifiers are told about.
+type Alert struct {
+	Rule       string   `json:"rule"`
+	Kind       string   `json:"kind"`
+	EventTypes []string `json:"event_types"`
+	Message    string   `json:"message"`
+	Count      int      `json:"count,omitempty"`
+	// Records lists the IDs of the records a lifecycle alert is about.
+	Records []string  `json:"records,omitempty"`
+	FiredAt time.Time `json:"fired_at"`
+}
+
+// Notifier delivers an alert somewhere outside the server.
+type Notifier interface {
+	Notify(ctx context.Context, alert Alert) error
+}
+
+// NotifierConfig is the JSON form of a notifier in an alert rule's actions.
+type NotifierConfig struct {
+	Type    string   `json:"type"`
+	URL     string   `json:"url,omitempty"`
+	Command []string `json:"command,omitempty"`
+	// Email holds the SMTP settings of "email" notifiers.
+	Email *EmailConfig `json:"email,omitempty"`
+}
+
+func newNotifier(cfg NotifierConfig) (Notifier, error) {
+	switch cfg.Type {
+	case "slack":
+		if cfg.URL == "" {
+			return nil, fmt.Errorf("slack notifier requires url")
+		}
+		return &slackNotifier{url: cfg.URL, client: http.DefaultClient}, nil
+	case "webhook":
+		if cfg.URL == "" {
+			return nil, fmt.Errorf("webhook notifier requires url")
+		}
+		return &webhookNotifier{url: cfg.URL, client: http.DefaultClient}, nil
+	case "exec":
+		if len(cfg.Command) == 0 {
+			return nil, fmt.Errorf("exec notifier requires command")
+		}
+		return &execNotifier{command: cfg.Command}, nil
+	case "email":
+		if cfg.Email == nil {
+			return nil, fmt.Errorf("email notifier requires email settings")
+		}
+		n, err := newEmailNotifier(*cfg.Email)
+		if err != nil {
+			return nil, err
+		}
+		return n, nil
+	default:
+		return nil, fmt.Errorf("unknown notifier type %q", cfg.Type)
+	}
+}
+
+func postJSON(ctx context.Context, client *http.Client, url string, v any) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("POST %s: %s", url, resp.Status)
+	}
+	return nil
+}
+
+// slackNotifier posts to a Slack incoming webhook.
+type slackNotifier struct {
+	url    string
+	client *http.Client
+}
+
+func (n *slackNotifier) Notify(ctx context.Context, alert Alert) error {
+	return postJSON(ctx, n.client, n.url, map[string]string{
+		"text": fmt.Sprintf("[webhook-echo] %s: %s", alert.Rule, alert.Message),
+	})
+}
+
+// webhookNotifier posts the alert as JSON.
+type webhookNotifier struct {
+	url    string
+	client *http.Client
+}
+
+func (n *webhookNotifier) Notify(ctx context.Context, alert Alert) error {
+	return postJSON(ctx, n.client, n.url, alert)
+}
+
+// execNotifier runs a command with the alert as JSON on stdin.
+type execNotifier struct {
+	command []string
+}
+
+func (n *execNotifier) Notify(ctx context.Context, alert Alert) error {
+	body, err := json.Marshal(alert)
+	if err != nil {
+		return err
+	}
+	cmd := exec.CommandContext(ctx, n.command[0], n.command[1:]...)
+	cmd.Stdin = bytes.NewReader(body)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%s: %w: %s", n.command[0], err, bytes.TrimSpace(out))
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// exactNumbers keeps payload numbers as json.Number, exactly as written,
+// instead of float64, which rounds integers past 2^53 and decimal amounts.
+var exactNumbers bool
+
+// decodeJSON is json.Unmarshal for payloads, honouring exactNumbers.
+func decodeJSON(data []byte, v any) error {
+	if !exactNumbers {
+		return json.Unmarshal(data, v)
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(v); err != nil {
+		return err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return errors.New("invalid character after top-level value")
+	}
+	return nil
+}
+
+// valueEquals reports whether a payload value has the string form want.
+// Exact numbers are compared by value, so that 1.50 matches 1.5 and large
+// integers match without rounding.
+func valueEquals(value any, want string) bool {
+	n, ok := value.(json.Number)
+	if !ok {
+		return valueString(value) == want
+	}
+	have, ok1 := parseDecimal(n.String())
+	other, ok2 := parseDecimal(want)
+	if !ok1 || !ok2 {
+		return n.String() == want
+	}
+	return have.Cmp(other) == 0
+}
+
+// maxDecimalExponent bounds the exponents parseDecimal expands, since
+// 1e999999999 would take a huge integer to represent exactly.
+const maxDecimalExponent = 1000
+
+// parseDecimal parses a number written as in JSON.
+func parseDecimal(s string) (*big.Rat, bool) {
+	if s == "" || s[0] != '-' && (s[0] < '0' || s[0] > '9') || !json.Valid([]byte(s)) {
+		return nil, false
+	}
+	if i := strings.IndexAny(s, "eE"); i >= 0 {
+		exp, err := strconv.Atoi(s[i+1:])
+		if err != nil || exp > maxDecimalExponent || exp < -maxDecimalExponent {
+			return nil, false
+		}
+	}
+	return new(big.Rat).SetString(s)
+}
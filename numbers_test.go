@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDecodeJSONExactNumbers(t *testing.T) {
+	exactNumbers = true
+	t.Cleanup(func() { exactNumbers = false })
+
+	var v map[string]any
+	if err := decodeJSON([]byte(`{"id":12345678901234567891,"amount":10.10}`), &v); err != nil {
+		t.Fatal(err)
+	}
+	if v["id"] != json.Number("12345678901234567891") || v["amount"] != json.Number("10.10") {
+		t.Errorf("expected numbers as written, got %#v", v)
+	}
+	if err := decodeJSON([]byte(`{} {}`), &v); err == nil {
+		t.Error("expected trailing data to be rejected like json.Unmarshal does")
+	}
+}
+
+func TestValueEquals(t *testing.T) {
+	tests := []struct {
+		value any
+		want  string
+		equal bool
+	}{
+		{json.Number("12345678901234567891"), "12345678901234567891", true},
+		{json.Number("12345678901234567891"), "12345678901234567890", false},
+		{json.Number("1.50"), "1.5", true},
+		{json.Number("1e2"), "100", true},
+		{json.Number("1e999999999"), "1e999999999", true},
+		{json.Number("0.5"), "1/2", false},
+		{json.Number("16"), "0x10", false},
+		{12345678901234567891.0, "12345678901234567891", false},
+		{1.5, "1.5", true},
+	}
+	for _, tt := range tests {
+		if got := valueEquals(tt.value, tt.want); got != tt.equal {
+			t.Errorf("valueEquals(%v, %q) = %v", tt.value, tt.want, got)
+		}
+	}
+}
+
+func TestExactNumbersEndToEnd(t *testing.T) {
+	exactNumbers = true
+	t.Cleanup(func() { exactNumbers = false })
+
+	mux := newTestServer()
+	postWebhook(t, mux, `{"event":"payment","data":{"id":12345678901234567891,"amount":19.90}}`)
+	postWebhook(t, mux, `{"event":"payment","data":{"id":12345678901234567892,"amount":5}}`)
+
+	got := queryWebhooks(t, mux, "/query/payment?id=12345678901234567891&amount=19.9")
+	if len(got) != 1 {
+		t.Fatalf("expected the exact id to match one record, got %d", len(got))
+	}
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/query/payment?id=12345678901234567891", nil))
+	if !strings.Contains(rec.Body.String(), `"id":12345678901234567891`) || !strings.Contains(rec.Body.String(), `"amount":19.90`) {
+		t.Errorf("expected numbers to be written back as sent, got %s", rec.Body)
+	}
+}
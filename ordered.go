@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"strconv"
+)
+
+// OrderedMember is an object member in an ordered view of a JSON document.
+// Objects become arrays of members, in the order they were sent and with
+// duplicate keys kept; numbers are kept as written.
+type OrderedMember struct {
+	Key   string `json:"key"`
+	Value any    `json:"value"`
+}
+
+// OrderedBody is the ordered view of a record's body. DuplicateKeys lists
+// the paths of keys that occur more than once in their object, which a
+// decoded payload silently collapses to the last occurrence.
+type OrderedBody struct {
+	Body          any      `json:"body"`
+	DuplicateKeys []string `json:"duplicate_keys,omitempty"`
+}
+
+// orderedJSON decodes body into its ordered view.
+func orderedJSON(body []byte) (OrderedBody, error) {
+	if err := checkJSONDepth(body, maxJSONDepth); err != nil {
+		return OrderedBody{}, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var ob OrderedBody
+	v, err := orderedValue(dec, "", &ob.DuplicateKeys)
+	if err != nil {
+		return OrderedBody{}, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return OrderedBody{}, errors.New("invalid character after top-level value")
+	}
+	ob.Body = v
+	return ob, nil
+}
+
+func orderedValue(dec *json.Decoder, path string, dups *[]string) (any, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch tok {
+	case json.Delim('{'):
+		members := []OrderedMember{}
+		seen := make(map[string]bool)
+		for dec.More() {
+			keyTok, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			key := keyTok.(string)
+			if seen[key] {
+				*dups = append(*dups, joinPath(path, key))
+			}
+			seen[key] = true
+			v, err := orderedValue(dec, joinPath(path, key), dups)
+			if err != nil {
+				return nil, err
+			}
+			members = append(members, OrderedMember{Key: key, Value: v})
+		}
+		_, err := dec.Token()
+		return members, err
+	case json.Delim('['):
+		items := []any{}
+		for i := 0; dec.More(); i++ {
+			v, err := orderedValue(dec, joinPath(path, strconv.Itoa(i)), dups)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, v)
+		}
+		_, err := dec.Token()
+		return items, err
+	default:
+		return tok, nil
+	}
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
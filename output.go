@@ -0,0 +1,224 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// Output formats of the subcommands, chosen with -output.
+const (
+	outputText  = "text"
+	outputJSON  = "json"
+	outputYAML  = "yaml"
+	outputTable = "table"
+)
+
+var outputFormat = outputText
+
+func validOutputFormat(format string) error {
+	switch format {
+	case outputText, outputJSON, outputYAML, outputTable:
+		return nil
+	}
+	return fmt.Errorf("unknown output format %q, expected text, json, yaml or table", format)
+}
+
+// outputPrinter prints a subcommand's results in outputFormat: one JSON
+// document per line, YAML documents separated by ---, or table rows under
+// one header. Each result is a struct, or a slice of them for several rows.
+type outputPrinter struct {
+	w       io.Writer
+	printed int
+	columns []string
+}
+
+// Print writes v, or calls text in the text format.
+func (p *outputPrinter) Print(v any, text func() error) error {
+	if outputFormat == outputText {
+		return text()
+	}
+	defer func() { p.printed++ }()
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	switch outputFormat {
+	case outputJSON:
+		_, err = fmt.Fprintf(p.w, "%s\n", data)
+		return err
+	case outputYAML:
+		doc, err := orderedOutput(data)
+		if err != nil {
+			return err
+		}
+		var b strings.Builder
+		if p.printed > 0 {
+			b.WriteString("---\n")
+		}
+		writeYAMLValue(&b, doc, 0)
+		_, err = io.WriteString(p.w, b.String())
+		return err
+	}
+	doc, err := orderedOutput(data)
+	if err != nil {
+		return err
+	}
+	rows, ok := doc.([]any)
+	if !ok {
+		rows = []any{doc}
+	}
+	return p.table(rows)
+}
+
+func orderedOutput(data []byte) (any, error) {
+	ob, err := orderedJSON(data)
+	return ob.Body, err
+}
+
+// table writes rows, objects whose members become columns. The columns are
+// those of the first row printed; nested values are shown as JSON.
+func (p *outputPrinter) table(rows []any) error {
+	tw := tabwriter.NewWriter(p.w, 0, 4, 2, ' ', 0)
+	for _, row := range rows {
+		members, _ := row.([]OrderedMember)
+		if p.columns == nil {
+			for _, m := range members {
+				p.columns = append(p.columns, m.Key)
+			}
+			heading := make([]string, len(p.columns))
+			for i, c := range p.columns {
+				heading[i] = strings.ToUpper(c)
+			}
+			fmt.Fprintln(tw, strings.Join(heading, "\t"))
+		}
+		cells := make([]string, len(p.columns))
+		for _, m := range members {
+			for i, c := range p.columns {
+				if c == m.Key {
+					cells[i] = tableCell(m.Value)
+				}
+			}
+		}
+		fmt.Fprintln(tw, strings.Join(cells, "\t"))
+	}
+	return tw.Flush()
+}
+
+func tableCell(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return strings.ReplaceAll(v, "\t", " ")
+	case json.Number:
+		return v.String()
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	var b bytes.Buffer
+	json.NewEncoder(&b).Encode(plainOutput(v))
+	return strings.TrimSpace(b.String())
+}
+
+// plainOutput turns an ordered value back into one encoding/json writes as
+// the original object, for table cells.
+func plainOutput(v any) any {
+	switch v := v.(type) {
+	case []OrderedMember:
+		m := make(map[string]any, len(v))
+		for _, member := range v {
+			m[member.Key] = plainOutput(member.Value)
+		}
+		return m
+	case []any:
+		out := make([]any, len(v))
+		for i, e := range v {
+			out[i] = plainOutput(e)
+		}
+		return out
+	}
+	return v
+}
+
+// writeYAMLValue writes an ordered JSON value as block YAML at indent.
+func writeYAMLValue(b *strings.Builder, v any, indent int) {
+	pad := strings.Repeat("  ", indent)
+	switch v := v.(type) {
+	case []OrderedMember:
+		if len(v) == 0 {
+			b.WriteString(pad + "{}\n")
+			return
+		}
+		for _, m := range v {
+			b.WriteString(pad + yamlScalar(m.Key) + ":")
+			writeYAMLChild(b, m.Value, indent)
+		}
+	case []any:
+		if len(v) == 0 {
+			b.WriteString(pad + "[]\n")
+			return
+		}
+		for _, e := range v {
+			// A mapping starts on the line of its item's dash.
+			if m, ok := e.([]OrderedMember); ok && len(m) > 0 {
+				var item strings.Builder
+				writeYAMLValue(&item, m, indent+1)
+				b.WriteString(pad + "- " + strings.TrimPrefix(item.String(), pad+"  "))
+				continue
+			}
+			b.WriteString(pad + "-")
+			writeYAMLChild(b, e, indent)
+		}
+	default:
+		b.WriteString(pad + yamlScalar(v) + "\n")
+	}
+}
+
+// writeYAMLChild writes the value of a mapping key or sequence item, inline
+// when it is a scalar or empty.
+func writeYAMLChild(b *strings.Builder, v any, indent int) {
+	switch c := v.(type) {
+	case []OrderedMember:
+		if len(c) > 0 {
+			b.WriteString("\n")
+			writeYAMLValue(b, c, indent+1)
+			return
+		}
+		b.WriteString(" {}\n")
+	case []any:
+		if len(c) > 0 {
+			b.WriteString("\n")
+			writeYAMLValue(b, c, indent+1)
+			return
+		}
+		b.WriteString(" []\n")
+	default:
+		b.WriteString(" " + yamlScalar(v) + "\n")
+	}
+}
+
+// yamlScalar writes a scalar, quoting strings YAML would read as another
+// type or that contain special characters.
+func yamlScalar(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return strconv.FormatBool(v)
+	case json.Number:
+		return v.String()
+	case string:
+		if v == "" || plainScalar(v) != any(v) || strings.ContainsAny(v, ":#{}[],&*!|>'\"%@`\n\t") ||
+			strings.TrimSpace(v) != v || strings.HasPrefix(v, "- ") || v == "-" || v == "?" {
+			b, _ := json.Marshal(v)
+			return string(b)
+		}
+		return v
+	}
+	return fmt.Sprint(v)
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestOutputFormats(t *testing.T) {
+	type row struct {
+		Name  string         `json:"name"`
+		Count int            `json:"count"`
+		Tags  []string       `json:"tags"`
+		Meta  map[string]any `json:"meta,omitempty"`
+	}
+	rows := []row{{Name: "a", Count: 1, Tags: []string{"x", "y"}}, {Name: "yes: no", Count: 20, Meta: map[string]any{"k": true}}}
+	tests := []struct {
+		format, want string
+	}{
+		{outputJSON, `[{"name":"a","count":1,"tags":["x","y"]},{"name":"yes: no","count":20,"tags":null,"meta":{"k":true}}]` + "\n"},
+		{outputYAML, "- name: a\n  count: 1\n  tags:\n    - x\n    - y\n- name: \"yes: no\"\n  count: 20\n  tags: null\n  meta:\n    k: true\n"},
+		{outputTable, "NAME     COUNT  TAGS\na        1      [\"x\",\"y\"]\nyes: no  20     \n"},
+	}
+	for _, tt := range tests {
+		outputFormat = tt.format
+		var out strings.Builder
+		if err := (&outputPrinter{w: &out}).Print(rows, nil); err != nil {
+			t.Fatal(err)
+		}
+		if out.String() != tt.want {
+			t.Errorf("%s output:\n%s\nwant:\n%s", tt.format, out.String(), tt.want)
+		}
+	}
+	outputFormat = outputText
+}
+
+func TestSubcommandOutputFlag(t *testing.T) {
+	var out strings.Builder
+	if err := runSubcommand("canonicalize", []string{"-output", "yaml"}, strings.NewReader(`{"b":2,"a":1}`), &out); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(out.String(), "input: \"-\"\ncanonical:\n  a: 1\n  b: 2\nsha256: ") {
+		t.Errorf("unexpected YAML output %q", out.String())
+	}
+	if err := runSubcommand("canonicalize", []string{"-output", "xml"}, strings.NewReader(`{}`), &out); err == nil {
+		t.Error("expected an unknown output format to be rejected")
+	}
+	if outputFormat != outputText {
+		t.Errorf("expected the output format reset for the next command, got %q", outputFormat)
+	}
+}
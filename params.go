@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// recordTimeFormat is how record timestamps are written: always UTC and
+// always with nanoseconds, so that they sort as strings and have a fixed
+// width.
+const recordTimeFormat = "2006-01-02T15:04:05.000000000Z"
+
+// webhookJSON has the fields of WebhookParams but not its methods, for the
+// default encoding underneath the custom one.
+type webhookJSON WebhookParams
+
+func (p WebhookParams) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		webhookJSON
+		ReceivedAt string `json:"received_at"`
+	}{webhookJSON(p), p.ReceivedAt.UTC().Format(recordTimeFormat)})
+}
+
+// UnmarshalJSON reads records and ingest bodies. Besides the current shape
+// it accepts the ones older senders and SDKs use: event_type and payload for
+// event and data, a numeric version, and received_at as Unix seconds or
+// milliseconds. The current names win when both are present.
+func (p *WebhookParams) UnmarshalJSON(b []byte) error {
+	v := struct {
+		*webhookJSON
+		ReceivedAt    flexTime       `json:"received_at"`
+		Version       flexString     `json:"version"`
+		LegacyType    string         `json:"event_type"`
+		LegacyPayload map[string]any `json:"payload"`
+	}{webhookJSON: (*webhookJSON)(p), ReceivedAt: flexTime(p.ReceivedAt), Version: flexString(p.Version)}
+	if err := decodeJSON(b, &v); err != nil {
+		return err
+	}
+	p.ReceivedAt, p.Version = time.Time(v.ReceivedAt), string(v.Version)
+	if p.EventType == "" {
+		p.EventType = v.LegacyType
+	}
+	if p.Payload == nil {
+		p.Payload = v.LegacyPayload
+	}
+	return nil
+}
+
+// flexTime is a timestamp given as an RFC 3339 string or as Unix seconds or
+// milliseconds.
+type flexTime time.Time
+
+func (t *flexTime) UnmarshalJSON(b []byte) error {
+	if bytes.Equal(b, []byte("null")) {
+		return nil
+	}
+	if len(b) > 0 && b[0] == '"' {
+		var parsed time.Time
+		if err := json.Unmarshal(b, &parsed); err != nil {
+			return err
+		}
+		*t = flexTime(parsed)
+		return nil
+	}
+	n, err := strconv.ParseFloat(string(b), 64)
+	if err != nil {
+		return fmt.Errorf("received_at: %s is neither a timestamp nor a number", b)
+	}
+	// Millisecond timestamps are past 1e12, seconds will not be for ages.
+	if n > 1e12 {
+		*t = flexTime(time.UnixMilli(int64(n)).UTC())
+	} else {
+		*t = flexTime(time.Unix(0, int64(n*1e9)).UTC())
+	}
+	return nil
+}
+
+// flexString is a string that senders may also give as a number.
+type flexString string
+
+func (s *flexString) UnmarshalJSON(b []byte) error {
+	if bytes.Equal(b, []byte("null")) {
+		return nil
+	}
+	if len(b) > 0 && b[0] == '"' {
+		return json.Unmarshal(b, (*string)(s))
+	}
+	var n json.Number
+	if err := json.Unmarshal(b, &n); err != nil {
+		return fmt.Errorf("version: %s is neither a string nor a number", b)
+	}
+	*s = flexString(n)
+	return nil
+}
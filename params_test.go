@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWebhookParamsMarshalJSON(t *testing.T) {
+	local := time.FixedZone("CEST", 2*60*60)
+	item := WebhookParams{
+		ID:         "abc",
+		EventType:  "order",
+		Payload:    map[string]any{"n": 1.0},
+		ReceivedAt: time.Date(2024, 5, 1, 14, 0, 0, 500, local),
+		Headers:    http.Header{"X-Test": {"1"}},
+		Raw:        []byte("ignored"),
+	}
+	b, err := json.Marshal(item)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), `"received_at":"2024-05-01T12:00:00.000000500Z"`) {
+		t.Errorf("expected a fixed-width UTC timestamp, got %s", b)
+	}
+	if strings.Contains(string(b), "ignored") || strings.Contains(string(b), "source") {
+		t.Errorf("expected raw and empty fields to be left out, got %s", b)
+	}
+
+	var back WebhookParams
+	if err := json.Unmarshal(b, &back); err != nil {
+		t.Fatal(err)
+	}
+	if !back.ReceivedAt.Equal(item.ReceivedAt) || back.Headers.Get("X-Test") != "1" || back.ID != "abc" {
+		t.Errorf("round trip lost fields: %+v", back)
+	}
+}
+
+func TestWebhookParamsUnmarshalLegacy(t *testing.T) {
+	tests := []struct {
+		body       string
+		event      string
+		version    string
+		receivedAt time.Time
+	}{
+		{`{"event":"order","data":{},"version":"2","received_at":"2024-05-01T12:00:00Z"}`,
+			"order", "2", time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)},
+		{`{"event_type":"order","payload":{"n":1},"version":2,"received_at":1714564800}`,
+			"order", "2", time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)},
+		{`{"event":"order","event_type":"legacy","data":{},"received_at":1714564800250}`,
+			"order", "", time.Date(2024, 5, 1, 12, 0, 0, 250e6, time.UTC)},
+	}
+	for _, tt := range tests {
+		var p WebhookParams
+		if err := json.Unmarshal([]byte(tt.body), &p); err != nil {
+			t.Errorf("%s: %v", tt.body, err)
+			continue
+		}
+		if p.EventType != tt.event || p.Version != tt.version || !p.ReceivedAt.Equal(tt.receivedAt) || p.Payload == nil {
+			t.Errorf("%s: got %+v", tt.body, p)
+		}
+	}
+
+	for _, bad := range []string{`{"received_at":true}`, `{"version":{}}`, `{"event":1}`} {
+		var p WebhookParams
+		if err := json.Unmarshal([]byte(bad), &p); err == nil {
+			t.Errorf("%s: expected an error", bad)
+		}
+	}
+}
+
+func TestHeadersRecorded(t *testing.T) {
+	mux := newTestServer()
+	postWebhook(t, mux, `{"event":"order","data":{},"headers":{"X-Forged":["1"]}}`)
+
+	got := queryWebhooks(t, mux, "/query/order")
+	if len(got) != 1 || got[0].Headers.Get("X-Forged") != "" {
+		t.Fatalf("expected headers from the request only, got %+v", got)
+	}
+}
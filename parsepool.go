@@ -0,0 +1,259 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// parserPool parses large JSON webhooks after answering them when
+// configured with -parse-offload; nil parses every webhook in its request.
+var parserPool *ParserPool
+
+const (
+	// classifyPrefix is how much of a body classifyWebhook looks at.
+	classifyPrefix = 4 << 10
+	// parserQueueSize bounds how many webhooks may wait for a parser.
+	parserQueueSize = 64
+)
+
+// ParserPool stores webhooks of at least Threshold bytes with Workers
+// goroutines, so that the sender is answered with a 202 as soon as the body
+// has been read rather than once a multi-megabyte payload has been parsed.
+// Only plain JSON deliveries that no response rule, redirect rule, storm
+// response or cassette has to answer and that are echoed verbatim or empty
+// are deferred; when the queue is full they are parsed in their request as
+// before. A deferred webhook is counted against quotas before drop rules
+// run, and one that fails to parse is only recorded with -record-malformed.
+// Debounce rules and storm detection apply as usual, but since the sender
+// has been answered already, its response carries neither the X-Echo-Id,
+// X-Echo-Received-At and X-Echo-Sequence headers nor X-Echo-Retry-Storm.
+type ParserPool struct {
+	Threshold int
+	Workers   int
+
+	recorder *Recorder
+	jobs     chan parseJob
+	// slots holds a token for each job queued or about to be, so that a
+	// webhook is only admitted once it is sure to be queued.
+	slots chan struct{}
+	wg    sync.WaitGroup
+
+	mu     sync.Mutex
+	status ParserPoolStatus
+}
+
+type parseJob struct {
+	r        *http.Request
+	raw      []byte
+	body     []byte
+	transfer *Transfer
+	encoding string
+	status   int
+	start    time.Time
+}
+
+// ParserPoolStatus counts the webhooks the pool took over.
+type ParserPoolStatus struct {
+	Threshold int `json:"threshold_bytes"`
+	Workers   int `json:"workers"`
+	Queued    int `json:"queued"`
+	Deferred  int `json:"deferred"`
+	Stored    int `json:"stored"`
+	Dropped   int `json:"dropped"`
+	Failed    int `json:"failed"`
+	// QueueFull counts the eligible webhooks parsed in their request
+	// because every queue slot was taken.
+	QueueFull int `json:"queue_full"`
+}
+
+func NewParserPool(recorder *Recorder, threshold, workers int) *ParserPool {
+	p := &ParserPool{
+		Threshold: threshold,
+		Workers:   max(workers, 1),
+		recorder:  recorder,
+		jobs:      make(chan parseJob, parserQueueSize),
+		slots:     make(chan struct{}, parserQueueSize),
+	}
+	p.status.Threshold, p.status.Workers = p.Threshold, p.Workers
+	for i := 0; i < p.Workers; i++ {
+		p.wg.Add(1)
+		go p.work()
+	}
+	return p
+}
+
+// Defer answers the delivery r, whose body was read as raw and normalized
+// to body, and queues it to be parsed and stored, reporting whether it did.
+// Once it has charged r against priority lanes and quotas it always does,
+// so that the ingest handler never charges a webhook twice.
+func (p *ParserPool) Defer(w http.ResponseWriter, r *http.Request, raw, body []byte, transfer *transferReader, encoding string, start time.Time) bool {
+	if len(raw) < p.Threshold || !p.eligible(r) {
+		return false
+	}
+	mode := echoMode
+	if m := r.Header.Get(echoModeHeader); m != "" {
+		mode = m
+	}
+	if mode != echoVerbatim && mode != echoEmpty {
+		return false
+	}
+	event, ok := classifyWebhook(body)
+	if !ok {
+		return false
+	}
+	if !captureControl(p.recorder, r) {
+		return false
+	}
+	select {
+	case p.slots <- struct{}{}:
+	default:
+		p.count(func(s *ParserPoolStatus) { s.QueueFull++ })
+		return false
+	}
+	if priorityLanes != nil && !priorityLanes.Admit(w, r, WebhookParams{EventType: event}) {
+		<-p.slots
+		return true
+	}
+	if !checkQuota(w, r, int64(len(raw))) {
+		<-p.slots
+		return true
+	}
+
+	job := parseJob{
+		r:        r.Clone(context.WithoutCancel(r.Context())),
+		raw:      raw,
+		body:     body,
+		transfer: transfer.result(r),
+		encoding: encoding,
+		status:   http.StatusAccepted,
+		start:    start,
+	}
+	if mode == echoEmpty {
+		job.status = http.StatusNoContent
+	}
+	// Never blocks: the slot taken above leaves room for job.
+	p.jobs <- job
+	p.count(func(s *ParserPoolStatus) { s.Deferred++ })
+
+	w.Header().Set("X-Echo-Parse", "deferred")
+	if event != "" {
+		w.Header().Set("X-Echo-Event", event)
+	}
+	if mode == echoEmpty {
+		w.WriteHeader(http.StatusNoContent)
+		return true
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	w.Write(raw)
+	return true
+}
+
+// eligible reports whether r can be answered before its body is parsed.
+func (p *ParserPool) eligible(r *http.Request) bool {
+	contentType := r.Header.Get("Content-Type")
+	if lookupFormat(contentType) != nil || githubDelivery(r.Header) != nil || r.Header.Get("X-Twilio-Signature") != "" {
+		return false
+	}
+	if storms != nil && storms.Response != "" {
+		return false
+	}
+	return redirectRules == nil && responseRules == nil && playback.Status().Remaining == 0
+}
+
+// classifyWebhook looks at the start of body only, returning the event type
+// if it comes first and reporting whether body looks like a JSON object.
+func classifyWebhook(body []byte) (string, bool) {
+	prefix := bytes.TrimLeft(body[:min(len(body), classifyPrefix)], " \t\r\n")
+	if len(prefix) == 0 || prefix[0] != '{' {
+		return "", false
+	}
+	dec := json.NewDecoder(bytes.NewReader(prefix))
+	if _, err := dec.Token(); err != nil {
+		return "", false
+	}
+	key, err := dec.Token()
+	if k, ok := key.(string); err != nil || !ok || k != "event" && k != "event_type" {
+		return "", true
+	}
+	if event, err := dec.Token(); err == nil {
+		if s, ok := event.(string); ok {
+			return s, true
+		}
+	}
+	return "", true
+}
+
+func (p *ParserPool) count(f func(*ParserPoolStatus)) {
+	p.mu.Lock()
+	f(&p.status)
+	p.mu.Unlock()
+}
+
+func (p *ParserPool) work() {
+	defer p.wg.Done()
+	for job := range p.jobs {
+		<-p.slots
+		p.process(job)
+	}
+}
+
+// process parses and stores job as the ingest handler would have.
+func (p *ParserPool) process(job parseJob) {
+	res, err := parseWebhook(job.body, job.r.Header.Get("Content-Type"))
+	if err != nil {
+		p.count(func(s *ParserPoolStatus) { s.Failed++ })
+		log.Printf("Deferred webhook not stored: %v", err)
+		if recordMalformed {
+			p.recorder.Record(malformedWebhook(job.r, job.raw, job.transfer, err.Error()), job.raw)
+		}
+		return
+	}
+	if dropRules != nil && dropRules.Drop(job.r, res) != "" {
+		p.count(func(s *ParserPoolStatus) { s.Dropped++ })
+		return
+	}
+	stampWebhook(&res, job.r, job.raw, job.body, job.transfer, job.encoding, nil)
+	res.StatusCode = job.status
+	var stored WebhookParams
+	var duplicate bool
+	if debounceRules != nil {
+		stored, duplicate = debounceRules.Record(p.recorder, job.r, res, job.body)
+	} else {
+		stored, duplicate = p.recorder.Record(res, job.body)
+	}
+	if ingestMetrics != nil && stored.ID != "" && !duplicate {
+		ingestMetrics.Observe(stored, time.Since(job.start))
+	}
+	if !duplicate {
+		checkStripeLater(p.recorder.buffer, stored)
+	}
+	tagStorm(p.recorder.buffer, stored)
+	p.count(func(s *ParserPoolStatus) { s.Stored++ })
+}
+
+// Close stops taking webhooks and waits for the queued ones to be stored.
+func (p *ParserPool) Close() {
+	close(p.jobs)
+	p.wg.Wait()
+}
+
+func (p *ParserPool) Status() ParserPoolStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	status := p.status
+	status.Queued = len(p.jobs)
+	return status
+}
+
+func parserPoolHandler(p *ParserPool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(p.Status())
+	}
+}
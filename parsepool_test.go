@@ -0,0 +1,101 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestClassifyWebhook(t *testing.T) {
+	tests := []struct {
+		body, event string
+		ok          bool
+	}{
+		{`{"event":"order.created","data":{}}`, "order.created", true},
+		{` {"event_type":"legacy","payload":{}}`, "legacy", true},
+		{`{"data":{},"event":"late"}`, "", true},
+		{`{"event":` + strings.Repeat(" ", classifyPrefix), "", true},
+		{`[1,2]`, "", false},
+		{`<xml/>`, "", false},
+	}
+	for _, tt := range tests {
+		if event, ok := classifyWebhook([]byte(tt.body)); event != tt.event || ok != tt.ok {
+			t.Errorf("classifyWebhook(%.30q) = %q, %v, want %q, %v", tt.body, event, ok, tt.event, tt.ok)
+		}
+	}
+}
+
+func TestParserPoolDefersLargeWebhooks(t *testing.T) {
+	buffer := NewRingBuffer(10)
+	mux := http.NewServeMux()
+	pool := NewParserPool(registerRoutes(mux, buffer, "secret"), 1000, 2)
+	parserPool = pool
+	t.Cleanup(func() { parserPool = nil })
+
+	large := `{"event":"export.ready","data":{"blob":"` + strings.Repeat("x", 2000) + `"}}`
+	rec := postWebhook(t, mux, large)
+	if rec.Code != http.StatusAccepted || rec.Header().Get("X-Echo-Parse") != "deferred" || rec.Header().Get("X-Echo-Event") != "export.ready" {
+		t.Fatalf("expected a deferred 202, got %d with %v", rec.Code, rec.Header())
+	}
+	if rec.Body.String() != large {
+		t.Error("expected the body echoed verbatim")
+	}
+	if rec := postWebhook(t, mux, `{"event":"small","data":{}}`); rec.Code != http.StatusOK || rec.Header().Get("X-Echo-Parse") != "" {
+		t.Errorf("expected a small webhook to be parsed in its request, got %d", rec.Code)
+	}
+	postWebhook(t, mux, `{"event":"broken","data":`+strings.Repeat(" ", 2000))
+	pool.Close()
+
+	items, _ := buffer.Query(t.Context(), QueryFilter{EventTypes: []string{"export.ready"}})
+	if len(items) != 1 || items[0].StatusCode != http.StatusAccepted || items[0].Payload["blob"] == nil || len(items[0].Raw) != len(large) {
+		t.Fatalf("expected the deferred webhook stored with its payload, got %+v", items)
+	}
+	status := pool.Status()
+	if status.Deferred != 2 || status.Stored != 1 || status.Failed != 1 {
+		t.Errorf("unexpected pool status %+v", status)
+	}
+}
+
+func TestParserPoolQueueFullChargesQuotaOnce(t *testing.T) {
+	withQuotas(t, NewQuotas("X-Echo-Bucket", QuotaLimits{PerMinute: 2}, QuotaLimits{}))
+	buffer := NewRingBuffer(10)
+	mux := http.NewServeMux()
+	pool := NewParserPool(registerRoutes(mux, buffer, "secret"), 1000, 1)
+	parserPool = pool
+	t.Cleanup(func() { parserPool = nil })
+	for range parserQueueSize {
+		pool.slots <- struct{}{}
+	}
+
+	large := `{"event":"export.ready","data":{"blob":"` + strings.Repeat("x", 2000) + `"}}`
+	rec := postToBucket(t, mux, "a", large)
+	if rec.Code != http.StatusOK || rec.Header().Get("X-Quota-Remaining") != "1" {
+		t.Errorf("expected the webhook parsed in its request and charged once, got %d with %v", rec.Code, rec.Header())
+	}
+	if status := pool.Status(); status.QueueFull != 1 || status.Deferred != 0 {
+		t.Errorf("unexpected pool status %+v", status)
+	}
+}
+
+func TestParserPoolTagsRetryStorms(t *testing.T) {
+	storms = NewStormDetector(1, "")
+	t.Cleanup(func() { storms = nil })
+	buffer := NewRingBuffer(10)
+	mux := http.NewServeMux()
+	pool := NewParserPool(registerRoutes(mux, buffer, "secret"), 1000, 1)
+	parserPool = pool
+	t.Cleanup(func() { parserPool = nil })
+
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"event":"export.ready","data":{"blob":"`+strings.Repeat("x", 2000)+`"}}`))
+	req.Header.Set(idempotencyHeader, "export-1")
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	pool.Close()
+
+	items, _ := buffer.Query(t.Context(), QueryFilter{})
+	if rec.Header().Get("X-Echo-Parse") != "deferred" || len(items) != 1 || !slices.Contains(items[0].Tags, tagRetryStorm) {
+		t.Errorf("expected the deferred webhook tagged as a retry storm, got %+v", items)
+	}
+}
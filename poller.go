@@ -0,0 +1,310 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	defaultPollInterval = time.Minute
+	// maxPollResponseSize bounds one page of a provider's event list.
+	maxPollResponseSize = 32 << 20
+)
+
+// PollerConfig describes a provider API that lists events, polled for
+// providers that cannot push webhooks. Each event in the list becomes a
+// webhook: Items is the dotted path of the list in the response, empty when
+// the response is the list; EventType is the path of the event type in an
+// event, the poller's name being used when it is unset; ID is the path of
+// the event's ID, which makes events seen on overlapping pages redeliveries
+// rather than new records. Header values have $VAR and ${VAR} expanded from
+// the environment, so tokens need not be in the file.
+type PollerConfig struct {
+	Name      string            `json:"name"`
+	URL       string            `json:"url"`
+	Interval  jsonDuration      `json:"interval,omitempty"`
+	Headers   map[string]string `json:"headers,omitempty"`
+	Items     string            `json:"items,omitempty"`
+	EventType string            `json:"event_type,omitempty"`
+	ID        string            `json:"id,omitempty"`
+	// Order is "oldest_first", the default, or "newest_first" for APIs
+	// listing the latest events first. Events are recorded oldest first
+	// either way.
+	Order  string       `json:"order,omitempty"`
+	Cursor PollerCursor `json:"cursor"`
+}
+
+// PollerCursor says how to resume where the last poll stopped. The cursor
+// is sent as the query parameter Param and taken either from the response,
+// at the dotted path Response (e.g. "next_cursor"), or from the newest event,
+// at the path Item (e.g. "id" for an ending_before-style API). HasMore is the
+// path of a boolean in the response saying another page is waiting, which is
+// then fetched right away.
+type PollerCursor struct {
+	Param    string `json:"param,omitempty"`
+	Response string `json:"response,omitempty"`
+	Item     string `json:"item,omitempty"`
+	Initial  string `json:"initial,omitempty"`
+	HasMore  string `json:"has_more,omitempty"`
+}
+
+func LoadPollers(path string) ([]PollerConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var configs []PollerConfig
+	if err := json.Unmarshal(data, &configs); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return configs, nil
+}
+
+// PollerStatus is what GET /pollers reports for a poller.
+type PollerStatus struct {
+	Name      string    `json:"name"`
+	URL       string    `json:"url"`
+	Cursor    string    `json:"cursor,omitempty"`
+	LastPoll  time.Time `json:"last_poll,omitzero"`
+	LastError string    `json:"last_error,omitempty"`
+	Recorded  int       `json:"recorded"`
+}
+
+// Poller fetches one provider's events and records them as webhooks.
+type Poller struct {
+	cfg      PollerConfig
+	client   *http.Client
+	recorder *Recorder
+
+	mu     sync.Mutex
+	status PollerStatus
+}
+
+func NewPoller(cfg PollerConfig, client *http.Client, recorder *Recorder) (*Poller, error) {
+	if cfg.Name == "" {
+		return nil, errors.New("poller without name")
+	}
+	u, err := url.Parse(cfg.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, fmt.Errorf("poller %s: url must be http or https", cfg.Name)
+	}
+	if cfg.Order != "" && cfg.Order != "oldest_first" && cfg.Order != "newest_first" {
+		return nil, fmt.Errorf("poller %s: order must be oldest_first or newest_first", cfg.Name)
+	}
+	if (cfg.Cursor.Response != "" || cfg.Cursor.Item != "") == (cfg.Cursor.Param == "") || cfg.Cursor.Response != "" && cfg.Cursor.Item != "" {
+		return nil, fmt.Errorf("poller %s: a cursor needs param and one of response or item", cfg.Name)
+	}
+	if cfg.Interval.Duration <= 0 {
+		cfg.Interval.Duration = defaultPollInterval
+	}
+	return &Poller{
+		cfg:      cfg,
+		client:   client,
+		recorder: recorder,
+		status:   PollerStatus{Name: cfg.Name, URL: u.Redacted(), Cursor: cfg.Cursor.Initial},
+	}, nil
+}
+
+// Run polls until ctx is cancelled. Errors are logged and retried on the
+// next poll.
+func (p *Poller) Run(ctx context.Context) {
+	for ctx.Err() == nil {
+		more, err := p.poll(ctx)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("Poller %s: %v", p.cfg.Name, err)
+		}
+		if more {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+		case <-time.After(p.cfg.Interval.Duration):
+		}
+	}
+}
+
+// poll fetches and records one page, reporting whether another one is
+// waiting.
+func (p *Poller) poll(ctx context.Context) (more bool, err error) {
+	p.mu.Lock()
+	cursor := p.status.Cursor
+	p.mu.Unlock()
+	defer func() {
+		p.mu.Lock()
+		p.status.LastPoll = time.Now().UTC()
+		p.status.LastError = ""
+		if err != nil {
+			p.status.LastError = err.Error()
+		}
+		p.mu.Unlock()
+	}()
+
+	resp, err := p.fetch(ctx, cursor)
+	if err != nil {
+		return false, err
+	}
+	list := resp
+	if p.cfg.Items != "" {
+		list, _ = pollPath(resp, p.cfg.Items)
+	}
+	items, ok := list.([]any)
+	if !ok {
+		return false, fmt.Errorf("no list of events at %q", p.cfg.Items)
+	}
+	if p.cfg.Order == "newest_first" {
+		items = slices.Clone(items)
+		slices.Reverse(items)
+	}
+
+	next := cursor
+	recorded := 0
+	for _, event := range items {
+		item, body, err := p.webhook(event)
+		if err != nil {
+			return false, err
+		}
+		if _, duplicate := p.recorder.Record(item, body); !duplicate {
+			recorded++
+		}
+		if p.cfg.Cursor.Item != "" {
+			if v, ok := pollPath(event, p.cfg.Cursor.Item); ok {
+				next = cursorString(v)
+			}
+		}
+	}
+	if p.cfg.Cursor.Response != "" {
+		if v, ok := pollPath(resp, p.cfg.Cursor.Response); ok && v != nil {
+			next = cursorString(v)
+		}
+	}
+	if p.cfg.Cursor.HasMore != "" {
+		v, _ := pollPath(resp, p.cfg.Cursor.HasMore)
+		// A cursor that did not move would fetch the same page forever.
+		more = v == true && next != cursor
+	}
+
+	p.mu.Lock()
+	p.status.Cursor = next
+	p.status.Recorded += recorded
+	p.mu.Unlock()
+	return more, nil
+}
+
+func (p *Poller) fetch(ctx context.Context, cursor string) (any, error) {
+	u, _ := url.Parse(p.cfg.URL)
+	if cursor != "" {
+		q := u.Query()
+		q.Set(p.cfg.Cursor.Param, cursor)
+		u.RawQuery = q.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", "webhook-echo/"+version)
+	for name, value := range p.cfg.Headers {
+		req.Header.Set(name, os.ExpandEnv(value))
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", u.Redacted(), resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxPollResponseSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(body) > maxPollResponseSize {
+		return nil, fmt.Errorf("GET %s: larger than %d bytes", u.Redacted(), maxPollResponseSize)
+	}
+	var v any
+	if err := decodeJSON(body, &v); err != nil {
+		return nil, fmt.Errorf("GET %s: %w", u.Redacted(), err)
+	}
+	return v, nil
+}
+
+// webhook turns one listed event into a synthetic webhook. Events that are
+// not objects become the payload's "value".
+func (p *Poller) webhook(event any) (WebhookParams, []byte, error) {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return WebhookParams{}, nil, err
+	}
+	payload, ok := event.(map[string]any)
+	if !ok {
+		payload = map[string]any{"value": event}
+	}
+	item := WebhookParams{
+		EventType:   p.cfg.Name,
+		Payload:     payload,
+		Source:      p.status.URL,
+		ContentType: "application/json",
+	}
+	if p.cfg.EventType != "" {
+		if v, ok := pollPath(event, p.cfg.EventType); ok {
+			item.EventType = cursorString(v)
+		}
+	}
+	if p.cfg.ID != "" {
+		if v, ok := pollPath(event, p.cfg.ID); ok {
+			item.IdempotencyKey = "poll:" + p.cfg.Name + ":" + cursorString(v)
+		}
+	}
+	return item, body, nil
+}
+
+func (p *Poller) Status() PollerStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.status
+}
+
+// pollPath resolves a dotted path in a decoded JSON value.
+func pollPath(v any, path string) (any, bool) {
+	obj, ok := v.(map[string]any)
+	if !ok {
+		return nil, false
+	}
+	return lookupPath(obj, path)
+}
+
+// cursorString renders a JSON scalar the way it would appear in a URL.
+func cursorString(v any) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	b, _ := json.Marshal(v)
+	return string(b)
+}
+
+func pollersHandler(pollers []*Poller) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		statuses := make([]PollerStatus, len(pollers))
+		for i, p := range pollers {
+			statuses[i] = p.Status()
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(statuses)
+	}
+}
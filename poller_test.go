@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPollerCursor(t *testing.T) {
+	t.Setenv("POLL_TOKEN", "secret")
+	pages := map[string]string{
+		"":     `{"data": [{"id": "ev_2", "type": "order.paid"}, {"id": "ev_1", "type": "order.created"}], "has_more": true}`,
+		"ev_2": `{"data": [{"id": "ev_3", "type": "order.shipped"}, {"id": "ev_2", "type": "order.paid"}], "has_more": false}`,
+	}
+	provider := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(pages[r.URL.Query().Get("ending_before")]))
+	}))
+	defer provider.Close()
+
+	buffer := NewRingBuffer(10)
+	p, err := NewPoller(PollerConfig{
+		Name:      "acme",
+		URL:       provider.URL + "/v1/events?limit=2",
+		Headers:   map[string]string{"Authorization": "Bearer ${POLL_TOKEN}"},
+		Items:     "data",
+		EventType: "type",
+		ID:        "id",
+		Order:     "newest_first",
+		Cursor:    PollerCursor{Param: "ending_before", Item: "id", HasMore: "has_more"},
+	}, provider.Client(), NewRecorder(buffer))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if more, err := p.poll(context.Background()); err != nil || !more {
+		t.Fatalf("expected a first page with more to come, got %v %v", more, err)
+	}
+	if more, err := p.poll(context.Background()); err != nil || more {
+		t.Fatalf("expected the last page, got %v %v", more, err)
+	}
+	items, _, _ := buffer.After(context.Background(), 0, 0, nil)
+	var events []string
+	for _, item := range items {
+		events = append(events, item.EventType)
+	}
+	if len(events) != 3 || events[0] != "order.created" || events[2] != "order.shipped" {
+		t.Fatalf("expected three events oldest first, overlap deduplicated, got %v", events)
+	}
+	if items[1].Deliveries != 2 || items[0].Payload["id"] != "ev_1" {
+		t.Errorf("expected ev_2 recorded once and seen twice, got %+v", items[1])
+	}
+
+	rec := httptest.NewRecorder()
+	pollersHandler([]*Poller{p})(rec, httptest.NewRequest(http.MethodGet, "/pollers", nil))
+	var statuses []PollerStatus
+	json.NewDecoder(rec.Body).Decode(&statuses)
+	if len(statuses) != 1 || statuses[0].Cursor != "ev_3" || statuses[0].Recorded != 3 || statuses[0].LastError != "" {
+		t.Errorf("unexpected poller status %+v", statuses)
+	}
+}
+
+func TestNewPollerValidation(t *testing.T) {
+	for name, cfg := range map[string]PollerConfig{
+		"no name":              {URL: "https://example.com"},
+		"bad url":              {Name: "a", URL: "ftp://example.com"},
+		"cursor without param": {Name: "a", URL: "https://example.com", Cursor: PollerCursor{Item: "id"}},
+		"param without source": {Name: "a", URL: "https://example.com", Cursor: PollerCursor{Param: "after"}},
+		"bad order":            {Name: "a", URL: "https://example.com", Order: "random"},
+	} {
+		if _, err := NewPoller(cfg, http.DefaultClient, nil); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
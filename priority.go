@@ -0,0 +1,177 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+)
+
+const codeOverloaded = "overloaded"
+
+// Priority classes, from shed first to never shed.
+const (
+	priorityLow      = "low"
+	priorityNormal   = "normal"
+	priorityCritical = "critical"
+)
+
+var priorityClasses = []string{priorityLow, priorityNormal, priorityCritical}
+
+// priorityLanes sheds webhooks under load when configured with
+// -max-inflight; nil stores everything.
+var priorityLanes *PriorityLanes
+
+// PriorityRule puts webhooks matching it, as a drop rule matches, in Class:
+// low, normal or critical. Webhooks no rule matches are normal.
+type PriorityRule struct {
+	DropRule
+	Class string `json:"class"`
+}
+
+// LoadPriorityRules reads a JSON array of priority rules from path.
+func LoadPriorityRules(path string) ([]PriorityRule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var rules []PriorityRule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return rules, nil
+}
+
+type priorityState struct {
+	*dropState
+	class   string
+	matched int
+}
+
+// PriorityClassStatus counts the webhooks of one class admitted and shed.
+type PriorityClassStatus struct {
+	Admitted int `json:"admitted"`
+	Shed     int `json:"shed"`
+}
+
+// PriorityLanes counts the webhooks being ingested and, once more than half
+// of MaxInFlight are, sheds low priority ones with a 503. Past MaxInFlight
+// normal ones are shed too; critical ones are always stored.
+type PriorityLanes struct {
+	MaxInFlight int
+
+	inFlight atomic.Int64
+	mu       sync.Mutex
+	rules    []*priorityState
+	classes  map[string]*PriorityClassStatus
+}
+
+func NewPriorityLanes(maxInFlight int, rules []PriorityRule) (*PriorityLanes, error) {
+	if maxInFlight <= 0 {
+		return nil, errors.New("max in-flight webhooks must be positive")
+	}
+	p := &PriorityLanes{MaxInFlight: maxInFlight, classes: make(map[string]*PriorityClassStatus)}
+	for _, class := range priorityClasses {
+		p.classes[class] = &PriorityClassStatus{}
+	}
+	for _, rule := range rules {
+		if rule.Name == "" {
+			return nil, errors.New("priority rule without name")
+		}
+		if p.classes[rule.Class] == nil {
+			return nil, fmt.Errorf("priority rule %s: class must be low, normal or critical, got %q", rule.Name, rule.Class)
+		}
+		state, err := newDropState("priority", rule.DropRule)
+		if err != nil {
+			return nil, err
+		}
+		p.rules = append(p.rules, &priorityState{dropState: state, class: rule.Class})
+	}
+	return p, nil
+}
+
+// Enter counts a webhook as being ingested until the returned function is
+// called.
+func (p *PriorityLanes) Enter() func() {
+	p.inFlight.Add(1)
+	return func() { p.inFlight.Add(-1) }
+}
+
+// Admit decides whether to store the webhook item, parsed from r, at the
+// current load. A shed webhook is answered with a 503 and Retry-After.
+func (p *PriorityLanes) Admit(w http.ResponseWriter, r *http.Request, item WebhookParams) bool {
+	p.mu.Lock()
+	class := priorityNormal
+	for _, s := range p.rules {
+		if s.matches(r, item) {
+			s.matched++
+			class = s.class
+			break
+		}
+	}
+	limit := int64(p.MaxInFlight)
+	if class == priorityLow {
+		limit = max(limit/2, 1)
+	}
+	admit := class == priorityCritical || p.inFlight.Load() <= limit
+	if admit {
+		p.classes[class].Admitted++
+	} else {
+		p.classes[class].Shed++
+	}
+	p.mu.Unlock()
+
+	if !admit {
+		w.Header().Set("Retry-After", "1")
+		w.Header().Set("X-Echo-Priority", class)
+		writeProblem(w, r, http.StatusServiceUnavailable, codeOverloaded,
+			fmt.Sprintf("Shedding %s priority webhooks under load", class))
+	}
+	return admit
+}
+
+type PriorityRuleStatus struct {
+	PriorityRule
+	Matched int `json:"matched"`
+}
+
+type PriorityReport struct {
+	MaxInFlight int                            `json:"max_inflight"`
+	InFlight    int64                          `json:"inflight"`
+	Shed        int                            `json:"shed"`
+	Classes     map[string]PriorityClassStatus `json:"classes"`
+	Rules       []PriorityRuleStatus           `json:"rules"`
+}
+
+func (p *PriorityLanes) Report() PriorityReport {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	report := PriorityReport{
+		MaxInFlight: p.MaxInFlight,
+		InFlight:    p.inFlight.Load(),
+		Classes:     make(map[string]PriorityClassStatus, len(p.classes)),
+		Rules:       make([]PriorityRuleStatus, 0, len(p.rules)),
+	}
+	for class, status := range p.classes {
+		report.Classes[class] = *status
+		report.Shed += status.Shed
+	}
+	for _, s := range p.rules {
+		report.Rules = append(report.Rules, PriorityRuleStatus{
+			PriorityRule: PriorityRule{DropRule: s.rule, Class: s.class},
+			Matched:      s.matched,
+		})
+	}
+	return report
+}
+
+func priorityLanesHandler(p *PriorityLanes) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(p.Report())
+	}
+}
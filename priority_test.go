@@ -0,0 +1,66 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestPriorityLanesShedLowFirst(t *testing.T) {
+	lanes, err := NewPriorityLanes(4, []PriorityRule{
+		{DropRule: DropRule{Name: "heartbeats", EventType: "heartbeat"}, Class: priorityLow},
+		{DropRule: DropRule{Name: "payments", EventType: "payment.*"}, Class: priorityCritical},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	priorityLanes = lanes
+	t.Cleanup(func() { priorityLanes = nil })
+	mux := newTestServer()
+
+	post := func(event string) int {
+		return postWebhook(t, mux, `{"event":"`+event+`","data":{}}`).Code
+	}
+	if code := post("heartbeat"); code != http.StatusOK {
+		t.Fatalf("expected a heartbeat to be stored without load, got %d", code)
+	}
+
+	// Two webhooks held elsewhere plus this one are past half of four.
+	for range 2 {
+		defer lanes.Enter()()
+	}
+	if code := post("heartbeat"); code != http.StatusServiceUnavailable {
+		t.Errorf("expected a heartbeat to be shed, got %d", code)
+	}
+	if code := post("order"); code != http.StatusOK {
+		t.Errorf("expected a normal webhook to be stored, got %d", code)
+	}
+
+	defer lanes.Enter()()
+	defer lanes.Enter()()
+	if code := post("order"); code != http.StatusServiceUnavailable {
+		t.Errorf("expected a normal webhook to be shed past the limit, got %d", code)
+	}
+	if code := post("payment.succeeded"); code != http.StatusOK {
+		t.Errorf("expected a payment to always be stored, got %d", code)
+	}
+
+	report := lanes.Report()
+	if report.Shed != 2 || report.Classes[priorityLow].Shed != 1 || report.Classes[priorityNormal].Shed != 1 || report.Classes[priorityCritical].Admitted != 1 {
+		t.Errorf("unexpected report %+v", report)
+	}
+	if report.InFlight != 4 || report.Rules[0].Matched != 2 {
+		t.Errorf("unexpected in-flight count or rule matches in %+v", report)
+	}
+	if got := queryWebhooks(t, mux, "/query/heartbeat"); len(got) != 1 {
+		t.Errorf("expected one stored heartbeat, got %d", len(got))
+	}
+}
+
+func TestNewPriorityLanesRejectsUnknownClass(t *testing.T) {
+	if _, err := NewPriorityLanes(4, []PriorityRule{{DropRule: DropRule{Name: "x", EventType: "x"}, Class: "urgent"}}); err == nil {
+		t.Error("expected an unknown class to be rejected")
+	}
+	if _, err := NewPriorityLanes(0, nil); err == nil {
+		t.Error("expected a zero limit to be rejected")
+	}
+}
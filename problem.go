@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// Machine-readable error codes returned in the "code" member of problem
+// responses. Clients should branch on these rather than on Detail.
+const (
+	codeInvalidJSON      = "invalid_json"
+	codeInvalidXML       = "invalid_xml"
+	codeInvalidGraphQL   = "invalid_graphql"
+	codeInvalidMsgPack   = "invalid_msgpack"
+	codeInvalidCBOR      = "invalid_cbor"
+	codeInvalidAvro      = "invalid_avro"
+	codePayloadTooLarge  = "payload_too_large"
+	codeUnreadableBody   = "unreadable_body"
+	codeMissingParameter = "missing_parameter"
+	codeInvalidParameter = "invalid_parameter"
+	codeUnauthorized     = "unauthorized"
+	codeForbidden        = "forbidden"
+	codeNotFound         = "not_found"
+	codeMethodNotAllowed = "method_not_allowed"
+	codeQueryTimeout     = "query_timeout"
+	codeLinkExpired      = "link_expired"
+	codeConflict         = "conflict"
+)
+
+// Problem is an RFC 7807 problem details object.
+type Problem struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Code     string `json:"code"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+}
+
+// writeProblem writes an application/problem+json error response.
+func writeProblem(w http.ResponseWriter, r *http.Request, status int, code, detail string) {
+	p := Problem{
+		Type:   "about:blank",
+		Title:  http.StatusText(status),
+		Status: status,
+		Code:   code,
+		Detail: detail,
+	}
+	if r != nil {
+		p.Instance = externalPath(r.URL.Path)
+	}
+
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(p)
+}
+
+// statusRecorder captures the status and headers a handler would write,
+// discarding the body.
+type statusRecorder struct {
+	header http.Header
+	status int
+}
+
+func (s *statusRecorder) Header() http.Header         { return s.header }
+func (s *statusRecorder) Write(b []byte) (int, error) { return len(b), nil }
+func (s *statusRecorder) WriteHeader(status int)      { s.status = status }
+
+// withProblemFallback replaces the mux's plain-text 404 and 405 responses
+// with problem details.
+func withProblemFallback(mux *http.ServeMux) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h, pattern := mux.Handler(r)
+		if pattern != "" {
+			mux.ServeHTTP(w, r)
+			return
+		}
+
+		rec := &statusRecorder{header: make(http.Header), status: http.StatusOK}
+		h.ServeHTTP(rec, r)
+
+		switch rec.status {
+		case http.StatusMethodNotAllowed:
+			if allow := rec.header.Get("Allow"); allow != "" {
+				w.Header().Set("Allow", allow)
+			}
+			writeProblem(w, r, rec.status, codeMethodNotAllowed, "Method not allowed for this route")
+		case http.StatusNotFound:
+			writeProblem(w, r, rec.status, codeNotFound, "No route matches this path")
+		default:
+			// Redirects and the like: let the mux answer as usual.
+			mux.ServeHTTP(w, r)
+		}
+	})
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func decodeProblem(t *testing.T, rec *httptest.ResponseRecorder) Problem {
+	t.Helper()
+	if ct := rec.Header().Get("Content-Type"); ct != "application/problem+json" {
+		t.Fatalf("expected problem+json content type, got %q", ct)
+	}
+	var p Problem
+	if err := json.Unmarshal(rec.Body.Bytes(), &p); err != nil {
+		t.Fatalf("failed to parse problem: %v", err)
+	}
+	if p.Status != rec.Code {
+		t.Errorf("problem status %d does not match response status %d", p.Status, rec.Code)
+	}
+	return p
+}
+
+func TestInvalidJSONProblem(t *testing.T) {
+	mux := newTestServer()
+
+	rec := postWebhook(t, mux, "not json")
+	p := decodeProblem(t, rec)
+	if p.Code != codeInvalidJSON {
+		t.Errorf("expected code %s, got %s", codeInvalidJSON, p.Code)
+	}
+}
+
+func TestPayloadTooLargeProblem(t *testing.T) {
+	maxBodySize = 16
+	defer func() { maxBodySize = 0 }()
+	mux := newTestServer()
+
+	rec := postWebhook(t, mux, `{"event":"big","data":{"padding":"`+strings.Repeat("x", 64)+`"}}`)
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected status 413, got %d", rec.Code)
+	}
+	if p := decodeProblem(t, rec); p.Code != codePayloadTooLarge {
+		t.Errorf("expected code %s, got %s", codePayloadTooLarge, p.Code)
+	}
+}
+
+func TestProblemFallbackForUnknownRoutes(t *testing.T) {
+	queryOnly := http.NewServeMux()
+	queryOnly.HandleFunc("GET /query/{event_type}", queryWebhookHandler(NewRingBuffer(1)))
+
+	req := httptest.NewRequest(http.MethodGet, "/nope", nil)
+	rec := httptest.NewRecorder()
+	withProblemFallback(queryOnly).ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected status 404, got %d", rec.Code)
+	}
+	if p := decodeProblem(t, rec); p.Code != codeNotFound {
+		t.Errorf("expected code %s, got %s", codeNotFound, p.Code)
+	}
+
+	handler := withProblemFallback(newTestServer())
+	req = httptest.NewRequest(http.MethodDelete, "/query/user", nil)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("expected status 405, got %d", rec.Code)
+	}
+	if p := decodeProblem(t, rec); p.Code != codeMethodNotAllowed {
+		t.Errorf("expected code %s, got %s", codeMethodNotAllowed, p.Code)
+	}
+	if rec.Header().Get("Allow") == "" {
+		t.Error("expected Allow header on 405")
+	}
+
+	// Matched routes are served untouched.
+	req = httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString(`{"event":"ok"}`))
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("expected status 200, got %d", rec.Code)
+	}
+}
+
+func TestUnauthorizedProblem(t *testing.T) {
+	mux := newDebugTestServer("secret")
+
+	req := httptest.NewRequest(http.MethodGet, "/debug/vars", nil)
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	if p := decodeProblem(t, rec); p.Code != codeUnauthorized {
+		t.Errorf("expected code %s, got %s", codeUnauthorized, p.Code)
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// queryCommand is "webhook-echo query [event-type] [name=value...]". It
+// prints the records a server holds that match the event type and the
+// /query parameters given, newest first.
+func queryCommand(fs *flag.FlagSet) func(args []string, stdin io.Reader, stdout io.Writer) error {
+	server := fs.String("url", "http://localhost:8080", "Base URL of the webhook-echo server")
+	return func(args []string, stdin io.Reader, stdout io.Writer) error {
+		client, err := newServerClient(*server, "")
+		if err != nil {
+			return err
+		}
+		eventType, params, err := parseQueryArgs(args)
+		if err != nil {
+			return err
+		}
+		path := "/query"
+		if eventType != "" {
+			path += "/" + url.PathEscape(eventType)
+		}
+		var res QueryResult
+		if err := client.call(http.MethodGet, path+"?"+params.Encode(), nil, &res); err != nil {
+			return err
+		}
+		if err := printRecords(res.Items, stdout); err != nil {
+			return err
+		}
+		if res.Truncated {
+			return errors.New("the server ran out of time scanning, so the results are partial")
+		}
+		return nil
+	}
+}
+
+// parseQueryArgs splits the arguments of query and replay into an event
+// type, given first if at all, and name=value query parameters.
+func parseQueryArgs(args []string) (eventType string, params url.Values, err error) {
+	if len(args) > 0 && !strings.Contains(args[0], "=") {
+		eventType, args = args[0], args[1:]
+	}
+	params = url.Values{}
+	for _, arg := range args {
+		name, value, ok := strings.Cut(arg, "=")
+		if !ok || name == "" {
+			return "", nil, fmt.Errorf("expected filters as name=value, got %q", arg)
+		}
+		params.Add(name, value)
+	}
+	return eventType, params, nil
+}
+
+// printRecords prints items one per line in the text format, as documents
+// with -output json or yaml, and as tailRows with -output table.
+func printRecords(items []WebhookParams, stdout io.Writer) error {
+	out := &outputPrinter{w: stdout}
+	if outputFormat == outputTable {
+		rows := make([]tailRow, len(items))
+		for i, item := range items {
+			rows[i] = tailRow{item.Sequence, item.ReceivedAt, item.EventType, item.StatusCode, item.ID}
+		}
+		return out.Print(rows, nil)
+	}
+	for _, item := range items {
+		err := out.Print(item, func() error {
+			payload, _ := json.Marshal(item.Payload)
+			_, err := fmt.Fprintf(stdout, "%s %s %s %s\n", item.ReceivedAt.Format(time.RFC3339), item.ID, item.EventType, payload)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// replayCommand is "webhook-echo replay -to URL [event-type]
+// [name=value...]". It has the server re-send the records matching the
+// event type and /query parameters to URL, signed under -scheme, and
+// prints how each delivery was answered.
+func replayCommand(fs *flag.FlagSet) func(args []string, stdin io.Reader, stdout io.Writer) error {
+	server := fs.String("url", "http://localhost:8080", "Base URL of the webhook-echo server")
+	token := fs.String("admin-token", "", "Admin token of the server; defaults to the token of -remote")
+	var req ReplayRequest
+	fs.StringVar(&req.URL, "to", "", "URL to re-send the webhooks to")
+	fs.StringVar(&req.Scheme, "scheme", "hmac-sha256", "Signature scheme the webhooks are signed under")
+	fs.StringVar(&req.Secret, "secret", "", "Secret the webhooks are signed with")
+	fs.IntVar(&req.Limit, "limit", 0, "Re-send at most this many of the newest matches, 0 for all")
+	fs.StringVar(&req.Timestamp, "timestamp", "", `Timestamp presented to the consumer: "now", "received_at" or an offset such as -10m`)
+	fs.StringVar(&req.SignedAt, "signed-at", "", "Timestamp the signature covers, -timestamp by default")
+	return func(args []string, stdin io.Reader, stdout io.Writer) error {
+		if req.URL == "" {
+			return errors.New("-to is required")
+		}
+		client, err := newServerClient(*server, *token)
+		if err != nil {
+			return err
+		}
+		eventType, params, err := parseQueryArgs(args)
+		if err != nil {
+			return err
+		}
+		if eventType != "" {
+			params.Set("event_type", eventType)
+		}
+		if req.Match, err = json.Marshal(params); err != nil {
+			return err
+		}
+		var results []ReplayResult
+		if err := client.call(http.MethodPost, "/replay", req, &results); err != nil {
+			return err
+		}
+		return (&outputPrinter{w: stdout}).Print(results, func() error {
+			for _, r := range results {
+				outcome := r.Error
+				if outcome == "" {
+					outcome = fmt.Sprint(r.Status, " ", http.StatusText(r.Status))
+				}
+				if _, err := fmt.Fprintf(stdout, "%s %s %s\n", r.ID, r.Event, outcome); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}
+}
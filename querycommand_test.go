@@ -0,0 +1,48 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestQueryCommand(t *testing.T) {
+	mux := newTestServer()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	postWebhook(t, mux, `{"event":"order","data":{"id":"o-1"}}`)
+	postWebhook(t, mux, `{"event":"order","data":{"id":"o-2"}}`)
+
+	var out strings.Builder
+	if err := runSubcommand("query", []string{"-url", server.URL, "order"}, nil, &out); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 || !strings.HasSuffix(lines[0], `order {"id":"o-2"}`) {
+		t.Errorf("expected both records newest first, got %q", out.String())
+	}
+
+	out.Reset()
+	if err := runSubcommand("query", []string{"-url", server.URL, "-output", "table", "order", "id=o-1"}, nil, &out); err != nil {
+		t.Fatal(err)
+	}
+	if rows := strings.Split(strings.TrimSpace(out.String()), "\n"); len(rows) != 2 || !strings.HasPrefix(rows[0], "SEQUENCE") {
+		t.Errorf("expected a header and one row, got %q", out.String())
+	}
+
+	if err := runSubcommand("query", []string{"-url", server.URL, "order", "id"}, nil, &out); err == nil {
+		t.Error("expected a filter without a value refused")
+	}
+	if err := runSubcommand("query", []string{"-url", server.URL}, nil, &out); err == nil || !strings.Contains(err.Error(), "Event type is required") {
+		t.Errorf("expected the server's problem reported, got %v", err)
+	}
+}
+
+func TestReplayCommandNeedsTarget(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+	if err := runSubcommand("replay", []string{"-url", server.URL, "order"}, nil, &strings.Builder{}); err == nil {
+		t.Error("expected -to to be required")
+	}
+}
@@ -0,0 +1,300 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const codeQuotaExceeded = "quota_exceeded"
+
+// quotas limits ingest when configured; nil disables quota checks.
+var quotas *Quotas
+
+// QuotaLimits caps what a bucket may capture. Records and Bytes cap what the
+// buffer holds, so that evicted, expired and deleted records free their share
+// again. PerMinute is a sliding one-minute window. Zero means no limit.
+type QuotaLimits struct {
+	Records   int   `json:"records,omitempty"`
+	Bytes     int64 `json:"bytes,omitempty"`
+	PerMinute int   `json:"per_minute,omitempty"`
+}
+
+// parseQuotaLimits parses "records=1000,bytes=1048576,per_minute=60".
+func parseQuotaLimits(s string) (QuotaLimits, error) {
+	var l QuotaLimits
+	fields, err := parseLabels(s)
+	if err != nil {
+		return l, err
+	}
+	for key, value := range fields {
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || n < 0 {
+			return l, fmt.Errorf("quota %s must be a non-negative integer, got %q", key, value)
+		}
+		switch key {
+		case "records":
+			l.Records = int(n)
+		case "bytes":
+			l.Bytes = n
+		case "per_minute":
+			l.PerMinute = int(n)
+		default:
+			return l, fmt.Errorf("unknown quota %q, expected records, bytes or per_minute", key)
+		}
+	}
+	return l, nil
+}
+
+// quotaUsage is what a bucket holds in the buffer, with the raw bodies of
+// its records as Bytes, and when its recent requests were admitted.
+type quotaUsage struct {
+	Records int   `json:"records"`
+	Bytes   int64 `json:"bytes"`
+	recent  []time.Time
+}
+
+// QuotaDecision is the outcome of a quota check. Remaining and
+// RemainingBytes are -1 when unlimited.
+type QuotaDecision struct {
+	Allowed        bool
+	Reason         string
+	Remaining      int
+	RemainingBytes int64
+	RetryAfter     time.Duration
+}
+
+// Quotas enforces per-bucket limits, with the bucket taken from a request
+// header, and global limits over all buckets together. As an ingest hook it
+// counts the records stored per bucket, and Observe, as the buffer's
+// lifecycle hook, uncounts the ones dropped. Records are counted once
+// stored, so concurrent requests may overshoot a limit by a few records, and
+// a record put back with Restore is not counted again. Buckets holding no
+// record and without requests in the last minute are forgotten.
+type Quotas struct {
+	mu        sync.Mutex
+	header    string
+	bucket    QuotaLimits
+	global    QuotaLimits
+	buckets   map[string]*quotaUsage
+	total     quotaUsage
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+func NewQuotas(header string, bucket, global QuotaLimits) *Quotas {
+	return &Quotas{
+		header:  header,
+		bucket:  bucket,
+		global:  global,
+		buckets: make(map[string]*quotaUsage),
+		now:     time.Now,
+	}
+}
+
+// prune drops the requests that left the per-minute window.
+func (u *quotaUsage) prune(now time.Time) {
+	cutoff := now.Add(-time.Minute)
+	keep := 0
+	for keep < len(u.recent) && !u.recent[keep].After(cutoff) {
+		keep++
+	}
+	u.recent = u.recent[keep:]
+}
+
+// check evaluates usage u against l for a request of size bytes, pruning
+// the per-minute window as it goes.
+func (l QuotaLimits) check(u *quotaUsage, size int64, now time.Time, scope string) QuotaDecision {
+	d := QuotaDecision{Allowed: true, Remaining: -1, RemainingBytes: -1}
+	u.prune(now)
+
+	if l.Records > 0 {
+		d.Remaining = l.Records - u.Records
+		if d.Remaining <= 0 {
+			d.Allowed, d.Reason = false, fmt.Sprintf("%s record quota of %d exhausted", scope, l.Records)
+		}
+	}
+	if l.PerMinute > 0 {
+		left := l.PerMinute - len(u.recent)
+		if d.Remaining < 0 || left < d.Remaining {
+			d.Remaining = left
+		}
+		if left <= 0 && d.Allowed {
+			d.Allowed, d.Reason = false, fmt.Sprintf("%s rate of %d per minute exceeded", scope, l.PerMinute)
+			d.RetryAfter = u.recent[0].Add(time.Minute).Sub(now)
+		}
+	}
+	if l.Bytes > 0 {
+		d.RemainingBytes = l.Bytes - u.Bytes
+		if size > d.RemainingBytes && d.Allowed {
+			d.Allowed, d.Reason = false, fmt.Sprintf("%s byte quota of %d exhausted", scope, l.Bytes)
+		}
+	}
+	return d
+}
+
+// tighter combines two decisions, keeping the more restrictive figures.
+func (d QuotaDecision) tighter(o QuotaDecision) QuotaDecision {
+	if d.Allowed && !o.Allowed {
+		d.Allowed, d.Reason, d.RetryAfter = false, o.Reason, o.RetryAfter
+	}
+	if o.Remaining >= 0 && (d.Remaining < 0 || o.Remaining < d.Remaining) {
+		d.Remaining = o.Remaining
+	}
+	if o.RemainingBytes >= 0 && (d.RemainingBytes < 0 || o.RemainingBytes < d.RemainingBytes) {
+		d.RemainingBytes = o.RemainingBytes
+	}
+	return d
+}
+
+// Allow checks a request of size bytes for bucket against both the bucket
+// and global limits and, if allowed, counts it against the per-minute
+// window. The remaining figures in the decision account for the request.
+func (q *Quotas) Allow(bucket string, size int64) QuotaDecision {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	now := q.now()
+	q.sweep(now)
+	u := q.usage(bucket)
+	d := q.bucket.check(u, size, now, "Bucket").tighter(q.global.check(&q.total, size, now, "Global"))
+	if !d.Allowed {
+		return d
+	}
+
+	for _, usage := range []*quotaUsage{u, &q.total} {
+		usage.recent = append(usage.recent, now)
+	}
+	if d.Remaining > 0 {
+		d.Remaining--
+	}
+	if d.RemainingBytes >= 0 {
+		d.RemainingBytes -= size
+	}
+	return d
+}
+
+// usage returns the usage of bucket, starting it if need be. q.mu must be
+// held.
+func (q *Quotas) usage(bucket string) *quotaUsage {
+	u, ok := q.buckets[bucket]
+	if !ok {
+		u = &quotaUsage{}
+		q.buckets[bucket] = u
+	}
+	return u
+}
+
+// sweep forgets the buckets that hold no record and had no request in the
+// last minute, at most once a minute. q.mu must be held.
+func (q *Quotas) sweep(now time.Time) {
+	if now.Sub(q.lastSweep) < time.Minute {
+		return
+	}
+	for name, u := range q.buckets {
+		if u.prune(now); u.Records == 0 && len(u.recent) == 0 {
+			delete(q.buckets, name)
+		}
+	}
+	q.lastSweep = now
+}
+
+// OnIngest counts a stored record against the bucket it was sent to.
+func (q *Quotas) OnIngest(item WebhookParams, body []byte) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	size := int64(len(item.Raw))
+	for _, usage := range []*quotaUsage{q.usage(item.Headers.Get(q.header)), &q.total} {
+		usage.Records++
+		usage.Bytes += size
+	}
+}
+
+// Observe uncounts a record the buffer dropped. It is the buffer's
+// lifecycle hook.
+func (q *Quotas) Observe(kind string, item *WebhookParams) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	size := int64(len(item.Raw))
+	usages := []*quotaUsage{&q.total}
+	if u, ok := q.buckets[item.Headers.Get(q.header)]; ok {
+		usages = append(usages, u)
+	}
+	for _, usage := range usages {
+		usage.Records = max(usage.Records-1, 0)
+		usage.Bytes = max(usage.Bytes-size, 0)
+	}
+}
+
+// Bucket returns the bucket a request is counted against.
+func (q *Quotas) Bucket(r *http.Request) string {
+	return r.Header.Get(q.header)
+}
+
+// checkQuota applies the configured quotas to an ingest request, writing
+// the X-Quota-Remaining headers and, when over quota, a 429 problem. It
+// reports whether the request may proceed.
+func checkQuota(w http.ResponseWriter, r *http.Request, size int64) bool {
+	if quotas == nil {
+		return true
+	}
+	d := quotas.Allow(quotas.Bucket(r), size)
+	if d.Remaining >= 0 {
+		w.Header().Set("X-Quota-Remaining", strconv.Itoa(d.Remaining))
+	}
+	if d.RemainingBytes >= 0 {
+		w.Header().Set("X-Quota-Remaining-Bytes", strconv.FormatInt(d.RemainingBytes, 10))
+	}
+	if d.Allowed {
+		return true
+	}
+	if d.RetryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int((d.RetryAfter+time.Second-1)/time.Second)))
+	}
+	writeProblem(w, r, http.StatusTooManyRequests, codeQuotaExceeded, d.Reason)
+	return false
+}
+
+type quotaReport struct {
+	Header  string        `json:"bucket_header"`
+	Bucket  QuotaLimits   `json:"bucket_limits"`
+	Global  QuotaLimits   `json:"global_limits"`
+	Total   quotaUsage    `json:"total"`
+	Buckets []bucketUsage `json:"buckets"`
+}
+
+type bucketUsage struct {
+	Name string `json:"name"`
+	quotaUsage
+	LastMinute int `json:"last_minute"`
+}
+
+func (q *Quotas) Report() quotaReport {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	cutoff := q.now().Add(-time.Minute)
+	report := quotaReport{Header: q.header, Bucket: q.bucket, Global: q.global, Total: q.total}
+	for name, u := range q.buckets {
+		usage := bucketUsage{Name: name, quotaUsage: *u}
+		for _, t := range u.recent {
+			if t.After(cutoff) {
+				usage.LastMinute++
+			}
+		}
+		report.Buckets = append(report.Buckets, usage)
+	}
+	sort.Slice(report.Buckets, func(i, j int) bool { return report.Buckets[i].Name < report.Buckets[j].Name })
+	return report
+}
+
+func quotasHandler(q *Quotas) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(q.Report())
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func withQuotas(t *testing.T, q *Quotas) {
+	t.Helper()
+	quotas = q
+	t.Cleanup(func() { quotas = nil })
+}
+
+// newQuotaTestServer serves buffer with q counting what it holds.
+func newQuotaTestServer(t *testing.T, buffer *RingBuffer, q *Quotas) *http.ServeMux {
+	t.Helper()
+	withQuotas(t, q)
+	buffer.AddLifecycleHook(q.Observe)
+	mux := http.NewServeMux()
+	registerRoutes(mux, buffer, "secret", q)
+	return mux
+}
+
+func postToBucket(t *testing.T, mux *http.ServeMux, bucket, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString(body))
+	req.Header.Set("X-Echo-Bucket", bucket)
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestParseQuotaLimits(t *testing.T) {
+	l, err := parseQuotaLimits("records=10, bytes=2048,per_minute=5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l != (QuotaLimits{Records: 10, Bytes: 2048, PerMinute: 5}) {
+		t.Errorf("unexpected limits %+v", l)
+	}
+	for _, bad := range []string{"records=-1", "records=many", "seats=3"} {
+		if _, err := parseQuotaLimits(bad); err == nil {
+			t.Errorf("expected %q to be rejected", bad)
+		}
+	}
+}
+
+func TestBucketRecordQuota(t *testing.T) {
+	mux := newQuotaTestServer(t, NewRingBuffer(100), NewQuotas("X-Echo-Bucket", QuotaLimits{Records: 2}, QuotaLimits{}))
+	body := `{"event":"e","data":{},"version":"1"}`
+
+	for want := 1; want >= 0; want-- {
+		rec := postToBucket(t, mux, "a", body)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d", rec.Code)
+		}
+		if got := rec.Header().Get("X-Quota-Remaining"); got != strconv.Itoa(want) {
+			t.Errorf("expected X-Quota-Remaining %d, got %q", want, got)
+		}
+	}
+
+	rec := postToBucket(t, mux, "a", body)
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected status 429, got %d", rec.Code)
+	}
+	if p := decodeProblem(t, rec); p.Code != codeQuotaExceeded {
+		t.Errorf("expected code %s, got %s", codeQuotaExceeded, p.Code)
+	}
+
+	// Other buckets are unaffected.
+	if rec := postToBucket(t, mux, "b", body); rec.Code != http.StatusOK {
+		t.Errorf("expected another bucket to be accepted, got %d", rec.Code)
+	}
+	if got := queryWebhooks(t, mux, "/query/e"); len(got) != 3 {
+		t.Errorf("expected 3 recorded webhooks, got %d", len(got))
+	}
+}
+
+func TestGlobalByteQuota(t *testing.T) {
+	mux := newQuotaTestServer(t, NewRingBuffer(100), NewQuotas("X-Echo-Bucket", QuotaLimits{}, QuotaLimits{Bytes: 80}))
+	body := `{"event":"e","data":{},"version":"1"}` // 37 bytes
+
+	postToBucket(t, mux, "a", body)
+	rec := postToBucket(t, mux, "b", body)
+	if rec.Code != http.StatusOK || rec.Header().Get("X-Quota-Remaining-Bytes") != "6" {
+		t.Fatalf("expected 6 bytes left, got %d %q", rec.Code, rec.Header().Get("X-Quota-Remaining-Bytes"))
+	}
+	if rec := postToBucket(t, mux, "c", body); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("expected the global byte quota to be exhausted, got %d", rec.Code)
+	}
+}
+
+func TestPerMinuteQuota(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	q := NewQuotas("X-Echo-Bucket", QuotaLimits{PerMinute: 2}, QuotaLimits{})
+	q.now = func() time.Time { return now }
+
+	q.Allow("a", 1)
+	now = now.Add(20 * time.Second)
+	q.Allow("a", 1)
+
+	d := q.Allow("a", 1)
+	if d.Allowed {
+		t.Fatal("expected the third request within a minute to be refused")
+	}
+	if d.RetryAfter != 40*time.Second {
+		t.Errorf("expected retry after 40s, got %s", d.RetryAfter)
+	}
+
+	now = now.Add(41 * time.Second)
+	if d := q.Allow("a", 1); !d.Allowed || d.Remaining != 0 {
+		t.Errorf("expected a slot once the oldest request left the window, got %+v", d)
+	}
+}
+
+func TestRecordQuotaFreedByEviction(t *testing.T) {
+	buffer := NewRingBuffer(2)
+	mux := newQuotaTestServer(t, buffer, NewQuotas("X-Echo-Bucket", QuotaLimits{Records: 2}, QuotaLimits{}))
+	body := `{"event":"e","data":{},"version":"1"}`
+
+	postToBucket(t, mux, "a", body)
+	postToBucket(t, mux, "a", body)
+	if rec := postToBucket(t, mux, "a", body); rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected the bucket to be full, got %d", rec.Code)
+	}
+	// Another bucket's records evict a's, which frees a's quota.
+	postToBucket(t, mux, "b", body)
+	if rec := postToBucket(t, mux, "a", body); rec.Code != http.StatusOK {
+		t.Errorf("expected an evicted record to free its share, got %d", rec.Code)
+	}
+
+	buffer.Clear()
+	if report := quotas.Report(); report.Total.Records != 0 || report.Total.Bytes != 0 {
+		t.Errorf("expected nothing counted once cleared, got %+v", report.Total)
+	}
+}
+
+func TestIdleBucketsForgotten(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	q := NewQuotas("X-Echo-Bucket", QuotaLimits{PerMinute: 2}, QuotaLimits{})
+	q.now = func() time.Time { return now }
+	q.Allow("a", 1)
+	q.Allow("b", 1)
+	q.OnIngest(WebhookParams{Headers: http.Header{"X-Echo-Bucket": {"b"}}}, nil)
+
+	now = now.Add(2 * time.Minute)
+	q.Allow("c", 1)
+	if report := q.Report(); len(report.Buckets) != 2 || report.Buckets[0].Name != "b" || report.Buckets[1].Name != "c" {
+		t.Errorf("expected only the idle bucket a forgotten, got %+v", report.Buckets)
+	}
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const codeRateLimited = "rate_limited"
+
+// rateLimiter simulates a receiver's rate limit when configured with
+// -rate-limit; nil disables it.
+var rateLimiter *RateLimiter
+
+// RateLimitProfile is a token bucket: Burst deliveries at once, refilled at
+// Rate per second. With Key set, each value of that request header has its
+// own bucket.
+type RateLimitProfile struct {
+	Rate  float64 `json:"rate_per_second"`
+	Burst int     `json:"burst"`
+	Key   string  `json:"key_header,omitempty"`
+}
+
+var rateUnits = map[string]time.Duration{"s": time.Second, "m": time.Minute, "h": time.Hour}
+
+// parseRateLimit parses "rate=10/s,burst=20,key=X-Echo-Bucket", where the
+// rate is per s, m or h. The burst defaults to the rate's count.
+func parseRateLimit(s string) (RateLimitProfile, error) {
+	var p RateLimitProfile
+	count := 0
+	fields, err := parseLabels(s)
+	if err != nil {
+		return p, err
+	}
+	for key, value := range fields {
+		switch key {
+		case "rate":
+			number, unit, _ := strings.Cut(value, "/")
+			n, err := strconv.Atoi(number)
+			per, ok := rateUnits[unit]
+			if err != nil || n <= 0 || !ok {
+				return p, fmt.Errorf("rate must be a positive count per s, m or h, e.g. 10/s, got %q", value)
+			}
+			p.Rate, count = float64(n)/per.Seconds(), n
+		case "burst":
+			n, err := strconv.Atoi(value)
+			if err != nil || n <= 0 {
+				return p, fmt.Errorf("burst must be a positive integer, got %q", value)
+			}
+			p.Burst = n
+		case "key":
+			p.Key = value
+		default:
+			return p, fmt.Errorf("unknown rate limit %q, expected rate, burst or key", key)
+		}
+	}
+	if p.Rate == 0 {
+		return p, fmt.Errorf("rate is required")
+	}
+	if p.Burst == 0 {
+		p.Burst = count
+	}
+	return p, nil
+}
+
+type tokenBucket struct {
+	tokens  float64
+	last    time.Time
+	allowed int
+	limited int
+}
+
+// RateLimiter answers deliveries beyond its profile with 429 and the
+// Retry-After and X-RateLimit-* headers senders are expected to honor.
+type RateLimiter struct {
+	mu      sync.Mutex
+	profile RateLimitProfile
+	buckets map[string]*tokenBucket
+	now     func() time.Time
+}
+
+func NewRateLimiter(p RateLimitProfile) *RateLimiter {
+	return &RateLimiter{profile: p, buckets: make(map[string]*tokenBucket), now: time.Now}
+}
+
+// RateLimitDecision is the outcome of taking a token. Reset is how long
+// until the bucket is full again, RetryAfter until the next token.
+type RateLimitDecision struct {
+	Allowed    bool
+	Remaining  int
+	Reset      time.Duration
+	RetryAfter time.Duration
+}
+
+// Take takes a token from key's bucket, if there is one.
+func (rl *RateLimiter) Take(key string) RateLimitDecision {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	now := rl.now()
+	burst := float64(rl.profile.Burst)
+	b, ok := rl.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: burst, last: now}
+		rl.buckets[key] = b
+	}
+	b.tokens = math.Min(burst, b.tokens+now.Sub(b.last).Seconds()*rl.profile.Rate)
+	b.last = now
+
+	var d RateLimitDecision
+	if b.tokens >= 1 {
+		b.tokens--
+		b.allowed++
+		d.Allowed = true
+	} else {
+		b.limited++
+		d.RetryAfter = rl.refill(1 - b.tokens)
+	}
+	d.Remaining = int(b.tokens)
+	d.Reset = rl.refill(burst - b.tokens)
+	return d
+}
+
+// refill is how long the bucket takes to gain tokens.
+func (rl *RateLimiter) refill(tokens float64) time.Duration {
+	return time.Duration(tokens / rl.profile.Rate * float64(time.Second))
+}
+
+// Bucket returns the bucket a request takes its token from.
+func (rl *RateLimiter) Bucket(r *http.Request) string {
+	if rl.profile.Key == "" {
+		return ""
+	}
+	return r.Header.Get(rl.profile.Key)
+}
+
+// checkRateLimit applies the rate limit profile to an ingest request,
+// writing the X-RateLimit-* headers and, when limited, a 429 problem with
+// Retry-After. It reports whether the request may proceed.
+func checkRateLimit(w http.ResponseWriter, r *http.Request) bool {
+	if rateLimiter == nil {
+		return true
+	}
+	d := rateLimiter.Take(rateLimiter.Bucket(r))
+	h := w.Header()
+	h.Set("X-RateLimit-Limit", strconv.Itoa(rateLimiter.profile.Burst))
+	h.Set("X-RateLimit-Remaining", strconv.Itoa(d.Remaining))
+	h.Set("X-RateLimit-Reset", strconv.FormatInt(rateLimiter.now().Add(d.Reset).Unix(), 10))
+	if d.Allowed {
+		return true
+	}
+	h.Set("Retry-After", strconv.Itoa(int((d.RetryAfter+time.Second-1)/time.Second)))
+	writeProblem(w, r, http.StatusTooManyRequests, codeRateLimited,
+		fmt.Sprintf("Rate limit of %d deliveries exceeded, retry after %s", rateLimiter.profile.Burst, d.RetryAfter.Round(time.Millisecond)))
+	return false
+}
+
+type rateLimitReport struct {
+	Profile RateLimitProfile    `json:"profile"`
+	Buckets []rateLimitedBucket `json:"buckets"`
+}
+
+type rateLimitedBucket struct {
+	Name    string `json:"name"`
+	Tokens  int    `json:"tokens"`
+	Allowed int    `json:"allowed"`
+	Limited int    `json:"limited"`
+}
+
+// Report lists each bucket's tokens as of now, and how many deliveries it
+// let through and limited.
+func (rl *RateLimiter) Report() rateLimitReport {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	now := rl.now()
+	report := rateLimitReport{Profile: rl.profile, Buckets: []rateLimitedBucket{}}
+	for name, b := range rl.buckets {
+		tokens := math.Min(float64(rl.profile.Burst), b.tokens+now.Sub(b.last).Seconds()*rl.profile.Rate)
+		report.Buckets = append(report.Buckets, rateLimitedBucket{Name: name, Tokens: int(tokens), Allowed: b.allowed, Limited: b.limited})
+	}
+	sort.Slice(report.Buckets, func(i, j int) bool { return report.Buckets[i].Name < report.Buckets[j].Name })
+	return report
+}
+
+func rateLimitHandler(rl *RateLimiter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(rl.Report())
+	}
+}
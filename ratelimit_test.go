@@ -0,0 +1,78 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestParseRateLimit(t *testing.T) {
+	p, err := parseRateLimit("rate=120/m,key=X-Echo-Bucket")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p != (RateLimitProfile{Rate: 2, Burst: 120, Key: "X-Echo-Bucket"}) {
+		t.Errorf("unexpected profile %+v", p)
+	}
+	if p, _ := parseRateLimit("burst=3,rate=10/s"); p.Burst != 3 {
+		t.Errorf("expected the explicit burst, got %+v", p)
+	}
+	for _, bad := range []string{"", "burst=3", "rate=10/d", "rate=0/s", "rate=1/s,burst=-1", "rate=1/s,window=1"} {
+		if _, err := parseRateLimit(bad); err == nil {
+			t.Errorf("expected %q to be rejected", bad)
+		}
+	}
+}
+
+func TestRateLimitTokenBucket(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	rl := NewRateLimiter(RateLimitProfile{Rate: 1, Burst: 2, Key: "X-Echo-Bucket"})
+	rl.now = func() time.Time { return now }
+	rateLimiter = rl
+	t.Cleanup(func() { rateLimiter = nil })
+	mux := newTestServer()
+	body := `{"event":"limited"}`
+
+	for want := 1; want >= 0; want-- {
+		rec := postToBucket(t, mux, "a", body)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d", rec.Code)
+		}
+		if got := rec.Header().Get("X-RateLimit-Remaining"); got != strconv.Itoa(want) {
+			t.Errorf("expected X-RateLimit-Remaining %d, got %q", want, got)
+		}
+		if got := rec.Header().Get("X-RateLimit-Limit"); got != "2" {
+			t.Errorf("expected X-RateLimit-Limit 2, got %q", got)
+		}
+	}
+
+	rec := postToBucket(t, mux, "a", body)
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected status 429, got %d", rec.Code)
+	}
+	if p := decodeProblem(t, rec); p.Code != codeRateLimited {
+		t.Errorf("expected code %s, got %s", codeRateLimited, p.Code)
+	}
+	if got := rec.Header().Get("Retry-After"); got != "1" {
+		t.Errorf("expected Retry-After 1, got %q", got)
+	}
+	if got := rec.Header().Get("X-RateLimit-Reset"); got != strconv.FormatInt(now.Unix()+2, 10) {
+		t.Errorf("expected the bucket full in 2s, got reset %q", got)
+	}
+	if rec := postToBucket(t, mux, "b", body); rec.Code != http.StatusOK {
+		t.Errorf("expected another bucket to be accepted, got %d", rec.Code)
+	}
+
+	now = now.Add(time.Second)
+	if rec := postToBucket(t, mux, "a", body); rec.Code != http.StatusOK {
+		t.Errorf("expected a refilled token after a second, got %d", rec.Code)
+	}
+	report := rl.Report()
+	if len(report.Buckets) != 2 || report.Buckets[0].Allowed != 3 || report.Buckets[0].Limited != 1 {
+		t.Errorf("unexpected report %+v", report)
+	}
+	if got := queryWebhooks(t, mux, "/query/limited"); len(got) != 4 {
+		t.Errorf("expected 4 recorded webhooks, got %d", len(got))
+	}
+}
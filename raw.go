@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// Get returns the stored webhook with the given id.
+func (rb *RingBuffer) Get(id string) (WebhookParams, bool) {
+	rb.mu.RLock()
+	defer rb.mu.RUnlock()
+
+	if idx, ok := rb.find(id); ok {
+		return *rb.at(idx), true
+	}
+	return WebhookParams{}, false
+}
+
+func getWebhookHandler(buffer *RingBuffer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		item, ok := buffer.Get(r.PathValue("id"))
+		if !ok {
+			writeProblem(w, r, http.StatusNotFound, codeNotFound, "No webhook with id "+r.PathValue("id"))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(item)
+	}
+}
+
+// rawWebhookHandler serves the body of a webhook as it was received. Without
+// a view it is returned as is under its original content type; view=hex
+// gives a hex dump, view=base64 the base64 encoding, view=utf8 the text
+// with invalid sequences replaced by U+FFFD and view=ordered a JSON body
+// with its key order and duplicate keys intact, see OrderedBody.
+func rawWebhookHandler(buffer *RingBuffer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		item, ok := buffer.Get(r.PathValue("id"))
+		if !ok {
+			writeProblem(w, r, http.StatusNotFound, codeNotFound, "No webhook with id "+r.PathValue("id"))
+			return
+		}
+
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		switch view := r.URL.Query().Get("view"); view {
+		case "":
+			contentType := item.ContentType
+			if contentType == "" {
+				contentType = "application/octet-stream"
+			}
+			w.Header().Set("Content-Type", contentType)
+			w.Write(item.Raw)
+		case "hex":
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			w.Write([]byte(hex.Dump(item.Raw)))
+		case "base64":
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			w.Write([]byte(base64.StdEncoding.EncodeToString(item.Raw)))
+		case "utf8":
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			w.Write([]byte(strings.ToValidUTF8(string(item.Raw), "�")))
+		case "ordered":
+			body, _, err := normalizeBody(item.Raw, item.ContentType)
+			if err != nil {
+				writeProblem(w, r, http.StatusBadRequest, codeUnreadableBody, "Failed to decode body: "+err.Error())
+				return
+			}
+			ob, err := orderedJSON(body)
+			if err != nil {
+				writeProblem(w, r, http.StatusBadRequest, codeInvalidJSON, "Body is not JSON: "+err.Error())
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(ob)
+		default:
+			writeProblem(w, r, http.StatusBadRequest, codeInvalidParameter,
+				"Unknown view "+view+", expected hex, base64, utf8 or ordered")
+		}
+	}
+}
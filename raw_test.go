@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func getRaw(t *testing.T, mux *http.ServeMux, path string) *httptest.ResponseRecorder {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	return rec
+}
+
+func TestRawViews(t *testing.T) {
+	mux := newTestServer()
+	body := "{\"event\":\"bin\",\"data\":{\"b\":\"\xff\"}}"
+	req := httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/vnd.test+json")
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	id := rec.Header().Get("X-Echo-Id")
+
+	raw := getRaw(t, mux, "/v1/webhooks/"+id+"/raw")
+	if raw.Body.String() != body || raw.Header().Get("Content-Type") != "application/vnd.test+json" {
+		t.Errorf("expected the body verbatim under its content type, got %q %q", raw.Header().Get("Content-Type"), raw.Body.String())
+	}
+
+	tests := map[string]string{
+		"hex":    "7b 22 65 76",
+		"base64": "eyJldmVudCI6ImJpbiIsImRhdGEiOnsiYiI6Iv8ifX0=",
+		"utf8":   `"b":"�"`,
+	}
+	for view, want := range tests {
+		got := getRaw(t, mux, "/v1/webhooks/"+id+"/raw?view="+view)
+		if got.Code != http.StatusOK || !strings.Contains(got.Body.String(), want) {
+			t.Errorf("view=%s: expected %q in %d %q", view, want, got.Code, got.Body.String())
+		}
+	}
+
+	if got := getRaw(t, mux, "/v1/webhooks/"+id+"/raw?view=octal"); got.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400 for an unknown view, got %d", got.Code)
+	}
+}
+
+func TestGetWebhook(t *testing.T) {
+	mux := newTestServer()
+	id := postWebhook(t, mux, `{"event":"order","data":{}}`).Header().Get("X-Echo-Id")
+
+	if rec := getRaw(t, mux, "/v1/webhooks/"+id); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), id) {
+		t.Errorf("expected the record, got %d %q", rec.Code, rec.Body.String())
+	}
+	if rec := getRaw(t, mux, "/v1/webhooks/nope/raw"); rec.Code != http.StatusNotFound {
+		t.Errorf("expected status 404 for an unknown id, got %d", rec.Code)
+	}
+}
+
+func TestRawOrderedView(t *testing.T) {
+	mux := newTestServer()
+	rec := postWebhook(t, mux, `{"event":"dup","data":{"z":1,"a":[{"k":1,"k":2.50}],"z":3}}`)
+	id := rec.Header().Get("X-Echo-Id")
+
+	got := getRaw(t, mux, "/v1/webhooks/"+id+"/raw?view=ordered")
+	if got.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", got.Code, got.Body)
+	}
+	want := `{"body":[{"key":"event","value":"dup"},{"key":"data","value":[{"key":"z","value":1},` +
+		`{"key":"a","value":[[{"key":"k","value":1},{"key":"k","value":2.50}]]},{"key":"z","value":3}]}],` +
+		`"duplicate_keys":["data.a.0.k","data.z"]}`
+	if strings.TrimSpace(got.Body.String()) != want {
+		t.Errorf("unexpected ordered view:\n got %s\nwant %s", got.Body, want)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`<order><id>1</id></order>`))
+	req.Header.Set("Content-Type", "application/xml")
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	if got := getRaw(t, mux, "/v1/webhooks/"+rec.Header().Get("X-Echo-Id")+"/raw?view=ordered"); got.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for a non-JSON body, got %d", got.Code)
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// redirectRules holds the ingest redirect rules when configured.
+var redirectRules *RedirectRules
+
+// redirectHopParam counts the hops of a redirect rule with Hops set.
+const redirectHopParam = "redirect_hop"
+
+// RedirectRule answers matching webhooks with a redirect, to see how a
+// sender handles an endpoint that moved. It matches as a drop rule does.
+// Location may be relative, absolute or on another host, with {path}
+// replaced by the request path. With Loop set the request is redirected to
+// itself forever, and with Hops set it is redirected back to its own path
+// that many times before being accepted. Redirected webhooks are recorded
+// with the redirect's status.
+type RedirectRule struct {
+	DropRule
+	Status   int    `json:"status"`
+	Location string `json:"location,omitempty"`
+	Loop     bool   `json:"loop,omitempty"`
+	Hops     int    `json:"hops,omitempty"`
+}
+
+// LoadRedirectRules reads a JSON array of redirect rules from path.
+func LoadRedirectRules(path string) ([]RedirectRule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var rules []RedirectRule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return rules, nil
+}
+
+type redirectState struct {
+	*dropState
+	redirect   RedirectRule
+	redirected int
+}
+
+// RedirectRules decides which webhooks to redirect and counts them per rule.
+type RedirectRules struct {
+	mu    sync.Mutex
+	rules []*redirectState
+}
+
+func NewRedirectRules(rules []RedirectRule) (*RedirectRules, error) {
+	rr := &RedirectRules{}
+	for _, rule := range rules {
+		if rule.Name == "" {
+			return nil, errors.New("redirect rule without name")
+		}
+		switch rule.Status {
+		case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		default:
+			return nil, fmt.Errorf("redirect rule %s: status must be 301, 302, 303, 307 or 308, got %d", rule.Name, rule.Status)
+		}
+		targets := 0
+		for _, set := range []bool{rule.Location != "", rule.Loop, rule.Hops > 0} {
+			if set {
+				targets++
+			}
+		}
+		if targets != 1 || rule.Hops < 0 {
+			return nil, fmt.Errorf("redirect rule %s: needs exactly one of location, loop or a positive hops", rule.Name)
+		}
+		state, err := newDropState("redirect", rule.DropRule)
+		if err != nil {
+			return nil, err
+		}
+		rr.rules = append(rr.rules, &redirectState{dropState: state, redirect: rule})
+	}
+	return rr, nil
+}
+
+// Redirect returns the first rule matching the request and its parsed
+// webhook, and where to redirect it, counting the redirect. It returns
+// nil when the webhook is to be accepted.
+func (rr *RedirectRules) Redirect(r *http.Request, item WebhookParams) (*RedirectRule, string) {
+	for _, s := range rr.rules {
+		if !s.matches(r, item) {
+			continue
+		}
+		location, ok := s.redirect.location(r)
+		if !ok {
+			continue
+		}
+		rr.mu.Lock()
+		s.redirected++
+		rr.mu.Unlock()
+		return &s.redirect, location
+	}
+	return nil, ""
+}
+
+func (rule RedirectRule) location(r *http.Request) (string, bool) {
+	switch {
+	case rule.Loop:
+		return r.URL.RequestURI(), true
+	case rule.Hops > 0:
+		query := r.URL.Query()
+		hop, _ := strconv.Atoi(query.Get(redirectHopParam))
+		if hop >= rule.Hops {
+			return "", false
+		}
+		query.Set(redirectHopParam, strconv.Itoa(hop+1))
+		return (&url.URL{Path: r.URL.Path, RawQuery: query.Encode()}).RequestURI(), true
+	}
+	return strings.ReplaceAll(rule.Location, "{path}", r.URL.Path), true
+}
+
+// writeRedirect answers with the redirect as given, without resolving a
+// relative location, so that senders see exactly what the rule says.
+func writeRedirect(w http.ResponseWriter, rule *RedirectRule, location string) {
+	w.Header().Set("Location", location)
+	w.Header().Set("X-Echo-Redirected", rule.Name)
+	w.WriteHeader(rule.Status)
+}
+
+type RedirectRuleStatus struct {
+	RedirectRule
+	Redirected int `json:"redirected"`
+}
+
+func (rr *RedirectRules) Report() []RedirectRuleStatus {
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+
+	report := make([]RedirectRuleStatus, 0, len(rr.rules))
+	for _, s := range rr.rules {
+		report = append(report, RedirectRuleStatus{RedirectRule: s.redirect, Redirected: s.redirected})
+	}
+	return report
+}
+
+func redirectRulesHandler(rr *RedirectRules) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(rr.Report())
+	}
+}
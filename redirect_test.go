@@ -0,0 +1,70 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRedirectRules(t *testing.T) {
+	rules, err := NewRedirectRules([]RedirectRule{
+		{DropRule: DropRule{Name: "moved", Path: "/old/*"}, Status: http.StatusPermanentRedirect, Location: "https://new.example.com{path}"},
+		{DropRule: DropRule{Name: "relative", Path: "/rel"}, Status: http.StatusFound, Location: "rel-moved"},
+		{DropRule: DropRule{Name: "loop", Path: "/loop"}, Status: http.StatusTemporaryRedirect, Loop: true},
+		{DropRule: DropRule{Name: "hops", EventType: "hop"}, Status: http.StatusMovedPermanently, Hops: 2},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	redirectRules = rules
+	t.Cleanup(func() { redirectRules = nil })
+	mux := newTestServer()
+
+	post := func(target, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, target, strings.NewReader(body)))
+		return rec
+	}
+	for _, tt := range []struct {
+		target, body string
+		status       int
+		location     string
+	}{
+		{"/old/hooks", `{"event":"moved"}`, http.StatusPermanentRedirect, "https://new.example.com/old/hooks"},
+		{"/rel", `{"event":"moved"}`, http.StatusFound, "rel-moved"},
+		{"/loop?x=1", `{"event":"moved"}`, http.StatusTemporaryRedirect, "/loop?x=1"},
+		{"/hooks", `{"event":"hop"}`, http.StatusMovedPermanently, "/hooks?redirect_hop=1"},
+		{"/hooks?redirect_hop=1", `{"event":"hop"}`, http.StatusMovedPermanently, "/hooks?redirect_hop=2"},
+		{"/hooks?redirect_hop=2", `{"event":"hop"}`, http.StatusOK, ""},
+		{"/new", `{"event":"moved"}`, http.StatusOK, ""},
+	} {
+		rec := post(tt.target, tt.body)
+		if rec.Code != tt.status || rec.Header().Get("Location") != tt.location {
+			t.Errorf("%s: got %d to %q, want %d to %q", tt.target, rec.Code, rec.Header().Get("Location"), tt.status, tt.location)
+		}
+	}
+
+	items := queryWebhooks(t, mux, "/query?status_code=3xx")
+	if len(items) != 5 {
+		t.Errorf("expected 5 redirected records, got %d", len(items))
+	}
+	report := rules.Report()
+	if report[3].Redirected != 2 {
+		t.Errorf("expected 2 hop redirects, got %+v", report[3])
+	}
+}
+
+func TestNewRedirectRulesRejectsInvalid(t *testing.T) {
+	for _, rule := range []RedirectRule{
+		{Status: http.StatusFound, Loop: true},
+		{DropRule: DropRule{Name: "status"}, Status: http.StatusOK, Loop: true},
+		{DropRule: DropRule{Name: "none"}, Status: http.StatusFound},
+		{DropRule: DropRule{Name: "both"}, Status: http.StatusFound, Loop: true, Location: "/x"},
+		{DropRule: DropRule{Name: "pattern", Path: "["}, Status: http.StatusFound, Loop: true},
+	} {
+		if _, err := NewRedirectRules([]RedirectRule{rule}); err == nil {
+			t.Errorf("rule %+v accepted", rule)
+		}
+	}
+}
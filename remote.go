@@ -0,0 +1,240 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// remoteName is the server chosen with -remote, which every subcommand
+// takes. Those that talk to a server use it instead of -url.
+var remoteName string
+
+// Remote is a capture instance saved with "webhook-echo remote add". Token
+// is sent as the bearer token of its admin API; it may be a secret
+// reference such as file:PATH, resolved whenever it is used, to keep the
+// token itself out of the remotes file.
+type Remote struct {
+	Name  string `json:"name"`
+	URL   string `json:"url"`
+	Token string `json:"token,omitempty"`
+}
+
+// remotesPath is where the remotes are saved, in the user's configuration
+// directory.
+func remotesPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "webhook-echo", "remotes.json"), nil
+}
+
+func loadRemotes() ([]Remote, error) {
+	path, err := remotesPath()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var remotes []Remote
+	if err := json.Unmarshal(data, &remotes); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return remotes, nil
+}
+
+// saveRemotes writes remotes readable by the user only, as they hold
+// tokens, replacing the file in one step.
+func saveRemotes(remotes []Remote) error {
+	path, err := remotesPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(remotes, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// remoteCommand is "webhook-echo remote add NAME URL [-token TOKEN]",
+// "remote remove NAME" or "remote list". The saved remotes can then be
+// chosen by name with -remote on any subcommand.
+func remoteCommand(fs *flag.FlagSet) func(args []string, stdin io.Reader, stdout io.Writer) error {
+	token := fs.String("token", "", "Admin token of the remote, or file:PATH or vault:PATH#FIELD to load it when used")
+	return func(args []string, stdin io.Reader, stdout io.Writer) error {
+		if len(args) == 0 {
+			return errors.New("expected add, remove or list")
+		}
+		remotes, err := loadRemotes()
+		if err != nil {
+			return err
+		}
+		switch action, args := args[0], args[1:]; action {
+		case "add":
+			if len(args) != 2 {
+				return errors.New("expected a name and a URL")
+			}
+			name, server := args[0], strings.TrimRight(args[1], "/")
+			if u, err := url.Parse(server); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return fmt.Errorf("invalid URL %q, expected an http or https URL", args[1])
+			}
+			if slices.ContainsFunc(remotes, func(r Remote) bool { return r.Name == name }) {
+				return fmt.Errorf("remote %s already exists", name)
+			}
+			return saveRemotes(append(remotes, Remote{Name: name, URL: server, Token: *token}))
+		case "remove", "rm":
+			if len(args) != 1 {
+				return errors.New("expected a name")
+			}
+			i := slices.IndexFunc(remotes, func(r Remote) bool { return r.Name == args[0] })
+			if i < 0 {
+				return fmt.Errorf("no remote named %s", args[0])
+			}
+			return saveRemotes(slices.Delete(remotes, i, i+1))
+		case "list", "ls":
+			return listRemotes(remotes, stdout)
+		default:
+			return fmt.Errorf("unknown action %q, expected add, remove or list", action)
+		}
+	}
+}
+
+// remoteRow is the -output form of a remote, showing only whether it has a
+// token unless the token is a reference.
+type remoteRow struct {
+	Name  string `json:"name"`
+	URL   string `json:"url"`
+	Token string `json:"token,omitempty"`
+}
+
+func listRemotes(remotes []Remote, stdout io.Writer) error {
+	rows := make([]remoteRow, len(remotes))
+	for i, r := range remotes {
+		rows[i] = remoteRow{Name: r.Name, URL: r.URL, Token: r.Token}
+		if r.Token != "" && !isSecretRef(r.Token) {
+			rows[i].Token = "(set)"
+		}
+	}
+	return (&outputPrinter{w: stdout}).Print(rows, func() error {
+		for _, r := range rows {
+			line := r.Name + "\t" + r.URL
+			if r.Token != "" {
+				line += "\ttoken " + r.Token
+			}
+			if _, err := fmt.Fprintln(stdout, line); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// serverClient talks to the API of the server a subcommand works against.
+type serverClient struct {
+	base  string
+	token string
+}
+
+// newServerClient returns a client for the remote chosen with -remote, or
+// else for the server at base with token.
+func newServerClient(base, token string) (*serverClient, error) {
+	if remoteName != "" {
+		remotes, err := loadRemotes()
+		if err != nil {
+			return nil, err
+		}
+		i := slices.IndexFunc(remotes, func(r Remote) bool { return r.Name == remoteName })
+		if i < 0 {
+			return nil, fmt.Errorf("no remote named %s, see webhook-echo remote list", remoteName)
+		}
+		base = remotes[i].URL
+		if token == "" {
+			token = remotes[i].Token
+		}
+	}
+	return &serverClient{base: strings.TrimRight(base, "/"), token: token}, nil
+}
+
+// api returns the URL of the versioned API route path.
+func (c *serverClient) api(path string) string {
+	return c.base + "/v" + apiVersion + path
+}
+
+// do sends a request to the API route path, with body as JSON if set, and
+// fails unless it is answered with 200 OK.
+func (c *serverClient) do(method, path string, body any) (*http.Response, error) {
+	var r io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		r = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, c.api(path), r)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token := currentSecret(c.token); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		var problem Problem
+		if json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&problem) == nil && problem.Detail != "" {
+			return nil, fmt.Errorf("%s %s: %s: %s", method, req.URL, resp.Status, problem.Detail)
+		}
+		return nil, fmt.Errorf("%s %s: %s", method, req.URL, resp.Status)
+	}
+	return resp, nil
+}
+
+// get returns the body of the API route path.
+func (c *serverClient) get(path string) ([]byte, error) {
+	resp, err := c.do(http.MethodGet, path, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return io.ReadAll(resp.Body)
+}
+
+// call sends body to the API route path and decodes the JSON answer into v.
+func (c *serverClient) call(method, path string, body, v any) error {
+	resp, err := c.do(method, path, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return json.NewDecoder(resp.Body).Decode(v)
+}
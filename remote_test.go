@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+// useTempRemotes keeps the remotes of a test in a temporary configuration
+// directory.
+func useTempRemotes(t *testing.T) {
+	t.Helper()
+	dir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", dir)
+	t.Setenv("HOME", dir)
+}
+
+func TestRemoteAddListRemove(t *testing.T) {
+	useTempRemotes(t)
+	var out strings.Builder
+	if err := runSubcommand("remote", []string{"add", "staging", "https://hooks.staging.internal/", "--token", "s3cret"}, nil, &out); err != nil {
+		t.Fatal(err)
+	}
+	if err := runSubcommand("remote", []string{"add", "-token", "file:/run/token", "prod", "https://hooks.example.com"}, nil, &out); err != nil {
+		t.Fatal(err)
+	}
+	if err := runSubcommand("remote", []string{"add", "staging", "https://elsewhere"}, nil, &out); err == nil {
+		t.Error("expected a duplicate name refused")
+	}
+	if err := runSubcommand("remote", []string{"add", "bad", "hooks.example.com"}, nil, &out); err == nil {
+		t.Error("expected a URL without a scheme refused")
+	}
+
+	path, _ := remotesPath()
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0o600 {
+		t.Errorf("expected the remotes file readable by the user only, got %v %v", info.Mode(), err)
+	}
+
+	out.Reset()
+	if err := runSubcommand("remote", []string{"list", "-output", "json"}, nil, &out); err != nil {
+		t.Fatal(err)
+	}
+	want := `[{"name":"staging","url":"https://hooks.staging.internal","token":"(set)"},{"name":"prod","url":"https://hooks.example.com","token":"file:/run/token"}]`
+	if strings.TrimSpace(out.String()) != want {
+		t.Errorf("unexpected list %s", out.String())
+	}
+
+	if err := runSubcommand("remote", []string{"remove", "staging"}, nil, &out); err != nil {
+		t.Fatal(err)
+	}
+	if err := runSubcommand("remote", []string{"remove", "staging"}, nil, &out); err == nil {
+		t.Error("expected removing a missing remote to fail")
+	}
+	if remotes, _ := loadRemotes(); len(remotes) != 1 || remotes[0].Name != "prod" {
+		t.Errorf("unexpected remotes %+v", remotes)
+	}
+}
+
+func TestSubcommandsUseRemote(t *testing.T) {
+	useTempRemotes(t)
+	buffer := NewRingBuffer(100)
+	mux := http.NewServeMux()
+	registerRoutes(mux, buffer, "secret")
+	handleAPI(mux, "POST /replay", requireAdmin("s3cret", replayHandler(buffer, http.DefaultClient)))
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	postWebhook(t, mux, `{"event":"order","data":{"id":"o-1","status":"paid"}}`)
+	postWebhook(t, mux, `{"event":"order","data":{"id":"o-2","status":"failed"}}`)
+
+	var received []map[string]any
+	consumer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		json.NewDecoder(r.Body).Decode(&body)
+		received = append(received, body)
+	}))
+	defer consumer.Close()
+
+	var out strings.Builder
+	if err := runSubcommand("remote", []string{"add", "local", server.URL, "-token", "s3cret"}, nil, &out); err != nil {
+		t.Fatal(err)
+	}
+
+	out.Reset()
+	if err := runSubcommand("query", []string{"--remote", "local", "order", "status=failed", "-output", "json"}, nil, &out); err != nil {
+		t.Fatal(err)
+	}
+	var item WebhookParams
+	if err := json.Unmarshal([]byte(out.String()), &item); err != nil || item.Payload["id"] != "o-2" {
+		t.Errorf("expected the failed order, got %s", out.String())
+	}
+
+	out.Reset()
+	if err := runSubcommand("replay", []string{"-remote", "local", "-to", consumer.URL, "order"}, nil, &out); err != nil {
+		t.Fatal(err)
+	}
+	if len(received) != 2 || !strings.Contains(out.String(), "order 200 OK") {
+		t.Errorf("expected both orders replayed, got %d: %s", len(received), out.String())
+	}
+
+	if err := runSubcommand("query", []string{"-remote", "missing", "order"}, nil, &out); err == nil || !strings.Contains(err.Error(), "no remote named missing") {
+		t.Errorf("expected an unknown remote refused, got %v", err)
+	}
+}
+
+func TestRunSubcommandInterspersedFlags(t *testing.T) {
+	var out strings.Builder
+	if err := runSubcommand("canonicalize", []string{"-", "-hash"}, strings.NewReader(`{"b":1,"a":2}`), &out); err != nil {
+		t.Fatal(err)
+	}
+	if len(strings.TrimSpace(out.String())) != 64 {
+		t.Errorf("expected -hash after the file to apply, got %q", out.String())
+	}
+	out.Reset()
+	if err := runSubcommand("canonicalize", []string{"--", "-hash"}, nil, &out); err == nil || !strings.Contains(err.Error(), "-hash") {
+		t.Errorf("expected -hash after -- to be a file name, got %v", err)
+	}
+}
+
+func TestRemoteOnlyOnServerSubcommands(t *testing.T) {
+	for name := range subcommands {
+		fs, _ := newSubcommandFlags(name)
+		if got := fs.Lookup("remote") != nil; got != serverSubcommands[name] {
+			t.Errorf("%s: expected -remote %v, got %v", name, serverSubcommands[name], got)
+		}
+	}
+	var out strings.Builder
+	if err := runSubcommand("install", []string{"-remote", "prod"}, nil, &out); err == nil {
+		t.Error("expected -remote refused by install")
+	}
+}
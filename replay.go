@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// replayTimeout bounds a single replayed delivery.
+const replayTimeout = 10 * time.Second
+
+// ReplayRequest re-sends the captured webhooks selected by Match (in /query
+// parameter syntax) to URL, signed under Scheme. The timestamps are chosen on
+// purpose so a consumer's replay protection can be exercised: Timestamp is
+// the one presented to the consumer and SignedAt the one the signature
+// covers. Each is "now", "received_at" or an offset from now such as "-10m";
+// SignedAt defaults to Timestamp. With Reverify, each record's signature is
+// checked again first, its verification result updated, and only the
+// records that now verify are replayed.
+type ReplayRequest struct {
+	URL       string          `json:"url"`
+	Match     json.RawMessage `json:"match"`
+	Limit     int             `json:"limit,omitempty"`
+	Scheme    string          `json:"scheme"`
+	Secret    string          `json:"secret"`
+	Timestamp string          `json:"timestamp,omitempty"`
+	SignedAt  string          `json:"signed_at,omitempty"`
+	Reverify  *Reverify       `json:"reverify,omitempty"`
+}
+
+// ReplayResult reports one replayed delivery.
+type ReplayResult struct {
+	ID         string    `json:"id"`
+	Event      string    `json:"event"`
+	ReceivedAt time.Time `json:"received_at"`
+	Timestamp  int64     `json:"timestamp"`
+	SignedAt   int64     `json:"signed_at"`
+	Status     int       `json:"status,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	// Verification is the record's new verification result, when the
+	// replay re-verified it.
+	Verification *Verification `json:"verification,omitempty"`
+}
+
+// replayTime resolves a ReplayRequest timestamp spec for item.
+func replayTime(spec string, item WebhookParams, now time.Time) (time.Time, error) {
+	switch spec {
+	case "", "now":
+		return now, nil
+	case "received_at":
+		return item.ReceivedAt, nil
+	}
+	offset, err := time.ParseDuration(spec)
+	if err != nil {
+		return time.Time{}, fmt.Errorf(`timestamp must be "now", "received_at" or a duration offset, got %q`, spec)
+	}
+	return now.Add(offset), nil
+}
+
+// checkReplayTarget validates where and how req replays to, returning its
+// signature scheme.
+func checkReplayTarget(req ReplayRequest, now time.Time) (SignatureScheme, error) {
+	if req.URL == "" {
+		return SignatureScheme{}, &paramError{codeMissingParameter, "Missing url"}
+	}
+	scheme, ok := signatureSchemes[req.Scheme]
+	if !ok {
+		return SignatureScheme{}, &paramError{codeInvalidParameter, fmt.Sprintf("Unknown scheme %q", req.Scheme)}
+	}
+	for _, spec := range []string{req.Timestamp, req.SignedAt} {
+		if _, err := replayTime(spec, WebhookParams{}, now); err != nil {
+			return SignatureScheme{}, &paramError{codeInvalidParameter, err.Error()}
+		}
+	}
+	return scheme, nil
+}
+
+// webhookBody renders item in the shape it was originally posted in, and
+// returns its content type. Bodies of a registered format, such as XML or
+// MessagePack, are sent as they arrived; JSON ones are re-encoded.
+func webhookBody(item WebhookParams) (body []byte, contentType string, err error) {
+	if lookupFormat(item.ContentType) != nil && len(item.Raw) > 0 {
+		body, err := decodedBody(item)
+		return body, item.ContentType, err
+	}
+	body, err = json.Marshal(struct {
+		EventType string         `json:"event"`
+		Payload   map[string]any `json:"data"`
+		Version   string         `json:"version"`
+	}{item.EventType, item.Payload, item.Version})
+	return body, "application/json", err
+}
+
+// signHeader signs body under scheme into h. The MAC covers signedTS but
+// the headers show the timestamp ts, as they would if an attacker refreshed
+// the timestamp of a captured request.
+func signHeader(h http.Header, scheme SignatureScheme, secret string, body []byte, ts, signedTS string) {
+	h.Set(scheme.header, scheme.format(scheme.MAC(secret, body, signedTS), ts))
+	if scheme.timestampHeader != "" {
+		h.Set(scheme.timestampHeader, ts)
+	}
+}
+
+func replayOne(ctx context.Context, client *http.Client, req ReplayRequest, scheme SignatureScheme, item WebhookParams, now time.Time) ReplayResult {
+	result := ReplayResult{ID: item.ID, Event: item.EventType, ReceivedAt: item.ReceivedAt}
+
+	// Both specs were validated by the handler.
+	presented, _ := replayTime(req.Timestamp, item, now)
+	signedAt := presented
+	if req.SignedAt != "" {
+		signedAt, _ = replayTime(req.SignedAt, item, now)
+	}
+	result.Timestamp, result.SignedAt = presented.Unix(), signedAt.Unix()
+
+	body, contentType, err := webhookBody(item)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	ts, signedTS := strconv.FormatInt(result.Timestamp, 10), strconv.FormatInt(result.SignedAt, 10)
+
+	ctx, cancel := context.WithTimeout(ctx, replayTimeout)
+	defer cancel()
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, req.URL, bytes.NewReader(body))
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	httpReq.Header.Set("Content-Type", contentType)
+	signHeader(httpReq.Header, scheme, req.Secret, body, ts, signedTS)
+	if item.IdempotencyKey != "" {
+		httpReq.Header.Set(idempotencyHeader, item.IdempotencyKey)
+	}
+
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	resp.Body.Close()
+	result.Status = resp.StatusCode
+	return result
+}
+
+// replayHandler serves POST /replay. Deliveries are made one at a time,
+// oldest first, and the response lists how the consumer answered each.
+func replayHandler(buffer *RingBuffer, client *http.Client) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req ReplayRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeProblem(w, r, http.StatusBadRequest, codeInvalidJSON, "Invalid JSON: "+err.Error())
+			return
+		}
+		now := time.Now()
+		scheme, err := checkReplayTarget(req, now)
+		if err != nil {
+			writeParamError(w, r, err)
+			return
+		}
+		reverifyScheme, err := checkReverify(req)
+		if err != nil {
+			writeParamError(w, r, err)
+			return
+		}
+
+		if len(req.Match) == 0 {
+			writeProblem(w, r, http.StatusBadRequest, codeMissingParameter, "Missing match")
+			return
+		}
+		params, err := decodeParams(req.Match)
+		if err != nil {
+			writeProblem(w, r, http.StatusBadRequest, codeInvalidParameter, "match: "+err.Error())
+			return
+		}
+		filter, err := parseQueryFilter(params, "")
+		if err != nil {
+			writeParamError(w, r, err)
+			return
+		}
+
+		ctx, cancel := scanContext(r)
+		items, truncated := buffer.Query(ctx, filter)
+		cancel()
+		if truncated {
+			writeProblem(w, r, http.StatusServiceUnavailable, codeQueryTimeout, "Selecting the records to replay took too long")
+			return
+		}
+		if req.Limit > 0 && len(items) > req.Limit {
+			items = items[:req.Limit]
+		}
+		results := make([]ReplayResult, 0, len(items))
+		for i := len(items) - 1; i >= 0; i-- {
+			results = append(results, replayRecord(r.Context(), client, buffer, req, scheme, reverifyScheme, items[i], now))
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(results)
+	}
+}
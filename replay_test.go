@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+type capturedDelivery struct {
+	header http.Header
+	body   []byte
+}
+
+// newReplayTarget records every request it receives and answers 401 to
+// deliveries whose Slack-style timestamp is older than five minutes.
+func newReplayTarget(t *testing.T) (*httptest.Server, func() []capturedDelivery) {
+	var mu sync.Mutex
+	var got []capturedDelivery
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		got = append(got, capturedDelivery{r.Header.Clone(), body})
+		mu.Unlock()
+		if ts, err := strconv.ParseInt(r.Header.Get("X-Slack-Request-Timestamp"), 10, 64); err == nil &&
+			time.Since(time.Unix(ts, 0)) > 5*time.Minute {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv, func() []capturedDelivery {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]capturedDelivery(nil), got...)
+	}
+}
+
+func postReplay(t *testing.T, buffer *RingBuffer, req ReplayRequest) (int, []ReplayResult) {
+	t.Helper()
+	body, _ := json.Marshal(req)
+	rec := httptest.NewRecorder()
+	replayHandler(buffer, http.DefaultClient)(rec, httptest.NewRequest(http.MethodPost, "/replay", bytes.NewReader(body)))
+
+	var results []ReplayResult
+	if rec.Code == http.StatusOK {
+		if err := json.NewDecoder(rec.Body).Decode(&results); err != nil {
+			t.Fatalf("decode response: %v", err)
+		}
+	}
+	return rec.Code, results
+}
+
+func replayBuffer() *RingBuffer {
+	buffer := NewRingBuffer(10)
+	old := time.Now().Add(-time.Hour).UTC()
+	buffer.Push(WebhookParams{EventType: "order.created", Payload: map[string]any{"id": "1"}, ReceivedAt: old, IdempotencyKey: "k1"})
+	buffer.Push(WebhookParams{EventType: "order.created", Payload: map[string]any{"id": "2"}, ReceivedAt: old})
+	buffer.Push(WebhookParams{EventType: "other", ReceivedAt: old})
+	return buffer
+}
+
+func TestReplayStaleTimestamp(t *testing.T) {
+	srv, deliveries := newReplayTarget(t)
+	code, results := postReplay(t, replayBuffer(), ReplayRequest{
+		URL:       srv.URL,
+		Match:     json.RawMessage(`{"event_type": "order.created"}`),
+		Scheme:    "slack",
+		Secret:    "s3cret",
+		Timestamp: "-10m",
+	})
+	if code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", code)
+	}
+	if len(results) != 2 {
+		t.Fatalf("expected 2 replays, got %d", len(results))
+	}
+	for _, res := range results {
+		if res.Status != http.StatusUnauthorized {
+			t.Errorf("expected the target to reject a stale delivery, got %+v", res)
+		}
+	}
+
+	got := deliveries()
+	// Oldest first.
+	var first map[string]any
+	json.Unmarshal(got[0].body, &first)
+	if first["data"].(map[string]any)["id"] != "1" {
+		t.Errorf("expected the oldest webhook first, got %s", got[0].body)
+	}
+	if got[0].header.Get(idempotencyHeader) != "k1" {
+		t.Errorf("expected the idempotency key to be replayed, got %q", got[0].header.Get(idempotencyHeader))
+	}
+
+	// The signature is valid for the stale timestamp it presents.
+	ts := got[0].header.Get("X-Slack-Request-Timestamp")
+	if !signatureSchemes["slack"].Verify("s3cret", got[0].body, ts, got[0].header.Get("X-Slack-Signature")) {
+		t.Error("expected the replayed signature to verify against the presented timestamp")
+	}
+}
+
+func TestReplayOldSignatureFreshTimestamp(t *testing.T) {
+	srv, deliveries := newReplayTarget(t)
+	_, results := postReplay(t, replayBuffer(), ReplayRequest{
+		URL:      srv.URL,
+		Match:    json.RawMessage(`{"event_type": "other"}`),
+		Scheme:   "stripe",
+		Secret:   "whsec_test",
+		SignedAt: "received_at",
+	})
+	if len(results) != 1 {
+		t.Fatalf("expected 1 replay, got %d", len(results))
+	}
+	if results[0].Timestamp-results[0].SignedAt < 3500 {
+		t.Errorf("expected the signature to predate the timestamp by an hour, got %+v", results[0])
+	}
+
+	d := deliveries()[0]
+	header := d.header.Get("Stripe-Signature")
+	s := signatureSchemes["stripe"]
+	if s.Verify("whsec_test", d.body, strconv.FormatInt(results[0].Timestamp, 10), header) {
+		t.Error("expected the old signature not to verify against the refreshed timestamp")
+	}
+	if !s.Verify("whsec_test", d.body, strconv.FormatInt(results[0].SignedAt, 10), header) {
+		t.Error("expected the signature to verify against the original timestamp")
+	}
+}
+
+func TestReplayValidation(t *testing.T) {
+	buffer := replayBuffer()
+	tests := map[string]ReplayRequest{
+		"missing url":    {Match: json.RawMessage(`{"event_type": "x"}`), Scheme: "github"},
+		"unknown scheme": {URL: "http://example.invalid", Match: json.RawMessage(`{"event_type": "x"}`), Scheme: "nope"},
+		"bad timestamp":  {URL: "http://example.invalid", Match: json.RawMessage(`{"event_type": "x"}`), Scheme: "github", Timestamp: "yesterday"},
+		"missing match":  {URL: "http://example.invalid", Scheme: "github"},
+	}
+	for name, req := range tests {
+		if code, _ := postReplay(t, buffer, req); code != http.StatusBadRequest {
+			t.Errorf("%s: expected status 400, got %d", name, code)
+		}
+	}
+}
+
+func TestReplaySendsRegisteredFormatsAsReceived(t *testing.T) {
+	body := []byte(`<webhook><event>order.created</event><data><id>1</id></data></webhook>`)
+	buffer := NewRingBuffer(10)
+	buffer.Push(WebhookParams{EventType: "order.created", Payload: map[string]any{"id": "1"}, ContentType: "application/xml", Raw: body})
+
+	target, deliveries := newReplayTarget(t)
+	if code, _ := postReplay(t, buffer, ReplayRequest{URL: target.URL, Match: json.RawMessage(`{"event_type":"order.created"}`), Scheme: "hmac-sha256", Secret: "s"}); code != http.StatusOK {
+		t.Fatalf("replay failed with %d", code)
+	}
+	got := deliveries()
+	if len(got) != 1 || !bytes.Equal(got[0].body, body) || got[0].header.Get("Content-Type") != "application/xml" {
+		t.Errorf("expected the XML body re-sent as received, got %+v", got)
+	}
+}
@@ -0,0 +1,302 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// reportTopSenders bounds how many senders the report lists.
+const reportTopSenders = 10
+
+// Report is a digest of the webhooks received within a period, built from
+// the records still in the buffer.
+type Report struct {
+	From  time.Time
+	To    time.Time
+	Total int
+	// Partial is set when records from the start of the period have already
+	// been evicted, or the scan ran out of time, so counts are lower bounds.
+	Partial       bool
+	EventTypes    []EventTypeVolume
+	NewEventTypes []string
+	SchemaChanges []SchemaChange
+	TopSenders    []SenderVolume
+}
+
+// EventTypeVolume counts the records of one event type. Errors are records
+// that failed signature verification.
+type EventTypeVolume struct {
+	EventType string
+	Count     int
+	Errors    int
+}
+
+func (v EventTypeVolume) ErrorRate() float64 {
+	if v.Count == 0 {
+		return 0
+	}
+	return float64(v.Errors) * 100 / float64(v.Count)
+}
+
+// SchemaChange is a payload field that first appeared, or first changed JSON
+// type, within the period, compared with earlier records of the same type.
+type SchemaChange struct {
+	EventType string
+	Field     string
+	Was       string // empty for a new field
+	Now       string
+	CaptureID string
+	SeenAt    time.Time
+}
+
+type SenderVolume struct {
+	Sender string
+	Count  int
+}
+
+// buildReport digests the records of s received in [from, to). Event types
+// count as new when idx first saw them within the period.
+func buildReport(ctx context.Context, s *Snapshot, idx *EventTypeIndex, from, to time.Time) Report {
+	report := Report{From: from, To: to}
+	volumes := make(map[string]*EventTypeVolume)
+	senders := make(map[string]int)
+	shapes := make(map[string]map[string]string) // event -> field -> JSON type
+	reported := make(map[string]bool)
+
+	for i := s.count - 1; i >= 0; i-- {
+		if (s.count-1-i)%scanCheckInterval == 0 && ctx.Err() != nil {
+			report.Partial = true
+			break
+		}
+		item := s.at(s.newest(i))
+		if i == s.count-1 && s.evicted > 0 && item.ReceivedAt.After(from) {
+			report.Partial = true
+		}
+		if !item.ReceivedAt.Before(to) {
+			break
+		}
+		inPeriod := !item.ReceivedAt.Before(from)
+
+		shape, known := shapes[item.EventType]
+		if !known {
+			shape = make(map[string]string)
+			shapes[item.EventType] = shape
+		}
+		for field, kind := range payloadShape(item.Payload) {
+			was, seen := shape[field]
+			switch {
+			case !seen:
+				shape[field] = kind
+			case was == "null" && kind != "null":
+				shape[field] = kind
+				continue
+			case was == kind || kind == "null":
+				continue
+			default:
+				shape[field] = kind
+			}
+			key := item.EventType + "\x00" + field
+			if !inPeriod || !known || reported[key] {
+				continue
+			}
+			reported[key] = true
+			report.SchemaChanges = append(report.SchemaChanges, SchemaChange{
+				EventType: item.EventType,
+				Field:     field,
+				Was:       was,
+				Now:       kind,
+				CaptureID: item.ID,
+				SeenAt:    item.ReceivedAt,
+			})
+		}
+		if !inPeriod {
+			continue
+		}
+
+		report.Total++
+		v := volumes[item.EventType]
+		if v == nil {
+			v = &EventTypeVolume{EventType: item.EventType}
+			volumes[item.EventType] = v
+		}
+		v.Count++
+		if item.Verification != nil && !item.Verification.Verified {
+			v.Errors++
+		}
+		sender := "unknown"
+		if item.Client != nil && item.Client.IP != "" {
+			sender = item.Client.IP
+		}
+		senders[sender]++
+	}
+
+	for _, v := range volumes {
+		report.EventTypes = append(report.EventTypes, *v)
+	}
+	sort.Slice(report.EventTypes, func(i, j int) bool {
+		a, b := report.EventTypes[i], report.EventTypes[j]
+		return a.Count > b.Count || a.Count == b.Count && a.EventType < b.EventType
+	})
+	for _, stats := range idx.List() {
+		if !stats.FirstSeen.Before(from) && stats.FirstSeen.Before(to) {
+			report.NewEventTypes = append(report.NewEventTypes, stats.EventType)
+		}
+	}
+	for sender, n := range senders {
+		report.TopSenders = append(report.TopSenders, SenderVolume{Sender: sender, Count: n})
+	}
+	sort.Slice(report.TopSenders, func(i, j int) bool {
+		a, b := report.TopSenders[i], report.TopSenders[j]
+		return a.Count > b.Count || a.Count == b.Count && a.Sender < b.Sender
+	})
+	if len(report.TopSenders) > reportTopSenders {
+		report.TopSenders = report.TopSenders[:reportTopSenders]
+	}
+	return report
+}
+
+// payloadShape maps the dotted path of every payload field to its JSON type,
+// with array elements under path[] as in the lint report.
+func payloadShape(payload map[string]any) map[string]string {
+	shape := make(map[string]string)
+	var walk func(path string, value any)
+	walk = func(path string, value any) {
+		shape[path] = jsonType(value)
+		switch v := value.(type) {
+		case map[string]any:
+			for key, child := range v {
+				walk(path+"."+key, child)
+			}
+		case []any:
+			for _, child := range v {
+				walk(path+"[]", child)
+			}
+		}
+	}
+	for key, value := range payload {
+		walk(key, value)
+	}
+	return shape
+}
+
+// writeMarkdown writes the report as Markdown for chat channels and tickets.
+func (rep Report) writeMarkdown(w io.Writer) {
+	fmt.Fprintf(w, "# Webhook report\n\n%s to %s: %d webhooks", rep.From.Format(time.RFC3339), rep.To.Format(time.RFC3339), rep.Total)
+	if rep.Partial {
+		fmt.Fprint(w, " (partial)")
+	}
+	fmt.Fprint(w, "\n\n## Volume by event type\n\n")
+	if len(rep.EventTypes) == 0 {
+		fmt.Fprint(w, "No webhooks received.\n")
+	} else {
+		fmt.Fprint(w, "| Event type | Count | Verification failures | Error rate |\n| --- | ---: | ---: | ---: |\n")
+		for _, v := range rep.EventTypes {
+			fmt.Fprintf(w, "| %s | %d | %d | %.1f%% |\n", markdownCell(v.EventType), v.Count, v.Errors, v.ErrorRate())
+		}
+	}
+
+	fmt.Fprint(w, "\n## New event types\n\n")
+	if len(rep.NewEventTypes) == 0 {
+		fmt.Fprint(w, "None.\n")
+	}
+	for _, eventType := range rep.NewEventTypes {
+		fmt.Fprintf(w, "- %s\n", markdownCell(eventType))
+	}
+
+	fmt.Fprint(w, "\n## Schema changes\n\n")
+	if len(rep.SchemaChanges) == 0 {
+		fmt.Fprint(w, "None.\n")
+	} else {
+		fmt.Fprint(w, "| Event type | Field | Change | First record |\n| --- | --- | --- | --- |\n")
+		for _, c := range rep.SchemaChanges {
+			fmt.Fprintf(w, "| %s | %s | %s | %s |\n", markdownCell(c.EventType), markdownCell(c.Field), c.Description(), c.CaptureID)
+		}
+	}
+
+	fmt.Fprint(w, "\n## Top senders\n\n")
+	if len(rep.TopSenders) == 0 {
+		fmt.Fprint(w, "None.\n")
+	} else {
+		fmt.Fprint(w, "| Sender | Count |\n| --- | ---: |\n")
+		for _, s := range rep.TopSenders {
+			fmt.Fprintf(w, "| %s | %d |\n", markdownCell(s.Sender), s.Count)
+		}
+	}
+}
+
+func (c SchemaChange) Description() string {
+	if c.Was == "" {
+		return "added (" + c.Now + ")"
+	}
+	return c.Was + " → " + c.Now
+}
+
+func markdownCell(s string) string {
+	if s == "" {
+		return "(none)"
+	}
+	return strings.NewReplacer("|", `\|`, "\n", " ", "`", "\\`", "*", `\*`, "_", `\_`).Replace(s)
+}
+
+var reportTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>Webhook report</title></head><body>
+<h1>Webhook report</h1>
+<p>{{.From.Format "2006-01-02T15:04:05Z07:00"}} to {{.To.Format "2006-01-02T15:04:05Z07:00"}}: {{.Total}} webhooks{{if .Partial}} (partial){{end}}</p>
+<h2>Volume by event type</h2>
+{{if .EventTypes}}<table>
+<tr><th>Event type</th><th>Count</th><th>Verification failures</th><th>Error rate</th></tr>
+{{range .EventTypes}}<tr><td>{{.EventType}}</td><td>{{.Count}}</td><td>{{.Errors}}</td><td>{{printf "%.1f" .ErrorRate}}%</td></tr>
+{{end}}</table>{{else}}<p>No webhooks received.</p>{{end}}
+<h2>New event types</h2>
+{{if .NewEventTypes}}<ul>{{range .NewEventTypes}}<li>{{.}}</li>{{end}}</ul>{{else}}<p>None.</p>{{end}}
+<h2>Schema changes</h2>
+{{if .SchemaChanges}}<table>
+<tr><th>Event type</th><th>Field</th><th>Change</th><th>First record</th></tr>
+{{range .SchemaChanges}}<tr><td>{{.EventType}}</td><td>{{.Field}}</td><td>{{.Description}}</td><td>{{.CaptureID}}</td></tr>
+{{end}}</table>{{else}}<p>None.</p>{{end}}
+<h2>Top senders</h2>
+{{if .TopSenders}}<table>
+<tr><th>Sender</th><th>Count</th></tr>
+{{range .TopSenders}}<tr><td>{{.Sender}}</td><td>{{.Count}}</td></tr>
+{{end}}</table>{{else}}<p>None.</p>{{end}}
+</body></html>
+`))
+
+// reportHandler serves /report?period=24h&format=md|html, a digest of the
+// period ending now.
+func reportHandler(buffer *RingBuffer, idx *EventTypeIndex) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		period := 24 * time.Hour
+		if p := r.URL.Query().Get("period"); p != "" {
+			d, err := time.ParseDuration(p)
+			if err != nil || d <= 0 {
+				writeProblem(w, r, http.StatusBadRequest, codeInvalidParameter, "period must be a positive duration such as 24h")
+				return
+			}
+			period = d
+		}
+		format := r.URL.Query().Get("format")
+		if format != "" && format != "md" && format != "html" {
+			writeProblem(w, r, http.StatusBadRequest, codeInvalidParameter, "format must be md or html")
+			return
+		}
+
+		ctx, cancel := scanContext(r)
+		defer cancel()
+		to := time.Now().UTC()
+		report := buildReport(ctx, buffer.Snapshot(), idx, to.Add(-period), to)
+		if format == "html" {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			reportTemplate.Execute(w, report)
+			return
+		}
+		w.Header().Set("Content-Type", "text/markdown; charset=utf-8")
+		report.writeMarkdown(w)
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBuildReport(t *testing.T) {
+	buffer := NewRingBuffer(10)
+	idx := NewEventTypeIndex()
+	now := time.Date(2024, 5, 2, 12, 0, 0, 0, time.UTC)
+	push := func(age time.Duration, eventType, ip string, payload map[string]any, verified *bool) WebhookParams {
+		item := WebhookParams{EventType: eventType, Payload: payload, ReceivedAt: now.Add(-age), Client: &ClientInfo{IP: ip}}
+		if verified != nil {
+			item.Verification = &Verification{Scheme: "stripe", Verified: *verified}
+		}
+		stored, _ := buffer.Push(item)
+		idx.OnIngest(stored, nil)
+		return stored
+	}
+	yes, no := true, false
+	push(30*time.Hour, "payment", "10.0.0.1", map[string]any{"amount": 1.0, "note": nil}, &yes)
+	push(2*time.Hour, "payment", "10.0.0.1", map[string]any{"amount": 2.0, "note": "x"}, &no)
+	changed := push(time.Hour, "payment", "10.0.0.2", map[string]any{"amount": "3", "currency": "usd"}, &yes)
+	push(time.Minute, "signup", "10.0.0.1", map[string]any{"user": map[string]any{"id": 1.0}}, nil)
+
+	rep := buildReport(context.Background(), buffer.Snapshot(), idx, now.Add(-24*time.Hour), now)
+	if rep.Total != 3 || rep.Partial {
+		t.Fatalf("expected 3 webhooks in full, got %+v", rep)
+	}
+	if len(rep.EventTypes) != 2 || rep.EventTypes[0] != (EventTypeVolume{"payment", 2, 1}) || rep.EventTypes[0].ErrorRate() != 50 {
+		t.Errorf("unexpected volumes %+v", rep.EventTypes)
+	}
+	if len(rep.NewEventTypes) != 1 || rep.NewEventTypes[0] != "signup" {
+		t.Errorf("expected signup to be new, got %v", rep.NewEventTypes)
+	}
+	want := map[string]string{"amount": "number → string", "currency": "added (string)"}
+	if len(rep.SchemaChanges) != 2 {
+		t.Fatalf("expected two schema changes, got %+v", rep.SchemaChanges)
+	}
+	for _, c := range rep.SchemaChanges {
+		if want[c.Field] != c.Description() || c.CaptureID != changed.ID {
+			t.Errorf("unexpected schema change %+v", c)
+		}
+	}
+	if len(rep.TopSenders) != 2 || rep.TopSenders[0] != (SenderVolume{"10.0.0.1", 2}) {
+		t.Errorf("unexpected senders %+v", rep.TopSenders)
+	}
+}
+
+func TestReportPartialAfterEviction(t *testing.T) {
+	buffer := NewRingBuffer(2)
+	now := time.Now()
+	for i := 0; i < 3; i++ {
+		buffer.Push(WebhookParams{EventType: "tick", ReceivedAt: now})
+	}
+	if rep := buildReport(context.Background(), buffer.Snapshot(), NewEventTypeIndex(), now.Add(-time.Hour), now.Add(time.Second)); !rep.Partial || rep.Total != 2 {
+		t.Errorf("expected a partial report of 2 webhooks, got %+v", rep)
+	}
+}
+
+func TestReportHandler(t *testing.T) {
+	mux := newTestServer()
+	postWebhook(t, mux, `{"event":"order_paid","data":{"id":1}}`)
+	postWebhook(t, mux, `{"event":"<b>order</b>","data":{"id":1}}`)
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/report?period=1h", nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `| order\_paid | 1 | 0 | 0.0% |`) {
+		t.Errorf("unexpected markdown report %s", rec.Body)
+	}
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/report?format=html", nil))
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/html") || !strings.Contains(rec.Body.String(), "&lt;b&gt;order&lt;/b&gt;") {
+		t.Errorf("expected an escaped html report, got %s %s", ct, rec.Body)
+	}
+
+	for _, query := range []string{"period=1d", "period=-1h", "format=pdf"} {
+		rec = httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/report?"+query, nil))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", query, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+)
+
+// retentionSweepInterval is how often expired records are dropped even
+// while the buffer has room, so they stop showing up in queries.
+const retentionSweepInterval = 10 * time.Second
+
+// RetentionRule keeps records whose event type matches Pattern, a glob such
+// as payment.*, for TTL after they were received.
+type RetentionRule struct {
+	Pattern string
+	TTL     time.Duration
+}
+
+// parseRetention parses comma-separated pattern=ttl pairs, e.g.
+// "heartbeat.*=10m,payment.*=168h". The first matching rule wins.
+func parseRetention(s string) ([]RetentionRule, error) {
+	var rules []RetentionRule
+	for _, pair := range splitList(s) {
+		pattern, ttl, ok := strings.Cut(pair, "=")
+		pattern = strings.TrimSpace(pattern)
+		if !ok || pattern == "" {
+			return nil, fmt.Errorf("invalid rule %q, expected pattern=ttl", pair)
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %v", pattern, err)
+		}
+		d, err := time.ParseDuration(strings.TrimSpace(ttl))
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("ttl for %s must be a positive duration, got %q", pattern, ttl)
+		}
+		rules = append(rules, RetentionRule{Pattern: pattern, TTL: d})
+	}
+	return rules, nil
+}
+
+// expiresAt returns when item expires under the buffer's retention rules,
+// or the zero time if no rule matches it. rb.mu must be held.
+func (rb *RingBuffer) expiresAt(item *WebhookParams) time.Time {
+	for _, rule := range rb.retention {
+		if ok, _ := path.Match(rule.Pattern, item.EventType); ok {
+			return item.ReceivedAt.Add(rule.TTL)
+		}
+	}
+	return time.Time{}
+}
+
+// SetRetention expires records by event type, on top of the buffer evicting
+// the oldest record when full. A full buffer drops expired records first, so
+// short-lived noise makes room for the events kept longer. It must be called
+// before the buffer is used.
+func (rb *RingBuffer) SetRetention(rules []RetentionRule) {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+	rb.retention = rules
+}
+
+// Expire drops the records that expired by now and returns how many.
+func (rb *RingBuffer) Expire(now time.Time) int {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+	return rb.expire(now)
+}
+
+// expire drops the records that expired by now. rb.mu must be held for
+// writing.
+func (rb *RingBuffer) expire(now time.Time) int {
+	if rb.nextExpiry.IsZero() || now.Before(rb.nextExpiry) {
+		return 0
+	}
+	rb.nextExpiry = time.Time{}
+	dropped := rb.compact(func(item *WebhookParams) bool {
+		expires := rb.expiresAt(item)
+		if !expires.IsZero() && !now.Before(expires) {
+			rb.dropped(lifecycleExpired, item)
+			return true
+		}
+		if !expires.IsZero() && (rb.nextExpiry.IsZero() || expires.Before(rb.nextExpiry)) {
+			rb.nextExpiry = expires
+		}
+		return false
+	})
+	rb.expired += uint64(dropped)
+	return dropped
+}
+
+// compact drops the records drop selects, moving the others up against
+// each other in order, and returns how many it dropped. rb.mu must be held
+// for writing.
+func (rb *RingBuffer) compact(drop func(item *WebhookParams) bool) int {
+	if rb.count == 0 {
+		return 0
+	}
+	oldest := rb.newest(rb.count - 1)
+	kept := 0
+	for i := 0; i < rb.count; i++ {
+		from := (oldest + i) % rb.size
+		item := rb.at(from)
+		if drop(item) {
+			if item.IdempotencyKey != "" {
+				delete(rb.keys, item.IdempotencyKey)
+			}
+			continue
+		}
+		to := (oldest + kept) % rb.size
+		if to != from {
+			*rb.slot(to) = *item
+			if item.IdempotencyKey != "" {
+				rb.keys[item.IdempotencyKey] = to
+			}
+		}
+		kept++
+	}
+	dropped := rb.count - kept
+	for i := kept; i < rb.count; i++ {
+		*rb.slot((oldest + i) % rb.size) = WebhookParams{}
+	}
+	rb.count = kept
+	rb.head = (oldest + kept) % rb.size
+	return dropped
+}
+
+// Expired returns how many records were dropped by retention rules since
+// the buffer was created.
+func (rb *RingBuffer) Expired() uint64 {
+	rb.mu.RLock()
+	defer rb.mu.RUnlock()
+	return rb.expired
+}
+
+// RunRetention drops expired records every retentionSweepInterval until ctx
+// is done.
+func (rb *RingBuffer) RunRetention(ctx context.Context) {
+	ticker := time.NewTicker(retentionSweepInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			rb.Expire(now)
+		}
+	}
+}
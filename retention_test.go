@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestParseRetention(t *testing.T) {
+	rules, err := parseRetention("heartbeat.*=10m, payment.*=168h")
+	if err != nil || len(rules) != 2 || rules[0] != (RetentionRule{"heartbeat.*", 10 * time.Minute}) {
+		t.Fatalf("unexpected rules %+v (%v)", rules, err)
+	}
+	for _, bad := range []string{"heartbeat.*", "=10m", "a=soon", "a=-1m", "[=1m"} {
+		if _, err := parseRetention(bad); err == nil {
+			t.Errorf("%q: expected an error", bad)
+		}
+	}
+}
+
+func TestRetentionMakesRoomForKeptEvents(t *testing.T) {
+	buffer := NewRingBuffer(4)
+	buffer.SetRetention([]RetentionRule{{"heartbeat.*", 10 * time.Minute}, {"payment.*", 168 * time.Hour}})
+	old := time.Now().Add(-time.Hour)
+
+	payment, _ := buffer.Push(WebhookParams{EventType: "payment.succeeded", ReceivedAt: old})
+	buffer.Push(WebhookParams{EventType: "heartbeat.ping", ReceivedAt: old, IdempotencyKey: "hb-1"})
+	buffer.Push(WebhookParams{EventType: "heartbeat.ping", ReceivedAt: old})
+	fresh, _ := buffer.Push(WebhookParams{EventType: "heartbeat.ping", ReceivedAt: time.Now()})
+
+	// The buffer is full: the expired heartbeats go instead of the payment.
+	order, _ := buffer.Push(WebhookParams{EventType: "order.created", ReceivedAt: time.Now()})
+	got, _, _ := buffer.After(context.Background(), 0, 0, nil)
+	if len(got) != 3 || got[0].ID != payment.ID || got[1].ID != fresh.ID || got[2].ID != order.ID {
+		t.Fatalf("expected order, fresh heartbeat and payment, got %+v", got)
+	}
+	if buffer.Evictions() != 0 || buffer.Expired() != 2 {
+		t.Errorf("expected 2 expired and no evictions, got %d and %d", buffer.Expired(), buffer.Evictions())
+	}
+	if _, ok := buffer.Get(payment.ID); !ok {
+		t.Error("expected the payment to be found after compaction")
+	}
+	if _, dup := buffer.Push(WebhookParams{EventType: "heartbeat.ping", IdempotencyKey: "hb-1", ReceivedAt: time.Now()}); dup {
+		t.Error("expected the expired record's idempotency key to be forgotten")
+	}
+
+	// With nothing expired, the oldest record is evicted as usual.
+	buffer.Push(WebhookParams{EventType: "order.created", ReceivedAt: time.Now()})
+	if buffer.Evictions() != 1 {
+		t.Errorf("expected one eviction, got %d", buffer.Evictions())
+	}
+}
+
+func TestExpireWhileNotFull(t *testing.T) {
+	buffer := NewRingBuffer(300)
+	buffer.SetRetention([]RetentionRule{{"heartbeat", time.Minute}})
+	now := time.Now()
+	var kept []string
+	for i := 0; i < 250; i++ {
+		if i%3 == 0 {
+			item, _ := buffer.Push(WebhookParams{EventType: "order", ReceivedAt: now})
+			kept = append(kept, item.ID)
+		} else {
+			buffer.Push(WebhookParams{EventType: "heartbeat", ReceivedAt: now})
+		}
+	}
+	snap := buffer.Snapshot()
+	if n := buffer.Expire(now.Add(59 * time.Second)); n != 0 {
+		t.Fatalf("expected nothing expired yet, got %d", n)
+	}
+	if n := buffer.Expire(now.Add(time.Minute)); n != 250-len(kept) {
+		t.Fatalf("expected %d expired, got %d", 250-len(kept), n)
+	}
+	got, _, _ := buffer.After(context.Background(), 0, 0, nil)
+	if len(got) != len(kept) {
+		t.Fatalf("expected %d records, got %d", len(kept), len(got))
+	}
+	for i, item := range got {
+		if item.ID != kept[i] {
+			t.Fatalf("record %d out of order", i)
+		}
+	}
+	if snap.Len() != 250 {
+		t.Errorf("expected the earlier snapshot to be unaffected, got %d records", snap.Len())
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Reverify re-runs signature verification of captured records under Scheme
+// with Secret, typically a secret that was misconfigured while they were
+// captured.
+type Reverify struct {
+	Scheme string `json:"scheme"`
+	Secret string `json:"secret"`
+}
+
+// SetVerification replaces the verification result of the record with the
+// given id.
+func (rb *RingBuffer) SetVerification(id string, v *Verification) bool {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+
+	idx, ok := rb.find(id)
+	if !ok {
+		return false
+	}
+	rb.slot(idx).Verification = v
+	return true
+}
+
+// signatureTimestamp finds the timestamp a captured request was signed
+// with: in the timestamp header, or in Stripe's t= element.
+func signatureTimestamp(scheme SignatureScheme, headers http.Header) string {
+	if scheme.timestampHeader != "" {
+		if ts := headers.Get(scheme.timestampHeader); ts != "" {
+			return ts
+		}
+	}
+	for _, part := range strings.Split(headers.Get(scheme.header), ",") {
+		if ts, ok := strings.CutPrefix(strings.TrimSpace(part), "t="); ok {
+			return ts
+		}
+	}
+	return ""
+}
+
+// reverify checks item's raw body and signature header again.
+func (rv Reverify) reverify(scheme SignatureScheme, item WebhookParams) *Verification {
+	v := &Verification{Scheme: scheme.Name}
+	header := item.Headers.Get(scheme.header)
+	switch {
+	case header == "":
+		v.Detail = "no " + scheme.header + " header"
+	case item.Raw == nil:
+		v.Detail = "raw body not captured"
+	case scheme.Verify(rv.Secret, item.Raw, signatureTimestamp(scheme, item.Headers), header):
+		v.Verified = true
+	default:
+		v.Detail = "signature mismatch"
+	}
+	return v
+}
+
+// checkReverify validates req.Reverify, returning its signature scheme.
+func checkReverify(req ReplayRequest) (SignatureScheme, error) {
+	if req.Reverify == nil {
+		return SignatureScheme{}, nil
+	}
+	scheme, ok := signatureSchemes[req.Reverify.Scheme]
+	if !ok {
+		return SignatureScheme{}, &paramError{codeInvalidParameter, fmt.Sprintf("Unknown reverify scheme %q", req.Reverify.Scheme)}
+	}
+	return scheme, nil
+}
+
+// replayRecord replays item as replayOne does. With req.Reverify set, item
+// is verified again first, its record updated with the new result, and only
+// replayed if it now verifies.
+func replayRecord(ctx context.Context, client *http.Client, buffer *RingBuffer, req ReplayRequest, scheme, reverifyScheme SignatureScheme, item WebhookParams, now time.Time) ReplayResult {
+	var v *Verification
+	if req.Reverify != nil {
+		v = req.Reverify.reverify(reverifyScheme, item)
+		buffer.SetVerification(item.ID, v)
+		if !v.Verified {
+			return ReplayResult{ID: item.ID, Event: item.EventType, ReceivedAt: item.ReceivedAt, Verification: v, Error: "not replayed: " + v.Detail}
+		}
+	}
+	result := replayOne(ctx, client, req, scheme, item, now)
+	result.Verification = v
+	return result
+}
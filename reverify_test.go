@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestReplayReverifies(t *testing.T) {
+	target, delivered := newReplayTarget(t)
+	buffer := NewRingBuffer(10)
+	stripe := signatureSchemes["stripe"]
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	capture := func(event, secret string) WebhookParams {
+		raw := []byte(`{"event":"` + event + `","data":{},"version":""}`)
+		var item WebhookParams
+		json.Unmarshal(raw, &item)
+		item.Raw = raw
+		item.Headers = http.Header{"Stripe-Signature": {stripe.Sign(secret, raw, ts)}}
+		// Captured while the configured secret was wrong.
+		item.Verification = &Verification{Scheme: "stripe", Detail: "signature mismatch"}
+		stored, _ := buffer.Push(item)
+		return stored
+	}
+	good := capture("charge.succeeded", "whsec_right")
+	forged := capture("charge.refunded", "whsec_forged")
+	buffer.Push(WebhookParams{EventType: "charge.failed", Verification: &Verification{Scheme: "stripe", Verified: true}})
+
+	code, results := postReplay(t, buffer, ReplayRequest{
+		URL:      target.URL,
+		Match:    json.RawMessage(`{"verified": "false"}`),
+		Scheme:   "hmac-sha256",
+		Secret:   "replay",
+		Reverify: &Reverify{Scheme: "stripe", Secret: "whsec_right"},
+	})
+	if code != http.StatusOK || len(results) != 2 {
+		t.Fatalf("expected both unverified records to be considered, got %d %+v", code, results)
+	}
+	if results[0].ID != good.ID || results[0].Status != http.StatusOK || !results[0].Verification.Verified {
+		t.Errorf("expected the record to verify and be replayed, got %+v", results[0])
+	}
+	if results[1].ID != forged.ID || results[1].Status != 0 || results[1].Error == "" || results[1].Verification.Verified {
+		t.Errorf("expected the forged record to be skipped, got %+v", results[1])
+	}
+	if got := delivered(); len(got) != 1 {
+		t.Errorf("expected one delivery, got %d", len(got))
+	}
+	if item, _ := buffer.Get(good.ID); item.Verification == nil || !item.Verification.Verified {
+		t.Errorf("expected the record to be marked verified, got %+v", item.Verification)
+	}
+	if item, _ := buffer.Get(forged.ID); item.Verification == nil || item.Verification.Verified {
+		t.Errorf("expected the forged record to stay unverified, got %+v", item.Verification)
+	}
+
+	if code, _ := postReplay(t, buffer, ReplayRequest{URL: target.URL, Match: json.RawMessage(`{"verified": "false"}`), Scheme: "stripe", Reverify: &Reverify{Scheme: "rot13"}}); code != http.StatusBadRequest {
+		t.Errorf("expected an unknown reverify scheme to be rejected, got %d", code)
+	}
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+)
+
+// SavedQuery is a named set of /query parameters.
+type SavedQuery struct {
+	Name      string     `json:"name"`
+	Params    url.Values `json:"params"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+type SavedQueries struct {
+	mu      sync.RWMutex
+	queries map[string]SavedQuery
+}
+
+func NewSavedQueries() *SavedQueries {
+	return &SavedQueries{queries: make(map[string]SavedQuery)}
+}
+
+// Put stores q, replacing any query with the same name. It reports whether
+// the name was new.
+func (sq *SavedQueries) Put(q SavedQuery) (created bool) {
+	sq.mu.Lock()
+	defer sq.mu.Unlock()
+	_, exists := sq.queries[q.Name]
+	sq.queries[q.Name] = q
+	return !exists
+}
+
+func (sq *SavedQueries) Get(name string) (SavedQuery, bool) {
+	sq.mu.RLock()
+	defer sq.mu.RUnlock()
+	q, ok := sq.queries[name]
+	return q, ok
+}
+
+func (sq *SavedQueries) Delete(name string) bool {
+	sq.mu.Lock()
+	defer sq.mu.Unlock()
+	_, ok := sq.queries[name]
+	delete(sq.queries, name)
+	return ok
+}
+
+func (sq *SavedQueries) List() []SavedQuery {
+	sq.mu.RLock()
+	defer sq.mu.RUnlock()
+	list := make([]SavedQuery, 0, len(sq.queries))
+	for _, q := range sq.queries {
+		list = append(list, q)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// Resolve applies params on top of the saved query named name, replacing
+// parameters of the same name, for subscriptions and /stream that take a
+// saved_query. A saved consistency is dropped, as only /query and runs
+// reach peers.
+func (sq *SavedQueries) Resolve(name string, params url.Values) (url.Values, error) {
+	if sq == nil {
+		return nil, &paramError{codeInvalidParameter, "saved_query is not available here"}
+	}
+	q, ok := sq.Get(name)
+	if !ok {
+		return nil, &paramError{codeInvalidParameter, "No saved query named " + name}
+	}
+	merged := maps.Clone(q.Params)
+	delete(merged, "consistency")
+	for key, values := range params {
+		merged[key] = values
+	}
+	return merged, nil
+}
+
+// decodeParams reads a JSON object of query parameters, where each value is a
+// string or an array of strings, e.g. {"event_type": "payment", "status:ci": "failed"}.
+func decodeParams(body []byte) (url.Values, error) {
+	var raw map[string]any
+	if err := json.Unmarshal(body, &raw); err != nil {
+		return nil, err
+	}
+
+	params := make(url.Values, len(raw))
+	for key, value := range raw {
+		switch v := value.(type) {
+		case string:
+			params.Add(key, v)
+		case []any:
+			for _, item := range v {
+				str, ok := item.(string)
+				if !ok {
+					return nil, fmt.Errorf("parameter %q must contain only strings", key)
+				}
+				params.Add(key, str)
+			}
+		default:
+			return nil, fmt.Errorf("parameter %q must be a string or array of strings", key)
+		}
+	}
+	return params, nil
+}
+
+func putSavedQueryHandler(saved *SavedQueries) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var raw json.RawMessage
+		if err := json.NewDecoder(r.Body).Decode(&raw); err != nil {
+			writeProblem(w, r, http.StatusBadRequest, codeInvalidJSON, "Invalid JSON: "+err.Error())
+			return
+		}
+		params, err := decodeParams(raw)
+		if err != nil {
+			writeProblem(w, r, http.StatusBadRequest, codeInvalidParameter, err.Error())
+			return
+		}
+		// Reject definitions that could never run.
+		filterParams := maps.Clone(params)
+		if _, err := parseConsistency(filterParams); err != nil {
+			writeParamError(w, r, err)
+			return
+		}
+		if _, err := parseQueryFilter(filterParams, ""); err != nil {
+			writeParamError(w, r, err)
+			return
+		}
+
+		q := SavedQuery{Name: r.PathValue("name"), Params: params, UpdatedAt: time.Now().UTC()}
+		status := http.StatusOK
+		if saved.Put(q) {
+			status = http.StatusCreated
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(q)
+	}
+}
+
+func getSavedQueryHandler(saved *SavedQueries) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q, ok := saved.Get(r.PathValue("name"))
+		if !ok {
+			writeProblem(w, r, http.StatusNotFound, codeNotFound, "No saved query named "+r.PathValue("name"))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(q)
+	}
+}
+
+func listSavedQueriesHandler(saved *SavedQueries) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(saved.List())
+	}
+}
+
+func deleteSavedQueryHandler(saved *SavedQueries) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !saved.Delete(r.PathValue("name")) {
+			writeProblem(w, r, http.StatusNotFound, codeNotFound, "No saved query named "+r.PathValue("name"))
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// runSavedQueryHandler runs a saved query. Parameters on the request are
+// applied on top of the saved ones, replacing parameters of the same name.
+// consistency works as it does on /query.
+func runSavedQueryHandler(buffer *RingBuffer, saved *SavedQueries) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q, ok := saved.Get(r.PathValue("name"))
+		if !ok {
+			writeProblem(w, r, http.StatusNotFound, codeNotFound, "No saved query named "+r.PathValue("name"))
+			return
+		}
+
+		params := maps.Clone(q.Params)
+		for key, values := range r.URL.Query() {
+			params[key] = values
+		}
+		consistency, err := parseConsistency(params)
+		if err != nil {
+			writeParamError(w, r, err)
+			return
+		}
+		filter, err := parseQueryFilter(params, "")
+		if err != nil {
+			writeParamError(w, r, err)
+			return
+		}
+
+		if consistency == consistencyAll && len(peers) > 0 {
+			// Peers run the merged parameters through their own /query.
+			r = r.Clone(r.Context())
+			r.URL.RawQuery = params.Encode()
+			writeClusterResults(w, r, buffer, filter)
+			return
+		}
+		writeQueryResults(w, r, buffer, filter)
+	}
+}
+
+// registerSavedQueryRoutes mounts the saved queries. Anyone can list and run
+// them, but saving and deleting one takes the admin token.
+func registerSavedQueryRoutes(mux *http.ServeMux, buffer *RingBuffer, saved *SavedQueries, adminToken string) {
+	handleAPI(mux, "GET /saved-queries", listSavedQueriesHandler(saved))
+	handleAPI(mux, "GET /saved-queries/{name}", getSavedQueryHandler(saved))
+	handleAPI(mux, "PUT /saved-queries/{name}", requireAdmin(adminToken, putSavedQueryHandler(saved)))
+	handleAPI(mux, "DELETE /saved-queries/{name}", requireAdmin(adminToken, deleteSavedQueryHandler(saved)))
+	handleAPI(mux, "GET /saved-queries/{name}/run", runSavedQueryHandler(buffer, saved))
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func putSavedQuery(t *testing.T, mux *http.ServeMux, name, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := adminRequest(http.MethodPut, "/v1/saved-queries/"+name, bytes.NewBufferString(body))
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestSavedQueryRun(t *testing.T) {
+	mux := newTestServer()
+
+	postWebhook(t, mux, `{"event":"payment.failed","data":{"currency":"usd","reason":"card_declined"}}`)
+	postWebhook(t, mux, `{"event":"payment.failed","data":{"currency":"EUR","reason":"expired"}}`)
+	postWebhook(t, mux, `{"event":"payment.succeeded","data":{"currency":"usd"}}`)
+
+	rec := putSavedQuery(t, mux, "failed-payments", `{"event_type":["payment.failed"],"currency:ci":"USD"}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected status 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	results := queryWebhooks(t, mux, "/v1/saved-queries/failed-payments/run")
+	if len(results) != 1 || results[0].Payload["reason"] != "card_declined" {
+		t.Errorf("expected the declined usd payment, got %v", results)
+	}
+
+	// Request parameters override the saved ones.
+	overridden := queryWebhooks(t, mux, "/v1/saved-queries/failed-payments/run?currency:ci=eur")
+	if len(overridden) != 1 || overridden[0].Payload["reason"] != "expired" {
+		t.Errorf("expected the expired eur payment, got %v", overridden)
+	}
+
+	if local := queryWebhooks(t, mux, "/v1/saved-queries/failed-payments/run?consistency=local"); len(local) != 1 {
+		t.Errorf("expected consistency to be taken as a query option, not a field, got %d results", len(local))
+	}
+
+	rec = putSavedQuery(t, mux, "failed-payments", `{"event_type":"payment.failed"}`)
+	if rec.Code != http.StatusOK {
+		t.Errorf("expected status 200 on replace, got %d", rec.Code)
+	}
+	if all := queryWebhooks(t, mux, "/v1/saved-queries/failed-payments/run"); len(all) != 2 {
+		t.Errorf("expected 2 results after replacing the query, got %d", len(all))
+	}
+}
+
+func TestSavedQueryValidationAndLifecycle(t *testing.T) {
+	mux := newTestServer()
+
+	if rec := putSavedQuery(t, mux, "broken", `{"status":"failed"}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400 without event_type, got %d", rec.Code)
+	}
+	if rec := putSavedQuery(t, mux, "broken", `{"event_type":1}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400 for non-string params, got %d", rec.Code)
+	}
+
+	putSavedQuery(t, mux, "orders", `{"event_type":"order"}`)
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/saved-queries", nil)
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	var list []SavedQuery
+	if err := json.Unmarshal(rec.Body.Bytes(), &list); err != nil {
+		t.Fatalf("failed to parse list: %v", err)
+	}
+	if len(list) != 1 || list[0].Name != "orders" || list[0].Params.Get("event_type") != "order" {
+		t.Errorf("unexpected saved queries: %+v", list)
+	}
+
+	req = httptest.NewRequest(http.MethodDelete, "/v1/saved-queries/orders", nil)
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected deleting without the admin token to be refused, got %d", rec.Code)
+	}
+
+	req = adminRequest(http.MethodDelete, "/v1/saved-queries/orders", nil)
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNoContent {
+		t.Errorf("expected status 204, got %d", rec.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/v1/saved-queries/orders/run", nil)
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("expected status 404 after delete, got %d", rec.Code)
+	}
+}
+
+func TestSavedQueryWithoutAdminToken(t *testing.T) {
+	mux := http.NewServeMux()
+	registerSavedQueryRoutes(mux, NewRingBuffer(1), NewSavedQueries(), "")
+	if rec := putSavedQuery(t, mux, "orders", `{"event_type":"order"}`); rec.Code != http.StatusForbidden {
+		t.Errorf("expected status 403 without a configured admin token, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultSecretRefresh = time.Minute
+	// secretTimeout bounds one secret lookup in Vault.
+	secretTimeout = 10 * time.Second
+)
+
+// secrets caches the secrets configured by reference: "file:PATH" reads the
+// value from a file, such as a mounted Kubernetes or Docker secret, and
+// "vault:PATH#FIELD" reads FIELD of the Vault secret at PATH, e.g.
+// vault:secret/data/webhook-echo#admin_token, using VAULT_ADDR and
+// VAULT_TOKEN. Any other value is the secret itself.
+var secrets = &secretCache{values: make(map[string]string), client: http.DefaultClient}
+
+type secretCache struct {
+	mu     sync.RWMutex
+	values map[string]string
+	client *http.Client
+}
+
+func isSecretRef(s string) bool {
+	return strings.HasPrefix(s, "file:") || strings.HasPrefix(s, "vault:")
+}
+
+// currentSecret resolves s to the latest value loaded for it. Secrets are
+// loaded at startup, so the lookup after a failed one only happens for
+// references not configured as flags; it fails closed, to an empty secret.
+func currentSecret(s string) string {
+	if !isSecretRef(s) {
+		return s
+	}
+	secrets.mu.RLock()
+	v, ok := secrets.values[s]
+	secrets.mu.RUnlock()
+	if ok {
+		return v
+	}
+	if err := secrets.Load(s); err != nil {
+		log.Printf("Secret %s: %v", s, err)
+		return ""
+	}
+	return currentSecret(s)
+}
+
+// Load resolves each reference and caches its value, so that Refresh keeps
+// it up to date.
+func (c *secretCache) Load(refs ...string) error {
+	for _, ref := range refs {
+		if !isSecretRef(ref) {
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), secretTimeout)
+		v, err := c.fetch(ctx, ref)
+		cancel()
+		if err != nil {
+			return err
+		}
+		c.mu.Lock()
+		c.values[ref] = v
+		c.mu.Unlock()
+	}
+	return nil
+}
+
+func (c *secretCache) fetch(ctx context.Context, ref string) (string, error) {
+	if path, ok := strings.CutPrefix(ref, "file:"); ok {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimRight(string(b), "\r\n"), nil
+	}
+	path, field, ok := strings.Cut(strings.TrimPrefix(ref, "vault:"), "#")
+	if !ok || path == "" || field == "" {
+		return "", fmt.Errorf("want vault:PATH#FIELD, got %q", ref)
+	}
+	addr := os.Getenv("VAULT_ADDR")
+	if addr == "" {
+		return "", fmt.Errorf("VAULT_ADDR is not set")
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimRight(addr, "/")+"/v1/"+strings.TrimPrefix(path, "/"), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Vault-Token", os.Getenv("VAULT_TOKEN"))
+	if ns := os.Getenv("VAULT_NAMESPACE"); ns != "" {
+		req.Header.Set("X-Vault-Namespace", ns)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("vault GET %s: %s", path, resp.Status)
+	}
+	var secret struct {
+		Data map[string]any `json:"data"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&secret); err != nil {
+		return "", fmt.Errorf("vault GET %s: %w", path, err)
+	}
+	// Version 2 of the KV engine nests the fields in data.data.
+	data := secret.Data
+	if nested, ok := data["data"].(map[string]any); ok {
+		if _, isMeta := data["metadata"]; isMeta {
+			data = nested
+		}
+	}
+	v, ok := data[field].(string)
+	if !ok {
+		return "", fmt.Errorf("vault secret %s has no string field %q", path, field)
+	}
+	return v, nil
+}
+
+// Refresh reloads every cached secret, keeping the old value of those that
+// fail to load.
+func (c *secretCache) Refresh() {
+	c.mu.RLock()
+	refs := make([]string, 0, len(c.values))
+	for ref := range c.values {
+		refs = append(refs, ref)
+	}
+	c.mu.RUnlock()
+	for _, ref := range refs {
+		if err := c.Load(ref); err != nil {
+			log.Printf("Secret %s not refreshed: %v", ref, err)
+		}
+	}
+}
+
+// Run refreshes the secrets every interval until ctx is done, so that
+// rotated secrets take effect without a restart.
+func (c *secretCache) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.Refresh()
+		}
+	}
+}
+
+// certificateReloader serves the certificate in certFile and keyFile,
+// picking up a renewed one every interval.
+type certificateReloader struct {
+	certFile, keyFile string
+	cert              atomic.Pointer[tls.Certificate]
+}
+
+func newCertificateReloader(certFile, keyFile string) (*certificateReloader, error) {
+	cr := &certificateReloader{certFile: certFile, keyFile: keyFile}
+	if err := cr.reload(); err != nil {
+		return nil, err
+	}
+	return cr, nil
+}
+
+func (cr *certificateReloader) reload() error {
+	cert, err := tls.LoadX509KeyPair(cr.certFile, cr.keyFile)
+	if err != nil {
+		return err
+	}
+	cr.cert.Store(&cert)
+	return nil
+}
+
+func (cr *certificateReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return cr.cert.Load(), nil
+}
+
+func (cr *certificateReloader) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := cr.reload(); err != nil {
+				log.Printf("TLS certificate not reloaded: %v", err)
+			}
+		}
+	}
+}
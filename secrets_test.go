@@ -0,0 +1,79 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSecretReferences(t *testing.T) {
+	vault := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/secret/data/echo" || r.Header.Get("X-Vault-Token") != "root" {
+			http.Error(w, "denied", http.StatusForbidden)
+			return
+		}
+		w.Write([]byte(`{"data":{"data":{"token":"from-vault"},"metadata":{"version":3}}}`))
+	}))
+	defer vault.Close()
+	t.Setenv("VAULT_ADDR", vault.URL)
+	t.Setenv("VAULT_TOKEN", "root")
+
+	path := filepath.Join(t.TempDir(), "token")
+	os.WriteFile(path, []byte("first\n"), 0o600)
+	fileRef, vaultRef := "file:"+path, "vault:secret/data/echo#token"
+	if err := secrets.Load(fileRef, vaultRef, "plain"); err != nil {
+		t.Fatal(err)
+	}
+	if got := currentSecret(fileRef); got != "first" {
+		t.Errorf("expected the file's secret without its newline, got %q", got)
+	}
+	if got := currentSecret(vaultRef); got != "from-vault" {
+		t.Errorf("expected the Vault secret, got %q", got)
+	}
+	if got := currentSecret("plain"); got != "plain" {
+		t.Errorf("expected plain values as is, got %q", got)
+	}
+
+	// Rotation takes effect on refresh; a failed refresh keeps the old value.
+	os.WriteFile(path, []byte("second"), 0o600)
+	secrets.Refresh()
+	if got := currentSecret(fileRef); got != "second" {
+		t.Errorf("expected the rotated secret, got %q", got)
+	}
+	os.Remove(path)
+	secrets.Refresh()
+	if got := currentSecret(fileRef); got != "second" {
+		t.Errorf("expected the last good secret to be kept, got %q", got)
+	}
+
+	if err := secrets.Load("vault:secret/data/echo#missing"); err == nil {
+		t.Error("expected a missing Vault field to fail")
+	}
+}
+
+func TestRequireAdminRotatesToken(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "admin")
+	os.WriteFile(path, []byte("old"), 0o600)
+	ref := "file:" + path
+	if err := secrets.Load(ref); err != nil {
+		t.Fatal(err)
+	}
+	h := requireAdmin(ref, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	status := func(token string) int {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	if status("old") != http.StatusOK {
+		t.Fatal("expected the token from the file to be accepted")
+	}
+	os.WriteFile(path, []byte("new"), 0o600)
+	secrets.Refresh()
+	if status("old") != http.StatusUnauthorized || status("new") != http.StatusOK {
+		t.Error("expected only the rotated token to be accepted")
+	}
+}
@@ -0,0 +1,356 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// version is the release this binary was built from, set with
+// -ldflags "-X main.version=v1.2.3".
+var version = "dev"
+
+// releasePublicKey is the base64 Ed25519 key release checksums are signed
+// with, set at build time like version. Without it self-update can only
+// check the checksums, which come from the same place as the binary, and
+// so only installs with -insecure.
+var releasePublicKey string
+
+// releaseRepo is where releases are published. Each release carries one
+// binary per platform named as by releaseAssetName, a checksums.txt in
+// sha256sum format and checksums.txt.sig, the base64 signature of it.
+const releaseRepo = "nickdichev/webhook-echo"
+
+var githubAPIBase = "https://api.github.com"
+
+// maxReleaseAssetSize bounds downloads, in case of a wrong or hostile URL.
+const maxReleaseAssetSize = 256 << 20
+
+type githubRelease struct {
+	TagName string `json:"tag_name"`
+	Assets  []struct {
+		Name string `json:"name"`
+		URL  string `json:"browser_download_url"`
+	} `json:"assets"`
+}
+
+func (rel githubRelease) assetURL(name string) (string, bool) {
+	for _, a := range rel.Assets {
+		if a.Name == name {
+			return a.URL, true
+		}
+	}
+	return "", false
+}
+
+func releaseAssetName(goos, goarch string) string {
+	name := "webhook-echo_" + goos + "_" + goarch
+	if goos == "windows" {
+		name += ".exe"
+	}
+	return name
+}
+
+// fetchRelease looks up the release with the given tag, or the latest one.
+func fetchRelease(client *http.Client, tag string) (githubRelease, error) {
+	endpoint := githubAPIBase + "/repos/" + releaseRepo + "/releases/latest"
+	if tag != "" {
+		endpoint = githubAPIBase + "/repos/" + releaseRepo + "/releases/tags/" + url.PathEscape(tag)
+	}
+	var rel githubRelease
+	body, err := download(client, endpoint)
+	if err != nil {
+		return rel, err
+	}
+	if err := json.Unmarshal(body, &rel); err != nil {
+		return rel, fmt.Errorf("release: %w", err)
+	}
+	return rel, nil
+}
+
+func download(client *http.Client, link string) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodGet, link, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "webhook-echo/"+version)
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", link, resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxReleaseAssetSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(body) > maxReleaseAssetSize {
+		return nil, fmt.Errorf("GET %s: larger than %d bytes", link, maxReleaseAssetSize)
+	}
+	return body, nil
+}
+
+// verifyRelease checks binary against its line in checksums and, when key is
+// set, checksums against its signature.
+func verifyRelease(name string, binary, checksums, signature []byte, key ed25519.PublicKey) error {
+	if key != nil {
+		sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(signature)))
+		if err != nil || !ed25519.Verify(key, checksums, sig) {
+			return errors.New("checksums.txt signature does not verify")
+		}
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(checksums))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 || strings.TrimPrefix(fields[1], "*") != name {
+			continue
+		}
+		sum := fields[0]
+		got := sha256.Sum256(binary)
+		if hex.EncodeToString(got[:]) != strings.ToLower(sum) {
+			return fmt.Errorf("%s does not match its checksum", name)
+		}
+		return nil
+	}
+	return fmt.Errorf("no checksum for %s", name)
+}
+
+// replaceExecutable swaps the binary at exe for binary. The new file is
+// written next to it and renamed over it, so a failed update leaves the old
+// binary in place. Windows will not replace a running executable, but lets
+// it be moved aside first.
+func replaceExecutable(exe string, binary []byte) error {
+	info, err := os.Stat(exe)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(exe), ".webhook-echo-update-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(binary); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), info.Mode().Perm()|0o111); err != nil {
+		return err
+	}
+	if runtime.GOOS == "windows" {
+		old := exe + ".old"
+		os.Remove(old)
+		if err := os.Rename(exe, old); err != nil {
+			return err
+		}
+	}
+	return os.Rename(tmp.Name(), exe)
+}
+
+// semver is a parsed release tag such as v1.2.3 or v1.3.0-rc.1. Build
+// metadata is dropped, as it does not order versions.
+type semver struct {
+	core [3]int
+	pre  []string
+}
+
+func parseSemver(s string) (semver, bool) {
+	var v semver
+	s, _, _ = strings.Cut(strings.TrimPrefix(s, "v"), "+")
+	s, pre, hasPre := strings.Cut(s, "-")
+	parts := strings.Split(s, ".")
+	if len(parts) != 3 || hasPre && pre == "" {
+		return v, false
+	}
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 || strings.HasPrefix(part, "+") {
+			return v, false
+		}
+		v.core[i] = n
+	}
+	if hasPre {
+		v.pre = strings.Split(pre, ".")
+	}
+	return v, true
+}
+
+// compare orders v and w by semver precedence: a pre-release comes before
+// its release, and its identifiers compare numerically when both are
+// numbers, with numbers before words.
+func (v semver) compare(w semver) int {
+	if c := slices.Compare(v.core[:], w.core[:]); c != 0 {
+		return c
+	}
+	if len(v.pre) == 0 || len(w.pre) == 0 {
+		return cmp.Compare(len(w.pre), len(v.pre))
+	}
+	for i := 0; i < len(v.pre) && i < len(w.pre); i++ {
+		a, aErr := strconv.Atoi(v.pre[i])
+		b, bErr := strconv.Atoi(w.pre[i])
+		var c int
+		switch {
+		case aErr == nil && bErr == nil:
+			c = cmp.Compare(a, b)
+		case aErr == nil:
+			c = -1
+		case bErr == nil:
+			c = 1
+		default:
+			c = strings.Compare(v.pre[i], w.pre[i])
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	return cmp.Compare(len(v.pre), len(w.pre))
+}
+
+// compareRelease orders the running version against a release tag,
+// negative when the release is newer. A build whose version is not a
+// semantic one, such as dev, counts as newer than any release but its own
+// tag, as does any build against a release tag that is not semantic.
+func compareRelease(running, release string) int {
+	if running == release {
+		return 0
+	}
+	cur, ok := parseSemver(running)
+	rel, relOK := parseSemver(release)
+	if !ok || !relOK {
+		return 1
+	}
+	return cur.compare(rel)
+}
+
+// selfUpdateResult is the -output form of a self-update. Status is
+// current, newer, available or updated.
+type selfUpdateResult struct {
+	Running      string `json:"running"`
+	Release      string `json:"release"`
+	Executable   string `json:"executable"`
+	Status       string `json:"status"`
+	ChecksumOnly bool   `json:"checksum_only,omitempty"`
+}
+
+// selfUpdate replaces exe with the release tagged tag, or the latest one
+// when it is newer than the running version. force reinstalls the running
+// version or moves a newer build back to the latest release; naming the
+// tag is enough to install an older one. A build without releasePublicKey
+// refuses to install unless insecure is set, as it can only check the
+// checksums, which come from the same place as the binary.
+func selfUpdate(client *http.Client, tag, exe string, checkOnly, force, insecure bool, stdout io.Writer) error {
+	rel, err := fetchRelease(client, tag)
+	if err != nil {
+		return err
+	}
+	out := &outputPrinter{w: stdout}
+	result := selfUpdateResult{Running: version, Release: rel.TagName, Executable: exe}
+	order := compareRelease(version, rel.TagName)
+	if order == 0 && !force {
+		result.Status = "current"
+		return out.Print(result, func() error {
+			_, err := fmt.Fprintf(stdout, "Already at %s\n", version)
+			return err
+		})
+	}
+	if order > 0 && tag == "" && !force {
+		result.Status = "newer"
+		return out.Print(result, func() error {
+			_, err := fmt.Fprintf(stdout, "Running %s, newer than the latest release %s\n", version, rel.TagName)
+			return err
+		})
+	}
+	if checkOnly {
+		result.Status = "available"
+		return out.Print(result, func() error {
+			_, err := fmt.Fprintf(stdout, "%s is available (running %s)\n", rel.TagName, version)
+			return err
+		})
+	}
+
+	name := releaseAssetName(runtime.GOOS, runtime.GOARCH)
+	var key ed25519.PublicKey
+	if releasePublicKey != "" {
+		k, err := base64.StdEncoding.DecodeString(releasePublicKey)
+		if err != nil || len(k) != ed25519.PublicKeySize {
+			return errors.New("built with an invalid release public key")
+		}
+		key = k
+	} else if !insecure {
+		return errors.New("built without a release key, so the release signature cannot be verified; use -insecure to trust the checksum alone")
+	}
+	assets := map[string][]byte{name: nil, "checksums.txt": nil}
+	if key != nil {
+		assets["checksums.txt.sig"] = nil
+	}
+	for asset := range assets {
+		link, ok := rel.assetURL(asset)
+		if !ok {
+			return fmt.Errorf("release %s has no %s", rel.TagName, asset)
+		}
+		if assets[asset], err = download(client, link); err != nil {
+			return err
+		}
+	}
+	if err := verifyRelease(name, assets[name], assets["checksums.txt"], assets["checksums.txt.sig"], key); err != nil {
+		return err
+	}
+	if key == nil {
+		// Said before the binary is replaced, and kept off stdout in the
+		// formats that must stay parseable.
+		warnings := stdout
+		if outputFormat != outputText {
+			warnings = os.Stderr
+		}
+		fmt.Fprintln(warnings, "Warning: built without a release key, only the checksum was verified")
+	}
+	if err := replaceExecutable(exe, assets[name]); err != nil {
+		return err
+	}
+	result.Status, result.ChecksumOnly = "updated", key == nil
+	return out.Print(result, func() error {
+		_, err := fmt.Fprintf(stdout, "Updated %s from %s to %s\n", exe, version, rel.TagName)
+		return err
+	})
+}
+
+// selfUpdateCommand is "webhook-echo self-update [-check] [-version tag]
+// [-force] [-insecure]". It replaces the running binary with a release from GitHub.
+func selfUpdateCommand(fs *flag.FlagSet) func(args []string, stdin io.Reader, stdout io.Writer) error {
+	check := fs.Bool("check", false, "Only report whether a newer release is available")
+	tag := fs.String("version", "", "Release tag to install instead of the latest")
+	force := fs.Bool("force", false, "Reinstall even when already at that release, or replace a newer build")
+	insecure := fs.Bool("insecure", false, "Install even though this build has no release key to verify the signature with")
+	return func(args []string, stdin io.Reader, stdout io.Writer) error {
+		exe, err := os.Executable()
+		if err != nil {
+			return err
+		}
+		if resolved, err := filepath.EvalSymlinks(exe); err == nil {
+			exe = resolved
+		}
+		return selfUpdate(&http.Client{Timeout: 5 * time.Minute}, *tag, exe, *check, *force, *insecure, stdout)
+	}
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// fakeReleases serves a release v2.0.0 whose checksums are signed with priv.
+func fakeReleases(t *testing.T, binary []byte, priv ed25519.PrivateKey) {
+	t.Helper()
+	name := releaseAssetName(runtime.GOOS, runtime.GOARCH)
+	sum := sha256.Sum256(binary)
+	checksums := []byte(hex.EncodeToString(sum[:]) + "  " + name + "\n")
+	sig := base64.StdEncoding.EncodeToString(ed25519.Sign(priv, checksums))
+
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/repos/" + releaseRepo + "/releases/latest", "/repos/" + releaseRepo + "/releases/tags/v2.0.0":
+			fmt.Fprintf(w, `{"tag_name":"v2.0.0","assets":[{"name":%q,"browser_download_url":"%s/bin"},
+				{"name":"checksums.txt","browser_download_url":"%s/sums"},
+				{"name":"checksums.txt.sig","browser_download_url":"%s/sig"}]}`, name, srv.URL, srv.URL, srv.URL)
+		case "/bin":
+			w.Write(binary)
+		case "/sums":
+			w.Write(checksums)
+		case "/sig":
+			w.Write([]byte(sig))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	old := githubAPIBase
+	githubAPIBase = srv.URL
+	t.Cleanup(func() { githubAPIBase = old })
+}
+
+// runningVersion makes the test binary report v for its version.
+func runningVersion(t *testing.T, v string) {
+	old := version
+	version = v
+	t.Cleanup(func() { version = old })
+}
+
+func TestSelfUpdate(t *testing.T) {
+	pub, priv, _ := ed25519.GenerateKey(nil)
+	releasePublicKey = base64.StdEncoding.EncodeToString(pub)
+	t.Cleanup(func() { releasePublicKey = "" })
+	fakeReleases(t, []byte("new binary"), priv)
+	runningVersion(t, "v1.0.0")
+
+	exe := filepath.Join(t.TempDir(), "webhook-echo")
+	os.WriteFile(exe, []byte("old binary"), 0o755)
+
+	var out bytes.Buffer
+	if err := selfUpdate(http.DefaultClient, "", exe, true, false, false, &out); err != nil || !strings.Contains(out.String(), "v2.0.0 is available") {
+		t.Fatalf("unexpected check result %q (%v)", out.String(), err)
+	}
+	if err := selfUpdate(http.DefaultClient, "", exe, false, false, false, &out); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := os.ReadFile(exe); string(got) != "new binary" {
+		t.Errorf("expected the binary to be replaced, got %q", got)
+	}
+	if info, _ := os.Stat(exe); info.Mode().Perm()&0o100 == 0 {
+		t.Errorf("expected the new binary to be executable, got %v", info.Mode())
+	}
+}
+
+func TestSelfUpdateRejectsBadSignature(t *testing.T) {
+	pub, _, _ := ed25519.GenerateKey(nil)
+	_, other, _ := ed25519.GenerateKey(nil)
+	releasePublicKey = base64.StdEncoding.EncodeToString(pub)
+	t.Cleanup(func() { releasePublicKey = "" })
+	fakeReleases(t, []byte("evil binary"), other)
+	runningVersion(t, "v1.0.0")
+
+	exe := filepath.Join(t.TempDir(), "webhook-echo")
+	os.WriteFile(exe, []byte("old binary"), 0o755)
+	if err := selfUpdate(http.DefaultClient, "", exe, false, false, false, &bytes.Buffer{}); err == nil || !strings.Contains(err.Error(), "signature") {
+		t.Fatalf("expected a signature error, got %v", err)
+	}
+	if got, _ := os.ReadFile(exe); string(got) != "old binary" {
+		t.Errorf("expected the old binary to stay, got %q", got)
+	}
+}
+
+func TestSelfUpdateNeedsReleaseKey(t *testing.T) {
+	_, priv, _ := ed25519.GenerateKey(nil)
+	fakeReleases(t, []byte("new binary"), priv)
+	runningVersion(t, "v1.0.0")
+
+	exe := filepath.Join(t.TempDir(), "webhook-echo")
+	os.WriteFile(exe, []byte("old binary"), 0o755)
+	if err := selfUpdate(http.DefaultClient, "", exe, false, false, false, &bytes.Buffer{}); err == nil || !strings.Contains(err.Error(), "-insecure") {
+		t.Fatalf("expected an update without a release key to be refused, got %v", err)
+	}
+	if got, _ := os.ReadFile(exe); string(got) != "old binary" {
+		t.Errorf("expected the old binary to stay, got %q", got)
+	}
+
+	var out bytes.Buffer
+	if err := selfUpdate(http.DefaultClient, "", exe, false, false, true, &out); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := os.ReadFile(exe); string(got) != "new binary" {
+		t.Errorf("expected -insecure to replace the binary, got %q", got)
+	}
+	if warning := strings.Index(out.String(), "Warning"); warning < 0 || warning > strings.Index(out.String(), "Updated") {
+		t.Errorf("expected the warning before the update is reported, got %q", out.String())
+	}
+}
+
+func TestSelfUpdateComparesVersions(t *testing.T) {
+	pub, priv, _ := ed25519.GenerateKey(nil)
+	releasePublicKey = base64.StdEncoding.EncodeToString(pub)
+	t.Cleanup(func() { releasePublicKey = "" })
+	fakeReleases(t, []byte("new binary"), priv)
+
+	for _, tc := range []struct {
+		running, tag string
+		force        bool
+		want         string
+	}{
+		{"v2.0.0", "", false, "Already at v2.0.0"},
+		{"v2.0.0", "", true, "Updated"},
+		{"v2.0.0-rc.1", "", false, "Updated"},
+		{"v2.1.0", "", false, "newer than the latest release"},
+		{"v10.0.0", "", false, "newer than the latest release"},
+		{"v2.1.0", "v2.0.0", false, "Updated"},
+		{"dev", "", false, "newer than the latest release"},
+		{"dev", "", true, "Updated"},
+	} {
+		runningVersion(t, tc.running)
+		exe := filepath.Join(t.TempDir(), "webhook-echo")
+		os.WriteFile(exe, []byte("old binary"), 0o755)
+
+		var out bytes.Buffer
+		if err := selfUpdate(http.DefaultClient, tc.tag, exe, false, tc.force, false, &out); err != nil {
+			t.Fatalf("%s: %v", tc.running, err)
+		}
+		if !strings.Contains(out.String(), tc.want) {
+			t.Errorf("running %s (tag %q, force %v): expected %q, got %q", tc.running, tc.tag, tc.force, tc.want, out.String())
+		}
+		got, _ := os.ReadFile(exe)
+		if updated := string(got) == "new binary"; updated != (tc.want == "Updated") {
+			t.Errorf("running %s (tag %q, force %v): unexpected binary %q", tc.running, tc.tag, tc.force, got)
+		}
+	}
+}
+
+func TestSemverOrder(t *testing.T) {
+	ordered := []string{"v1.0.0-alpha", "v1.0.0-alpha.1", "v1.0.0-alpha.beta", "v1.0.0-beta.2", "v1.0.0-beta.11", "v1.0.0-rc.1", "v1.0.0", "v1.0.1", "v1.10.0", "v2.0.0+build.5"}
+	for i := range ordered {
+		for j := range ordered {
+			a, okA := parseSemver(ordered[i])
+			b, okB := parseSemver(ordered[j])
+			if !okA || !okB {
+				t.Fatalf("expected %s and %s to parse", ordered[i], ordered[j])
+			}
+			if got, want := a.compare(b), cmp.Compare(i, j); got != want {
+				t.Errorf("compare(%s, %s) = %d, want %d", ordered[i], ordered[j], got, want)
+			}
+		}
+	}
+	for _, bad := range []string{"dev", "v1.2", "v1.2.x", "v1.2.3-", "v1.-2.3"} {
+		if _, ok := parseSemver(bad); ok {
+			t.Errorf("expected %q not to parse", bad)
+		}
+	}
+}
+
+func TestVerifyReleaseChecksum(t *testing.T) {
+	sum := sha256.Sum256([]byte("binary"))
+	checksums := []byte("00  other\n" + hex.EncodeToString(sum[:]) + " *webhook-echo_linux_amd64\n")
+	if err := verifyRelease("webhook-echo_linux_amd64", []byte("binary"), checksums, nil, nil); err != nil {
+		t.Errorf("expected the checksum to verify, got %v", err)
+	}
+	if err := verifyRelease("webhook-echo_linux_amd64", []byte("tampered"), checksums, nil, nil); err == nil {
+		t.Error("expected a checksum mismatch")
+	}
+	if err := verifyRelease("webhook-echo_darwin_arm64", []byte("binary"), checksums, nil, nil); err == nil {
+		t.Error("expected a missing checksum to be an error")
+	}
+}
@@ -0,0 +1,292 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// shadowQueueSize bounds how many webhooks may wait to be forwarded to
+	// the shadow targets before new ones are dropped.
+	shadowQueueSize = 100
+	// shadowKeep is how many comparisons the shadow diff report holds.
+	shadowKeep = 500
+	// shadowTimeout bounds each forwarded delivery.
+	shadowTimeout = 10 * time.Second
+	// shadowMaxBody is how much of each response body is kept and compared.
+	shadowMaxBody = 64 << 10
+	// shadowMaxPaths caps the differing JSON paths listed per comparison.
+	shadowMaxPaths = 20
+	// shadowDiffTag marks records whose shadow responses differed.
+	shadowDiffTag = "shadow-diff"
+)
+
+// ShadowResponse is how one shadow target answered a forwarded webhook.
+type ShadowResponse struct {
+	Status     int     `json:"status,omitempty"`
+	Body       string  `json:"body,omitempty"`
+	DurationMs float64 `json:"duration_ms"`
+	Error      string  `json:"error,omitempty"`
+}
+
+// ShadowResult compares the responses of the old and the new consumer to a
+// webhook. Paths lists the JSON paths whose values differ when both bodies
+// are JSON.
+type ShadowResult struct {
+	ID         string         `json:"id"`
+	Event      string         `json:"event"`
+	ReceivedAt time.Time      `json:"received_at"`
+	Old        ShadowResponse `json:"old"`
+	New        ShadowResponse `json:"new"`
+	StatusDiff bool           `json:"status_diff,omitempty"`
+	BodyDiff   bool           `json:"body_diff,omitempty"`
+	Paths      []string       `json:"paths,omitempty"`
+}
+
+func (r ShadowResult) matched() bool {
+	return !r.StatusDiff && !r.BodyDiff && r.Old.Error == "" && r.New.Error == ""
+}
+
+// ShadowDiff forwards each captured webhook to an old and a new consumer
+// implementation and compares their answers, to validate a rewrite against
+// real traffic. Webhooks whose answers differ are tagged shadow-diff.
+type ShadowDiff struct {
+	oldURL, newURL string
+	filter         *QueryFilter
+	client         *http.Client
+	buffer         *RingBuffer
+	jobs           chan WebhookParams
+
+	mu      sync.Mutex
+	results []ShadowResult
+	counts  shadowCounts
+}
+
+type shadowCounts struct {
+	Compared    int `json:"compared"`
+	Matched     int `json:"matched"`
+	StatusDiffs int `json:"status_diffs"`
+	BodyDiffs   int `json:"body_diffs"`
+	Errors      int `json:"errors"`
+	Dropped     int `json:"dropped"`
+}
+
+// NewShadowDiff starts forwarding to oldURL and newURL. A nil filter
+// matches every webhook.
+func NewShadowDiff(oldURL, newURL string, filter *QueryFilter, client *http.Client, buffer *RingBuffer) *ShadowDiff {
+	s := &ShadowDiff{
+		oldURL: oldURL,
+		newURL: newURL,
+		filter: filter,
+		client: client,
+		buffer: buffer,
+		jobs:   make(chan WebhookParams, shadowQueueSize),
+	}
+	go s.worker()
+	return s
+}
+
+func (s *ShadowDiff) OnIngest(item WebhookParams, body []byte) {
+	if s.filter != nil && !s.filter.Match(item) {
+		return
+	}
+	if item.Raw == nil {
+		item.Raw = body
+	}
+	select {
+	case s.jobs <- item:
+	default:
+		s.mu.Lock()
+		s.counts.Dropped++
+		s.mu.Unlock()
+		log.Printf("Shadow diff queue full, dropping %s webhook", item.EventType)
+	}
+}
+
+func (s *ShadowDiff) QueueName() string { return "shadow" }
+
+// QueueDepth is how many webhooks wait to be sent to both targets.
+func (s *ShadowDiff) QueueDepth() int { return len(s.jobs) }
+
+func (s *ShadowDiff) worker() {
+	for item := range s.jobs {
+		s.record(s.compare(context.Background(), item))
+	}
+}
+
+// compare forwards item to both targets at once and diffs the answers.
+func (s *ShadowDiff) compare(ctx context.Context, item WebhookParams) ShadowResult {
+	result := ShadowResult{ID: item.ID, Event: item.EventType, ReceivedAt: item.ReceivedAt}
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() { defer wg.Done(); result.Old = s.forward(ctx, s.oldURL, "old", item) }()
+	go func() { defer wg.Done(); result.New = s.forward(ctx, s.newURL, "new", item) }()
+	wg.Wait()
+
+	if result.Old.Error != "" || result.New.Error != "" {
+		return result
+	}
+	result.StatusDiff = result.Old.Status != result.New.Status
+	var oldJSON, newJSON any
+	if json.Unmarshal([]byte(result.Old.Body), &oldJSON) == nil && json.Unmarshal([]byte(result.New.Body), &newJSON) == nil {
+		result.Paths = jsonDiff("", oldJSON, newJSON, nil)
+		result.BodyDiff = len(result.Paths) > 0
+	} else {
+		result.BodyDiff = result.Old.Body != result.New.Body
+	}
+	return result
+}
+
+// forward posts item as it was received to target.
+func (s *ShadowDiff) forward(ctx context.Context, target, side string, item WebhookParams) ShadowResponse {
+	ctx, cancel := context.WithTimeout(ctx, shadowTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(item.Raw))
+	if err != nil {
+		return ShadowResponse{Error: err.Error()}
+	}
+	for name, values := range item.Headers {
+		switch http.CanonicalHeaderKey(name) {
+		case "Content-Length", "Connection", "Transfer-Encoding", "Te", "Trailer", "Upgrade", "Keep-Alive", "Host":
+			continue
+		}
+		req.Header[name] = values
+	}
+	if item.ContentType != "" {
+		req.Header.Set("Content-Type", item.ContentType)
+	}
+	req.Header.Set("X-Echo-Id", item.ID)
+	req.Header.Set("X-Echo-Shadow", side)
+
+	start := time.Now()
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return ShadowResponse{DurationMs: millis(time.Since(start)), Error: err.Error()}
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, shadowMaxBody))
+	out := ShadowResponse{Status: resp.StatusCode, Body: string(body), DurationMs: millis(time.Since(start))}
+	if err != nil {
+		out.Error = "reading body: " + err.Error()
+	}
+	return out
+}
+
+func (s *ShadowDiff) record(result ShadowResult) {
+	s.mu.Lock()
+	s.counts.Compared++
+	switch {
+	case result.Old.Error != "" || result.New.Error != "":
+		s.counts.Errors++
+	case result.matched():
+		s.counts.Matched++
+	}
+	if result.StatusDiff {
+		s.counts.StatusDiffs++
+	}
+	if result.BodyDiff {
+		s.counts.BodyDiffs++
+	}
+	s.results = append(s.results, result)
+	if len(s.results) > shadowKeep {
+		s.results = s.results[len(s.results)-shadowKeep:]
+	}
+	s.mu.Unlock()
+
+	if !result.matched() && result.ID != "" {
+		s.buffer.AddTag(result.ID, shadowDiffTag)
+	}
+}
+
+// jsonDiff appends to paths the paths under prefix where a and b differ,
+// stopping at shadowMaxPaths.
+func jsonDiff(prefix string, a, b any, paths []string) []string {
+	if len(paths) >= shadowMaxPaths {
+		return paths
+	}
+	am, aIsMap := a.(map[string]any)
+	bm, bIsMap := b.(map[string]any)
+	if aIsMap && bIsMap {
+		keys := make([]string, 0, len(am)+len(bm))
+		for k := range am {
+			keys = append(keys, k)
+		}
+		for k := range bm {
+			if _, ok := am[k]; !ok {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			path := k
+			if prefix != "" {
+				path = prefix + "." + k
+			}
+			paths = jsonDiff(path, am[k], bm[k], paths)
+		}
+		return paths
+	}
+	as, aIsList := a.([]any)
+	bs, bIsList := b.([]any)
+	if aIsList && bIsList && len(as) == len(bs) {
+		for i := range as {
+			paths = jsonDiff(prefix+"["+strconv.Itoa(i)+"]", as[i], bs[i], paths)
+		}
+		return paths
+	}
+	if !reflect.DeepEqual(a, b) {
+		if prefix == "" {
+			prefix = "."
+		}
+		paths = append(paths, prefix)
+	}
+	return paths
+}
+
+// ShadowReport sums up the comparisons and lists the latest, newest first.
+type ShadowReport struct {
+	Old string `json:"old"`
+	New string `json:"new"`
+	shadowCounts
+	Results []ShadowResult `json:"results"`
+}
+
+// Report returns the comparisons held, only those that differed or failed
+// when mismatched is set.
+func (s *ShadowDiff) Report(mismatched bool) ShadowReport {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	report := ShadowReport{Old: s.oldURL, New: s.newURL, shadowCounts: s.counts, Results: []ShadowResult{}}
+	for i := len(s.results) - 1; i >= 0; i-- {
+		if !mismatched || !s.results[i].matched() {
+			report.Results = append(report.Results, s.results[i])
+		}
+	}
+	return report
+}
+
+func shadowHandler(s *ShadowDiff) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		mismatched := false
+		if v := r.URL.Query().Get("mismatched"); v != "" {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				writeParamError(w, r, &paramError{codeInvalidParameter, fmt.Sprintf("mismatched must be a boolean, got %q", v)})
+				return
+			}
+			mismatched = b
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(s.Report(mismatched))
+	}
+}
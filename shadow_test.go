@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestShadowDiff(t *testing.T) {
+	consumer := func(version string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			if r.Header.Get("X-Echo-Shadow") == "" || r.Header.Get("X-Custom") != "kept" {
+				t.Errorf("unexpected forwarded headers %v", r.Header)
+			}
+			if strings.Contains(string(body), "fail") && version == "new" {
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+			w.Header().Set("Content-Type", "application/json")
+			io.WriteString(w, `{"ok":true,"version":"`+version+`"}`)
+		}))
+	}
+	oldServer, newServer := consumer("old"), consumer("old")
+	defer oldServer.Close()
+	defer newServer.Close()
+
+	buffer := NewRingBuffer(10)
+	shadow := &ShadowDiff{oldURL: oldServer.URL, newURL: newServer.URL, client: http.DefaultClient, buffer: buffer}
+	mux := http.NewServeMux()
+	registerRoutes(mux, buffer, "secret")
+
+	for _, body := range []string{`{"event":"same"}`, `{"event":"fail"}`} {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+		req.Header.Set("X-Custom", "kept")
+		mux.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	compareAll(shadow, buffer)
+	report := shadow.Report(false)
+	if report.Compared != 2 || report.Matched != 2 {
+		t.Errorf("identical consumers should match, got %+v", report.shadowCounts)
+	}
+
+	newServer.Close()
+	newServer = consumer("new")
+	defer newServer.Close()
+	shadow.newURL = newServer.URL
+	compareAll(shadow, buffer)
+	report = shadow.Report(true)
+	if report.StatusDiffs != 1 || report.BodyDiffs != 2 || len(report.Results) != 2 {
+		t.Fatalf("expected two mismatches, one with a status diff, got %+v", report)
+	}
+	if got := report.Results[0].Paths; !reflect.DeepEqual(got, []string{"version"}) {
+		t.Errorf("expected the version path to differ, got %v", got)
+	}
+	if items := queryWebhooks(t, mux, "/query/fail"); len(items) != 1 || !reflect.DeepEqual(items[0].Tags, []string{shadowDiffTag}) {
+		t.Errorf("expected the mismatched record tagged, got %+v", items)
+	}
+}
+
+// compareAll compares every buffered record, as the worker would as they
+// come in.
+func compareAll(shadow *ShadowDiff, buffer *RingBuffer) {
+	items, _ := buffer.Query(context.Background(), QueryFilter{Status: StatusFilter{StatusCode: "2xx"}})
+	for _, item := range items {
+		shadow.record(shadow.compare(context.Background(), item))
+	}
+}
+
+func TestShadowDiffHook(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer target.Close()
+	buffer := NewRingBuffer(10)
+	shadow := NewShadowDiff(target.URL, target.URL, nil, http.DefaultClient, buffer)
+	mux := http.NewServeMux()
+	registerRoutes(mux, buffer, "secret", shadow)
+	postWebhook(t, mux, `{"event":"hooked"}`)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for shadow.Report(false).Compared == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if report := shadow.Report(false); report.Matched != 1 {
+		t.Errorf("expected one matched comparison, got %+v", report)
+	}
+}
+
+func TestJSONDiff(t *testing.T) {
+	a := map[string]any{"a": 1.0, "b": []any{1.0, 2.0}, "c": map[string]any{"d": "x"}}
+	b := map[string]any{"a": 1.0, "b": []any{1.0, 3.0}, "c": map[string]any{"d": "y"}, "e": true}
+	want := []string{"b[1]", "c.d", "e"}
+	if got := jsonDiff("", a, b, nil); !reflect.DeepEqual(got, want) {
+		t.Errorf("jsonDiff = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultShareTTL = 24 * time.Hour
+	maxShareTTL     = 30 * 24 * time.Hour
+)
+
+// shareKey signs share links unless -share-secret is set, so by default
+// links stop working when the server restarts.
+var shareKey = func() []byte {
+	key := make([]byte, 32)
+	rand.Read(key)
+	return key
+}()
+
+// redacted replaces the values of sensitive headers and payload fields in
+// shared records.
+const redacted = "[redacted]"
+
+// sensitiveNames are the substrings that make a header or payload key
+// sensitive, compared in lower case with - and _ removed.
+var sensitiveNames = []string{
+	"authorization", "cookie", "password", "passwd", "secret", "token",
+	"apikey", "signature", "credential", "session", "cardnumber", "cvv", "cvc", "ssn",
+}
+
+func isSensitive(name string) bool {
+	name = strings.NewReplacer("-", "", "_", "").Replace(strings.ToLower(name))
+	for _, s := range sensitiveNames {
+		if strings.Contains(name, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// forwardingHeaders carry the sender's address through proxies. Shared
+// records leave them out along with Client.
+var forwardingHeaders = []string{
+	"Forwarded", "X-Forwarded-For", "X-Real-IP", "X-Client-IP", "True-Client-IP",
+	"CF-Connecting-IP", "CF-IPCountry", "Fastly-Client-IP",
+}
+
+// redactRecord returns the copy of item a share link shows: sensitive
+// headers, trailers and payload fields are masked, and the sender's address,
+// forwarding headers, the raw body and attachments are left out. The preview of a truncated
+// record is taken from the masked payload, as the body's own is not.
+func redactRecord(item WebhookParams) WebhookParams {
+	item.Headers = redactHeaders(item.Headers)
+	for _, name := range forwardingHeaders {
+		item.Headers.Del(name)
+	}
+	if item.Transfer != nil {
+		transfer := *item.Transfer
+		transfer.Trailers = redactHeaders(transfer.Trailers)
+		item.Transfer = &transfer
+	}
+	item.Payload, _ = redactValue(item.Payload).(map[string]any)
+	item.Client, item.Raw, item.Attachments = nil, nil, nil
+	if item.Truncation != nil {
+		truncation := *item.Truncation
+		truncation.Preview = ""
+		if body, _, err := webhookBody(item); err == nil {
+			truncation.Preview = truncatePreview(body)
+		}
+		item.Truncation = &truncation
+	}
+	return item
+}
+
+func redactHeaders(h http.Header) http.Header {
+	if h == nil {
+		return nil
+	}
+	h = h.Clone()
+	for name, values := range h {
+		if isSensitive(name) {
+			for i := range values {
+				values[i] = redacted
+			}
+		}
+	}
+	return h
+}
+
+func redactValue(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		if v == nil {
+			return v
+		}
+		out := make(map[string]any, len(v))
+		for key, value := range v {
+			if isSensitive(key) {
+				out[key] = redacted
+			} else {
+				out[key] = redactValue(value)
+			}
+		}
+		return out
+	case []any:
+		out := make([]any, len(v))
+		for i, value := range v {
+			out[i] = redactValue(value)
+		}
+		return out
+	}
+	return v
+}
+
+// shareToken signs id and the expiry into an opaque token: the base64 of
+// "id.expiry" and of its HMAC, joined by a dot.
+func shareToken(id string, expires time.Time) string {
+	payload := id + "." + strconv.FormatInt(expires.Unix(), 10)
+	return base64.RawURLEncoding.EncodeToString([]byte(payload)) + "." + base64.RawURLEncoding.EncodeToString(shareMAC(payload))
+}
+
+// shareSecret, set by -share-secret, replaces shareKey. It may be a secret
+// reference, so that rotating it revokes the links signed with the old one.
+var shareSecret string
+
+func shareMAC(payload string) []byte {
+	key := shareKey
+	if shareSecret != "" {
+		key = []byte(currentSecret(shareSecret))
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
+
+var (
+	errInvalidShareToken = errors.New("invalid share link")
+	errShareExpired      = errors.New("share link expired")
+)
+
+// parseShareToken returns the record ID a token grants access to.
+func parseShareToken(token string, now time.Time) (string, error) {
+	encoded, sig, ok := strings.Cut(token, ".")
+	if !ok {
+		return "", errInvalidShareToken
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", errInvalidShareToken
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil || !hmac.Equal(mac, shareMAC(string(payload))) {
+		return "", errInvalidShareToken
+	}
+	id, expiry, _ := strings.Cut(string(payload), ".")
+	unix, err := strconv.ParseInt(expiry, 10, 64)
+	if err != nil {
+		return "", errInvalidShareToken
+	}
+	if !now.Before(time.Unix(unix, 0)) {
+		return "", errShareExpired
+	}
+	return id, nil
+}
+
+// shareURL, set by -share-url, is the origin share links point at. Without
+// it links use the host the share was requested on, or, when the APIs are
+// on -admin-addr, that host with the port and scheme of sharedListener.
+var shareURL string
+
+// sharedListener is the ingest listener that serves /shared/{token} when
+// the APIs are on a separate -admin-addr.
+var sharedListener struct {
+	addr string
+	tls  bool
+}
+
+// shareOrigin returns the scheme and host share links requested with r
+// point at.
+func shareOrigin(r *http.Request) string {
+	if shareURL != "" {
+		return strings.TrimSuffix(shareURL, "/")
+	}
+	client := clientInfo(r)
+	if sharedListener.addr == "" {
+		return client.Proto + "://" + client.Host
+	}
+	host, port, err := net.SplitHostPort(sharedListener.addr)
+	if err != nil {
+		return client.Proto + "://" + client.Host
+	}
+	if ip := net.ParseIP(host); host == "" || ip != nil && ip.IsUnspecified() {
+		host = client.Host
+		if h, _, err := net.SplitHostPort(client.Host); err == nil {
+			host = h
+		}
+		host = strings.Trim(host, "[]")
+	}
+	proto := "http"
+	if sharedListener.tls {
+		proto = "https"
+	}
+	return proto + "://" + net.JoinHostPort(host, port)
+}
+
+type shareRequest struct {
+	TTL jsonDuration `json:"ttl"`
+}
+
+type shareResponse struct {
+	URL       string    `json:"url"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// shareHandler serves POST /webhooks/{id}/share, which answers with a
+// public, read-only link to the redacted record. The optional body sets the
+// link's lifetime, {"ttl": "2h"}, by default a day and at most 30 days.
+// Creating a link takes the admin token; opening one does not.
+func shareHandler(buffer *RingBuffer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := r.PathValue("id")
+		if _, ok := buffer.Get(id); !ok {
+			writeProblem(w, r, http.StatusNotFound, codeNotFound, "No webhook with id "+id)
+			return
+		}
+		var req shareRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+			writeProblem(w, r, http.StatusBadRequest, codeInvalidJSON, "Invalid JSON: "+err.Error())
+			return
+		}
+		ttl := req.TTL.Duration
+		if ttl == 0 {
+			ttl = defaultShareTTL
+		}
+		if ttl < 0 || ttl > maxShareTTL {
+			writeProblem(w, r, http.StatusBadRequest, codeInvalidParameter, fmt.Sprintf("ttl must be positive and at most %s", maxShareTTL))
+			return
+		}
+
+		expires := time.Now().Add(ttl).Truncate(time.Second).UTC()
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(shareResponse{
+			URL:       shareOrigin(r) + externalPath("/shared/"+shareToken(id, expires)),
+			ExpiresAt: expires,
+		})
+	}
+}
+
+// sharedWebhookHandler serves GET /shared/{token}, the public side of a
+// share link. It is mounted on the ingest listener too, so links work when
+// the APIs are only reachable on -admin-addr.
+func sharedWebhookHandler(buffer *RingBuffer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := parseShareToken(r.PathValue("token"), time.Now())
+		if err == errShareExpired {
+			writeProblem(w, r, http.StatusGone, codeLinkExpired, "This share link has expired")
+			return
+		}
+		item, ok := buffer.Get(id)
+		if err != nil || !ok {
+			writeProblem(w, r, http.StatusNotFound, codeNotFound, "No such shared webhook")
+			return
+		}
+		w.Header().Set("Cache-Control", "private, no-store")
+		w.Header().Set("X-Robots-Tag", "noindex")
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(redactRecord(item))
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestShareLink(t *testing.T) {
+	mux := newTestServer()
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"event": "charge", "data": {"amount": 5, "card": {"card_number": "4242", "last4": "4242"}, "api_key": "sk_live"}}`))
+	req.Header.Set("Authorization", "Bearer hunter2")
+	req.Header.Set("Stripe-Signature", "t=1,v1=abc")
+	req.Header.Set("User-Agent", "Stripe/1.0")
+	req.Header.Set("X-Forwarded-For", "203.0.113.7")
+	req.Header.Set("X-Real-IP", "203.0.113.7")
+	req.Header.Set("Forwarded", "for=203.0.113.7")
+	mux.ServeHTTP(httptest.NewRecorder(), req)
+	id := queryWebhooks(t, mux, "/query/charge?amount=5")[0].ID
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, adminRequest(http.MethodPost, "/v1/webhooks/"+id+"/share", bytes.NewBufferString(`{"ttl": "1h"}`)))
+	var share shareResponse
+	json.NewDecoder(rec.Body).Decode(&share)
+	if rec.Code != http.StatusCreated || !strings.HasPrefix(share.URL, "http://example.com/shared/") || time.Until(share.ExpiresAt) > time.Hour {
+		t.Fatalf("unexpected share response %d %+v", rec.Code, share)
+	}
+
+	link, _ := url.Parse(share.URL)
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, link.Path, nil))
+	var shared WebhookParams
+	json.NewDecoder(rec.Body).Decode(&shared)
+	if rec.Code != http.StatusOK || shared.ID != id {
+		t.Fatalf("expected the shared record, got %d %s", rec.Code, rec.Body)
+	}
+	card, _ := shared.Payload["card"].(map[string]any)
+	if shared.Payload["api_key"] != redacted || card["card_number"] != redacted || card["last4"] != "4242" || shared.Payload["amount"] != 5.0 {
+		t.Errorf("expected sensitive payload fields masked, got %v", shared.Payload)
+	}
+	if shared.Headers.Get("Authorization") != redacted || shared.Headers.Get("Stripe-Signature") != redacted || shared.Headers.Get("User-Agent") != "Stripe/1.0" || shared.Client != nil {
+		t.Errorf("expected sensitive headers masked, got %v %+v", shared.Headers, shared.Client)
+	}
+	for _, name := range []string{"X-Forwarded-For", "X-Real-IP", "Forwarded"} {
+		if shared.Headers.Get(name) != "" {
+			t.Errorf("expected %s left out of the shared record, got %q", name, shared.Headers.Get(name))
+		}
+	}
+
+	tampered := strings.Replace(link.Path, "/shared/", "/shared/x", 1)
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tampered, nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("expected a tampered link to be refused, got %d", rec.Code)
+	}
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/shared/"+shareToken(id, time.Now().Add(-time.Second)), nil))
+	if p := decodeProblem(t, rec); rec.Code != http.StatusGone || p.Code != codeLinkExpired {
+		t.Errorf("expected an expired link to answer 410, got %d %+v", rec.Code, p)
+	}
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, adminRequest(http.MethodPost, "/v1/webhooks/"+id+"/share", bytes.NewBufferString(`{"ttl": "1000h"}`)))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected a ttl past 30 days to be refused, got %d", rec.Code)
+	}
+}
+
+func TestShareLinkOrigin(t *testing.T) {
+	t.Cleanup(func() { sharedListener.addr, sharedListener.tls, shareURL = "", false, "" })
+	req := httptest.NewRequest(http.MethodPost, "/v1/webhooks/x/share", nil)
+	req.Host = "127.0.0.1:9090"
+
+	sharedListener.addr, sharedListener.tls = ":8443", true
+	if got := shareOrigin(req); got != "https://127.0.0.1:8443" {
+		t.Errorf("expected links on the ingest listener, got %q", got)
+	}
+	sharedListener.addr, sharedListener.tls = "10.0.0.5:8080", false
+	if got := shareOrigin(req); got != "http://10.0.0.5:8080" {
+		t.Errorf("expected the ingest listener's own address, got %q", got)
+	}
+	shareURL = "https://hooks.example.com/"
+	if got := shareOrigin(req); got != "https://hooks.example.com" {
+		t.Errorf("expected -share-url to win, got %q", got)
+	}
+}
+
+func TestShareLinkTruncatedRecord(t *testing.T) {
+	inlineBodyLimit = 64
+	t.Cleanup(func() { inlineBodyLimit = 0 })
+	mux := newTestServer()
+	postWebhook(t, mux, `{"event": "signup", "data": {"api_token": "hunter2", "notes": "`+strings.Repeat("n", 200)+`"}}`)
+	id := queryWebhooks(t, mux, "/query/signup")[0].ID
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, adminRequest(http.MethodPost, "/v1/webhooks/"+id+"/share", nil))
+	var share shareResponse
+	json.NewDecoder(rec.Body).Decode(&share)
+	link, _ := url.Parse(share.URL)
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, link.Path, nil))
+	if rec.Code != http.StatusOK || strings.Contains(rec.Body.String(), "hunter2") {
+		t.Fatalf("expected the shared record masked, got %d %s", rec.Code, rec.Body)
+	}
+	var shared WebhookParams
+	json.NewDecoder(rec.Body).Decode(&shared)
+	if shared.Truncation == nil || !strings.Contains(shared.Truncation.Preview, redacted) {
+		t.Errorf("expected the preview taken from the masked payload, got %+v", shared.Truncation)
+	}
+}
+
+func TestShareLinkWithoutAdminToken(t *testing.T) {
+	buffer := NewRingBuffer(1)
+	stored, _ := buffer.Push(WebhookParams{EventType: "charge"})
+	mux := http.NewServeMux()
+	registerRoutes(mux, buffer, "")
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, adminRequest(http.MethodPost, "/v1/webhooks/"+stored.ID+"/share", nil))
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("expected status 403 without a configured admin token, got %d", rec.Code)
+	}
+}
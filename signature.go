@@ -0,0 +1,248 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// SignatureScheme describes how a provider signs webhook bodies.
+type SignatureScheme struct {
+	Name string
+	hash func() hash.Hash
+	// message builds the signed bytes from the body and timestamp.
+	message func(body []byte, timestamp string) []byte
+	// format renders the MAC as the provider's header value.
+	format func(mac []byte, timestamp string) string
+	// extract pulls the bare signature out of a header value.
+	extract func(header string) string
+	// needsTimestamp is set for schemes that sign a timestamp too.
+	needsTimestamp bool
+	// header carries the signature. timestampHeader carries the timestamp
+	// for schemes that send it separately.
+	header          string
+	timestampHeader string
+}
+
+// Verification records whether a captured request carried a valid
+// signature, and under which scheme.
+type Verification struct {
+	Scheme   string `json:"scheme"`
+	Verified bool   `json:"verified"`
+	Detail   string `json:"detail,omitempty"`
+	// Secret says which configured secret matched, "primary" or
+	// "secondary", when a verify rule accepts two.
+	Secret string `json:"secret,omitempty"`
+}
+
+func rawBody(body []byte, _ string) []byte { return body }
+func hexMAC(mac []byte, _ string) string   { return hex.EncodeToString(mac) }
+func identity(header string) string        { return header }
+
+var signatureSchemes = map[string]SignatureScheme{
+	"hmac-sha1":   {Name: "hmac-sha1", hash: sha1.New, message: rawBody, format: hexMAC, extract: identity, header: "X-Signature", timestampHeader: "X-Signature-Timestamp"},
+	"hmac-sha256": {Name: "hmac-sha256", hash: sha256.New, message: rawBody, format: hexMAC, extract: identity, header: "X-Signature", timestampHeader: "X-Signature-Timestamp"},
+	"hmac-sha512": {Name: "hmac-sha512", hash: sha512.New, message: rawBody, format: hexMAC, extract: identity, header: "X-Signature", timestampHeader: "X-Signature-Timestamp"},
+	"github": {
+		Name: "github", hash: sha256.New, message: rawBody, header: "X-Hub-Signature-256",
+		format:  func(mac []byte, _ string) string { return "sha256=" + hex.EncodeToString(mac) },
+		extract: func(h string) string { return strings.TrimPrefix(h, "sha256=") },
+	},
+	"shopify": {
+		Name: "shopify", hash: sha256.New, message: rawBody, header: "X-Shopify-Hmac-Sha256",
+		format:  func(mac []byte, _ string) string { return base64.StdEncoding.EncodeToString(mac) },
+		extract: identity,
+	},
+	"stripe": {
+		Name: "stripe", hash: sha256.New, needsTimestamp: true, header: "Stripe-Signature",
+		message: func(body []byte, ts string) []byte { return append([]byte(ts+"."), body...) },
+		format:  func(mac []byte, ts string) string { return "t=" + ts + ",v1=" + hex.EncodeToString(mac) },
+		extract: func(h string) string {
+			for _, part := range strings.Split(h, ",") {
+				if sig, ok := strings.CutPrefix(strings.TrimSpace(part), "v1="); ok {
+					return sig
+				}
+			}
+			return h
+		},
+	},
+	"slack": {
+		Name: "slack", hash: sha256.New, needsTimestamp: true,
+		header: "X-Slack-Signature", timestampHeader: "X-Slack-Request-Timestamp",
+		message: func(body []byte, ts string) []byte { return append([]byte("v0:"+ts+":"), body...) },
+		format:  func(mac []byte, _ string) string { return "v0=" + hex.EncodeToString(mac) },
+		extract: func(h string) string { return strings.TrimPrefix(h, "v0=") },
+	},
+}
+
+func signatureSchemeNames() []string {
+	names := make([]string, 0, len(signatureSchemes))
+	for name := range signatureSchemes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// MAC computes the raw MAC of body under the scheme.
+func (s SignatureScheme) MAC(secret string, body []byte, timestamp string) []byte {
+	m := hmac.New(s.hash, []byte(secret))
+	m.Write(s.message(body, timestamp))
+	return m.Sum(nil)
+}
+
+// Sign returns the header value a provider would send for body.
+func (s SignatureScheme) Sign(secret string, body []byte, timestamp string) string {
+	return s.format(s.MAC(secret, body, timestamp), timestamp)
+}
+
+// Verify checks a received header value in constant time, accepting the MAC
+// in either hex or base64 encoding.
+func (s SignatureScheme) Verify(secret string, body []byte, timestamp, header string) bool {
+	mac := s.MAC(secret, body, timestamp)
+	return macMatches(mac, s.extract(strings.TrimSpace(header)))
+}
+
+func macMatches(mac []byte, provided string) bool {
+	if decoded, err := hex.DecodeString(provided); err == nil && hmac.Equal(decoded, mac) {
+		return true
+	}
+	if decoded, err := base64.StdEncoding.DecodeString(provided); err == nil && hmac.Equal(decoded, mac) {
+		return true
+	}
+	return false
+}
+
+type signatureDebugRequest struct {
+	Body      string `json:"body"`
+	Secret    string `json:"secret"`
+	Scheme    string `json:"scheme"`
+	Timestamp string `json:"timestamp,omitempty"`
+	Header    string `json:"header,omitempty"`
+}
+
+type signatureDebugResponse struct {
+	Scheme   string   `json:"scheme"`
+	Expected string   `json:"expected"`
+	Hex      string   `json:"hex"`
+	Base64   string   `json:"base64"`
+	Provided string   `json:"provided,omitempty"`
+	Match    *bool    `json:"match,omitempty"`
+	Pitfalls []string `json:"pitfalls,omitempty"`
+}
+
+// signaturePitfalls flags problems with the provided header. When it does not
+// verify, the signature is recomputed under common mistakes and the ones that
+// would explain the mismatch are reported.
+func signaturePitfalls(s SignatureScheme, req signatureDebugRequest) []string {
+	var pitfalls []string
+	body := []byte(req.Body)
+	header := strings.TrimSpace(req.Header)
+	provided := s.extract(header)
+	mac := s.MAC(req.Secret, body, req.Timestamp)
+
+	if header != req.Header {
+		pitfalls = append(pitfalls, "Header value has leading or trailing whitespace")
+	}
+	if prefix, rest, ok := strings.Cut(provided, "="); ok && len(prefix) <= 8 && macMatches(mac, rest) {
+		pitfalls = append(pitfalls, fmt.Sprintf("Header carries a %q prefix this scheme does not use", prefix+"="))
+	}
+	if provided != strings.ToLower(provided) && hex.EncodeToString(mac) == strings.ToLower(provided) {
+		pitfalls = append(pitfalls, "Hex digest is upper-case; decode it before comparing instead of comparing strings")
+	}
+	if s.needsTimestamp && req.Timestamp == "" {
+		pitfalls = append(pitfalls, "Scheme signs a timestamp but none was given")
+	}
+	if strings.HasPrefix(req.Secret, "whsec_") && s.Name != "stripe" {
+		pitfalls = append(pitfalls, "Secret looks like a Stripe signing secret")
+	}
+	if macMatches(mac, provided) {
+		return pitfalls
+	}
+
+	// Each variant recomputes the MAC the way a buggy sender or verifier
+	// commonly does.
+	variants := []struct {
+		secret string
+		body   []byte
+		note   string
+	}{
+		{req.Secret, append(bytes.Clone(body), '\n'), "Signature covers the body plus a trailing newline"},
+		{req.Secret, bytes.TrimRight(body, "\r\n"), "Signature covers the body without its trailing newline"},
+		{strings.TrimSpace(req.Secret), body, "Secret has surrounding whitespace; the signature matches the trimmed secret"},
+		{req.Secret, compactJSON(body), "Signature covers re-serialised JSON; sign and verify the raw bytes, not a parsed and re-encoded body"},
+	}
+	for _, v := range variants {
+		if v.body == nil || (v.secret == req.Secret && bytes.Equal(v.body, body)) {
+			continue
+		}
+		if macMatches(s.MAC(v.secret, v.body, req.Timestamp), provided) {
+			pitfalls = append(pitfalls, v.note)
+		}
+	}
+
+	var others []string
+	for _, name := range signatureSchemeNames() {
+		if name != s.Name && signatureSchemes[name].Verify(req.Secret, body, req.Timestamp, header) {
+			others = append(others, name)
+		}
+	}
+	if len(others) > 0 {
+		pitfalls = append(pitfalls, "Signature matches scheme "+strings.Join(others, ", ")+" instead")
+	}
+	return pitfalls
+}
+
+func compactJSON(body []byte) []byte {
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, body); err != nil {
+		return nil
+	}
+	return buf.Bytes()
+}
+
+func signatureDebugHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req signatureDebugRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeProblem(w, r, http.StatusBadRequest, codeInvalidJSON, "Invalid JSON: "+err.Error())
+			return
+		}
+		if req.Scheme == "" {
+			req.Scheme = "hmac-sha256"
+		}
+		scheme, ok := signatureSchemes[req.Scheme]
+		if !ok {
+			writeProblem(w, r, http.StatusBadRequest, codeInvalidParameter,
+				fmt.Sprintf("Unknown scheme %q, available: %s", req.Scheme, strings.Join(signatureSchemeNames(), ", ")))
+			return
+		}
+
+		mac := scheme.MAC(req.Secret, []byte(req.Body), req.Timestamp)
+		resp := signatureDebugResponse{
+			Scheme:   scheme.Name,
+			Expected: scheme.format(mac, req.Timestamp),
+			Hex:      hex.EncodeToString(mac),
+			Base64:   base64.StdEncoding.EncodeToString(mac),
+		}
+		if req.Header != "" {
+			match := scheme.Verify(req.Secret, []byte(req.Body), req.Timestamp, req.Header)
+			resp.Provided = req.Header
+			resp.Match = &match
+			resp.Pitfalls = signaturePitfalls(scheme, req)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func debugSignature(t *testing.T, req signatureDebugRequest) (int, signatureDebugResponse) {
+	t.Helper()
+	body, _ := json.Marshal(req)
+	rec := httptest.NewRecorder()
+	signatureDebugHandler()(rec, httptest.NewRequest(http.MethodPost, "/debug/signature", bytes.NewReader(body)))
+
+	var resp signatureDebugResponse
+	if rec.Code == http.StatusOK {
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatalf("decode response: %v", err)
+		}
+	}
+	return rec.Code, resp
+}
+
+func TestSignSchemes(t *testing.T) {
+	tests := []struct {
+		scheme, timestamp, want string
+	}{
+		// Reference value from GitHub's webhook validation docs.
+		{"github", "", "sha256=757107ea0eb2509fc211221cce984b8a37570b6d7586c22c46f4379c8b043e17"},
+		{"hmac-sha256", "", "757107ea0eb2509fc211221cce984b8a37570b6d7586c22c46f4379c8b043e17"},
+		{"stripe", "1700000000", "t=1700000000,v1="},
+		{"slack", "1700000000", "v0="},
+	}
+	for _, tt := range tests {
+		got := signatureSchemes[tt.scheme].Sign("It's a Secret to Everybody", []byte("Hello, World!"), tt.timestamp)
+		if !strings.HasPrefix(got, tt.want) {
+			t.Errorf("%s: got %q, want prefix %q", tt.scheme, got, tt.want)
+		}
+	}
+}
+
+func TestVerifyAcceptsHexAndBase64(t *testing.T) {
+	s := signatureSchemes["hmac-sha256"]
+	mac := s.MAC("secret", []byte("body"), "")
+	for _, header := range []string{hexMAC(mac, ""), signatureSchemes["shopify"].format(mac, "")} {
+		if !s.Verify("secret", []byte("body"), "", header) {
+			t.Errorf("expected %q to verify", header)
+		}
+	}
+	if s.Verify("other", []byte("body"), "", hexMAC(mac, "")) {
+		t.Error("expected verification with the wrong secret to fail")
+	}
+}
+
+func TestSignatureDebugMatch(t *testing.T) {
+	expected := signatureSchemes["github"].Sign("s3cret", []byte(`{"a":1}`), "")
+
+	code, resp := debugSignature(t, signatureDebugRequest{Body: `{"a":1}`, Secret: "s3cret", Scheme: "github", Header: expected})
+	if code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", code)
+	}
+	if resp.Expected != expected || resp.Match == nil || !*resp.Match {
+		t.Errorf("expected a match against %q, got %+v", expected, resp)
+	}
+	if len(resp.Pitfalls) != 0 {
+		t.Errorf("expected no pitfalls on a match, got %v", resp.Pitfalls)
+	}
+}
+
+func TestSignatureDebugPitfalls(t *testing.T) {
+	body := "{\n  \"a\": 1\n}\n"
+	sha := signatureSchemes["hmac-sha256"]
+
+	tests := []struct {
+		name   string
+		req    signatureDebugRequest
+		header string
+		match  bool
+		want   string
+	}{
+		{
+			name:   "prefix",
+			req:    signatureDebugRequest{Scheme: "hmac-sha256"},
+			header: "sha256=" + sha.Sign("k", []byte(body), ""),
+			want:   `"sha256=" prefix`,
+		},
+		{
+			name:   "upper-case hex",
+			req:    signatureDebugRequest{Scheme: "hmac-sha256"},
+			header: strings.ToUpper(sha.Sign("k", []byte(body), "")),
+			match:  true,
+			want:   "upper-case",
+		},
+		{
+			name:   "stripped newline",
+			req:    signatureDebugRequest{Scheme: "hmac-sha256"},
+			header: sha.Sign("k", []byte(strings.TrimRight(body, "\n")), ""),
+			want:   "without its trailing newline",
+		},
+		{
+			name:   "re-serialised JSON",
+			req:    signatureDebugRequest{Scheme: "hmac-sha256"},
+			header: sha.Sign("k", []byte(`{"a":1}`), ""),
+			want:   "re-serialised JSON",
+		},
+		{
+			name:   "wrong scheme",
+			req:    signatureDebugRequest{Scheme: "hmac-sha1"},
+			header: sha.Sign("k", []byte(body), ""),
+			want:   "hmac-sha256",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.req.Body, tt.req.Secret, tt.req.Header = body, "k", tt.header
+			_, resp := debugSignature(t, tt.req)
+			if resp.Match == nil || *resp.Match != tt.match {
+				t.Fatalf("expected match=%v, got %+v", tt.match, resp)
+			}
+			found := false
+			for _, p := range resp.Pitfalls {
+				if strings.Contains(p, tt.want) {
+					found = true
+				}
+			}
+			if !found {
+				t.Errorf("expected a pitfall mentioning %q, got %v", tt.want, resp.Pitfalls)
+			}
+		})
+	}
+}
+
+func TestSignatureDebugUnknownScheme(t *testing.T) {
+	code, _ := debugSignature(t, signatureDebugRequest{Scheme: "rot13"})
+	if code != http.StatusBadRequest {
+		t.Errorf("expected status 400, got %d", code)
+	}
+}
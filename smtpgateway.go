@@ -0,0 +1,325 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/http"
+	"net/mail"
+	"net/textproto"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Limits on an SMTP session. Messages are limited to -max-body-size, or to
+// smtpMaxMessageSize when that is unset.
+const (
+	smtpMaxMessageSize = 32 << 20
+	smtpMaxRecipients  = 100
+	smtpMaxLine        = 4096
+	smtpMaxPartDepth   = 10
+	smtpCommandTimeout = 5 * time.Minute
+)
+
+// SMTPGateway accepts mail over SMTP and records each message as an "email"
+// webhook. It is a sink for notification services that can only send mail:
+// it accepts any sender and recipient and relays nothing. There is no AUTH
+// or STARTTLS, so it belongs on a private network.
+type SMTPGateway struct {
+	recorder *Recorder
+	hostname string
+}
+
+func NewSMTPGateway(recorder *Recorder) *SMTPGateway {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "webhook-echo"
+	}
+	return &SMTPGateway{recorder: recorder, hostname: hostname}
+}
+
+// ListenAndServe listens on addr and serves SMTP.
+func (g *SMTPGateway) ListenAndServe(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	log.Printf("SMTP gateway listening on %s", addr)
+	return g.Serve(l)
+}
+
+// Serve accepts SMTP connections on l until it is closed.
+func (g *SMTPGateway) Serve(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go g.serveConn(conn)
+	}
+}
+
+func (g *SMTPGateway) serveConn(conn net.Conn) {
+	defer conn.Close()
+	br := bufio.NewReaderSize(conn, smtpMaxLine)
+	w := textproto.NewWriter(bufio.NewWriter(conn))
+	reply := func(format string, args ...any) error { return w.PrintfLine(format, args...) }
+
+	limit := int64(smtpMaxMessageSize)
+	if maxBodySize > 0 {
+		limit = maxBodySize
+	}
+	remote, _, _ := net.SplitHostPort(conn.RemoteAddr().String())
+	var from string
+	var to []string
+	var inTransaction bool
+
+	reply("220 %s webhook-echo ESMTP ready", g.hostname)
+	for {
+		conn.SetDeadline(time.Now().Add(smtpCommandTimeout))
+		line, err := br.ReadSlice('\n')
+		if err == bufio.ErrBufferFull {
+			reply("500 Line too long")
+			return
+		}
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(strings.TrimRight(string(line), "\r\n"), " ")
+		switch strings.ToUpper(verb) {
+		case "HELO":
+			err = reply("250 %s", g.hostname)
+		case "EHLO":
+			err = reply("250-%s\r\n250-8BITMIME\r\n250-SMTPUTF8\r\n250 SIZE %d", g.hostname, limit)
+		case "MAIL":
+			addr, ok := smtpPath(arg, "FROM:")
+			if !ok {
+				err = reply("501 Syntax: MAIL FROM:<address>")
+				break
+			}
+			from, to, inTransaction = addr, nil, true
+			err = reply("250 OK")
+		case "RCPT":
+			addr, ok := smtpPath(arg, "TO:")
+			switch {
+			case !inTransaction:
+				err = reply("503 MAIL first")
+			case !ok || addr == "":
+				err = reply("501 Syntax: RCPT TO:<address>")
+			case len(to) == smtpMaxRecipients:
+				err = reply("452 Too many recipients")
+			default:
+				to = append(to, addr)
+				err = reply("250 OK")
+			}
+		case "DATA":
+			if len(to) == 0 {
+				err = reply("503 RCPT first")
+				break
+			}
+			if err = reply("354 End data with <CR><LF>.<CR><LF>"); err != nil {
+				break
+			}
+			dot := textproto.NewReader(br).DotReader()
+			raw, readErr := io.ReadAll(io.LimitReader(dot, limit+1))
+			if readErr != nil {
+				return
+			}
+			if int64(len(raw)) > limit {
+				if _, err := io.Copy(io.Discard, dot); err != nil {
+					return
+				}
+				err = reply("552 Message exceeds %d bytes", limit)
+			} else if item, parseErr := parseEmail(raw, from, to); parseErr != nil {
+				err = reply("554 Invalid message: %s", strings.ReplaceAll(parseErr.Error(), "\n", " "))
+			} else {
+				item.Source = "smtp://" + remote
+				stored, _ := g.recorder.Record(item, raw)
+				err = reply("250 OK queued as %s", stored.ID)
+			}
+			from, to, inTransaction = "", nil, false
+		case "RSET":
+			from, to, inTransaction = "", nil, false
+			err = reply("250 OK")
+		case "NOOP":
+			err = reply("250 OK")
+		case "VRFY":
+			err = reply("252 Cannot verify, but will accept")
+		case "QUIT":
+			reply("221 Bye")
+			return
+		default:
+			err = reply("502 %s not implemented", verb)
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// smtpPath returns the address in a MAIL or RCPT argument such as
+// "FROM:<a@example.com> SIZE=100". The null sender <> is allowed.
+func smtpPath(arg, prefix string) (string, bool) {
+	if len(arg) < len(prefix) || !strings.EqualFold(arg[:len(prefix)], prefix) {
+		return "", false
+	}
+	path := strings.TrimSpace(arg[len(prefix):])
+	if !strings.HasPrefix(path, "<") {
+		return "", false
+	}
+	addr, _, ok := strings.Cut(path[1:], ">")
+	return addr, ok
+}
+
+// parseEmail turns a message into an "email" webhook. The payload carries
+// the envelope, the decoded subject and addresses, the first text/plain and
+// text/html bodies and a summary of every MIME part; parts with a filename
+// become attachments of the record, as far as the attachment limits allow.
+// The Message-ID is the idempotency key, so a re-sent message counts as a
+// redelivery.
+func parseEmail(raw []byte, from string, to []string) (WebhookParams, error) {
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return WebhookParams{}, err
+	}
+	dec := new(mime.WordDecoder)
+	header := func(name string) string {
+		v := msg.Header.Get(name)
+		if d, err := dec.DecodeHeader(v); err == nil {
+			return d
+		}
+		return v
+	}
+	recipients := make([]any, len(to))
+	for i, addr := range to {
+		recipients[i] = addr
+	}
+	payload := map[string]any{
+		"envelope_from": from,
+		"envelope_to":   recipients,
+		"from":          header("From"),
+		"to":            header("To"),
+		"subject":       header("Subject"),
+	}
+	for key, name := range map[string]string{"cc": "Cc", "reply_to": "Reply-To", "date": "Date", "message_id": "Message-Id"} {
+		if v := header(name); v != "" {
+			payload[key] = v
+		}
+	}
+	if date, err := msg.Header.Date(); err == nil {
+		payload["date"] = date.UTC().Format(time.RFC3339)
+	}
+
+	e := &emailParts{payload: payload, parts: []any{}}
+	if err := e.walk(textproto.MIMEHeader(msg.Header), msg.Body, 0); err != nil {
+		return WebhookParams{}, err
+	}
+	payload["parts"] = e.parts
+
+	return WebhookParams{
+		EventType:      "email",
+		Payload:        payload,
+		IdempotencyKey: strings.Trim(msg.Header.Get("Message-Id"), "<> "),
+		Headers:        http.Header(msg.Header),
+		ContentType:    "message/rfc822",
+		Attachments:    e.attachments,
+	}, nil
+}
+
+type emailParts struct {
+	payload     map[string]any
+	parts       []any
+	attachments []Attachment
+}
+
+func (e *emailParts) walk(h textproto.MIMEHeader, body io.Reader, depth int) error {
+	if depth > smtpMaxPartDepth {
+		return fmt.Errorf("MIME parts nest deeper than %d levels", smtpMaxPartDepth)
+	}
+	contentType := h.Get("Content-Type")
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType, params = "text/plain", nil
+	}
+	if strings.HasPrefix(mediaType, "multipart/") {
+		mr := multipart.NewReader(body, params["boundary"])
+		for {
+			p, err := mr.NextPart()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if err := e.walk(p.Header, p, depth+1); err != nil {
+				return err
+			}
+		}
+	}
+
+	// multipart.Part undoes quoted-printable itself and drops the header.
+	switch strings.ToLower(strings.TrimSpace(h.Get("Content-Transfer-Encoding"))) {
+	case "base64":
+		body = base64.NewDecoder(base64.StdEncoding, body)
+	case "quoted-printable":
+		body = quotedprintable.NewReader(body)
+	}
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return fmt.Errorf("%s part: %w", mediaType, err)
+	}
+
+	part := map[string]any{"content_type": mediaType, "size": float64(len(data))}
+	disposition, dparams, _ := mime.ParseMediaType(h.Get("Content-Disposition"))
+	filename := dparams["filename"]
+	if filename == "" {
+		filename = params["name"]
+	}
+	if filename != "" {
+		part["filename"] = filename
+	}
+	if disposition != "" {
+		part["disposition"] = disposition
+	}
+	e.parts = append(e.parts, part)
+
+	if filename == "" && disposition != "attachment" {
+		key := map[string]string{"text/plain": "text", "text/html": "html"}[mediaType]
+		if _, seen := e.payload[key]; key != "" && !seen {
+			if text, _, err := normalizeBody(data, contentType); err == nil {
+				e.payload[key] = string(text)
+			}
+		}
+		return nil
+	}
+	if filename == "" {
+		filename = "part-" + strconv.Itoa(len(e.parts))
+	}
+	if len(data) > attachmentMaxSize || len(e.attachments) == attachmentMaxCount {
+		part["stored"] = false
+		return nil
+	}
+	for _, a := range e.attachments {
+		if a.Name == filename {
+			filename = strconv.Itoa(len(e.parts)) + "-" + filename
+			break
+		}
+	}
+	e.attachments = append(e.attachments, Attachment{
+		Name:        filename,
+		ContentType: mediaType,
+		Size:        len(data),
+		AddedAt:     time.Now().UTC(),
+		Data:        data,
+	})
+	return nil
+}
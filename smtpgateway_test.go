@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"net/smtp"
+	"strings"
+	"testing"
+)
+
+const testEmail = "From: Alerts <alerts@example.com>\r\n" +
+	"To: ops@example.org\r\n" +
+	"Subject: =?UTF-8?Q?Disk_f=C3=BCll?=\r\n" +
+	"Date: Mon, 02 Jan 2006 15:04:05 -0700\r\n" +
+	"Message-ID: <abc123@example.com>\r\n" +
+	"MIME-Version: 1.0\r\n" +
+	"Content-Type: multipart/mixed; boundary=outer\r\n" +
+	"\r\n" +
+	"--outer\r\n" +
+	"Content-Type: multipart/alternative; boundary=inner\r\n" +
+	"\r\n" +
+	"--inner\r\n" +
+	"Content-Type: text/plain; charset=utf-8\r\n" +
+	"Content-Transfer-Encoding: quoted-printable\r\n" +
+	"\r\n" +
+	"Disk is 95% f=C3=BCll\r\n" +
+	"--inner\r\n" +
+	"Content-Type: text/html\r\n" +
+	"\r\n" +
+	"<p>Disk is full</p>\r\n" +
+	"--inner--\r\n" +
+	"--outer\r\n" +
+	"Content-Type: text/csv; name=usage.csv\r\n" +
+	"Content-Disposition: attachment; filename=usage.csv\r\n" +
+	"Content-Transfer-Encoding: base64\r\n" +
+	"\r\n" +
+	"L2RldiwgOTUK\r\n" +
+	"--outer--\r\n"
+
+func startSMTPGateway(t *testing.T) (*RingBuffer, string) {
+	t.Helper()
+	buffer := NewRingBuffer(10)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go NewSMTPGateway(NewRecorder(buffer)).Serve(l)
+	return buffer, l.Addr().String()
+}
+
+func TestSMTPGateway(t *testing.T) {
+	buffer, addr := startSMTPGateway(t)
+	for range 2 {
+		if err := smtp.SendMail(addr, nil, "bounce@example.com", []string{"ops@example.org", "dev@example.org"}, []byte(testEmail)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	items, _, _ := buffer.After(context.Background(), 0, 0, nil)
+	if len(items) != 1 || items[0].Deliveries != 2 {
+		t.Fatalf("expected one record delivered twice, got %+v", items)
+	}
+	item := items[0]
+	p := item.Payload
+	if item.EventType != "email" || p["subject"] != "Disk füll" || p["text"] != "Disk is 95% füll" || p["html"] != "<p>Disk is full</p>" {
+		t.Errorf("unexpected email record %q %+v", item.EventType, p)
+	}
+	if to, _ := p["envelope_to"].([]any); p["envelope_from"] != "bounce@example.com" || len(to) != 2 || p["date"] != "2006-01-02T22:04:05Z" {
+		t.Errorf("expected the envelope and date in the payload, got %+v", p)
+	}
+	if parts, _ := p["parts"].([]any); len(parts) != 3 {
+		t.Errorf("expected three MIME parts, got %v", p["parts"])
+	}
+	if len(item.Attachments) != 1 || item.Attachments[0].Name != "usage.csv" || string(item.Attachments[0].Data) != "/dev, 95\n" {
+		t.Errorf("expected usage.csv attached, got %+v", item.Attachments)
+	}
+	if item.IdempotencyKey != "abc123@example.com" || item.Headers.Get("From") != "Alerts <alerts@example.com>" || !strings.HasPrefix(item.Source, "smtp://127.0.0.1") {
+		t.Errorf("unexpected record metadata %+v", item)
+	}
+}
+
+func TestSMTPGatewayProtocolErrors(t *testing.T) {
+	_, addr := startSMTPGateway(t)
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	r.ReadString('\n')
+	for _, tc := range []struct{ command, want string }{
+		{"RCPT TO:<a@example.com>", "503"},
+		{"MAIL FROM:a@example.com", "501"},
+		{"MAIL FROM:<>", "250"},
+		{"DATA", "503"},
+		{"AUTH PLAIN", "502"},
+		{"QUIT", "221"},
+	} {
+		conn.Write([]byte(tc.command + "\r\n"))
+		if line, _ := r.ReadString('\n'); !strings.HasPrefix(line, tc.want) {
+			t.Errorf("%s: expected %s, got %q", tc.command, tc.want, line)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"slices"
+)
+
+// chunkSize is the number of records per copy-on-write chunk. A write after
+// a snapshot copies the chunk it lands in, so this trades the cost of that
+// copy against the number of chunk pointers copied along with it.
+const chunkSize = 64
+
+// recordChunk holds consecutive buffer slots. gen is the buffer generation
+// the chunk was last copied in; a chunk from an earlier generation may be
+// shared with a snapshot and must not be written to.
+type recordChunk struct {
+	gen   uint64
+	items [chunkSize]WebhookParams
+}
+
+// ringView is the layout of a ring buffer: the chunks holding its records,
+// the slot the next record goes into and how many records are held.
+type ringView struct {
+	chunks []*recordChunk
+	head   int
+	count  int
+	size   int
+}
+
+func newRingView(size int) ringView {
+	chunks := make([]*recordChunk, (size+chunkSize-1)/chunkSize)
+	for i := range chunks {
+		chunks[i] = new(recordChunk)
+	}
+	return ringView{chunks: chunks, size: size}
+}
+
+// at returns the record in slot idx, for reading only.
+func (v *ringView) at(idx int) *WebhookParams {
+	return &v.chunks[idx/chunkSize].items[idx%chunkSize]
+}
+
+// newest returns the slot of the i-th newest record, 0 being the newest.
+func (v *ringView) newest(i int) int {
+	return (v.head - 1 - i + v.size) % v.size
+}
+
+// find returns the slot of the record with the given id.
+func (v *ringView) find(id string) (int, bool) {
+	for i := 0; i < v.count; i++ {
+		if idx := v.newest(i); v.at(idx).ID == id {
+			return idx, true
+		}
+	}
+	return 0, false
+}
+
+// query returns the records matching filter, newest first, stopping early
+// with truncated set when ctx is done.
+func (v *ringView) query(ctx context.Context, filter QueryFilter) (results []WebhookParams, truncated bool) {
+	truncated = v.scan(ctx, filter, func(item *WebhookParams) bool {
+		results = append(results, *item)
+		return true
+	})
+	return results, truncated
+}
+
+// scan calls fn with each record matching filter, newest first, until fn
+// returns false. It reports whether ctx ended the scan early.
+func (v *ringView) scan(ctx context.Context, filter QueryFilter, fn func(item *WebhookParams) bool) (truncated bool) {
+	for i := 0; i < v.count; i++ {
+		if i%scanCheckInterval == 0 && ctx.Err() != nil {
+			return true
+		}
+		if item := v.at(v.newest(i)); filter.Match(*item) && !fn(item) {
+			return false
+		}
+	}
+	return false
+}
+
+// after returns up to limit records after sequence seq matching filter,
+// oldest first; see RingBuffer.After.
+func (v *ringView) after(ctx context.Context, seq uint64, limit int, filter *QueryFilter) (items []WebhookParams, evicted uint64, truncated bool) {
+	for i := v.count - 1; i >= 0; i-- {
+		if (v.count-1-i)%scanCheckInterval == 0 && ctx.Err() != nil {
+			return items, evicted, true
+		}
+		item := v.at(v.newest(i))
+		if i == v.count-1 && item.Sequence > seq+1 {
+			evicted = item.Sequence - seq - 1
+		}
+		if item.Sequence <= seq || filter != nil && !filter.Match(*item) {
+			continue
+		}
+		if limit > 0 && len(items) == limit {
+			break
+		}
+		items = append(items, *item)
+	}
+	return items, evicted, false
+}
+
+// Snapshot is a consistent, read-only view of a RingBuffer. Taking one is
+// cheap and reading it holds no lock, so long scans do not hold up ingest;
+// records stored after it was taken are not in it.
+type Snapshot struct {
+	ringView
+	evicted  uint64
+	sequence uint64
+	chained  bool
+	lastHash string
+}
+
+// Snapshot returns a view of the buffer as it is now. The chunks stay shared
+// until the buffer next writes to them, which copies them first.
+func (rb *RingBuffer) Snapshot() *Snapshot {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+
+	rb.gen++
+	return &Snapshot{
+		ringView: rb.ringView,
+		evicted:  rb.evicted,
+		sequence: rb.sequence,
+		chained:  rb.chained,
+		lastHash: rb.lastHash,
+	}
+}
+
+// slot returns the record in slot idx for writing, first copying whatever
+// a snapshot may still be reading. rb.mu must be held for writing.
+func (rb *RingBuffer) slot(idx int) *WebhookParams {
+	if rb.chunksGen != rb.gen {
+		rb.chunks = slices.Clone(rb.chunks)
+		rb.chunksGen = rb.gen
+	}
+	c := rb.chunks[idx/chunkSize]
+	if c.gen != rb.gen {
+		copied := *c
+		copied.gen = rb.gen
+		c = &copied
+		rb.chunks[idx/chunkSize] = c
+	}
+	return &c.items[idx%chunkSize]
+}
+
+// Len returns the number of records in the snapshot.
+func (s *Snapshot) Len() int {
+	return s.count
+}
+
+// Query is RingBuffer.Query on the snapshot.
+func (s *Snapshot) Query(ctx context.Context, filter QueryFilter) ([]WebhookParams, bool) {
+	return s.query(ctx, filter)
+}
+
+// Scan calls fn with each record matching filter, newest first, until fn
+// returns false, reporting whether ctx ended the scan early.
+func (s *Snapshot) Scan(ctx context.Context, filter QueryFilter, fn func(item WebhookParams) bool) bool {
+	return s.scan(ctx, filter, func(item *WebhookParams) bool { return fn(*item) })
+}
+
+// After is RingBuffer.After on the snapshot.
+func (s *Snapshot) After(ctx context.Context, seq uint64, limit int, filter *QueryFilter) ([]WebhookParams, uint64, bool) {
+	return s.after(ctx, seq, limit, filter)
+}
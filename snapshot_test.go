@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestSnapshotIsolation(t *testing.T) {
+	buffer := NewRingBuffer(100)
+	first, _ := buffer.Push(WebhookParams{EventType: "order", IdempotencyKey: "k"})
+	snap := buffer.Snapshot()
+
+	buffer.Push(WebhookParams{EventType: "order"})
+	buffer.Push(WebhookParams{EventType: "order", IdempotencyKey: "k"})
+	buffer.AddTag(first.ID, tagRetryStorm)
+	if _, err := buffer.Attach(first.ID, &Attachment{Name: "note"}); err != nil {
+		t.Fatal(err)
+	}
+
+	items, _ := snap.Query(context.Background(), QueryFilter{EventTypes: []string{"order"}})
+	if snap.Len() != 1 || len(items) != 1 || items[0].Deliveries != 1 || items[0].Tags != nil || items[0].Attachments != nil {
+		t.Fatalf("expected the snapshot to keep the original record only, got %+v", items)
+	}
+	now, _ := buffer.Get(first.ID)
+	if now.Deliveries != 2 || len(now.Tags) != 1 || len(now.Attachments) != 1 {
+		t.Errorf("expected the buffer to have the updates, got %+v", now)
+	}
+}
+
+func TestSnapshotAcrossChunks(t *testing.T) {
+	size := 2*chunkSize + 10
+	buffer := NewRingBuffer(size)
+	for i := 0; i < size+5; i++ {
+		buffer.Push(WebhookParams{EventType: "order", Version: fmt.Sprint(i)})
+	}
+	snap := buffer.Snapshot()
+	for i := 0; i < chunkSize; i++ {
+		buffer.Push(WebhookParams{EventType: "order", Version: "later"})
+	}
+
+	items, _, _ := snap.After(context.Background(), 0, 0, nil)
+	if len(items) != size || items[0].Version != "5" || items[size-1].Version != fmt.Sprint(size+4) {
+		t.Fatalf("unexpected snapshot contents: %d items from %s", len(items), items[0].Version)
+	}
+	latest, _ := buffer.Query(context.Background(), QueryFilter{EventTypes: []string{"order"}})
+	if len(latest) != size || latest[0].Version != "later" {
+		t.Errorf("expected the buffer to move on, got %d items, newest %s", len(latest), latest[0].Version)
+	}
+}
+
+// TestConcurrentReadWrite mixes ingest, updates and scans; run it with
+// -race.
+func TestConcurrentReadWrite(t *testing.T) {
+	buffer := NewRingBuffer(3 * chunkSize)
+	buffer.ChainHashes()
+	filter := QueryFilter{EventTypes: []string{"order"}}
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 500; i++ {
+				stored, _ := buffer.Push(WebhookParams{EventType: "order", IdempotencyKey: fmt.Sprintf("%d-%d", w, i%50)})
+				buffer.AddTag(stored.ID, tagRetryStorm)
+				buffer.Attach(stored.ID, &Attachment{Name: "n"})
+			}
+		}(w)
+	}
+	for r := 0; r < 4; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				snap := buffer.Snapshot()
+				items, _ := snap.Query(ctx, filter)
+				if len(items) != snap.Len() {
+					t.Errorf("snapshot of %d records returned %d", snap.Len(), len(items))
+					return
+				}
+				for j := 1; j < len(items); j++ {
+					if items[j].Sequence >= items[j-1].Sequence {
+						t.Errorf("snapshot out of order at %d", j)
+						return
+					}
+				}
+				buffer.After(ctx, uint64(i), 10, &filter)
+				if report := buffer.VerifyChain(); !report.Valid {
+					t.Errorf("chain broken under load: %+v", report.Broken)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"io"
+)
+
+// soapFaultEvent is the event type faults are recorded under, keeping them
+// apart from the operations they answer.
+const soapFaultEvent = "soap.fault"
+
+// soapVersions maps envelope namespaces to the version recorded on the
+// webhook.
+var soapVersions = map[string]string{
+	"http://schemas.xmlsoap.org/soap/envelope/": "soap-1.1",
+	"http://www.w3.org/2003/05/soap-envelope":   "soap-1.2",
+}
+
+// soapOperation returns the name of the first element inside the envelope's
+// Body, which is the operation (or Fault). The payload form loses element
+// order, so this scans the document again.
+func soapOperation(body []byte) (string, error) {
+	dec := xml.NewDecoder(bytes.NewReader(body))
+	dec.CharsetReader = func(_ string, r io.Reader) (io.Reader, error) { return r, nil }
+
+	depth, inBody := 0, false
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return "", err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			depth++
+			switch {
+			case depth == 2 && t.Name.Local == "Body":
+				inBody = true
+			case depth == 3 && inBody:
+				return t.Name.Local, nil
+			}
+		case xml.EndElement:
+			if depth == 2 && inBody {
+				return "", errors.New("soap: empty Body")
+			}
+			depth--
+		}
+	}
+}
+
+// soapWebhook unwraps a SOAP envelope: the operation inside the Body becomes
+// the event type and its content the payload, next to the envelope Header if
+// there is one. Faults are recorded under the soap.fault event type.
+func soapWebhook(body []byte, version string, envelope any) (WebhookParams, error) {
+	env, _ := envelope.(map[string]any)
+	soapBody, ok := env["Body"].(map[string]any)
+	if !ok {
+		return WebhookParams{}, errors.New("soap: envelope without Body")
+	}
+	operation, err := soapOperation(body)
+	if err != nil {
+		return WebhookParams{}, err
+	}
+
+	payload := map[string]any{operation: soapBody[operation]}
+	if header, ok := env["Header"]; ok {
+		payload["Header"] = header
+	}
+	event := operation
+	if operation == "Fault" {
+		event = soapFaultEvent
+	}
+	return WebhookParams{EventType: event, Version: version, Payload: payload}, nil
+}
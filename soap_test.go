@@ -0,0 +1,64 @@
+package main
+
+import "testing"
+
+const soapNotification = `<?xml version="1.0"?>
+<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/" xmlns:n="urn:notify">
+  <soap:Header><n:MessageID>m-1</n:MessageID></soap:Header>
+  <soap:Body>
+    <n:OrderShipped><n:OrderId>42</n:OrderId></n:OrderShipped>
+  </soap:Body>
+</soap:Envelope>`
+
+const soapFault = `<env:Envelope xmlns:env="http://www.w3.org/2003/05/soap-envelope">
+  <env:Body>
+    <env:Fault>
+      <env:Code><env:Value>env:Receiver</env:Value></env:Code>
+      <env:Reason><env:Text>Backend unavailable</env:Text></env:Reason>
+    </env:Fault>
+  </env:Body>
+</env:Envelope>`
+
+func TestSOAPEnvelopeUnwrapping(t *testing.T) {
+	item, err := parseXMLWebhook([]byte(soapNotification))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if item.EventType != "OrderShipped" || item.Version != "soap-1.1" {
+		t.Errorf("expected OrderShipped soap-1.1, got %s %s", item.EventType, item.Version)
+	}
+	if v, _ := lookupPath(item.Payload, "OrderShipped.OrderId"); v != "42" {
+		t.Errorf("expected the operation content as payload, got %v", item.Payload)
+	}
+	if v, _ := lookupPath(item.Payload, "Header.MessageID"); v != "m-1" {
+		t.Errorf("expected the SOAP header to be kept, got %v", item.Payload)
+	}
+}
+
+func TestSOAPFault(t *testing.T) {
+	item, err := parseXMLWebhook([]byte(soapFault))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if item.EventType != soapFaultEvent || item.Version != "soap-1.2" {
+		t.Errorf("expected a soap-1.2 fault, got %s %s", item.EventType, item.Version)
+	}
+	if v, _ := lookupPath(item.Payload, "Fault.Reason.Text"); v != "Backend unavailable" {
+		t.Errorf("expected the fault reason, got %v", item.Payload)
+	}
+}
+
+func TestSOAPIngest(t *testing.T) {
+	mux := newTestServer()
+	postXML(t, mux, soapNotification)
+	got := queryWebhooks(t, mux, "/query/OrderShipped?xpath=/OrderShipped/OrderId=42")
+	if len(got) != 1 {
+		t.Errorf("expected the unwrapped operation to be queryable, got %d", len(got))
+	}
+
+	// Envelope-shaped documents outside the SOAP namespaces are left alone.
+	item, _ := parseXMLWebhook([]byte(`<Envelope><Body><x/></Body></Envelope>`))
+	if item.EventType != "Envelope" {
+		t.Errorf("expected a plain XML document, got %s", item.EventType)
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// recordMalformed makes the ingest endpoint store deliveries it cannot
+// parse, with the parse error and an empty event type, instead of only
+// answering them with a problem.
+var recordMalformed bool
+
+// StatusFilter selects records by how their delivery went rather than by
+// payload. Nil fields and an empty StatusCode match anything.
+type StatusFilter struct {
+	// Verified matches records whose signature was checked, and passed or
+	// failed as given.
+	Verified *bool
+	// ParseError matches records that did or did not fail to parse.
+	ParseError *bool
+	// StatusCode is the response status the record was answered with, as a
+	// code such as 400 or a class such as 4xx.
+	StatusCode string
+	// JA3 is the sender's JA3 fingerprint, as the string or its hash, and
+	// JA4 its JA4 fingerprint.
+	JA3, JA4 string
+}
+
+func (f StatusFilter) empty() bool {
+	return f.Verified == nil && f.ParseError == nil && f.StatusCode == "" && f.JA3 == "" && f.JA4 == ""
+}
+
+// parseStatusFilter takes the verified, parse_error, status_code, ja3 and
+// ja4 parameters out of params.
+func parseStatusFilter(params url.Values) (StatusFilter, error) {
+	var filter StatusFilter
+	for _, flag := range []struct {
+		param string
+		dest  **bool
+	}{
+		{"verified", &filter.Verified},
+		{"parse_error", &filter.ParseError},
+	} {
+		if value := params.Get(flag.param); value != "" {
+			b, err := strconv.ParseBool(value)
+			if err != nil {
+				return filter, &paramError{codeInvalidParameter, flag.param + " must be a boolean"}
+			}
+			*flag.dest = &b
+		}
+		delete(params, flag.param)
+	}
+	if code := strings.ToLower(params.Get("status_code")); code != "" {
+		if !validStatusCode(code) {
+			return filter, &paramError{codeInvalidParameter, "status_code must be a status code such as 400 or a class such as 4xx"}
+		}
+		filter.StatusCode = code
+	}
+	delete(params, "status_code")
+	filter.JA3, filter.JA4 = params.Get("ja3"), params.Get("ja4")
+	delete(params, "ja3")
+	delete(params, "ja4")
+	return filter, nil
+}
+
+func validStatusCode(spec string) bool {
+	if len(spec) != 3 || spec[0] < '1' || spec[0] > '5' {
+		return false
+	}
+	if spec[1:] == "xx" {
+		return true
+	}
+	_, err := strconv.Atoi(spec)
+	return err == nil
+}
+
+func (f StatusFilter) Match(item WebhookParams) bool {
+	if f.Verified != nil && (item.Verification == nil || item.Verification.Verified != *f.Verified) {
+		return false
+	}
+	if f.ParseError != nil && (item.ParseError != "") != *f.ParseError {
+		return false
+	}
+	if f.JA3 != "" || f.JA4 != "" {
+		var fp *TLSFingerprint
+		if item.TLS != nil {
+			fp = item.TLS.Fingerprint
+		}
+		if fp == nil || (f.JA3 != "" && f.JA3 != fp.JA3 && !strings.EqualFold(f.JA3, fp.JA3Hash)) || (f.JA4 != "" && f.JA4 != fp.JA4) {
+			return false
+		}
+	}
+	return f.StatusCode == "" || statusMatches(f.StatusCode, item.StatusCode)
+}
+
+// statusMatches reports whether code is the status code or in the class
+// spec, as validated by validStatusCode.
+func statusMatches(spec string, code int) bool {
+	s := strconv.Itoa(code)
+	if strings.HasSuffix(spec, "xx") {
+		return code != 0 && s[0] == spec[0]
+	}
+	return s == spec
+}
+
+// rejectMalformed answers a delivery whose body failed to parse with a 400
+// problem, storing it first with -record-malformed.
+func rejectMalformed(w http.ResponseWriter, r *http.Request, recorder *Recorder, raw []byte, transfer *transferReader, code, detail string) {
+	if recordMalformed {
+		if !checkQuota(w, r, int64(len(raw))) {
+			return
+		}
+		if captureControl(recorder, r) {
+			stored, _ := recorder.Record(malformedWebhook(r, raw, transfer.result(r), detail), raw)
+			setProvenanceHeaders(w, stored)
+		}
+	}
+	writeProblem(w, r, http.StatusBadRequest, code, detail)
+}
+
+// malformedWebhook is the record of a delivery r whose body raw failed to
+// parse with detail.
+func malformedWebhook(r *http.Request, raw []byte, transfer *Transfer, detail string) WebhookParams {
+	contentType := r.Header.Get("Content-Type")
+	return WebhookParams{
+		IdempotencyKey: r.Header.Get(idempotencyHeader),
+		Headers:        r.Header.Clone(),
+		Trace:          traceContext(r.Header),
+		Client:         clientInfo(r),
+		TLS:            tlsInfo(r),
+		Transfer:       transfer,
+		ContentType:    contentType,
+		Raw:            raw,
+		SniffedType:    sniffedType(raw, contentType),
+		StatusCode:     http.StatusBadRequest,
+		ParseError:     detail,
+	}
+}
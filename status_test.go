@@ -0,0 +1,54 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestQueryByDeliveryStatus(t *testing.T) {
+	recordMalformed = true
+	defer func() { recordMalformed = false }()
+	buffer := NewRingBuffer(10)
+	mux := http.NewServeMux()
+	registerRoutes(mux, buffer, "secret")
+
+	postWebhook(t, mux, `{"event":"order"}`)
+	rec := postWebhook(t, mux, `{"event":"order",`)
+	if rec.Code != http.StatusBadRequest || rec.Header().Get("X-Echo-Id") == "" {
+		t.Fatalf("expected the malformed delivery to be answered 400 and recorded, got %d %v", rec.Code, rec.Header())
+	}
+	buffer.Push(WebhookParams{EventType: "order", Verification: &Verification{Scheme: "stripe", Verified: false}, StatusCode: http.StatusOK})
+	buffer.Push(WebhookParams{EventType: "refund", Verification: &Verification{Scheme: "stripe", Verified: true}, StatusCode: http.StatusOK})
+
+	for _, tc := range []struct {
+		path string
+		want int
+	}{
+		{"/query?verified=false", 1},
+		{"/query?verified=true", 1},
+		{"/query?parse_error=true", 1},
+		{"/query?parse_error=false", 3},
+		{"/query?status_code=400", 1},
+		{"/query?status_code=2xx", 3},
+		{"/query/order?status_code=200", 2},
+		{"/query/order?verified=false&status_code=4xx", 0},
+	} {
+		if got := queryWebhooks(t, mux, tc.path); len(got) != tc.want {
+			t.Errorf("%s: expected %d records, got %d", tc.path, tc.want, len(got))
+		}
+	}
+
+	malformed := queryWebhooks(t, mux, "/query?parse_error=true")[0]
+	if malformed.EventType != "" || malformed.ParseError == "" || malformed.StatusCode != http.StatusBadRequest {
+		t.Errorf("unexpected malformed record: %+v", malformed)
+	}
+
+	for _, path := range []string{"/query?status_code=99", "/query?verified=maybe"} {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", path, rec.Code)
+		}
+	}
+}
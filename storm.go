@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+)
+
+// tagRetryStorm marks records whose deliveries came in as a retry storm.
+const tagRetryStorm = "retry-storm"
+
+// stormWindow is the window over which deliveries per key are counted.
+const stormWindow = time.Minute
+
+// storms detects retry storms when configured; nil disables detection.
+var storms *StormDetector
+
+// StormDetector counts deliveries per idempotency key over the last minute.
+// A key delivered Threshold times or more within that minute is storming.
+// While a key storms, deliveries are answered with Response if it is set,
+// so that a provider stuck retrying gets the success it is waiting for.
+type StormDetector struct {
+	Threshold int
+	Response  string
+
+	mu        sync.Mutex
+	hits      map[string][]time.Time
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+func NewStormDetector(threshold int, response string) *StormDetector {
+	return &StormDetector{
+		Threshold: threshold,
+		Response:  response,
+		hits:      make(map[string][]time.Time),
+		now:       time.Now,
+	}
+}
+
+// Observe counts a delivery of key and reports whether the key is storming,
+// along with its deliveries in the window.
+func (d *StormDetector) Observe(key string) (storming bool, count int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := d.now()
+	cutoff := now.Add(-stormWindow)
+	if now.Sub(d.lastSweep) > stormWindow {
+		for k, hits := range d.hits {
+			if !hits[len(hits)-1].After(cutoff) {
+				delete(d.hits, k)
+			}
+		}
+		d.lastSweep = now
+	}
+
+	hits := d.hits[key]
+	keep := 0
+	for keep < len(hits) && !hits[keep].After(cutoff) {
+		keep++
+	}
+	hits = append(hits[keep:], now)
+	d.hits[key] = hits
+	return len(hits) >= d.Threshold, len(hits)
+}
+
+// writeResponse answers a storming delivery with the configured response.
+func (d *StormDetector) writeResponse(w http.ResponseWriter) {
+	if json.Valid([]byte(d.Response)) {
+		w.Header().Set("Content-Type", "application/json")
+	} else {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	}
+	w.Write([]byte(d.Response))
+}
+
+// AddTag adds tag to the record with the given id, if it is not tagged
+// already.
+func (rb *RingBuffer) AddTag(id, tag string) bool {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+
+	idx, ok := rb.find(id)
+	if !ok {
+		return false
+	}
+	if tags := rb.at(idx).Tags; !slices.Contains(tags, tag) {
+		// Copy on write: records handed out by Query share the old slice.
+		rb.slot(idx).Tags = append(slices.Clip(tags), tag)
+	}
+	return true
+}
+
+// tagStorm tracks a recorded delivery and tags its record once the key
+// storms, reporting whether it does.
+func tagStorm(buffer *RingBuffer, stored WebhookParams) bool {
+	if storms == nil || stored.IdempotencyKey == "" || stored.ID == "" {
+		return false
+	}
+	storming, count := storms.Observe(stored.IdempotencyKey)
+	if !storming {
+		return false
+	}
+	if buffer.AddTag(stored.ID, tagRetryStorm) && !slices.Contains(stored.Tags, tagRetryStorm) {
+		log.Printf("Retry storm: %s delivered %d times within %s", stored.IdempotencyKey, count, stormWindow)
+	}
+	return true
+}
+
+// checkStorm tags a storming delivery as tagStorm does and marks its
+// response. It reports whether it answered the request itself.
+func checkStorm(w http.ResponseWriter, buffer *RingBuffer, stored WebhookParams) bool {
+	if !tagStorm(buffer, stored) {
+		return false
+	}
+	w.Header().Set("X-Echo-Retry-Storm", "true")
+	if storms.Response == "" {
+		return false
+	}
+	setProvenanceHeaders(w, stored)
+	storms.writeResponse(w)
+	return true
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestStormDetector(t *testing.T) {
+	d := NewStormDetector(3, "")
+	now := time.Now()
+	d.now = func() time.Time { return now }
+
+	for i, want := range []bool{false, false, true, true} {
+		if storming, _ := d.Observe("k"); storming != want {
+			t.Errorf("delivery %d: got storming=%v", i+1, storming)
+		}
+	}
+	if storming, _ := d.Observe("other"); storming {
+		t.Error("expected keys to be counted separately")
+	}
+
+	now = now.Add(2 * stormWindow)
+	if storming, count := d.Observe("k"); storming || count != 1 {
+		t.Errorf("expected the window to expire, got %v %d", storming, count)
+	}
+	if _, ok := d.hits["other"]; ok {
+		t.Error("expected idle keys to be swept")
+	}
+}
+
+func TestRetryStormResponse(t *testing.T) {
+	storms = NewStormDetector(2, `{"received":true}`)
+	t.Cleanup(func() { storms = nil })
+	mux := newTestServer()
+
+	deliver := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString(`{"event":"order"}`))
+		req.Header.Set("X-Idempotency-Key", "evt-1")
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := deliver(); rec.Body.String() != `{"event":"order"}` || rec.Header().Get("X-Echo-Retry-Storm") != "" {
+		t.Fatalf("expected a normal echo, got %q", rec.Body.String())
+	}
+	rec := deliver()
+	if rec.Code != http.StatusOK || rec.Body.String() != `{"received":true}` || rec.Header().Get("X-Echo-Retry-Storm") != "true" {
+		t.Fatalf("expected the storm response, got %d %q", rec.Code, rec.Body.String())
+	}
+	got := queryWebhooks(t, mux, "/query/order")
+	if len(got) != 1 || got[0].Deliveries != 2 || !slices.Equal(got[0].Tags, []string{tagRetryStorm}) {
+		t.Errorf("expected one tagged record, got %+v", got)
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// streamBacklog is how many webhooks may wait for a slow /stream client
+	// before newer ones are dropped for it.
+	streamBacklog = 256
+	// streamKeepAlive is how often an idle /stream sends a comment, so that
+	// proxies keep the connection open.
+	streamKeepAlive = 15 * time.Second
+)
+
+// EventStream sends newly recorded webhooks to the clients of /stream as
+// server-sent events.
+type EventStream struct {
+	mu      sync.Mutex
+	clients map[*streamClient]struct{}
+}
+
+type streamClient struct {
+	filter QueryFilter
+	items  chan WebhookParams
+}
+
+func NewEventStream() *EventStream {
+	return &EventStream{clients: make(map[*streamClient]struct{})}
+}
+
+func (s *EventStream) OnIngest(item WebhookParams, body []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for c := range s.clients {
+		if !c.filter.Match(item) {
+			continue
+		}
+		select {
+		case c.items <- item:
+		default:
+		}
+	}
+}
+
+func (s *EventStream) subscribe(filter QueryFilter) *streamClient {
+	c := &streamClient{filter: filter, items: make(chan WebhookParams, streamBacklog)}
+	s.mu.Lock()
+	s.clients[c] = struct{}{}
+	s.mu.Unlock()
+	return c
+}
+
+func (s *EventStream) unsubscribe(c *streamClient) {
+	s.mu.Lock()
+	delete(s.clients, c)
+	s.mu.Unlock()
+}
+
+// streamHandler streams the webhooks recorded from now on that match the
+// /query parameters, each as a "webhook" event with its sequence as ID.
+// Unlike /query, no event type is needed: a bare /stream sends every webhook.
+// saved_query names a saved query the other parameters apply on top of.
+func streamHandler(s *EventStream, saved *SavedQueries) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := r.URL.Query()
+		if name := params.Get("saved_query"); name != "" {
+			delete(params, "saved_query")
+			var err error
+			if params, err = saved.Resolve(name, params); err != nil {
+				writeParamError(w, r, err)
+				return
+			}
+		}
+		filter, err := parseFilterParams(params, r.PathValue("event_type"))
+		if err != nil {
+			writeParamError(w, r, err)
+			return
+		}
+		c := s.subscribe(filter)
+		defer s.unsubscribe(c)
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.WriteHeader(http.StatusOK)
+		rc := http.NewResponseController(w)
+		rc.Flush()
+
+		keepAlive := time.NewTicker(streamKeepAlive)
+		defer keepAlive.Stop()
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-keepAlive.C:
+				fmt.Fprint(w, ": keep-alive\n\n")
+			case item := <-c.items:
+				data, err := json.Marshal(item)
+				if err != nil {
+					continue
+				}
+				fmt.Fprintf(w, "id: %d\nevent: webhook\ndata: %s\n\n", item.Sequence, data)
+			}
+			if rc.Flush() != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStreamSendsNewWebhooks(t *testing.T) {
+	mux := newTestServer()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	postWebhook(t, mux, `{"event":"order","data":{"id":"before"}}`)
+
+	resp, err := http.Get(server.URL + "/v1/stream/order")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("expected an event stream, got %q", ct)
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for i := 0; ; i++ {
+			select {
+			case <-done:
+				return
+			case <-time.After(10 * time.Millisecond):
+				postWebhook(t, mux, `{"event":"refund","data":{}}`)
+				postWebhook(t, mux, `{"event":"order","data":{"id":"after"}}`)
+			}
+		}
+	}()
+
+	var lines []string
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() && scanner.Text() != "" {
+		lines = append(lines, scanner.Text())
+	}
+	if len(lines) != 3 || !strings.HasPrefix(lines[0], "id: ") || lines[1] != "event: webhook" || !strings.Contains(lines[2], `"id":"after"`) {
+		t.Errorf("expected an order recorded after connecting, got %q", lines)
+	}
+}
+
+func TestStreamWithoutEventType(t *testing.T) {
+	mux := newTestServer()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/stream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected /stream to accept no event type, got %d", resp.StatusCode)
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case <-time.After(10 * time.Millisecond):
+				postWebhook(t, mux, `{"event":"refund","data":{}}`)
+			}
+		}
+	}()
+
+	scanner := bufio.NewScanner(resp.Body)
+	var lines []string
+	for scanner.Scan() && scanner.Text() != "" {
+		lines = append(lines, scanner.Text())
+	}
+	if len(lines) != 3 || !strings.Contains(lines[2], `"event":"refund"`) {
+		t.Errorf("expected any webhook on a bare /stream, got %q", lines)
+	}
+}
+
+func TestStreamSavedQuery(t *testing.T) {
+	mux := newTestServer()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	if rec := putSavedQuery(t, mux, "refunds", `{"event_type":"refund"}`); rec.Code != http.StatusCreated {
+		t.Fatalf("expected the saved query to be created, got %d", rec.Code)
+	}
+
+	resp, err := http.Get(server.URL + "/stream?saved_query=missing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected an unknown saved query to be refused, got %d", resp.StatusCode)
+	}
+	resp, err = http.Get(server.URL + "/stream?saved_query=refunds&amount=2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case <-time.After(10 * time.Millisecond):
+				postWebhook(t, mux, `{"event":"order","data":{"amount":2}}`)
+				postWebhook(t, mux, `{"event":"refund","data":{"amount":1}}`)
+				postWebhook(t, mux, `{"event":"refund","data":{"amount":2}}`)
+			}
+		}
+	}()
+
+	scanner := bufio.NewScanner(resp.Body)
+	var lines []string
+	for scanner.Scan() && scanner.Text() != "" {
+		lines = append(lines, scanner.Text())
+	}
+	if len(lines) != 3 || !strings.Contains(lines[2], `"event":"refund"`) || !strings.Contains(lines[2], `"amount":2`) {
+		t.Errorf("expected refunds of 2 through the saved query, got %q", lines)
+	}
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// stripeAPIKey enables cross-checking Stripe events against the Stripe API.
+var stripeAPIKey string
+
+var stripeAPIBase = "https://api.stripe.com"
+
+const (
+	// stripeCheckTimeout bounds an API lookup.
+	stripeCheckTimeout = 5 * time.Second
+	// stripeCheckWorkers is how many API lookups run at once.
+	stripeCheckWorkers = 4
+	// stripeCheckQueueSize bounds the lookups waiting for a worker. Past it
+	// an event is reported as not checked rather than held up.
+	stripeCheckQueueSize = 1000
+	// stripeRetryWindow is how long Stripe keeps retrying a delivery. An
+	// older event cannot be a genuine retry.
+	stripeRetryWindow = 72 * time.Hour
+)
+
+// Outcomes of checking a Stripe event.
+const (
+	stripePending   = "pending"   // the lookup has not answered yet
+	stripeConfirmed = "confirmed" // the API knows the event as delivered
+	stripeMismatch  = "mismatch"  // the API has the id but not this event
+	stripeUnknown   = "unknown"   // the API has no event with this id
+	stripeStale     = "stale"     // older than Stripe's retry window
+	stripeError     = "error"     // the lookup failed
+)
+
+// StripeEvent holds the envelope of a Stripe event. Check is the result of
+// cross-checking it, empty if that is not configured and pending until the
+// API lookup, done after the event is stored, answers.
+type StripeEvent struct {
+	ID         string    `json:"id"`
+	Type       string    `json:"type"`
+	APIVersion string    `json:"api_version,omitempty"`
+	Livemode   bool      `json:"livemode"`
+	Created    time.Time `json:"created"`
+	Check      string    `json:"check,omitempty"`
+	CheckError string    `json:"check_error,omitempty"`
+}
+
+type stripeEnvelope struct {
+	ID         string `json:"id"`
+	Object     string `json:"object"`
+	Type       string `json:"type"`
+	APIVersion string `json:"api_version"`
+	Livemode   bool   `json:"livemode"`
+	Created    int64  `json:"created"`
+}
+
+// stripeEvent recognises a Stripe event body.
+func stripeEvent(body []byte) *StripeEvent {
+	// Most bodies are not Stripe events; finding no event ID is cheaper than
+	// decoding them a second time.
+	if !bytes.Contains(body, []byte(`"evt_`)) {
+		return nil
+	}
+	var env stripeEnvelope
+	if json.Unmarshal(body, &env) != nil || env.Object != "event" || !strings.HasPrefix(env.ID, "evt_") || env.Type == "" {
+		return nil
+	}
+	return &StripeEvent{
+		ID:         env.ID,
+		Type:       env.Type,
+		APIVersion: env.APIVersion,
+		Livemode:   env.Livemode,
+		Created:    time.Unix(env.Created, 0).UTC(),
+	}
+}
+
+// precheck flags stale events, reporting whether the event is left for
+// the API to check.
+func (se *StripeEvent) precheck(now time.Time) bool {
+	if now.Sub(se.Created) > stripeRetryWindow {
+		se.Check = stripeStale
+		return false
+	}
+	return currentSecret(stripeAPIKey) != ""
+}
+
+// check flags stale events and, with an API key, looks the event up to
+// catch forged deliveries.
+func (se *StripeEvent) check(ctx context.Context, client *http.Client, now time.Time) {
+	if !se.precheck(now) {
+		return
+	}
+	apiKey := currentSecret(stripeAPIKey)
+
+	ctx, cancel := context.WithTimeout(ctx, stripeCheckTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, stripeAPIBase+"/v1/events/"+url.PathEscape(se.ID), nil)
+	if err != nil {
+		se.Check, se.CheckError = stripeError, err.Error()
+		return
+	}
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+	resp, err := client.Do(req)
+	if err != nil {
+		se.Check, se.CheckError = stripeError, err.Error()
+		return
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		se.Check = stripeUnknown
+		return
+	case resp.StatusCode != http.StatusOK:
+		se.Check, se.CheckError = stripeError, fmt.Sprintf("GET /v1/events/%s: %s", se.ID, resp.Status)
+		return
+	}
+	var env stripeEnvelope
+	if err := json.NewDecoder(resp.Body).Decode(&env); err != nil {
+		se.Check, se.CheckError = stripeError, err.Error()
+		return
+	}
+	if env.Type != se.Type || env.Livemode != se.Livemode || env.Created != se.Created.Unix() {
+		se.Check = stripeMismatch
+		return
+	}
+	se.Check = stripeConfirmed
+}
+
+// stripeCheckJob is the lookup of the Stripe event of the record id.
+type stripeCheckJob struct {
+	buffer *RingBuffer
+	id     string
+	event  StripeEvent
+}
+
+// stripeChecks runs the API lookups of stored Stripe events, so that a slow
+// or unreachable API never holds up ingest. Its workers start with the
+// first lookup.
+var stripeChecks struct {
+	once sync.Once
+	jobs chan stripeCheckJob
+}
+
+// checkStripeLater queues the API lookup of the event of a newly stored
+// record, whose check stays pending until the lookup answers.
+func checkStripeLater(buffer *RingBuffer, stored WebhookParams) {
+	if stored.ID == "" || stored.Stripe == nil || stored.Stripe.Check != stripePending {
+		return
+	}
+	stripeChecks.once.Do(func() {
+		stripeChecks.jobs = make(chan stripeCheckJob, stripeCheckQueueSize)
+		for range stripeCheckWorkers {
+			go func() {
+				for job := range stripeChecks.jobs {
+					job.event.check(context.Background(), http.DefaultClient, time.Now())
+					job.buffer.setStripeCheck(job.id, job.event)
+				}
+			}()
+		}
+	})
+	select {
+	case stripeChecks.jobs <- stripeCheckJob{buffer, stored.ID, *stored.Stripe}:
+	default:
+		log.Printf("Stripe event %s not checked: %d lookups already queued", stored.Stripe.ID, stripeCheckQueueSize)
+		event := *stored.Stripe
+		event.Check, event.CheckError = stripeError, "too many lookups queued"
+		buffer.setStripeCheck(stored.ID, event)
+	}
+}
+
+// setStripeCheck replaces the Stripe event of the record id with se, once
+// it is checked. A record evicted meanwhile is left alone.
+func (rb *RingBuffer) setStripeCheck(id string, se StripeEvent) {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+
+	idx, ok := rb.find(id)
+	if !ok {
+		return
+	}
+	// Copy on write: records handed out by Query share the old event.
+	rb.slot(idx).Stripe = &se
+}
+
+// applyStripeEvent fills in the event type, version and idempotency key of a
+// Stripe delivery from its envelope. Stripe retries reuse the event id, so
+// keying on it makes them count as re-deliveries.
+func applyStripeEvent(res *WebhookParams, se *StripeEvent) {
+	res.Stripe = se
+	if res.EventType == "" {
+		res.EventType = se.Type
+	}
+	if res.Version == "" {
+		res.Version = se.APIVersion
+	}
+	if res.IdempotencyKey == "" {
+		res.IdempotencyKey = "stripe:" + se.ID
+	}
+}
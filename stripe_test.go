@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func stripeBody(id string, created time.Time) string {
+	return fmt.Sprintf(`{"id":%q,"object":"event","type":"invoice.paid","api_version":"2024-06-20","livemode":false,"created":%d,"data":{"object":{"amount_paid":500}}}`,
+		id, created.Unix())
+}
+
+func TestStripeEnrichment(t *testing.T) {
+	mux := newTestServer()
+	body := stripeBody("evt_1", time.Now())
+	postWebhook(t, mux, body)
+	rec := postWebhook(t, mux, body)
+	if rec.Header().Get("X-Delivery-Count") != "2" {
+		t.Errorf("expected the retry to count as a re-delivery, got %s", rec.Header().Get("X-Delivery-Count"))
+	}
+
+	got := queryWebhooks(t, mux, "/query/invoice.paid?object.amount_paid=500")
+	if len(got) != 1 || got[0].Stripe == nil || got[0].Stripe.ID != "evt_1" || got[0].Version != "2024-06-20" {
+		t.Fatalf("expected the Stripe envelope, got %+v", got)
+	}
+	if got[0].Stripe.Check != "" {
+		t.Errorf("expected no check without an API key, got %q", got[0].Stripe.Check)
+	}
+
+	postWebhook(t, mux, stripeBody("evt_old", time.Now().Add(-96*time.Hour)))
+	if got := queryWebhooks(t, mux, "/query/invoice.paid"); got[0].Stripe.Check != stripeStale {
+		t.Errorf("expected an old event to be flagged stale, got %q", got[0].Stripe.Check)
+	}
+}
+
+func TestStripeCrossCheck(t *testing.T) {
+	created := time.Now().Add(-time.Minute)
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer sk_test" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch strings.TrimPrefix(r.URL.Path, "/v1/events/") {
+		case "evt_real":
+			fmt.Fprint(w, stripeBody("evt_real", created))
+		case "evt_changed":
+			fmt.Fprint(w, strings.Replace(stripeBody("evt_changed", created), "invoice.paid", "invoice.voided", 1))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer api.Close()
+	stripeAPIKey, stripeAPIBase = "sk_test", api.URL
+	t.Cleanup(func() { stripeAPIKey, stripeAPIBase = "", "https://api.stripe.com" })
+
+	tests := map[string]string{
+		"evt_real":    stripeConfirmed,
+		"evt_changed": stripeMismatch,
+		"evt_forged":  stripeUnknown,
+	}
+	for id, want := range tests {
+		se := stripeEvent([]byte(stripeBody(id, created)))
+		se.check(t.Context(), http.DefaultClient, time.Now())
+		if se.Check != want {
+			t.Errorf("%s: got %q (%s), want %q", id, se.Check, se.CheckError, want)
+		}
+	}
+
+	stripeAPIKey = "sk_wrong"
+	se := stripeEvent([]byte(stripeBody("evt_real", created)))
+	se.check(t.Context(), http.DefaultClient, time.Now())
+	if se.Check != stripeError || se.CheckError == "" {
+		t.Errorf("expected a failed lookup to be reported, got %+v", se)
+	}
+}
+
+func TestStripeCheckDoesNotHoldIngest(t *testing.T) {
+	created := time.Now().Add(-time.Minute)
+	release := make(chan struct{})
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		fmt.Fprint(w, stripeBody("evt_slow", created))
+	}))
+	defer api.Close()
+	stripeAPIKey, stripeAPIBase = "sk_test", api.URL
+	t.Cleanup(func() { stripeAPIKey, stripeAPIBase = "", "https://api.stripe.com" })
+
+	mux := newTestServer()
+	postWebhook(t, mux, stripeBody("evt_slow", created))
+	if got := queryWebhooks(t, mux, "/query/invoice.paid"); got[0].Stripe.Check != stripePending {
+		t.Fatalf("expected the check to be pending while the API is slow, got %q", got[0].Stripe.Check)
+	}
+
+	close(release)
+	waitFor(t, func() bool {
+		got := queryWebhooks(t, mux, "/query/invoice.paid")
+		return got[0].Stripe.Check == stripeConfirmed
+	})
+}
@@ -0,0 +1,685 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// subscriptionBatch is the most records a pull returns, and the batch a
+	// push subscription works through before checking for new ones.
+	subscriptionBatch = 100
+	// subscriptionTimeout bounds a single push delivery.
+	subscriptionTimeout = 10 * time.Second
+	// subscriptionMaxRetry caps the redelivery delay of a failing push
+	// subscription, which doubles from one second per consecutive failure.
+	subscriptionMaxRetry = time.Minute
+	// subscriptionLogSize is how many delivery attempts a push subscription's
+	// delivery log keeps.
+	subscriptionLogSize = 100
+	// contractMaxBody is how much of a response body is checked against a
+	// response contract.
+	contractMaxBody = 1 << 20
+)
+
+// After returns up to limit records stored after sequence seq that match
+// filter (all records if nil), oldest first. evicted counts records after
+// seq that were evicted from the buffer before they could be returned. Like
+// Query, it scans a snapshot and stops early with truncated set when ctx is
+// done.
+func (rb *RingBuffer) After(ctx context.Context, seq uint64, limit int, filter *QueryFilter) (items []WebhookParams, evicted uint64, truncated bool) {
+	return rb.Snapshot().After(ctx, seq, limit, filter)
+}
+
+// LastSequence returns the sequence number of the most recently stored
+// record, 0 if there is none.
+func (rb *RingBuffer) LastSequence() uint64 {
+	rb.mu.RLock()
+	defer rb.mu.RUnlock()
+	return rb.sequence
+}
+
+// SubscriptionRequest creates a subscription. With a URL records are pushed
+// to it; without one they are pulled from /subscriptions/{id}/records.
+// Match selects records in /query parameter syntax, all records if empty.
+// SavedQuery names a saved query Match applies on top of; it is resolved
+// when the subscription is made, so later changes to it do not apply.
+// From is "latest" (the default) to start with the next record or
+// "earliest" to start with the oldest one still buffered. Expect is the
+// response contract a push target is checked against. MaxAttempts is how
+// many times in a row a push subscription tries a record before moving it
+// to the dead-letter queue, 10 by default. Transform reshapes the pushed
+// requests for a target expecting another shape.
+type SubscriptionRequest struct {
+	URL         string            `json:"url,omitempty"`
+	Match       json.RawMessage   `json:"match,omitempty"`
+	SavedQuery  string            `json:"saved_query,omitempty"`
+	From        string            `json:"from,omitempty"`
+	Expect      *ResponseContract `json:"expect,omitempty"`
+	MaxAttempts int               `json:"max_attempts,omitempty"`
+	Transform   *Transform        `json:"transform,omitempty"`
+}
+
+// Subscription is a consumer of captured records. Acked is the sequence
+// number up to which it has acknowledged them: everything after it is
+// delivered again until acknowledged. Evicted counts records after Acked
+// that left the buffer before they could be delivered. Violations counts
+// the responses that broke the Expect contract, DeadLettered the records
+// given up on.
+type Subscription struct {
+	ID            string            `json:"id"`
+	URL           string            `json:"url,omitempty"`
+	Match         json.RawMessage   `json:"match,omitempty"`
+	SavedQuery    string            `json:"saved_query,omitempty"`
+	Expect        *ResponseContract `json:"expect,omitempty"`
+	MaxAttempts   int               `json:"max_attempts,omitempty"`
+	Transform     *Transform        `json:"transform,omitempty"`
+	Acked         uint64            `json:"acked"`
+	Evicted       uint64            `json:"evicted,omitempty"`
+	Failures      int               `json:"failures,omitempty"`
+	LastError     string            `json:"last_error,omitempty"`
+	Delivered     int               `json:"delivered,omitempty"`
+	Violations    int               `json:"violations,omitempty"`
+	LastViolation string            `json:"last_violation,omitempty"`
+	DeadLettered  int               `json:"dead_lettered,omitempty"`
+	CreatedAt     time.Time         `json:"created_at"`
+}
+
+// DeliveryAttempt is one push of a record to a subscriber, as kept in the
+// subscription's delivery log.
+type DeliveryAttempt struct {
+	ID         string    `json:"id"`
+	Sequence   uint64    `json:"sequence"`
+	At         time.Time `json:"at"`
+	Status     int       `json:"status,omitempty"`
+	DurationMs float64   `json:"duration_ms"`
+	Error      string    `json:"error,omitempty"`
+	Violations []string  `json:"violations,omitempty"`
+}
+
+type subscription struct {
+	Subscription
+	filter *QueryFilter
+	wake   chan struct{}
+	cancel context.CancelFunc
+	log    []DeliveryAttempt
+	// requeued are dead letters handed back, delivered before the records
+	// after Acked.
+	requeued []WebhookParams
+}
+
+// Subscriptions tracks subscribers and their acknowledged offsets, and
+// pushes records to push subscribers until they accept them. Offsets are
+// kept in memory, so subscriptions do not survive a restart.
+type Subscriptions struct {
+	mu     sync.Mutex
+	buffer *RingBuffer
+	client *http.Client
+	subs   map[string]*subscription
+	retry  time.Duration
+	// saved resolves SavedQuery, see registerRoutes.
+	saved       *SavedQueries
+	deadLetters []DeadLetter // oldest first
+	breakers    *CircuitBreakers
+}
+
+func NewSubscriptions(buffer *RingBuffer, client *http.Client) *Subscriptions {
+	return &Subscriptions{
+		buffer:   buffer,
+		client:   client,
+		subs:     make(map[string]*subscription),
+		retry:    time.Second,
+		breakers: NewCircuitBreakers(),
+	}
+}
+
+func (s *Subscriptions) Create(req SubscriptionRequest) (Subscription, error) {
+	sub := &subscription{Subscription: Subscription{
+		ID:         newRecordID(),
+		URL:        req.URL,
+		Match:      req.Match,
+		SavedQuery: req.SavedQuery,
+		Expect:     req.Expect,
+		Transform:  req.Transform,
+		CreatedAt:  time.Now().UTC(),
+	}}
+	if req.Transform != nil {
+		if req.URL == "" {
+			return Subscription{}, &paramError{codeInvalidParameter, "transform needs a push subscription url"}
+		}
+		if err := req.Transform.validate(); err != nil {
+			return Subscription{}, err
+		}
+	}
+	if req.URL != "" {
+		sub.MaxAttempts = subscriptionMaxAttempts
+	}
+	if req.MaxAttempts != 0 {
+		if req.URL == "" || req.MaxAttempts < 0 {
+			return Subscription{}, &paramError{codeInvalidParameter, "max_attempts needs a push subscription url and must be positive"}
+		}
+		sub.MaxAttempts = req.MaxAttempts
+	}
+	if req.Expect != nil {
+		if req.URL == "" {
+			return Subscription{}, &paramError{codeInvalidParameter, "expect needs a push subscription url"}
+		}
+		if err := req.Expect.compile(); err != nil {
+			return Subscription{}, err
+		}
+	}
+	if len(req.Match) > 0 || req.SavedQuery != "" {
+		params := url.Values{}
+		if len(req.Match) > 0 {
+			var err error
+			if params, err = decodeParams(req.Match); err != nil {
+				return Subscription{}, &paramError{codeInvalidParameter, "match: " + err.Error()}
+			}
+		}
+		if req.SavedQuery != "" {
+			var err error
+			if params, err = s.saved.Resolve(req.SavedQuery, params); err != nil {
+				return Subscription{}, err
+			}
+		}
+		filter, err := parseQueryFilter(params, "")
+		if err != nil {
+			return Subscription{}, err
+		}
+		sub.filter = &filter
+	}
+	switch req.From {
+	case "", "latest":
+		sub.Acked = s.buffer.LastSequence()
+	case "earliest":
+	default:
+		return Subscription{}, &paramError{codeInvalidParameter, `from must be "latest" or "earliest"`}
+	}
+
+	var ctx context.Context
+	if sub.URL != "" {
+		ctx, sub.cancel = context.WithCancel(context.Background())
+		sub.wake = make(chan struct{}, 1)
+	}
+	s.mu.Lock()
+	s.subs[sub.ID] = sub
+	created := sub.Subscription
+	s.mu.Unlock()
+	if ctx != nil {
+		go s.run(ctx, sub)
+	}
+	return created, nil
+}
+
+func (s *Subscriptions) Get(id string) (Subscription, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sub, ok := s.subs[id]
+	if !ok {
+		return Subscription{}, false
+	}
+	return sub.Subscription, true
+}
+
+func (s *Subscriptions) List() []Subscription {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := make([]Subscription, 0, len(s.subs))
+	for _, sub := range s.subs {
+		list = append(list, sub.Subscription)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.Before(list[j].CreatedAt) })
+	return list
+}
+
+func (s *Subscriptions) Delete(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sub, ok := s.subs[id]
+	if ok && sub.cancel != nil {
+		sub.cancel()
+	}
+	delete(s.subs, id)
+	if ok && sub.URL != "" && !s.pushesTo(sub.URL) {
+		s.breakers.Forget(sub.URL)
+	}
+	return ok
+}
+
+// pushesTo reports whether a subscription pushes to target. s.mu must be
+// held.
+func (s *Subscriptions) pushesTo(target string) bool {
+	for _, sub := range s.subs {
+		if sub.URL == target {
+			return true
+		}
+	}
+	return false
+}
+
+// Pending returns up to limit unacknowledged records of a subscription, and
+// whether ctx cut the scan for them short.
+func (s *Subscriptions) Pending(ctx context.Context, id string, limit int) (items []WebhookParams, _ Subscription, truncated, ok bool) {
+	s.mu.Lock()
+	sub, found := s.subs[id]
+	if !found {
+		s.mu.Unlock()
+		return nil, Subscription{}, false, false
+	}
+	acked, filter := sub.Acked, sub.filter
+	s.mu.Unlock()
+
+	items, evicted, truncated := s.buffer.After(ctx, acked, limit, filter)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sub.Evicted = evicted
+	return items, sub.Subscription, truncated, true
+}
+
+// Ack acknowledges every record of a subscription up to and including
+// sequence seq. Acknowledgements are cumulative, so an older seq is a no-op.
+func (s *Subscriptions) Ack(id string, seq uint64) (Subscription, error) {
+	if last := s.buffer.LastSequence(); seq > last {
+		return Subscription{}, &paramError{codeInvalidParameter,
+			fmt.Sprintf("Cannot acknowledge sequence %d, the latest record is %d", seq, last)}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sub, ok := s.subs[id]
+	if !ok {
+		return Subscription{}, errSubscriptionNotFound
+	}
+	sub.Acked = max(sub.Acked, seq)
+	return sub.Subscription, nil
+}
+
+var errSubscriptionNotFound = errors.New("subscription not found")
+
+// QueueName names the subscriptions' queue in /debug/vars.
+func (s *Subscriptions) QueueName() string { return "subscriptions" }
+
+// QueueDepth is how many buffered records all subscriptions have yet to
+// acknowledge, counting for each only the records its filter matches.
+func (s *Subscriptions) QueueDepth() int {
+	snap := s.buffer.Snapshot()
+	type pending struct {
+		acked  uint64
+		filter *QueryFilter
+	}
+	s.mu.Lock()
+	subs := make([]pending, 0, len(s.subs))
+	depth := 0
+	for _, sub := range s.subs {
+		subs = append(subs, pending{sub.Acked, sub.filter})
+		depth += len(sub.requeued)
+	}
+	s.mu.Unlock()
+
+	for _, sub := range subs {
+		snap.Scan(context.Background(), QueryFilter{}, func(item WebhookParams) bool {
+			if item.Sequence <= sub.acked {
+				return false
+			}
+			if sub.filter == nil || sub.filter.Match(item) {
+				depth++
+			}
+			return true
+		})
+	}
+	return depth
+}
+
+// OnIngest wakes the push subscriptions so new records go out right away.
+func (s *Subscriptions) OnIngest(item WebhookParams, body []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, sub := range s.subs {
+		if sub.wake != nil {
+			select {
+			case sub.wake <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
+
+// run pushes a subscription's records in order until ctx is cancelled. A
+// failed delivery stops the batch and is retried with backoff, so nothing
+// after it is sent out of order, until it has failed MaxAttempts times in
+// a row and is dead-lettered. While the circuit to its target is open it
+// waits without counting attempts.
+func (s *Subscriptions) run(ctx context.Context, sub *subscription) {
+	for {
+		if item, requeued, err := s.push(ctx, sub); err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			var open *circuitOpenError
+			if errors.As(err, &open) {
+				s.mu.Lock()
+				sub.LastError = err.Error()
+				s.mu.Unlock()
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(open.retryIn):
+				}
+				continue
+			}
+			s.mu.Lock()
+			sub.Failures++
+			sub.LastError = err.Error()
+			delay := min(s.retry<<min(sub.Failures-1, 16), subscriptionMaxRetry)
+			dead := sub.Failures >= sub.MaxAttempts
+			if dead {
+				s.deadLetter(sub, item, requeued)
+			}
+			s.mu.Unlock()
+			if dead {
+				log.Printf("Subscription %s gave up on record %s after %d attempts: %v", sub.ID, item.ID, sub.MaxAttempts, err)
+				continue
+			}
+			if debug {
+				log.Printf("Subscription %s delivery failed, retrying in %s: %v", sub.ID, delay, err)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(delay):
+			}
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-sub.wake:
+		}
+	}
+}
+
+// push delivers the requeued and then the pending records of sub,
+// acknowledging each one the subscriber accepts. On failure it returns the
+// record that failed and whether it was a requeued one.
+func (s *Subscriptions) push(ctx context.Context, sub *subscription) (failed WebhookParams, requeued bool, err error) {
+	for {
+		s.mu.Lock()
+		if len(sub.requeued) > 0 {
+			item := sub.requeued[0]
+			s.mu.Unlock()
+			if err := s.deliver(ctx, sub, item); err != nil {
+				return item, true, err
+			}
+			s.mu.Lock()
+			sub.requeued = sub.requeued[1:]
+			sub.Failures, sub.LastError = 0, ""
+			s.mu.Unlock()
+			continue
+		}
+		acked := sub.Acked
+		s.mu.Unlock()
+
+		items, evicted, _ := s.buffer.After(ctx, acked, subscriptionBatch, sub.filter)
+		s.mu.Lock()
+		sub.Evicted = evicted
+		s.mu.Unlock()
+		if len(items) == 0 {
+			return WebhookParams{}, false, nil
+		}
+		for _, item := range items {
+			if err := s.deliver(ctx, sub, item); err != nil {
+				return item, false, err
+			}
+			s.mu.Lock()
+			sub.Acked = item.Sequence
+			sub.Failures, sub.LastError = 0, ""
+			s.mu.Unlock()
+		}
+	}
+}
+
+// deliver posts item in its original shape, or as its transform shapes it.
+// Consumers see a record again after a failure, so X-Echo-Id lets them drop
+// duplicates.
+func (s *Subscriptions) deliver(parent context.Context, sub *subscription, item WebhookParams) error {
+	body, contentType, err := sub.Transform.body(item)
+	if err != nil {
+		return err
+	}
+	if err := s.breakers.Allow(sub.URL); err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(parent, subscriptionTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("X-Echo-Id", item.ID)
+	req.Header.Set("X-Echo-Sequence", strconv.FormatUint(item.Sequence, 10))
+	req.Header.Set("X-Echo-Subscription", sub.ID)
+	sub.Transform.headers(req.Header)
+
+	start := time.Now()
+	attempt := DeliveryAttempt{ID: item.ID, Sequence: item.Sequence, At: start.UTC()}
+	resp, err := s.client.Do(req)
+	if err != nil && parent.Err() != nil {
+		s.breakers.Abort(sub.URL)
+		return err
+	}
+	if err != nil {
+		s.breakers.Done(sub.URL, err)
+		attempt.Error = err.Error()
+		s.logDelivery(sub, attempt)
+		return err
+	}
+	var respBody []byte
+	if sub.Expect.needsBody() {
+		respBody, _ = io.ReadAll(io.LimitReader(resp.Body, contractMaxBody))
+	}
+	resp.Body.Close()
+	latency := time.Since(start)
+	attempt.Status, attempt.DurationMs = resp.StatusCode, millis(latency)
+	attempt.Violations = sub.Expect.Check(resp.StatusCode, respBody, latency)
+	if resp.StatusCode >= 300 {
+		err = fmt.Errorf("POST %s: %s", sub.URL, resp.Status)
+		attempt.Error = err.Error()
+	}
+	s.breakers.Done(sub.URL, err)
+	s.logDelivery(sub, attempt)
+	return err
+}
+
+// logDelivery adds attempt to the delivery log of sub and its counts.
+func (s *Subscriptions) logDelivery(sub *subscription, attempt DeliveryAttempt) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if attempt.Error == "" {
+		sub.Delivered++
+	}
+	if len(attempt.Violations) > 0 {
+		sub.Violations++
+		sub.LastViolation = strings.Join(attempt.Violations, "; ")
+	}
+	sub.log = append(sub.log, attempt)
+	if len(sub.log) > subscriptionLogSize {
+		sub.log = sub.log[len(sub.log)-subscriptionLogSize:]
+	}
+}
+
+// Deliveries returns the delivery log of a push subscription, newest first,
+// only the attempts that broke its contract when violations is set.
+func (s *Subscriptions) Deliveries(id string, violations bool) ([]DeliveryAttempt, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sub, ok := s.subs[id]
+	if !ok {
+		return nil, false
+	}
+	attempts := []DeliveryAttempt{}
+	for i := len(sub.log) - 1; i >= 0; i-- {
+		if !violations || len(sub.log[i].Violations) > 0 {
+			attempts = append(attempts, sub.log[i])
+		}
+	}
+	return attempts, true
+}
+
+func createSubscriptionHandler(subs *Subscriptions) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req SubscriptionRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeProblem(w, r, http.StatusBadRequest, codeInvalidJSON, "Invalid JSON: "+err.Error())
+			return
+		}
+		sub, err := subs.Create(req)
+		if err != nil {
+			writeParamError(w, r, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(sub)
+	}
+}
+
+func listSubscriptionsHandler(subs *Subscriptions) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(subs.List())
+	}
+}
+
+func getSubscriptionHandler(subs *Subscriptions) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		sub, ok := subs.Get(r.PathValue("id"))
+		if !ok {
+			writeProblem(w, r, http.StatusNotFound, codeNotFound, "No subscription with id "+r.PathValue("id"))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(sub)
+	}
+}
+
+func deleteSubscriptionHandler(subs *Subscriptions) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !subs.Delete(r.PathValue("id")) {
+			writeProblem(w, r, http.StatusNotFound, codeNotFound, "No subscription with id "+r.PathValue("id"))
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func subscriptionDeliveriesHandler(subs *Subscriptions) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		violations := false
+		if v := r.URL.Query().Get("violations"); v != "" {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				writeProblem(w, r, http.StatusBadRequest, codeInvalidParameter, "violations must be a boolean")
+				return
+			}
+			violations = b
+		}
+		attempts, ok := subs.Deliveries(r.PathValue("id"), violations)
+		if !ok {
+			writeProblem(w, r, http.StatusNotFound, codeNotFound, "No subscription with id "+r.PathValue("id"))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(attempts)
+	}
+}
+
+type subscriptionRecords struct {
+	Records      []WebhookParams `json:"records"`
+	Subscription Subscription    `json:"subscription"`
+	Truncated    bool            `json:"truncated,omitempty"`
+}
+
+// pullSubscriptionHandler returns the unacknowledged records of a pull
+// subscription, oldest first. The same records are returned until they are
+// acknowledged.
+func pullSubscriptionHandler(subs *Subscriptions) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		limit := subscriptionBatch
+		if v := r.URL.Query().Get("max"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 {
+				writeProblem(w, r, http.StatusBadRequest, codeInvalidParameter, "max must be a positive integer")
+				return
+			}
+			limit = min(n, subscriptionBatch)
+		}
+		if sub, ok := subs.Get(r.PathValue("id")); ok && sub.URL != "" {
+			writeProblem(w, r, http.StatusBadRequest, codeInvalidParameter, "Push subscriptions cannot be pulled from")
+			return
+		}
+
+		ctx, cancel := scanContext(r)
+		defer cancel()
+		items, sub, truncated, ok := subs.Pending(ctx, r.PathValue("id"), limit)
+		if !ok {
+			writeProblem(w, r, http.StatusNotFound, codeNotFound, "No subscription with id "+r.PathValue("id"))
+			return
+		}
+		if items == nil {
+			items = []WebhookParams{}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(subscriptionRecords{Records: items, Subscription: sub, Truncated: truncated})
+	}
+}
+
+func ackSubscriptionHandler(subs *Subscriptions) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Sequence uint64 `json:"sequence"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeProblem(w, r, http.StatusBadRequest, codeInvalidJSON, "Invalid JSON: "+err.Error())
+			return
+		}
+		sub, err := subs.Ack(r.PathValue("id"), req.Sequence)
+		if errors.Is(err, errSubscriptionNotFound) {
+			writeProblem(w, r, http.StatusNotFound, codeNotFound, "No subscription with id "+r.PathValue("id"))
+			return
+		}
+		if err != nil {
+			writeParamError(w, r, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(sub)
+	}
+}
+
+// registerSubscriptionRoutes mounts the admin-only subscription API. Push
+// targets are arbitrary URLs, so creating one is an admin action.
+func registerSubscriptionRoutes(mux *http.ServeMux, subs *Subscriptions, adminToken string) {
+	handleAPI(mux, "GET /subscriptions", requireAdmin(adminToken, listSubscriptionsHandler(subs)))
+	handleAPI(mux, "POST /subscriptions", requireAdmin(adminToken, createSubscriptionHandler(subs)))
+	handleAPI(mux, "GET /subscriptions/{id}", requireAdmin(adminToken, getSubscriptionHandler(subs)))
+	handleAPI(mux, "DELETE /subscriptions/{id}", requireAdmin(adminToken, deleteSubscriptionHandler(subs)))
+	handleAPI(mux, "GET /subscriptions/{id}/records", requireAdmin(adminToken, pullSubscriptionHandler(subs)))
+	handleAPI(mux, "POST /subscriptions/{id}/ack", requireAdmin(adminToken, ackSubscriptionHandler(subs)))
+	handleAPI(mux, "GET /subscriptions/{id}/deliveries", requireAdmin(adminToken, subscriptionDeliveriesHandler(subs)))
+	handleAPI(mux, "GET /deadletter", requireAdmin(adminToken, deadLettersHandler(subs)))
+	handleAPI(mux, "POST /deadletter/{id}/requeue", requireAdmin(adminToken, requeueHandler(subs)))
+	handleAPI(mux, "GET /stats/circuits", requireAdmin(adminToken, circuitsHandler(subs.breakers)))
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newSubscriptionServer(size int) (*http.ServeMux, *RingBuffer, *Subscriptions) {
+	buffer := NewRingBuffer(size)
+	subs := NewSubscriptions(buffer, http.DefaultClient)
+	subs.retry = time.Millisecond
+	mux := http.NewServeMux()
+	registerSubscriptionRoutes(mux, subs, "secret")
+	registerRoutes(mux, buffer, "secret", subs)
+	return mux, buffer, subs
+}
+
+func subscriptionRequest(t *testing.T, mux *http.ServeMux, method, path, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer secret")
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	return rec
+}
+
+func createSubscription(t *testing.T, mux *http.ServeMux, body string) Subscription {
+	t.Helper()
+	rec := subscriptionRequest(t, mux, http.MethodPost, "/subscriptions", body)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create failed with status %d: %s", rec.Code, rec.Body.String())
+	}
+	var sub Subscription
+	json.NewDecoder(rec.Body).Decode(&sub)
+	return sub
+}
+
+func pullSubscription(t *testing.T, mux *http.ServeMux, id string) subscriptionRecords {
+	t.Helper()
+	rec := subscriptionRequest(t, mux, http.MethodGet, "/subscriptions/"+id+"/records?max=2", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("pull failed with status %d: %s", rec.Code, rec.Body.String())
+	}
+	var got subscriptionRecords
+	json.NewDecoder(rec.Body).Decode(&got)
+	return got
+}
+
+func TestSubscriptionSavedQuery(t *testing.T) {
+	mux, _, _ := newSubscriptionServer(10)
+	if rec := putSavedQuery(t, mux, "usd-orders", `{"event_type":"order","currency":"usd"}`); rec.Code != http.StatusCreated {
+		t.Fatalf("expected the saved query to be created, got %d", rec.Code)
+	}
+	sub := createSubscription(t, mux, `{"saved_query":"usd-orders","match":{"status":"paid"}}`)
+	if sub.SavedQuery != "usd-orders" {
+		t.Errorf("expected the subscription to name its saved query, got %+v", sub)
+	}
+	postWebhook(t, mux, `{"event":"order","data":{"currency":"usd","status":"open"}}`)
+	postWebhook(t, mux, `{"event":"order","data":{"currency":"eur","status":"paid"}}`)
+	postWebhook(t, mux, `{"event":"order","data":{"currency":"usd","status":"paid"}}`)
+
+	if got := pullSubscription(t, mux, sub.ID); len(got.Records) != 1 || got.Records[0].Sequence != 3 {
+		t.Errorf("expected the paid usd order, got %+v", got.Records)
+	}
+	rec := subscriptionRequest(t, mux, http.MethodPost, "/subscriptions", `{"saved_query":"missing"}`)
+	if p := decodeProblem(t, rec); rec.Code != http.StatusBadRequest || p.Code != codeInvalidParameter {
+		t.Errorf("expected an unknown saved query to be refused, got %d %+v", rec.Code, p)
+	}
+}
+
+func TestRingBufferAfter(t *testing.T) {
+	buffer := NewRingBuffer(3)
+	for _, event := range []string{"a", "b", "a", "b", "a"} {
+		buffer.Push(WebhookParams{EventType: event})
+	}
+
+	items, evicted, _ := buffer.After(context.Background(), 0, 0, nil)
+	if len(items) != 3 || items[0].Sequence != 3 || evicted != 2 {
+		t.Errorf("expected sequences 3-5 with 2 evicted, got %d items from %d, %d evicted", len(items), items[0].Sequence, evicted)
+	}
+	filter := QueryFilter{EventTypes: []string{"a"}}
+	if items, evicted, _ := buffer.After(context.Background(), 3, 1, &filter); len(items) != 1 || items[0].Sequence != 5 || evicted != 0 {
+		t.Errorf("expected sequence 5, got %+v (%d evicted)", items, evicted)
+	}
+}
+
+func TestPullSubscription(t *testing.T) {
+	mux, _, _ := newSubscriptionServer(10)
+	postWebhook(t, mux, `{"event":"before"}`)
+	sub := createSubscription(t, mux, `{"match":{"event_type":"order"}}`)
+
+	for i := 0; i < 3; i++ {
+		postWebhook(t, mux, `{"event":"order"}`)
+		postWebhook(t, mux, `{"event":"other"}`)
+	}
+
+	got := pullSubscription(t, mux, sub.ID)
+	if len(got.Records) != 2 || got.Records[0].Sequence != 2 {
+		t.Fatalf("expected the first 2 orders, got %+v", got.Records)
+	}
+	// Unacknowledged records are delivered again.
+	if again := pullSubscription(t, mux, sub.ID); again.Records[0].ID != got.Records[0].ID {
+		t.Errorf("expected redelivery of %s, got %s", got.Records[0].ID, again.Records[0].ID)
+	}
+
+	ack := `{"sequence":` + jsonNumber(got.Records[1].Sequence) + `}`
+	if rec := subscriptionRequest(t, mux, http.MethodPost, "/subscriptions/"+sub.ID+"/ack", ack); rec.Code != http.StatusOK {
+		t.Fatalf("ack failed with status %d: %s", rec.Code, rec.Body.String())
+	}
+	got = pullSubscription(t, mux, sub.ID)
+	if len(got.Records) != 1 || got.Records[0].Sequence != 6 {
+		t.Fatalf("expected the last order, got %+v", got.Records)
+	}
+
+	if rec := subscriptionRequest(t, mux, http.MethodPost, "/subscriptions/"+sub.ID+"/ack", `{"sequence":99}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400 for acknowledging the future, got %d", rec.Code)
+	}
+	if rec := subscriptionRequest(t, mux, http.MethodDelete, "/subscriptions/"+sub.ID, ""); rec.Code != http.StatusNoContent {
+		t.Errorf("expected status 204 on delete, got %d", rec.Code)
+	}
+	if rec := subscriptionRequest(t, mux, http.MethodGet, "/subscriptions/"+sub.ID+"/records", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("expected status 404 after delete, got %d", rec.Code)
+	}
+}
+
+func TestPullSubscriptionReportsEvictions(t *testing.T) {
+	mux, _, _ := newSubscriptionServer(5)
+	sub := createSubscription(t, mux, `{"from":"earliest"}`)
+	for i := 0; i < 7; i++ {
+		postWebhook(t, mux, `{"event":"order"}`)
+	}
+	if got := pullSubscription(t, mux, sub.ID); got.Subscription.Evicted != 2 || got.Records[0].Sequence != 3 {
+		t.Errorf("expected 2 evicted records, got %+v", got.Subscription)
+	}
+}
+
+func TestPushSubscriptionRedelivers(t *testing.T) {
+	var mu sync.Mutex
+	var delivered []string
+	failures := 2
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		defer mu.Unlock()
+		if failures > 0 {
+			failures--
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		delivered = append(delivered, r.Header.Get("X-Echo-Sequence")+":"+string(bytes.TrimSpace(body)))
+	}))
+	defer target.Close()
+
+	mux, _, subs := newSubscriptionServer(10)
+	sub := createSubscription(t, mux, `{"url":"`+target.URL+`"}`)
+	postWebhook(t, mux, `{"event":"a"}`)
+	postWebhook(t, mux, `{"event":"b"}`)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if s, _ := subs.Get(sub.ID); s.Acked == 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			s, _ := subs.Get(sub.ID)
+			t.Fatalf("push did not catch up: %+v", s)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	want := []string{`1:{"event":"a","data":null,"version":""}`, `2:{"event":"b","data":null,"version":""}`}
+	if strings.Join(delivered, " ") != strings.Join(want, " ") {
+		t.Errorf("expected in-order redelivery, got %v", delivered)
+	}
+	if rec := subscriptionRequest(t, mux, http.MethodGet, "/subscriptions/"+sub.ID+"/records", ""); rec.Code != http.StatusBadRequest {
+		t.Errorf("expected pulling a push subscription to fail, got %d", rec.Code)
+	}
+	subs.Delete(sub.ID)
+}
+
+func jsonNumber(n uint64) string {
+	b, _ := json.Marshal(n)
+	return string(b)
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// logLine renders a captured webhook as a single logfmt line for log
+// aggregation sinks.
+func logLine(item WebhookParams, bodyLen int) string {
+	var b strings.Builder
+	b.WriteString("msg=webhook_captured")
+	field := func(key, value string) {
+		if value == "" {
+			return
+		}
+		b.WriteByte(' ')
+		b.WriteString(key)
+		b.WriteByte('=')
+		if strings.ContainsAny(value, " \"=\\") || !strconv.CanBackquote(value) {
+			b.WriteString(strconv.Quote(value))
+		} else {
+			b.WriteString(value)
+		}
+	}
+	field("event", item.EventType)
+	field("version", item.Version)
+	field("received_at", item.ReceivedAt.UTC().Format(time.RFC3339Nano))
+	field("idempotency_key", item.IdempotencyKey)
+	field("bytes", strconv.Itoa(bodyLen))
+	return b.String()
+}
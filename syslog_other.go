@@ -0,0 +1,14 @@
+//go:build windows || plan9
+
+package main
+
+import "errors"
+
+// SyslogSink is unavailable on this platform.
+type SyslogSink struct{}
+
+func NewSyslogSink(addr, tag string) (*SyslogSink, error) {
+	return nil, errors.New("syslog is not supported on this platform")
+}
+
+func (s *SyslogSink) OnIngest(item WebhookParams, body []byte) {}
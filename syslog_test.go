@@ -0,0 +1,20 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLogLine(t *testing.T) {
+	item := WebhookParams{
+		EventType:      "order created",
+		Version:        "2",
+		ReceivedAt:     time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		IdempotencyKey: "k1",
+	}
+
+	want := `msg=webhook_captured event="order created" version=2 received_at=2024-01-02T03:04:05Z idempotency_key=k1 bytes=42`
+	if got := logLine(item, 42); got != want {
+		t.Errorf("unexpected line:\n got %s\nwant %s", got, want)
+	}
+}
@@ -0,0 +1,41 @@
+//go:build !windows && !plan9
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"log/syslog"
+	"strings"
+)
+
+// SyslogSink emits one structured line per captured webhook to syslog. With
+// an empty address it talks to the local daemon, which journald also serves.
+type SyslogSink struct {
+	w *syslog.Writer
+}
+
+// NewSyslogSink connects to addr, given as "udp://host:port",
+// "tcp://host:port" or "" for the local syslog socket.
+func NewSyslogSink(addr, tag string) (*SyslogSink, error) {
+	network, raddr := "", ""
+	if addr != "" {
+		var ok bool
+		network, raddr, ok = strings.Cut(addr, "://")
+		if !ok || (network != "udp" && network != "tcp") {
+			return nil, fmt.Errorf("syslog address must be udp://host:port or tcp://host:port, got %q", addr)
+		}
+	}
+
+	w, err := syslog.Dial(network, raddr, syslog.LOG_INFO|syslog.LOG_DAEMON, tag)
+	if err != nil {
+		return nil, err
+	}
+	return &SyslogSink{w: w}, nil
+}
+
+func (s *SyslogSink) OnIngest(item WebhookParams, body []byte) {
+	if err := s.w.Info(logLine(item, len(body))); err != nil {
+		log.Printf("Syslog sink: %v", err)
+	}
+}
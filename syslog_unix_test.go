@@ -0,0 +1,41 @@
+//go:build !windows && !plan9
+
+package main
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSyslogSinkSendsLine(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("cannot listen on udp: %v", err)
+	}
+	defer conn.Close()
+
+	sink, err := NewSyslogSink("udp://"+conn.LocalAddr().String(), "webhook-echo")
+	if err != nil {
+		t.Fatalf("NewSyslogSink: %v", err)
+	}
+	sink.OnIngest(WebhookParams{EventType: "ping", ReceivedAt: time.Now()}, []byte("{}"))
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	buf := make([]byte, 1024)
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("no syslog message received: %v", err)
+	}
+	msg := string(buf[:n])
+	if !strings.Contains(msg, "webhook-echo") || !strings.Contains(msg, "event=ping") {
+		t.Errorf("unexpected syslog message: %s", msg)
+	}
+}
+
+func TestSyslogSinkRejectsBadAddress(t *testing.T) {
+	if _, err := NewSyslogSink("localhost:514", "x"); err == nil {
+		t.Error("expected address without scheme to be rejected")
+	}
+}
@@ -0,0 +1,386 @@
+package main
+
+import (
+	"bufio"
+	"cmp"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+const defaultTailFormat = `{{.ReceivedAt.Format "15:04:05"}} {{.EventType}} {{json .Payload}}`
+
+// tailColors are the ANSI colors event types are shown in, picked by a hash
+// of the type so that each keeps its color.
+var tailColors = []string{"31", "32", "33", "34", "35", "36"}
+
+// tailCommand prints the webhooks a running server records from now on,
+// read from its /stream endpoint. -filter keeps those matching an
+// expression such as data.status=="failed" && data.amount>100, and -format
+// is a text/template over the record. With -output json or yaml the whole
+// record is printed instead, and with table a summary of it.
+func tailCommand(fs *flag.FlagSet) func(args []string, stdin io.Reader, stdout io.Writer) error {
+	var opts tailOptions
+	fs.StringVar(&opts.server, "url", "http://localhost:8080", "Base URL of the webhook-echo server")
+	fs.StringVar(&opts.filter, "filter", "", `Only print webhooks matching this expression, e.g. data.status=="failed"`)
+	fs.StringVar(&opts.format, "format", defaultTailFormat, "Template each webhook is printed with, e.g. '{{.EventType}} {{.Payload.amount}}'")
+	fs.StringVar(&opts.color, "color", "auto", "Color event types: auto, always or never")
+	fs.IntVar(&opts.count, "n", 0, "Exit after printing this many webhooks, 0 to run until interrupted")
+	return func(args []string, stdin io.Reader, stdout io.Writer) error {
+		if len(args) > 1 {
+			return errors.New("at most one event type may be given")
+		}
+		if len(args) == 1 {
+			opts.eventType = args[0]
+		}
+		return tail(opts, stdout)
+	}
+}
+
+type tailOptions struct {
+	server, filter, format, color, eventType string
+	count                                    int
+}
+
+// tailRow is the table form of a tailed webhook.
+type tailRow struct {
+	Sequence   uint64    `json:"sequence"`
+	ReceivedAt time.Time `json:"received_at"`
+	Event      string    `json:"event"`
+	StatusCode int       `json:"status_code"`
+	ID         string    `json:"id"`
+}
+
+func tail(opts tailOptions, stdout io.Writer) error {
+	filter, err := parseTailFilter(opts.filter)
+	if err != nil {
+		return fmt.Errorf("-filter: %w", err)
+	}
+	tmpl, err := template.New("format").Option("missingkey=zero").Funcs(template.FuncMap{
+		"json": func(v any) string {
+			b, _ := json.Marshal(v)
+			return string(b)
+		},
+	}).Parse(opts.format)
+	if err != nil {
+		return fmt.Errorf("-format: %w", err)
+	}
+	var colored bool
+	switch opts.color {
+	case "always":
+		colored = true
+	case "never":
+	case "auto":
+		colored = isTerminal(stdout) && os.Getenv("NO_COLOR") == ""
+	default:
+		return fmt.Errorf("-color must be auto, always or never, got %q", opts.color)
+	}
+
+	client, err := newServerClient(opts.server, "")
+	if err != nil {
+		return err
+	}
+	streamPath := "/stream"
+	if opts.eventType != "" {
+		streamPath += "/" + url.PathEscape(opts.eventType)
+	}
+	resp, err := client.do(http.MethodGet, streamPath, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	out := &outputPrinter{w: stdout}
+	printed := 0
+	return readServerSentEvents(resp.Body, func(event string, data []byte) error {
+		if event != "webhook" {
+			return nil
+		}
+		var doc any
+		var item WebhookParams
+		if err := json.Unmarshal(data, &doc); err != nil {
+			return err
+		}
+		if err := json.Unmarshal(data, &item); err != nil {
+			return err
+		}
+		if !filter.match(doc) {
+			return nil
+		}
+		var result any = json.RawMessage(data)
+		if outputFormat == outputTable {
+			result = tailRow{item.Sequence, item.ReceivedAt, item.EventType, item.StatusCode, item.ID}
+		}
+		err := out.Print(result, func() error {
+			var line strings.Builder
+			if err := tmpl.Execute(&line, item); err != nil {
+				return fmt.Errorf("-format: %w", err)
+			}
+			text := line.String()
+			if colored {
+				text = colorize(item.EventType, text)
+			}
+			_, err := fmt.Fprintln(stdout, text)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		if printed++; opts.count > 0 && printed >= opts.count {
+			return io.EOF
+		}
+		return nil
+	})
+}
+
+// readServerSentEvents calls handle with the type and data of each event
+// read from r until handle fails; io.EOF from handle stops without error.
+func readServerSentEvents(r io.Reader, handle func(event string, data []byte) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64<<10), 64<<20)
+	event, data := "message", []byte(nil)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			if data != nil {
+				if err := handle(event, data); err != nil {
+					if err == io.EOF {
+						return nil
+					}
+					return err
+				}
+			}
+			event, data = "message", nil
+		case strings.HasPrefix(line, ":"):
+		default:
+			field, value, _ := strings.Cut(line, ":")
+			value = strings.TrimPrefix(value, " ")
+			switch field {
+			case "event":
+				event = value
+			case "data":
+				if data != nil {
+					data = append(data, '\n')
+				}
+				data = append(data, value...)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return errors.New("stream closed by server")
+}
+
+// colorize shows text in the color of eventType, only the event type itself
+// when text contains it.
+func colorize(eventType, text string) string {
+	h := fnv.New32a()
+	h.Write([]byte(eventType))
+	code := tailColors[h.Sum32()%uint32(len(tailColors))]
+	if eventType != "" && strings.Contains(text, eventType) {
+		return strings.Replace(text, eventType, "\x1b["+code+"m"+eventType+"\x1b[0m", 1)
+	}
+	return "\x1b[" + code + "m" + text + "\x1b[0m"
+}
+
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// tailFilter is a parsed -filter expression: comparisons of record fields,
+// given as dotted paths into the record's JSON such as data.status, joined
+// by && and ||, with && binding tighter. A path alone is true when it is
+// present and neither false, null, 0 nor "".
+type tailFilter [][]tailCondition
+
+type tailCondition struct {
+	path  []string
+	op    string
+	value any
+}
+
+var tailOperators = []string{"==", "!=", ">=", "<=", ">", "<"}
+
+func parseTailFilter(expr string) (tailFilter, error) {
+	tokens, err := tailTokens(expr)
+	if err != nil || len(tokens) == 0 {
+		return nil, err
+	}
+	var filter tailFilter
+	var clause []tailCondition
+	for i := 0; i < len(tokens); {
+		path := tokens[i]
+		if !isTailPath(path) {
+			return nil, fmt.Errorf("expected a field path, got %s", path)
+		}
+		cond := tailCondition{path: strings.Split(strings.TrimPrefix(path, "."), ".")}
+		i++
+		if i+1 < len(tokens) && isTailOperator(tokens[i]) {
+			if err := json.Unmarshal([]byte(tokens[i+1]), &cond.value); err != nil {
+				return nil, fmt.Errorf("expected a JSON value after %s, got %s", tokens[i], tokens[i+1])
+			}
+			cond.op = tokens[i]
+			i += 2
+		}
+		clause = append(clause, cond)
+		if i == len(tokens) {
+			break
+		}
+		switch tokens[i] {
+		case "&&":
+		case "||":
+			filter, clause = append(filter, clause), nil
+		default:
+			return nil, fmt.Errorf("expected && or ||, got %s", tokens[i])
+		}
+		if i++; i == len(tokens) {
+			return nil, errors.New("expression ends with an operator")
+		}
+	}
+	return append(filter, clause), nil
+}
+
+// tailTokens splits expr into paths, JSON literals and operators.
+func tailTokens(expr string) ([]string, error) {
+	var tokens []string
+	for s := strings.TrimSpace(expr); s != ""; s = strings.TrimSpace(s) {
+		switch {
+		case s[0] == '"':
+			end := 1
+			for end < len(s) && s[end] != '"' {
+				if s[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(s) {
+				return nil, errors.New("unterminated string")
+			}
+			tokens, s = append(tokens, s[:end+1]), s[end+1:]
+		case strings.HasPrefix(s, "&&") || strings.HasPrefix(s, "||"):
+			tokens, s = append(tokens, s[:2]), s[2:]
+		case strings.ContainsRune("=!<>", rune(s[0])):
+			n := 1
+			if len(s) > 1 && s[1] == '=' {
+				n = 2
+			}
+			if !isTailOperator(s[:n]) {
+				return nil, fmt.Errorf("unknown operator %s", s[:n])
+			}
+			tokens, s = append(tokens, s[:n]), s[n:]
+		default:
+			end := strings.IndexAny(s, " \t\"&|=!<>")
+			if end < 0 {
+				end = len(s)
+			}
+			tokens, s = append(tokens, s[:end]), s[end:]
+		}
+	}
+	return tokens, nil
+}
+
+func isTailOperator(s string) bool {
+	for _, op := range tailOperators {
+		if s == op {
+			return true
+		}
+	}
+	return false
+}
+
+func isTailPath(s string) bool {
+	if s == "" || s == "true" || s == "false" || s == "null" || s[0] == '"' {
+		return false
+	}
+	_, err := strconv.ParseFloat(s, 64)
+	return err != nil
+}
+
+func (f tailFilter) match(doc any) bool {
+	if len(f) == 0 {
+		return true
+	}
+	for _, clause := range f {
+		ok := true
+		for _, cond := range clause {
+			ok = ok && cond.match(doc)
+		}
+		if ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (c tailCondition) match(doc any) bool {
+	v, found := doc, true
+	for _, key := range c.path {
+		m, ok := v.(map[string]any)
+		if !ok {
+			v, found = nil, false
+			break
+		}
+		v, found = m[key]
+	}
+	if c.op == "" {
+		return found && v != nil && v != false && v != 0.0 && v != ""
+	}
+	order, comparable := compareTailValues(v, c.value)
+	switch c.op {
+	case "==":
+		return comparable && order == 0
+	case "!=":
+		return !comparable || order != 0
+	case ">":
+		return comparable && order > 0
+	case ">=":
+		return comparable && order >= 0
+	case "<":
+		return comparable && order < 0
+	default:
+		return comparable && order <= 0
+	}
+}
+
+// compareTailValues orders two JSON values of the same type, reporting
+// false for values of different types. Booleans are only equal or not, and
+// null equals null and a missing field.
+func compareTailValues(a, b any) (int, bool) {
+	switch b := b.(type) {
+	case float64:
+		if a, ok := a.(float64); ok {
+			return cmp.Compare(a, b), true
+		}
+	case string:
+		if a, ok := a.(string); ok {
+			return strings.Compare(a, b), true
+		}
+	case bool:
+		if a, ok := a.(bool); ok {
+			if a == b {
+				return 0, true
+			}
+			return 1, true
+		}
+	case nil:
+		return 0, a == nil
+	}
+	return 0, false
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTailFilter(t *testing.T) {
+	doc := map[string]any{
+		"event": "payment",
+		"data":  map[string]any{"status": "failed", "amount": 250.0, "live": true},
+	}
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		{``, true},
+		{`data.status=="failed"`, true},
+		{`.data.status != "failed"`, false},
+		{`data.amount > 100 && data.live`, true},
+		{`data.amount >= 300 || event == "payment"`, true},
+		{`data.amount < 100 || data.missing`, false},
+		{`data.missing == null`, true},
+		{`data.live == false`, false},
+		{`data.status > 5`, false},
+	}
+	for _, tt := range tests {
+		filter, err := parseTailFilter(tt.expr)
+		if err != nil {
+			t.Errorf("parseTailFilter(%q): %v", tt.expr, err)
+			continue
+		}
+		if got := filter.match(doc); got != tt.want {
+			t.Errorf("%q matched %v, want %v", tt.expr, got, tt.want)
+		}
+	}
+	for _, expr := range []string{`data.status ==`, `data.x == "open`, `"a" == data.x`, `data.x = 1`, `a b`, `a &&`} {
+		if _, err := parseTailFilter(expr); err == nil {
+			t.Errorf("expected %q to be rejected", expr)
+		}
+	}
+}
+
+func TestTailCommand(t *testing.T) {
+	mux := newTestServer()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	done := make(chan struct{})
+	go func() {
+		for i := 0; ; i++ {
+			select {
+			case <-done:
+				return
+			case <-time.After(10 * time.Millisecond):
+				status := []string{"ok", "failed"}[i%2]
+				postWebhook(t, mux, fmt.Sprintf(`{"event":"payment","data":{"status":%q,"amount":%d}}`, status, i))
+			}
+		}
+	}()
+
+	var out strings.Builder
+	err := runSubcommand("tail", []string{
+		"-url", server.URL, "-n", "2", "-color", "never",
+		"-filter", `data.status=="failed"`,
+		"-format", "{{.EventType}} {{.Payload.status}} {{.Payload.amount}}",
+		"payment",
+	}, nil, &out)
+	close(done)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 || !strings.HasPrefix(lines[0], "payment failed ") || !strings.HasPrefix(lines[1], "payment failed ") {
+		t.Errorf("expected two failed payments, got %q", out.String())
+	}
+}
+
+func TestTailCommandWithoutEventType(t *testing.T) {
+	mux := newTestServer()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	done := make(chan struct{})
+	go func() {
+		for i := 0; ; i++ {
+			select {
+			case <-done:
+				return
+			case <-time.After(10 * time.Millisecond):
+				event := []string{"payment", "refund"}[i%2]
+				postWebhook(t, mux, fmt.Sprintf(`{"event":%q,"data":{"amount":%d}}`, event, i))
+			}
+		}
+	}()
+
+	var out strings.Builder
+	err := runSubcommand("tail", []string{
+		"-url", server.URL, "-n", "2", "-color", "never",
+		"-filter", `event=="refund"`,
+		"-format", "{{.EventType}}",
+	}, nil, &out)
+	close(done)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.TrimSpace(out.String()); got != "refund\nrefund" {
+		t.Errorf("expected two refunds, got %q", got)
+	}
+}
+
+func TestColorize(t *testing.T) {
+	if got := colorize("order", "12:00 order {}"); !strings.Contains(got, "\x1b[") || !strings.HasPrefix(got, "12:00 ") {
+		t.Errorf("expected only the event type colored, got %q", got)
+	}
+	if colorize("order", "x") == colorize("refund", "x") && colorize("order", "x") == colorize("invoice", "x") {
+		t.Error("expected event types to get different colors")
+	}
+}
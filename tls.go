@@ -0,0 +1,73 @@
+package main
+
+import (
+	"crypto/tls"
+	"net/http"
+)
+
+// TLSInfo is the TLS connection a webhook was delivered over, when the
+// server terminates TLS itself with -tls-cert and -tls-key. Behind a
+// terminating proxy it describes the proxy's connection, if any.
+type TLSInfo struct {
+	Version     string `json:"version"`
+	CipherSuite string `json:"cipher_suite"`
+	// ServerName is the SNI the client sent, empty when it sent none.
+	ServerName string `json:"server_name,omitempty"`
+	// ALPN is the negotiated application protocol, e.g. "h2".
+	ALPN    string `json:"alpn,omitempty"`
+	Resumed bool   `json:"resumed,omitempty"`
+	// ClientCertificate is the subject of the client's certificate, if it
+	// presented one.
+	ClientCertificate string `json:"client_certificate,omitempty"`
+	// Fingerprint is taken from the client's hello when the server
+	// terminates TLS itself.
+	Fingerprint *TLSFingerprint `json:"fingerprint,omitempty"`
+}
+
+// tlsInfo describes the TLS connection r came over, nil for plain HTTP.
+func tlsInfo(r *http.Request) *TLSInfo {
+	state := r.TLS
+	if state == nil {
+		return nil
+	}
+	info := &TLSInfo{
+		Version:     tls.VersionName(state.Version),
+		CipherSuite: tls.CipherSuiteName(state.CipherSuite),
+		ServerName:  state.ServerName,
+		ALPN:        state.NegotiatedProtocol,
+		Resumed:     state.DidResume,
+		Fingerprint: requestFingerprint(r),
+	}
+	if len(state.PeerCertificates) > 0 {
+		info.ClientCertificate = state.PeerCertificates[0].Subject.String()
+	}
+	return info
+}
+
+// tlsConfig returns the server TLS configuration for -tls-cert and -tls-key.
+// Client certificates are requested but not verified, so that they can be
+// recorded without turning away senders that have none. Server names in
+// -tls-invalid-sni get an invalid certificate instead.
+func tlsConfig(certs *certificateReloader) *tls.Config {
+	return &tls.Config{
+		GetCertificate: func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+			if wantsInvalidCert(hello) {
+				return invalidCert()
+			}
+			return certs.GetCertificate(hello)
+		},
+		ClientAuth: tls.RequestClientCert,
+		NextProtos: []string{"h2", "http/1.1"},
+	}
+}
+
+// listenAndServe serves handler on addr, over TLS when config is set,
+// fingerprinting clients.
+func listenAndServe(addr string, handler http.Handler, config *tls.Config) error {
+	if config == nil {
+		return http.ListenAndServe(addr, handler)
+	}
+	server := &http.Server{Addr: addr, Handler: handler, TLSConfig: config}
+	fingerprintTLS(server, config)
+	return server.ListenAndServeTLS("", "")
+}
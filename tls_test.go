@@ -0,0 +1,46 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRecordsTLSHandshake(t *testing.T) {
+	buffer := NewRingBuffer(10)
+	mux := http.NewServeMux()
+	registerRoutes(mux, buffer, "secret")
+	server := httptest.NewUnstartedServer(mux)
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	defer server.Close()
+
+	client := server.Client()
+	client.Transport.(*http.Transport).TLSClientConfig.ServerName = "example.com"
+	resp, err := client.Post(server.URL+"/webhook", "application/json", strings.NewReader(`{"event":"secure"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	items := queryWebhooks(t, mux, "/query/secure")
+	if len(items) != 1 || items[0].TLS == nil {
+		t.Fatalf("expected one record with TLS details, got %+v", items)
+	}
+	info := items[0].TLS
+	if info.Version != "TLS 1.3" || info.CipherSuite == "" || info.ServerName != "example.com" || info.ALPN != "h2" {
+		t.Errorf("unexpected TLS details: %+v", info)
+	}
+	if items[0].Client.Proto != "https" {
+		t.Errorf("expected https, got %+v", items[0].Client)
+	}
+}
+
+func TestPlainRequestHasNoTLS(t *testing.T) {
+	mux := newTestServer()
+	postWebhook(t, mux, `{"event":"plain"}`)
+	if items := queryWebhooks(t, mux, "/query/plain"); len(items) != 1 || items[0].TLS != nil {
+		t.Errorf("expected no TLS details, got %+v", items)
+	}
+}
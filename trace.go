@@ -0,0 +1,107 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// traceURLTemplate links records to a tracing UI, e.g.
+// "https://jaeger.example.com/trace/{trace_id}". {trace_id} and {span_id}
+// are expanded.
+var traceURLTemplate string
+
+// TraceContext is the distributed trace a webhook was sent from.
+type TraceContext struct {
+	TraceID string `json:"trace_id"`
+	SpanID  string `json:"span_id,omitempty"`
+	Sampled *bool  `json:"sampled,omitempty"`
+	// Format is the propagation format it was read from, "w3c" or "b3".
+	Format string `json:"format"`
+	URL    string `json:"url,omitempty"`
+}
+
+// traceContext extracts the trace context from W3C traceparent, b3 or
+// X-B3-* headers, in that order of preference. Malformed headers are
+// ignored.
+func traceContext(h http.Header) *TraceContext {
+	var tc *TraceContext
+	if v := h.Get("Traceparent"); v != "" {
+		tc = parseTraceparent(v)
+	}
+	if tc == nil {
+		if v := h.Get("B3"); v != "" {
+			tc = parseB3(v)
+		}
+	}
+	if tc == nil && h.Get("X-B3-TraceId") != "" {
+		tc = &TraceContext{TraceID: strings.ToLower(h.Get("X-B3-TraceId")), SpanID: strings.ToLower(h.Get("X-B3-SpanId")), Format: "b3"}
+		switch h.Get("X-B3-Sampled") {
+		case "1", "true":
+			tc.Sampled = boolPtr(true)
+		case "0", "false":
+			tc.Sampled = boolPtr(false)
+		}
+		if !isTraceID(tc.TraceID) || tc.SpanID != "" && !isHexID(tc.SpanID, 16) {
+			tc = nil
+		}
+	}
+	if tc != nil && traceURLTemplate != "" {
+		tc.URL = strings.NewReplacer("{trace_id}", tc.TraceID, "{span_id}", tc.SpanID).Replace(traceURLTemplate)
+	}
+	return tc
+}
+
+// parseTraceparent parses version-traceid-parentid-flags. Later versions
+// may append fields, which are ignored.
+func parseTraceparent(v string) *TraceContext {
+	parts := strings.Split(strings.TrimSpace(v), "-")
+	if len(parts) < 4 || !isHexID(parts[0], 2) || parts[0] == "ff" || parts[0] == "00" && len(parts) != 4 {
+		return nil
+	}
+	traceID, spanID, flags := parts[1], parts[2], parts[3]
+	if !isHexID(traceID, 32) || !isHexID(spanID, 16) || !isHexID(flags, 2) ||
+		strings.Trim(traceID, "0") == "" || strings.Trim(spanID, "0") == "" {
+		return nil
+	}
+	f, _ := strconv.ParseUint(flags, 16, 8)
+	return &TraceContext{TraceID: traceID, SpanID: spanID, Sampled: boolPtr(f&1 == 1), Format: "w3c"}
+}
+
+// parseB3 parses the single b3 header: traceid-spanid[-sampled[-parent]],
+// or just the sampling decision, which carries no trace.
+func parseB3(v string) *TraceContext {
+	parts := strings.Split(strings.ToLower(strings.TrimSpace(v)), "-")
+	if len(parts) < 2 || !isTraceID(parts[0]) || !isHexID(parts[1], 16) {
+		return nil
+	}
+	tc := &TraceContext{TraceID: parts[0], SpanID: parts[1], Format: "b3"}
+	if len(parts) > 2 {
+		switch parts[2] {
+		case "1", "d":
+			tc.Sampled = boolPtr(true)
+		case "0":
+			tc.Sampled = boolPtr(false)
+		}
+	}
+	return tc
+}
+
+// isTraceID accepts the 64- and 128-bit trace IDs B3 allows.
+func isTraceID(s string) bool {
+	return isHexID(s, 16) || isHexID(s, 32)
+}
+
+func isHexID(s string, n int) bool {
+	if len(s) != n {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if !('0' <= s[i] && s[i] <= '9' || 'a' <= s[i] && s[i] <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+func boolPtr(b bool) *bool { return &b }
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTraceContext(t *testing.T) {
+	tests := []struct {
+		header  http.Header
+		traceID string
+		spanID  string
+		sampled *bool
+	}{
+		{http.Header{"Traceparent": {"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"}},
+			"4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7", boolPtr(true)},
+		{http.Header{"Traceparent": {"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00"}},
+			"4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7", boolPtr(false)},
+		{http.Header{"B3": {"80f198ee56343ba864fe8b2a57d3eff7-e457b5a2e4d86bd1-1"}},
+			"80f198ee56343ba864fe8b2a57d3eff7", "e457b5a2e4d86bd1", boolPtr(true)},
+		{http.Header{"X-B3-Traceid": {"463AC35C9F6413AD"}, "X-B3-Spanid": {"a2fb4a1d1a96d312"}},
+			"463ac35c9f6413ad", "a2fb4a1d1a96d312", nil},
+		// An invalid traceparent falls back to the B3 headers.
+		{http.Header{"Traceparent": {"00-00000000000000000000000000000000-00f067aa0ba902b7-01"}, "B3": {"463ac35c9f6413ad-a2fb4a1d1a96d312"}},
+			"463ac35c9f6413ad", "a2fb4a1d1a96d312", nil},
+	}
+	for _, tt := range tests {
+		tc := traceContext(tt.header)
+		if tc == nil || tc.TraceID != tt.traceID || tc.SpanID != tt.spanID ||
+			(tc.Sampled == nil) != (tt.sampled == nil) || tc.Sampled != nil && *tc.Sampled != *tt.sampled {
+			t.Errorf("%v: got %+v", tt.header, tc)
+		}
+	}
+
+	for _, bad := range []http.Header{
+		{},
+		{"Traceparent": {"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"}},
+		{"Traceparent": {"00-4bf92f3577b34da6-00f067aa0ba902b7-01"}},
+		{"B3": {"1"}},
+		{"X-B3-Traceid": {"not-hex"}},
+	} {
+		if tc := traceContext(bad); tc != nil {
+			t.Errorf("%v: expected no trace context, got %+v", bad, tc)
+		}
+	}
+}
+
+func TestTraceLinkOnRecords(t *testing.T) {
+	traceURLTemplate = "https://tracing.example.com/trace/{trace_id}?span={span_id}"
+	t.Cleanup(func() { traceURLTemplate = "" })
+
+	mux := newTestServer()
+	req := httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString(`{"event":"order","trace":{"trace_id":"forged"}}`))
+	req.Header.Set("Traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	mux.ServeHTTP(httptest.NewRecorder(), req)
+	postWebhook(t, mux, `{"event":"order","trace":{"trace_id":"forged"}}`)
+
+	got := queryWebhooks(t, mux, "/query/order")
+	if len(got) != 2 || got[0].Trace != nil {
+		t.Fatalf("expected the trace to come from headers only, got %+v", got)
+	}
+	want := "https://tracing.example.com/trace/4bf92f3577b34da6a3ce929d0e0e4736?span=00f067aa0ba902b7"
+	if got[1].Trace == nil || got[1].Trace.URL != want {
+		t.Errorf("expected link %s, got %+v", want, got[1].Trace)
+	}
+}
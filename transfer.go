@@ -0,0 +1,86 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"time"
+)
+
+// maxTransferReads bounds the reads listed in a Transfer; Reads keeps
+// counting past it.
+const maxTransferReads = 256
+
+// Transfer describes how a streamed request body arrived: one sent without
+// a Content-Length, chunked on HTTP/1.1 or as unsized DATA frames on HTTP/2,
+// or one followed by trailers. Go's chunked decoder may return several small
+// chunks in one read, so Segments are the body as the server saw it arrive
+// rather than the exact chunk boundaries; long gaps between them are what
+// usually matter.
+type Transfer struct {
+	Proto            string      `json:"proto"`
+	TransferEncoding []string    `json:"transfer_encoding,omitempty"`
+	Trailers         http.Header `json:"trailers,omitempty"`
+	Bytes            int64       `json:"bytes"`
+	Reads            int         `json:"reads"`
+	// FirstByteMs is how long after the headers the first body byte came,
+	// DurationMs how long after the headers the body ended, and MaxGapMs
+	// the longest wait for more of it.
+	FirstByteMs float64           `json:"first_byte_ms"`
+	DurationMs  float64           `json:"duration_ms"`
+	MaxGapMs    float64           `json:"max_gap_ms"`
+	Segments    []TransferSegment `json:"segments,omitempty"`
+}
+
+// TransferSegment is one read of the body, AtMs after the headers.
+type TransferSegment struct {
+	AtMs  float64 `json:"at_ms"`
+	Bytes int     `json:"bytes"`
+}
+
+// transferReader times the reads of a request body.
+type transferReader struct {
+	io.ReadCloser
+	start    time.Time
+	last     time.Time
+	transfer Transfer
+}
+
+func newTransferReader(body io.ReadCloser, start time.Time) *transferReader {
+	return &transferReader{ReadCloser: body, start: start, last: start}
+}
+
+func (t *transferReader) Read(p []byte) (int, error) {
+	n, err := t.ReadCloser.Read(p)
+	if n > 0 {
+		now := time.Now()
+		if t.transfer.Reads == 0 {
+			t.transfer.FirstByteMs = millis(now.Sub(t.start))
+		} else if gap := millis(now.Sub(t.last)); gap > t.transfer.MaxGapMs {
+			t.transfer.MaxGapMs = gap
+		}
+		t.last = now
+		t.transfer.Reads++
+		t.transfer.Bytes += int64(n)
+		if len(t.transfer.Segments) < maxTransferReads {
+			t.transfer.Segments = append(t.transfer.Segments, TransferSegment{AtMs: millis(now.Sub(t.start)), Bytes: n})
+		}
+	}
+	return n, err
+}
+
+// result returns the transfer details of r's fully read body, or nil when
+// the body was neither streamed nor followed by trailers.
+func (t *transferReader) result(r *http.Request) *Transfer {
+	if r.ContentLength >= 0 && len(r.Trailer) == 0 {
+		return nil
+	}
+	transfer := t.transfer
+	transfer.Proto = r.Proto
+	transfer.TransferEncoding = r.TransferEncoding
+	transfer.DurationMs = millis(t.last.Sub(t.start))
+	// Declared trailers that never arrived are listed with no value.
+	if len(r.Trailer) > 0 {
+		transfer.Trailers = r.Trailer.Clone()
+	}
+	return &transfer
+}
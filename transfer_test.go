@@ -0,0 +1,61 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRecordsChunkedTransfer(t *testing.T) {
+	buffer := NewRingBuffer(10)
+	mux := http.NewServeMux()
+	registerRoutes(mux, buffer, "secret")
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	body, send := io.Pipe()
+	req, _ := http.NewRequest(http.MethodPost, server.URL+"/webhook", body)
+	req.Header.Set("Content-Type", "application/json")
+	req.Trailer = http.Header{"Checksum": nil, "X-Signature": nil}
+	go func() {
+		io.WriteString(send, `{"event":"slow",`)
+		time.Sleep(50 * time.Millisecond)
+		req.Trailer.Set("Checksum", "abc")
+		io.WriteString(send, `"data":{}}`)
+		send.Close()
+	}()
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	items := queryWebhooks(t, mux, "/query/slow")
+	if len(items) != 1 || items[0].Transfer == nil {
+		t.Fatalf("expected one record with transfer details, got %+v", items)
+	}
+	transfer := items[0].Transfer
+	if strings.Join(transfer.TransferEncoding, ",") != "chunked" || transfer.Proto != "HTTP/1.1" {
+		t.Errorf("unexpected encoding: %+v", transfer)
+	}
+	if transfer.Trailers.Get("Checksum") != "abc" {
+		t.Errorf("expected the trailer, got %v", transfer.Trailers)
+	}
+	if _, ok := transfer.Trailers["X-Signature"]; !ok {
+		t.Errorf("expected the declared but unsent trailer to be listed, got %v", transfer.Trailers)
+	}
+	if transfer.Bytes != 26 || transfer.Reads < 2 || transfer.MaxGapMs < 40 || len(transfer.Segments) != transfer.Reads {
+		t.Errorf("unexpected timing: %+v", transfer)
+	}
+}
+
+func TestSizedBodyHasNoTransfer(t *testing.T) {
+	mux := newTestServer()
+	postWebhook(t, mux, `{"event":"sized"}`)
+	if items := queryWebhooks(t, mux, "/query/sized"); len(items) != 1 || items[0].Transfer != nil {
+		t.Errorf("expected no transfer details for a body with a Content-Length, got %+v", items)
+	}
+}
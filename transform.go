@@ -0,0 +1,199 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// CloudEvents conversions of a Transform.
+const (
+	cloudEventsTo   = "to"
+	cloudEventsFrom = "from"
+)
+
+// Transform reshapes what a push subscription delivers, so that a target
+// expecting another shape can be fed during a migration. The steps apply
+// in this order: CloudEvents "from" takes the type and data of a captured
+// CloudEvent, in structured or binary mode, as the event and payload;
+// Rename moves payload fields, by dotted path; the body is built as a
+// structured CloudEvent with CloudEvents "to", or as {"event", "data",
+// "version"} otherwise; Unwrap replaces the body with the value at a dotted
+// path of it; and Wrap nests the body under a key. SetHeaders and
+// RemoveHeaders edit the request headers last, X-Echo-* included. Records
+// captured in a binary format are only transformed if CloudEvents, Rename,
+// Unwrap and Wrap are all unset.
+type Transform struct {
+	CloudEvents   string            `json:"cloudevents,omitempty"`
+	Rename        map[string]string `json:"rename,omitempty"`
+	Unwrap        string            `json:"unwrap,omitempty"`
+	Wrap          string            `json:"wrap,omitempty"`
+	SetHeaders    map[string]string `json:"set_headers,omitempty"`
+	RemoveHeaders []string          `json:"remove_headers,omitempty"`
+}
+
+func (t *Transform) validate() error {
+	switch t.CloudEvents {
+	case "", cloudEventsTo, cloudEventsFrom:
+	default:
+		return &paramError{codeInvalidParameter, `transform cloudevents must be "to" or "from"`}
+	}
+	for from, to := range t.Rename {
+		if from == "" || to == "" {
+			return &paramError{codeInvalidParameter, "transform rename paths must not be empty"}
+		}
+	}
+	for name := range t.SetHeaders {
+		if name == "" || strings.ContainsAny(name, " :\r\n") {
+			return &paramError{codeInvalidParameter, fmt.Sprintf("transform header name %q is invalid", name)}
+		}
+	}
+	return nil
+}
+
+// reshapes reports whether t changes the body, not just headers.
+func (t *Transform) reshapes() bool {
+	return t != nil && (t.CloudEvents != "" || len(t.Rename) > 0 || t.Unwrap != "" || t.Wrap != "")
+}
+
+// body builds the body delivering item, as webhookBody does when t leaves
+// the body alone.
+func (t *Transform) body(item WebhookParams) ([]byte, string, error) {
+	if !t.reshapes() {
+		return webhookBody(item)
+	}
+	if lookupFormat(item.ContentType) != nil {
+		return nil, "", errors.New("transform: cannot reshape a record captured as " + item.ContentType)
+	}
+	event, payload := item.EventType, item.Payload
+	if t.CloudEvents == cloudEventsFrom {
+		var err error
+		if event, payload, err = fromCloudEvent(item); err != nil {
+			return nil, "", err
+		}
+	}
+	// Renames must not touch the record, which shares its payload.
+	if payload != nil {
+		payload = cloneJSONObject(payload)
+	}
+	for from, to := range t.Rename {
+		if v, ok := lookupPath(payload, from); ok {
+			deletePath(payload, from)
+			setPath(payload, to, v)
+		}
+	}
+
+	var doc any = map[string]any{"event": event, "data": payload, "version": item.Version}
+	contentType := "application/json"
+	if t.CloudEvents == cloudEventsTo {
+		doc = map[string]any{
+			"specversion":     "1.0",
+			"id":              item.ID,
+			"source":          "webhook-echo",
+			"type":            event,
+			"time":            item.ReceivedAt,
+			"datacontenttype": "application/json",
+			"data":            payload,
+		}
+		contentType = "application/cloudevents+json"
+	}
+	if t.Unwrap != "" {
+		obj, _ := doc.(map[string]any)
+		v, ok := lookupPath(obj, t.Unwrap)
+		if !ok {
+			return nil, "", fmt.Errorf("transform: no %s to unwrap", t.Unwrap)
+		}
+		doc = v
+	}
+	if t.Wrap != "" {
+		doc = map[string]any{t.Wrap: doc}
+	}
+	body, err := json.Marshal(doc)
+	return body, contentType, err
+}
+
+// headers applies the header edits of t to h.
+func (t *Transform) headers(h http.Header) {
+	if t == nil {
+		return
+	}
+	for _, name := range t.RemoveHeaders {
+		h.Del(name)
+	}
+	for name, value := range t.SetHeaders {
+		h.Set(name, value)
+	}
+}
+
+// fromCloudEvent reads the type and data of a CloudEvent captured in
+// structured mode, or in binary mode with the ce-* headers.
+func fromCloudEvent(item WebhookParams) (string, map[string]any, error) {
+	if item.Headers.Get("Ce-Specversion") != "" {
+		var data map[string]any
+		if err := json.Unmarshal(item.Raw, &data); err != nil {
+			return "", nil, fmt.Errorf("transform: CloudEvent data is not a JSON object: %w", err)
+		}
+		return item.Headers.Get("Ce-Type"), data, nil
+	}
+	var ce struct {
+		SpecVersion string         `json:"specversion"`
+		Type        string         `json:"type"`
+		Data        map[string]any `json:"data"`
+	}
+	if err := json.Unmarshal(item.Raw, &ce); err != nil || ce.SpecVersion == "" {
+		return "", nil, errors.New("transform: record is not a CloudEvent")
+	}
+	return ce.Type, ce.Data, nil
+}
+
+// cloneJSONObject deep-copies a decoded JSON object.
+func cloneJSONObject(obj map[string]any) map[string]any {
+	clone := make(map[string]any, len(obj))
+	for k, v := range obj {
+		clone[k] = cloneJSONValue(v)
+	}
+	return clone
+}
+
+func cloneJSONValue(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		return cloneJSONObject(v)
+	case []any:
+		clone := make([]any, len(v))
+		for i, e := range v {
+			clone[i] = cloneJSONValue(e)
+		}
+		return clone
+	}
+	return v
+}
+
+// setPath sets the dotted path in obj to v, making the objects on the way.
+func setPath(obj map[string]any, path string, v any) {
+	parts := strings.Split(path, ".")
+	for _, part := range parts[:len(parts)-1] {
+		next, ok := obj[part].(map[string]any)
+		if !ok {
+			next = make(map[string]any)
+			obj[part] = next
+		}
+		obj = next
+	}
+	obj[parts[len(parts)-1]] = v
+}
+
+// deletePath removes the dotted path from obj.
+func deletePath(obj map[string]any, path string) {
+	parts := strings.Split(path, ".")
+	for _, part := range parts[:len(parts)-1] {
+		next, ok := obj[part].(map[string]any)
+		if !ok {
+			return
+		}
+		obj = next
+	}
+	delete(obj, parts[len(parts)-1])
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+func TestTransformBody(t *testing.T) {
+	item := WebhookParams{
+		ID:        "rec1",
+		EventType: "order",
+		Payload:   map[string]any{"id": 1.0, "customer": map[string]any{"name": "Ada"}},
+		Version:   "2",
+	}
+	tests := []struct {
+		name        string
+		transform   Transform
+		item        WebhookParams
+		want        string
+		contentType string
+	}{
+		{"rename and wrap", Transform{Rename: map[string]string{"customer.name": "buyer", "id": "order_id"}, Wrap: "payload"}, item,
+			`{"payload":{"data":{"buyer":"Ada","customer":{},"order_id":1},"event":"order","version":"2"}}`, "application/json"},
+		{"unwrap", Transform{Unwrap: "data.customer"}, item, `{"name":"Ada"}`, "application/json"},
+		{"to cloudevents", Transform{CloudEvents: cloudEventsTo, Unwrap: "type"}, item, `"order"`, "application/cloudevents+json"},
+		{"from structured cloudevent", Transform{CloudEvents: cloudEventsFrom}, WebhookParams{Raw: []byte(`{"specversion":"1.0","type":"user.created","data":{"id":7}}`)},
+			`{"data":{"id":7},"event":"user.created","version":""}`, "application/json"},
+		{"from binary cloudevent", Transform{CloudEvents: cloudEventsFrom}, WebhookParams{
+			Headers: http.Header{"Ce-Specversion": {"1.0"}, "Ce-Type": {"user.deleted"}},
+			Raw:     []byte(`{"id":8}`),
+		}, `{"data":{"id":8},"event":"user.deleted","version":""}`, "application/json"},
+	}
+	for _, tt := range tests {
+		body, contentType, err := tt.transform.body(tt.item)
+		if err != nil || string(body) != tt.want || contentType != tt.contentType {
+			t.Errorf("%s: got %s %s %v, want %s %s", tt.name, body, contentType, err, tt.want, tt.contentType)
+		}
+	}
+	if _, ok := item.Payload["id"]; !ok {
+		t.Error("expected renames to leave the record alone")
+	}
+	if _, _, err := (&Transform{CloudEvents: cloudEventsFrom}).body(item); err == nil {
+		t.Error("expected a record that is no CloudEvent to fail")
+	}
+	if err := (&Transform{CloudEvents: "sideways"}).validate(); err == nil {
+		t.Error("expected an unknown CloudEvents conversion to be refused")
+	}
+}
+
+func TestPushSubscriptionTransform(t *testing.T) {
+	var mu sync.Mutex
+	var got *http.Request
+	var body []byte
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		got = r
+		body, _ = io.ReadAll(r.Body)
+	}))
+	defer target.Close()
+
+	mux, _, subs := newSubscriptionServer(10)
+	sub := createSubscription(t, mux, `{"url":"`+target.URL+`","transform":{"unwrap":"data","set_headers":{"X-Source":"echo"},"remove_headers":["X-Echo-Subscription"]}}`)
+	defer subs.Delete(sub.ID)
+	postWebhook(t, mux, `{"event":"order","data":{"id":1}}`)
+	waitFor(t, func() bool { s, _ := subs.Get(sub.ID); return s.Acked == 1 })
+
+	mu.Lock()
+	defer mu.Unlock()
+	var data map[string]any
+	json.Unmarshal(body, &data)
+	if data["id"] != 1.0 || got.Header.Get("X-Source") != "echo" || got.Header.Get("X-Echo-Subscription") != "" || got.Header.Get("X-Echo-Id") == "" {
+		t.Errorf("unexpected transformed delivery %s with %v", body, got.Header)
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"time"
+)
+
+// defaultTrashRetention is how long deleted records can be restored, see
+// -trash-retention.
+const defaultTrashRetention = time.Hour
+
+var (
+	errNotInTrash        = errors.New("no deleted webhook with this id")
+	errRestoreTooOld     = errors.New("the buffer is full of newer records")
+	errRestoreDuplicated = errors.New("a newer record has the same idempotency key")
+)
+
+// trashedRecord is a record deleted with Delete or Clear, kept so that it
+// can be restored until expires.
+type trashedRecord struct {
+	item    WebhookParams
+	expires time.Time
+}
+
+// SetTrashRetention keeps records dropped by Delete and Clear for d, during
+// which Restore puts them back. The trash holds at most as many records as
+// the buffer, dropping the oldest deleted first. 0, the default, deletes for
+// good. It must be called before the buffer is used.
+func (rb *RingBuffer) SetTrashRetention(d time.Duration) {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+	rb.trashRetention = d
+}
+
+// toTrash keeps a copy of the deleted item. rb.mu must be held.
+func (rb *RingBuffer) toTrash(item *WebhookParams, now time.Time) {
+	if rb.trashRetention <= 0 {
+		return
+	}
+	rb.trash = append(rb.trash, trashedRecord{item: *item, expires: now.Add(rb.trashRetention)})
+	if over := len(rb.trash) - rb.size; over > 0 {
+		rb.trash = slices.Delete(rb.trash, 0, over)
+	}
+}
+
+// sweepTrash forgets the deleted records past their retention. rb.mu must
+// be held.
+func (rb *RingBuffer) sweepTrash(now time.Time) {
+	rb.trash = slices.DeleteFunc(rb.trash, func(t trashedRecord) bool {
+		return !now.Before(t.expires)
+	})
+}
+
+// Trash returns the deleted records that can still be restored, most
+// recently deleted first.
+func (rb *RingBuffer) Trash() []WebhookParams {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+	rb.sweepTrash(time.Now())
+	items := make([]WebhookParams, 0, len(rb.trash))
+	for i := len(rb.trash) - 1; i >= 0; i-- {
+		items = append(items, rb.trash[i].item)
+	}
+	return items
+}
+
+// Restore puts the deleted record id back where its sequence places it,
+// with its ID and sequence unchanged. When the buffer is full the oldest
+// record is evicted to make room, unless the restored one would be it.
+func (rb *RingBuffer) Restore(id string) (WebhookParams, error) {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+	rb.sweepTrash(time.Now())
+	i := slices.IndexFunc(rb.trash, func(t trashedRecord) bool { return t.item.ID == id })
+	if i < 0 {
+		return WebhookParams{}, errNotInTrash
+	}
+	item := rb.trash[i].item
+	if _, ok := rb.keys[item.IdempotencyKey]; ok && item.IdempotencyKey != "" {
+		return WebhookParams{}, errRestoreDuplicated
+	}
+
+	items := make([]WebhookParams, 0, rb.count+1)
+	for j := rb.count - 1; j >= 0; j-- {
+		items = append(items, *rb.at(rb.newest(j)))
+	}
+	at, _ := slices.BinarySearchFunc(items, item.Sequence, func(e WebhookParams, seq uint64) int {
+		return cmp.Compare(e.Sequence, seq)
+	})
+	if rb.count == rb.size {
+		if at == 0 {
+			return WebhookParams{}, errRestoreTooOld
+		}
+		evicted := items[0]
+		rb.evicted++
+		rb.dropped(lifecycleEvicted, &evicted)
+		items, at = items[1:], at-1
+	}
+	items = slices.Insert(items, at, item)
+	rb.trash = slices.Delete(rb.trash, i, i+1)
+
+	// Rewrite the buffer oldest first from slot 0.
+	clear(rb.keys)
+	for j := range rb.size {
+		var stored WebhookParams
+		if j < len(items) {
+			stored = items[j]
+			if stored.IdempotencyKey != "" {
+				rb.keys[stored.IdempotencyKey] = j
+			}
+		}
+		*rb.slot(j) = stored
+	}
+	rb.count = len(items)
+	rb.head = rb.count % rb.size
+	if expires := rb.expiresAt(&item); !expires.IsZero() && (rb.nextExpiry.IsZero() || expires.Before(rb.nextExpiry)) {
+		rb.nextExpiry = expires
+	}
+	return item, nil
+}
+
+func trashHandler(buffer *RingBuffer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(buffer.Trash())
+	}
+}
+
+// restoreHandler serves POST /webhooks/{id}/restore, which puts a record
+// deleted within -trash-retention back into the store.
+func restoreHandler(buffer *RingBuffer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		item, err := buffer.Restore(r.PathValue("id"))
+		switch {
+		case errors.Is(err, errNotInTrash):
+			writeProblem(w, r, http.StatusNotFound, codeNotFound, "No deleted webhook with id "+r.PathValue("id"))
+			return
+		case err != nil:
+			writeProblem(w, r, http.StatusConflict, codeConflict, "Cannot restore: "+err.Error())
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(item)
+	}
+}
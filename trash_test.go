@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRestoreDeletedRecords(t *testing.T) {
+	buffer := NewRingBuffer(3)
+	buffer.SetTrashRetention(time.Hour)
+	var ids []string
+	for _, event := range []string{"a", "b", "c"} {
+		stored, _ := buffer.Push(WebhookParams{EventType: event, IdempotencyKey: event})
+		ids = append(ids, stored.ID)
+	}
+
+	if n, err := buffer.Delete(map[string]bool{ids[1]: true}); n != 1 || err != nil {
+		t.Fatalf("expected b deleted, got %d %v", n, err)
+	}
+	if n, err := buffer.Clear(); n != 2 || err != nil {
+		t.Fatalf("expected a and c cleared, got %d %v", n, err)
+	}
+	if trash := buffer.Trash(); len(trash) != 3 || trash[0].EventType != "c" {
+		t.Fatalf("expected 3 records in the trash, most recently deleted first, got %+v", trash)
+	}
+
+	for _, id := range []string{ids[2], ids[0], ids[1]} {
+		if _, err := buffer.Restore(id); err != nil {
+			t.Fatalf("restoring %s: %v", id, err)
+		}
+	}
+	items, _ := buffer.Query(context.Background(), QueryFilter{})
+	if len(items) != 3 || items[0].EventType != "c" || items[1].EventType != "b" || items[2].EventType != "a" {
+		t.Errorf("expected the records back in sequence order, got %+v", items)
+	}
+	if _, err := buffer.Restore(ids[0]); err != errNotInTrash {
+		t.Errorf("expected a restored record to leave the trash, got %v", err)
+	}
+	if stored, duplicate := buffer.Push(WebhookParams{EventType: "b", IdempotencyKey: "b"}); !duplicate || stored.ID != ids[1] {
+		t.Errorf("expected the restored idempotency key to be known again, got %+v", stored)
+	}
+
+	// The buffer is full: an older record cannot push out newer ones.
+	buffer.Delete(map[string]bool{ids[0]: true})
+	buffer.Push(WebhookParams{EventType: "d"})
+	if _, err := buffer.Restore(ids[0]); err != errRestoreTooOld {
+		t.Errorf("expected restoring the oldest record into a full buffer to fail, got %v", err)
+	}
+}
+
+func TestTrashRetention(t *testing.T) {
+	buffer := NewRingBuffer(3)
+	buffer.Push(WebhookParams{EventType: "a"})
+	buffer.Clear()
+	if trash := buffer.Trash(); len(trash) != 0 {
+		t.Errorf("expected no trash without a retention, got %+v", trash)
+	}
+
+	buffer.SetTrashRetention(time.Nanosecond)
+	stored, _ := buffer.Push(WebhookParams{EventType: "a"})
+	buffer.Clear()
+	time.Sleep(time.Millisecond)
+	if _, err := buffer.Restore(stored.ID); err != errNotInTrash {
+		t.Errorf("expected an expired record to be gone, got %v", err)
+	}
+}
+
+func TestRestoreHandler(t *testing.T) {
+	buffer := NewRingBuffer(3)
+	buffer.SetTrashRetention(time.Hour)
+	stored, _ := buffer.Push(WebhookParams{EventType: "a"})
+	buffer.Clear()
+	mux := http.NewServeMux()
+	handleAPI(mux, "POST /webhooks/{id}/restore", requireAdmin("secret", restoreHandler(buffer)))
+
+	restore := func(id string) int {
+		req := httptest.NewRequest(http.MethodPost, "/v1/webhooks/"+id+"/restore", nil)
+		req.Header.Set("Authorization", "Bearer secret")
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	if code := restore(stored.ID); code != http.StatusOK || buffer.Len() != 1 {
+		t.Errorf("expected the record restored, got %d with %d records", code, buffer.Len())
+	}
+	if code := restore(stored.ID); code != http.StatusNotFound {
+		t.Errorf("expected 404 for a record not in the trash, got %d", code)
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// trickleHeader lets a sender slow down the response to a single request,
+// with the same syntax as -trickle.
+const trickleHeader = "X-Echo-Trickle"
+
+// trickleTick is how often a trickled response writes a chunk.
+const trickleTick = 100 * time.Millisecond
+
+// defaultTrickle slows down every ingest response when set with -trickle.
+var defaultTrickle Trickle
+
+// Trickle slows down an ingest response, to exercise a sender's client
+// timeouts and its handling of partial responses: Stall holds back the
+// status line and headers, then the body is written at Rate bytes per
+// second. A zero Rate writes the body at once.
+type Trickle struct {
+	Rate  int
+	Stall time.Duration
+}
+
+func (t Trickle) enabled() bool {
+	return t.Rate > 0 || t.Stall > 0
+}
+
+// parseTrickle parses a trickle as rate=BYTES_PER_SECOND,stall=DURATION,
+// e.g. rate=64,stall=5s. Either may be left out.
+func parseTrickle(s string) (Trickle, error) {
+	var t Trickle
+	fields, err := parseLabels(s)
+	if err != nil {
+		return t, err
+	}
+	for key, value := range fields {
+		switch key {
+		case "rate":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 {
+				return t, fmt.Errorf("trickle rate must be a non-negative number of bytes per second, got %q", value)
+			}
+			t.Rate = n
+		case "stall":
+			d, err := time.ParseDuration(value)
+			if err != nil || d < 0 {
+				return t, fmt.Errorf("trickle stall must be a non-negative duration, got %q", value)
+			}
+			t.Stall = d
+		default:
+			return t, fmt.Errorf("unknown trickle %q, expected rate or stall", key)
+		}
+	}
+	return t, nil
+}
+
+// trickleWriter writes a response as its Trickle says, giving up when the
+// sender hangs up.
+type trickleWriter struct {
+	http.ResponseWriter
+	ctx         context.Context
+	trickle     Trickle
+	wroteHeader bool
+	size        int
+	written     int
+}
+
+func newTrickleWriter(w http.ResponseWriter, r *http.Request, t Trickle) *trickleWriter {
+	return &trickleWriter{ResponseWriter: w, ctx: r.Context(), trickle: t}
+}
+
+func (w *trickleWriter) WriteHeader(status int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	if !w.sleep(w.trickle.Stall) {
+		return
+	}
+	w.ResponseWriter.WriteHeader(status)
+	http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+func (w *trickleWriter) Write(p []byte) (int, error) {
+	if !w.wroteHeader {
+		// Announce the full length, so that the sender can tell a response
+		// cut short by its own timeout from a complete one.
+		if w.Header().Get("Content-Length") == "" {
+			w.Header().Set("Content-Length", strconv.Itoa(len(p)))
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+	w.size += len(p)
+	if w.trickle.Rate <= 0 {
+		n, err := w.ResponseWriter.Write(p)
+		w.written += n
+		return n, err
+	}
+	chunk := max(1, w.trickle.Rate*int(trickleTick)/int(time.Second))
+	rc := http.NewResponseController(w.ResponseWriter)
+	written := 0
+	for written < len(p) {
+		if w.ctx.Err() != nil {
+			w.hungUp()
+			return written, w.ctx.Err()
+		}
+		end := min(written+chunk, len(p))
+		n, err := w.ResponseWriter.Write(p[written:end])
+		written += n
+		w.written += n
+		if err != nil {
+			return written, err
+		}
+		rc.Flush()
+		if written < len(p) && !w.sleep(time.Duration(n)*time.Second/time.Duration(w.trickle.Rate)) {
+			w.hungUp()
+			return written, w.ctx.Err()
+		}
+	}
+	return written, nil
+}
+
+// sleep waits d, returning false if the sender hung up meanwhile.
+func (w *trickleWriter) sleep(d time.Duration) bool {
+	if d <= 0 {
+		return w.ctx.Err() == nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-w.ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+func (w *trickleWriter) hungUp() {
+	log.Printf("Sender hung up on a trickled response after %d of %d bytes", w.written, w.size)
+}
+
+func (w *trickleWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseTrickle(t *testing.T) {
+	got, err := parseTrickle("rate=64,stall=5s")
+	if err != nil || got != (Trickle{Rate: 64, Stall: 5 * time.Second}) {
+		t.Errorf("parseTrickle = %+v, %v", got, err)
+	}
+	for _, bad := range []string{"rate=-1", "stall=soon", "speed=1"} {
+		if _, err := parseTrickle(bad); err == nil {
+			t.Errorf("parseTrickle(%q) accepted", bad)
+		}
+	}
+}
+
+func TestTrickledResponse(t *testing.T) {
+	server := httptest.NewServer(newTestServer())
+	defer server.Close()
+
+	body := `{"event":"slow","pad":"0123456789"}`
+	req, _ := http.NewRequest(http.MethodPost, server.URL+"/webhook", strings.NewReader(body))
+	req.Header.Set(trickleHeader, "rate=100,stall=100ms")
+	start := time.Now()
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if stalled := time.Since(start); stalled < 100*time.Millisecond {
+		t.Errorf("headers after %v, want a 100ms stall", stalled)
+	}
+	if resp.ContentLength != int64(len(body)) {
+		t.Errorf("Content-Length = %d, want %d", resp.ContentLength, len(body))
+	}
+	got, err := io.ReadAll(resp.Body)
+	if err != nil || string(got) != body {
+		t.Errorf("body = %q, %v", got, err)
+	}
+	// 36 bytes at 100 bytes per second take about 350ms after the stall.
+	if elapsed := time.Since(start); elapsed < 400*time.Millisecond {
+		t.Errorf("response took %v, want it trickled", elapsed)
+	}
+}
+
+func TestTrickleSenderTimeout(t *testing.T) {
+	server := httptest.NewServer(newTestServer())
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodPost, server.URL+"/webhook", strings.NewReader(`{"event":"stalled"}`))
+	req.Header.Set(trickleHeader, "stall=5s")
+	start := time.Now()
+	if _, err := http.DefaultClient.Do(req); err == nil {
+		t.Fatal("expected the sender to time out")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("timed out after %v", elapsed)
+	}
+}
+
+func TestInvalidTrickleHeader(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(`{"event":"x"}`))
+	req.Header.Set(trickleHeader, "rate=fast")
+	rec := httptest.NewRecorder()
+	newTestServer().ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want 400", rec.Code)
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+)
+
+// inlineBodyLimit is the size, in bytes, of the largest body whose payload
+// query responses show, set with -inline-body-limit; 0 shows them all. It
+// only shapes responses: records over it still keep their payload and raw
+// body in memory, and carry a preview on top.
+var inlineBodyLimit int
+
+// BodyTruncation marks a record whose body is too large to show inline.
+// The record keeps its payload, for filters, replay and delivery, but query
+// responses leave it out and show Preview, the first bytes of the body,
+// instead. The complete body is served from /webhooks/{id}/body.
+type BodyTruncation struct {
+	Size    int    `json:"size"`
+	Preview string `json:"preview"`
+}
+
+// truncateInline marks item, whose body is body, as truncated when body is
+// over inlineBodyLimit.
+func truncateInline(item WebhookParams, body []byte) WebhookParams {
+	if inlineBodyLimit <= 0 || len(body) <= inlineBodyLimit {
+		return item
+	}
+	item.Truncation = &BodyTruncation{Size: len(body), Preview: truncatePreview(body)}
+	return item
+}
+
+// truncatePreview is the first inlineBodyLimit bytes of body. A rune split
+// by the limit is left out.
+func truncatePreview(body []byte) string {
+	return strings.ToValidUTF8(string(body[:min(len(body), inlineBodyLimit)]), "")
+}
+
+// previewItems leaves the payloads of truncated records out of items, as
+// query responses show them. The records are copies, so the buffer keeps
+// their payloads.
+func previewItems(items []WebhookParams) {
+	for i := range items {
+		items[i] = previewRecord(items[i])
+	}
+}
+
+func previewRecord(item WebhookParams) WebhookParams {
+	if item.Truncation != nil {
+		item.Payload = nil
+	}
+	return item
+}
+
+// decodedBody is the body of item decoded as it was for parsing: gunzipped,
+// and for text formats converted to UTF-8.
+func decodedBody(item WebhookParams) ([]byte, error) {
+	normalize := normalizeBody
+	if f := lookupFormat(item.ContentType); f != nil && f.Binary {
+		normalize = gunzipBody
+	}
+	body, _, err := normalize(item.Raw, item.ContentType)
+	return body, err
+}
+
+// bodyWebhookHandler serves the complete body of a record, decoded as it
+// was for parsing, with support for range requests.
+func bodyWebhookHandler(buffer *RingBuffer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		item, ok := buffer.Get(r.PathValue("id"))
+		if !ok {
+			writeProblem(w, r, http.StatusNotFound, codeNotFound, "No webhook with id "+r.PathValue("id"))
+			return
+		}
+		body, err := decodedBody(item)
+		if err != nil {
+			writeProblem(w, r, http.StatusBadRequest, codeUnreadableBody, "Failed to decode body: "+err.Error())
+			return
+		}
+		contentType := "application/json"
+		if lookupFormat(item.ContentType) != nil {
+			contentType = item.ContentType
+		}
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		http.ServeContent(w, r, "", item.ReceivedAt, bytes.NewReader(body))
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestInlineBodyTruncation(t *testing.T) {
+	inlineBodyLimit = 64
+	t.Cleanup(func() { inlineBodyLimit = 0 })
+	mux := newTestServer()
+
+	large := `{"event":"export","data":{"note":"héllo","rows":"` + strings.Repeat("r", 500) + `"}}`
+	rec := postWebhook(t, mux, large)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("ingest failed with %d", rec.Code)
+	}
+	id := rec.Header().Get("X-Echo-Id")
+	postWebhook(t, mux, `{"event":"export","data":{"rows":"few"}}`)
+
+	items := queryWebhooks(t, mux, "/query/export")
+	if len(items) != 2 || items[0].Truncation != nil || items[0].Payload["rows"] != "few" {
+		t.Fatalf("expected the small webhook kept whole, got %+v", items)
+	}
+	truncated := items[1].Truncation
+	if truncated == nil || items[1].Payload != nil || truncated.Size != len(large) || !strings.HasPrefix(large, truncated.Preview) || len(truncated.Preview) > 64 {
+		t.Fatalf("expected the large webhook truncated to a preview, got %+v", items[1])
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/webhooks/"+id+"/body", nil)
+	body := httptest.NewRecorder()
+	mux.ServeHTTP(body, req)
+	if body.Code != http.StatusOK || body.Body.String() != large {
+		t.Errorf("expected the full body, got %d with %d bytes", body.Code, body.Body.Len())
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/webhooks/"+id+"/body", nil)
+	req.Header.Set("Range", "bytes=0-8")
+	part := httptest.NewRecorder()
+	mux.ServeHTTP(part, req)
+	if b, _ := io.ReadAll(part.Body); part.Code != http.StatusPartialContent || string(b) != `{"event":` {
+		t.Errorf("expected a range of the body, got %d %q", part.Code, b)
+	}
+}
+
+func TestTruncateInlineSplitRune(t *testing.T) {
+	inlineBodyLimit = 2
+	t.Cleanup(func() { inlineBodyLimit = 0 })
+	item := truncateInline(WebhookParams{Payload: map[string]any{}}, []byte(`"é"…`))
+	if item.Truncation == nil || item.Truncation.Preview != `"` {
+		t.Errorf("expected the split rune left out, got %+v", item.Truncation)
+	}
+	if b, _ := json.Marshal(item); !strings.Contains(string(b), `"truncation":{"size":7,"preview":"\""}`) {
+		t.Errorf("unexpected record %s", b)
+	}
+}
+
+func TestTruncatedRecordKeepsPayload(t *testing.T) {
+	inlineBodyLimit = 32
+	t.Cleanup(func() { inlineBodyLimit = 0 })
+	buffer := NewRingBuffer(10)
+	mux := http.NewServeMux()
+	registerRoutes(mux, buffer, "secret")
+
+	large := `{"event":"export","data":{"id":"x1","rows":"` + strings.Repeat("r", 200) + `"}}`
+	postWebhook(t, mux, large)
+	items := queryWebhooks(t, mux, "/query/export?id=x1")
+	if len(items) != 1 || items[0].Truncation == nil || items[0].Payload != nil {
+		t.Fatalf("expected the payload filter to match and the response to show a preview, got %+v", items)
+	}
+
+	target, deliveries := newReplayTarget(t)
+	if code, results := postReplay(t, buffer, ReplayRequest{URL: target.URL, Match: json.RawMessage(`{"event_type":"export"}`), Scheme: "hmac-sha256", Secret: "s"}); code != http.StatusOK || len(results) != 1 {
+		t.Fatalf("replay failed with %d: %+v", code, results)
+	}
+	if got := deliveries(); len(got) != 1 || !strings.Contains(string(got[0].body), `"id":"x1"`) {
+		t.Errorf("expected the whole payload replayed, got %q", got)
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"mime"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// twilioAuthToken is the account auth token Twilio signs requests with.
+// twilioBaseURL replaces the scheme and host of the URL Twilio is
+// assumed to have called, for when a proxy or tunnel sits in between.
+var (
+	twilioAuthToken string
+	twilioBaseURL   string
+)
+
+// twilioSignature computes X-Twilio-Signature: the base64 HMAC-SHA1 of the
+// full URL followed by every POST parameter name and value, sorted by name.
+func twilioSignature(token, fullURL string, params url.Values) string {
+	var b strings.Builder
+	b.WriteString(fullURL)
+	keys := make([]string, 0, len(params))
+	for key := range params {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		for _, value := range params[key] {
+			b.WriteString(key)
+			b.WriteString(value)
+		}
+	}
+	mac := hmac.New(sha1.New, []byte(token))
+	mac.Write([]byte(b.String()))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// twilioURL reconstructs the URL Twilio sent r to, as seen by Twilio when
+// behind trusted proxies.
+func twilioURL(r *http.Request) string {
+	if twilioBaseURL != "" {
+		return strings.TrimSuffix(twilioBaseURL, "/") + externalPath(r.URL.RequestURI())
+	}
+	client := clientInfo(r)
+	return client.Proto + "://" + client.Host + externalPath(r.URL.RequestURI())
+}
+
+func isFormContentType(contentType string) bool {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	return mediaType == "application/x-www-form-urlencoded"
+}
+
+// verifyTwilio checks the X-Twilio-Signature of r. Form-encoded requests
+// sign their parameters; JSON requests sign only the URL, which carries the
+// body's SHA-256 in a bodySHA256 parameter.
+func verifyTwilio(r *http.Request, body []byte) *Verification {
+	v := &Verification{Scheme: "twilio"}
+	fullURL := twilioURL(r)
+	var params url.Values
+	if isFormContentType(r.Header.Get("Content-Type")) {
+		var err error
+		if params, err = url.ParseQuery(string(body)); err != nil {
+			v.Detail = "unparseable form body"
+			return v
+		}
+	} else {
+		sum := sha256.Sum256(body)
+		if r.URL.Query().Get("bodySHA256") != hex.EncodeToString(sum[:]) {
+			v.Detail = "bodySHA256 does not match the body"
+			return v
+		}
+	}
+
+	want := twilioSignature(currentSecret(twilioAuthToken), fullURL, params)
+	if !hmac.Equal([]byte(r.Header.Get("X-Twilio-Signature")), []byte(want)) {
+		v.Detail = "signature mismatch for " + fullURL
+		return v
+	}
+	v.Verified = true
+	return v
+}
+
+// twilioWebhook turns a form-encoded Twilio callback into a webhook. The
+// event type is twilio.message or twilio.call when the callback is about
+// one, otherwise just twilio.
+func twilioWebhook(body []byte) (WebhookParams, error) {
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		return WebhookParams{}, &paramError{codeInvalidParameter, "Invalid form body: " + err.Error()}
+	}
+	payload := make(map[string]any, len(form))
+	for key, values := range form {
+		if len(values) == 1 {
+			payload[key] = values[0]
+			continue
+		}
+		list := make([]any, len(values))
+		for i, v := range values {
+			list[i] = v
+		}
+		payload[key] = list
+	}
+
+	event := "twilio"
+	switch {
+	case form.Has("MessageSid") || form.Has("SmsSid"):
+		event = "twilio.message"
+	case form.Has("CallSid"):
+		event = "twilio.call"
+	}
+	return WebhookParams{EventType: event, Payload: payload, Version: form.Get("ApiVersion")}, nil
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestTwilioSignature(t *testing.T) {
+	// The example from Twilio's webhook security documentation.
+	params := url.Values{
+		"CallSid": {"CA1234567890ABCDE"},
+		"Caller":  {"+12349013030"},
+		"Digits":  {"1234"},
+		"From":    {"+12349013030"},
+		"To":      {"+18005551212"},
+	}
+	got := twilioSignature("12345", "https://mycompany.com/myapp.php?foo=1&bar=2", params)
+	if got != "0/KCTR6DLpKmkAf8muzZqo1nDgQ=" {
+		t.Errorf("got %s", got)
+	}
+}
+
+func postTwilio(t *testing.T, mux *http.ServeMux, target, contentType, body, signature string) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, target, strings.NewReader(body))
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("X-Twilio-Signature", signature)
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestTwilioIngest(t *testing.T) {
+	twilioAuthToken, twilioBaseURL = "secret", "https://hooks.example.com"
+	t.Cleanup(func() { twilioAuthToken, twilioBaseURL = "", "" })
+	mux := newTestServer()
+
+	form := url.Values{"MessageSid": {"SM1"}, "Body": {"hello"}, "ApiVersion": {"2010-04-01"}}
+	sig := twilioSignature("secret", "https://hooks.example.com/sms", form)
+	postTwilio(t, mux, "/sms", "application/x-www-form-urlencoded", form.Encode(), sig)
+	postTwilio(t, mux, "/sms", "application/x-www-form-urlencoded", form.Encode(), "forged")
+
+	got := queryWebhooks(t, mux, "/query/twilio.message?Body=hello")
+	if len(got) != 2 || got[0].Version != "2010-04-01" {
+		t.Fatalf("expected 2 messages, got %+v", got)
+	}
+	if v := got[1].Verification; v == nil || !v.Verified || v.Scheme != "twilio" {
+		t.Errorf("expected the signed callback to verify, got %+v", v)
+	}
+	if v := got[0].Verification; v == nil || v.Verified {
+		t.Errorf("expected the forged callback not to verify, got %+v", v)
+	}
+
+	body := `{"event":"twilio.event","data":{"sid":"EV1"}}`
+	sum := sha256.Sum256([]byte(body))
+	target := "/events?bodySHA256=" + hex.EncodeToString(sum[:])
+	postTwilio(t, mux, target, "application/json", body, twilioSignature("secret", "https://hooks.example.com"+target, nil))
+	got = queryWebhooks(t, mux, "/query/twilio.event")
+	if len(got) != 1 || got[0].Verification == nil || !got[0].Verification.Verified {
+		t.Errorf("expected the JSON callback to verify, got %+v", got)
+	}
+}
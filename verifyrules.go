@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"sync"
+)
+
+// verifyRules holds the signature verification rules when configured.
+var verifyRules *VerifyRules
+
+// VerifyRule checks the signature of webhooks posted to paths matching Path,
+// a glob, under Scheme. During a provider's secret rotation both Secret and
+// SecondarySecret are accepted, and the record says which one matched.
+// Either may be a secret reference such as file:PATH.
+type VerifyRule struct {
+	Name            string `json:"name"`
+	Path            string `json:"path,omitempty"`
+	Scheme          string `json:"scheme"`
+	Secret          string `json:"secret"`
+	SecondarySecret string `json:"secondary_secret,omitempty"`
+}
+
+// LoadVerifyRules reads a JSON array of verification rules from path.
+func LoadVerifyRules(path string) ([]VerifyRule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var rules []VerifyRule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return rules, nil
+}
+
+// VerifyRuleStatus reports how a rule's deliveries verified, so that a
+// rotation can be finished once nothing matches the old secret any more.
+// Secrets are left out.
+type VerifyRuleStatus struct {
+	Name             string `json:"name"`
+	Path             string `json:"path,omitempty"`
+	Scheme           string `json:"scheme"`
+	HasSecondary     bool   `json:"has_secondary"`
+	PrimaryMatches   int    `json:"primary_matches"`
+	SecondaryMatches int    `json:"secondary_matches"`
+	Failed           int    `json:"failed"`
+}
+
+type verifyState struct {
+	rule   VerifyRule
+	scheme SignatureScheme
+	status VerifyRuleStatus
+}
+
+// VerifyRules verifies ingested webhooks by the first rule matching their
+// path.
+type VerifyRules struct {
+	mu    sync.Mutex
+	rules []*verifyState
+}
+
+func NewVerifyRules(rules []VerifyRule) (*VerifyRules, error) {
+	v := &VerifyRules{}
+	for _, rule := range rules {
+		if rule.Name == "" {
+			return nil, errors.New("verify rule without name")
+		}
+		if _, err := path.Match(rule.Path, ""); err != nil {
+			return nil, fmt.Errorf("verify rule %s: invalid pattern %q", rule.Name, rule.Path)
+		}
+		scheme, ok := signatureSchemes[rule.Scheme]
+		if !ok {
+			return nil, fmt.Errorf("verify rule %s: unknown scheme %q", rule.Name, rule.Scheme)
+		}
+		if rule.Secret == "" {
+			return nil, fmt.Errorf("verify rule %s: secret is required", rule.Name)
+		}
+		if err := secrets.Load(rule.Secret, rule.SecondarySecret); err != nil {
+			return nil, fmt.Errorf("verify rule %s: %w", rule.Name, err)
+		}
+		v.rules = append(v.rules, &verifyState{
+			rule:   rule,
+			scheme: scheme,
+			status: VerifyRuleStatus{Name: rule.Name, Path: rule.Path, Scheme: rule.Scheme, HasSecondary: rule.SecondarySecret != ""},
+		})
+	}
+	return v, nil
+}
+
+// Verify checks the signature of r, whose body was raw, under the first
+// rule matching its path. It returns nil when no rule matches.
+func (v *VerifyRules) Verify(r *http.Request, raw []byte) *Verification {
+	for _, s := range v.rules {
+		if !globMatch(s.rule.Path, r.URL.Path) {
+			continue
+		}
+		result := &Verification{Scheme: s.scheme.Name}
+		header := r.Header.Get(s.scheme.header)
+		ts := signatureTimestamp(s.scheme, r.Header)
+		switch {
+		case header == "":
+			result.Detail = "no " + s.scheme.header + " header"
+		case s.scheme.Verify(currentSecret(s.rule.Secret), raw, ts, header):
+			result.Verified, result.Secret = true, "primary"
+		case s.rule.SecondarySecret != "" && s.scheme.Verify(currentSecret(s.rule.SecondarySecret), raw, ts, header):
+			result.Verified, result.Secret = true, "secondary"
+		default:
+			result.Detail = "signature mismatch"
+		}
+
+		v.mu.Lock()
+		switch result.Secret {
+		case "primary":
+			s.status.PrimaryMatches++
+		case "secondary":
+			s.status.SecondaryMatches++
+		default:
+			s.status.Failed++
+		}
+		v.mu.Unlock()
+		return result
+	}
+	return nil
+}
+
+func (v *VerifyRules) Status() []VerifyRuleStatus {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	statuses := make([]VerifyRuleStatus, len(v.rules))
+	for i, s := range v.rules {
+		statuses[i] = s.status
+	}
+	return statuses
+}
+
+func verifyRulesHandler(v *VerifyRules) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(v.Status())
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestVerifyRulesSecondarySecret(t *testing.T) {
+	rules, err := NewVerifyRules([]VerifyRule{
+		{Name: "github", Path: "/github/*", Scheme: "github", Secret: "new", SecondarySecret: "old"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifyRules = rules
+	t.Cleanup(func() { verifyRules = nil })
+
+	mux := newTestServer()
+	body := `{"event_type":"push"}`
+	github := signatureSchemes["github"]
+	for _, secret := range []string{"new", "old", "wrong"} {
+		req := httptest.NewRequest(http.MethodPost, "/github/hooks", strings.NewReader(body))
+		req.Header.Set(github.header, github.Sign(secret, []byte(body), ""))
+		mux.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	postWebhook(t, mux, body)
+
+	items := queryWebhooks(t, mux, "/query/push")
+	if len(items) != 4 {
+		t.Fatalf("got %d records, want 4", len(items))
+	}
+	want := []struct {
+		verified bool
+		secret   string
+	}{{false, ""}, {false, ""}, {true, "secondary"}, {true, "primary"}}
+	for i, item := range items {
+		v := item.Verification
+		if i == 0 {
+			if v != nil {
+				t.Errorf("unmatched path verified: %+v", v)
+			}
+			continue
+		}
+		if v == nil || v.Verified != want[i].verified || v.Secret != want[i].secret {
+			t.Errorf("record %d verification = %+v, want verified=%v secret=%q", i, v, want[i].verified, want[i].secret)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	verifyRulesHandler(rules)(rec, httptest.NewRequest(http.MethodGet, "/verify-rules", nil))
+	var statuses []VerifyRuleStatus
+	if err := json.Unmarshal(rec.Body.Bytes(), &statuses); err != nil {
+		t.Fatal(err)
+	}
+	got := statuses[0]
+	if got.PrimaryMatches != 1 || got.SecondaryMatches != 1 || got.Failed != 1 || !got.HasSecondary {
+		t.Errorf("status = %+v", got)
+	}
+	if strings.Contains(rec.Body.String(), "old") {
+		t.Errorf("status leaks a secret: %s", rec.Body)
+	}
+}
+
+func TestNewVerifyRulesRejectsInvalid(t *testing.T) {
+	for _, rule := range []VerifyRule{
+		{Scheme: "github", Secret: "s"},
+		{Name: "scheme", Scheme: "nope", Secret: "s"},
+		{Name: "secret", Scheme: "github"},
+		{Name: "pattern", Path: "[", Scheme: "github", Secret: "s"},
+	} {
+		if _, err := NewVerifyRules([]VerifyRule{rule}); err == nil {
+			t.Errorf("rule %+v accepted", rule)
+		}
+	}
+}
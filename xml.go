@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// xmlNode collects an element while it is being decoded.
+type xmlNode struct {
+	name   string
+	fields map[string]any
+	text   strings.Builder
+}
+
+// value converts the element to its payload form: a string for a plain text
+// element, otherwise an object with attributes under "@name", children by
+// name (repeated children as arrays) and any text under "#text".
+func (n *xmlNode) value() any {
+	text := strings.TrimSpace(n.text.String())
+	if len(n.fields) == 0 {
+		return text
+	}
+	if text != "" {
+		n.fields["#text"] = text
+	}
+	return n.fields
+}
+
+func (n *xmlNode) add(key string, value any) {
+	if n.fields == nil {
+		n.fields = make(map[string]any)
+	}
+	switch existing := n.fields[key].(type) {
+	case nil:
+		n.fields[key] = value
+	case []any:
+		n.fields[key] = append(existing, value)
+	default:
+		n.fields[key] = []any{existing, value}
+	}
+}
+
+// parseXML decodes an XML document into its root element's name and payload
+// form. Namespaces are dropped below the root. The body has already been
+// converted to UTF-8, so the declared encoding is ignored.
+func parseXML(body []byte) (root xml.Name, value any, err error) {
+	dec := xml.NewDecoder(bytes.NewReader(body))
+	dec.CharsetReader = func(_ string, r io.Reader) (io.Reader, error) { return r, nil }
+
+	var stack []*xmlNode
+	for {
+		tok, err := dec.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return root, nil, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if root.Local != "" && len(stack) == 0 {
+				return root, nil, errors.New("multiple root elements")
+			}
+			node := &xmlNode{name: t.Name.Local}
+			for _, attr := range t.Attr {
+				if attr.Name.Space == "xmlns" || attr.Name.Local == "xmlns" {
+					continue
+				}
+				node.add("@"+attr.Name.Local, attr.Value)
+			}
+			if len(stack) == 0 {
+				root = t.Name
+			}
+			stack = append(stack, node)
+		case xml.CharData:
+			if len(stack) > 0 {
+				stack[len(stack)-1].text.Write(t)
+			}
+		case xml.EndElement:
+			node := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			if len(stack) == 0 {
+				value = node.value()
+			} else {
+				stack[len(stack)-1].add(node.name, node.value())
+			}
+		}
+	}
+	if root.Local == "" {
+		return root, nil, errors.New("no root element")
+	}
+	return root, value, nil
+}
+
+// parseXMLWebhook turns an XML callback into a webhook. XML has no envelope,
+// so the root element name is used as the event type and the payload holds
+// the document under that name, making /order/status address
+// <order><status>. SOAP envelopes are unwrapped, see soapWebhook.
+func parseXMLWebhook(body []byte) (WebhookParams, error) {
+	root, value, err := parseXML(body)
+	if err != nil {
+		return WebhookParams{}, err
+	}
+	if version, ok := soapVersions[root.Space]; ok && root.Local == "Envelope" {
+		return soapWebhook(body, version, value)
+	}
+	return WebhookParams{EventType: root.Local, Payload: map[string]any{root.Local: value}}, nil
+}
+
+type xpathStep struct {
+	name  string // element or "@attribute" name, "*" for any
+	index int    // 1-based position among same-named siblings, 0 for any
+}
+
+// xpathCond is a "/a/b[2]/@c=value" condition. Without "=value" it only
+// requires the path to exist. It applies to any payload, not just XML:
+// /order/status addresses {"order": {"status": ...}} either way.
+type xpathCond struct {
+	steps    []xpathStep
+	value    string
+	hasValue bool
+}
+
+func parseXPath(expr string) (xpathCond, error) {
+	var cond xpathCond
+	path := expr
+	if p, v, ok := strings.Cut(expr, "="); ok {
+		path, cond.value, cond.hasValue = p, strings.Trim(v, `'"`), true
+	}
+	if !strings.HasPrefix(path, "/") || path == "/" {
+		return cond, fmt.Errorf("xpath %q must be an absolute path such as /order/status", expr)
+	}
+	for _, part := range strings.Split(path[1:], "/") {
+		step := xpathStep{name: part}
+		if name, idx, ok := strings.Cut(part, "["); ok {
+			n, err := strconv.Atoi(strings.TrimSuffix(idx, "]"))
+			if err != nil || n < 1 || !strings.HasSuffix(idx, "]") {
+				return cond, fmt.Errorf("xpath %q: invalid index in %q", expr, part)
+			}
+			step = xpathStep{name: name, index: n}
+		}
+		if step.name == "" {
+			return cond, fmt.Errorf("xpath %q: empty step", expr)
+		}
+		cond.steps = append(cond.steps, step)
+	}
+	return cond, nil
+}
+
+// selectNodes returns every value the steps lead to from current.
+func selectNodes(current any, steps []xpathStep) []any {
+	if len(steps) == 0 {
+		return []any{current}
+	}
+	obj, ok := current.(map[string]any)
+	if !ok {
+		return nil
+	}
+
+	var candidates []any
+	if steps[0].name == "*" {
+		for key, v := range obj {
+			if !strings.HasPrefix(key, "@") && key != "#text" {
+				candidates = append(candidates, v)
+			}
+		}
+	} else if v, ok := obj[steps[0].name]; ok {
+		candidates = []any{v}
+	}
+
+	var out []any
+	for _, c := range candidates {
+		siblings, repeated := c.([]any)
+		if !repeated {
+			siblings = []any{c}
+		}
+		if i := steps[0].index; i > 0 {
+			if i > len(siblings) {
+				continue
+			}
+			siblings = siblings[i-1 : i]
+		}
+		for _, s := range siblings {
+			out = append(out, selectNodes(s, steps[1:])...)
+		}
+	}
+	return out
+}
+
+// Match reports whether any node selected by the path exists and, if a value
+// is given, has that string value. Elements with attributes compare their
+// text content.
+func (c xpathCond) Match(payload map[string]any) bool {
+	for _, node := range selectNodes(payload, c.steps) {
+		if !c.hasValue {
+			return true
+		}
+		if obj, ok := node.(map[string]any); ok {
+			node = obj["#text"]
+		}
+		if node != nil && valueEquals(node, c.value) {
+			return true
+		}
+	}
+	return false
+}
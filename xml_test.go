@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+const orderXML = `<?xml version="1.0" encoding="ISO-8859-1"?>
+<order id="42" xmlns="urn:example">
+  <status>shipped</status>
+  <item sku="A1"><qty>2</qty></item>
+  <item sku="B2"><qty>1</qty></item>
+  <note lang="en">Leave at door</note>
+</order>`
+
+func postXML(t *testing.T, mux *http.ServeMux, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/xml")
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestParseXML(t *testing.T) {
+	root, value, err := parseXML([]byte(orderXML))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]any{
+		"@id":    "42",
+		"status": "shipped",
+		"item": []any{
+			map[string]any{"@sku": "A1", "qty": "2"},
+			map[string]any{"@sku": "B2", "qty": "1"},
+		},
+		"note": map[string]any{"@lang": "en", "#text": "Leave at door"},
+	}
+	if root.Local != "order" || !reflect.DeepEqual(value, want) {
+		t.Errorf("got %s %#v", root, value)
+	}
+
+	for _, bad := range []string{"", "<a></b>", "<a/><b/>"} {
+		if _, _, err := parseXML([]byte(bad)); err == nil {
+			t.Errorf("expected %q to be rejected", bad)
+		}
+	}
+}
+
+func TestXPathConditions(t *testing.T) {
+	_, value, _ := parseXML([]byte(orderXML))
+	payload := map[string]any{"order": value}
+
+	tests := map[string]bool{
+		"/order/status=shipped":     true,
+		"/order/status=pending":     false,
+		"/order/@id=42":             true,
+		"/order/item/@sku=B2":       true,
+		"/order/item[1]/@sku=B2":    false,
+		"/order/item[2]/qty='1'":    true,
+		"/order/note=Leave at door": true,
+		"/order/*/qty=2":            true,
+		"/order/refund":             false,
+		"/order/note/@lang":         true,
+	}
+	for expr, want := range tests {
+		cond, err := parseXPath(expr)
+		if err != nil {
+			t.Errorf("%s: %v", expr, err)
+			continue
+		}
+		if got := cond.Match(payload); got != want {
+			t.Errorf("%s: got %v, want %v", expr, got, want)
+		}
+	}
+
+	for _, bad := range []string{"order/status", "/", "/order//status", "/item[x]"} {
+		if _, err := parseXPath(bad); err == nil {
+			t.Errorf("expected %q to be rejected", bad)
+		}
+	}
+}
+
+func TestIngestXMLAndQueryByXPath(t *testing.T) {
+	mux := newTestServer()
+	rec := postXML(t, mux, orderXML)
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/xml" {
+		t.Fatalf("expected the XML to be echoed, got %d %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	postXML(t, mux, `<order><status>pending</status></order>`)
+
+	if got := queryWebhooks(t, mux, "/query/order?xpath=/order/status=shipped"); len(got) != 1 {
+		t.Errorf("expected 1 shipped order, got %d", len(got))
+	}
+	if got := queryWebhooks(t, mux, "/query/order?xpath=/order/item"); len(got) != 1 {
+		t.Errorf("expected 1 order with items, got %d", len(got))
+	}
+
+	if rec := postXML(t, mux, "<order>"); rec.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400 for malformed XML, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,318 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// parseYAML parses the block-style YAML that go-vcr and most hand-written
+// configuration use into maps, slices, strings, booleans and json.Numbers:
+// mappings, sequences, plain and quoted scalars, literal and folded block
+// scalars, and flow collections that are also JSON. Anchors, tags and
+// multiple documents are not supported.
+func parseYAML(s string) (any, error) {
+	p := &yamlParser{lines: strings.Split(strings.ReplaceAll(s, "\r\n", "\n"), "\n")}
+	v, err := p.block(0)
+	if err != nil {
+		return nil, err
+	}
+	if _, text, ok := p.peek(); ok {
+		return nil, fmt.Errorf("yaml line %d: unexpected %q", p.pos+1, text)
+	}
+	return v, nil
+}
+
+type yamlParser struct {
+	lines []string
+	pos   int
+}
+
+// peek skips blank lines, comments and document markers, returning the
+// indentation and text of the next significant line.
+func (p *yamlParser) peek() (int, string, bool) {
+	for ; p.pos < len(p.lines); p.pos++ {
+		line := p.lines[p.pos]
+		text := strings.TrimLeft(line, " ")
+		if text == "" || strings.HasPrefix(text, "#") || text == "---" || text == "..." {
+			continue
+		}
+		return len(line) - len(text), strings.TrimRight(text, " \t"), true
+	}
+	return 0, "", false
+}
+
+func isSeqItem(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+// block parses the node starting on the next line indented at least indent.
+func (p *yamlParser) block(indent int) (any, error) {
+	ind, text, ok := p.peek()
+	if !ok || ind < indent {
+		return nil, nil
+	}
+	if isSeqItem(text) {
+		return p.seq(ind)
+	}
+	return p.mapping(ind)
+}
+
+func (p *yamlParser) seq(indent int) (any, error) {
+	items := []any{}
+	for {
+		ind, text, ok := p.peek()
+		if !ok || ind != indent || !isSeqItem(text) {
+			return items, nil
+		}
+		content := strings.TrimLeft(strings.TrimPrefix(text, "-"), " ")
+		if content == "" {
+			p.pos++
+			item, err := p.block(indent + 1)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+			continue
+		}
+		if _, _, isKey := splitYAMLKey(content); isKey {
+			// The item is a mapping starting on the dash's line: parse it as
+			// if the dash were a space.
+			itemIndent := indent + len(text) - len(content)
+			p.lines[p.pos] = strings.Repeat(" ", itemIndent) + content
+			item, err := p.mapping(itemIndent)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+			continue
+		}
+		p.pos++
+		item, err := p.value(content, indent)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+}
+
+func (p *yamlParser) mapping(indent int) (any, error) {
+	m := map[string]any{}
+	for {
+		ind, text, ok := p.peek()
+		if !ok || ind < indent || (ind == indent && isSeqItem(text)) {
+			return m, nil
+		}
+		if ind > indent {
+			return nil, fmt.Errorf("yaml line %d: unexpected indentation", p.pos+1)
+		}
+		key, rest, ok := splitYAMLKey(text)
+		if !ok {
+			return nil, fmt.Errorf("yaml line %d: expected a key, got %q", p.pos+1, text)
+		}
+		p.pos++
+		var v any
+		var err error
+		if rest == "" {
+			if next, nextText, ok := p.peek(); ok && (next > indent || next == indent && isSeqItem(nextText)) {
+				v, err = p.block(next)
+			}
+		} else {
+			v, err = p.value(rest, indent)
+		}
+		if err != nil {
+			return nil, err
+		}
+		m[key] = v
+	}
+}
+
+// splitYAMLKey splits "key: value" into its key and value.
+func splitYAMLKey(text string) (string, string, bool) {
+	if strings.HasPrefix(text, `"`) || strings.HasPrefix(text, "'") {
+		end := closingQuote(text)
+		if end < 0 || !strings.HasPrefix(text[end+1:], ":") {
+			return "", "", false
+		}
+		key, err := unquoteYAML(text[:end+1])
+		rest := text[end+2:]
+		if err != nil || (rest != "" && rest[0] != ' ') {
+			return "", "", false
+		}
+		return key, strings.TrimSpace(rest), true
+	}
+	if strings.HasPrefix(text, "{") || strings.HasPrefix(text, "[") {
+		return "", "", false
+	}
+	for i := 0; i < len(text); i++ {
+		if text[i] == ':' && (i == len(text)-1 || text[i+1] == ' ') {
+			return text[:i], strings.TrimSpace(text[i+1:]), true
+		}
+		if text[i] == ' ' && i+1 < len(text) && text[i+1] == '#' {
+			break
+		}
+	}
+	return "", "", false
+}
+
+// value parses a scalar or flow collection starting with text on the line
+// of a key or sequence item indented at indent, reading any block scalar or
+// continuation lines that follow.
+func (p *yamlParser) value(text string, indent int) (any, error) {
+	switch {
+	case strings.HasPrefix(text, "|") || strings.HasPrefix(text, ">"):
+		return p.blockScalar(text, indent)
+	case strings.HasPrefix(text, "{") || strings.HasPrefix(text, "["):
+		var v any
+		if err := json.Unmarshal([]byte(text), &v); err != nil {
+			return nil, fmt.Errorf("yaml line %d: unsupported flow collection %q", p.pos, text)
+		}
+		return v, nil
+	case strings.HasPrefix(text, `"`) || strings.HasPrefix(text, "'"):
+		quoted := text
+		for closingQuote(quoted) < 0 {
+			if p.pos >= len(p.lines) {
+				return nil, fmt.Errorf("yaml: unterminated quoted scalar")
+			}
+			quoted += p.continuation()
+		}
+		return unquoteYAML(strings.TrimSpace(quoted))
+	}
+	plain := stripYAMLComment(text)
+	for {
+		ind, next, ok := p.peek()
+		if !ok || ind <= indent {
+			break
+		}
+		if _, _, isKey := splitYAMLKey(next); isKey {
+			return nil, fmt.Errorf("yaml line %d: unexpected indentation", p.pos+1)
+		}
+		plain += strings.TrimRight(p.continuation(), " ")
+	}
+	return plainScalar(plain), nil
+}
+
+// continuation reads the next line of a scalar folded over several lines.
+// A blank line stands for a newline, any other line break for a space.
+func (p *yamlParser) continuation() string {
+	line := strings.TrimSpace(p.lines[p.pos])
+	p.pos++
+	if line == "" {
+		return "\n"
+	}
+	return " " + line
+}
+
+func (p *yamlParser) blockScalar(header string, indent int) (any, error) {
+	header = stripYAMLComment(header)
+	folded, chomp, explicit := header[0] == '>', byte(0), 0
+	for _, c := range header[1:] {
+		switch {
+		case c == '-' || c == '+':
+			chomp = byte(c)
+		case c >= '1' && c <= '9':
+			explicit = int(c - '0')
+		default:
+			return nil, fmt.Errorf("yaml line %d: invalid block scalar header %q", p.pos, header)
+		}
+	}
+	blockIndent := 0
+	if explicit > 0 {
+		blockIndent = indent + explicit
+	}
+	var lines []string
+	for ; p.pos < len(p.lines); p.pos++ {
+		line := strings.TrimRight(p.lines[p.pos], "\r")
+		text := strings.TrimLeft(line, " ")
+		ind := len(line) - len(text)
+		if text == "" {
+			lines = append(lines, "")
+			continue
+		}
+		if blockIndent == 0 {
+			if ind <= indent {
+				break
+			}
+			blockIndent = ind
+		}
+		if ind < blockIndent {
+			break
+		}
+		lines = append(lines, line[blockIndent:])
+	}
+
+	content := len(lines)
+	for content > 0 && lines[content-1] == "" {
+		content--
+	}
+	var b strings.Builder
+	for i, line := range lines[:content] {
+		if i > 0 {
+			if folded && line != "" && lines[i-1] != "" && !strings.HasPrefix(line, " ") {
+				b.WriteByte(' ')
+			} else {
+				b.WriteByte('\n')
+			}
+		}
+		b.WriteString(line)
+	}
+	switch {
+	case chomp == '+':
+		b.WriteString(strings.Repeat("\n", len(lines)-content+1))
+	case chomp == 0 && content > 0:
+		b.WriteByte('\n')
+	}
+	return b.String(), nil
+}
+
+// closingQuote returns the index of the quote closing the scalar text
+// starts with, or -1.
+func closingQuote(text string) int {
+	quote := text[0]
+	for i := 1; i < len(text); i++ {
+		switch {
+		case quote == '"' && text[i] == '\\':
+			i++
+		case text[i] == quote && quote == '\'' && i+1 < len(text) && text[i+1] == '\'':
+			i++
+		case text[i] == quote:
+			return i
+		}
+	}
+	return -1
+}
+
+func unquoteYAML(quoted string) (string, error) {
+	if quoted[0] == '\'' {
+		return strings.ReplaceAll(quoted[1:len(quoted)-1], "''", "'"), nil
+	}
+	var s string
+	if err := json.Unmarshal([]byte(quoted), &s); err == nil {
+		return s, nil
+	}
+	// YAML escapes JSON does not know, such as \x41.
+	return strconv.Unquote(quoted)
+}
+
+func stripYAMLComment(text string) string {
+	if i := strings.Index(text, " #"); i >= 0 {
+		text = text[:i]
+	}
+	return strings.TrimSpace(text)
+}
+
+func plainScalar(s string) any {
+	switch s {
+	case "", "~", "null", "Null", "NULL":
+		return nil
+	case "true", "True", "TRUE":
+		return true
+	case "false", "False", "FALSE":
+		return false
+	}
+	if (s[0] == '-' || s[0] >= '0' && s[0] <= '9') && json.Valid([]byte(s)) {
+		return json.Number(s)
+	}
+	return s
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestParseYAML(t *testing.T) {
+	doc := `---
+# a comment
+version: 2
+name: "quoted \"name\""
+single: 'it''s'
+empty: {}
+list: ["a", "b"]
+plain: folded
+    over two lines
+literal: |
+    line one
+    line two
+stripped: |-
+    no newline
+nested:
+    - id: 0
+      flag: true
+      tags:
+        - x
+        - "y"
+    - id: 1
+      missing: ~
+sameIndent:
+- 1
+- -2.5
+url: https://example.com/a#frag # trailing comment
+`
+	got, err := parseYAML(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]any{
+		"version":  json.Number("2"),
+		"name":     `quoted "name"`,
+		"single":   "it's",
+		"empty":    map[string]any{},
+		"list":     []any{"a", "b"},
+		"plain":    "folded over two lines",
+		"literal":  "line one\nline two\n",
+		"stripped": "no newline",
+		"nested": []any{
+			map[string]any{"id": json.Number("0"), "flag": true, "tags": []any{"x", "y"}},
+			map[string]any{"id": json.Number("1"), "missing": nil},
+		},
+		"sameIndent": []any{json.Number("1"), json.Number("-2.5")},
+		"url":        "https://example.com/a#frag",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseYAML =\n%#v\nwant\n%#v", got, want)
+	}
+}
+
+func TestParseYAMLErrors(t *testing.T) {
+	for _, doc := range []string{
+		"a: 1\n  b: 2\n",
+		"key: \"unterminated\n",
+		"just a scalar line\nkey: 1\n",
+	} {
+		if _, err := parseYAML(doc); err == nil {
+			t.Errorf("parseYAML(%q) accepted", doc)
+		}
+	}
+}